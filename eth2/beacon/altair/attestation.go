@@ -10,24 +10,99 @@ import (
 	"github.com/protolambda/zrnt/eth2/util/math"
 )
 
-func ProcessAttestations(ctx context.Context, spec *common.Spec, epc *common.EpochsContext, state AltairLikeBeaconState, ops []phase0.Attestation) error {
+// ProcessAttestations processes the attestations of a block, verifying the signatures in parallel.
+// See ProcessAttestationsParallel.
+func ProcessAttestations(ctx context.Context, spec *common.Spec, epc *common.EpochsContext, tr *common.Transition, state AltairLikeBeaconState, ops []phase0.Attestation) error {
+	return ProcessAttestationsParallel(ctx, spec, epc, tr, state, ops, 0)
+}
+
+// ProcessAttestationsParallel processes the attestations in three steps:
+//  1. all attestations are checked and converted to indexed form, sequentially.
+//  2. the signatures of all attestations are verified individually, by a pool of workers.
+//     If parallelism <= 0, a worker per CPU is used. During a batched block transition,
+//     the signatures are added to the signature batch of the block instead, and skipped in a trusted transition.
+//  3. only if all attestations are valid, the participation flags and proposer rewards are updated, sequentially and in order.
+//
+// The error identifies the index of the first invalid attestation.
+func ProcessAttestationsParallel(ctx context.Context, spec *common.Spec, epc *common.EpochsContext, tr *common.Transition,
+	state AltairLikeBeaconState, ops []phase0.Attestation, parallelism int) error {
+	indexed := make([]*phase0.IndexedAttestation, len(ops))
+	applyFlags := make([]ParticipationFlags, len(ops))
+	domains := make([]common.BLSDomain, len(ops))
 	for i := range ops {
 		if err := ctx.Err(); err != nil {
 			return err
 		}
-		if err := ProcessAttestation(spec, epc, state, &ops[i]); err != nil {
+		indexedAtt, flags, err := ValidateAttestationNoSignature(spec, epc, state, &ops[i])
+		if err != nil {
+			return fmt.Errorf("attestation %d is invalid: %v", i, err)
+		}
+		dom, err := common.GetDomain(state, common.DOMAIN_BEACON_ATTESTER, indexedAtt.Data.Target.Epoch)
+		if err != nil {
+			return err
+		}
+		indexed[i] = indexedAtt
+		applyFlags[i] = flags
+		domains[i] = dom
+	}
+	if tr != nil && (tr.SignatureBatch != nil || tr.SkipSignatures) {
+		// the signatures are verified together with the other signatures of the block, or skipped
+		for i := range ops {
+			desc := fmt.Sprintf("attestation %d", i)
+			if err := phase0.VerifyIndexedAttestationSignature(spec, epc, tr, desc, domains[i], indexed[i]); err != nil {
+				return fmt.Errorf("attestation %d is invalid: attestation could not be verified in its indexed form: %v", i, err)
+			}
+		}
+	} else {
+		err := common.ParallelRange(ctx, len(ops), parallelism, func(i int) error {
+			if err := phase0.ValidateIndexedAttestationSignature(spec, domains[i], epc.ValidatorPubkeyCache, indexed[i]); err != nil {
+				return fmt.Errorf("attestation %d is invalid: attestation could not be verified in its indexed form: %v", i, err)
+			}
+			return nil
+		})
+		if err != nil {
 			return err
 		}
 	}
+	tr.CountSignatures(string(common.OpAttestation), len(ops))
+	for i := range ops {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		tr.TraceBeforeOp(state, common.OpAttestation, i)
+		err := applyAttestation(spec, epc, state, indexed[i], applyFlags[i])
+		tr.TraceAfterOp(state, common.OpAttestation, i, err)
+		if err != nil {
+			return fmt.Errorf("failed to apply attestation %d: %v", i, err)
+		}
+	}
 	return nil
 }
 
 func ProcessAttestation(spec *common.Spec, epc *common.EpochsContext, state AltairLikeBeaconState, attestation *phase0.Attestation) error {
+	indexedAtt, applyFlags, err := ValidateAttestationNoSignature(spec, epc, state, attestation)
+	if err != nil {
+		return err
+	}
+	dom, err := common.GetDomain(state, common.DOMAIN_BEACON_ATTESTER, indexedAtt.Data.Target.Epoch)
+	if err != nil {
+		return err
+	}
+	if err := phase0.VerifyIndexedAttestationSignature(spec, epc, nil, "attestation", dom, indexedAtt); err != nil {
+		return fmt.Errorf("attestation could not be verified in its indexed form: %v", err)
+	}
+	return applyAttestation(spec, epc, state, indexedAtt, applyFlags)
+}
+
+// ValidateAttestationNoSignature checks the attestation against the state, except for the signature,
+// and returns it in indexed form, with the participation flags to apply.
+func ValidateAttestationNoSignature(spec *common.Spec, epc *common.EpochsContext, state common.BeaconState,
+	attestation *phase0.Attestation) (*phase0.IndexedAttestation, ParticipationFlags, error) {
 	data := &attestation.Data
 
 	currentSlot, err := state.Slot()
 	if err != nil {
-		return err
+		return nil, 0, err
 	}
 
 	currentEpoch := spec.SlotToEpoch(currentSlot)
@@ -35,51 +110,63 @@ func ProcessAttestation(spec *common.Spec, epc *common.EpochsContext, state Alta
 
 	// Check target
 	if data.Target.Epoch < previousEpoch {
-		return errors.New("attestation data is invalid, target is too far in past")
+		return nil, 0, errors.New("attestation data is invalid, target is too far in past")
 	} else if data.Target.Epoch > currentEpoch {
-		return errors.New("attestation data is invalid, target is in future")
+		return nil, 0, errors.New("attestation data is invalid, target is in future")
 	}
 	// And if it matches the slot
 	if data.Target.Epoch != spec.SlotToEpoch(data.Slot) {
-		return errors.New("attestation data is invalid, slot epoch does not match target epoch")
+		return nil, 0, errors.New("attestation data is invalid, slot epoch does not match target epoch")
 	}
 
 	// safe additions, slot converts to a valid epoch, thus must be low
 	if !(currentSlot <= data.Slot+spec.SLOTS_PER_EPOCH) {
-		return errors.New("attestation slot is too old")
+		return nil, 0, errors.New("attestation slot is too old")
 	}
 	if !(data.Slot+spec.MIN_ATTESTATION_INCLUSION_DELAY <= currentSlot) {
-		return errors.New("attestation is too new")
+		return nil, 0, errors.New("attestation is too new")
 	}
 
 	// Check committee index
 	if commCount, err := epc.GetCommitteeCountPerSlot(data.Target.Epoch); err != nil {
-		return err
+		return nil, 0, err
 	} else if uint64(data.Index) >= commCount {
-		return errors.New("attestation data is invalid, committee index out of range")
+		return nil, 0, errors.New("attestation data is invalid, committee index out of range")
 	}
 
 	// Note: this checks the source checkpoint.
 	applyFlags, err := GetApplicableAttestationParticipationFlags(spec, state, data, currentSlot-data.Slot)
 	if err != nil {
-		return err
+		return nil, 0, err
 	}
 
-	// Check signature and bitfields
+	// Check bitfields
 	committee, err := epc.GetBeaconCommittee(data.Slot, data.Index)
 	if err != nil {
-		return err
+		return nil, 0, err
 	}
-	indexedAtt, err := attestation.ConvertToIndexed(spec, committee)
+	indexedAtt, err := attestation.ConvertToIndexedWithCache(spec, epc, committee)
 	if err != nil {
-		return fmt.Errorf("attestation could not be converted to an indexed attestation: %v", err)
-	} else if err := phase0.ValidateIndexedAttestation(spec, epc, state, indexedAtt); err != nil {
-		return fmt.Errorf("attestation could not be verified in its indexed form: %v", err)
+		return nil, 0, fmt.Errorf("attestation could not be converted to an indexed attestation: %v", err)
+	}
+	if err := phase0.ValidateIndexedAttestation(spec, epc, state, indexedAtt, false); err != nil {
+		return nil, 0, fmt.Errorf("attestation could not be verified in its indexed form: %v", err)
 	}
+	return indexedAtt, applyFlags, nil
+}
+
+// applyAttestation updates the participation flags and rewards the proposer for the already validated attestation.
+func applyAttestation(spec *common.Spec, epc *common.EpochsContext, state AltairLikeBeaconState,
+	indexedAtt *phase0.IndexedAttestation, applyFlags ParticipationFlags) error {
+	currentSlot, err := state.Slot()
+	if err != nil {
+		return err
+	}
+	currentEpoch := spec.SlotToEpoch(currentSlot)
 
 	var epochParticipation *ParticipationRegistryView
 	// Check source
-	if data.Target.Epoch == currentEpoch {
+	if indexedAtt.Data.Target.Epoch == currentEpoch {
 		epochParticipation, err = state.CurrentEpochParticipation()
 		if err != nil {
 			return err
@@ -92,6 +179,11 @@ func ProcessAttestation(spec *common.Spec, epc *common.EpochsContext, state Alta
 	}
 
 	// TODO: probably better to batch flag changes, needs optimization, tree structure not good for this.
+	tallies := common.StateParticipationTallies(state)
+	vals, err := state.Validators()
+	if err != nil {
+		return err
+	}
 	proposerRewardNumerator := common.Gwei(0)
 	baseRewardPerIncrement := spec.EFFECTIVE_BALANCE_INCREMENT * common.Gwei(spec.BASE_REWARD_FACTOR) / epc.TotalActiveStakeSqRoot
 	for _, vi := range indexedAtt.AttestingIndices {
@@ -109,6 +201,9 @@ func ProcessAttestation(spec *common.Spec, epc *common.EpochsContext, state Alta
 		}
 		if (applyFlags&TIMELY_TARGET_FLAG != 0) && (existingFlags&TIMELY_TARGET_FLAG == 0) {
 			proposerRewardNumerator += baseReward * TIMELY_TARGET_WEIGHT
+			if err := tallies.AddTargetAttester(vals, indexedAtt.Data.Target.Epoch, vi); err != nil {
+				return err
+			}
 		}
 		if (applyFlags&TIMELY_HEAD_FLAG != 0) && (existingFlags&TIMELY_HEAD_FLAG == 0) {
 			proposerRewardNumerator += baseReward * TIMELY_HEAD_WEIGHT
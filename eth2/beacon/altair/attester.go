@@ -26,14 +26,15 @@ type EpochAttesterData struct {
 	CurrEpochUnslashedTargetStake common.Gwei
 }
 
-func ComputeEpochAttesterData(ctx context.Context, spec *common.Spec, epc *common.EpochsContext, flats []common.FlatValidator, state AltairLikeBeaconState) (out *EpochAttesterData, err error) {
+func ComputeEpochAttesterData(ctx context.Context, spec *common.Spec, epc *common.EpochsContext, scratch *common.EpochProcessScratch,
+	flats []common.FlatValidator, state AltairLikeBeaconState) (out *EpochAttesterData, err error) {
 	prevEpoch := epc.PreviousEpoch.Epoch
 	currentEpoch := epc.CurrentEpoch.Epoch
 	out = &EpochAttesterData{
 		PrevEpoch:       prevEpoch,
 		CurrEpoch:       currentEpoch,
 		Flats:           flats,
-		EligibleIndices: make([]common.ValidatorIndex, 0, len(flats)),
+		EligibleIndices: scratch.ValidatorIndices(uint64(len(flats))),
 		PrevEpochUnslashedStake: EpochStakeSummary{
 			SourceStake: 0,
 			TargetStake: 0,
@@ -81,8 +82,14 @@ func ComputeEpochAttesterData(ctx context.Context, spec *common.Spec, epc *commo
 		if prevFlag&TIMELY_HEAD_FLAG != 0 {
 			out.PrevEpochUnslashedStake.HeadStake += effBal
 		}
+	}
+	// validators that are activated in the current epoch also count towards the current target
+	for _, vi := range epc.CurrentEpoch.ActiveIndices {
+		if flats[vi].Slashed {
+			continue
+		}
 		if currEpochParticipation[vi]&TIMELY_TARGET_FLAG != 0 {
-			out.CurrEpochUnslashedTargetStake += effBal
+			out.CurrEpochUnslashedTargetStake += flats[vi].EffectiveBalance
 		}
 	}
 	if out.PrevEpochUnslashedStake.SourceStake < spec.EFFECTIVE_BALANCE_INCREMENT {
@@ -0,0 +1,75 @@
+package altair_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/protolambda/zrnt/eth2/beacon/altair"
+	"github.com/protolambda/zrnt/eth2/beacon/common"
+	"github.com/protolambda/zrnt/eth2/beacon/testutil"
+	"github.com/protolambda/zrnt/eth2/configs"
+)
+
+// The current target stake is summed over the validators active in the current epoch,
+// like get_unslashed_participating_indices of the spec, not over the active validators of the previous epoch.
+func TestCurrEpochUnslashedTargetStake(t *testing.T) {
+	spec := *configs.Minimal
+	spec.ALTAIR_FORK_EPOCH = 0
+	s, _, err := testutil.GenerateTestState(&spec, 64, testutil.StateOptions{Slot: 2*spec.SLOTS_PER_EPOCH + 3})
+	if err != nil {
+		t.Fatal(err)
+	}
+	state := s.(*altair.BeaconStateView)
+	vals, err := state.Validators()
+	if err != nil {
+		t.Fatal(err)
+	}
+	const (
+		activated = common.ValidatorIndex(5)
+		exited    = common.ValidatorIndex(6)
+		active    = common.ValidatorIndex(7)
+	)
+	current := common.Epoch(2)
+	if v, err := vals.Validator(activated); err != nil {
+		t.Fatal(err)
+	} else if err := v.SetActivationEpoch(current); err != nil {
+		t.Fatal(err)
+	} else if err := v.SetEffectiveBalance(spec.MAX_EFFECTIVE_BALANCE / 2); err != nil {
+		t.Fatal(err)
+	}
+	if v, err := vals.Validator(exited); err != nil {
+		t.Fatal(err)
+	} else if err := v.SetExitEpoch(current); err != nil {
+		t.Fatal(err)
+	}
+	flags, err := state.CurrentEpochParticipation()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, vi := range []common.ValidatorIndex{activated, exited, active} {
+		if err := flags.SetFlags(vi, altair.TIMELY_TARGET_FLAG); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	epc, err := common.NewEpochsContext(&spec, state)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if epc.CurrentEpoch.Epoch != current {
+		t.Fatalf("unexpected epoch %d", epc.CurrentEpoch.Epoch)
+	}
+	flats, err := common.FlattenValidators(vals)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := altair.ComputeEpochAttesterData(context.Background(), &spec, epc, nil, flats, state)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := flats[activated].EffectiveBalance + flats[active].EffectiveBalance
+	if data.CurrEpochUnslashedTargetStake != expected {
+		t.Fatalf("expected current target stake %d of the validators active in the current epoch, got %d",
+			expected, data.CurrEpochUnslashedTargetStake)
+	}
+}
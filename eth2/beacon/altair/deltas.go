@@ -2,21 +2,36 @@ package altair
 
 import (
 	"context"
+	"sync"
 
 	"github.com/protolambda/zrnt/eth2/beacon/common"
 )
 
-func ComputeFlagDeltas(ctx context.Context, spec *common.Spec, epc *common.EpochsContext, attesterData *EpochAttesterData,
+func ComputeFlagDeltas(ctx context.Context, spec *common.Spec, epc *common.EpochsContext, scratch *common.EpochProcessScratch,
+	attesterData *EpochAttesterData,
 	flag ParticipationFlags, weight common.Gwei, isInactivityLeak bool) (*common.Deltas, error) {
 
 	valCount := uint64(len(attesterData.Flats))
-	out := common.NewDeltas(valCount)
+	out := scratch.Deltas(valCount)
 
+	// the partial sums of the chunks are added up in any order, the total is the same
+	var mu sync.Mutex
 	unslashedParticipatingTotalBalance := common.Gwei(0)
-	for _, vi := range epc.PreviousEpoch.ActiveIndices {
-		if !attesterData.Flats[vi].Slashed && (attesterData.PrevParticipation[vi]&flag != 0) {
-			unslashedParticipatingTotalBalance += attesterData.Flats[vi].EffectiveBalance
+	active := epc.PreviousEpoch.ActiveIndices
+	err := common.ParallelChunks(ctx, len(active), epc.EpochProcessParallelism, func(start int, end int) error {
+		partial := common.Gwei(0)
+		for _, vi := range active[start:end] {
+			if !attesterData.Flats[vi].Slashed && (attesterData.PrevParticipation[vi]&flag != 0) {
+				partial += attesterData.Flats[vi].EffectiveBalance
+			}
 		}
+		mu.Lock()
+		unslashedParticipatingTotalBalance += partial
+		mu.Unlock()
+		return nil
+	})
+	if err != nil {
+		return nil, err
 	}
 	// get_total_balance makes it 1 increment minimum
 	if unslashedParticipatingTotalBalance < spec.EFFECTIVE_BALANCE_INCREMENT {
@@ -27,30 +42,38 @@ func ComputeFlagDeltas(ctx context.Context, spec *common.Spec, epc *common.Epoch
 	activeIncrements := epc.TotalActiveStake / spec.EFFECTIVE_BALANCE_INCREMENT
 
 	baseRewardPerIncrement := (spec.EFFECTIVE_BALANCE_INCREMENT * common.Gwei(spec.BASE_REWARD_FACTOR)) / epc.TotalActiveStakeSqRoot
-	for _, vi := range attesterData.EligibleIndices {
-		effBal := attesterData.Flats[vi].EffectiveBalance
-		increments := effBal / spec.EFFECTIVE_BALANCE_INCREMENT
-		baseReward := increments * baseRewardPerIncrement
-		prevEpochParticipation := attesterData.PrevParticipation[vi]
-		flagParticipation := prevEpochParticipation&flag != 0
-
-		slashed := attesterData.Flats[vi].Slashed
-		if !slashed && flagParticipation {
-			if !isInactivityLeak {
-				rewardNumerator := (baseReward * weight) * unslashedParticipatingIncrements
-				rewardDenominator := activeIncrements * WEIGHT_DENOMINATOR
-				out.Rewards[vi] += rewardNumerator / rewardDenominator
+	// every eligible validator is only once in the eligible indices, the chunks do not write to the same deltas
+	eligible := attesterData.EligibleIndices
+	err = common.ParallelChunks(ctx, len(eligible), epc.EpochProcessParallelism, func(start int, end int) error {
+		for _, vi := range eligible[start:end] {
+			effBal := attesterData.Flats[vi].EffectiveBalance
+			increments := effBal / spec.EFFECTIVE_BALANCE_INCREMENT
+			baseReward := increments * baseRewardPerIncrement
+			prevEpochParticipation := attesterData.PrevParticipation[vi]
+			flagParticipation := prevEpochParticipation&flag != 0
+
+			slashed := attesterData.Flats[vi].Slashed
+			if !slashed && flagParticipation {
+				if !isInactivityLeak {
+					rewardNumerator := (baseReward * weight) * unslashedParticipatingIncrements
+					rewardDenominator := activeIncrements * WEIGHT_DENOMINATOR
+					out.Rewards[vi] += rewardNumerator / rewardDenominator
+				}
+			} else if flag != TIMELY_HEAD_FLAG {
+				out.Penalties[vi] += (baseReward * weight) / WEIGHT_DENOMINATOR
 			}
-		} else if flag != TIMELY_HEAD_FLAG {
-			out.Penalties[vi] += (baseReward * weight) / WEIGHT_DENOMINATOR
 		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
 	}
 	return out, nil
 }
 
-func ComputeInactivityPenaltyDeltas(ctx context.Context, spec *common.Spec, epc *common.EpochsContext,
+func ComputeInactivityPenaltyDeltas(ctx context.Context, spec *common.Spec, epc *common.EpochsContext, scratch *common.EpochProcessScratch,
 	attesterData *EpochAttesterData, inactivityScores *InactivityScoresView, inactivityPenaltyQuotient uint64) (*common.Deltas, error) {
-	out := common.NewDeltas(uint64(len(attesterData.Flats)))
+	out := scratch.Deltas(uint64(len(attesterData.Flats)))
 	penaltyDenominator := common.Gwei(uint64(spec.INACTIVITY_SCORE_BIAS) * inactivityPenaltyQuotient)
 	for _, vi := range attesterData.EligibleIndices {
 		if !(!attesterData.Flats[vi].Slashed && (attesterData.PrevParticipation[vi]&TIMELY_TARGET_FLAG != 0)) {
@@ -82,7 +105,7 @@ func NewRewardsAndPenalties(validatorCount uint64) *RewardsAndPenalties {
 	}
 }
 
-func AttestationRewardsAndPenalties(ctx context.Context, spec *common.Spec, epc *common.EpochsContext,
+func AttestationRewardsAndPenalties(ctx context.Context, spec *common.Spec, epc *common.EpochsContext, scratch *common.EpochProcessScratch,
 	attesterData *EpochAttesterData, state AltairLikeBeaconState) (*RewardsAndPenalties, error) {
 	if err := ctx.Err(); err != nil {
 		return nil, err
@@ -94,17 +117,17 @@ func AttestationRewardsAndPenalties(ctx context.Context, spec *common.Spec, epc
 	finalityDelay := attesterData.PrevEpoch - finalized.Epoch
 	isInactivityLeak := finalityDelay > spec.MIN_EPOCHS_TO_INACTIVITY_PENALTY
 
-	sourceDeltas, err := ComputeFlagDeltas(ctx, spec, epc, attesterData,
+	sourceDeltas, err := ComputeFlagDeltas(ctx, spec, epc, scratch, attesterData,
 		TIMELY_SOURCE_FLAG, TIMELY_SOURCE_WEIGHT, isInactivityLeak)
 	if err != nil {
 		return nil, err
 	}
-	targetDeltas, err := ComputeFlagDeltas(ctx, spec, epc, attesterData,
+	targetDeltas, err := ComputeFlagDeltas(ctx, spec, epc, scratch, attesterData,
 		TIMELY_TARGET_FLAG, TIMELY_TARGET_WEIGHT, isInactivityLeak)
 	if err != nil {
 		return nil, err
 	}
-	headDeltas, err := ComputeFlagDeltas(ctx, spec, epc, attesterData,
+	headDeltas, err := ComputeFlagDeltas(ctx, spec, epc, scratch, attesterData,
 		TIMELY_HEAD_FLAG, TIMELY_HEAD_WEIGHT, isInactivityLeak)
 	if err != nil {
 		return nil, err
@@ -115,7 +138,7 @@ func AttestationRewardsAndPenalties(ctx context.Context, spec *common.Spec, epc
 	}
 	settings := state.ForkSettings(spec)
 	inactivityPenalties, err := ComputeInactivityPenaltyDeltas(
-		ctx, spec, epc, attesterData, inactivityScores, settings.InactivityPenaltyQuotient)
+		ctx, spec, epc, scratch, attesterData, inactivityScores, settings.InactivityPenaltyQuotient)
 	if err != nil {
 		return nil, err
 	}
@@ -127,27 +150,29 @@ func AttestationRewardsAndPenalties(ctx context.Context, spec *common.Spec, epc
 	}, nil
 }
 
-func ProcessEpochRewardsAndPenalties(ctx context.Context, spec *common.Spec, epc *common.EpochsContext,
+func ProcessEpochRewardsAndPenalties(ctx context.Context, spec *common.Spec, epc *common.EpochsContext, scratch *common.EpochProcessScratch,
 	attesterData *EpochAttesterData, state AltairLikeBeaconState) error {
 	currentEpoch := epc.CurrentEpoch.Epoch
 	if currentEpoch == common.GENESIS_EPOCH {
 		return nil
 	}
 
-	rewAndPenalties, err := AttestationRewardsAndPenalties(ctx, spec, epc, attesterData, state)
+	rewAndPenalties, err := AttestationRewardsAndPenalties(ctx, spec, epc, scratch, attesterData, state)
 	if err != nil {
 		return err
 	}
 
 	valCount := uint64(len(attesterData.Flats))
-	sum := common.NewDeltas(valCount)
-	sum.Add(rewAndPenalties.Source)
-	sum.Add(rewAndPenalties.Target)
-	sum.Add(rewAndPenalties.Head)
-	sum.Add(rewAndPenalties.Inactivity)
-	balances, err := common.ApplyDeltas(state, sum)
+	sum := scratch.Deltas(valCount)
+	err = common.ParallelChunks(ctx, int(valCount), epc.EpochProcessParallelism, func(start int, end int) error {
+		sum.AddRange(rewAndPenalties.Source, start, end)
+		sum.AddRange(rewAndPenalties.Target, start, end)
+		sum.AddRange(rewAndPenalties.Head, start, end)
+		sum.AddRange(rewAndPenalties.Inactivity, start, end)
+		return nil
+	})
 	if err != nil {
 		return err
 	}
-	return state.SetBalances(balances)
+	return common.ApplyBalanceDeltas(spec, state, sum.Rewards, sum.Penalties)
 }
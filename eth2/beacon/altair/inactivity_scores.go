@@ -12,6 +12,10 @@ import (
 
 type InactivityScores []Uint64View
 
+func (li InactivityScores) MarshalJSON() ([]byte, error) {
+	return common.MarshalJSONList(len(li), []Uint64View(li))
+}
+
 func (a *InactivityScores) Deserialize(spec *common.Spec, dr *codec.DecodingReader) error {
 	return dr.List(func() codec.Deserializable {
 		i := len(*a)
@@ -89,7 +89,7 @@ func (r *ParticipationRegistry) UnmarshalJSON(data []byte) error {
 }
 
 func (r ParticipationRegistry) MarshalJSON() ([]byte, error) {
-	return json.Marshal([]ParticipationFlags(r))
+	return common.MarshalJSONList(len(r), []ParticipationFlags(r))
 }
 
 func (r *ParticipationRegistry) UnmarshalYAML(value *yaml.Node) error {
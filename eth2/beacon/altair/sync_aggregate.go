@@ -67,7 +67,7 @@ func AsSyncAggregate(v View, err error) (*SyncAggregateView, error) {
 	return &SyncAggregateView{c}, err
 }
 
-func ProcessSyncAggregate(ctx context.Context, spec *common.Spec, epc *common.EpochsContext, state common.BeaconState, agg *SyncAggregate) error {
+func ProcessSyncAggregate(ctx context.Context, spec *common.Spec, epc *common.EpochsContext, tr *common.Transition, state common.BeaconState, agg *SyncAggregate) error {
 	if err := ctx.Err(); err != nil {
 		return err
 	}
@@ -108,7 +108,8 @@ func ProcessSyncAggregate(ctx context.Context, spec *common.Spec, epc *common.Ep
 	if err != nil {
 		return fmt.Errorf("failed to decode and sub-group check sync committee signature: %v", err)
 	}
-	if !blsu.Eth2FastAggregateVerify(participantPubkeys, signingRoot[:], sig) {
+	tr.CountSignatures("sync_aggregate", 1)
+	if !tr.VerifyAggregateSignature("sync aggregate", participantPubkeys, signingRoot[:], sig) {
 		return errors.New("invalid sync committee signature")
 	}
 
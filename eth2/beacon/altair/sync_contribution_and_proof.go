@@ -109,11 +109,10 @@ func (b *SignedContributionAndProof) HashTreeRoot(spec *common.Spec, hFn tree.Ha
 
 // VerifySignature verifies the outer Signature ONLY. This does not verify the selection proof or contribution contents.
 func (b *SignedContributionAndProof) VerifySignature(spec *common.Spec, epc *common.EpochsContext, domainFn common.BLSDomainFn) error {
-	dom, err := domainFn(common.DOMAIN_CONTRIBUTION_AND_PROOF, spec.SlotToEpoch(b.Message.Contribution.Slot))
+	sigRoot, err := ContributionAndProofSigningRoot(spec, domainFn, &b.Message)
 	if err != nil {
 		return err
 	}
-	sigRoot := common.ComputeSigningRoot(b.Message.HashTreeRoot(spec, tree.GetHashFn()), dom)
 	pub, ok := epc.ValidatorPubkeyCache.Pubkey(b.Message.AggregatorIndex)
 	if !ok {
 		return fmt.Errorf("could not fetch pubkey for aggregator %d", b.Message.AggregatorIndex)
@@ -132,6 +131,27 @@ func (b *SignedContributionAndProof) VerifySignature(spec *common.Spec, epc *com
 	return nil
 }
 
+// BuildContributionAndProof wraps the contribution of a selected aggregator into a ContributionAndProof message.
+// The selection proof is the aggregator's signature of the SyncAggregatorSelectionData of the contribution,
+// see SyncAggregatorSelectionSigningRoot and IsSyncCommitteeAggregator.
+// The message is then signed, see ContributionAndProofSigningRoot, to form the SignedContributionAndProof.
+func BuildContributionAndProof(aggregatorIndex common.ValidatorIndex, contribution *SyncCommitteeContribution, selectionProof common.BLSSignature) *ContributionAndProof {
+	return &ContributionAndProof{
+		AggregatorIndex: aggregatorIndex,
+		Contribution:    *contribution,
+		SelectionProof:  selectionProof,
+	}
+}
+
+// ContributionAndProofSigningRoot computes the root for the aggregator to sign, to produce a SignedContributionAndProof.
+func ContributionAndProofSigningRoot(spec *common.Spec, domainFn common.BLSDomainFn, cnp *ContributionAndProof) (common.Root, error) {
+	dom, err := domainFn(common.DOMAIN_CONTRIBUTION_AND_PROOF, spec.SlotToEpoch(cnp.Contribution.Slot))
+	if err != nil {
+		return common.Root{}, err
+	}
+	return common.ComputeSigningRoot(cnp.HashTreeRoot(spec, tree.GetHashFn()), dom), nil
+}
+
 type SignedContributionAndProofView struct {
 	*ContainerView
 }
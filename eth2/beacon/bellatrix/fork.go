@@ -111,9 +111,9 @@ func UpgradeToBellatrix(spec *common.Spec, epc *common.EpochsContext, pre *altai
 	if err != nil {
 		return nil, err
 	}
-	latestExecutionPayloadHeader := ExecutionPayloadHeaderType.Default(nil)
+	latestExecutionPayloadHeader := ExecutionPayloadHeaderType(spec).Default(nil)
 
-	return AsBeaconStateView(BeaconStateType(spec).FromFields(
+	post, err := AsBeaconStateView(BeaconStateType(spec).FromFields(
 		(*view.Uint64View)(&genesisTime),
 		(*view.RootView)(&genesisValidatorsRoot),
 		(*view.Uint64View)(&slot),
@@ -140,4 +140,10 @@ func UpgradeToBellatrix(spec *common.Spec, epc *common.EpochsContext, pre *altai
 		nextSyncCommitteeView,
 		latestExecutionPayloadHeader,
 	))
+	if err != nil {
+		return nil, err
+	}
+	// the participation is carried over as-is, and so are the tallies of it
+	post.tallies = pre.ParticipationTallies().Clone()
+	return post, nil
 }
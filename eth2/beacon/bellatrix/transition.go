@@ -11,66 +11,80 @@ import (
 	"github.com/protolambda/zrnt/eth2/beacon/phase0"
 )
 
-func (state *BeaconStateView) ProcessEpoch(ctx context.Context, spec *common.Spec, epc *common.EpochsContext) error {
+func (state *BeaconStateView) ProcessEpoch(ctx context.Context, spec *common.Spec, epc *common.EpochsContext, tr *common.Transition) error {
+	scratch := tr.EpochScratch()
 	vals, err := state.Validators()
 	if err != nil {
 		return err
 	}
-	flats, err := common.FlattenValidators(vals)
+	flats, err := scratch.FlattenValidators(vals)
 	if err != nil {
 		return err
 	}
-	attesterData, err := altair.ComputeEpochAttesterData(ctx, spec, epc, flats, state)
+	attesterData, err := altair.ComputeEpochAttesterData(ctx, spec, epc, scratch, flats, state)
 	if err != nil {
 		return err
 	}
-	just := phase0.JustificationStakeData{
-		CurrentEpoch:                  epc.CurrentEpoch.Epoch,
-		TotalActiveStake:              epc.TotalActiveStake,
-		PrevEpochUnslashedTargetStake: attesterData.PrevEpochUnslashedStake.TargetStake,
-		CurrEpochUnslashedTargetStake: attesterData.CurrEpochUnslashedTargetStake,
+	just, err := phase0.NewJustificationStakeData(spec, epc, state.ParticipationTallies(),
+		attesterData.PrevEpochUnslashedStake.TargetStake, attesterData.CurrEpochUnslashedTargetStake)
+	if err != nil {
+		return err
 	}
-	if err := phase0.ProcessEpochJustification(ctx, spec, &just, state); err != nil {
+	if err := phase0.ProcessEpochJustification(ctx, spec, just, state); err != nil {
 		return err
 	}
+	tr.TraceEpochStage(state, common.EpochStageJustification)
 	if err := altair.ProcessInactivityUpdates(ctx, spec, attesterData, state); err != nil {
 		return err
 	}
-	if err := altair.ProcessEpochRewardsAndPenalties(ctx, spec, epc, attesterData, state); err != nil {
+	tr.TraceEpochStage(state, common.EpochStageInactivityUpdates)
+	if err := altair.ProcessEpochRewardsAndPenalties(ctx, spec, epc, scratch, attesterData, state); err != nil {
 		return err
 	}
+	tr.TraceEpochStage(state, common.EpochStageRewardsAndPenalties)
 	if err := phase0.ProcessEpochRegistryUpdates(ctx, spec, epc, flats, state); err != nil {
 		return err
 	}
+	tr.TraceEpochStage(state, common.EpochStageRegistryUpdates)
 	// phase0 implementation, but with fork-logic, will account for changed slashing multiplier
-	if err := phase0.ProcessEpochSlashings(ctx, spec, epc, flats, state); err != nil {
+	if err := phase0.ProcessEpochSlashings(ctx, spec, epc, scratch, flats, state); err != nil {
 		return err
 	}
+	tr.TraceEpochStage(state, common.EpochStageSlashings)
 	if err := phase0.ProcessEth1DataReset(ctx, spec, epc, state); err != nil {
 		return err
 	}
+	tr.TraceEpochStage(state, common.EpochStageEth1DataReset)
 	if err := phase0.ProcessEffectiveBalanceUpdates(ctx, spec, epc, flats, state); err != nil {
 		return err
 	}
+	tr.TraceEpochStage(state, common.EpochStageEffectiveBalanceUpdates)
 	if err := phase0.ProcessSlashingsReset(ctx, spec, epc, state); err != nil {
 		return err
 	}
+	tr.TraceEpochStage(state, common.EpochStageSlashingsReset)
 	if err := phase0.ProcessRandaoMixesReset(ctx, spec, epc, state); err != nil {
 		return err
 	}
+	tr.TraceEpochStage(state, common.EpochStageRandaoMixesReset)
 	if err := phase0.ProcessHistoricalRootsUpdate(ctx, spec, epc, state); err != nil {
 		return err
 	}
+	tr.TraceEpochStage(state, common.EpochStageHistoricalRootsUpdate)
 	if err := altair.ProcessParticipationFlagUpdates(ctx, spec, state); err != nil {
 		return err
 	}
+	tr.TraceEpochStage(state, common.EpochStageParticipationFlagUpdates)
 	if err := altair.ProcessSyncCommitteeUpdates(ctx, spec, epc, state); err != nil {
 		return err
 	}
+	tr.TraceEpochStage(state, common.EpochStageSyncCommitteeUpdates)
+	// the effective balances of the flat validators are updated, the previous tally is summed up with these
+	state.ParticipationTallies().Rotate(epc.NextEpoch.Epoch, flats)
 	return nil
 }
 
-func (state *BeaconStateView) ProcessBlock(ctx context.Context, spec *common.Spec, epc *common.EpochsContext, benv *common.BeaconBlockEnvelope) error {
+func (state *BeaconStateView) ProcessBlock(ctx context.Context, spec *common.Spec, epc *common.EpochsContext, tr *common.Transition, benv *common.BeaconBlockEnvelope) error {
 	body, ok := benv.Body.(*BeaconBlockBody)
 	if !ok {
 		return fmt.Errorf("unexpected block type %T in Bellatrix ProcessBlock", benv.Body)
@@ -82,6 +96,7 @@ func (state *BeaconStateView) ProcessBlock(ctx context.Context, spec *common.Spe
 	if err := common.ProcessHeader(ctx, spec, state, &benv.BeaconBlockHeader, expectedProposer); err != nil {
 		return err
 	}
+	tr.TraceBlockStage(state, common.BlockStageHeader)
 	block := &BeaconBlock{
 		Slot:          benv.Slot,
 		ProposerIndex: benv.ProposerIndex,
@@ -95,37 +110,42 @@ func (state *BeaconStateView) ProcessBlock(ctx context.Context, spec *common.Spe
 		if err := ProcessExecutionPayload(ctx, spec, state, &body.ExecutionPayload, spec.ExecutionEngine); err != nil {
 			return err
 		}
+		tr.TraceBlockStage(state, common.BlockStageExecutionPayload)
 	}
-	if err := phase0.ProcessRandaoReveal(ctx, spec, epc, state, body.RandaoReveal); err != nil {
+	if err := phase0.ProcessRandaoReveal(ctx, spec, epc, tr, state, body.RandaoReveal); err != nil {
 		return err
 	}
+	tr.TraceBlockStage(state, common.BlockStageRandao)
 	if err := phase0.ProcessEth1Vote(ctx, spec, epc, state, body.Eth1Data); err != nil {
 		return err
 	}
+	tr.TraceBlockStage(state, common.BlockStageEth1Data)
 	// Safety checks, in case the user of the function provided too many operations
 	if err := body.CheckLimits(spec); err != nil {
 		return err
 	}
 
-	if err := phase0.ProcessProposerSlashings(ctx, spec, epc, state, body.ProposerSlashings); err != nil {
+	if err := phase0.ProcessProposerSlashings(ctx, spec, epc, tr, state, body.ProposerSlashings); err != nil {
 		return err
 	}
-	if err := phase0.ProcessAttesterSlashings(ctx, spec, epc, state, body.AttesterSlashings); err != nil {
+	if err := phase0.ProcessAttesterSlashings(ctx, spec, epc, tr, state, body.AttesterSlashings); err != nil {
 		return err
 	}
-	if err := altair.ProcessAttestations(ctx, spec, epc, state, body.Attestations); err != nil {
+	if err := altair.ProcessAttestations(ctx, spec, epc, tr, state, body.Attestations); err != nil {
 		return err
 	}
 	// Note: state.AddValidator changed in Altair, but the deposit processing itself stayed the same.
-	if err := phase0.ProcessDeposits(ctx, spec, epc, state, body.Deposits); err != nil {
+	if err := phase0.ProcessDeposits(ctx, spec, epc, tr, state, body.Deposits); err != nil {
 		return err
 	}
-	if err := phase0.ProcessVoluntaryExits(ctx, spec, epc, state, body.VoluntaryExits); err != nil {
+	if err := phase0.ProcessVoluntaryExits(ctx, spec, epc, tr, state, body.VoluntaryExits); err != nil {
 		return err
 	}
-	if err := altair.ProcessSyncAggregate(ctx, spec, epc, state, &body.SyncAggregate); err != nil {
+	tr.TraceBlockStage(state, common.BlockStageOperations)
+	if err := altair.ProcessSyncAggregate(ctx, spec, epc, tr, state, &body.SyncAggregate); err != nil {
 		return err
 	}
+	tr.TraceBlockStage(state, common.BlockStageSyncAggregate)
 	return nil
 }
 
@@ -139,7 +159,7 @@ type ExecutionTrackingBeaconState interface {
 	common.BeaconState
 
 	LatestExecutionPayloadHeader() (*ExecutionPayloadHeaderView, error)
-	SetLatestExecutionPayloadHeader(h *ExecutionPayloadHeader) error
+	SetLatestExecutionPayloadHeader(spec *common.Spec, h *ExecutionPayloadHeader) error
 }
 
 func (state *BeaconStateView) IsExecutionEnabled(spec *common.Spec, block *BeaconBlock) (bool, error) {
@@ -158,7 +178,8 @@ func (state *BeaconStateView) IsTransitionCompleted() (bool, error) {
 	if err != nil {
 		return false, err
 	}
-	empty := ExecutionPayloadHeaderType.DefaultNode().MerkleRoot(tree.GetHashFn())
+	// the header type of the state is bound to the spec limits of the state
+	empty := execHeader.Type().DefaultNode().MerkleRoot(tree.GetHashFn())
 	return execHeader.HashTreeRoot(tree.GetHashFn()) != empty, nil
 }
 
@@ -5,26 +5,28 @@ import (
 	"context"
 	"fmt"
 
-	blsu "github.com/protolambda/bls12-381-util"
 	"github.com/protolambda/ztyp/tree"
 
 	"github.com/protolambda/zrnt/eth2/beacon/common"
 	"github.com/protolambda/zrnt/eth2/util/hashing"
 )
 
-func ProcessBLSToExecutionChanges(ctx context.Context, spec *common.Spec, epc *common.EpochsContext, state common.BeaconState, ops common.SignedBLSToExecutionChanges) error {
+func ProcessBLSToExecutionChanges(ctx context.Context, spec *common.Spec, epc *common.EpochsContext, tr *common.Transition, state common.BeaconState, ops common.SignedBLSToExecutionChanges) error {
 	for i := range ops {
 		if err := ctx.Err(); err != nil {
 			return err
 		}
-		if err := ProcessBLSToExecutionChange(ctx, spec, epc, state, &ops[i]); err != nil {
+		tr.TraceBeforeOp(state, common.OpBLSToExecutionChange, i)
+		err := ProcessBLSToExecutionChange(ctx, spec, epc, tr, state, &ops[i])
+		tr.TraceAfterOp(state, common.OpBLSToExecutionChange, i, err)
+		if err != nil {
 			return err
 		}
 	}
 	return nil
 }
 
-func ProcessBLSToExecutionChange(ctx context.Context, spec *common.Spec, epc *common.EpochsContext, state common.BeaconState, op *common.SignedBLSToExecutionChange) error {
+func ProcessBLSToExecutionChange(ctx context.Context, spec *common.Spec, epc *common.EpochsContext, tr *common.Transition, state common.BeaconState, op *common.SignedBLSToExecutionChange) error {
 	validators, err := state.Validators()
 	if err != nil {
 		return err
@@ -72,11 +74,17 @@ func ProcessBLSToExecutionChange(ctx context.Context, spec *common.Spec, epc *co
 		return err
 	}
 
-	if !blsu.Verify(pubKey, sigRoot[:], signature) {
+	tr.CountSignatures(string(common.OpBLSToExecutionChange), 1)
+	if !tr.VerifySignature(fmt.Sprintf("bls to execution change of validator %d", addressChange.ValidatorIndex), pubKey, sigRoot[:], signature) {
 		return fmt.Errorf("invalid bls to execution change signature")
 	}
 	var newWithdrawalCredentials tree.Root
 	copy(newWithdrawalCredentials[0:1], []byte{common.ETH1_ADDRESS_WITHDRAWAL_PREFIX})
 	copy(newWithdrawalCredentials[12:], addressChange.ToExecutionAddress[:])
-	return validator.SetWithdrawalCredentials(newWithdrawalCredentials)
+	if err := validator.SetWithdrawalCredentials(newWithdrawalCredentials); err != nil {
+		return err
+	}
+	// the credentials are not part of the flat validators, the snapshot only follows the changed registry
+	common.StateFlatValidators(state).Update(state, addressChange.ValidatorIndex, func(v *common.FlatValidator) {})
+	return nil
 }
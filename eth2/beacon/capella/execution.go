@@ -30,23 +30,25 @@ const (
 	__end
 )
 
-var ExecutionPayloadHeaderType = ContainerType("ExecutionPayloadHeader", []FieldDef{
-	{"parent_hash", common.Hash32Type},
-	{"fee_recipient", common.Eth1AddressType},
-	{"state_root", common.Bytes32Type},
-	{"receipts_root", common.Bytes32Type},
-	{"logs_bloom", common.LogsBloomType},
-	{"prev_randao", common.Bytes32Type},
-	{"block_number", Uint64Type},
-	{"gas_limit", Uint64Type},
-	{"gas_used", Uint64Type},
-	{"timestamp", common.TimestampType},
-	{"extra_data", common.ExtraDataType},
-	{"base_fee_per_gas", Uint256Type},
-	{"block_hash", common.Hash32Type},
-	{"transactions_root", RootType},
-	{"withdrawals_root", RootType},
-})
+func ExecutionPayloadHeaderType(spec *common.Spec) *ContainerTypeDef {
+	return ContainerType("ExecutionPayloadHeader", []FieldDef{
+		{"parent_hash", common.Hash32Type},
+		{"fee_recipient", common.Eth1AddressType},
+		{"state_root", common.Bytes32Type},
+		{"receipts_root", common.Bytes32Type},
+		{"logs_bloom", common.LogsBloomType},
+		{"prev_randao", common.Bytes32Type},
+		{"block_number", Uint64Type},
+		{"gas_limit", Uint64Type},
+		{"gas_used", Uint64Type},
+		{"timestamp", common.TimestampType},
+		{"extra_data", common.ExtraDataType(spec)},
+		{"base_fee_per_gas", Uint256Type},
+		{"block_hash", common.Hash32Type},
+		{"transactions_root", RootType},
+		{"withdrawals_root", RootType},
+	})
+}
 
 type ExecutionPayloadHeaderView struct {
 	*ContainerView
@@ -184,8 +186,8 @@ type ExecutionPayloadHeader struct {
 	WithdrawalsRoot  common.Root        `json:"withdrawals_root" yaml:"withdrawals_root"`
 }
 
-func (s *ExecutionPayloadHeader) View() *ExecutionPayloadHeaderView {
-	ed, err := s.ExtraData.View()
+func (s *ExecutionPayloadHeader) View(spec *common.Spec) *ExecutionPayloadHeaderView {
+	ed, err := s.ExtraData.View(spec)
 	if err != nil {
 		panic(err)
 	}
@@ -194,45 +196,45 @@ func (s *ExecutionPayloadHeader) View() *ExecutionPayloadHeaderView {
 	ts, bf, bh, tr := Uint64View(s.Timestamp), &s.BaseFeePerGas, (*RootView)(&s.BlockHash), (*RootView)(&s.TransactionsRoot)
 	wr := (*RootView)(&s.WithdrawalsRoot)
 
-	v, err := AsExecutionPayloadHeader(ExecutionPayloadHeaderType.FromFields(pr, cb, sr, rr, lb, rng, nr, gl, gu, ts, ed, bf, bh, tr, wr))
+	v, err := AsExecutionPayloadHeader(ExecutionPayloadHeaderType(spec).FromFields(pr, cb, sr, rr, lb, rng, nr, gl, gu, ts, ed, bf, bh, tr, wr))
 	if err != nil {
 		panic(err)
 	}
 	return v
 }
 
-func (s *ExecutionPayloadHeader) Deserialize(dr *codec.DecodingReader) error {
+func (s *ExecutionPayloadHeader) Deserialize(spec *common.Spec, dr *codec.DecodingReader) error {
 	return dr.Container(&s.ParentHash, &s.FeeRecipient, &s.StateRoot,
 		&s.ReceiptsRoot, &s.LogsBloom, &s.PrevRandao, &s.BlockNumber, &s.GasLimit,
-		&s.GasUsed, &s.Timestamp, &s.ExtraData, &s.BaseFeePerGas, &s.BlockHash, &s.TransactionsRoot,
+		&s.GasUsed, &s.Timestamp, spec.Wrap(&s.ExtraData), &s.BaseFeePerGas, &s.BlockHash, &s.TransactionsRoot,
 		&s.WithdrawalsRoot,
 	)
 }
 
-func (s *ExecutionPayloadHeader) Serialize(w *codec.EncodingWriter) error {
+func (s *ExecutionPayloadHeader) Serialize(spec *common.Spec, w *codec.EncodingWriter) error {
 	return w.Container(&s.ParentHash, &s.FeeRecipient, &s.StateRoot,
 		&s.ReceiptsRoot, &s.LogsBloom, &s.PrevRandao, &s.BlockNumber, &s.GasLimit,
-		&s.GasUsed, &s.Timestamp, &s.ExtraData, &s.BaseFeePerGas, &s.BlockHash, &s.TransactionsRoot,
+		&s.GasUsed, &s.Timestamp, spec.Wrap(&s.ExtraData), &s.BaseFeePerGas, &s.BlockHash, &s.TransactionsRoot,
 		&s.WithdrawalsRoot,
 	)
 }
 
-func (s *ExecutionPayloadHeader) ByteLength() uint64 {
+func (s *ExecutionPayloadHeader) ByteLength(spec *common.Spec) uint64 {
 	return codec.ContainerLength(&s.ParentHash, &s.FeeRecipient, &s.StateRoot,
 		&s.ReceiptsRoot, &s.LogsBloom, &s.PrevRandao, &s.BlockNumber, &s.GasLimit,
-		&s.GasUsed, &s.Timestamp, &s.ExtraData, &s.BaseFeePerGas, &s.BlockHash, &s.TransactionsRoot,
+		&s.GasUsed, &s.Timestamp, spec.Wrap(&s.ExtraData), &s.BaseFeePerGas, &s.BlockHash, &s.TransactionsRoot,
 		&s.WithdrawalsRoot,
 	)
 }
 
-func (b *ExecutionPayloadHeader) FixedLength() uint64 {
+func (b *ExecutionPayloadHeader) FixedLength(*common.Spec) uint64 {
 	return 0
 }
 
-func (s *ExecutionPayloadHeader) HashTreeRoot(hFn tree.HashFn) common.Root {
+func (s *ExecutionPayloadHeader) HashTreeRoot(spec *common.Spec, hFn tree.HashFn) common.Root {
 	return hFn.HashTreeRoot(&s.ParentHash, &s.FeeRecipient, &s.StateRoot,
 		&s.ReceiptsRoot, &s.LogsBloom, &s.PrevRandao, &s.BlockNumber, &s.GasLimit,
-		&s.GasUsed, &s.Timestamp, &s.ExtraData, &s.BaseFeePerGas, &s.BlockHash, &s.TransactionsRoot,
+		&s.GasUsed, &s.Timestamp, spec.Wrap(&s.ExtraData), &s.BaseFeePerGas, &s.BlockHash, &s.TransactionsRoot,
 		&s.WithdrawalsRoot,
 	)
 }
@@ -249,7 +251,7 @@ func ExecutionPayloadType(spec *common.Spec) *ContainerTypeDef {
 		{"gas_limit", Uint64Type},
 		{"gas_used", Uint64Type},
 		{"timestamp", common.TimestampType},
-		{"extra_data", common.ExtraDataType},
+		{"extra_data", common.ExtraDataType(spec)},
 		{"base_fee_per_gas", Uint256Type},
 		{"block_hash", common.Hash32Type},
 		{"transactions", common.PayloadTransactionsType(spec)},
@@ -287,7 +289,7 @@ type ExecutionPayload struct {
 func (s *ExecutionPayload) Deserialize(spec *common.Spec, dr *codec.DecodingReader) error {
 	return dr.Container(&s.ParentHash, &s.FeeRecipient, &s.StateRoot,
 		&s.ReceiptsRoot, &s.LogsBloom, &s.PrevRandao, &s.BlockNumber, &s.GasLimit,
-		&s.GasUsed, &s.Timestamp, &s.ExtraData, &s.BaseFeePerGas, &s.BlockHash, spec.Wrap(&s.Transactions),
+		&s.GasUsed, &s.Timestamp, spec.Wrap(&s.ExtraData), &s.BaseFeePerGas, &s.BlockHash, spec.Wrap(&s.Transactions),
 		spec.Wrap(&s.Withdrawals),
 	)
 }
@@ -295,7 +297,7 @@ func (s *ExecutionPayload) Deserialize(spec *common.Spec, dr *codec.DecodingRead
 func (s *ExecutionPayload) Serialize(spec *common.Spec, w *codec.EncodingWriter) error {
 	return w.Container(&s.ParentHash, &s.FeeRecipient, &s.StateRoot,
 		&s.ReceiptsRoot, &s.LogsBloom, &s.PrevRandao, &s.BlockNumber, &s.GasLimit,
-		&s.GasUsed, &s.Timestamp, &s.ExtraData, &s.BaseFeePerGas, &s.BlockHash, spec.Wrap(&s.Transactions),
+		&s.GasUsed, &s.Timestamp, spec.Wrap(&s.ExtraData), &s.BaseFeePerGas, &s.BlockHash, spec.Wrap(&s.Transactions),
 		spec.Wrap(&s.Withdrawals),
 	)
 }
@@ -303,7 +305,7 @@ func (s *ExecutionPayload) Serialize(spec *common.Spec, w *codec.EncodingWriter)
 func (s *ExecutionPayload) ByteLength(spec *common.Spec) uint64 {
 	return codec.ContainerLength(&s.ParentHash, &s.FeeRecipient, &s.StateRoot,
 		&s.ReceiptsRoot, &s.LogsBloom, &s.PrevRandao, &s.BlockNumber, &s.GasLimit,
-		&s.GasUsed, &s.Timestamp, &s.ExtraData, &s.BaseFeePerGas, &s.BlockHash, spec.Wrap(&s.Transactions),
+		&s.GasUsed, &s.Timestamp, spec.Wrap(&s.ExtraData), &s.BaseFeePerGas, &s.BlockHash, spec.Wrap(&s.Transactions),
 		spec.Wrap(&s.Withdrawals),
 	)
 }
@@ -316,7 +318,7 @@ func (a *ExecutionPayload) FixedLength(*common.Spec) uint64 {
 func (s *ExecutionPayload) HashTreeRoot(spec *common.Spec, hFn tree.HashFn) common.Root {
 	return hFn.HashTreeRoot(&s.ParentHash, &s.FeeRecipient, &s.StateRoot,
 		&s.ReceiptsRoot, &s.LogsBloom, &s.PrevRandao, &s.BlockNumber, &s.GasLimit,
-		&s.GasUsed, &s.Timestamp, &s.ExtraData, &s.BaseFeePerGas, &s.BlockHash, spec.Wrap(&s.Transactions),
+		&s.GasUsed, &s.Timestamp, spec.Wrap(&s.ExtraData), &s.BaseFeePerGas, &s.BlockHash, spec.Wrap(&s.Transactions),
 		spec.Wrap(&s.Withdrawals),
 	)
 }
@@ -139,7 +139,7 @@ func UpgradeToCapella(spec *common.Spec, epc *common.EpochsContext, pre *bellatr
 	nextWithdrawalIndex := view.Uint64View(0)
 	nextWithdrawalValidatorIndex := view.Uint64View(0)
 
-	return AsBeaconStateView(BeaconStateType(spec).FromFields(
+	post, err := AsBeaconStateView(BeaconStateType(spec).FromFields(
 		(*view.Uint64View)(&genesisTime),
 		(*view.RootView)(&genesisValidatorsRoot),
 		(*view.Uint64View)(&slot),
@@ -164,9 +164,15 @@ func UpgradeToCapella(spec *common.Spec, epc *common.EpochsContext, pre *bellatr
 		inactivityScores,
 		currentSyncCommitteeView,
 		nextSyncCommitteeView,
-		updatedExecutionPayloadHeader.View(),
+		updatedExecutionPayloadHeader.View(spec),
 		nextWithdrawalIndex,
 		nextWithdrawalValidatorIndex,
 		HistoricalSummariesType(spec).Default(nil),
 	))
+	if err != nil {
+		return nil, err
+	}
+	// the participation is carried over as-is, and so are the tallies of it
+	post.tallies = pre.ParticipationTallies().Clone()
+	return post, nil
 }
@@ -48,6 +48,10 @@ var HistoricalSummaryType = ContainerType("HistoricalSummary", []FieldDef{
 // HistoricalSummaries are the summaries of historical batches
 type HistoricalSummaries []HistoricalSummary
 
+func (li HistoricalSummaries) MarshalJSON() ([]byte, error) {
+	return common.MarshalJSONList(len(li), []HistoricalSummary(li))
+}
+
 func (a *HistoricalSummaries) Deserialize(spec *common.Spec, dr *codec.DecodingReader) error {
 	return dr.List(func() codec.Deserializable {
 		i := len(*a)
@@ -67,7 +67,7 @@ func (v *BeaconState) Deserialize(spec *common.Spec, dr *codec.DecodingReader) e
 		&v.FinalizedCheckpoint,
 		spec.Wrap(&v.InactivityScores),
 		spec.Wrap(&v.CurrentSyncCommittee), spec.Wrap(&v.NextSyncCommittee),
-		&v.LatestExecutionPayloadHeader,
+		spec.Wrap(&v.LatestExecutionPayloadHeader),
 		&v.NextWithdrawalIndex, &v.NextWithdrawalValidatorIndex,
 		spec.Wrap(&v.HistoricalSummaries),
 	)
@@ -86,7 +86,7 @@ func (v *BeaconState) Serialize(spec *common.Spec, w *codec.EncodingWriter) erro
 		&v.FinalizedCheckpoint,
 		spec.Wrap(&v.InactivityScores),
 		spec.Wrap(&v.CurrentSyncCommittee), spec.Wrap(&v.NextSyncCommittee),
-		&v.LatestExecutionPayloadHeader,
+		spec.Wrap(&v.LatestExecutionPayloadHeader),
 		&v.NextWithdrawalIndex, &v.NextWithdrawalValidatorIndex,
 		spec.Wrap(&v.HistoricalSummaries),
 	)
@@ -105,7 +105,7 @@ func (v *BeaconState) ByteLength(spec *common.Spec) uint64 {
 		&v.FinalizedCheckpoint,
 		spec.Wrap(&v.InactivityScores),
 		spec.Wrap(&v.CurrentSyncCommittee), spec.Wrap(&v.NextSyncCommittee),
-		&v.LatestExecutionPayloadHeader,
+		spec.Wrap(&v.LatestExecutionPayloadHeader),
 		&v.NextWithdrawalIndex, &v.NextWithdrawalValidatorIndex,
 		spec.Wrap(&v.HistoricalSummaries),
 	)
@@ -128,7 +128,7 @@ func (v *BeaconState) HashTreeRoot(spec *common.Spec, hFn tree.HashFn) common.Ro
 		&v.FinalizedCheckpoint,
 		spec.Wrap(&v.InactivityScores),
 		spec.Wrap(&v.CurrentSyncCommittee), spec.Wrap(&v.NextSyncCommittee),
-		&v.LatestExecutionPayloadHeader,
+		spec.Wrap(&v.LatestExecutionPayloadHeader),
 		&v.NextWithdrawalIndex, &v.NextWithdrawalValidatorIndex,
 		spec.Wrap(&v.HistoricalSummaries),
 	)
@@ -204,7 +204,7 @@ func BeaconStateType(spec *common.Spec) *ContainerTypeDef {
 		{"current_sync_committee", common.SyncCommitteeType(spec)},
 		{"next_sync_committee", common.SyncCommitteeType(spec)},
 		// Execution-layer
-		{"latest_execution_payload_header", ExecutionPayloadHeaderType},
+		{"latest_execution_payload_header", ExecutionPayloadHeaderType(spec)},
 		// Withdrawals
 		{"next_withdrawal_index", common.WithdrawalIndexType},
 		{"next_withdrawal_validator_index", common.ValidatorIndexType},
@@ -218,17 +218,35 @@ func BeaconStateType(spec *common.Spec) *ContainerTypeDef {
 //	state, err := beacon.AsBeaconStateView(beacon.BeaconStateType.Deserialize(codec.NewDecodingReader(reader, size)))
 func AsBeaconStateView(v View, err error) (*BeaconStateView, error) {
 	c, err := AsContainer(v, err)
-	return &BeaconStateView{c}, err
+	return &BeaconStateView{ContainerView: c, tallies: common.NewParticipationTallies(), flats: common.NewFlatValidatorCache()}, err
 }
 
 type BeaconStateView struct {
 	*ContainerView
+	rootMemo common.StateRootMemo
+	tallies  *common.ParticipationTallies
+	flats    *common.FlatValidatorCache
 }
 
 var _ common.BeaconState = (*phase0.BeaconStateView)(nil)
 
 func NewBeaconStateView(spec *common.Spec) *BeaconStateView {
-	return &BeaconStateView{ContainerView: BeaconStateType(spec).New()}
+	return &BeaconStateView{ContainerView: BeaconStateType(spec).New(), tallies: common.NewParticipationTallies(), flats: common.NewFlatValidatorCache()}
+}
+
+// HashTreeRoot returns the state root, memoized until the state is mutated.
+func (state *BeaconStateView) HashTreeRoot(hFn tree.HashFn) common.Root {
+	return state.rootMemo.HashTreeRoot(state.Backing(), hFn)
+}
+
+// ParticipationTallies returns the target-attesting stake tallies of the state, see common.ParticipationTallies.
+func (state *BeaconStateView) ParticipationTallies() *common.ParticipationTallies {
+	return state.tallies
+}
+
+// FlatValidators returns the flat validator snapshot of the state, see common.FlatValidatorCache.
+func (state *BeaconStateView) FlatValidators() *common.FlatValidatorCache {
+	return state.flats
 }
 
 func (state *BeaconStateView) GenesisTime() (common.Timestamp, error) {
@@ -514,8 +532,8 @@ func (state *BeaconStateView) LatestExecutionPayloadHeader() (*ExecutionPayloadH
 	return AsExecutionPayloadHeader(state.Get(_latestExecutionPayloadHeader))
 }
 
-func (state *BeaconStateView) SetLatestExecutionPayloadHeader(h *ExecutionPayloadHeader) error {
-	return state.Set(_latestExecutionPayloadHeader, h.View())
+func (state *BeaconStateView) SetLatestExecutionPayloadHeader(spec *common.Spec, h *ExecutionPayloadHeader) error {
+	return state.Set(_latestExecutionPayloadHeader, h.View(spec))
 }
 
 func (state *BeaconStateView) NextWithdrawalIndex() (common.WithdrawalIndex, error) {
@@ -564,6 +582,15 @@ func (state *BeaconStateView) ForkSettings(spec *common.Spec) *common.ForkSettin
 	}
 }
 
+// View converts the flattened state into a tree-structured state, the reverse of BeaconStateView.Raw.
+func (v *BeaconState) View(spec *common.Spec) (*BeaconStateView, error) {
+	var buf bytes.Buffer
+	if err := v.Serialize(spec, codec.NewEncodingWriter(&buf)); err != nil {
+		return nil, err
+	}
+	return AsBeaconStateView(BeaconStateType(spec).Deserialize(codec.NewDecodingReader(bytes.NewReader(buf.Bytes()), uint64(len(buf.Bytes())))))
+}
+
 // Raw converts the tree-structured state into a flattened native Go structure.
 func (state *BeaconStateView) Raw(spec *common.Spec) (*BeaconState, error) {
 	var buf bytes.Buffer
@@ -579,7 +606,13 @@ func (state *BeaconStateView) Raw(spec *common.Spec) (*BeaconState, error) {
 }
 
 func (state *BeaconStateView) CopyState() (common.BeaconState, error) {
-	return AsBeaconStateView(state.ContainerView.Copy())
+	out, err := AsBeaconStateView(state.ContainerView.Copy())
+	if err != nil {
+		return nil, err
+	}
+	out.tallies = state.tallies.Clone()
+	out.flats = state.flats.Clone()
+	return out, nil
 }
 
 type ExecutionUpgradeBeaconState interface {
@@ -592,7 +625,7 @@ type ExecutionTrackingBeaconState interface {
 	common.BeaconState
 
 	LatestExecutionPayloadHeader() (*ExecutionPayloadHeaderView, error)
-	SetLatestExecutionPayloadHeader(h *ExecutionPayloadHeader) error
+	SetLatestExecutionPayloadHeader(spec *common.Spec, h *ExecutionPayloadHeader) error
 }
 
 func (state *BeaconStateView) IsExecutionEnabled(spec *common.Spec, block *BeaconBlock) (bool, error) {
@@ -611,7 +644,8 @@ func (state *BeaconStateView) IsTransitionCompleted() (bool, error) {
 	if err != nil {
 		return false, err
 	}
-	empty := ExecutionPayloadHeaderType.DefaultNode().MerkleRoot(tree.GetHashFn())
+	// the header type of the state is bound to the spec limits of the state
+	empty := execHeader.Type().DefaultNode().MerkleRoot(tree.GetHashFn())
 	return execHeader.HashTreeRoot(tree.GetHashFn()) != empty, nil
 }
 
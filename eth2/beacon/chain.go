@@ -2,6 +2,7 @@ package beacon
 
 import (
 	"context"
+	"fmt"
 
 	"github.com/protolambda/zrnt/eth2/beacon/common"
 )
@@ -83,3 +84,172 @@ type ChainIter interface {
 	// The step.Block on Start() and End() counts as bounds: chains may only store part of the slot.
 	Entry(step common.Step) (entry ChainEntry, err error)
 }
+
+// BlockIter iterates the entries with a block of a chain iterator in order, skipping empty slots.
+type BlockIter struct {
+	iter ChainIter
+	next common.Step
+}
+
+func NewBlockIter(iter ChainIter) *BlockIter {
+	next := iter.Start()
+	if !next.Block() {
+		next++
+	}
+	return &BlockIter{iter: iter, next: next}
+}
+
+// Next returns the next entry with a block, or ok == false once the end of the iterator is reached.
+// Empty slots are skipped, but are still fetched from the underlying iterator.
+// If fetching an entry fails, the error is returned, and the same entry is tried again on the next call.
+func (it *BlockIter) Next() (entry ChainEntry, ok bool, err error) {
+	for it.next < it.iter.End() {
+		entry, err := it.iter.Entry(it.next)
+		if err != nil {
+			return nil, false, fmt.Errorf("failed to get entry at step %s: %v", it.next, err)
+		}
+		it.next += 2
+		if entry != nil {
+			return entry, true, nil
+		}
+	}
+	return nil, false, nil
+}
+
+// IterRange gets the entries of the slots from start (inclusive) to end (exclusive) of the iterator,
+// clipped to the bounds of the iterator, with a single walk. With the iterator of Chain.Iter,
+// these are the canonical entries of the slots. For every slot, the entry with the block is preferred,
+// an empty slot is represented by the entry without block, unless skipEmpty is set.
+func IterRange(iter ChainIter, start common.Slot, end common.Slot, skipEmpty bool) ([]ChainEntry, error) {
+	if s := iter.Start().Slot(); start < s {
+		start = s
+	}
+	if e := iter.End(); e.Block() {
+		// the end slot is included, up to its pre-block entry
+		if end > e.Slot()+1 {
+			end = e.Slot() + 1
+		}
+	} else if end > e.Slot() {
+		end = e.Slot()
+	}
+	if end <= start {
+		return nil, nil
+	}
+	out := make([]ChainEntry, 0, end-start)
+	for slot := start; slot < end; slot++ {
+		step := common.AsStep(slot, true)
+		if step >= iter.Start() && step < iter.End() {
+			entry, err := iter.Entry(step)
+			if err != nil {
+				return nil, fmt.Errorf("failed to get entry at step %s: %v", step, err)
+			}
+			if entry != nil {
+				out = append(out, entry)
+				continue
+			}
+		}
+		if skipEmpty {
+			continue
+		}
+		step = common.AsStep(slot, false)
+		if step < iter.Start() {
+			continue
+		}
+		entry, err := iter.Entry(step)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get entry at step %s: %v", step, err)
+		}
+		out = append(out, entry)
+	}
+	return out, nil
+}
+
+// AncestorAtSlot returns the root of the last block at or before the slot, in the chain of the iterator
+// up to the given block, like get_ancestor of the fork choice: the block itself if it is not after the slot.
+// With the iterator of Chain.Iter, the block has to be canonical.
+// An error is returned if the block is not in the iterator, or if the slot is before the start of the iterator.
+func AncestorAtSlot(iter ChainIter, root common.Root, slot common.Slot) (common.Root, error) {
+	start := iter.Start()
+	found := false
+	// walk back the blocks, from the end of the iterator
+	for step := iter.End(); step > start; {
+		step--
+		if !step.Block() {
+			continue
+		}
+		entry, err := iter.Entry(step)
+		if err != nil {
+			return common.Root{}, fmt.Errorf("failed to get entry at step %s: %v", step, err)
+		}
+		if entry == nil {
+			continue
+		}
+		blockRoot, err := entry.BlockRoot()
+		if err != nil {
+			return common.Root{}, err
+		}
+		if !found {
+			if blockRoot != root {
+				continue
+			}
+			found = true
+		}
+		if step.Slot() <= slot {
+			return blockRoot, nil
+		}
+	}
+	if !found {
+		return common.Root{}, fmt.Errorf("unknown block %s", root)
+	}
+	if start.Block() || slot < start.Slot() {
+		return common.Root{}, fmt.Errorf("slot %d is before the start of the chain at %s", slot, start)
+	}
+	// no block in the iterator at or before the slot, the entry without block at the start has the last block root
+	entry, err := iter.Entry(start)
+	if err != nil {
+		return common.Root{}, fmt.Errorf("failed to get entry at step %s: %v", start, err)
+	}
+	return entry.BlockRoot()
+}
+
+// BlockLookup gets chain entries by block root, like Chain.ByBlock.
+type BlockLookup interface {
+	ByBlock(root common.Root) (entry ChainEntry, ok bool)
+}
+
+// ReverseIter walks back from a block to its ancestors, by parent root, until the start of the chain.
+// Parent links do not change, so the walk is unaffected by head changes during the iteration.
+type ReverseIter struct {
+	chain   BlockLookup
+	next    common.Root
+	started bool
+	done    bool
+}
+
+func NewReverseIter(chain BlockLookup, from common.Root) *ReverseIter {
+	return &ReverseIter{chain: chain, next: from}
+}
+
+// Prev returns the next entry with a block, starting with the block of the iterator itself,
+// or ok == false once the parent is not in the chain.
+// An error is returned if the first block is not in the chain.
+func (it *ReverseIter) Prev() (entry ChainEntry, ok bool, err error) {
+	if it.done {
+		return nil, false, nil
+	}
+	entry, ok = it.chain.ByBlock(it.next)
+	if !ok {
+		it.done = true
+		if !it.started {
+			return nil, false, fmt.Errorf("unknown block %s", it.next)
+		}
+		return nil, false, nil
+	}
+	parent, err := entry.ParentRoot()
+	if err != nil {
+		return nil, false, fmt.Errorf("failed to get parent of block %s: %v", it.next, err)
+	}
+	it.started = true
+	it.next = parent
+	return entry, true, nil
+}
@@ -0,0 +1,261 @@
+package beacon
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/protolambda/zrnt/eth2/beacon/common"
+)
+
+type testStepEntry struct {
+	ChainEntry
+	step common.Step
+	root common.Root
+}
+
+func (e *testStepEntry) Step() common.Step {
+	return e.step
+}
+
+func (e *testStepEntry) BlockRoot() (common.Root, error) {
+	return e.root, nil
+}
+
+func testBlockRoot(slot common.Slot) common.Root {
+	return common.Root{1, byte(slot), byte(slot >> 8)}
+}
+
+// testGapIter is a canonical chain with blocks at the given slots only.
+type testGapIter struct {
+	blocks  map[common.Slot]bool
+	end     common.Slot
+	fetches int
+	failAt  common.Step
+	// the chain ends with the pre-block entry of the end slot
+	partialEnd bool
+}
+
+func (it *testGapIter) Start() common.Step {
+	return common.AsStep(0, false)
+}
+
+func (it *testGapIter) End() common.Step {
+	return common.AsStep(it.end, it.partialEnd)
+}
+
+func (it *testGapIter) Entry(step common.Step) (ChainEntry, error) {
+	if step < it.Start() || step >= it.End() {
+		return nil, fmt.Errorf("step %s out of range", step)
+	}
+	if step == it.failAt {
+		it.failAt = 0
+		return nil, errors.New("temporary failure")
+	}
+	it.fetches++
+	if step.Block() && !it.blocks[step.Slot()] {
+		return nil, nil
+	}
+	// the root of the last block, up to the block of the step itself
+	var root common.Root
+	for s := step.Slot() + 1; s > 0; s-- {
+		if it.blocks[s-1] && (s-1 < step.Slot() || step.Block()) {
+			root = testBlockRoot(s - 1)
+			break
+		}
+	}
+	return &testStepEntry{step: step, root: root}, nil
+}
+
+func TestBlockIter(t *testing.T) {
+	slots := []common.Slot{0, 1, 50, 51, 300, 999}
+	it := &testGapIter{blocks: make(map[common.Slot]bool), end: 1000, failAt: common.AsStep(300, true)}
+	for _, s := range slots {
+		it.blocks[s] = true
+	}
+	bi := NewBlockIter(it)
+	var got []common.Slot
+	for {
+		entry, ok, err := bi.Next()
+		if err != nil {
+			// the failure is temporary, the next call retries the same entry
+			t.Logf("retrying after error: %v", err)
+			continue
+		}
+		if !ok {
+			break
+		}
+		if !entry.Step().Block() {
+			t.Fatalf("expected entry with block, got step %s", entry.Step())
+		}
+		got = append(got, entry.Step().Slot())
+	}
+	if fmt.Sprint(got) != fmt.Sprint(slots) {
+		t.Fatalf("expected blocks at slots %v, got %v", slots, got)
+	}
+	if it.fetches != 1000 {
+		t.Fatalf("expected every slot to be fetched once, got %d fetches", it.fetches)
+	}
+	if _, ok, err := bi.Next(); ok || err != nil {
+		t.Fatal("expected the iterator to stay at the end")
+	}
+}
+
+func TestIterRange(t *testing.T) {
+	it := &testGapIter{blocks: map[common.Slot]bool{0: true, 50: true, 51: true, 999: true}, end: 1000}
+	steps := func(entries []ChainEntry) string {
+		var out []string
+		for _, e := range entries {
+			out = append(out, e.Step().String())
+		}
+		return fmt.Sprint(out)
+	}
+	entries, err := IterRange(it, 48, 53, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s := steps(entries); s != "[48:0 49:0 50:1 51:1 52:0]" {
+		t.Fatalf("unexpected range: %s", s)
+	}
+	entries, err = IterRange(it, 0, 100, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s := steps(entries); s != "[0:1 50:1 51:1]" {
+		t.Fatalf("unexpected range without empty slots: %s", s)
+	}
+	// clipped to the end of the iterator
+	entries, err = IterRange(it, 997, 2000, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s := steps(entries); s != "[997:0 998:0 999:1]" {
+		t.Fatalf("unexpected range at the end: %s", s)
+	}
+	if entries, err := IterRange(it, 1000, 2000, false); err != nil || len(entries) != 0 {
+		t.Fatalf("expected empty range after the end, got %d entries, err: %v", len(entries), err)
+	}
+	// a failed fetch fails the range
+	it.failAt = common.AsStep(10, false)
+	if _, err := IterRange(it, 5, 15, false); err == nil {
+		t.Fatal("expected error")
+	}
+}
+
+func TestIterRangePartialEnd(t *testing.T) {
+	it := &testGapIter{blocks: map[common.Slot]bool{10: true}, end: 10, partialEnd: true}
+	// the pre-block entry of the last slot represents the slot, its block is not in the iterator yet
+	entries, err := IterRange(it, 8, 20, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 3 || entries[2].Step() != common.AsStep(10, false) {
+		t.Fatalf("unexpected range: %v", entries)
+	}
+}
+
+type testBlockEntry struct {
+	ChainEntry
+	root   common.Root
+	parent common.Root
+}
+
+func (e *testBlockEntry) ParentRoot() (common.Root, error) {
+	return e.parent, nil
+}
+
+type testBlockLookup map[common.Root]*testBlockEntry
+
+func (l testBlockLookup) ByBlock(root common.Root) (ChainEntry, bool) {
+	e, ok := l[root]
+	if !ok {
+		return nil, false
+	}
+	return e, true
+}
+
+func TestReverseIter(t *testing.T) {
+	blocks := testBlockLookup{}
+	add := func(root byte, parent byte) {
+		blocks[common.Root{root}] = &testBlockEntry{root: common.Root{root}, parent: common.Root{parent}}
+	}
+	// the chain starts at block 1, its parent is not in the chain. Block 4 forks off block 2.
+	add(1, 0)
+	add(2, 1)
+	add(3, 2)
+	add(4, 2)
+	add(5, 3)
+	it := NewReverseIter(blocks, common.Root{5})
+	var got []byte
+	for {
+		entry, ok, err := it.Prev()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !ok {
+			break
+		}
+		got = append(got, entry.(*testBlockEntry).root[0])
+	}
+	if fmt.Sprint(got) != "[5 3 2 1]" {
+		t.Fatalf("unexpected ancestors: %v", got)
+	}
+	if _, ok, err := it.Prev(); ok || err != nil {
+		t.Fatal("expected the iterator to stay at the end")
+	}
+	if _, _, err := NewReverseIter(blocks, common.Root{9}).Prev(); err == nil {
+		t.Fatal("expected error for unknown block")
+	}
+}
+
+func TestAncestorAtSlot(t *testing.T) {
+	it := &testGapIter{blocks: map[common.Slot]bool{3: true, 50: true, 51: true, 999: true}, end: 1000,
+		failAt: common.AsStep(2000, false)}
+	for _, c := range []struct {
+		block    common.Slot
+		slot     common.Slot
+		ancestor common.Slot
+	}{
+		{999, 999, 999},
+		{999, 60, 51},
+		{999, 51, 51},
+		{999, 50, 50},
+		{999, 10, 3},
+		// the block itself, if it is not after the slot
+		{51, 500, 51},
+		{3, 3, 3},
+	} {
+		got, err := AncestorAtSlot(it, testBlockRoot(c.block), c.slot)
+		if err != nil {
+			t.Fatalf("block %d, slot %d: %v", c.block, c.slot, err)
+		}
+		if got != testBlockRoot(c.ancestor) {
+			t.Fatalf("block %d, slot %d: expected ancestor at %d, got %s", c.block, c.slot, c.ancestor, got)
+		}
+	}
+	// no block at or before the slot, the start of the chain has the last block root
+	if got, err := AncestorAtSlot(it, testBlockRoot(50), 2); err != nil || got != (common.Root{}) {
+		t.Fatalf("expected the root before the first block, got %s, %v", got, err)
+	}
+	if _, err := AncestorAtSlot(it, testBlockRoot(52), 10); err == nil {
+		t.Fatal("expected error for a block unknown to the chain")
+	}
+	// the chain starts later, the ancestor before the start is unknown
+	late := &testLateIter{testGapIter: it, start: 20}
+	if _, err := AncestorAtSlot(late, testBlockRoot(999), 10); err == nil {
+		t.Fatal("expected error for a slot before the start of the chain")
+	}
+	if got, err := AncestorAtSlot(late, testBlockRoot(999), 30); err != nil || got != testBlockRoot(3) {
+		t.Fatalf("expected the block before the start of the chain, got %s, %v", got, err)
+	}
+}
+
+// testLateIter is a testGapIter that starts at a later slot.
+type testLateIter struct {
+	*testGapIter
+	start common.Slot
+}
+
+func (it *testLateIter) Start() common.Step {
+	return common.AsStep(it.start, false)
+}
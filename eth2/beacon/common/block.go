@@ -28,27 +28,42 @@ func (b *BeaconBlockEnvelope) VerifySignature(spec *Spec, genesisValidatorsRoot
 }
 
 func (b *BeaconBlockEnvelope) VerifySignatureVersioned(spec *Spec, version Version, genesisValidatorsRoot Root, proposer ValidatorIndex, cachedPub *CachedPubkey) bool {
+	pub, signingRoot, sig, ok := b.signatureSet(version, genesisValidatorsRoot, proposer, cachedPub)
+	return ok && blsu.Verify(pub, signingRoot[:], sig)
+}
+
+// signatureSet checks the proposer and fork digest of the block, and returns what to verify the signature with.
+func (b *BeaconBlockEnvelope) signatureSet(version Version, genesisValidatorsRoot Root, proposer ValidatorIndex,
+	cachedPub *CachedPubkey) (pub *blsu.Pubkey, signingRoot Root, sig *blsu.Signature, ok bool) {
 	if b.ProposerIndex != proposer {
-		return false
+		return nil, Root{}, nil, false
 	}
 	forkRoot := ComputeForkDataRoot(version, genesisValidatorsRoot)
 	// Sanity check fork digest
 	if !bytes.Equal(forkRoot[0:4], b.ForkDigest[:]) {
-		return false
+		return nil, Root{}, nil, false
 	}
 	pub, err := cachedPub.Pubkey()
 	if err != nil {
-		return false
+		return nil, Root{}, nil, false
 	}
 	dom := ComputeDomain(DOMAIN_BEACON_PROPOSER, version, genesisValidatorsRoot)
-	signingRoot := ComputeSigningRoot(b.BlockRoot, dom)
-	sig, err := b.Signature.Signature()
+	signingRoot = ComputeSigningRoot(b.BlockRoot, dom)
+	sig, err = b.Signature.Signature()
 	if err != nil {
-		return false
+		return nil, Root{}, nil, false
 	}
-	return blsu.Verify(pub, signingRoot[:], sig)
+	return pub, signingRoot, sig, true
 }
 
 type EnvelopeBuilder interface {
 	Envelope(spec *Spec, digest ForkDigest) *BeaconBlockEnvelope
 }
+
+// SignedHeader returns the signed header of the block, e.g. for use in proposer slashings.
+func (b *BeaconBlockEnvelope) SignedHeader() *SignedBeaconBlockHeader {
+	return &SignedBeaconBlockHeader{
+		Message:   b.BeaconBlockHeader,
+		Signature: b.Signature,
+	}
+}
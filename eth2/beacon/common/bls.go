@@ -2,9 +2,12 @@ package common
 
 import (
 	"bytes"
+	"context"
 	"encoding/hex"
 	"errors"
 	"fmt"
+	"sync/atomic"
+	"unsafe"
 
 	blsu "github.com/protolambda/bls12-381-util"
 	"github.com/protolambda/ztyp/codec"
@@ -71,20 +74,50 @@ func (p *BLSPubkey) Pubkey() (*blsu.Pubkey, error) {
 	return &pub, nil
 }
 
+// DecompressPubkeys deserializes and validates the pubkeys with a pool of workers.
+// The BLS backend does not support batch decompression, so the keys are decompressed individually, in parallel.
+// If parallelism <= 0, a worker per CPU is used.
+func DecompressPubkeys(ctx context.Context, pubs []BLSPubkey, parallelism int) ([]*blsu.Pubkey, error) {
+	out := make([]*blsu.Pubkey, len(pubs))
+	err := ParallelRange(ctx, len(pubs), parallelism, func(i int) error {
+		pub, err := pubs[i].Pubkey()
+		if err != nil {
+			return fmt.Errorf("invalid pubkey %d (%s): %v", i, pubs[i], err)
+		}
+		out[i] = pub
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
 type CachedPubkey struct {
-	Compressed   BLSPubkey
-	decompressed *blsu.Pubkey
+	Compressed BLSPubkey
+	// *blsu.Pubkey, accessed atomically: the pubkey may be decompressed by concurrent signature verifications.
+	decompressed unsafe.Pointer
 }
 
 func (c *CachedPubkey) Pubkey() (*blsu.Pubkey, error) {
-	if c.decompressed == nil {
-		pub, err := c.Compressed.Pubkey()
-		if err != nil {
-			return nil, err
-		}
-		c.decompressed = pub
+	if pub := c.loaded(); pub != nil {
+		return pub, nil
+	}
+	pub, err := c.Compressed.Pubkey()
+	if err != nil {
+		return nil, err
 	}
-	return c.decompressed, nil
+	c.store(pub)
+	return pub, nil
+}
+
+// loaded returns the decompressed pubkey, or nil if it was not decompressed yet.
+func (c *CachedPubkey) loaded() *blsu.Pubkey {
+	return (*blsu.Pubkey)(atomic.LoadPointer(&c.decompressed))
+}
+
+func (c *CachedPubkey) store(pub *blsu.Pubkey) {
+	atomic.StorePointer(&c.decompressed, unsafe.Pointer(pub))
 }
 
 func ViewPubkey(pub *BLSPubkey) *BLSPubkeyView {
@@ -0,0 +1,102 @@
+package common
+
+import (
+	"container/list"
+	"sync"
+)
+
+// DefaultCommitteeCacheSize is enough to hold every committee of a few slots at the max committees per slot.
+const DefaultCommitteeCacheSize = 256
+
+type committeeKey struct {
+	slot  Slot
+	index CommitteeIndex
+}
+
+type committeeEntry struct {
+	key       committeeKey
+	committee []ValidatorIndex
+}
+
+// CommitteeCache is a bounded cache of recently requested beacon committees of a single EpochsContext.
+// The least recently used committee is evicted when the cache is full.
+// The cached committees are shared, not copied, and must be treated as read-only.
+type CommitteeCache struct {
+	sync.Mutex
+	maxEntries int
+	entries    map[committeeKey]*list.Element
+	// least recently used at the back
+	lru *list.List
+
+	hits   uint64
+	misses uint64
+}
+
+func NewCommitteeCache(maxEntries int) *CommitteeCache {
+	if maxEntries < 1 {
+		maxEntries = 1
+	}
+	return &CommitteeCache{
+		maxEntries: maxEntries,
+		entries:    make(map[committeeKey]*list.Element, maxEntries),
+		lru:        list.New(),
+	}
+}
+
+// Get returns the cached committee, if any, and counts the hit or miss.
+// The returned committee is read-only.
+func (cc *CommitteeCache) Get(slot Slot, index CommitteeIndex) (committee []ValidatorIndex, ok bool) {
+	cc.Lock()
+	defer cc.Unlock()
+	elem, ok := cc.entries[committeeKey{slot, index}]
+	if !ok {
+		cc.misses++
+		return nil, false
+	}
+	cc.hits++
+	cc.lru.MoveToFront(elem)
+	return elem.Value.(*committeeEntry).committee, true
+}
+
+// Add caches the committee, evicting the least recently used committee if the cache is full.
+func (cc *CommitteeCache) Add(slot Slot, index CommitteeIndex, committee []ValidatorIndex) {
+	cc.Lock()
+	defer cc.Unlock()
+	cc.add(committeeKey{slot, index}, committee)
+}
+
+func (cc *CommitteeCache) add(key committeeKey, committee []ValidatorIndex) {
+	if elem, ok := cc.entries[key]; ok {
+		elem.Value.(*committeeEntry).committee = committee
+		cc.lru.MoveToFront(elem)
+		return
+	}
+	if cc.lru.Len() >= cc.maxEntries {
+		last := cc.lru.Back()
+		cc.lru.Remove(last)
+		delete(cc.entries, last.Value.(*committeeEntry).key)
+	}
+	cc.entries[key] = cc.lru.PushFront(&committeeEntry{key: key, committee: committee})
+}
+
+// Reset drops all cached committees, e.g. after the shuffling changed.
+func (cc *CommitteeCache) Reset() {
+	cc.Lock()
+	defer cc.Unlock()
+	cc.entries = make(map[committeeKey]*list.Element, cc.maxEntries)
+	cc.lru.Init()
+}
+
+// Len returns the number of cached committees.
+func (cc *CommitteeCache) Len() int {
+	cc.Lock()
+	defer cc.Unlock()
+	return cc.lru.Len()
+}
+
+// Stats returns the number of cache hits and misses so far.
+func (cc *CommitteeCache) Stats() (hits uint64, misses uint64) {
+	cc.Lock()
+	defer cc.Unlock()
+	return cc.hits, cc.misses
+}
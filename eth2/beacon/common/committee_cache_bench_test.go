@@ -0,0 +1,35 @@
+package common
+
+import (
+	"testing"
+)
+
+// Gossip-like access pattern: attestations for the committees of the last few slots, in random order.
+func benchGossipCommittees(b *testing.B, cache *CommitteeCache) {
+	epc := testCommitteeEpochsContext(400000, cache)
+	slot := Slot(10*32 + 5)
+	committees := uint64(len(epc.CurrentEpoch.Committees[0]))
+	b.ReportAllocs()
+	b.ResetTimer()
+	x := uint64(123)
+	res := ValidatorIndex(0)
+	for i := 0; i < b.N; i++ {
+		x ^= x << 13
+		x ^= x >> 7
+		x ^= x << 17
+		s := slot - Slot(x%3)
+		comm, err := epc.GetBeaconCommittee(s, CommitteeIndex((x>>8)%committees))
+		if err != nil {
+			b.Fatal(err)
+		}
+		res += comm[0]
+	}
+}
+
+func BenchmarkGossipCommitteesNoCache(b *testing.B) {
+	benchGossipCommittees(b, nil)
+}
+
+func BenchmarkGossipCommitteesCached(b *testing.B) {
+	benchGossipCommittees(b, NewCommitteeCache(DefaultCommitteeCacheSize))
+}
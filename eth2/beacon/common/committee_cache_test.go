@@ -0,0 +1,76 @@
+package common
+
+import (
+	"testing"
+)
+
+func testCommitteeEpochsContext(validatorCount uint64, cache *CommitteeCache) *EpochsContext {
+	spec := &Spec{}
+	spec.SLOTS_PER_EPOCH = 32
+	spec.TARGET_COMMITTEE_SIZE = 128
+	spec.MAX_COMMITTEES_PER_SLOT = 64
+	spec.SHUFFLE_ROUND_COUNT = 90
+	indices := make([]BoundedIndex, validatorCount)
+	for i := range indices {
+		indices[i] = BoundedIndex{Index: ValidatorIndex(i), Activation: 0, Exit: FAR_FUTURE_EPOCH}
+	}
+	shuf := func(epoch Epoch) *ShufflingEpoch {
+		return NewShufflingEpoch(spec, indices, Root{byte(epoch)}, epoch)
+	}
+	return &EpochsContext{
+		Spec:           spec,
+		PreviousEpoch:  shuf(9),
+		CurrentEpoch:   shuf(10),
+		NextEpoch:      shuf(11),
+		CommitteeCache: cache,
+	}
+}
+
+func TestCommitteeCache(t *testing.T) {
+	epc := testCommitteeEpochsContext(50000, NewCommitteeCache(16))
+	slot := Slot(10 * 32)
+	expected := epc.CurrentEpoch.Committees[0][3]
+	for i := 0; i < 2; i++ {
+		comm, err := epc.GetBeaconCommittee(slot, 3)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if &comm[0] != &expected[0] || len(comm) != len(expected) {
+			t.Fatal("expected committee to be shared with the shuffling")
+		}
+	}
+	if hits, misses := epc.CommitteeCache.Stats(); hits != 1 || misses != 1 {
+		t.Fatalf("expected 1 hit and 1 miss, got %d hits, %d misses", hits, misses)
+	}
+	if _, err := epc.GetBeaconCommittee(slot, 20); err == nil {
+		t.Fatal("expected out of range committee index error")
+	}
+	if _, err := epc.GetBeaconCommittee(slot+64, 0); err == nil {
+		t.Fatal("expected out of range epoch error")
+	}
+
+	if err := epc.PrefetchSlot(slot + 1); err != nil {
+		t.Fatal(err)
+	}
+	// bounded: 12 committees of the prefetched slot, and the earlier committee
+	if n := epc.CommitteeCache.Len(); n != 13 {
+		t.Fatalf("expected 13 cached committees, got %d", n)
+	}
+	if err := epc.PrefetchSlot(slot + 2); err != nil {
+		t.Fatal(err)
+	}
+	if n := epc.CommitteeCache.Len(); n != 16 {
+		t.Fatalf("expected cache to be bounded to 16 committees, got %d", n)
+	}
+	if _, ok := epc.CommitteeCache.Get(slot, 3); ok {
+		t.Fatal("expected least recently used committee to be evicted")
+	}
+	if _, ok := epc.CommitteeCache.Get(slot+2, 11); !ok {
+		t.Fatal("expected prefetched committee to be cached")
+	}
+
+	clone := epc.Clone()
+	if clone.CommitteeCache == epc.CommitteeCache || clone.CommitteeCache.Len() != 0 {
+		t.Fatal("expected clone to have a fresh committee cache")
+	}
+}
@@ -1,7 +1,8 @@
 package common
 
 import (
-	"errors"
+	"encoding/binary"
+	"fmt"
 
 	"github.com/protolambda/ztyp/codec"
 	"github.com/protolambda/ztyp/tree"
@@ -71,23 +72,38 @@ func NewDeltas(validatorCount uint64) *Deltas {
 }
 
 func (deltas *Deltas) Add(other *Deltas) {
-	for i := 0; i < len(deltas.Rewards); i++ {
-		deltas.Rewards[i] += other.Rewards[i]
+	deltas.AddRange(other, 0, len(deltas.Rewards))
+}
+
+// AddRange adds the deltas of the validators in the index range [start, end) only.
+func (deltas *Deltas) AddRange(other *Deltas, start int, end int) {
+	for i := start; i < end; i++ {
+		deltas.Rewards[i] = saturatingAdd(deltas.Rewards[i], other.Rewards[i])
+	}
+	for i := start; i < end; i++ {
+		deltas.Penalties[i] = saturatingAdd(deltas.Penalties[i], other.Penalties[i])
 	}
-	for i := 0; i < len(deltas.Penalties); i++ {
-		deltas.Penalties[i] += other.Penalties[i]
+}
+
+// saturatingAdd returns a + b, capped at the max uint64 instead of overflowing.
+// Only crafted states, e.g. of fuzzers, have balances this large.
+func saturatingAdd(a Gwei, b Gwei) Gwei {
+	if sum := a + b; sum >= a {
+		return sum
 	}
+	return ^Gwei(0)
 }
 
+// IncreaseBalance adds the delta to the balance of the validator, capped at the max uint64 instead of overflowing.
 func IncreaseBalance(v BalancesRegistry, index ValidatorIndex, delta Gwei) error {
 	bal, err := v.GetBalance(index)
 	if err != nil {
 		return err
 	}
-	bal += delta
-	return v.SetBalance(index, bal)
+	return v.SetBalance(index, saturatingAdd(bal, delta))
 }
 
+// DecreaseBalance subtracts the delta from the balance of the validator, clipped to 0 instead of underflowing.
 func DecreaseBalance(v BalancesRegistry, index ValidatorIndex, delta Gwei) error {
 	bal, err := v.GetBalance(index)
 	if err != nil {
@@ -105,36 +121,143 @@ func DecreaseBalance(v BalancesRegistry, index ValidatorIndex, delta Gwei) error
 // Applies deltas to the balances in the state, returns the resulting balances,
 // ready to overwrite the state balances subtree with.
 func ApplyDeltas(state BeaconState, deltas *Deltas) ([]Gwei, error) {
+	return (*EpochProcessScratch)(nil).ApplyDeltas(state, deltas)
+}
+
+// BackedBalancesRegistry is implemented by balance registries that are backed by a binary tree,
+// to change many balances at once, see ApplyBalanceDeltas.
+type BackedBalancesRegistry interface {
+	BalancesRegistry
+	Backing() tree.Node
+	SetBacking(b tree.Node) error
+}
+
+// ApplyBalanceDeltas adds the rewards to, and subtracts the penalties from, the balances in the state.
+// Balances are clipped to 0 instead of underflowing, and capped at the max uint64 instead of overflowing.
+//
+// The packed balance leaves are read and patched in memory: every changed 32-byte chunk is written once,
+// every changed subtree node is rebuilt once, and the new balances tree is committed to the state once.
+// Unchanged subtrees are kept as-is, including their cached roots.
+func ApplyBalanceDeltas(spec *Spec, state BeaconState, rewards []Gwei, penalties []Gwei) error {
 	balances, err := state.Balances()
 	if err != nil {
-		return nil, err
+		return err
 	}
 	length, err := balances.Length()
 	if err != nil {
-		return nil, err
+		return err
+	}
+	if uint64(len(rewards)) != length || uint64(len(penalties)) != length {
+		return fmt.Errorf("cannot apply %d rewards and %d penalties to %d balances", len(rewards), len(penalties), length)
+	}
+	backed, ok := balances.(BackedBalancesRegistry)
+	if !ok {
+		// no tree access, set every changed balance individually
+		for i := uint64(0); i < length; i++ {
+			if rewards[i] == 0 && penalties[i] == 0 {
+				continue
+			}
+			bal, err := balances.GetBalance(ValidatorIndex(i))
+			if err != nil {
+				return err
+			}
+			if err := balances.SetBalance(ValidatorIndex(i), applyBalanceDelta(bal, rewards[i], penalties[i])); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	backing := backed.Backing()
+	contents, err := backing.Left()
+	if err != nil {
+		return err
+	}
+	lengthNode, err := backing.Right()
+	if err != nil {
+		return err
+	}
+	// 4 balances per chunk
+	depth := tree.CoverDepth((uint64(spec.VALIDATOR_REGISTRY_LIMIT) + 3) / 4)
+	p := balanceChunksPatch{rewards: rewards, penalties: penalties, chunkCount: (length + 3) / 4}
+	newContents, changed, err := p.patch(contents, depth, 0)
+	if err != nil {
+		return err
+	}
+	if !changed {
+		return nil
+	}
+	return backed.SetBacking(tree.NewPairNode(newContents, lengthNode))
+}
+
+func applyBalanceDelta(bal Gwei, reward Gwei, penalty Gwei) Gwei {
+	bal = saturatingAdd(bal, reward)
+	if bal >= penalty {
+		return bal - penalty
+	}
+	return 0
+}
+
+type balanceChunksPatch struct {
+	rewards    []Gwei
+	penalties  []Gwei
+	chunkCount uint64
+}
+
+// patch returns the node with the deltas applied to the chunks in the subtree of the given depth,
+// starting at the given chunk index, or the node itself if no chunk changed.
+func (p *balanceChunksPatch) patch(node tree.Node, depth uint8, start uint64) (tree.Node, bool, error) {
+	if depth == 0 {
+		return p.patchChunk(node, start)
+	}
+	left, err := node.Left()
+	if err != nil {
+		return nil, false, err
 	}
-	if uint64(len(deltas.Penalties)) != length || uint64(len(deltas.Rewards)) != length {
-		return nil, errors.New("cannot apply deltas to balances list with different length")
+	right, err := node.Right()
+	if err != nil {
+		return nil, false, err
+	}
+	newLeft, leftChanged, err := p.patch(left, depth-1, start)
+	if err != nil {
+		return nil, false, err
 	}
-	balancesOut := make([]Gwei, 0, length)
-	balIterNext := balances.Iter()
-	i := ValidatorIndex(0)
-	for {
-		bal, ok, err := balIterNext()
+	newRight, rightChanged := right, false
+	if mid := start + (uint64(1) << (depth - 1)); mid < p.chunkCount {
+		newRight, rightChanged, err = p.patch(right, depth-1, mid)
 		if err != nil {
-			return nil, err
+			return nil, false, err
 		}
-		if !ok {
+	}
+	if !leftChanged && !rightChanged {
+		return node, false, nil
+	}
+	return tree.NewPairNode(newLeft, newRight), true, nil
+}
+
+func (p *balanceChunksPatch) patchChunk(node tree.Node, chunk uint64) (tree.Node, bool, error) {
+	start := chunk * 4
+	end := start + 4
+	if end > uint64(len(p.rewards)) {
+		end = uint64(len(p.rewards))
+	}
+	nonZero := false
+	for i := start; i < end; i++ {
+		if p.rewards[i] != 0 || p.penalties[i] != 0 {
+			nonZero = true
 			break
 		}
-		bal += deltas.Rewards[i]
-		if penalty := deltas.Penalties[i]; bal >= penalty {
-			bal -= penalty
-		} else {
-			bal = 0
-		}
-		balancesOut = append(balancesOut, bal)
-		i++
 	}
-	return balancesOut, nil
+	if !nonZero {
+		return node, false, nil
+	}
+	leaf := node.MerkleRoot(nil)
+	for i := start; i < end; i++ {
+		offset := (i - start) * 8
+		bal := Gwei(binary.LittleEndian.Uint64(leaf[offset : offset+8]))
+		binary.LittleEndian.PutUint64(leaf[offset:offset+8], uint64(applyBalanceDelta(bal, p.rewards[i], p.penalties[i])))
+	}
+	if leaf == node.MerkleRoot(nil) {
+		return node, false, nil
+	}
+	return &leaf, true, nil
 }
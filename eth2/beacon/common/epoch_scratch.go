@@ -0,0 +1,160 @@
+package common
+
+import (
+	"errors"
+	"sync"
+)
+
+// EpochProcessScratch holds the large per-validator buffers of the epoch transition,
+// to re-use them between epoch transitions instead of re-allocating them every epoch.
+// Buffers are resized in place, and only re-allocated when the validator count grows beyond their capacity.
+//
+// The buffers are only valid until the next use of the scratch, and must not be retained after the epoch transition.
+// All methods can be called on a nil scratch, to allocate new buffers instead.
+type EpochProcessScratch struct {
+	flats    []FlatValidator
+	bounded  []BoundedIndex
+	indices  []ValidatorIndex
+	balances []Gwei
+
+	deltas     []*Deltas
+	usedDeltas int
+}
+
+var epochScratchPool = sync.Pool{
+	New: func() interface{} {
+		return new(EpochProcessScratch)
+	},
+}
+
+// GetEpochProcessScratch gets a scratch from the shared pool, see PutEpochProcessScratch.
+func GetEpochProcessScratch() *EpochProcessScratch {
+	s := epochScratchPool.Get().(*EpochProcessScratch)
+	s.usedDeltas = 0
+	return s
+}
+
+// PutEpochProcessScratch returns the scratch to the shared pool. The scratch and its buffers must not be used afterwards.
+func PutEpochProcessScratch(s *EpochProcessScratch) {
+	if s != nil {
+		epochScratchPool.Put(s)
+	}
+}
+
+// FlattenValidators is like the FlattenValidators function, but re-uses the flat validators buffer.
+func (s *EpochProcessScratch) FlattenValidators(vals ValidatorRegistry) ([]FlatValidator, error) {
+	count, err := vals.ValidatorCount()
+	if err != nil {
+		return nil, err
+	}
+	var out []FlatValidator
+	if s != nil && uint64(cap(s.flats)) >= count {
+		out = s.flats[:count]
+	} else {
+		out = make([]FlatValidator, count, count)
+		if s != nil {
+			s.flats = out
+		}
+	}
+	if err := flattenValidatorsInto(vals, out); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// LoadBoundedIndices is like the LoadBoundedIndices function, but re-uses the bounded indices buffer.
+func (s *EpochProcessScratch) LoadBoundedIndices(vals ValidatorRegistry) ([]BoundedIndex, error) {
+	count, err := vals.ValidatorCount()
+	if err != nil {
+		return nil, err
+	}
+	var out []BoundedIndex
+	if s != nil && uint64(cap(s.bounded)) >= count {
+		out = s.bounded[:count]
+	} else {
+		out = make([]BoundedIndex, count, count)
+		if s != nil {
+			s.bounded = out
+		}
+	}
+	if err := loadBoundedIndicesInto(vals, out); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// ValidatorIndices returns an empty validator indices buffer with at least the given capacity.
+func (s *EpochProcessScratch) ValidatorIndices(capacity uint64) []ValidatorIndex {
+	if s == nil {
+		return make([]ValidatorIndex, 0, capacity)
+	}
+	if uint64(cap(s.indices)) < capacity {
+		s.indices = make([]ValidatorIndex, 0, capacity)
+	}
+	return s.indices[:0]
+}
+
+// Deltas returns zeroed deltas for the given validator count. Every call returns different deltas,
+// until the scratch is returned to the pool.
+func (s *EpochProcessScratch) Deltas(validatorCount uint64) *Deltas {
+	if s == nil {
+		return NewDeltas(validatorCount)
+	}
+	if s.usedDeltas == len(s.deltas) {
+		s.deltas = append(s.deltas, NewDeltas(validatorCount))
+	}
+	d := s.deltas[s.usedDeltas]
+	s.usedDeltas++
+	if uint64(cap(d.Rewards)) < validatorCount || uint64(cap(d.Penalties)) < validatorCount {
+		*d = *NewDeltas(validatorCount)
+		return d
+	}
+	d.Rewards = d.Rewards[:validatorCount]
+	d.Penalties = d.Penalties[:validatorCount]
+	for i := range d.Rewards {
+		d.Rewards[i] = 0
+	}
+	for i := range d.Penalties {
+		d.Penalties[i] = 0
+	}
+	return d
+}
+
+// ApplyDeltas is like the ApplyDeltas function, but re-uses the balances buffer.
+func (s *EpochProcessScratch) ApplyDeltas(state BeaconState, deltas *Deltas) ([]Gwei, error) {
+	balances, err := state.Balances()
+	if err != nil {
+		return nil, err
+	}
+	length, err := balances.Length()
+	if err != nil {
+		return nil, err
+	}
+	if uint64(len(deltas.Penalties)) != length || uint64(len(deltas.Rewards)) != length {
+		return nil, errors.New("cannot apply deltas to balances list with different length")
+	}
+	var balancesOut []Gwei
+	if s != nil && uint64(cap(s.balances)) >= length {
+		balancesOut = s.balances[:0]
+	} else {
+		balancesOut = make([]Gwei, 0, length)
+		if s != nil {
+			s.balances = balancesOut
+		}
+	}
+	balIterNext := balances.Iter()
+	i := ValidatorIndex(0)
+	for {
+		bal, ok, err := balIterNext()
+		if err != nil {
+			return nil, err
+		}
+		if !ok {
+			break
+		}
+		bal = applyBalanceDelta(bal, deltas.Rewards[i], deltas.Penalties[i])
+		balancesOut = append(balancesOut, bal)
+		i++
+	}
+	return balancesOut, nil
+}
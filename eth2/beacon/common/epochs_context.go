@@ -57,6 +57,21 @@ type EpochsContext struct {
 	CurrentSyncCommittee *IndexedSyncCommittee
 	NextSyncCommittee    *IndexedSyncCommittee
 
+	// Optional, shared between contexts. Consulted when computing the shuffling of an epoch.
+	ShufflingCache *ShufflingCache
+	// Optional, shared between contexts. Consulted when computing the proposers of an epoch.
+	ProposerCache *ProposerCache
+	// Optional, shared between contexts. Consulted when converting attestations to indexed form.
+	IndexedAttestationCache *IndexedAttestationCache
+	// Optional, recently requested committees of this context. Not shared between contexts.
+	// Committees are already materialized per epoch as slices of the shuffling,
+	// so this only helps if committee retrieval becomes more expensive than a cache lookup.
+	CommitteeCache *CommitteeCache
+
+	// Number of workers for the per-validator computations of the epoch transition, see ParallelChunks.
+	// The computations are serial if <= 1, the default. The state is always changed serially.
+	EpochProcessParallelism int
+
 	// TODO: track active effective balances
 	// TODO: track total active stake
 	// Effective balances of all validators at the start of the epoch.
@@ -69,6 +84,18 @@ type EpochsContext struct {
 
 // NewEpochsContext constructs a new context for the processing of the current epoch.
 func NewEpochsContext(spec *Spec, state BeaconState) (*EpochsContext, error) {
+	return NewEpochsContextWithShufflingCache(spec, state, nil)
+}
+
+// NewEpochsContextWithShufflingCache constructs a new context for the processing of the current epoch,
+// re-using shufflings from the given cache where possible. The cache may be nil.
+func NewEpochsContextWithShufflingCache(spec *Spec, state BeaconState, cache *ShufflingCache) (*EpochsContext, error) {
+	return NewEpochsContextWithCaches(spec, state, cache, nil)
+}
+
+// NewEpochsContextWithCaches constructs a new context for the processing of the current epoch,
+// re-using shufflings and proposers from the given caches where possible. Either cache may be nil.
+func NewEpochsContextWithCaches(spec *Spec, state BeaconState, shufflingCache *ShufflingCache, proposerCache *ProposerCache) (*EpochsContext, error) {
 	vals, err := state.Validators()
 	if err != nil {
 		return nil, err
@@ -81,6 +108,8 @@ func NewEpochsContext(spec *Spec, state BeaconState) (*EpochsContext, error) {
 	epc := &EpochsContext{
 		Spec:                 spec,
 		ValidatorPubkeyCache: pc,
+		ShufflingCache:       shufflingCache,
+		ProposerCache:        proposerCache,
 	}
 	if err := epc.LoadShuffling(state); err != nil {
 		return nil, err
@@ -110,7 +139,10 @@ func (epc *EpochsContext) LoadShuffling(state BeaconState) error {
 		return err
 	}
 	currentEpoch := epc.Spec.SlotToEpoch(slot)
-	epc.CurrentEpoch, err = ComputeShufflingEpoch(epc.Spec, state, indicesBounded, currentEpoch)
+	if epc.CommitteeCache != nil {
+		epc.CommitteeCache.Reset()
+	}
+	epc.CurrentEpoch, err = epc.computeShufflingEpoch(state, indicesBounded, currentEpoch)
 	if err != nil {
 		return err
 	}
@@ -122,18 +154,33 @@ func (epc *EpochsContext) LoadShuffling(state BeaconState) error {
 	if prevEpoch == currentEpoch { // in case of genesis
 		epc.PreviousEpoch = epc.CurrentEpoch
 	} else {
-		epc.PreviousEpoch, err = ComputeShufflingEpoch(epc.Spec, state, indicesBounded, prevEpoch)
+		epc.PreviousEpoch, err = epc.computeShufflingEpoch(state, indicesBounded, prevEpoch)
 		if err != nil {
 			return err
 		}
 	}
-	epc.NextEpoch, err = ComputeShufflingEpoch(epc.Spec, state, indicesBounded, currentEpoch+1)
+	epc.NextEpoch, err = epc.computeShufflingEpoch(state, indicesBounded, currentEpoch+1)
 	if err != nil {
 		return err
 	}
 	return nil
 }
 
+func (epc *EpochsContext) computeShufflingEpoch(state BeaconState, indicesBounded []BoundedIndex, epoch Epoch) (*ShufflingEpoch, error) {
+	if epc.ShufflingCache == nil {
+		return ComputeShufflingEpoch(epc.Spec, state, indicesBounded, epoch)
+	}
+	mixes, err := state.RandaoMixes()
+	if err != nil {
+		return nil, err
+	}
+	seed, err := GetSeed(epc.Spec, mixes, epoch, DOMAIN_BEACON_ATTESTER)
+	if err != nil {
+		return nil, err
+	}
+	return epc.ShufflingCache.GetOrCompute(epc.Spec, indicesBounded, seed, epoch), nil
+}
+
 func (epc *EpochsContext) loadCurrentStake(state BeaconState, indicesBounded []BoundedIndex) error {
 	epc.EffectiveBalances = make([]Gwei, len(indicesBounded), len(indicesBounded))
 	epc.TotalActiveStake = 0
@@ -171,7 +218,7 @@ func (epc *EpochsContext) LoadProposers(state BeaconState) error {
 			return err
 		}
 	}
-	props, err := ComputeProposers(epc.Spec, state, epc.CurrentEpoch.Epoch, epc.CurrentEpoch.ActiveIndices)
+	props, err := ComputeProposersWithCache(epc.Spec, state, epc.CurrentEpoch.Epoch, epc.CurrentEpoch.ActiveIndices, epc.ProposerCache)
 	if err != nil {
 		return err
 	}
@@ -202,10 +249,22 @@ func (epc *EpochsContext) LoadSyncCommittees(state SyncCommitteeBeaconState) err
 func (epc *EpochsContext) Clone() *EpochsContext {
 	// All fields can be reused, just need a fresh shallow copy of the outer container
 	epcClone := *epc
+	// Except the committee cache: the clone may change shuffling independently.
+	if epc.CommitteeCache != nil {
+		epcClone.CommitteeCache = NewCommitteeCache(epc.CommitteeCache.maxEntries)
+	}
 	return &epcClone
 }
 
 func (epc *EpochsContext) RotateEpochs(state BeaconState) error {
+	return epc.rotateEpochs(state, nil)
+}
+
+// rotateEpochs is RotateEpochs, with the buffers of the epoch transition, or nil to allocate.
+func (epc *EpochsContext) rotateEpochs(state BeaconState, scratch *EpochProcessScratch) error {
+	if epc.CommitteeCache != nil {
+		epc.CommitteeCache.Reset()
+	}
 	epc.PreviousEpoch = epc.CurrentEpoch
 	epc.CurrentEpoch = epc.NextEpoch
 	nextEpoch := epc.CurrentEpoch.Epoch + 1
@@ -214,11 +273,11 @@ func (epc *EpochsContext) RotateEpochs(state BeaconState) error {
 		return err
 	}
 	// TODO: could use epoch-transition processing validator data to not read state here
-	indicesBounded, err := LoadBoundedIndices(vals)
+	indicesBounded, err := scratch.LoadBoundedIndices(vals)
 	if err != nil {
 		return err
 	}
-	epc.NextEpoch, err = ComputeShufflingEpoch(epc.Spec, state, indicesBounded, nextEpoch)
+	epc.NextEpoch, err = epc.computeShufflingEpoch(state, indicesBounded, nextEpoch)
 	if err != nil {
 		return err
 	}
@@ -297,22 +356,51 @@ func (epc *EpochsContext) getSlotComms(slot Slot) ([][]ValidatorIndex, error) {
 }
 
 func (epc *EpochsContext) getEpochComms(epoch Epoch) ([][][]ValidatorIndex, error) {
+	shep, err := epc.getShufflingEpoch(epoch)
+	if err != nil {
+		return nil, err
+	}
+	return shep.Committees, nil
+}
+
+func (epc *EpochsContext) getShufflingEpoch(epoch Epoch) (*ShufflingEpoch, error) {
 	if epoch == epc.PreviousEpoch.Epoch {
-		return epc.PreviousEpoch.Committees, nil
+		return epc.PreviousEpoch, nil
 	} else if epoch == epc.CurrentEpoch.Epoch {
-		return epc.CurrentEpoch.Committees, nil
+		return epc.CurrentEpoch, nil
 	} else if epoch == epc.NextEpoch.Epoch {
-		return epc.NextEpoch.Committees, nil
+		return epc.NextEpoch, nil
 	} else {
 		return nil, fmt.Errorf("beacon committee retrieval: out of range epoch: %d", epoch)
 	}
 }
 
+// Shuffling returns the shuffling of the previous, current or next epoch of the context.
+// The shuffling is shared, and must not be modified.
+func (epc *EpochsContext) Shuffling(epoch Epoch) (*ShufflingEpoch, error) {
+	return epc.getShufflingEpoch(epoch)
+}
+
+// ShufflingID returns the ID of the shuffling of the given epoch, see ShufflingEpoch.ID.
+func (epc *EpochsContext) ShufflingID(epoch Epoch) (uint64, error) {
+	shep, err := epc.getShufflingEpoch(epoch)
+	if err != nil {
+		return 0, err
+	}
+	return shep.ID(), nil
+}
+
 // Return the beacon committee at slot for index.
+// The committee is shared with the shuffling and the committee cache, and must not be modified.
 func (epc *EpochsContext) GetBeaconCommittee(slot Slot, index CommitteeIndex) ([]ValidatorIndex, error) {
 	if index >= CommitteeIndex(epc.Spec.MAX_COMMITTEES_PER_SLOT) {
 		return nil, fmt.Errorf("beacon committee retrieval: out of range committee index: %d", index)
 	}
+	if epc.CommitteeCache != nil {
+		if committee, ok := epc.CommitteeCache.Get(slot, index); ok {
+			return committee, nil
+		}
+	}
 
 	slotComms, err := epc.getSlotComms(slot)
 	if err != nil {
@@ -322,9 +410,35 @@ func (epc *EpochsContext) GetBeaconCommittee(slot Slot, index CommitteeIndex) ([
 	if index >= CommitteeIndex(len(slotComms)) {
 		return nil, fmt.Errorf("beacon committee retrieval: out of range committee index: %d", index)
 	}
+	if epc.CommitteeCache != nil {
+		epc.CommitteeCache.Add(slot, index, slotComms[index])
+	}
 	return slotComms[index], nil
 }
 
+// PrefetchSlot caches all committees of the slot at once, e.g. before processing the attestations of a block.
+func (epc *EpochsContext) PrefetchSlot(slot Slot) error {
+	slotComms, err := epc.getSlotComms(slot)
+	if err != nil {
+		return err
+	}
+	if epc.CommitteeCache == nil {
+		return nil
+	}
+	epc.CommitteeCache.Lock()
+	defer epc.CommitteeCache.Unlock()
+	for i, committee := range slotComms {
+		epc.CommitteeCache.add(committeeKey{slot, CommitteeIndex(i)}, committee)
+	}
+	return nil
+}
+
+// ChurnLimit returns the max number of validators that may exit, or activate, per epoch,
+// based on the active validators of the current epoch.
+func (epc *EpochsContext) ChurnLimit() uint64 {
+	return epc.Spec.GetChurnLimit(uint64(len(epc.CurrentEpoch.ActiveIndices)))
+}
+
 func (epc *EpochsContext) GetCommitteeCountPerSlot(epoch Epoch) (uint64, error) {
 	epochComms, err := epc.getEpochComms(epoch)
 	return uint64(len(epochComms[0])), err
@@ -0,0 +1,139 @@
+package common
+
+import (
+	"sync"
+)
+
+// EpochsContextKey identifies the context of an epoch on a branch. The shufflings, proposers and effective balances
+// of an epoch are all decided by the epoch transition: states of the same epoch that descend from the same block
+// at the last slot of the previous epoch have the same context.
+type EpochsContextKey struct {
+	Epoch Epoch
+	// DecisionRoot is the block root at the last slot before the epoch, or the zero root for the genesis epoch.
+	DecisionRoot Root
+}
+
+// NewEpochsContextKey returns the key of the context of the current epoch of the state.
+func NewEpochsContextKey(spec *Spec, state BeaconState) (EpochsContextKey, error) {
+	slot, err := state.Slot()
+	if err != nil {
+		return EpochsContextKey{}, err
+	}
+	epoch := spec.SlotToEpoch(slot)
+	key := EpochsContextKey{Epoch: epoch}
+	if epoch == GENESIS_EPOCH {
+		return key, nil
+	}
+	start, err := spec.EpochStartSlot(epoch)
+	if err != nil {
+		return EpochsContextKey{}, err
+	}
+	key.DecisionRoot, err = GetBlockRootAtSlot(spec, state, start-1)
+	if err != nil {
+		return EpochsContextKey{}, err
+	}
+	return key, nil
+}
+
+// EpochsContextCache is a bounded cache of the contexts of recent epochs, shared between the states of a branch,
+// so only the first state of a branch in a new epoch computes a context.
+// The cached contexts are shared as-is, and must not be modified: clone a context before processing with it,
+// the shufflings and proposers are shared with the clone.
+// The least recently used context is evicted when the cache is full. Evicted contexts are not released,
+// as other users may still hold them.
+type EpochsContextCache struct {
+	sync.Mutex
+	maxEntries int
+	entries    map[EpochsContextKey]*EpochsContext
+	// keys, least recently used first
+	order []EpochsContextKey
+
+	hits   uint64
+	misses uint64
+}
+
+func NewEpochsContextCache(maxEntries int) *EpochsContextCache {
+	if maxEntries < 1 {
+		maxEntries = 1
+	}
+	return &EpochsContextCache{
+		maxEntries: maxEntries,
+		entries:    make(map[EpochsContextKey]*EpochsContext, maxEntries),
+	}
+}
+
+func (ec *EpochsContextCache) touch(key EpochsContextKey) {
+	for i, k := range ec.order {
+		if k == key {
+			ec.order = append(ec.order[:i], ec.order[i+1:]...)
+			break
+		}
+	}
+	ec.order = append(ec.order, key)
+}
+
+// Get retrieves a cached context, and counts the hit or miss.
+func (ec *EpochsContextCache) Get(key EpochsContextKey) (epc *EpochsContext, ok bool) {
+	ec.Lock()
+	defer ec.Unlock()
+	epc, ok = ec.entries[key]
+	if ok {
+		ec.hits++
+		ec.touch(key)
+	} else {
+		ec.misses++
+	}
+	return
+}
+
+// Add caches the context, evicting the least recently used context if the cache is full.
+// If a context is already cached for the key, the cached context is kept and returned instead,
+// so concurrent misses end up sharing the same context.
+func (ec *EpochsContextCache) Add(key EpochsContextKey, epc *EpochsContext) *EpochsContext {
+	ec.Lock()
+	defer ec.Unlock()
+	if prev, ok := ec.entries[key]; ok {
+		ec.touch(key)
+		return prev
+	}
+	if len(ec.entries) >= ec.maxEntries {
+		delete(ec.entries, ec.order[0])
+		ec.order = ec.order[1:]
+	}
+	ec.entries[key] = epc
+	ec.touch(key)
+	return epc
+}
+
+// GetOrCompute returns the cached context of the current epoch of the state, or computes and caches it.
+// The compute function is only called on a miss, and should return the context of the state.
+// The returned context is shared: it must be cloned before modifying it.
+func (ec *EpochsContextCache) GetOrCompute(spec *Spec, state BeaconState, compute func() (*EpochsContext, error)) (*EpochsContext, error) {
+	key, err := NewEpochsContextKey(spec, state)
+	if err != nil {
+		return nil, err
+	}
+	if epc, ok := ec.Get(key); ok {
+		return epc, nil
+	}
+	// Computed without holding the lock, concurrent misses may compute the same context twice.
+	epc, err := compute()
+	if err != nil {
+		return nil, err
+	}
+	return ec.Add(key, epc), nil
+}
+
+// Len returns the number of cached contexts.
+func (ec *EpochsContextCache) Len() int {
+	ec.Lock()
+	defer ec.Unlock()
+	return len(ec.entries)
+}
+
+// Stats returns the number of cache hits and misses so far.
+func (ec *EpochsContextCache) Stats() (hits uint64, misses uint64) {
+	ec.Lock()
+	defer ec.Unlock()
+	return ec.hits, ec.misses
+}
@@ -16,30 +16,30 @@ type Hash32 = Root
 
 const Hash32Type = RootType
 
-const MAX_EXTRA_DATA_BYTES = 32
-
-var ExtraDataType = BasicListType(Uint8Type, MAX_EXTRA_DATA_BYTES)
+func ExtraDataType(spec *Spec) *BasicListTypeDef {
+	return BasicListType(Uint8Type, uint64(spec.MAX_EXTRA_DATA_BYTES))
+}
 
 type ExtraData []byte
 
-func (otx *ExtraData) Deserialize(dr *codec.DecodingReader) error {
-	return dr.ByteList((*[]byte)(otx), MAX_EXTRA_DATA_BYTES)
+func (otx *ExtraData) Deserialize(spec *Spec, dr *codec.DecodingReader) error {
+	return dr.ByteList((*[]byte)(otx), uint64(spec.MAX_EXTRA_DATA_BYTES))
 }
 
-func (otx ExtraData) Serialize(w *codec.EncodingWriter) error {
+func (otx ExtraData) Serialize(spec *Spec, w *codec.EncodingWriter) error {
 	return w.Write(otx)
 }
 
-func (otx ExtraData) ByteLength() (out uint64) {
+func (otx ExtraData) ByteLength(spec *Spec) (out uint64) {
 	return uint64(len(otx))
 }
 
-func (otx *ExtraData) FixedLength() uint64 {
+func (otx *ExtraData) FixedLength(spec *Spec) uint64 {
 	return 0
 }
 
-func (otx ExtraData) HashTreeRoot(hFn tree.HashFn) Root {
-	return hFn.ByteListHTR(otx, MAX_EXTRA_DATA_BYTES)
+func (otx ExtraData) HashTreeRoot(spec *Spec, hFn tree.HashFn) Root {
+	return hFn.ByteListHTR(otx, uint64(spec.MAX_EXTRA_DATA_BYTES))
 }
 
 func (otx ExtraData) MarshalText() ([]byte, error) {
@@ -57,9 +57,9 @@ func (otx *ExtraData) UnmarshalText(text []byte) error {
 	return conv.DynamicBytesUnmarshalText((*[]byte)(otx), text[:])
 }
 
-func (otx ExtraData) View() (*ExtraDataView, error) {
+func (otx ExtraData) View(spec *Spec) (*ExtraDataView, error) {
 	dec := codec.NewDecodingReader(bytes.NewReader(otx), uint64(len(otx)))
-	return AsExtraData(ExtraDataType.Deserialize(dec))
+	return AsExtraData(ExtraDataType(spec).Deserialize(dec))
 }
 
 type ExtraDataView struct {
@@ -0,0 +1,45 @@
+package common
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/protolambda/ztyp/codec"
+	"github.com/protolambda/ztyp/tree"
+)
+
+func TestExtraDataSpecLimit(t *testing.T) {
+	small, large := &Spec{}, &Spec{}
+	small.MAX_EXTRA_DATA_BYTES = 32
+	large.MAX_EXTRA_DATA_BYTES = 64
+	data := make([]byte, 40)
+	for i := range data {
+		data[i] = byte(i)
+	}
+	decode := func(spec *Spec) (ExtraData, error) {
+		var out ExtraData
+		err := out.Deserialize(spec, codec.NewDecodingReader(bytes.NewReader(data), uint64(len(data))))
+		return out, err
+	}
+	if _, err := decode(small); err == nil {
+		t.Fatal("expected extra data to exceed the limit")
+	}
+	extra, err := decode(large)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(extra, data) {
+		t.Fatal("decoded extra data does not match")
+	}
+	v, err := extra.View(large)
+	if err != nil {
+		t.Fatal(err)
+	}
+	hFn := tree.GetHashFn()
+	if root := extra.HashTreeRoot(large, hFn); root != v.HashTreeRoot(hFn) {
+		t.Fatalf("hash-tree-root %s does not match view root %s", root, v.HashTreeRoot(hFn))
+	}
+	if _, err := extra.View(small); err == nil {
+		t.Fatal("expected view to enforce the limit of the spec")
+	}
+}
@@ -13,24 +13,27 @@ func (v *FlatValidator) IsActive(epoch Epoch) bool {
 	return v.ActivationEpoch <= epoch && epoch < v.ExitEpoch
 }
 
+func (v *FlatValidator) IsSlashable(epoch Epoch) bool {
+	return !v.Slashed && v.ActivationEpoch <= epoch && epoch < v.WithdrawableEpoch
+}
+
 func FlattenValidators(vals ValidatorRegistry) ([]FlatValidator, error) {
-	count, err := vals.ValidatorCount()
-	if err != nil {
-		return nil, err
-	}
-	out := make([]FlatValidator, count, count)
+	return (*EpochProcessScratch)(nil).FlattenValidators(vals)
+}
+
+func flattenValidatorsInto(vals ValidatorRegistry, out []FlatValidator) error {
 	next := vals.Iter()
-	for i := uint64(0); i < count; i++ {
+	for i := range out {
 		v, ok, err := next()
 		if err != nil {
-			return nil, err
+			return err
 		}
 		if !ok {
 			break
 		}
 		if err := v.Flatten(&out[i]); err != nil {
-			return nil, err
+			return err
 		}
 	}
-	return out, nil
+	return nil
 }
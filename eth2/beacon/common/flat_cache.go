@@ -0,0 +1,226 @@
+package common
+
+import (
+	"fmt"
+	"sync"
+
+	"github.com/protolambda/ztyp/tree"
+)
+
+// FlatValidatorCache is a flat snapshot of the validator registry of a single state,
+// to check operations against the validator registry without reading the state tree for every check.
+// It is loaded from the state on first use, and patched by the operation processors
+// when block processing slashes, exits or adds validators.
+//
+// The cache belongs to a single state, see FlatValidatorsState: a copy of the state gets a copy of the cache.
+// The registry root of the last load or patch is remembered, and the snapshot is loaded again
+// if the registry of the state was changed otherwise, e.g. by the epoch transition.
+// All methods can be called on a nil cache, to read from the state instead.
+type FlatValidatorCache struct {
+	mu    sync.RWMutex
+	flats []FlatValidator
+	// node is the backing of the validator registry the flats were read from, nil if not loaded
+	node tree.Node
+	// shared is true when the flats slice may be referenced by the cache of a copy of the state,
+	// the slice is copied before it is changed.
+	shared bool
+}
+
+func NewFlatValidatorCache() *FlatValidatorCache {
+	return new(FlatValidatorCache)
+}
+
+// FlatValidatorsState is a state that keeps a flat validator snapshot.
+type FlatValidatorsState interface {
+	FlatValidators() *FlatValidatorCache
+}
+
+// StateFlatValidators returns the flat validator snapshot of the state, or nil if the state does not keep one.
+func StateFlatValidators(state BeaconState) *FlatValidatorCache {
+	if fs, ok := state.(FlatValidatorsState); ok {
+		return fs.FlatValidators()
+	}
+	return nil
+}
+
+func registryNode(vals ValidatorRegistry) tree.Node {
+	if b, ok := vals.(interface{ Backing() tree.Node }); ok {
+		return b.Backing()
+	}
+	return nil
+}
+
+func (fc *FlatValidatorCache) loadMaybe(state BeaconState) error {
+	vals, err := state.Validators()
+	if err != nil {
+		return err
+	}
+	node := registryNode(vals)
+	fc.mu.RLock()
+	loaded := node != nil && fc.node == node
+	fc.mu.RUnlock()
+	if loaded {
+		return nil
+	}
+	fc.mu.Lock()
+	defer fc.mu.Unlock()
+	if node != nil && fc.node == node {
+		return nil
+	}
+	flats, err := FlattenValidators(vals)
+	if err != nil {
+		return fmt.Errorf("failed to load flat validator cache: %v", err)
+	}
+	fc.flats = flats
+	fc.node = node
+	fc.shared = false
+	return nil
+}
+
+// Validator returns the flat data of the given validator, loading the snapshot from the state if necessary.
+func (fc *FlatValidatorCache) Validator(state BeaconState, index ValidatorIndex) (FlatValidator, error) {
+	if fc == nil {
+		return readFlatValidator(state, index)
+	}
+	if err := fc.loadMaybe(state); err != nil {
+		return FlatValidator{}, err
+	}
+	fc.mu.RLock()
+	if uint64(index) < uint64(len(fc.flats)) {
+		v := fc.flats[index]
+		fc.mu.RUnlock()
+		return v, nil
+	}
+	fc.mu.RUnlock()
+	return readFlatValidator(state, index)
+}
+
+// Each calls fn with the flat data of every validator, in order of validator index,
+// loading the snapshot from the state if necessary. The cache is locked for reading during the iteration.
+func (fc *FlatValidatorCache) Each(state BeaconState, fn func(index ValidatorIndex, v *FlatValidator)) error {
+	if fc == nil {
+		vals, err := state.Validators()
+		if err != nil {
+			return err
+		}
+		flats, err := FlattenValidators(vals)
+		if err != nil {
+			return err
+		}
+		for i := range flats {
+			fn(ValidatorIndex(i), &flats[i])
+		}
+		return nil
+	}
+	if err := fc.loadMaybe(state); err != nil {
+		return err
+	}
+	fc.mu.RLock()
+	defer fc.mu.RUnlock()
+	for i := range fc.flats {
+		fn(ValidatorIndex(i), &fc.flats[i])
+	}
+	return nil
+}
+
+func (fc *FlatValidatorCache) ownFlats() {
+	if fc.shared {
+		fc.flats = append(make([]FlatValidator, 0, len(fc.flats)), fc.flats...)
+		fc.shared = false
+	}
+}
+
+// sync moves the snapshot to the current registry of the state, after it was patched with the same change.
+// The snapshot is dropped if the registry cannot be read.
+func (fc *FlatValidatorCache) sync(state BeaconState) {
+	vals, err := state.Validators()
+	if err != nil {
+		fc.flats = nil
+		fc.node = nil
+		return
+	}
+	fc.node = registryNode(vals)
+}
+
+// Update patches the data of the given validator, directly after the same change was made to the validator in the state.
+// The snapshot then follows the changed registry: other changes to the registry since the last load or patch
+// are not detected anymore. Nothing is patched if the snapshot is not loaded.
+func (fc *FlatValidatorCache) Update(state BeaconState, index ValidatorIndex, fn func(v *FlatValidator)) {
+	if fc == nil {
+		return
+	}
+	fc.mu.Lock()
+	defer fc.mu.Unlock()
+	if fc.node == nil || uint64(index) >= uint64(len(fc.flats)) {
+		return
+	}
+	fc.ownFlats()
+	fn(&fc.flats[index])
+	fc.sync(state)
+}
+
+// AddValidator adds the data of a validator that was just added to the state, if the snapshot is loaded.
+// If the validator does not directly follow the snapshot, the snapshot is dropped,
+// to be loaded from the state again when it is used.
+func (fc *FlatValidatorCache) AddValidator(state BeaconState, index ValidatorIndex) error {
+	if fc == nil {
+		return nil
+	}
+	fc.mu.Lock()
+	defer fc.mu.Unlock()
+	if fc.node == nil {
+		return nil
+	}
+	if uint64(index) != uint64(len(fc.flats)) {
+		fc.flats = nil
+		fc.node = nil
+		return nil
+	}
+	v, err := readFlatValidator(state, index)
+	if err != nil {
+		return err
+	}
+	fc.ownFlats()
+	fc.flats = append(fc.flats, v)
+	fc.sync(state)
+	return nil
+}
+
+// Invalidate drops the snapshot, to be loaded from the state again when it is used.
+func (fc *FlatValidatorCache) Invalidate() {
+	if fc == nil {
+		return
+	}
+	fc.mu.Lock()
+	defer fc.mu.Unlock()
+	fc.flats = nil
+	fc.node = nil
+	fc.shared = false
+}
+
+// Clone returns a copy of the cache, for a copy of the state.
+// The snapshot is shared until either cache is patched.
+func (fc *FlatValidatorCache) Clone() *FlatValidatorCache {
+	if fc == nil {
+		return nil
+	}
+	fc.mu.Lock()
+	defer fc.mu.Unlock()
+	if fc.node != nil {
+		fc.shared = true
+	}
+	return &FlatValidatorCache{flats: fc.flats, node: fc.node, shared: fc.shared}
+}
+
+func readFlatValidator(state BeaconState, index ValidatorIndex) (out FlatValidator, err error) {
+	vals, err := state.Validators()
+	if err != nil {
+		return out, err
+	}
+	v, err := vals.Validator(index)
+	if err != nil {
+		return out, err
+	}
+	err = v.Flatten(&out)
+	return
+}
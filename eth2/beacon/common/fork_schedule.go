@@ -0,0 +1,145 @@
+package common
+
+type ForkName string
+
+const (
+	Phase0    ForkName = "phase0"
+	Altair    ForkName = "altair"
+	Bellatrix ForkName = "bellatrix"
+	Capella   ForkName = "capella"
+	Deneb     ForkName = "deneb"
+)
+
+// ForkEntry is a fork of the schedule: the fork version is active from the start of the fork epoch.
+type ForkEntry struct {
+	Name    ForkName
+	Version Version
+	// FAR_FUTURE_EPOCH if the fork is not scheduled
+	Epoch Epoch
+}
+
+func (f *ForkEntry) Scheduled() bool {
+	return f.Epoch != FAR_FUTURE_EPOCH
+}
+
+// Digest computes the fork digest of the fork version, for the chain with the genesis validators root.
+func (f *ForkEntry) Digest(genesisValidatorsRoot Root) ForkDigest {
+	return ComputeForkDigest(f.Version, genesisValidatorsRoot)
+}
+
+// ForkSchedule lists every fork in upgrade order, starting with the genesis fork at epoch 0.
+type ForkSchedule []ForkEntry
+
+// ForkSchedule derives the fork schedule from the fork versions and epochs of the config.
+// A fork scheduled before the fork it upgrades from is treated as not scheduled,
+// e.g. a fork epoch that is missing in an older config.
+func (spec *Spec) ForkSchedule() ForkSchedule {
+	schedule := ForkSchedule{
+		{Name: Phase0, Version: spec.GENESIS_FORK_VERSION, Epoch: 0},
+		{Name: Altair, Version: spec.ALTAIR_FORK_VERSION, Epoch: spec.ALTAIR_FORK_EPOCH},
+		{Name: Bellatrix, Version: spec.BELLATRIX_FORK_VERSION, Epoch: spec.BELLATRIX_FORK_EPOCH},
+		{Name: Capella, Version: spec.CAPELLA_FORK_VERSION, Epoch: spec.CAPELLA_FORK_EPOCH},
+		{Name: Deneb, Version: spec.DENEB_FORK_VERSION, Epoch: spec.DENEB_FORK_EPOCH},
+	}
+	for i := 1; i < len(schedule); i++ {
+		if schedule[i].Epoch < schedule[i-1].Epoch {
+			schedule[i].Epoch = FAR_FUTURE_EPOCH
+		}
+	}
+	return schedule
+}
+
+// ForkAtEpoch returns the latest fork that is active at the epoch.
+func (fs ForkSchedule) ForkAtEpoch(epoch Epoch) ForkEntry {
+	out := fs[0]
+	for _, f := range fs[1:] {
+		if !f.Scheduled() || f.Epoch > epoch {
+			break
+		}
+		out = f
+	}
+	return out
+}
+
+func (fs ForkSchedule) VersionAtEpoch(epoch Epoch) Version {
+	return fs.ForkAtEpoch(epoch).Version
+}
+
+// ForkForVersion finds the fork with the version, scheduled or not.
+func (fs ForkSchedule) ForkForVersion(v Version) (ForkEntry, bool) {
+	for _, f := range fs {
+		if f.Version == v {
+			return f, true
+		}
+	}
+	return ForkEntry{}, false
+}
+
+// ForkByName finds the fork with the name, scheduled or not.
+func (fs ForkSchedule) ForkByName(name ForkName) (ForkEntry, bool) {
+	for _, f := range fs {
+		if f.Name == name {
+			return f, true
+		}
+	}
+	return ForkEntry{}, false
+}
+
+// Next returns the first scheduled fork after the epoch, or nil if there is none.
+func (fs ForkSchedule) Next(epoch Epoch) *ForkEntry {
+	for i := range fs {
+		if !fs[i].Scheduled() {
+			break
+		}
+		if fs[i].Epoch > epoch {
+			return &fs[i]
+		}
+	}
+	return nil
+}
+
+// NextForkEpoch returns the epoch of the first scheduled fork after the epoch, if there is any.
+func (fs ForkSchedule) NextForkEpoch(epoch Epoch) (Epoch, bool) {
+	if next := fs.Next(epoch); next != nil {
+		return next.Epoch, true
+	}
+	return FAR_FUTURE_EPOCH, false
+}
+
+// ForkDigest computes the digest of the fork that is active at the epoch.
+func (fs ForkSchedule) ForkDigest(genesisValidatorsRoot Root, epoch Epoch) ForkDigest {
+	f := fs.ForkAtEpoch(epoch)
+	return f.Digest(genesisValidatorsRoot)
+}
+
+// GetDomain returns the signature domain of a message with the fork version that is active at the message epoch.
+// Unlike the domain of the state fork, this is also correct for messages from before the previous fork.
+func (fs ForkSchedule) GetDomain(dom BLSDomainType, genesisValidatorsRoot Root, messageEpoch Epoch) BLSDomain {
+	return ComputeDomain(dom, fs.VersionAtEpoch(messageEpoch), genesisValidatorsRoot)
+}
+
+// After returns the fork that upgrades from the named fork, or nil if it is the last fork.
+// The returned fork may not be scheduled.
+func (fs ForkSchedule) After(name ForkName) *ForkEntry {
+	for i := 0; i+1 < len(fs); i++ {
+		if fs[i].Name == name {
+			return &fs[i+1]
+		}
+	}
+	return nil
+}
+
+// Eth2Data is the fork information of the node record at the epoch.
+func (fs ForkSchedule) Eth2Data(epoch Epoch, genesisValidatorsRoot Root) Eth2Data {
+	current := fs.ForkAtEpoch(epoch)
+	out := Eth2Data{
+		ForkDigest:      current.Digest(genesisValidatorsRoot),
+		NextForkVersion: current.Version,
+		NextForkEpoch:   FAR_FUTURE_EPOCH,
+	}
+	if next := fs.Next(epoch); next != nil {
+		out.NextForkVersion = next.Version
+		out.NextForkEpoch = next.Epoch
+	}
+	return out
+}
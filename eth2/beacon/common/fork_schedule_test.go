@@ -0,0 +1,129 @@
+package common
+
+import (
+	"crypto/sha256"
+	"testing"
+)
+
+func testForkSpec(altair, bellatrix, capella, deneb Epoch) *Spec {
+	spec := &Spec{}
+	spec.GENESIS_FORK_VERSION = Version{0, 0, 0, 1}
+	spec.ALTAIR_FORK_VERSION, spec.ALTAIR_FORK_EPOCH = Version{1, 0, 0, 1}, altair
+	spec.BELLATRIX_FORK_VERSION, spec.BELLATRIX_FORK_EPOCH = Version{2, 0, 0, 1}, bellatrix
+	spec.CAPELLA_FORK_VERSION, spec.CAPELLA_FORK_EPOCH = Version{3, 0, 0, 1}, capella
+	spec.DENEB_FORK_VERSION, spec.DENEB_FORK_EPOCH = Version{4, 0, 0, 1}, deneb
+	spec.SLOTS_PER_EPOCH = 8
+	return spec
+}
+
+func TestForkScheduleDisabledFork(t *testing.T) {
+	spec := testForkSpec(10, 20, 30, FAR_FUTURE_EPOCH)
+	fs := spec.ForkSchedule()
+	for _, c := range []struct {
+		epoch Epoch
+		name  ForkName
+	}{{0, Phase0}, {9, Phase0}, {10, Altair}, {29, Bellatrix}, {30, Capella}, {1 << 40, Capella}, {FAR_FUTURE_EPOCH, Capella}} {
+		if got := fs.ForkAtEpoch(c.epoch); got.Name != c.name {
+			t.Errorf("epoch %d: expected %s, got %s", c.epoch, c.name, got.Name)
+		}
+	}
+	if v := spec.ForkVersion(Slot(30) * spec.SLOTS_PER_EPOCH); v != spec.CAPELLA_FORK_VERSION {
+		t.Errorf("unexpected fork version %s", v)
+	}
+	if next := fs.Next(20); next == nil || next.Name != Capella {
+		t.Errorf("expected capella to be next, got %v", next)
+	}
+	if next := fs.Next(30); next != nil {
+		t.Errorf("expected no next fork after capella, got %s", next.Name)
+	}
+	// the version of the disabled fork is still known
+	if f, ok := fs.ForkForVersion(spec.DENEB_FORK_VERSION); !ok || f.Name != Deneb || f.Scheduled() {
+		t.Errorf("unexpected deneb fork entry: %v %v", f, ok)
+	}
+	if _, ok := fs.ForkForVersion(Version{9, 9, 9, 9}); ok {
+		t.Error("expected unknown version")
+	}
+	data := fs.Eth2Data(30, Root{1})
+	if data.NextForkEpoch != FAR_FUTURE_EPOCH || data.NextForkVersion != spec.CAPELLA_FORK_VERSION ||
+		data.ForkDigest != ComputeForkDigest(spec.CAPELLA_FORK_VERSION, Root{1}) {
+		t.Errorf("unexpected eth2 data: %+v", data)
+	}
+	if data := fs.Eth2Data(15, Root{1}); data.NextForkEpoch != 20 || data.NextForkVersion != spec.BELLATRIX_FORK_VERSION {
+		t.Errorf("unexpected eth2 data: %+v", data)
+	}
+}
+
+func TestForkScheduleGenesisForks(t *testing.T) {
+	spec := testForkSpec(0, 0, 0, 2)
+	fs := spec.ForkSchedule()
+	if f := fs.ForkAtEpoch(0); f.Name != Capella {
+		t.Errorf("expected capella at genesis, got %s", f.Name)
+	}
+	if f := fs.ForkAtEpoch(2); f.Name != Deneb {
+		t.Errorf("expected deneb at epoch 2, got %s", f.Name)
+	}
+	if next := fs.Next(0); next == nil || next.Name != Deneb {
+		t.Errorf("expected deneb to be next, got %v", next)
+	}
+	if after := fs.After(Phase0); after == nil || after.Name != Altair {
+		t.Errorf("expected altair after phase0, got %v", after)
+	}
+	if after := fs.After(Deneb); after != nil {
+		t.Errorf("expected no fork after deneb, got %s", after.Name)
+	}
+}
+
+func TestForkScheduleOutOfOrder(t *testing.T) {
+	// a fork epoch that is missing in the config is treated as not scheduled
+	spec := testForkSpec(10, 20, 30, 0)
+	fs := spec.ForkSchedule()
+	if f, _ := fs.ForkByName(Deneb); f.Scheduled() {
+		t.Fatal("expected deneb to not be scheduled")
+	}
+	if f := fs.ForkAtEpoch(40); f.Name != Capella {
+		t.Errorf("expected capella, got %s", f.Name)
+	}
+}
+
+func TestForkScheduleDigests(t *testing.T) {
+	// capella is scheduled in the future
+	spec := testForkSpec(0, 10, 100, FAR_FUTURE_EPOCH)
+	fs := spec.ForkSchedule()
+	genesisValRoot := Root{0x42}
+	digest := func(v Version) (out ForkDigest) {
+		// hash_tree_root(ForkData): the version is padded to a chunk, followed by the root
+		var data [64]byte
+		copy(data[:4], v[:])
+		copy(data[32:], genesisValRoot[:])
+		h := sha256.Sum256(data[:])
+		copy(out[:], h[:4])
+		return
+	}
+	for _, c := range []struct {
+		epoch   Epoch
+		version Version
+		next    Epoch
+	}{{0, spec.ALTAIR_FORK_VERSION, 10}, {9, spec.ALTAIR_FORK_VERSION, 10}, {10, spec.BELLATRIX_FORK_VERSION, 100},
+		{99, spec.BELLATRIX_FORK_VERSION, 100}, {100, spec.CAPELLA_FORK_VERSION, FAR_FUTURE_EPOCH}} {
+		if got, expected := fs.ForkDigest(genesisValRoot, c.epoch), digest(c.version); got != expected {
+			t.Errorf("epoch %d: expected digest %s, got %s", c.epoch, expected, got)
+		}
+		next, ok := fs.NextForkEpoch(c.epoch)
+		if next != c.next || ok != (c.next != FAR_FUTURE_EPOCH) {
+			t.Errorf("epoch %d: expected next fork epoch %d, got %d %v", c.epoch, c.next, next, ok)
+		}
+		if got, expected := fs.GetDomain(DOMAIN_BEACON_PROPOSER, genesisValRoot, c.epoch),
+			ComputeDomain(DOMAIN_BEACON_PROPOSER, c.version, genesisValRoot); got != expected {
+			t.Errorf("epoch %d: expected domain %s, got %s", c.epoch, expected, got)
+		}
+	}
+	// the state fork only knows the previous version
+	stateFork := Fork{PreviousVersion: spec.BELLATRIX_FORK_VERSION, CurrentVersion: spec.CAPELLA_FORK_VERSION, Epoch: 100}
+	old, err := stateFork.GetDomain(DOMAIN_BEACON_PROPOSER, genesisValRoot, 5)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if old == fs.GetDomain(DOMAIN_BEACON_PROPOSER, genesisValRoot, 5) {
+		t.Error("expected the schedule to use the altair version for epoch 5")
+	}
+}
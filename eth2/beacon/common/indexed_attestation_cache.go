@@ -0,0 +1,95 @@
+package common
+
+import (
+	"container/list"
+	"sync"
+)
+
+// IndexedAttestationKey identifies the attesting indices of an attestation.
+// The data root covers the slot and committee index, the shuffling ID the committee members,
+// and the bits digest the participants within the committee.
+type IndexedAttestationKey struct {
+	// ID of the shuffling of the attestation slot, see ShufflingEpoch.ID.
+	// Branches with a different shuffling never share attesting indices.
+	Shuffling uint64
+	DataRoot  Root
+	// SHA-256 digest of the aggregation bitlist, including the length bit.
+	BitsDigest Root
+}
+
+type indexedAttestationEntry struct {
+	key     IndexedAttestationKey
+	indices []ValidatorIndex
+}
+
+// IndexedAttestationCache is a bounded cache of the attesting indices of recently converted attestations,
+// shared between EpochsContexts, so the same aggregate seen on gossip, in the pool and in blocks is converted only once.
+// The cached indices are shared, not copied, and must be treated as read-only.
+// The least recently used indices are evicted when the cache is full.
+type IndexedAttestationCache struct {
+	sync.Mutex
+	maxEntries int
+	entries    map[IndexedAttestationKey]*list.Element
+	// least recently used at the back
+	lru *list.List
+
+	hits   uint64
+	misses uint64
+}
+
+func NewIndexedAttestationCache(maxEntries int) *IndexedAttestationCache {
+	if maxEntries < 1 {
+		maxEntries = 1
+	}
+	return &IndexedAttestationCache{
+		maxEntries: maxEntries,
+		entries:    make(map[IndexedAttestationKey]*list.Element, maxEntries),
+		lru:        list.New(),
+	}
+}
+
+// Get returns the cached attesting indices, if any, and counts the hit or miss.
+// The returned indices are read-only.
+func (ic *IndexedAttestationCache) Get(key IndexedAttestationKey) (indices []ValidatorIndex, ok bool) {
+	ic.Lock()
+	defer ic.Unlock()
+	elem, ok := ic.entries[key]
+	if !ok {
+		ic.misses++
+		return nil, false
+	}
+	ic.hits++
+	ic.lru.MoveToFront(elem)
+	return elem.Value.(*indexedAttestationEntry).indices, true
+}
+
+// Add caches the attesting indices, evicting the least recently used indices if the cache is full.
+func (ic *IndexedAttestationCache) Add(key IndexedAttestationKey, indices []ValidatorIndex) {
+	ic.Lock()
+	defer ic.Unlock()
+	if elem, ok := ic.entries[key]; ok {
+		elem.Value.(*indexedAttestationEntry).indices = indices
+		ic.lru.MoveToFront(elem)
+		return
+	}
+	if ic.lru.Len() >= ic.maxEntries {
+		last := ic.lru.Back()
+		ic.lru.Remove(last)
+		delete(ic.entries, last.Value.(*indexedAttestationEntry).key)
+	}
+	ic.entries[key] = ic.lru.PushFront(&indexedAttestationEntry{key: key, indices: indices})
+}
+
+// Len returns the number of cached attesting indices.
+func (ic *IndexedAttestationCache) Len() int {
+	ic.Lock()
+	defer ic.Unlock()
+	return len(ic.entries)
+}
+
+// Stats returns the number of cache hits and misses so far.
+func (ic *IndexedAttestationCache) Stats() (hits uint64, misses uint64) {
+	ic.Lock()
+	defer ic.Unlock()
+	return ic.hits, ic.misses
+}
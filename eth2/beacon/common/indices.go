@@ -8,6 +8,10 @@ import (
 
 type CommitteeIndices []ValidatorIndex
 
+func (li CommitteeIndices) MarshalJSON() ([]byte, error) {
+	return MarshalJSONList(len(li), []ValidatorIndex(li))
+}
+
 func (p *CommitteeIndices) Deserialize(spec *Spec, dr *codec.DecodingReader) error {
 	return dr.List(func() codec.Deserializable {
 		i := len(*p)
@@ -0,0 +1,13 @@
+package common
+
+import "encoding/json"
+
+// MarshalJSONList encodes the elements of a list of the given length. Like in the beacon API,
+// an empty list is encoded as [], also when it is nil, rather than null.
+// The elements must be passed as plain slice, to not recurse into the MarshalJSON of the list type.
+func MarshalJSONList(length int, elems interface{}) ([]byte, error) {
+	if length == 0 {
+		return []byte("[]"), nil
+	}
+	return json.Marshal(elems)
+}
@@ -11,6 +11,7 @@ import (
 	"github.com/protolambda/ztyp/view"
 )
 
+// BYTES_PER_LOGS_BLOOM is fixed by the execution-layer, presets must match it (see Spec.Validate).
 const BYTES_PER_LOGS_BLOOM = 256
 
 type LogsBloomView struct {
@@ -0,0 +1,58 @@
+package common
+
+import (
+	"time"
+
+	"github.com/protolambda/zrnt/eth2/metrics"
+)
+
+// StartStages starts the timing of the stages of a block or epoch transition, if the transition has a metrics sink.
+// Every stage is timed from the end of the previous stage, the first stage from this start.
+func (tr *Transition) StartStages() {
+	if tr != nil && tr.Metrics != nil {
+		tr.stageStart = time.Now()
+	}
+}
+
+func (tr *Transition) observeStage(name string, stage string) {
+	now := time.Now()
+	if !tr.stageStart.IsZero() {
+		tr.Metrics.Observe(name, now.Sub(tr.stageStart).Seconds(), metrics.Label{Name: metrics.LabelStage, Value: stage})
+	}
+	tr.stageStart = now
+}
+
+// CountSignatures counts n verified signatures of the kind, if the transition has a metrics sink.
+func (tr *Transition) CountSignatures(kind string, n int) {
+	if tr != nil && tr.Metrics != nil {
+		tr.Metrics.Add(metrics.SignatureVerifications, float64(n), metrics.Label{Name: metrics.LabelKind, Value: kind})
+	}
+}
+
+// ReportCacheMetrics sets the hits and misses of the caches of the context to the sink, if not nil.
+func (epc *EpochsContext) ReportCacheMetrics(sink metrics.Sink) {
+	if sink == nil {
+		return
+	}
+	report := func(cache string, hits uint64, misses uint64) {
+		label := metrics.Label{Name: metrics.LabelCache, Value: cache}
+		sink.Set(metrics.CacheHits, float64(hits), label)
+		sink.Set(metrics.CacheMisses, float64(misses), label)
+	}
+	if epc.ShufflingCache != nil {
+		hits, misses := epc.ShufflingCache.Stats()
+		report("shuffling", hits, misses)
+	}
+	if epc.ProposerCache != nil {
+		hits, misses := epc.ProposerCache.Stats()
+		report("proposer", hits, misses)
+	}
+	if epc.IndexedAttestationCache != nil {
+		hits, misses := epc.IndexedAttestationCache.Stats()
+		report("indexed_attestation", hits, misses)
+	}
+	if epc.CommitteeCache != nil {
+		hits, misses := epc.CommitteeCache.Stats()
+		report("committee", hits, misses)
+	}
+}
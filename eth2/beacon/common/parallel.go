@@ -0,0 +1,76 @@
+package common
+
+import (
+	"context"
+	"runtime"
+	"sync"
+	"sync/atomic"
+)
+
+// ParallelRange runs fn for each index in [0, count) with a pool of workers.
+// If parallelism <= 0, a worker per CPU is used. Indices are processed in increasing order by the workers,
+// and no new work is started after the first error.
+// If fn fails for multiple indices, the error of the lowest index is returned.
+func ParallelRange(ctx context.Context, count int, parallelism int, fn func(i int) error) error {
+	if parallelism <= 0 {
+		parallelism = runtime.GOMAXPROCS(0)
+	}
+	if parallelism > count {
+		parallelism = count
+	}
+	var next int64 = -1
+	var failed int32
+	var mu sync.Mutex
+	errIndex := count
+	var firstErr error
+	var wg sync.WaitGroup
+	wg.Add(parallelism)
+	for w := 0; w < parallelism; w++ {
+		go func() {
+			defer wg.Done()
+			for atomic.LoadInt32(&failed) == 0 && ctx.Err() == nil {
+				i := int(atomic.AddInt64(&next, 1))
+				if i >= count {
+					return
+				}
+				if err := fn(i); err != nil {
+					mu.Lock()
+					if i < errIndex {
+						errIndex, firstErr = i, err
+					}
+					mu.Unlock()
+					atomic.StoreInt32(&failed, 1)
+					return
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	if firstErr != nil {
+		return firstErr
+	}
+	return ctx.Err()
+}
+
+// parallelChunksPerWorker splits the work in more chunks than workers, to balance uneven chunks.
+const parallelChunksPerWorker = 4
+
+// ParallelChunks runs fn for consecutive index ranges that cover [0, count), with a pool of workers.
+// Unlike ParallelRange, the work is done serially, with a single call for the whole range, if parallelism <= 1.
+// Every index is in exactly one range, fn must only write to data of the indices of its own range,
+// or synchronize otherwise. The error of the lowest failing range is returned.
+func ParallelChunks(ctx context.Context, count int, parallelism int, fn func(start int, end int) error) error {
+	if parallelism <= 1 || count <= 1 {
+		return fn(0, count)
+	}
+	chunkSize := (count + parallelism*parallelChunksPerWorker - 1) / (parallelism * parallelChunksPerWorker)
+	chunks := (count + chunkSize - 1) / chunkSize
+	return ParallelRange(ctx, chunks, parallelism, func(i int) error {
+		start := i * chunkSize
+		end := start + chunkSize
+		if end > count {
+			end = count
+		}
+		return fn(start, end)
+	})
+}
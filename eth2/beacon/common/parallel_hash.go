@@ -0,0 +1,228 @@
+package common
+
+import (
+	"runtime"
+	"sync"
+	"sync/atomic"
+	"unsafe"
+
+	"github.com/protolambda/ztyp/tree"
+)
+
+// ParallelHashThreshold is the minimum number of elements of a list or vector
+// for its hash-tree-root to be computed in parallel. Smaller collections are hashed serially.
+const ParallelHashThreshold = 1 << 12
+
+// maxParallelSplitDepth limits how deep the tree is searched for subtrees to hash in parallel.
+const maxParallelSplitDepth = 64
+
+// ParallelHasher is implemented by views that can compute their hash-tree-root in parallel, see ParallelMerkleRoot.
+type ParallelHasher interface {
+	ParallelHashTreeRoot() Root
+}
+
+// HashValidatorsParallel hashes the validator registry of the state with a worker per CPU, if the registry supports it,
+// so the state root re-uses the cached registry root. This is opt-in, for bulk changes of the registry like genesis,
+// see TransitionOptions.ParallelHashing: the registry must not be hashed by anything else at the same time,
+// including copies of the state that share nodes with it.
+func HashValidatorsParallel(state BeaconState) error {
+	vals, err := state.Validators()
+	if err != nil {
+		return err
+	}
+	if ph, ok := vals.(ParallelHasher); ok {
+		ph.ParallelHashTreeRoot()
+	}
+	return nil
+}
+
+// ParallelMerkleRoot computes the merkle root of the tree, hashing independent subtrees with a pool of workers.
+// If workers <= 0, GOMAXPROCS workers are used.
+//
+// The tree is split at the first depth that has enough subtrees without cached root for all workers,
+// the subtrees are hashed in parallel, and the remaining top of the tree is then hashed serially, re-using the subtree roots.
+// Subtrees with a cached root are skipped entirely, so re-hashing after a few changes stays cheap.
+//
+// Subtrees may share nodes, like elements that were set to the same value. Hashing caches the root in the node,
+// so every node without cached root is hashed by a single worker: the nodes that are reachable from the subtrees
+// of multiple workers are found first, and hashed serially before the workers start.
+// Hashing caches roots in the tree nodes: the tree must not be hashed concurrently elsewhere.
+func ParallelMerkleRoot(node tree.Node, workers int) Root {
+	if workers <= 0 {
+		workers = runtime.GOMAXPROCS(0)
+	}
+	if workers <= 1 {
+		return node.MerkleRoot(tree.GetHashFn())
+	}
+	target := workers * 4
+	level := []tree.Node{node}
+	for depth := 0; depth < maxParallelSplitDepth && len(level) < target; depth++ {
+		var next []tree.Node
+		seen := make(map[tree.Node]struct{})
+		for _, n := range level {
+			if n.IsLeaf() {
+				continue
+			}
+			// skip subtrees that were already hashed
+			if p, ok := n.(*tree.PairNode); ok && p.Value != (Root{}) {
+				continue
+			}
+			left, err := n.Left()
+			if err != nil {
+				continue
+			}
+			right, err := n.Right()
+			if err != nil {
+				continue
+			}
+			for _, c := range []tree.Node{left, right} {
+				if _, ok := seen[c]; !ok {
+					seen[c] = struct{}{}
+					next = append(next, c)
+				}
+			}
+		}
+		if len(next) == 0 {
+			// small tree, nothing left to split
+			break
+		}
+		level = next
+	}
+	if len(level) < 2 {
+		return node.MerkleRoot(tree.GetHashFn())
+	}
+	if workers > len(level) {
+		workers = len(level)
+	}
+	// every worker walks the same subtrees it hashes after, to claim the nodes without cached root
+	owners := new(nodeOwners)
+	eachSubtree(level, workers, func(worker int, n tree.Node, _ tree.HashFn) {
+		owners.walk(n, worker)
+	})
+	hFn := tree.GetHashFn()
+	for _, n := range owners.shared {
+		n.MerkleRoot(hFn)
+	}
+	eachSubtree(level, workers, func(_ int, n tree.Node, hFn tree.HashFn) {
+		n.MerkleRoot(hFn)
+	})
+	return node.MerkleRoot(hFn)
+}
+
+// eachSubtree runs fn for every subtree with a pool of workers. Worker w gets the subtrees w, w+workers, w+2*workers, etc.,
+// the same subtrees on every call. Hash functions are not safe for concurrent use, each worker has its own.
+func eachSubtree(subtrees []tree.Node, workers int, fn func(worker int, n tree.Node, hFn tree.HashFn)) {
+	var wg sync.WaitGroup
+	wg.Add(workers)
+	for w := 0; w < workers; w++ {
+		go func(w int) {
+			defer wg.Done()
+			hFn := tree.GetHashFn()
+			for i := w; i < len(subtrees); i += workers {
+				fn(w, subtrees[i], hFn)
+			}
+		}(w)
+	}
+	wg.Wait()
+}
+
+const nodeOwnerShards = 256
+
+// sharedOwner marks a node that is reachable from the subtrees of multiple workers
+const sharedOwner = -1
+
+// nodeOwners tracks which worker reaches each node without cached root.
+type nodeOwners struct {
+	shards [nodeOwnerShards]struct {
+		sync.Mutex
+		// keyed by node address, the nodes are kept alive by the tree
+		owners map[uintptr]int
+	}
+	mu sync.Mutex
+	// the nodes that have to be hashed before the workers start
+	shared []tree.Node
+}
+
+func (o *nodeOwners) addShared(n tree.Node) {
+	o.mu.Lock()
+	o.shared = append(o.shared, n)
+	o.mu.Unlock()
+}
+
+// claim returns true if the node was not reached before. A node that was reached by another worker is marked as shared.
+func (o *nodeOwners) claim(p *tree.PairNode, worker int) bool {
+	key := uintptr(unsafe.Pointer(p))
+	shard := &o.shards[(key>>6)%nodeOwnerShards]
+	shard.Lock()
+	if shard.owners == nil {
+		shard.owners = make(map[uintptr]int)
+	}
+	owner, ok := shard.owners[key]
+	if !ok {
+		shard.owners[key] = worker
+	} else if owner != worker && owner != sharedOwner {
+		shard.owners[key] = sharedOwner
+		o.addShared(p)
+	}
+	shard.Unlock()
+	return !ok
+}
+
+// walk claims the nodes without cached root of the subtree for the worker.
+// The tree is only read: no roots are computed until all workers are done walking.
+func (o *nodeOwners) walk(n tree.Node, worker int) {
+	if n.IsLeaf() {
+		return
+	}
+	p, ok := n.(*tree.PairNode)
+	if !ok {
+		// unknown node type, it may cache its root in any way: hash it before the workers start
+		o.addShared(n)
+		return
+	}
+	if p.Value != (Root{}) {
+		return
+	}
+	if !o.claim(p, worker) {
+		// the rest of the subtree was already claimed, or is hashed with the shared node
+		return
+	}
+	o.walk(p.LeftChild, worker)
+	o.walk(p.RightChild, worker)
+}
+
+// ParallelHashEach runs fn for each index in [0, count) with a pool of workers, like ParallelRange.
+// Hash functions are not safe for concurrent use: every worker passes its own hash function to fn.
+// If parallelism <= 0, a worker per CPU is used.
+func ParallelHashEach(count int, parallelism int, fn func(i int, hFn tree.HashFn)) {
+	if parallelism <= 0 {
+		parallelism = runtime.GOMAXPROCS(0)
+	}
+	if parallelism > count {
+		parallelism = count
+	}
+	if parallelism <= 1 {
+		hFn := tree.GetHashFn()
+		for i := 0; i < count; i++ {
+			fn(i, hFn)
+		}
+		return
+	}
+	var next int64 = -1
+	var wg sync.WaitGroup
+	wg.Add(parallelism)
+	for w := 0; w < parallelism; w++ {
+		go func() {
+			defer wg.Done()
+			hFn := tree.GetHashFn()
+			for {
+				i := int(atomic.AddInt64(&next, 1))
+				if i >= count {
+					return
+				}
+				fn(i, hFn)
+			}
+		}()
+	}
+	wg.Wait()
+}
@@ -0,0 +1,212 @@
+package common
+
+import "sync"
+
+type epochTally struct {
+	epoch Epoch
+	// valid is false if the tally does not cover all participation of the epoch
+	valid bool
+	stake Gwei
+	// bitset of the validators that are counted in the stake
+	counted []uint64
+	// shared is true when the counted bitset may be referenced by the tallies of a copy of the state,
+	// the bitset is copied before it is changed.
+	shared bool
+}
+
+func (t *epochTally) has(index ValidatorIndex) bool {
+	i := uint64(index) >> 6
+	return i < uint64(len(t.counted)) && t.counted[i]&(1<<(uint64(index)&63)) != 0
+}
+
+func (t *epochTally) own(minLen uint64) {
+	if !t.shared && uint64(len(t.counted)) >= minLen {
+		return
+	}
+	size := uint64(len(t.counted))
+	if size < minLen {
+		size = minLen
+	}
+	counted := make([]uint64, size, size)
+	copy(counted, t.counted)
+	t.counted = counted
+	t.shared = false
+}
+
+func (t *epochTally) set(index ValidatorIndex) {
+	t.own((uint64(index) >> 6) + 1)
+	t.counted[uint64(index)>>6] |= 1 << (uint64(index) & 63)
+}
+
+func (t *epochTally) unset(index ValidatorIndex) {
+	t.own(0)
+	t.counted[uint64(index)>>6] &^= 1 << (uint64(index) & 63)
+}
+
+// ParticipationTallies keeps the unslashed target-attesting stake of the previous and current epoch of a state
+// up to date during block processing, so the justification of the epoch transition does not have to sum up the participation.
+// Attesters are added by the attestation processors, and removed again when slashed.
+//
+// The tallies belong to a single state, see ParticipationTalliesState: a copy of the state gets a copy of the tallies.
+// They only follow the changes of the state transition functions, a state that is changed otherwise must Invalidate them.
+//
+// A tally is only complete if it covers all participation of its epoch:
+// tallies start out incomplete, and become complete as the epochs rotate.
+// All methods can be called on nil tallies, which are never complete.
+type ParticipationTallies struct {
+	mu   sync.Mutex
+	prev epochTally
+	curr epochTally
+}
+
+func NewParticipationTallies() *ParticipationTallies {
+	return new(ParticipationTallies)
+}
+
+// ParticipationTalliesState is a state that keeps participation tallies.
+type ParticipationTalliesState interface {
+	ParticipationTallies() *ParticipationTallies
+}
+
+// StateParticipationTallies returns the participation tallies of the state, or nil if the state does not keep any.
+func StateParticipationTallies(state BeaconState) *ParticipationTallies {
+	if ts, ok := state.(ParticipationTalliesState); ok {
+		return ts.ParticipationTallies()
+	}
+	return nil
+}
+
+// Reset starts tracking from a state without any participation yet, e.g. the genesis state.
+func (pt *ParticipationTallies) Reset(currentEpoch Epoch) {
+	if pt == nil {
+		return
+	}
+	pt.mu.Lock()
+	defer pt.mu.Unlock()
+	pt.prev = epochTally{epoch: currentEpoch.Previous(), valid: true}
+	pt.curr = epochTally{epoch: currentEpoch, valid: true}
+}
+
+// AddTargetAttester counts the effective balance of the validator towards the target stake of the given epoch,
+// unless the validator is slashed. Validators are counted at most once per epoch.
+// The validator is only read from the registry if the tally of the epoch is complete.
+func (pt *ParticipationTallies) AddTargetAttester(vals ValidatorRegistry, epoch Epoch, index ValidatorIndex) error {
+	if pt == nil {
+		return nil
+	}
+	pt.mu.Lock()
+	defer pt.mu.Unlock()
+	var t *epochTally
+	if pt.curr.valid && pt.curr.epoch == epoch {
+		t = &pt.curr
+	} else if pt.prev.valid && pt.prev.epoch == epoch {
+		t = &pt.prev
+	} else {
+		return nil
+	}
+	if t.has(index) {
+		return nil
+	}
+	v, err := vals.Validator(index)
+	if err != nil {
+		return err
+	}
+	if slashed, err := v.Slashed(); err != nil {
+		return err
+	} else if slashed {
+		return nil
+	}
+	effBalance, err := v.EffectiveBalance()
+	if err != nil {
+		return err
+	}
+	t.set(index)
+	t.stake += effBalance
+	return nil
+}
+
+// RemoveAttester un-counts the given validator, e.g. when it is slashed.
+func (pt *ParticipationTallies) RemoveAttester(index ValidatorIndex, effBalance Gwei) {
+	if pt == nil {
+		return
+	}
+	pt.mu.Lock()
+	defer pt.mu.Unlock()
+	for _, t := range []*epochTally{&pt.prev, &pt.curr} {
+		if t.valid && t.has(index) {
+			t.unset(index)
+			t.stake -= effBalance
+		}
+	}
+}
+
+// Rotate moves the current tally to the previous epoch, and starts an empty tally for the new current epoch.
+// The previous tally is summed up again with the effective balances of the new epoch, taken from the flat validators.
+func (pt *ParticipationTallies) Rotate(currentEpoch Epoch, flats []FlatValidator) {
+	if pt == nil {
+		return
+	}
+	pt.mu.Lock()
+	defer pt.mu.Unlock()
+	pt.prev = pt.curr
+	if pt.prev.epoch+1 != currentEpoch {
+		pt.prev.valid = false
+	}
+	if pt.prev.valid {
+		stake := Gwei(0)
+	sum:
+		for i, bits := range pt.prev.counted {
+			for j := uint64(0); bits != 0; j++ {
+				if bits&1 != 0 {
+					index := uint64(i)<<6 | j
+					if index >= uint64(len(flats)) {
+						pt.prev.valid = false
+						break sum
+					}
+					stake += flats[index].EffectiveBalance
+				}
+				bits >>= 1
+			}
+		}
+		pt.prev.stake = stake
+	}
+	pt.curr = epochTally{epoch: currentEpoch, valid: true}
+}
+
+// Invalidate drops the tallies, e.g. when the participation of the state is changed without the state transition.
+func (pt *ParticipationTallies) Invalidate() {
+	if pt == nil {
+		return
+	}
+	pt.mu.Lock()
+	defer pt.mu.Unlock()
+	pt.prev = epochTally{}
+	pt.curr = epochTally{}
+}
+
+// TargetStakes returns the unslashed target-attesting stake of the given previous and current epoch,
+// if the tallies of both epochs are complete.
+func (pt *ParticipationTallies) TargetStakes(prevEpoch Epoch, currEpoch Epoch) (prev Gwei, curr Gwei, ok bool) {
+	if pt == nil {
+		return 0, 0, false
+	}
+	pt.mu.Lock()
+	defer pt.mu.Unlock()
+	if !pt.prev.valid || !pt.curr.valid || pt.prev.epoch != prevEpoch || pt.curr.epoch != currEpoch {
+		return 0, 0, false
+	}
+	return pt.prev.stake, pt.curr.stake, true
+}
+
+// Clone returns a copy of the tallies, for a copy of the state.
+// The counted validators are shared until either copy changes.
+func (pt *ParticipationTallies) Clone() *ParticipationTallies {
+	if pt == nil {
+		return nil
+	}
+	pt.mu.Lock()
+	defer pt.mu.Unlock()
+	pt.prev.shared = true
+	pt.curr.shared = true
+	return &ParticipationTallies{prev: pt.prev, curr: pt.curr}
+}
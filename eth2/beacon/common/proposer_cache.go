@@ -0,0 +1,98 @@
+package common
+
+import (
+	"sync"
+)
+
+// ProposerKey identifies the proposers of an epoch. Besides the seed, the proposers depend on the active validators
+// and their effective balances: the root of the validator registry covers both.
+// Changes to the registry that do not affect the proposers, like a slashing, still result in a different key.
+type ProposerKey struct {
+	Epoch        Epoch
+	Seed         Root
+	RegistryRoot Root
+}
+
+// proposerSequence holds the proposers of an epoch, computed lazily and shared by all contexts with the same ProposerKey.
+type proposerSequence struct {
+	mu sync.Mutex
+	// SLOTS_PER_EPOCH proposer indices, valid where computed is true.
+	proposers []ValidatorIndex
+	computed  []bool
+}
+
+func newProposerSequence(slots uint64) *proposerSequence {
+	return &proposerSequence{
+		proposers: make([]ValidatorIndex, slots, slots),
+		computed:  make([]bool, slots, slots),
+	}
+}
+
+// ProposerCache is a bounded cache of the proposers of an epoch, shared between EpochsContexts,
+// to not recompute the same proposers for sibling branches. The proposers are shared as they are computed:
+// a proposer looked up by one context is not computed again by another context with the same key.
+// The least recently used proposers are evicted when the cache is full.
+type ProposerCache struct {
+	sync.Mutex
+	maxEntries int
+	entries    map[ProposerKey]*proposerSequence
+	// keys, least recently used first
+	order []ProposerKey
+
+	hits   uint64
+	misses uint64
+}
+
+func NewProposerCache(maxEntries int) *ProposerCache {
+	if maxEntries < 1 {
+		maxEntries = 1
+	}
+	return &ProposerCache{
+		maxEntries: maxEntries,
+		entries:    make(map[ProposerKey]*proposerSequence, maxEntries),
+	}
+}
+
+func (pc *ProposerCache) touch(key ProposerKey) {
+	for i, k := range pc.order {
+		if k == key {
+			pc.order = append(pc.order[:i], pc.order[i+1:]...)
+			break
+		}
+	}
+	pc.order = append(pc.order, key)
+}
+
+// getOrAdd returns the cached proposers, or caches new proposers to be computed, and counts the hit or miss.
+func (pc *ProposerCache) getOrAdd(key ProposerKey, slots uint64) *proposerSequence {
+	pc.Lock()
+	defer pc.Unlock()
+	if seq, ok := pc.entries[key]; ok {
+		pc.hits++
+		pc.touch(key)
+		return seq
+	}
+	pc.misses++
+	if len(pc.entries) >= pc.maxEntries {
+		delete(pc.entries, pc.order[0])
+		pc.order = pc.order[1:]
+	}
+	seq := newProposerSequence(slots)
+	pc.entries[key] = seq
+	pc.touch(key)
+	return seq
+}
+
+// Len returns the number of cached proposer sequences.
+func (pc *ProposerCache) Len() int {
+	pc.Lock()
+	defer pc.Unlock()
+	return len(pc.entries)
+}
+
+// Stats returns the number of cache hits and misses so far.
+func (pc *ProposerCache) Stats() (hits uint64, misses uint64) {
+	pc.Lock()
+	defer pc.Unlock()
+	return pc.hits, pc.misses
+}
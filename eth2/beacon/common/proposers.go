@@ -6,15 +6,25 @@ import (
 	"fmt"
 
 	"github.com/protolambda/zrnt/eth2/util/hashing"
+	"github.com/protolambda/ztyp/tree"
 )
 
+// ProposersEpoch computes the beacon proposers of an epoch lazily:
+// the proposer of a slot is computed on first lookup and then memoized. Safe for concurrent use.
 type ProposersEpoch struct {
 	Spec  *Spec
 	Epoch Epoch
-	// Proposers is a slice of SLOTS_PER_EPOCH proposer indices for the epoch
-	Proposers []ValidatorIndex
 
 	CommitteesPerSlot uint64
+
+	// Inputs for the proposer computation. The registry is a snapshot, later changes to the state are not seen:
+	// the effective balances do not change during the epoch.
+	seed     Root
+	registry ValidatorRegistry
+	active   []ValidatorIndex
+
+	// The proposers computed so far, may be shared with other contexts through a ProposerCache.
+	seq *proposerSequence
 }
 
 func (epc *ProposersEpoch) GetBeaconProposer(slot Slot) (ValidatorIndex, error) {
@@ -22,45 +32,80 @@ func (epc *ProposersEpoch) GetBeaconProposer(slot Slot) (ValidatorIndex, error)
 	if epoch != epc.Epoch {
 		return 0, fmt.Errorf("expected epoch %d for beacon proposer lookup, but lookup was at slot %d (epoch %d)", epc.Epoch, slot, epoch)
 	}
-	return epc.Proposers[slot%epc.Spec.SLOTS_PER_EPOCH], nil
+	epc.seq.mu.Lock()
+	defer epc.seq.mu.Unlock()
+	return epc.getBeaconProposer(slot)
+}
+
+func (epc *ProposersEpoch) getBeaconProposer(slot Slot) (ValidatorIndex, error) {
+	i := slot % epc.Spec.SLOTS_PER_EPOCH
+	if epc.seq.computed[i] {
+		return epc.seq.proposers[i], nil
+	}
+	var buf [32 + 8]byte
+	copy(buf[0:32], epc.seed[:])
+	binary.LittleEndian.PutUint64(buf[32:], uint64(slot))
+	seed := hashing.GetHashFn()(buf[:])
+	proposer, err := ComputeProposerIndex(epc.Spec, epc.registry, epc.active, seed)
+	if err != nil {
+		return 0, err
+	}
+	epc.seq.proposers[i] = proposer
+	epc.seq.computed[i] = true
+	return proposer, nil
+}
+
+// ComputeAllProposers returns the proposers of every slot of the epoch, computing the ones that were not looked up yet.
+// The returned slice is a copy.
+func (epc *ProposersEpoch) ComputeAllProposers() ([]ValidatorIndex, error) {
+	startSlot, err := epc.Spec.EpochStartSlot(epc.Epoch)
+	if err != nil {
+		return nil, err
+	}
+	epc.seq.mu.Lock()
+	defer epc.seq.mu.Unlock()
+	for i := Slot(0); i < epc.Spec.SLOTS_PER_EPOCH; i++ {
+		if _, err := epc.getBeaconProposer(startSlot + i); err != nil {
+			return nil, err
+		}
+	}
+	return append([]ValidatorIndex(nil), epc.seq.proposers...), nil
 }
 
+// ComputeProposers prepares the proposer computation of the given epoch. The proposers themselves are computed lazily,
+// see ProposersEpoch.GetBeaconProposer and ProposersEpoch.ComputeAllProposers.
 func ComputeProposers(spec *Spec, state BeaconState, epoch Epoch, active []ValidatorIndex) (*ProposersEpoch, error) {
+	return ComputeProposersWithCache(spec, state, epoch, active, nil)
+}
+
+// ComputeProposersWithCache is like ComputeProposers, but shares the computed proposers
+// with other contexts through the given cache. The cache may be nil.
+func ComputeProposersWithCache(spec *Spec, state BeaconState, epoch Epoch, active []ValidatorIndex, cache *ProposerCache) (*ProposersEpoch, error) {
 	if len(active) == 0 {
 		return nil, errors.New("no active validators available to compute proposers")
 	}
-	proposers := make([]ValidatorIndex, spec.SLOTS_PER_EPOCH, spec.SLOTS_PER_EPOCH)
 	mixes, err := state.RandaoMixes()
 	if err != nil {
 		return nil, err
 	}
-	startSlot, err := spec.EpochStartSlot(epoch)
-	if err != nil {
+	if _, err := spec.EpochStartSlot(epoch); err != nil {
 		return nil, err
 	}
 	vals, err := state.Validators()
 	if err != nil {
 		return nil, err
 	}
+	epochSeed, err := GetSeed(spec, mixes, epoch, DOMAIN_BEACON_PROPOSER)
+	if err != nil {
+		return nil, err
+	}
 
-	hFn := hashing.GetHashFn()
-	// compute beacon proposers
-	{
-		epochSeed, err := GetSeed(spec, mixes, epoch, DOMAIN_BEACON_PROPOSER)
-		if err != nil {
-			return nil, err
-		}
-		var buf [32 + 8]byte
-		copy(buf[0:32], epochSeed[:])
-		for i := Slot(0); i < spec.SLOTS_PER_EPOCH; i++ {
-			binary.LittleEndian.PutUint64(buf[32:], uint64(startSlot+i))
-			seed := hFn(buf[:])
-			proposer, err := ComputeProposerIndex(spec, vals, active, seed)
-			if err != nil {
-				return nil, err
-			}
-			proposers[i] = proposer
-		}
+	var seq *proposerSequence
+	if cache != nil {
+		key := ProposerKey{Epoch: epoch, Seed: epochSeed, RegistryRoot: vals.HashTreeRoot(tree.GetHashFn())}
+		seq = cache.getOrAdd(key, uint64(spec.SLOTS_PER_EPOCH))
+	} else {
+		seq = newProposerSequence(uint64(spec.SLOTS_PER_EPOCH))
 	}
 
 	validatorsPerSlot := uint64(len(active)) / uint64(spec.SLOTS_PER_EPOCH)
@@ -69,8 +114,11 @@ func ComputeProposers(spec *Spec, state BeaconState, epoch Epoch, active []Valid
 	return &ProposersEpoch{
 		Spec:              spec,
 		Epoch:             epoch,
-		Proposers:         proposers,
 		CommitteesPerSlot: committeesPerSlot,
+		seed:              epochSeed,
+		registry:          vals,
+		active:            active,
+		seq:               seq,
 	}, nil
 }
 
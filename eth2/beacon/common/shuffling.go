@@ -1,5 +1,7 @@
 package common
 
+import "sync/atomic"
+
 type BoundedIndex struct {
 	Index      ValidatorIndex
 	Activation Epoch
@@ -7,28 +9,27 @@ type BoundedIndex struct {
 }
 
 func LoadBoundedIndices(validators ValidatorRegistry) ([]BoundedIndex, error) {
-	valCount, err := validators.ValidatorCount()
-	if err != nil {
-		return nil, err
-	}
-	indicesBounded := make([]BoundedIndex, valCount, valCount)
+	return (*EpochProcessScratch)(nil).LoadBoundedIndices(validators)
+}
+
+func loadBoundedIndicesInto(validators ValidatorRegistry, indicesBounded []BoundedIndex) error {
 	valIterNext := validators.Iter()
 	i := ValidatorIndex(0)
 	for {
 		val, ok, err := valIterNext()
 		if err != nil {
-			return nil, err
+			return err
 		}
 		if !ok {
 			break
 		}
 		actiEp, err := val.ActivationEpoch()
 		if err != nil {
-			return nil, err
+			return err
 		}
 		exitEp, err := val.ExitEpoch()
 		if err != nil {
-			return nil, err
+			return err
 		}
 		indicesBounded[i] = BoundedIndex{
 			Index:      i,
@@ -37,7 +38,7 @@ func LoadBoundedIndices(validators ValidatorRegistry) ([]BoundedIndex, error) {
 		}
 		i++
 	}
-	return indicesBounded, nil
+	return nil
 }
 
 func CommitteeCount(spec *Spec, activeValidators uint64) uint64 {
@@ -54,12 +55,26 @@ func CommitteeCount(spec *Spec, activeValidators uint64) uint64 {
 
 // With a high amount of shards, or low amount of validators,
 // some shards may not have a committee this epoch.
+//
+// A shuffling is never modified after it is computed: it is shared between contexts, their clones
+// and the shuffling cache, and committees taken from it can be kept for as long as needed.
 type ShufflingEpoch struct {
 	Epoch         Epoch
 	ActiveIndices []ValidatorIndex
 	Shuffling     []ValidatorIndex // the active validator indices, shuffled into their committee
 	// slot (vector SLOTS_PER_EPOCH) -> index of committee (< MAX_COMMITTEES_PER_SLOT) -> index of validator within committee -> validator
 	Committees [][][]ValidatorIndex // slices of Shuffling, 1 per slot. Committee can be nil slice.
+
+	id uint64
+}
+
+// last assigned shuffling ID
+var shufflingIDs uint64
+
+// ID uniquely identifies the computed shuffling within the process.
+// Contexts that share the shuffling, e.g. through a ShufflingCache, see the same ID.
+func (shep *ShufflingEpoch) ID() uint64 {
+	return shep.id
 }
 
 func ComputeShufflingEpoch(spec *Spec, state BeaconState, indicesBounded []BoundedIndex, epoch Epoch) (*ShufflingEpoch, error) {
@@ -85,12 +100,16 @@ func ActiveIndices(indicesBounded []BoundedIndex, epoch Epoch) []ValidatorIndex
 }
 
 func NewShufflingEpoch(spec *Spec, indicesBounded []BoundedIndex, seed Root, epoch Epoch) *ShufflingEpoch {
+	return newShufflingEpoch(spec, ActiveIndices(indicesBounded, epoch), seed, epoch)
+}
+
+func newShufflingEpoch(spec *Spec, activeIndices []ValidatorIndex, seed Root, epoch Epoch) *ShufflingEpoch {
 	shep := &ShufflingEpoch{
-		Epoch: epoch,
+		Epoch:         epoch,
+		ActiveIndices: activeIndices,
+		id:            atomic.AddUint64(&shufflingIDs, 1),
 	}
 
-	shep.ActiveIndices = ActiveIndices(indicesBounded, epoch)
-
 	// Copy over the active indices, then get the shuffling of them
 	shep.Shuffling = make([]ValidatorIndex, len(shep.ActiveIndices), len(shep.ActiveIndices))
 	for i, v := range shep.ActiveIndices {
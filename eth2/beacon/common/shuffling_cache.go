@@ -0,0 +1,135 @@
+package common
+
+import (
+	"encoding/binary"
+	"sync"
+
+	"github.com/minio/sha256-simd"
+)
+
+// ShufflingKey identifies a shuffling: the same seed and active validator set always result in the same committees,
+// for the same preset. Specs of different presets can share a cache.
+type ShufflingKey struct {
+	// Name of the preset of the spec, and the preset values that the committees depend on,
+	// in case a spec changes them but keeps the preset name.
+	Preset               string
+	ShuffleRoundCount    uint8
+	SlotsPerEpoch        Slot
+	MaxCommitteesPerSlot uint64
+	TargetCommitteeSize  uint64
+	Epoch                Epoch
+	Seed                 Root
+	// Number of active validators
+	ActiveCount uint64
+	// SHA-256 digest of the active validator indices
+	ActiveDigest Root
+}
+
+func NewShufflingKey(spec *Spec, epoch Epoch, seed Root, activeIndices []ValidatorIndex) ShufflingKey {
+	h := sha256.New()
+	var buf [8]byte
+	for _, i := range activeIndices {
+		binary.LittleEndian.PutUint64(buf[:], uint64(i))
+		h.Write(buf[:])
+	}
+	key := ShufflingKey{
+		Preset:               spec.PresetName,
+		ShuffleRoundCount:    uint8(spec.SHUFFLE_ROUND_COUNT),
+		SlotsPerEpoch:        spec.SLOTS_PER_EPOCH,
+		MaxCommitteesPerSlot: uint64(spec.MAX_COMMITTEES_PER_SLOT),
+		TargetCommitteeSize:  uint64(spec.TARGET_COMMITTEE_SIZE),
+		Epoch:                epoch,
+		Seed:                 seed,
+		ActiveCount:          uint64(len(activeIndices)),
+	}
+	copy(key.ActiveDigest[:], h.Sum(nil))
+	return key
+}
+
+// ShufflingCache is a bounded cache of computed shufflings, shared between EpochsContexts,
+// to avoid recomputing the same shuffling for sibling branches or after a restart.
+// The cached ShufflingEpoch values are shared as-is, and must not be modified.
+// The least recently used shuffling is evicted when the cache is full.
+type ShufflingCache struct {
+	sync.Mutex
+	maxEntries int
+	entries    map[ShufflingKey]*ShufflingEpoch
+	// keys, least recently used first
+	order []ShufflingKey
+
+	hits   uint64
+	misses uint64
+}
+
+func NewShufflingCache(maxEntries int) *ShufflingCache {
+	if maxEntries < 1 {
+		maxEntries = 1
+	}
+	return &ShufflingCache{
+		maxEntries: maxEntries,
+		entries:    make(map[ShufflingKey]*ShufflingEpoch, maxEntries),
+	}
+}
+
+func (sc *ShufflingCache) touch(key ShufflingKey) {
+	for i, k := range sc.order {
+		if k == key {
+			sc.order = append(sc.order[:i], sc.order[i+1:]...)
+			break
+		}
+	}
+	sc.order = append(sc.order, key)
+}
+
+// Get retrieves a cached shuffling, and counts the hit or miss.
+func (sc *ShufflingCache) Get(key ShufflingKey) (shuf *ShufflingEpoch, ok bool) {
+	sc.Lock()
+	defer sc.Unlock()
+	shuf, ok = sc.entries[key]
+	if ok {
+		sc.hits++
+		sc.touch(key)
+	} else {
+		sc.misses++
+	}
+	return
+}
+
+// Add caches the shuffling, evicting the least recently used shuffling if the cache is full.
+func (sc *ShufflingCache) Add(key ShufflingKey, shuf *ShufflingEpoch) {
+	sc.Lock()
+	defer sc.Unlock()
+	if _, ok := sc.entries[key]; !ok && len(sc.entries) >= sc.maxEntries {
+		delete(sc.entries, sc.order[0])
+		sc.order = sc.order[1:]
+	}
+	sc.entries[key] = shuf
+	sc.touch(key)
+}
+
+// GetOrCompute returns the cached shuffling for the given epoch and seed, or computes and caches it.
+func (sc *ShufflingCache) GetOrCompute(spec *Spec, indicesBounded []BoundedIndex, seed Root, epoch Epoch) *ShufflingEpoch {
+	active := ActiveIndices(indicesBounded, epoch)
+	key := NewShufflingKey(spec, epoch, seed, active)
+	if shuf, ok := sc.Get(key); ok {
+		return shuf
+	}
+	// Computed without holding the lock, concurrent misses may compute the same shuffling twice.
+	shuf := newShufflingEpoch(spec, active, seed, epoch)
+	sc.Add(key, shuf)
+	return shuf
+}
+
+// Len returns the number of cached shufflings.
+func (sc *ShufflingCache) Len() int {
+	sc.Lock()
+	defer sc.Unlock()
+	return len(sc.entries)
+}
+
+// Stats returns the number of cache hits and misses so far.
+func (sc *ShufflingCache) Stats() (hits uint64, misses uint64) {
+	sc.Lock()
+	defer sc.Unlock()
+	return sc.hits, sc.misses
+}
@@ -0,0 +1,94 @@
+package common
+
+import (
+	"errors"
+	"fmt"
+
+	blsu "github.com/protolambda/bls12-381-util"
+
+	"github.com/protolambda/zrnt/eth2/util/bls"
+)
+
+// SignatureBatch collects the signatures of a block transition, to verify them together at the end of the block,
+// with a single multi-pairing instead of a pairing per signature. See StateTransitionWithBatch.
+// A batch is not safe for concurrent use.
+type SignatureBatch struct {
+	verifier *bls.BatchVerifier
+	// what every signature is of, to report the invalid signature
+	descriptions []string
+}
+
+func NewSignatureBatch() *SignatureBatch {
+	return &SignatureBatch{verifier: bls.NewBatchVerifier(128)}
+}
+
+// Add queues the signature. The description tells what the signature is of, to report it if it is invalid.
+func (sb *SignatureBatch) Add(description string, pub *blsu.Pubkey, message []byte, sig *blsu.Signature) {
+	sb.verifier.Add(pub, message, sig)
+	sb.descriptions = append(sb.descriptions, description)
+}
+
+// Len returns the number of queued signatures.
+func (sb *SignatureBatch) Len() int {
+	return sb.verifier.Len()
+}
+
+// Verify checks all queued signatures at once. If the batch is invalid, the signatures are verified one by one,
+// to return an error that describes the first invalid signature.
+func (sb *SignatureBatch) Verify() error {
+	valid, err := sb.verifier.Verify()
+	if err != nil {
+		return err
+	}
+	if valid {
+		return nil
+	}
+	i, ok := sb.verifier.FirstInvalid()
+	if !ok {
+		return errors.New("signature batch is invalid, but every signature is valid on its own")
+	}
+	return fmt.Errorf("invalid signature of %s", sb.descriptions[i])
+}
+
+// Reset drops the queued signatures, to re-use the batch for the next block.
+func (sb *SignatureBatch) Reset() {
+	sb.verifier.Reset()
+	for i := range sb.descriptions {
+		sb.descriptions[i] = ""
+	}
+	sb.descriptions = sb.descriptions[:0]
+}
+
+// VerifySignature checks the signature of the pubkey over the message. If the transition has a signature batch,
+// the signature is added to the batch instead, and true is returned: the batch is verified at the end of the block.
+// During a trusted block transition, the signature is not checked, and true is returned. The transition may be nil.
+func (tr *Transition) VerifySignature(description string, pub *blsu.Pubkey, message []byte, sig *blsu.Signature) bool {
+	if tr == nil {
+		return blsu.Verify(pub, message, sig)
+	}
+	if tr.SkipSignatures {
+		return true
+	}
+	if tr.SignatureBatch != nil {
+		tr.SignatureBatch.Add(description, pub, message, sig)
+		return true
+	}
+	return blsu.Verify(pub, message, sig)
+}
+
+// VerifyAggregateSignature is like VerifySignature, for the aggregate signature of the pubkeys over the same message.
+// An empty set of pubkeys requires the infinity signature, as specified by eth2_fast_aggregate_verify.
+func (tr *Transition) VerifyAggregateSignature(description string, pubkeys []*blsu.Pubkey, message []byte, sig *blsu.Signature) bool {
+	if tr != nil && tr.SkipSignatures {
+		return true
+	}
+	if tr == nil || tr.SignatureBatch == nil || len(pubkeys) == 0 {
+		return blsu.Eth2FastAggregateVerify(pubkeys, message, sig)
+	}
+	pub, err := blsu.AggregatePubkeys(pubkeys)
+	if err != nil {
+		return false
+	}
+	tr.SignatureBatch.Add(description, pub, message, sig)
+	return true
+}
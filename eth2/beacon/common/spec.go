@@ -2,6 +2,7 @@ package common
 
 import (
 	"encoding/json"
+	"fmt"
 
 	kbls "github.com/kilic/bls12-381"
 	"github.com/protolambda/ztyp/codec"
@@ -99,6 +100,7 @@ type AltairPreset struct {
 
 	// Sync committees and light clients
 	MIN_SYNC_COMMITTEE_PARTICIPANTS Uint64View `yaml:"MIN_SYNC_COMMITTEE_PARTICIPANTS" json:"MIN_SYNC_COMMITTEE_PARTICIPANTS"`
+	UPDATE_TIMEOUT                  Slot       `yaml:"UPDATE_TIMEOUT" json:"UPDATE_TIMEOUT"`
 }
 
 type BellatrixPreset struct {
@@ -240,19 +242,38 @@ func (s *specObj) MarshalYAML() (interface{}, error) {
 	return s.des, nil
 }
 
-type Spec struct {
+// Preset holds the compile-time constants of all forks, which size the SSZ types.
+// Presets are shared between networks: a config selects its preset by name, see Config.PRESET_BASE.
+type Preset struct {
+	// Name of the preset, e.g. "mainnet" or "minimal". Not part of the preset files.
+	PresetName string `json:"-" yaml:"-"`
+
 	Phase0Preset    `json:",inline" yaml:",inline"`
 	AltairPreset    `json:",inline" yaml:",inline"`
 	BellatrixPreset `json:",inline" yaml:",inline"`
 	CapellaPreset   `json:",inline" yaml:",inline"`
 	DenebPreset     `json:",inline" yaml:",inline"`
-	Config          `json:",inline" yaml:",inline"`
-	Setup           `json:",inline" yaml:",inline"`
+}
+
+// Spec composes a preset with the runtime config of a network.
+type Spec struct {
+	Preset `json:",inline" yaml:",inline"`
+	Config `json:",inline" yaml:",inline"`
+	Setup  `json:",inline" yaml:",inline"`
 
 	// Experimental, for bellatrix
 	ExecutionEngine `json:"-" yaml:"-"`
 }
 
+// CheckPresetBase checks that the config is meant for the preset of the spec.
+// A spec without preset name or without PRESET_BASE is not checked.
+func (spec *Spec) CheckPresetBase() error {
+	if spec.PresetName != "" && spec.PRESET_BASE != "" && spec.PresetName != spec.PRESET_BASE {
+		return fmt.Errorf("config is meant for preset %q, but preset is %q", spec.PRESET_BASE, spec.PresetName)
+	}
+	return nil
+}
+
 type G1Setup struct {
 	Serialized [][48]byte
 	Points     []kbls.PointG1
@@ -276,14 +297,5 @@ func (spec *Spec) Wrap(des SpecObj) SSZObj {
 }
 
 func (spec *Spec) ForkVersion(slot Slot) Version {
-	epoch := spec.SlotToEpoch(slot)
-	if epoch < spec.ALTAIR_FORK_EPOCH {
-		return spec.GENESIS_FORK_VERSION
-	} else if epoch < spec.BELLATRIX_FORK_EPOCH {
-		return spec.ALTAIR_FORK_VERSION
-	} else if epoch < spec.CAPELLA_FORK_EPOCH {
-		return spec.BELLATRIX_FORK_VERSION
-	} else {
-		return spec.CAPELLA_FORK_VERSION
-	}
+	return spec.ForkSchedule().VersionAtEpoch(spec.SlotToEpoch(slot))
 }
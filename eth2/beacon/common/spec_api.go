@@ -0,0 +1,138 @@
+package common
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// specAPIConstants are the constants that the beacon API exposes with the spec, next to the preset and config values.
+func specAPIConstants() map[string]string {
+	out := map[string]string{
+		"BLS_WITHDRAWAL_PREFIX":                    fmt.Sprintf("0x%02x", BLS_WITHDRAWAL_PREFIX),
+		"ETH1_ADDRESS_WITHDRAWAL_PREFIX":           fmt.Sprintf("0x%02x", ETH1_ADDRESS_WITHDRAWAL_PREFIX),
+		"TARGET_AGGREGATORS_PER_COMMITTEE":         fmt.Sprintf("%d", TARGET_AGGREGATORS_PER_COMMITTEE),
+		"RANDOM_SUBNETS_PER_VALIDATOR":             fmt.Sprintf("%d", RANDOM_SUBNETS_PER_VALIDATOR),
+		"EPOCHS_PER_RANDOM_SUBNET_SUBSCRIPTION":    fmt.Sprintf("%d", EPOCHS_PER_RANDOM_SUBNET_SUBSCRIPTION),
+		"SYNC_COMMITTEE_SUBNET_COUNT":              fmt.Sprintf("%d", SYNC_COMMITTEE_SUBNET_COUNT),
+		"TARGET_AGGREGATORS_PER_SYNC_SUBCOMMITTEE": fmt.Sprintf("%d", TARGET_AGGREGATORS_PER_SYNC_SUBCOMMITTEE),
+	}
+	for k, d := range map[string]BLSDomainType{
+		"DOMAIN_BEACON_PROPOSER":                DOMAIN_BEACON_PROPOSER,
+		"DOMAIN_BEACON_ATTESTER":                DOMAIN_BEACON_ATTESTER,
+		"DOMAIN_RANDAO":                         DOMAIN_RANDAO,
+		"DOMAIN_DEPOSIT":                        DOMAIN_DEPOSIT,
+		"DOMAIN_VOLUNTARY_EXIT":                 DOMAIN_VOLUNTARY_EXIT,
+		"DOMAIN_SELECTION_PROOF":                DOMAIN_SELECTION_PROOF,
+		"DOMAIN_AGGREGATE_AND_PROOF":            DOMAIN_AGGREGATE_AND_PROOF,
+		"DOMAIN_SYNC_COMMITTEE":                 DOMAIN_SYNC_COMMITTEE,
+		"DOMAIN_SYNC_COMMITTEE_SELECTION_PROOF": DOMAIN_SYNC_COMMITTEE_SELECTION_PROOF,
+		"DOMAIN_CONTRIBUTION_AND_PROOF":         DOMAIN_CONTRIBUTION_AND_PROOF,
+		"DOMAIN_BLS_TO_EXECUTION_CHANGE":        DOMAIN_BLS_TO_EXECUTION_CHANGE,
+	} {
+		text, _ := d.MarshalText()
+		out[k] = string(text)
+	}
+	return out
+}
+
+// specAPIFields calls fn with the key and (addressable) value of every preset and config field of the spec.
+func specAPIFields(spec *Spec, fn func(key string, v reflect.Value) error) error {
+	var walk func(v reflect.Value) error
+	walk = func(v reflect.Value) error {
+		typ := v.Type()
+		for i := 0; i < typ.NumField(); i++ {
+			f := typ.Field(i)
+			tag := f.Tag.Get("yaml")
+			name := strings.Split(tag, ",")[0]
+			if strings.Contains(tag, ",inline") && f.Type.Kind() == reflect.Struct {
+				if err := walk(v.Field(i)); err != nil {
+					return err
+				}
+			} else if name != "" && name != "-" {
+				if err := fn(name, v.Field(i)); err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	}
+	if err := walk(reflect.ValueOf(&spec.Preset).Elem()); err != nil {
+		return err
+	}
+	return walk(reflect.ValueOf(&spec.Config).Elem())
+}
+
+// MarshalAPI encodes the spec like the /eth/v1/config/spec response of the beacon API:
+// a flat map of the preset, config and constant values, by their upstream names.
+// Numbers are formatted as decimals, byte values as 0x-prefixed hex.
+func (spec *Spec) MarshalAPI() (map[string]string, error) {
+	out := specAPIConstants()
+	err := specAPIFields(spec, func(key string, v reflect.Value) error {
+		var node yaml.Node
+		if err := node.Encode(v.Interface()); err != nil {
+			return fmt.Errorf("failed to encode %s: %v", key, err)
+		}
+		if node.Kind != yaml.ScalarNode {
+			return fmt.Errorf("spec value %s is not a scalar", key)
+		}
+		out[key] = node.Value
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// MarshalAPIYAML encodes the values of MarshalAPI as a flat YAML mapping,
+// like the data of the /eth/v1/config/spec response.
+// Unlike yaml.Marshal of the spec, the constants are included, and the values are all strings.
+func (spec *Spec) MarshalAPIYAML() ([]byte, error) {
+	values, err := spec.MarshalAPI()
+	if err != nil {
+		return nil, err
+	}
+	return yaml.Marshal(values)
+}
+
+// SpecFromAPI decodes the spec of a /eth/v1/config/spec response, see MarshalAPI.
+// All preset and config values must be present. Unknown keys are ignored,
+// but the known constants must match the constants of this implementation.
+// The preset is named after the PRESET_BASE of the config.
+func SpecFromAPI(values map[string]string) (*Spec, error) {
+	for k, expected := range specAPIConstants() {
+		if v, ok := values[k]; ok && !strings.EqualFold(v, expected) {
+			return nil, fmt.Errorf("constant %s is %s, expected %s", k, v, expected)
+		}
+	}
+	var spec Spec
+	var missing []string
+	err := specAPIFields(&spec, func(key string, v reflect.Value) error {
+		value, ok := values[key]
+		if !ok {
+			missing = append(missing, key)
+			return nil
+		}
+		node := yaml.Node{Kind: yaml.ScalarNode, Value: value}
+		if v.Kind() == reflect.String {
+			node.Tag = "!!str"
+		}
+		if err := node.Decode(v.Addr().Interface()); err != nil {
+			return fmt.Errorf("invalid value for %s: %v", key, err)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if len(missing) > 0 {
+		sort.Strings(missing)
+		return nil, fmt.Errorf("missing spec values: %s", strings.Join(missing, ", "))
+	}
+	spec.PresetName = spec.PRESET_BASE
+	return &spec, nil
+}
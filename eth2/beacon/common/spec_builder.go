@@ -0,0 +1,85 @@
+package common
+
+import . "github.com/protolambda/ztyp/view"
+
+// SpecBuilder modifies a copy of a spec, e.g. to run a devnet with shorter epochs or earlier forks.
+// The SSZ types are derived from the spec when used, the built spec sizes them with the modified preset.
+type SpecBuilder struct {
+	spec Spec
+}
+
+// NewSpecBuilder starts from a copy of the base spec.
+func NewSpecBuilder(base *Spec) *SpecBuilder {
+	return &SpecBuilder{spec: *base}
+}
+
+// With applies any other modification to the spec.
+func (b *SpecBuilder) With(fn func(spec *Spec)) *SpecBuilder {
+	fn(&b.spec)
+	return b
+}
+
+func (b *SpecBuilder) SlotsPerEpoch(v Slot) *SpecBuilder {
+	b.spec.SLOTS_PER_EPOCH = v
+	return b
+}
+
+func (b *SpecBuilder) SecondsPerSlot(v Timestamp) *SpecBuilder {
+	b.spec.SECONDS_PER_SLOT = v
+	return b
+}
+
+func (b *SpecBuilder) SlotsPerHistoricalRoot(v Slot) *SpecBuilder {
+	b.spec.SLOTS_PER_HISTORICAL_ROOT = v
+	return b
+}
+
+func (b *SpecBuilder) EpochsPerHistoricalVector(v Epoch) *SpecBuilder {
+	b.spec.EPOCHS_PER_HISTORICAL_VECTOR = v
+	return b
+}
+
+func (b *SpecBuilder) ChurnLimitQuotient(v Uint64View) *SpecBuilder {
+	b.spec.CHURN_LIMIT_QUOTIENT = v
+	return b
+}
+
+func (b *SpecBuilder) MinGenesisActiveValidatorCount(v Uint64View) *SpecBuilder {
+	b.spec.MIN_GENESIS_ACTIVE_VALIDATOR_COUNT = v
+	return b
+}
+
+func (b *SpecBuilder) GenesisForkVersion(v Version) *SpecBuilder {
+	b.spec.GENESIS_FORK_VERSION = v
+	return b
+}
+
+func (b *SpecBuilder) AltairForkEpoch(v Epoch) *SpecBuilder {
+	b.spec.ALTAIR_FORK_EPOCH = v
+	return b
+}
+
+func (b *SpecBuilder) BellatrixForkEpoch(v Epoch) *SpecBuilder {
+	b.spec.BELLATRIX_FORK_EPOCH = v
+	return b
+}
+
+func (b *SpecBuilder) CapellaForkEpoch(v Epoch) *SpecBuilder {
+	b.spec.CAPELLA_FORK_EPOCH = v
+	return b
+}
+
+func (b *SpecBuilder) DenebForkEpoch(v Epoch) *SpecBuilder {
+	b.spec.DENEB_FORK_EPOCH = v
+	return b
+}
+
+// Build validates the modified spec, and returns a copy of it. See Spec.Validate for the errors.
+// The builder can be used again after building.
+func (b *SpecBuilder) Build() (*Spec, error) {
+	spec := b.spec
+	if err := spec.Validate(); err != nil {
+		return nil, err
+	}
+	return &spec, nil
+}
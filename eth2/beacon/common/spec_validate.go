@@ -0,0 +1,180 @@
+package common
+
+import (
+	"fmt"
+	"strings"
+)
+
+// SpecErrors holds all violations of the invariants between the spec parameters, see Spec.Validate.
+type SpecErrors []error
+
+func (errs SpecErrors) Error() string {
+	msgs := make([]string, len(errs))
+	for i, err := range errs {
+		msgs[i] = err.Error()
+	}
+	return fmt.Sprintf("invalid spec: %s", strings.Join(msgs, "; "))
+}
+
+// Validate checks the invariants between the parameters of the spec that the transition relies on,
+// to detect an inconsistent config before it results in failures deep in the transition.
+// All violations are returned, as SpecErrors. Nil if the spec is valid.
+func (spec *Spec) Validate() error {
+	var errs SpecErrors
+	check := func(ok bool, format string, args ...interface{}) {
+		if !ok {
+			errs = append(errs, fmt.Errorf(format, args...))
+		}
+	}
+	nonZero := func(name string, v uint64) {
+		check(v != 0, "%s must not be zero", name)
+	}
+
+	// Parameters that are divided by, or taken modulo of.
+	nonZero("SLOTS_PER_EPOCH", uint64(spec.SLOTS_PER_EPOCH))
+	nonZero("MAX_COMMITTEES_PER_SLOT", uint64(spec.MAX_COMMITTEES_PER_SLOT))
+	nonZero("TARGET_COMMITTEE_SIZE", uint64(spec.TARGET_COMMITTEE_SIZE))
+	nonZero("HYSTERESIS_QUOTIENT", uint64(spec.HYSTERESIS_QUOTIENT))
+	nonZero("EFFECTIVE_BALANCE_INCREMENT", uint64(spec.EFFECTIVE_BALANCE_INCREMENT))
+	nonZero("EPOCHS_PER_ETH1_VOTING_PERIOD", uint64(spec.EPOCHS_PER_ETH1_VOTING_PERIOD))
+	nonZero("EPOCHS_PER_SLASHINGS_VECTOR", uint64(spec.EPOCHS_PER_SLASHINGS_VECTOR))
+	nonZero("WHISTLEBLOWER_REWARD_QUOTIENT", uint64(spec.WHISTLEBLOWER_REWARD_QUOTIENT))
+	nonZero("PROPOSER_REWARD_QUOTIENT", uint64(spec.PROPOSER_REWARD_QUOTIENT))
+	nonZero("INACTIVITY_PENALTY_QUOTIENT", uint64(spec.INACTIVITY_PENALTY_QUOTIENT))
+	nonZero("MIN_SLASHING_PENALTY_QUOTIENT", uint64(spec.MIN_SLASHING_PENALTY_QUOTIENT))
+	nonZero("INACTIVITY_PENALTY_QUOTIENT_ALTAIR", uint64(spec.INACTIVITY_PENALTY_QUOTIENT_ALTAIR))
+	nonZero("MIN_SLASHING_PENALTY_QUOTIENT_ALTAIR", uint64(spec.MIN_SLASHING_PENALTY_QUOTIENT_ALTAIR))
+	nonZero("EPOCHS_PER_SYNC_COMMITTEE_PERIOD", uint64(spec.EPOCHS_PER_SYNC_COMMITTEE_PERIOD))
+	nonZero("INACTIVITY_PENALTY_QUOTIENT_BELLATRIX", uint64(spec.INACTIVITY_PENALTY_QUOTIENT_BELLATRIX))
+	nonZero("MIN_SLASHING_PENALTY_QUOTIENT_BELLATRIX", uint64(spec.MIN_SLASHING_PENALTY_QUOTIENT_BELLATRIX))
+	nonZero("SECONDS_PER_SLOT", uint64(spec.SECONDS_PER_SLOT))
+	nonZero("CHURN_LIMIT_QUOTIENT", uint64(spec.CHURN_LIMIT_QUOTIENT))
+	// the altair inactivity penalty is divided by INACTIVITY_SCORE_BIAS * INACTIVITY_PENALTY_QUOTIENT_ALTAIR
+	nonZero("INACTIVITY_SCORE_BIAS", uint64(spec.INACTIVITY_SCORE_BIAS))
+
+	// Without rounds the shuffling is the identity, and committees are in validator index order.
+	nonZero("SHUFFLE_ROUND_COUNT", uint64(spec.SHUFFLE_ROUND_COUNT))
+	// Genesis would be triggered without any validators to propose or attest.
+	nonZero("MIN_GENESIS_ACTIVE_VALIDATOR_COUNT", uint64(spec.MIN_GENESIS_ACTIVE_VALIDATOR_COUNT))
+
+	// Phase0 proposer rewards are divided by the inclusion delay, which is at least the minimum delay,
+	// and attestations can only be included within an epoch after their slot.
+	check(spec.MIN_ATTESTATION_INCLUSION_DELAY >= 1,
+		"MIN_ATTESTATION_INCLUSION_DELAY must be at least 1")
+	check(spec.MIN_ATTESTATION_INCLUSION_DELAY <= spec.SLOTS_PER_EPOCH,
+		"MIN_ATTESTATION_INCLUSION_DELAY (%d) must not exceed SLOTS_PER_EPOCH (%d)",
+		spec.MIN_ATTESTATION_INCLUSION_DELAY, spec.SLOTS_PER_EPOCH)
+
+	// Block roots are batched into the historical roots at epoch boundaries,
+	// and the target root of the previous epoch must still be available at the end of the current epoch.
+	if spec.SLOTS_PER_EPOCH != 0 {
+		check(spec.SLOTS_PER_HISTORICAL_ROOT%spec.SLOTS_PER_EPOCH == 0,
+			"SLOTS_PER_HISTORICAL_ROOT (%d) must be a multiple of SLOTS_PER_EPOCH (%d)",
+			spec.SLOTS_PER_HISTORICAL_ROOT, spec.SLOTS_PER_EPOCH)
+	}
+	check(uint64(spec.SLOTS_PER_HISTORICAL_ROOT) >= 2*uint64(spec.SLOTS_PER_EPOCH),
+		"SLOTS_PER_HISTORICAL_ROOT (%d) must cover at least two epochs of SLOTS_PER_EPOCH (%d)",
+		spec.SLOTS_PER_HISTORICAL_ROOT, spec.SLOTS_PER_EPOCH)
+
+	// Like in all presets, the history vectors are full binary trees, so proofs into them have a fixed depth.
+	powerOfTwo := func(name string, v uint64) {
+		check(v != 0 && v&(v-1) == 0, "%s (%d) must be a power of two", name, v)
+	}
+	powerOfTwo("SLOTS_PER_HISTORICAL_ROOT", uint64(spec.SLOTS_PER_HISTORICAL_ROOT))
+	powerOfTwo("EPOCHS_PER_HISTORICAL_VECTOR", uint64(spec.EPOCHS_PER_HISTORICAL_VECTOR))
+
+	// The shuffling of the next epoch is computed ahead, at the start of the current epoch:
+	// its seed and its active validators must be final by then.
+	check(spec.MIN_SEED_LOOKAHEAD >= 1,
+		"MIN_SEED_LOOKAHEAD must be at least 1")
+	check(spec.MIN_SEED_LOOKAHEAD < spec.MAX_SEED_LOOKAHEAD,
+		"MIN_SEED_LOOKAHEAD (%d) must be less than MAX_SEED_LOOKAHEAD (%d)",
+		spec.MIN_SEED_LOOKAHEAD, spec.MAX_SEED_LOOKAHEAD)
+	// The seed is read from the randao mix of MIN_SEED_LOOKAHEAD + 1 epochs ago.
+	check(uint64(spec.EPOCHS_PER_HISTORICAL_VECTOR) > uint64(spec.MIN_SEED_LOOKAHEAD)+1,
+		"EPOCHS_PER_HISTORICAL_VECTOR (%d) must exceed MIN_SEED_LOOKAHEAD + 1 (%d)",
+		spec.EPOCHS_PER_HISTORICAL_VECTOR, spec.MIN_SEED_LOOKAHEAD+1)
+
+	// Balances
+	if spec.EFFECTIVE_BALANCE_INCREMENT != 0 {
+		check(spec.MAX_EFFECTIVE_BALANCE%spec.EFFECTIVE_BALANCE_INCREMENT == 0,
+			"MAX_EFFECTIVE_BALANCE (%d) must be a multiple of EFFECTIVE_BALANCE_INCREMENT (%d)",
+			spec.MAX_EFFECTIVE_BALANCE, spec.EFFECTIVE_BALANCE_INCREMENT)
+	}
+	check(spec.MAX_EFFECTIVE_BALANCE >= spec.EFFECTIVE_BALANCE_INCREMENT,
+		"MAX_EFFECTIVE_BALANCE (%d) must be at least EFFECTIVE_BALANCE_INCREMENT (%d)",
+		spec.MAX_EFFECTIVE_BALANCE, spec.EFFECTIVE_BALANCE_INCREMENT)
+	check(spec.EJECTION_BALANCE < spec.MAX_EFFECTIVE_BALANCE,
+		"EJECTION_BALANCE (%d) must be less than MAX_EFFECTIVE_BALANCE (%d)",
+		spec.EJECTION_BALANCE, spec.MAX_EFFECTIVE_BALANCE)
+	check(spec.MIN_DEPOSIT_AMOUNT <= spec.MAX_EFFECTIVE_BALANCE,
+		"MIN_DEPOSIT_AMOUNT (%d) must not exceed MAX_EFFECTIVE_BALANCE (%d)",
+		spec.MIN_DEPOSIT_AMOUNT, spec.MAX_EFFECTIVE_BALANCE)
+
+	// Committees
+	check(spec.MAX_VALIDATORS_PER_COMMITTEE >= spec.TARGET_COMMITTEE_SIZE,
+		"MAX_VALIDATORS_PER_COMMITTEE (%d) must be at least TARGET_COMMITTEE_SIZE (%d)",
+		spec.MAX_VALIDATORS_PER_COMMITTEE, spec.TARGET_COMMITTEE_SIZE)
+	// List limits of the state: the registry must fit the genesis validators and a full committee.
+	nonZero("HISTORICAL_ROOTS_LIMIT", uint64(spec.HISTORICAL_ROOTS_LIMIT))
+	check(spec.VALIDATOR_REGISTRY_LIMIT >= spec.MIN_GENESIS_ACTIVE_VALIDATOR_COUNT,
+		"VALIDATOR_REGISTRY_LIMIT (%d) must be at least MIN_GENESIS_ACTIVE_VALIDATOR_COUNT (%d)",
+		spec.VALIDATOR_REGISTRY_LIMIT, spec.MIN_GENESIS_ACTIVE_VALIDATOR_COUNT)
+	check(spec.VALIDATOR_REGISTRY_LIMIT >= spec.MAX_VALIDATORS_PER_COMMITTEE,
+		"VALIDATOR_REGISTRY_LIMIT (%d) must be at least MAX_VALIDATORS_PER_COMMITTEE (%d)",
+		spec.VALIDATOR_REGISTRY_LIMIT, spec.MAX_VALIDATORS_PER_COMMITTEE)
+	// Blocks must be able to include the deposits, or the chain stalls on the first deposit.
+	nonZero("MAX_DEPOSITS", uint64(spec.MAX_DEPOSITS))
+
+	// Sync committees are split into subnets of equal size.
+	check(spec.SYNC_COMMITTEE_SIZE != 0 && spec.SYNC_COMMITTEE_SIZE%SYNC_COMMITTEE_SUBNET_COUNT == 0,
+		"SYNC_COMMITTEE_SIZE (%d) must be a non-zero multiple of the sync committee subnet count (%d)",
+		spec.SYNC_COMMITTEE_SIZE, SYNC_COMMITTEE_SUBNET_COUNT)
+	check(spec.MIN_SYNC_COMMITTEE_PARTICIPANTS <= spec.SYNC_COMMITTEE_SIZE,
+		"MIN_SYNC_COMMITTEE_PARTICIPANTS (%d) must not exceed SYNC_COMMITTEE_SIZE (%d)",
+		spec.MIN_SYNC_COMMITTEE_PARTICIPANTS, spec.SYNC_COMMITTEE_SIZE)
+
+	// Execution payloads
+	// The logs bloom is a fixed-size array type, the execution-layer does not configure it.
+	check(spec.BYTES_PER_LOGS_BLOOM == BYTES_PER_LOGS_BLOOM,
+		"BYTES_PER_LOGS_BLOOM (%d) must be %d", spec.BYTES_PER_LOGS_BLOOM, BYTES_PER_LOGS_BLOOM)
+	// The next withdrawal index and validator are derived from the last withdrawal of a full payload.
+	nonZero("MAX_WITHDRAWALS_PER_PAYLOAD", uint64(spec.MAX_WITHDRAWALS_PER_PAYLOAD))
+	nonZero("MAX_VALIDATORS_PER_WITHDRAWALS_SWEEP", uint64(spec.MAX_VALIDATORS_PER_WITHDRAWALS_SWEEP))
+	// Blobs are evaluated over a power-of-two domain.
+	check(spec.FIELD_ELEMENTS_PER_BLOB != 0 && spec.FIELD_ELEMENTS_PER_BLOB&(spec.FIELD_ELEMENTS_PER_BLOB-1) == 0,
+		"FIELD_ELEMENTS_PER_BLOB (%d) must be a power of two", spec.FIELD_ELEMENTS_PER_BLOB)
+
+	// Forks are upgraded in order, and every fork needs its own version for domain separation.
+	check(spec.ALTAIR_FORK_EPOCH <= spec.BELLATRIX_FORK_EPOCH,
+		"ALTAIR_FORK_EPOCH (%d) must not be after BELLATRIX_FORK_EPOCH (%d)", spec.ALTAIR_FORK_EPOCH, spec.BELLATRIX_FORK_EPOCH)
+	check(spec.BELLATRIX_FORK_EPOCH <= spec.CAPELLA_FORK_EPOCH,
+		"BELLATRIX_FORK_EPOCH (%d) must not be after CAPELLA_FORK_EPOCH (%d)", spec.BELLATRIX_FORK_EPOCH, spec.CAPELLA_FORK_EPOCH)
+	check(spec.CAPELLA_FORK_EPOCH <= spec.DENEB_FORK_EPOCH,
+		"CAPELLA_FORK_EPOCH (%d) must not be after DENEB_FORK_EPOCH (%d)", spec.CAPELLA_FORK_EPOCH, spec.DENEB_FORK_EPOCH)
+	versions := []struct {
+		name    string
+		version Version
+	}{
+		{"GENESIS_FORK_VERSION", spec.GENESIS_FORK_VERSION},
+		{"ALTAIR_FORK_VERSION", spec.ALTAIR_FORK_VERSION},
+		{"BELLATRIX_FORK_VERSION", spec.BELLATRIX_FORK_VERSION},
+		{"CAPELLA_FORK_VERSION", spec.CAPELLA_FORK_VERSION},
+		{"DENEB_FORK_VERSION", spec.DENEB_FORK_VERSION},
+	}
+	for i := range versions {
+		for j := i + 1; j < len(versions); j++ {
+			check(versions[i].version != versions[j].version,
+				"%s and %s must differ, both are %s", versions[i].name, versions[j].name, versions[i].version)
+		}
+	}
+
+	// Fork choice
+	check(spec.PROPOSER_SCORE_BOOST <= 100,
+		"PROPOSER_SCORE_BOOST (%d) is a percentage, and must not exceed 100", spec.PROPOSER_SCORE_BOOST)
+
+	if len(errs) == 0 {
+		return nil
+	}
+	return errs
+}
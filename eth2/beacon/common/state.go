@@ -2,6 +2,7 @@ package common
 
 import (
 	"context"
+	"sync"
 
 	"github.com/protolambda/ztyp/tree"
 	"github.com/protolambda/ztyp/view"
@@ -136,11 +137,12 @@ type BeaconState interface {
 
 	ForkSettings(spec *Spec) *ForkSettings
 
-	// ProcessEpoch applies an epoch-transition to the state.
-	ProcessEpoch(ctx context.Context, spec *Spec, epc *EpochsContext) error
+	// ProcessEpoch applies an epoch-transition to the state. The transition may be nil.
+	ProcessEpoch(ctx context.Context, spec *Spec, epc *EpochsContext, tr *Transition) error
 	// ProcessBlock applies a block to the state.
 	// Excludes slot processing and signature validation. Just applies the block as-is. Error if mismatching slot.
-	ProcessBlock(ctx context.Context, spec *Spec, epc *EpochsContext, benv *BeaconBlockEnvelope) error
+	// The transition may be nil.
+	ProcessBlock(ctx context.Context, spec *Spec, epc *EpochsContext, tr *Transition, benv *BeaconBlockEnvelope) error
 }
 
 type UpgradeableBeaconState interface {
@@ -158,3 +160,25 @@ type SyncCommitteeBeaconState interface {
 	SetNextSyncCommittee(v *SyncCommitteeView) error
 	RotateSyncCommittee(next *SyncCommitteeView) error
 }
+
+// StateRootMemo memoizes the root of a state, for the backing node it was computed for.
+// Any mutation through the state view swaps the backing node of the state, which invalidates the memo.
+// The zero value is an empty memo. It is safe for concurrent use: concurrent root queries of the same state
+// are serialized, as hashing caches roots in the shared nodes of the tree.
+type StateRootMemo struct {
+	mu   sync.Mutex
+	node tree.Node
+	root Root
+}
+
+// HashTreeRoot returns the memoized root if the backing node did not change, and computes it otherwise.
+func (m *StateRootMemo) HashTreeRoot(backing tree.Node, hFn tree.HashFn) Root {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.node != nil && m.node == backing {
+		return m.root
+	}
+	m.root = backing.MerkleRoot(hFn)
+	m.node = backing
+	return m.root
+}
@@ -0,0 +1,114 @@
+package common
+
+import (
+	"github.com/protolambda/ztyp/tree"
+
+	"github.com/protolambda/zrnt/eth2/metrics"
+)
+
+// OpKind is the kind of a block operation, as named in the block body.
+type OpKind string
+
+const (
+	OpProposerSlashing     OpKind = "proposer_slashing"
+	OpAttesterSlashing     OpKind = "attester_slashing"
+	OpAttestation          OpKind = "attestation"
+	OpDeposit              OpKind = "deposit"
+	OpVoluntaryExit        OpKind = "voluntary_exit"
+	OpBLSToExecutionChange OpKind = "bls_to_execution_change"
+)
+
+// BlockStage is a sub-stage of the block transition.
+type BlockStage string
+
+const (
+	BlockStageHeader           BlockStage = "header"
+	BlockStageWithdrawals      BlockStage = "withdrawals"
+	BlockStageExecutionPayload BlockStage = "execution_payload"
+	BlockStageRandao           BlockStage = "randao"
+	BlockStageEth1Data         BlockStage = "eth1_data"
+	BlockStageOperations       BlockStage = "operations"
+	BlockStageSyncAggregate    BlockStage = "sync_aggregate"
+)
+
+// EpochStage is a stage of the epoch transition.
+type EpochStage string
+
+const (
+	EpochStageJustification              EpochStage = "justification_and_finalization"
+	EpochStageInactivityUpdates          EpochStage = "inactivity_updates"
+	EpochStageRewardsAndPenalties        EpochStage = "rewards_and_penalties"
+	EpochStageRegistryUpdates            EpochStage = "registry_updates"
+	EpochStageSlashings                  EpochStage = "slashings"
+	EpochStageEth1DataReset              EpochStage = "eth1_data_reset"
+	EpochStageEffectiveBalanceUpdates    EpochStage = "effective_balance_updates"
+	EpochStageSlashingsReset             EpochStage = "slashings_reset"
+	EpochStageRandaoMixesReset           EpochStage = "randao_mixes_reset"
+	EpochStageHistoricalRootsUpdate      EpochStage = "historical_roots_update"
+	EpochStageHistoricalSummariesUpdate  EpochStage = "historical_summaries_update"
+	EpochStageParticipationRecordUpdates EpochStage = "participation_record_updates"
+	EpochStageParticipationFlagUpdates   EpochStage = "participation_flag_updates"
+	EpochStageSyncCommitteeUpdates       EpochStage = "sync_committee_updates"
+)
+
+// Tracer follows the steps of the block and epoch transitions, to find where two implementations diverge.
+// The state root is nil, unless Transition.TraceStateRoots is enabled: hashing the state at every step is expensive.
+//
+// Operations are traced as they are applied: attestations are applied only after all attestations
+// of the block are verified, so an invalid attestation fails the operations stage without op callbacks.
+type Tracer interface {
+	// BeforeOp is called before the operation is applied, index is the position of the operation in its list in the block.
+	BeforeOp(kind OpKind, index int, stateRoot *Root)
+	// AfterOp is called after the operation is applied, or failed with the error.
+	AfterOp(kind OpKind, index int, err error, stateRoot *Root)
+	AfterBlockStage(stage BlockStage, stateRoot *Root)
+	AfterEpochStage(stage EpochStage, stateRoot *Root)
+}
+
+func (tr *Transition) traceRoot(state BeaconState) *Root {
+	if !tr.TraceStateRoots {
+		return nil
+	}
+	root := state.HashTreeRoot(tree.GetHashFn())
+	return &root
+}
+
+// TraceBeforeOp calls the tracer of the transition, if any.
+func (tr *Transition) TraceBeforeOp(state BeaconState, kind OpKind, index int) {
+	if tr != nil && tr.Tracer != nil {
+		tr.Tracer.BeforeOp(kind, index, tr.traceRoot(state))
+	}
+}
+
+// TraceAfterOp calls the tracer of the transition, if any.
+func (tr *Transition) TraceAfterOp(state BeaconState, kind OpKind, index int, err error) {
+	if tr != nil && tr.Tracer != nil {
+		tr.Tracer.AfterOp(kind, index, err, tr.traceRoot(state))
+	}
+}
+
+// TraceBlockStage calls the tracer of the transition, if any, and reports the stage duration to the metrics sink, if any.
+func (tr *Transition) TraceBlockStage(state BeaconState, stage BlockStage) {
+	if tr == nil {
+		return
+	}
+	if tr.Metrics != nil {
+		tr.observeStage(metrics.BlockStageSeconds, string(stage))
+	}
+	if tr.Tracer != nil {
+		tr.Tracer.AfterBlockStage(stage, tr.traceRoot(state))
+	}
+}
+
+// TraceEpochStage calls the tracer of the transition, if any, and reports the stage duration to the metrics sink, if any.
+func (tr *Transition) TraceEpochStage(state BeaconState, stage EpochStage) {
+	if tr == nil {
+		return
+	}
+	if tr.Metrics != nil {
+		tr.observeStage(metrics.EpochStageSeconds, string(stage))
+	}
+	if tr.Tracer != nil {
+		tr.Tracer.AfterEpochStage(stage, tr.traceRoot(state))
+	}
+}
@@ -2,8 +2,10 @@ package common
 
 import (
 	"bytes"
+	"encoding/binary"
 	"encoding/hex"
 	"errors"
+	"fmt"
 
 	"github.com/protolambda/ztyp/codec"
 	"github.com/protolambda/ztyp/conv"
@@ -17,12 +19,78 @@ func PayloadTransactionsType(spec *Spec) ListTypeDef {
 
 type PayloadTransactions []Transaction
 
+func (li PayloadTransactions) MarshalJSON() ([]byte, error) {
+	return MarshalJSONList(len(li), []Transaction(li))
+}
+
+// Deserialize reads the transactions list into a single buffer, without copying the transactions individually:
+// every decoded transaction is a sub-slice of the buffer, with its capacity limited to its own bytes.
+// The buffer is retained for as long as any of the transactions is referenced.
+// Use Copy for transactions that should not keep the rest of the list alive.
 func (txs *PayloadTransactions) Deserialize(spec *Spec, dr *codec.DecodingReader) error {
-	return dr.List(func() codec.Deserializable {
-		i := len(*txs)
-		*txs = append(*txs, Transaction{})
-		return spec.Wrap(&((*txs)[i]))
-	}, 0, uint64(spec.MAX_TRANSACTIONS_PER_PAYLOAD))
+	scope := dr.Scope()
+	// no transactions to decode
+	if scope == 0 {
+		return nil
+	}
+	buf := make([]byte, scope, scope)
+	if _, err := dr.Read(buf); err != nil {
+		return err
+	}
+	return txs.decodeShared(spec, buf)
+}
+
+func (txs *PayloadTransactions) decodeShared(spec *Spec, buf []byte) error {
+	scope := uint64(len(buf))
+	if scope < codec.OFFSET_SIZE {
+		return fmt.Errorf("transactions list of %d bytes is too small for an offset", scope)
+	}
+	firstOffset := uint64(binary.LittleEndian.Uint32(buf[:codec.OFFSET_SIZE]))
+	if firstOffset == 0 || firstOffset%codec.OFFSET_SIZE != 0 {
+		return fmt.Errorf("first offset of list is invalid, not a non-zero multiple of 4: %d", firstOffset)
+	}
+	if firstOffset > scope {
+		return fmt.Errorf("first offset %d is out of scope %d", firstOffset, scope)
+	}
+	length := firstOffset / codec.OFFSET_SIZE
+	if length > uint64(spec.MAX_TRANSACTIONS_PER_PAYLOAD) {
+		return fmt.Errorf("too many items in list: %d > %d", length, uint64(spec.MAX_TRANSACTIONS_PER_PAYLOAD))
+	}
+	out := *txs
+	if uint64(cap(out)-len(out)) < length {
+		out = append(make(PayloadTransactions, 0, uint64(len(out))+length), out...)
+	}
+	offset := firstOffset
+	for i := uint64(0); i < length; i++ {
+		next := scope
+		if i+1 < length {
+			next = uint64(binary.LittleEndian.Uint32(buf[(i+1)*codec.OFFSET_SIZE:]))
+		}
+		if next < offset || next > scope {
+			return fmt.Errorf("offset %d of transaction %d is invalid, previous was %d, scope is %d", next, i+1, offset, scope)
+		}
+		if size := next - offset; size > uint64(spec.MAX_BYTES_PER_TRANSACTION) {
+			return fmt.Errorf("failed to deserialize item %d: byte list is too big: %d bytes, limit is %d",
+				i, size, uint64(spec.MAX_BYTES_PER_TRANSACTION))
+		}
+		out = append(out, Transaction(buf[offset:next:next]))
+		offset = next
+	}
+	*txs = out
+	return nil
+}
+
+// Copy returns the transactions with their own copies of the transaction bytes, not sharing any buffer.
+func (txs PayloadTransactions) Copy() PayloadTransactions {
+	if txs == nil {
+		return nil
+	}
+	out := make(PayloadTransactions, len(txs), len(txs))
+	for i, tx := range txs {
+		out[i] = make(Transaction, len(tx), len(tx))
+		copy(out[i], tx)
+	}
+	return out
 }
 
 func (txs PayloadTransactions) Serialize(spec *Spec, w *codec.EncodingWriter) error {
@@ -42,14 +110,13 @@ func (txs *PayloadTransactions) FixedLength(*Spec) uint64 {
 	return 0
 }
 
+// HashTreeRoot hashes the transaction bytes in place, e.g. directly from the buffer of a decoded list.
 func (txs PayloadTransactions) HashTreeRoot(spec *Spec, hFn tree.HashFn) Root {
 	length := uint64(len(txs))
-	return hFn.ComplexListHTR(func(i uint64) tree.HTR {
-		if i < length {
-			return spec.Wrap(&txs[i])
-		}
-		return nil
-	}, length, uint64(spec.MAX_TRANSACTIONS_PER_PAYLOAD))
+	txLimit := uint64(spec.MAX_BYTES_PER_TRANSACTION)
+	return hFn.Mixin(tree.Merkleize(hFn, length, uint64(spec.MAX_TRANSACTIONS_PER_PAYLOAD), func(i uint64) Root {
+		return hFn.ByteListHTR(txs[i], txLimit)
+	}), length)
 }
 
 func TransactionType(spec *Spec) *BasicListTypeDef {
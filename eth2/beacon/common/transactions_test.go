@@ -0,0 +1,122 @@
+package common
+
+import (
+	"bytes"
+	"encoding/binary"
+	"testing"
+	"unsafe"
+
+	"github.com/protolambda/ztyp/codec"
+	"github.com/protolambda/ztyp/tree"
+)
+
+func testTransactionsSpec() *Spec {
+	spec := &Spec{}
+	spec.MAX_BYTES_PER_TRANSACTION = 1 << 30
+	spec.MAX_TRANSACTIONS_PER_PAYLOAD = 1 << 20
+	return spec
+}
+
+func testTransactions(count int) PayloadTransactions {
+	txs := make(PayloadTransactions, count)
+	for i := range txs {
+		// some empty transactions in between
+		txs[i] = make(Transaction, (i*37)%300)
+		for j := range txs[i] {
+			txs[i][j] = byte(i + j)
+		}
+	}
+	return txs
+}
+
+func testDecodeTransactions(t *testing.T, spec *Spec, data []byte) (PayloadTransactions, error) {
+	t.Helper()
+	var txs PayloadTransactions
+	err := txs.Deserialize(spec, codec.NewDecodingReader(bytes.NewReader(data), uint64(len(data))))
+	return txs, err
+}
+
+func TestPayloadTransactionsSharedDecode(t *testing.T) {
+	spec := testTransactionsSpec()
+	expected := testTransactions(100)
+	var buf bytes.Buffer
+	if err := expected.Serialize(spec, codec.NewEncodingWriter(&buf)); err != nil {
+		t.Fatal(err)
+	}
+	txs, err := testDecodeTransactions(t, spec, buf.Bytes())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(txs) != len(expected) {
+		t.Fatalf("expected %d transactions, got %d", len(expected), len(txs))
+	}
+	for i := range txs {
+		if !bytes.Equal(txs[i], expected[i]) {
+			t.Fatalf("transaction %d does not match", i)
+		}
+		if cap(txs[i]) != len(txs[i]) {
+			t.Fatalf("transaction %d may be appended to into the next transaction", i)
+		}
+	}
+	// the transactions share the buffer
+	if uintptr(unsafe.Pointer(&txs[2][len(txs[2])-1]))+1 != uintptr(unsafe.Pointer(&txs[3][0])) {
+		t.Fatal("expected transactions to be sub-slices of the same buffer")
+	}
+
+	// the hash-tree-root is the same as of the generic list
+	hFn := tree.GetHashFn()
+	genericRoot := hFn.ComplexListHTR(func(i uint64) tree.HTR {
+		return spec.Wrap(&expected[i])
+	}, uint64(len(expected)), uint64(spec.MAX_TRANSACTIONS_PER_PAYLOAD))
+	if root := txs.HashTreeRoot(spec, hFn); root != genericRoot {
+		t.Fatalf("hash-tree-root %s does not match generic list root %s", root, genericRoot)
+	}
+
+	copied := txs.Copy()
+	copied[3][0] ^= 0xff
+	if txs[3][0] == copied[3][0] {
+		t.Fatal("copy must not share the buffer")
+	}
+	if root := copied.HashTreeRoot(spec, hFn); root == genericRoot {
+		t.Fatal("expected different root after changing the copy")
+	}
+}
+
+func TestPayloadTransactionsInvalidOffsets(t *testing.T) {
+	spec := testTransactionsSpec()
+	valid := testTransactions(3)
+	var buf bytes.Buffer
+	if err := valid.Serialize(spec, codec.NewEncodingWriter(&buf)); err != nil {
+		t.Fatal(err)
+	}
+	data := buf.Bytes()
+	cases := map[string]func(b []byte){
+		"zero first offset":    func(b []byte) { binary.LittleEndian.PutUint32(b[0:4], 0) },
+		"unaligned offset":     func(b []byte) { binary.LittleEndian.PutUint32(b[0:4], 13) },
+		"first out of scope":   func(b []byte) { binary.LittleEndian.PutUint32(b[0:4], uint32(len(b)+4)) },
+		"decreasing offset":    func(b []byte) { binary.LittleEndian.PutUint32(b[8:12], 11) },
+		"offset out of scope":  func(b []byte) { binary.LittleEndian.PutUint32(b[8:12], uint32(len(b)+1)) },
+		"too short for offset": nil,
+	}
+	for name, modify := range cases {
+		b := append([]byte(nil), data...)
+		if modify != nil {
+			modify(b)
+		} else {
+			b = b[:2]
+		}
+		if _, err := testDecodeTransactions(t, spec, b); err == nil {
+			t.Errorf("%s: expected decoding error", name)
+		}
+	}
+	small := *spec
+	small.MAX_BYTES_PER_TRANSACTION = 50
+	if _, err := testDecodeTransactions(t, &small, data); err == nil {
+		t.Error("expected error for too large transaction")
+	}
+	small = *spec
+	small.MAX_TRANSACTIONS_PER_PAYLOAD = 2
+	if _, err := testDecodeTransactions(t, &small, data); err == nil {
+		t.Error("expected error for too many transactions")
+	}
+}
@@ -4,8 +4,11 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"time"
 
 	"github.com/protolambda/ztyp/tree"
+
+	"github.com/protolambda/zrnt/eth2/metrics"
 )
 
 func ProcessSlot(ctx context.Context, _ *Spec, state BeaconState) error {
@@ -57,6 +60,13 @@ func ProcessSlot(ctx context.Context, _ *Spec, state BeaconState) error {
 // Returns an error if the slot is older than the state is already at.
 // Mutates the state, does not copy.
 func ProcessSlots(ctx context.Context, spec *Spec, epc *EpochsContext, state UpgradeableBeaconState, slot Slot) error {
+	return ProcessSlotsWithOptions(ctx, spec, epc, state, slot, TransitionOptions{})
+}
+
+// ProcessSlotsWithOptions is ProcessSlots, with the epoch transitions traced and measured as configured by the options.
+// The checks of the options only apply to blocks, and are ignored.
+func ProcessSlotsWithOptions(ctx context.Context, spec *Spec, epc *EpochsContext, state UpgradeableBeaconState,
+	slot Slot, opts TransitionOptions) error {
 	// happens at the start of every CurrentSlot
 	currentSlot, err := state.Slot()
 	if err != nil {
@@ -69,6 +79,11 @@ func ProcessSlots(ctx context.Context, spec *Spec, epc *EpochsContext, state Upg
 		if err := ctx.Err(); err != nil {
 			return err
 		}
+		if opts.ParallelHashing {
+			if err := HashValidatorsParallel(state); err != nil {
+				return err
+			}
+		}
 		if err := ProcessSlot(ctx, spec, state); err != nil {
 			return err
 		}
@@ -76,20 +91,15 @@ func ProcessSlots(ctx context.Context, spec *Spec, epc *EpochsContext, state Upg
 		// (with the slot still at the end of the last epoch)
 		isEpochEnd := spec.SlotToEpoch(currentSlot+1) != spec.SlotToEpoch(currentSlot)
 		if isEpochEnd {
-			if err := state.ProcessEpoch(ctx, spec, epc); err != nil {
+			if err := processEpoch(ctx, spec, epc, state, currentSlot+1, &opts); err != nil {
 				return err
 			}
-		}
-		currentSlot += 1
-		if err := state.SetSlot(currentSlot); err != nil {
-			return err
-		}
-
-		if isEpochEnd {
-			if err := epc.RotateEpochs(state); err != nil {
+		} else {
+			if err := state.SetSlot(currentSlot + 1); err != nil {
 				return err
 			}
 		}
+		currentSlot += 1
 
 		if err := state.UpgradeMaybe(ctx, spec, epc); err != nil {
 			return err
@@ -98,18 +108,158 @@ func ProcessSlots(ctx context.Context, spec *Spec, epc *EpochsContext, state Upg
 	return nil
 }
 
+// Transition holds what is specific to a single block or epoch transition.
+// The EpochsContext is shared between states, and is not changed during a transition: anything that is,
+// like re-used buffers, lives here instead. Every transition has its own, it is never shared.
+//
+// A nil transition is valid: buffers are allocated, and nothing is traced or measured.
+type Transition struct {
+	// Reusable buffers of the epoch transition, nil to allocate new buffers.
+	Scratch *EpochProcessScratch
+
+	// Optional, collects the signatures of the block, to verify them all at once after processing the block.
+	// Nil to verify every signature when it is processed.
+	SignatureBatch *SignatureBatch
+	// Skip the signatures of the operations of the block, to replay a block that was already fully validated.
+	// Deposit signatures are still checked: they decide if a deposit is applied.
+	SkipSignatures bool
+
+	// Optional, follows the steps of the transition. Nil to not trace.
+	Tracer Tracer
+	// Pass the state root to the tracer at every step. Expensive: the state is hashed at every step.
+	TraceStateRoots bool
+
+	// Optional, receives the metrics of the transition. Nil for no metrics.
+	Metrics metrics.Sink
+	// Start of the current block or epoch stage, only tracked if there is a metrics sink.
+	stageStart time.Time
+}
+
+// EpochScratch returns the buffers of the epoch transition, nil if the transition is nil or has none.
+func (tr *Transition) EpochScratch() *EpochProcessScratch {
+	if tr == nil {
+		return nil
+	}
+	return tr.Scratch
+}
+
+// processEpoch runs the epoch transition, moves the state to the next slot, and rotates the epochs context,
+// with a pooled scratch for re-use of the large buffers between epoch transitions.
+func processEpoch(ctx context.Context, spec *Spec, epc *EpochsContext, state UpgradeableBeaconState,
+	nextSlot Slot, opts *TransitionOptions) error {
+	tr := opts.NewTransition()
+	tr.Scratch = GetEpochProcessScratch()
+	defer PutEpochProcessScratch(tr.Scratch)
+	start := time.Now()
+	tr.StartStages()
+	if err := state.ProcessEpoch(ctx, spec, epc, tr); err != nil {
+		return err
+	}
+	if err := state.SetSlot(nextSlot); err != nil {
+		return err
+	}
+	if err := epc.rotateEpochs(state, tr.Scratch); err != nil {
+		return err
+	}
+	if tr.Metrics != nil {
+		tr.Metrics.Observe(metrics.EpochTransitionSeconds, time.Since(start).Seconds())
+		epc.ReportCacheMetrics(tr.Metrics)
+	}
+	return nil
+}
+
+// TransitionOptions configure the checks of a block transition. The zero value skips all optional checks;
+// use FullVerification for the checks of an untrusted block.
+type TransitionOptions struct {
+	// VerifySignatures checks the signatures of the operations of the block.
+	// Skip them only to replay blocks that were already fully validated.
+	// Deposit signatures are always checked: an invalid one skips the deposit, it does not invalidate the block.
+	VerifySignatures bool
+	// VerifyProposer checks the signature of the block by its proposer.
+	VerifyProposer bool
+	// VerifyStateRoot checks the state root of the block against the post-state.
+	VerifyStateRoot bool
+	// SignatureBatch collects the signatures of the block, to verify them all at once after processing the block.
+	// Nil to verify every signature when it is processed. Ignored if the signatures are not verified.
+	SignatureBatch *SignatureBatch
+
+	// Tracer follows the steps of the transition, optional.
+	Tracer Tracer
+	// TraceStateRoots passes the state root of every step to the tracer. Expensive: the state is hashed at every step.
+	TraceStateRoots bool
+	// Metrics receives the metrics of the transition, optional.
+	Metrics metrics.Sink
+	// ParallelHashing hashes the validator registry with a worker per CPU before the state root of every slot,
+	// see HashValidatorsParallel. For bulk processing of a state that is not hashed by anything else at the same time.
+	ParallelHashing bool
+}
+
+// NewTransition makes the Transition of a single block or epoch transition, traced and measured as configured by the options.
+func (opts *TransitionOptions) NewTransition() *Transition {
+	return &Transition{
+		Tracer:          opts.Tracer,
+		TraceStateRoots: opts.TraceStateRoots,
+		Metrics:         opts.Metrics,
+	}
+}
+
+// FullVerification returns the options that check everything of the block.
+func FullVerification() TransitionOptions {
+	return TransitionOptions{VerifySignatures: true, VerifyProposer: true, VerifyStateRoot: true}
+}
+
+// validateResultOptions are the options of the validateResult flag: the operation signatures are always verified,
+// the proposer signature and the state root only if the result is validated.
+func validateResultOptions(validateResult bool, batch *SignatureBatch) TransitionOptions {
+	return TransitionOptions{
+		VerifySignatures: true,
+		VerifyProposer:   validateResult,
+		VerifyStateRoot:  validateResult,
+		SignatureBatch:   batch,
+	}
+}
+
 // StateTransition to the slot of the given block, then process the block.
 // Returns an error if the slot is older or equal to what the state is already at.
 // Mutates the state, does not copy.
 func StateTransition(ctx context.Context, spec *Spec, epc *EpochsContext, state UpgradeableBeaconState, benv *BeaconBlockEnvelope, validateResult bool) error {
-	if err := ProcessSlots(ctx, spec, epc, state, benv.Slot); err != nil {
+	return StateTransitionWithOptions(ctx, spec, epc, state, benv, validateResultOptions(validateResult, nil))
+}
+
+// StateTransitionWithBatch is StateTransition, but collects the signatures of the block in the batch,
+// to verify them all at once after processing the block. The batch may be nil, to verify every signature
+// when it is processed. If the batch is invalid, the error describes the first invalid signature.
+func StateTransitionWithBatch(ctx context.Context, spec *Spec, epc *EpochsContext, state UpgradeableBeaconState,
+	benv *BeaconBlockEnvelope, validateResult bool, batch *SignatureBatch) error {
+	return StateTransitionWithOptions(ctx, spec, epc, state, benv, validateResultOptions(validateResult, batch))
+}
+
+// StateTransitionWithOptions is StateTransition, with the checks of the block configured by the options.
+// All other rules of the block, like the slashability of validators and the validity of indices, are always enforced.
+func StateTransitionWithOptions(ctx context.Context, spec *Spec, epc *EpochsContext, state UpgradeableBeaconState,
+	benv *BeaconBlockEnvelope, opts TransitionOptions) error {
+	if err := ProcessSlotsWithOptions(ctx, spec, epc, state, benv.Slot, opts); err != nil {
 		return err
 	}
-	return PostSlotTransition(ctx, spec, epc, state, benv, validateResult)
+	return PostSlotTransitionWithOptions(ctx, spec, epc, state, benv, opts)
 }
 
 // PostSlotTransition finishes a state transition after applying ProcessSlots(..., block.Slot).
 func PostSlotTransition(ctx context.Context, spec *Spec, epc *EpochsContext, state BeaconState, benv *BeaconBlockEnvelope, validateResult bool) error {
+	return PostSlotTransitionWithOptions(ctx, spec, epc, state, benv, validateResultOptions(validateResult, nil))
+}
+
+// PostSlotTransitionWithBatch is PostSlotTransition, with the signatures of the block verified at once,
+// see StateTransitionWithBatch.
+func PostSlotTransitionWithBatch(ctx context.Context, spec *Spec, epc *EpochsContext, state BeaconState,
+	benv *BeaconBlockEnvelope, validateResult bool, batch *SignatureBatch) error {
+	return PostSlotTransitionWithOptions(ctx, spec, epc, state, benv, validateResultOptions(validateResult, batch))
+}
+
+// PostSlotTransitionWithOptions is PostSlotTransition, with the checks of the block configured by the options,
+// see StateTransitionWithOptions.
+func PostSlotTransitionWithOptions(ctx context.Context, spec *Spec, epc *EpochsContext, state BeaconState,
+	benv *BeaconBlockEnvelope, opts TransitionOptions) error {
 	slot, err := state.Slot()
 	if err != nil {
 		return err
@@ -117,40 +267,73 @@ func PostSlotTransition(ctx context.Context, spec *Spec, epc *EpochsContext, sta
 	if slot != benv.Slot {
 		return fmt.Errorf("transition of block, post-slot-processing, must run on state with same slot")
 	}
-	if validateResult {
-		// TODO: tests have invalid fork version in state
-		fork, err := state.Fork()
-		if err != nil {
-			return err
-		}
-		//version := spec.ForkVersion(benv.Slot)
-		//if fork.CurrentVersion != version {
-		//	return fmt.Errorf("state does not have expected fork version of block slot: %s <> %s (slot %d)",
-		//		fork.CurrentVersion, version, benv.Slot)
-		//}
-		proposer, err := epc.GetBeaconProposer(benv.Slot)
-		if err != nil {
+	batch := opts.SignatureBatch
+	if !opts.VerifySignatures {
+		batch = nil
+	}
+	if batch != nil {
+		batch.Reset()
+	}
+	tr := opts.NewTransition()
+	tr.SignatureBatch = batch
+	if opts.VerifyProposer {
+		if err := VerifyProposerSignature(spec, epc, tr, state, benv); err != nil {
 			return err
 		}
-		genValRoot, err := state.GenesisValidatorsRoot()
-		if err != nil {
+	}
+	// after the proposer signature, which may be verified without the signatures of the operations
+	tr.SkipSignatures = !opts.VerifySignatures
+	start := time.Now()
+	tr.StartStages()
+	if err := state.ProcessBlock(ctx, spec, epc, tr, benv); err != nil {
+		return err
+	}
+	if batch != nil {
+		if err := batch.Verify(); err != nil {
 			return err
 		}
-		pub, ok := epc.ValidatorPubkeyCache.Pubkey(proposer)
-		if !ok {
-			return fmt.Errorf("unknown pubkey for proposer %d", proposer)
-		}
-		if !benv.VerifySignatureVersioned(spec, fork.CurrentVersion, genValRoot, proposer, pub) {
-			return errors.New("block has invalid signature")
-		}
 	}
-	if err := state.ProcessBlock(ctx, spec, epc, benv); err != nil {
-		return err
+	if tr.Metrics != nil {
+		tr.Metrics.Observe(metrics.BlockTransitionSeconds, time.Since(start).Seconds())
+		epc.ReportCacheMetrics(tr.Metrics)
 	}
 
 	// State root verification
-	if validateResult && benv.StateRoot != state.HashTreeRoot(tree.GetHashFn()) {
+	if opts.VerifyStateRoot && benv.StateRoot != state.HashTreeRoot(tree.GetHashFn()) {
 		return errors.New("block has invalid state root")
 	}
 	return nil
 }
+
+// VerifyProposerSignature checks the signature of the block by the expected proposer, with the fork version of the state.
+// The state must be processed up to the slot of the block.
+func VerifyProposerSignature(spec *Spec, epc *EpochsContext, tr *Transition, state BeaconState, benv *BeaconBlockEnvelope) error {
+	// TODO: tests have invalid fork version in state
+	fork, err := state.Fork()
+	if err != nil {
+		return err
+	}
+	//version := spec.ForkVersion(benv.Slot)
+	//if fork.CurrentVersion != version {
+	//	return fmt.Errorf("state does not have expected fork version of block slot: %s <> %s (slot %d)",
+	//		fork.CurrentVersion, version, benv.Slot)
+	//}
+	proposer, err := epc.GetBeaconProposer(benv.Slot)
+	if err != nil {
+		return err
+	}
+	genValRoot, err := state.GenesisValidatorsRoot()
+	if err != nil {
+		return err
+	}
+	pub, ok := epc.ValidatorPubkeyCache.Pubkey(proposer)
+	if !ok {
+		return fmt.Errorf("unknown pubkey for proposer %d", proposer)
+	}
+	tr.CountSignatures("block", 1)
+	blsPub, signingRoot, sig, ok := benv.signatureSet(fork.CurrentVersion, genValRoot, proposer, pub)
+	if !ok || !tr.VerifySignature("block", blsPub, signingRoot[:], sig) {
+		return errors.New("block has invalid signature")
+	}
+	return nil
+}
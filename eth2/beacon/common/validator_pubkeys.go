@@ -1,20 +1,61 @@
 package common
 
 import (
+	"context"
+	"encoding/binary"
 	"fmt"
 	"sync"
+	"sync/atomic"
+
+	blsu "github.com/protolambda/bls12-381-util"
+)
+
+// The pubkey cache is split in a fixed number of shards, to reduce lock contention of concurrent lookups.
+const (
+	pubkeyCacheShardBits = 5
+	pubkeyCacheShards    = 1 << pubkeyCacheShardBits
+	pubkeyCacheShardMask = pubkeyCacheShards - 1
 )
 
+type pubkeyIndexShard struct {
+	rwLock sync.RWMutex
+	// The pubkeys of the indices in this shard, in order: (index - trustedParentCount) >> pubkeyCacheShardBits
+	// The entries are never moved, pointers to them remain valid after appends.
+	pubs []*CachedPubkey
+}
+
+type pubkeyLookupShard struct {
+	rwLock  sync.RWMutex
+	pub2idx map[BLSPubkey]ValidatorIndex
+}
+
 // PubkeyCache is shared between any state. However, if .Append(index, pubkey) conflicts, a new cache will be forked out.
+//
+// Lookups by index are sharded by index, lookups by pubkey are sharded by pubkey, each shard with its own lock.
+// Lookups only take the read lock of a single shard, appends take the write lock of just the shards they change.
 type PubkeyCache struct {
 	parent *PubkeyCache
 	// The count up until the conflicting validator index (cause of the pubkey cache fork).
 	trustedParentCount ValidatorIndex
-	pub2idx            map[BLSPubkey]ValidatorIndex
-	// starting at trustedParentCount
-	idx2pub []CachedPubkey
-	// Can have many reads concurrently, but only 1 write.
-	rwLock sync.RWMutex
+	// Number of pubkeys in this cache, starting at trustedParentCount. Accessed atomically.
+	count uint64
+
+	idx2pub [pubkeyCacheShards]pubkeyIndexShard
+	pub2idx [pubkeyCacheShards]pubkeyLookupShard
+
+	// Only 1 append at a time. Lookups do not take this lock.
+	appendLock sync.Mutex
+}
+
+func newPubkeyCache(parent *PubkeyCache, trustedParentCount ValidatorIndex) *PubkeyCache {
+	pc := &PubkeyCache{
+		parent:             parent,
+		trustedParentCount: trustedParentCount,
+	}
+	for i := range pc.pub2idx {
+		pc.pub2idx[i].pub2idx = make(map[BLSPubkey]ValidatorIndex)
+	}
+	return pc
 }
 
 func NewPubkeyCache(vals ValidatorRegistry) (*PubkeyCache, error) {
@@ -22,14 +63,9 @@ func NewPubkeyCache(vals ValidatorRegistry) (*PubkeyCache, error) {
 	if err != nil {
 		return nil, err
 	}
-	pc := &PubkeyCache{
-		parent:             nil,
-		trustedParentCount: 0,
-		pub2idx:            make(map[BLSPubkey]ValidatorIndex),
-		idx2pub:            make([]CachedPubkey, 0),
-	}
-	currentCount := uint64(len(pc.idx2pub))
-	for i := currentCount; i < valCount; i++ {
+	pc := newPubkeyCache(nil, 0)
+	entries := make([]CachedPubkey, valCount)
+	for i := uint64(0); i < valCount; i++ {
 		idx := ValidatorIndex(i)
 		v, err := vals.Validator(idx)
 		if err != nil {
@@ -39,19 +75,57 @@ func NewPubkeyCache(vals ValidatorRegistry) (*PubkeyCache, error) {
 		if err != nil {
 			return nil, err
 		}
-		pc.pub2idx[pub] = idx
-		pc.idx2pub = append(pc.idx2pub, CachedPubkey{Compressed: pub})
+		entries[i].Compressed = pub
+		// not shared yet, no need to lock
+		pc.appendUnsafe(idx, &entries[i])
 	}
 	return pc, nil
 }
 
 func EmptyPubkeyCache() *PubkeyCache {
-	return &PubkeyCache{
-		parent:             nil,
-		trustedParentCount: 0,
-		pub2idx:            make(map[BLSPubkey]ValidatorIndex),
-		idx2pub:            make([]CachedPubkey, 0),
+	return newPubkeyCache(nil, 0)
+}
+
+func pubkeyShard(pub *BLSPubkey) uint32 {
+	// the last bytes of the compressed pubkey are part of the x coordinate, and evenly distributed.
+	return binary.LittleEndian.Uint32(pub[44:48]) & pubkeyCacheShardMask
+}
+
+// appendUnsafe adds the next pubkey to the shards, the caller must hold the append lock.
+func (pc *PubkeyCache) appendUnsafe(index ValidatorIndex, pub *CachedPubkey) {
+	li := uint64(index - pc.trustedParentCount)
+	idxShard := &pc.idx2pub[li&pubkeyCacheShardMask]
+	idxShard.rwLock.Lock()
+	idxShard.pubs = append(idxShard.pubs, pub)
+	idxShard.rwLock.Unlock()
+
+	pubShard := &pc.pub2idx[pubkeyShard(&pub.Compressed)]
+	pubShard.rwLock.Lock()
+	pubShard.pub2idx[pub.Compressed] = index
+	pubShard.rwLock.Unlock()
+
+	atomic.AddUint64(&pc.count, 1)
+}
+
+// nextIndex is the validator index of the next pubkey to append.
+func (pc *PubkeyCache) nextIndex() ValidatorIndex {
+	return pc.trustedParentCount + ValidatorIndex(atomic.LoadUint64(&pc.count))
+}
+
+// ownPubkey looks up the pubkey in this cache, without looking at the parent.
+func (pc *PubkeyCache) ownPubkey(index ValidatorIndex) (pub *CachedPubkey, ok bool) {
+	if index < pc.trustedParentCount {
+		return nil, false
+	}
+	li := uint64(index - pc.trustedParentCount)
+	shard := &pc.idx2pub[li&pubkeyCacheShardMask]
+	pos := li >> pubkeyCacheShardBits
+	shard.rwLock.RLock()
+	defer shard.rwLock.RUnlock()
+	if pos >= uint64(len(shard.pubs)) {
+		return nil, false
 	}
+	return shard.pubs[pos], true
 }
 
 // Get the pubkey of a validator index.
@@ -59,17 +133,8 @@ func EmptyPubkeyCache() *PubkeyCache {
 // It merely means that this is a known pubkey for that particular validator
 // (could be in a later part of a forked version of the state).
 func (pc *PubkeyCache) Pubkey(index ValidatorIndex) (pub *CachedPubkey, ok bool) {
-	pc.rwLock.RLock()
-	defer pc.rwLock.RUnlock()
-	return pc.unsafePubkey(index)
-}
-
-func (pc *PubkeyCache) unsafePubkey(index ValidatorIndex) (pub *CachedPubkey, ok bool) {
 	if index >= pc.trustedParentCount {
-		if index >= pc.trustedParentCount+ValidatorIndex(len(pc.idx2pub)) {
-			return nil, false
-		}
-		return &pc.idx2pub[index-pc.trustedParentCount], true
+		return pc.ownPubkey(index)
 	} else if pc.parent != nil {
 		return pc.parent.Pubkey(index)
 	} else {
@@ -82,13 +147,10 @@ func (pc *PubkeyCache) unsafePubkey(index ValidatorIndex) (pub *CachedPubkey, ok
 // It merely means that this is a known pubkey for that particular validator
 // (could be in a later part of a forked version of the state).
 func (pc *PubkeyCache) ValidatorIndex(pubkey BLSPubkey) (index ValidatorIndex, ok bool) {
-	pc.rwLock.RLock()
-	defer pc.rwLock.RUnlock()
-	return pc.unsafeValidatorIndex(pubkey)
-}
-
-func (pc *PubkeyCache) unsafeValidatorIndex(pubkey BLSPubkey) (index ValidatorIndex, ok bool) {
-	index, ok = pc.pub2idx[pubkey]
+	shard := &pc.pub2idx[pubkeyShard(&pubkey)]
+	shard.rwLock.RLock()
+	index, ok = shard.pub2idx[pubkey]
+	shard.rwLock.RUnlock()
 	if !ok && pc.parent != nil {
 		return pc.parent.ValidatorIndex(pubkey)
 	}
@@ -104,26 +166,16 @@ func (pc *PubkeyCache) AddValidator(index ValidatorIndex, pub BLSPubkey) (*Pubke
 	if indexExists {
 		if existingIndex != index {
 			// conflict detected! Deposit log fork!
-			forkedPc := &PubkeyCache{
-				parent: pc,
-				// fork out the existing index, only trust the history
-				trustedParentCount: existingIndex,
-				pub2idx:            make(map[BLSPubkey]ValidatorIndex),
-				idx2pub:            make([]CachedPubkey, 0),
-			}
+			// fork out the existing index, only trust the history
+			forkedPc := newPubkeyCache(pc, existingIndex)
 			// Do not have to unlock this cache (parent of forkedPc) early, as the forkedPc is guaranteed to handle it.
 			return forkedPc.AddValidator(index, pub)
 		}
 		if pubkeyExists {
 			if existingPubkey.Compressed != pub {
 				// conflict detected! Deposit log fork!
-				forkedPc := &PubkeyCache{
-					parent: pc,
-					// fork out the existing index, only trust the history
-					trustedParentCount: index,
-					pub2idx:            make(map[BLSPubkey]ValidatorIndex),
-					idx2pub:            make([]CachedPubkey, 0),
-				}
+				// fork out the existing index, only trust the history
+				forkedPc := newPubkeyCache(pc, index)
 				// Do not have to unlock this cache (parent of forkedPc) early, as the forkedPc is guaranteed to handle it.
 				return forkedPc.AddValidator(index, pub)
 			}
@@ -134,24 +186,70 @@ func (pc *PubkeyCache) AddValidator(index ValidatorIndex, pub BLSPubkey) (*Pubke
 	if pubkeyExists {
 		if existingPubkey.Compressed != pub {
 			// conflict detected! Deposit log fork!
-			forkedPc := &PubkeyCache{
-				parent: pc,
-				// fork out the existing index, only trust the history
-				trustedParentCount: index,
-				pub2idx:            make(map[BLSPubkey]ValidatorIndex),
-				idx2pub:            make([]CachedPubkey, 0),
-			}
+			// fork out the existing index, only trust the history
+			forkedPc := newPubkeyCache(pc, index)
 			// Do not have to unlock this cache (parent of forkedPc) early, as the forkedPc is guaranteed to handle it.
 			return forkedPc.AddValidator(index, pub)
 		}
 	}
-	pc.rwLock.Lock()
-	defer pc.rwLock.Unlock()
-	if expected := pc.trustedParentCount + ValidatorIndex(len(pc.idx2pub)); index != expected {
+	pc.appendLock.Lock()
+	defer pc.appendLock.Unlock()
+	if expected := pc.nextIndex(); index != expected {
 		// index is unknown, but too far ahead of cache; in between indices are missing.
 		return nil, fmt.Errorf("AddValidator is incorrect, missing earlier index. got: (%d, %x), but currently expecting %d next", index, pub, expected)
 	}
-	pc.idx2pub = append(pc.idx2pub, CachedPubkey{Compressed: pub})
-	pc.pub2idx[pub] = index
+	pc.appendUnsafe(index, &CachedPubkey{Compressed: pub})
 	return pc, nil
 }
+
+// AddPubkeys validates and decompresses the pubkeys in bulk, and then appends them to the cache,
+// starting at the next validator index. Like AddValidator, a forked cache is returned if there is a conflict.
+// If any pubkey is invalid, none of the pubkeys are added.
+func (pc *PubkeyCache) AddPubkeys(pubs []BLSPubkey) (*PubkeyCache, error) {
+	decompressed, err := DecompressPubkeys(context.Background(), pubs, 0)
+	if err != nil {
+		return nil, err
+	}
+	index := pc.nextIndex()
+	out := pc
+	for i, pub := range pubs {
+		out, err = out.AddValidator(index, pub)
+		if err != nil {
+			return nil, err
+		}
+		out.setDecompressed(index, decompressed[i])
+		index++
+	}
+	return out, nil
+}
+
+func (pc *PubkeyCache) setDecompressed(index ValidatorIndex, pub *blsu.Pubkey) {
+	if p, ok := pc.ownPubkey(index); ok && p.loaded() == nil {
+		p.store(pub)
+	}
+}
+
+// WarmPubkeyCache decompresses all pubkeys in the cache (and its parents) that were not decompressed yet,
+// with a pool of workers, to avoid decompressing them one by one on first use.
+// If parallelism <= 0, a worker per CPU is used.
+func WarmPubkeyCache(ctx context.Context, cache *PubkeyCache, parallelism int) error {
+	for pc := cache; pc != nil; pc = pc.parent {
+		var indices []ValidatorIndex
+		var pubs []BLSPubkey
+		end := pc.nextIndex()
+		for index := pc.trustedParentCount; index < end; index++ {
+			if p, ok := pc.ownPubkey(index); ok && p.loaded() == nil {
+				indices = append(indices, index)
+				pubs = append(pubs, p.Compressed)
+			}
+		}
+		decompressed, err := DecompressPubkeys(ctx, pubs, parallelism)
+		if err != nil {
+			return err
+		}
+		for i, index := range indices {
+			pc.setDecompressed(index, decompressed[i])
+		}
+	}
+	return nil
+}
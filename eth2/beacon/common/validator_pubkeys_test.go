@@ -0,0 +1,186 @@
+package common
+
+import (
+	"context"
+	"encoding/binary"
+	"fmt"
+	"testing"
+
+	blsu "github.com/protolambda/bls12-381-util"
+)
+
+func testPubkeys(t *testing.T, count int) []BLSPubkey {
+	out := make([]BLSPubkey, 0, count)
+	for i := 0; i < count; i++ {
+		var data [32]byte
+		binary.BigEndian.PutUint64(data[24:], uint64(i)+1)
+		var sk blsu.SecretKey
+		if err := sk.Deserialize(&data); err != nil {
+			t.Fatal(err)
+		}
+		pub, err := blsu.SkToPk(&sk)
+		if err != nil {
+			t.Fatal(err)
+		}
+		out = append(out, pub.Serialize())
+	}
+	return out
+}
+
+func TestPubkeyCacheAddPubkeys(t *testing.T) {
+	pubs := testPubkeys(t, 20)
+	pc, err := EmptyPubkeyCache().AddPubkeys(pubs[:10])
+	if err != nil {
+		t.Fatal(err)
+	}
+	pc, err = pc.AddPubkeys(pubs[10:])
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, pub := range pubs {
+		cached, ok := pc.Pubkey(ValidatorIndex(i))
+		if !ok {
+			t.Fatalf("missing pubkey %d", i)
+		}
+		if cached.Compressed != pub || cached.loaded() == nil {
+			t.Fatalf("pubkey %d is not cached correctly", i)
+		}
+		if index, ok := pc.ValidatorIndex(pub); !ok || index != ValidatorIndex(i) {
+			t.Fatalf("pubkey %d has index %d", i, index)
+		}
+	}
+
+	invalid := append(testPubkeys(t, 2), BLSPubkey{0xff})
+	if _, err := EmptyPubkeyCache().AddPubkeys(invalid); err == nil {
+		t.Fatal("expected invalid pubkey error")
+	}
+}
+
+func TestWarmPubkeyCache(t *testing.T) {
+	pc := EmptyPubkeyCache()
+	var err error
+	for i, pub := range testPubkeys(t, 50) {
+		if pc, err = pc.AddValidator(ValidatorIndex(i), pub); err != nil {
+			t.Fatal(err)
+		}
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := WarmPubkeyCache(ctx, pc, 4); err == nil {
+		t.Fatal("expected canceled context error")
+	}
+	if err := WarmPubkeyCache(context.Background(), pc, 4); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 50; i++ {
+		cached, _ := pc.Pubkey(ValidatorIndex(i))
+		if cached.loaded() == nil {
+			t.Fatalf("pubkey %d was not decompressed", i)
+		}
+	}
+}
+
+func testFakePubkey(i uint64) (pub BLSPubkey) {
+	binary.LittleEndian.PutUint64(pub[0:8], i)
+	binary.LittleEndian.PutUint64(pub[40:48], i*0x9e3779b97f4a7c15)
+	return
+}
+
+func TestPubkeyCacheConcurrentAppendLookup(t *testing.T) {
+	const count = 2000
+	pc := EmptyPubkeyCache()
+	done := make(chan struct{})
+	errs := make(chan error, 4)
+	for w := 0; w < 4; w++ {
+		go func() {
+			for {
+				select {
+				case <-done:
+					errs <- nil
+					return
+				default:
+				}
+				next := uint64(pc.nextIndex())
+				for i := uint64(0); i < next; i++ {
+					pub, ok := pc.Pubkey(ValidatorIndex(i))
+					if !ok {
+						errs <- fmt.Errorf("missing pubkey %d", i)
+						return
+					}
+					if pub.Compressed != testFakePubkey(i) {
+						errs <- fmt.Errorf("wrong pubkey %d", i)
+						return
+					}
+				}
+				if next > 0 {
+					last := next - 1
+					// the index lookup is added after the pubkey lookup, it may not be visible yet, but may not be wrong.
+					if index, ok := pc.ValidatorIndex(testFakePubkey(last)); ok && index != ValidatorIndex(last) {
+						errs <- fmt.Errorf("wrong index %d for pubkey %d", index, last)
+						return
+					}
+				}
+			}
+		}()
+	}
+	for i := uint64(0); i < count; i++ {
+		out, err := pc.AddValidator(ValidatorIndex(i), testFakePubkey(i))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if out != pc {
+			t.Fatal("unexpected fork")
+		}
+	}
+	close(done)
+	for w := 0; w < 4; w++ {
+		if err := <-errs; err != nil {
+			t.Fatal(err)
+		}
+	}
+	for i := uint64(0); i < count; i++ {
+		if index, ok := pc.ValidatorIndex(testFakePubkey(i)); !ok || index != ValidatorIndex(i) {
+			t.Fatalf("pubkey %d has index %d", i, index)
+		}
+	}
+	if _, ok := pc.Pubkey(count); ok {
+		t.Fatal("unexpected pubkey")
+	}
+}
+
+func TestPubkeyCacheFork(t *testing.T) {
+	pc := EmptyPubkeyCache()
+	var err error
+	for i := uint64(0); i < 100; i++ {
+		if pc, err = pc.AddValidator(ValidatorIndex(i), testFakePubkey(i)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// adding a known validator again is a no-op
+	if out, err := pc.AddValidator(42, testFakePubkey(42)); err != nil || out != pc {
+		t.Fatal("expected no-op")
+	}
+	if _, err := pc.AddValidator(101, testFakePubkey(101)); err == nil {
+		t.Fatal("expected missing index error")
+	}
+	// a different pubkey at a known index forks the cache
+	forked, err := pc.AddValidator(60, testFakePubkey(1000))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if forked == pc {
+		t.Fatal("expected fork")
+	}
+	if pub, ok := forked.Pubkey(60); !ok || pub.Compressed != testFakePubkey(1000) {
+		t.Fatal("expected new pubkey in fork")
+	}
+	if pub, ok := forked.Pubkey(59); !ok || pub.Compressed != testFakePubkey(59) {
+		t.Fatal("expected parent pubkey in fork")
+	}
+	if _, ok := forked.Pubkey(61); ok {
+		t.Fatal("expected forked out pubkey to be unknown")
+	}
+	if pub, ok := pc.Pubkey(60); !ok || pub.Compressed != testFakePubkey(60) {
+		t.Fatal("expected original pubkey in parent")
+	}
+}
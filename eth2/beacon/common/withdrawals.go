@@ -172,6 +172,10 @@ func WithdrawalsType(spec *Spec) ListTypeDef {
 
 type Withdrawals []Withdrawal
 
+func (li Withdrawals) MarshalJSON() ([]byte, error) {
+	return MarshalJSONList(len(li), []Withdrawal(li))
+}
+
 func (ws *Withdrawals) Deserialize(spec *Spec, dr *codec.DecodingReader) error {
 	return dr.List(func() codec.Deserializable {
 		i := len(*ws)
@@ -371,6 +375,10 @@ func BlockSignedBLSToExecutionChangesType(spec *Spec) ListTypeDef {
 
 type SignedBLSToExecutionChanges []SignedBLSToExecutionChange
 
+func (li SignedBLSToExecutionChanges) MarshalJSON() ([]byte, error) {
+	return MarshalJSONList(len(li), []SignedBLSToExecutionChange(li))
+}
+
 func (li *SignedBLSToExecutionChanges) Deserialize(spec *Spec, dr *codec.DecodingReader) error {
 	return dr.List(func() codec.Deserializable {
 		i := len(*li)
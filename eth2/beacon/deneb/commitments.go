@@ -14,6 +14,10 @@ import (
 
 type KZGCommitments []common.KZGCommitment
 
+func (li KZGCommitments) MarshalJSON() ([]byte, error) {
+	return common.MarshalJSONList(len(li), []common.KZGCommitment(li))
+}
+
 func (li *KZGCommitments) Deserialize(spec *common.Spec, dr *codec.DecodingReader) error {
 	return dr.List(func() codec.Deserializable {
 		i := len(*li)
@@ -77,5 +77,5 @@ func ProcessExecutionPayload(ctx context.Context, spec *common.Spec, state Execu
 			executionPayload.BlockHash, executionPayload.BlockNumber)
 	}
 
-	return state.SetLatestExecutionPayloadHeader(executionPayload.Header(spec))
+	return state.SetLatestExecutionPayloadHeader(spec, executionPayload.Header(spec))
 }
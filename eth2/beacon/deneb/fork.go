@@ -150,7 +150,7 @@ func UpgradeToDeneb(spec *common.Spec, epc *common.EpochsContext, pre *capella.B
 		return nil, err
 	}
 
-	return AsBeaconStateView(BeaconStateType(spec).FromFields(
+	post, err := AsBeaconStateView(BeaconStateType(spec).FromFields(
 		(*view.Uint64View)(&genesisTime),
 		(*view.RootView)(&genesisValidatorsRoot),
 		(*view.Uint64View)(&slot),
@@ -175,9 +175,15 @@ func UpgradeToDeneb(spec *common.Spec, epc *common.EpochsContext, pre *capella.B
 		inactivityScores,
 		currentSyncCommitteeView,
 		nextSyncCommitteeView,
-		updatedExecutionPayloadHeader.View(),
+		updatedExecutionPayloadHeader.View(spec),
 		(*view.Uint64View)(&nextWithdrawalIndex),
 		(*view.Uint64View)(&nextWithdrawalValidatorIndex),
 		nextHistoricalSummaries.(*capella.HistoricalSummariesView),
 	))
+	if err != nil {
+		return nil, err
+	}
+	// the participation is carried over as-is, and so are the tallies of it
+	post.tallies = pre.ParticipationTallies().Clone()
+	return post, nil
 }
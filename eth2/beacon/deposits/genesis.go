@@ -0,0 +1,61 @@
+package deposits
+
+import (
+	"crypto/sha256"
+	"fmt"
+
+	blsu "github.com/protolambda/bls12-381-util"
+	"github.com/protolambda/ztyp/tree"
+
+	"github.com/protolambda/zrnt/eth2/beacon/common"
+)
+
+// SignDepositData returns the deposit data of the secret key, with BLS withdrawal credentials of the pubkey,
+// signed in the fork-agnostic deposit domain of the spec.
+func SignDepositData(spec *common.Spec, sk *blsu.SecretKey, amount common.Gwei) (*common.DepositData, error) {
+	pub, err := blsu.SkToPk(sk)
+	if err != nil {
+		return nil, err
+	}
+	data := &common.DepositData{Pubkey: pub.Serialize(), Amount: amount}
+	h := sha256.Sum256(data.Pubkey[:])
+	data.WithdrawalCredentials[0] = common.BLS_WITHDRAWAL_PREFIX
+	copy(data.WithdrawalCredentials[1:], h[1:])
+	dom := common.ComputeDomain(common.DOMAIN_DEPOSIT, spec.GENESIS_FORK_VERSION, common.Root{})
+	msg := common.ComputeSigningRoot(data.MessageRoot(), dom)
+	data.Signature = blsu.Sign(sk, msg[:]).Serialize()
+	return data, nil
+}
+
+// BuildGenesisDeposits returns a signed deposit of the amount for every secret key, with its proof.
+// Like at genesis, the proof of every deposit is against the deposit root that includes the deposit
+// and all deposits before it, but not the deposits after it. The tree of all deposits is returned too.
+func BuildGenesisDeposits(spec *common.Spec, keys [][]byte, amount common.Gwei) ([]common.Deposit, *Tree, error) {
+	t := NewTree()
+	out := make([]common.Deposit, 0, len(keys))
+	for i, key := range keys {
+		if len(key) != 32 {
+			return nil, nil, fmt.Errorf("secret key %d has %d bytes, expected 32", i, len(key))
+		}
+		var raw [32]byte
+		copy(raw[:], key)
+		var sk blsu.SecretKey
+		if err := sk.Deserialize(&raw); err != nil {
+			return nil, nil, fmt.Errorf("invalid secret key %d: %v", i, err)
+		}
+		data, err := SignDepositData(spec, &sk, amount)
+		if err != nil {
+			return nil, nil, err
+		}
+		index, err := t.InsertRoot(data.HashTreeRoot(tree.GetHashFn()))
+		if err != nil {
+			return nil, nil, err
+		}
+		proof, err := t.Proof(index)
+		if err != nil {
+			return nil, nil, err
+		}
+		out = append(out, common.Deposit{Proof: proof, Data: *data})
+	}
+	return out, t, nil
+}
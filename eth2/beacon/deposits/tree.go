@@ -0,0 +1,96 @@
+// Package deposits builds deposits with valid proofs, like the deposit contract, for tests and testnet genesis states.
+package deposits
+
+import (
+	"encoding/binary"
+	"fmt"
+
+	"github.com/protolambda/ztyp/tree"
+
+	"github.com/protolambda/zrnt/eth2/beacon/common"
+)
+
+const depth = common.DEPOSIT_CONTRACT_TREE_DEPTH
+
+// Tree is the incremental Merkle tree of the deposit contract: the deposit data roots are the leaves
+// of a sparse tree of depth 32, and the root is mixed in with the number of deposits.
+// All nodes are kept, to prove any deposit against the current root.
+type Tree struct {
+	// nodes by level, level 0 are the leaves. The missing right-most nodes are zero hashes.
+	levels [depth + 1][]common.Root
+}
+
+func NewTree() *Tree {
+	return &Tree{}
+}
+
+// Count returns the number of deposits in the tree.
+func (t *Tree) Count() uint64 {
+	return uint64(len(t.levels[0]))
+}
+
+// Insert appends the deposit data to the tree, and returns its index.
+func (t *Tree) Insert(data *common.DepositData) (uint64, error) {
+	return t.InsertRoot(data.HashTreeRoot(tree.GetHashFn()))
+}
+
+// InsertRoot appends the root of deposit data to the tree, and returns its index.
+func (t *Tree) InsertRoot(leaf common.Root) (uint64, error) {
+	index := t.Count()
+	if index >= 1<<depth {
+		return 0, fmt.Errorf("deposit tree is full, cannot insert deposit %d", index)
+	}
+	hFn := tree.GetHashFn()
+	t.levels[0] = append(t.levels[0], leaf)
+	node := leaf
+	i := index
+	for d := 0; d < depth; d++ {
+		if i%2 == 0 {
+			node = hFn(node, tree.ZeroHashes[d])
+		} else {
+			node = hFn(t.levels[d][i-1], node)
+		}
+		i /= 2
+		if i < uint64(len(t.levels[d+1])) {
+			t.levels[d+1][i] = node
+		} else {
+			t.levels[d+1] = append(t.levels[d+1], node)
+		}
+	}
+	return index, nil
+}
+
+// Root returns the deposit root, as stored in the eth1 data of the state.
+func (t *Tree) Root() common.Root {
+	root := tree.ZeroHashes[depth]
+	if t.Count() > 0 {
+		root = t.levels[depth][0]
+	}
+	return tree.GetHashFn()(root, t.countNode())
+}
+
+// countNode is the length mix-in of the root.
+func (t *Tree) countNode() (out common.Root) {
+	binary.LittleEndian.PutUint64(out[:8], t.Count())
+	return
+}
+
+// Proof returns the branch of the deposit at the index, against the current root.
+// The last element is the length mix-in, as verified by the deposit processing.
+func (t *Tree) Proof(index uint64) (out common.DepositProof, err error) {
+	if index >= t.Count() {
+		return out, fmt.Errorf("deposit %d is not in the tree of %d deposits", index, t.Count())
+	}
+	i := index
+	for d := 0; d < depth; d++ {
+		sibling := i ^ 1
+		if sibling < uint64(len(t.levels[d])) {
+			out[d] = t.levels[d][sibling]
+		} else {
+			out[d] = tree.ZeroHashes[d]
+		}
+		i /= 2
+	}
+	out[depth] = t.countNode()
+	return out, nil
+}
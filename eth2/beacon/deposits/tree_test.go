@@ -0,0 +1,114 @@
+package deposits
+
+import (
+	"testing"
+
+	"github.com/protolambda/ztyp/tree"
+	"github.com/protolambda/ztyp/view"
+
+	"github.com/protolambda/zrnt/eth2/beacon/common"
+	"github.com/protolambda/zrnt/eth2/beacon/phase0"
+	"github.com/protolambda/zrnt/eth2/beacon/testutil"
+	"github.com/protolambda/zrnt/eth2/configs"
+	"github.com/protolambda/zrnt/eth2/util/merkle"
+)
+
+func TestTreeRoot(t *testing.T) {
+	dt := NewTree()
+	roots := phase0.NewDepositRootsView()
+	hFn := tree.GetHashFn()
+	for i := 0; i <= 9; i++ {
+		if got, expected := dt.Root(), roots.HashTreeRoot(hFn); got != expected {
+			t.Fatalf("%d deposits: expected root %s, got %s", i, expected, got)
+		}
+		for j := uint64(0); j < dt.Count(); j++ {
+			proof, err := dt.Proof(j)
+			if err != nil {
+				t.Fatal(err)
+			}
+			leaf, _ := roots.Get(j)
+			if !merkle.VerifyMerkleBranch(leaf.HashTreeRoot(hFn), proof[:], common.DEPOSIT_CONTRACT_TREE_DEPTH+1, j, dt.Root()) {
+				t.Fatalf("%d deposits: invalid proof of deposit %d", i, j)
+			}
+		}
+		leaf := view.RootView{byte(i), 0xaa}
+		if _, err := dt.InsertRoot(common.Root(leaf)); err != nil {
+			t.Fatal(err)
+		}
+		if err := roots.Append(&leaf); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := dt.Proof(dt.Count()); err == nil {
+		t.Fatal("expected error for proof of missing deposit")
+	}
+}
+
+func interopKeys(from uint64, to uint64) [][]byte {
+	var keys [][]byte
+	for i := from; i < to; i++ {
+		raw := testutil.InteropKey(common.ValidatorIndex(i)).Serialize()
+		keys = append(keys, raw[:])
+	}
+	return keys
+}
+
+// Proofs of the generated deposits are verified by the real deposit processing, at genesis and in blocks.
+func TestBuildGenesisDeposits(t *testing.T) {
+	spec := configs.Minimal
+	deps, dt, err := BuildGenesisDeposits(spec, interopKeys(0, 64), spec.MAX_EFFECTIVE_BALANCE)
+	if err != nil {
+		t.Fatal(err)
+	}
+	state, epc, err := phase0.GenesisFromEth1(spec, common.Root{0x42}, spec.MIN_GENESIS_TIME, deps, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if valid, err := phase0.IsValidGenesisState(spec, state); err != nil || !valid {
+		t.Fatalf("expected valid genesis state, got %v (%v)", valid, err)
+	}
+	eth1Data, err := state.Eth1Data()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if eth1Data.DepositRoot != dt.Root() {
+		t.Fatalf("expected deposit root %s, got %s", dt.Root(), eth1Data.DepositRoot)
+	}
+
+	// deposits after genesis, proven against the root of all deposits
+	more, _, err := BuildGenesisDeposits(spec, interopKeys(64, 68), spec.MAX_EFFECTIVE_BALANCE)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := range more {
+		if _, err := dt.Insert(&more[i].Data); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := state.SetEth1Data(common.Eth1Data{DepositRoot: dt.Root(), DepositCount: common.DepositIndex(dt.Count())}); err != nil {
+		t.Fatal(err)
+	}
+	for i := range more {
+		dep := common.Deposit{Data: more[i].Data}
+		if dep.Proof, err = dt.Proof(uint64(64 + i)); err != nil {
+			t.Fatal(err)
+		}
+		if i == 1 {
+			bad := dep
+			bad.Proof[3][0] ^= 1
+			if err := phase0.ProcessDeposit(spec, epc, nil, state, &bad, false); err == nil {
+				t.Fatal("expected invalid proof")
+			}
+		}
+		if err := phase0.ProcessDeposit(spec, epc, nil, state, &dep, false); err != nil {
+			t.Fatal(err)
+		}
+	}
+	vals, err := state.Validators()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if count, err := vals.ValidatorCount(); err != nil || count != 68 {
+		t.Fatalf("expected 68 validators, got %d (%v)", count, err)
+	}
+}
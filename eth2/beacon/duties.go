@@ -0,0 +1,128 @@
+package beacon
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/protolambda/zrnt/eth2/beacon/common"
+)
+
+// AttesterDuty is the committee assignment of a validator in an epoch.
+type AttesterDuty struct {
+	ValidatorIndex common.ValidatorIndex
+	Slot           common.Slot
+	CommitteeIndex common.CommitteeIndex
+	// Position of the validator in the committee
+	CommitteePosition uint64
+	CommitteeLength   uint64
+	// Number of committees at the slot, to compute the attestation subnet of the committee
+	CommitteesAtSlot uint64
+}
+
+// AttesterDuties returns the duties of the given validators in the epoch, which must be the previous, current
+// or next epoch of the context. The committees are walked once for all validators.
+// The duties are ordered like the indices. Validators that are not active in the epoch have no duty.
+func AttesterDuties(ctx context.Context, epc *common.EpochsContext, state common.BeaconState,
+	epoch common.Epoch, indices []common.ValidatorIndex) ([]AttesterDuty, error) {
+	vals, err := state.Validators()
+	if err != nil {
+		return nil, err
+	}
+	count, err := vals.ValidatorCount()
+	if err != nil {
+		return nil, err
+	}
+	wanted := make(map[common.ValidatorIndex]*AttesterDuty, len(indices))
+	for _, i := range indices {
+		if uint64(i) >= count {
+			return nil, fmt.Errorf("unknown validator index %d, registry has %d validators", i, count)
+		}
+		wanted[i] = nil
+	}
+	shuf, err := epc.Shuffling(epoch)
+	if err != nil {
+		return nil, err
+	}
+	start, err := epc.Spec.EpochStartSlot(epoch)
+	if err != nil {
+		return nil, err
+	}
+	found := 0
+	for s, slotComms := range shuf.Committees {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		for c, committee := range slotComms {
+			for p, i := range committee {
+				if duty, ok := wanted[i]; !ok || duty != nil {
+					continue
+				}
+				wanted[i] = &AttesterDuty{
+					ValidatorIndex:    i,
+					Slot:              start + common.Slot(s),
+					CommitteeIndex:    common.CommitteeIndex(c),
+					CommitteePosition: uint64(p),
+					CommitteeLength:   uint64(len(committee)),
+					CommitteesAtSlot:  uint64(len(slotComms)),
+				}
+				found++
+			}
+		}
+		if found == len(wanted) {
+			break
+		}
+	}
+	out := make([]AttesterDuty, 0, len(indices))
+	for _, i := range indices {
+		if duty := wanted[i]; duty != nil {
+			out = append(out, *duty)
+		}
+	}
+	return out, nil
+}
+
+// CanonicalAttesterDuties returns the attester duties of the validators in the epoch of the canonical chain.
+// Duties are known up to one epoch after the epoch of the head. The duties of the next epoch can still change
+// if a reorg changes the head to another branch.
+func CanonicalAttesterDuties(ctx context.Context, chain Chain, epoch common.Epoch, indices []common.ValidatorIndex) ([]AttesterDuty, error) {
+	head, err := chain.Head()
+	if err != nil {
+		return nil, err
+	}
+	entry := head
+	epc, err := head.EpochsContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	headEpoch := epc.Spec.SlotToEpoch(head.Step().Slot())
+	if epoch > headEpoch+1 {
+		return nil, fmt.Errorf("epoch %d is too far ahead of the head epoch %d", epoch, headEpoch)
+	}
+	if epoch < headEpoch {
+		// the last canonical entry of the epoch has the shuffling of the epoch
+		start, err := epc.Spec.EpochStartSlot(epoch)
+		if err != nil {
+			return nil, err
+		}
+		iter, err := chain.Iter()
+		if err != nil {
+			return nil, err
+		}
+		entries, err := IterRange(iter, start, start+epc.Spec.SLOTS_PER_EPOCH, false)
+		if err != nil {
+			return nil, err
+		}
+		if len(entries) == 0 {
+			return nil, fmt.Errorf("no canonical entries in epoch %d", epoch)
+		}
+		entry = entries[len(entries)-1]
+		if epc, err = entry.EpochsContext(ctx); err != nil {
+			return nil, err
+		}
+	}
+	state, err := entry.State(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return AttesterDuties(ctx, epc, state, epoch, indices)
+}
@@ -0,0 +1,162 @@
+package beacon
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/protolambda/zrnt/eth2/beacon/common"
+	"github.com/protolambda/zrnt/eth2/configs"
+)
+
+// bruteForceDuties looks up every committee of the epoch, to find the duties of all validators.
+func bruteForceDuties(t *testing.T, epc *common.EpochsContext, epoch common.Epoch) map[common.ValidatorIndex]AttesterDuty {
+	out := make(map[common.ValidatorIndex]AttesterDuty)
+	start, _ := epc.Spec.EpochStartSlot(epoch)
+	count, err := epc.GetCommitteeCountPerSlot(epoch)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for slot := start; slot < start+epc.Spec.SLOTS_PER_EPOCH; slot++ {
+		for c := common.CommitteeIndex(0); c < common.CommitteeIndex(count); c++ {
+			committee, err := epc.GetBeaconCommittee(slot, c)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for p, i := range committee {
+				out[i] = AttesterDuty{
+					ValidatorIndex:    i,
+					Slot:              slot,
+					CommitteeIndex:    c,
+					CommitteePosition: uint64(p),
+					CommitteeLength:   uint64(len(committee)),
+					CommitteesAtSlot:  count,
+				}
+			}
+		}
+	}
+	return out
+}
+
+func checkDuties(t *testing.T, epc *common.EpochsContext, epoch common.Epoch, indices []common.ValidatorIndex, duties []AttesterDuty) {
+	expected := bruteForceDuties(t, epc, epoch)
+	if len(duties) != len(indices) {
+		t.Fatalf("epoch %d: expected %d duties, got %d", epoch, len(indices), len(duties))
+	}
+	for j, i := range indices {
+		if duties[j] != expected[i] {
+			t.Fatalf("epoch %d: validator %d: expected duty %+v, got %+v", epoch, i, expected[i], duties[j])
+		}
+	}
+}
+
+func TestAttesterDuties(t *testing.T) {
+	spec := configs.Minimal
+	ctx := context.Background()
+	state, epc := testGenesis(t, spec)
+	if err := common.ProcessSlots(ctx, spec, epc, state, spec.SLOTS_PER_EPOCH*2+3); err != nil {
+		t.Fatal(err)
+	}
+	indices := []common.ValidatorIndex{63, 0, 5, 17, 5}
+	for epoch := common.Epoch(1); epoch <= 3; epoch++ {
+		duties, err := AttesterDuties(ctx, epc, state, epoch, indices)
+		if err != nil {
+			t.Fatal(err)
+		}
+		checkDuties(t, epc, epoch, indices, duties)
+	}
+	if _, err := AttesterDuties(ctx, epc, state, 4, indices); err == nil {
+		t.Fatal("expected error for an epoch out of range of the context")
+	}
+	if _, err := AttesterDuties(ctx, epc, state, 2, []common.ValidatorIndex{64}); err == nil {
+		t.Fatal("expected error for an unknown validator")
+	}
+}
+
+type testDutiesEntry struct {
+	ChainEntry
+	step  common.Step
+	epc   *common.EpochsContext
+	state common.BeaconState
+}
+
+func (e *testDutiesEntry) Step() common.Step {
+	return e.step
+}
+
+func (e *testDutiesEntry) EpochsContext(ctx context.Context) (*common.EpochsContext, error) {
+	return e.epc, nil
+}
+
+func (e *testDutiesEntry) State(ctx context.Context) (common.BeaconState, error) {
+	return e.state, nil
+}
+
+// testDutiesChain is a canonical chain of empty slots, one entry per slot.
+type testDutiesChain struct {
+	Chain
+	entries []ChainEntry
+}
+
+func (c *testDutiesChain) Head() (ChainEntry, error) {
+	return c.entries[len(c.entries)-1], nil
+}
+
+func (c *testDutiesChain) Iter() (ChainIter, error) {
+	return (*testDutiesIter)(c), nil
+}
+
+type testDutiesIter testDutiesChain
+
+func (it *testDutiesIter) Start() common.Step {
+	return common.AsStep(0, false)
+}
+
+func (it *testDutiesIter) End() common.Step {
+	return common.AsStep(common.Slot(len(it.entries)), false)
+}
+
+func (it *testDutiesIter) Entry(step common.Step) (ChainEntry, error) {
+	if step < it.Start() || step >= it.End() {
+		return nil, fmt.Errorf("step %s out of range", step)
+	}
+	if step.Block() {
+		return nil, nil
+	}
+	return it.entries[step.Slot()], nil
+}
+
+func TestCanonicalAttesterDuties(t *testing.T) {
+	spec := configs.Minimal
+	ctx := context.Background()
+	state, epc := testGenesis(t, spec)
+	chain := &testDutiesChain{}
+	for slot := common.Slot(0); slot <= spec.SLOTS_PER_EPOCH*2+3; slot++ {
+		if slot > 0 {
+			if err := common.ProcessSlots(ctx, spec, epc, state, slot); err != nil {
+				t.Fatal(err)
+			}
+		}
+		s, err := state.CopyState()
+		if err != nil {
+			t.Fatal(err)
+		}
+		chain.entries = append(chain.entries, &testDutiesEntry{step: common.AsStep(slot, false), epc: epc.Clone(), state: s})
+	}
+	indices := []common.ValidatorIndex{1, 2, 3, 40}
+	for epoch := common.Epoch(0); epoch <= 3; epoch++ {
+		duties, err := CanonicalAttesterDuties(ctx, chain, epoch, indices)
+		if err != nil {
+			t.Fatal(err)
+		}
+		// the context of the last slot of the epoch, or of the head
+		last := int(spec.SLOTS_PER_EPOCH)*(int(epoch)+1) - 1
+		if last >= len(chain.entries) {
+			last = len(chain.entries) - 1
+		}
+		checkDuties(t, chain.entries[last].(*testDutiesEntry).epc, epoch, indices, duties)
+	}
+	if _, err := CanonicalAttesterDuties(ctx, chain, 4, indices); err == nil {
+		t.Fatal("expected error for an epoch beyond the lookahead")
+	}
+}
@@ -14,23 +14,23 @@ import (
 
 type ForkDecoder struct {
 	Spec      *common.Spec
+	Schedule  common.ForkSchedule
 	Genesis   common.ForkDigest
 	Altair    common.ForkDigest
 	Bellatrix common.ForkDigest
 	Capella   common.ForkDigest
 	Deneb     common.ForkDigest
-	// TODO more forks
+	// digests of the forks in the schedule, by index in the schedule
+	digests []common.ForkDigest
 }
 
 func NewForkDecoder(spec *common.Spec, genesisValRoot common.Root) *ForkDecoder {
-	return &ForkDecoder{
-		Spec:      spec,
-		Genesis:   common.ComputeForkDigest(spec.GENESIS_FORK_VERSION, genesisValRoot),
-		Altair:    common.ComputeForkDigest(spec.ALTAIR_FORK_VERSION, genesisValRoot),
-		Bellatrix: common.ComputeForkDigest(spec.BELLATRIX_FORK_VERSION, genesisValRoot),
-		Capella:   common.ComputeForkDigest(spec.CAPELLA_FORK_VERSION, genesisValRoot),
-		Deneb:     common.ComputeForkDigest(spec.DENEB_FORK_VERSION, genesisValRoot),
+	d := &ForkDecoder{Spec: spec, Schedule: spec.ForkSchedule()}
+	for i := range d.Schedule {
+		d.digests = append(d.digests, d.Schedule[i].Digest(genesisValRoot))
 	}
+	d.Genesis, d.Altair, d.Bellatrix, d.Capella, d.Deneb = d.digests[0], d.digests[1], d.digests[2], d.digests[3], d.digests[4]
+	return d
 }
 
 type OpaqueBlock interface {
@@ -38,78 +38,128 @@ type OpaqueBlock interface {
 	common.EnvelopeBuilder
 }
 
+// BlockAllocator returns the allocator of the block type of the fork with the digest, scheduled or not.
 func (d *ForkDecoder) BlockAllocator(digest common.ForkDigest) (func() OpaqueBlock, error) {
-	switch digest {
-	case d.Genesis:
-		return func() OpaqueBlock { return new(phase0.SignedBeaconBlock) }, nil
-	case d.Altair:
-		return func() OpaqueBlock { return new(altair.SignedBeaconBlock) }, nil
-	case d.Bellatrix:
-		return func() OpaqueBlock { return new(bellatrix.SignedBeaconBlock) }, nil
-	case d.Capella:
-		return func() OpaqueBlock { return new(capella.SignedBeaconBlock) }, nil
-	case d.Deneb:
-		return func() OpaqueBlock { return new(deneb.SignedBeaconBlock) }, nil
-	default:
-		return nil, fmt.Errorf("unrecognized fork digest: %s", digest)
+	for i, fd := range d.digests {
+		if fd != digest {
+			continue
+		}
+		switch d.Schedule[i].Name {
+		case common.Phase0:
+			return func() OpaqueBlock { return new(phase0.SignedBeaconBlock) }, nil
+		case common.Altair:
+			return func() OpaqueBlock { return new(altair.SignedBeaconBlock) }, nil
+		case common.Bellatrix:
+			return func() OpaqueBlock { return new(bellatrix.SignedBeaconBlock) }, nil
+		case common.Capella:
+			return func() OpaqueBlock { return new(capella.SignedBeaconBlock) }, nil
+		case common.Deneb:
+			return func() OpaqueBlock { return new(deneb.SignedBeaconBlock) }, nil
+		}
 	}
+	return nil, fmt.Errorf("unrecognized fork digest: %s", digest)
 }
 
+// ForkDigest returns the digest of the fork that is active at the epoch.
 func (d *ForkDecoder) ForkDigest(epoch common.Epoch) common.ForkDigest {
-	if epoch < d.Spec.ALTAIR_FORK_EPOCH {
-		return d.Genesis
-	} else if epoch < d.Spec.BELLATRIX_FORK_EPOCH {
-		return d.Altair
-	} else if epoch < d.Spec.CAPELLA_FORK_EPOCH {
-		return d.Bellatrix
-	} else {
-		// only consider deneb if it's actually set equal or higher than capella, to ignore it if it's missing in a config.
-		if d.Spec.DENEB_FORK_EPOCH >= d.Spec.CAPELLA_FORK_EPOCH && epoch >= d.Spec.DENEB_FORK_EPOCH {
-			return d.Deneb
+	current := d.Schedule.ForkAtEpoch(epoch)
+	for i := range d.Schedule {
+		if d.Schedule[i].Name == current.Name {
+			return d.digests[i]
 		}
-		return d.Capella
 	}
+	return d.Genesis
 }
 
 type StandardUpgradeableBeaconState struct {
 	common.BeaconState
 }
 
+// ParticipationTallies returns the participation tallies of the wrapped state,
+// so changes through the wrapper are tallied in the state.
+func (s *StandardUpgradeableBeaconState) ParticipationTallies() *common.ParticipationTallies {
+	return common.StateParticipationTallies(s.BeaconState)
+}
+
+// FlatValidators returns the flat validator snapshot of the wrapped state,
+// so changes through the wrapper are patched into the snapshot of the state.
+func (s *StandardUpgradeableBeaconState) FlatValidators() *common.FlatValidatorCache {
+	return common.StateFlatValidators(s.BeaconState)
+}
+
+// StateFork returns the name of the fork of the state type.
+func StateFork(state common.BeaconState) (common.ForkName, error) {
+	switch state.(type) {
+	case *phase0.BeaconStateView:
+		return common.Phase0, nil
+	case *altair.BeaconStateView:
+		return common.Altair, nil
+	case *bellatrix.BeaconStateView:
+		return common.Bellatrix, nil
+	case *capella.BeaconStateView:
+		return common.Capella, nil
+	case *deneb.BeaconStateView:
+		return common.Deneb, nil
+	default:
+		return "", fmt.Errorf("unrecognized state type: %T", state)
+	}
+}
+
+// UpgradeMaybe upgrades the state at the start of the epoch of the next fork in the schedule.
+// Forks that are scheduled at the same epoch are all upgraded to, in order.
 func (s *StandardUpgradeableBeaconState) UpgradeMaybe(ctx context.Context, spec *common.Spec, epc *common.EpochsContext) error {
 	slot, err := s.BeaconState.Slot()
 	if err != nil {
 		return err
 	}
-	if tpre, ok := s.BeaconState.(*phase0.BeaconStateView); ok && slot == common.Slot(spec.ALTAIR_FORK_EPOCH)*spec.SLOTS_PER_EPOCH {
-		post, err := altair.UpgradeToAltair(spec, epc, tpre)
+	schedule := spec.ForkSchedule()
+	for {
+		current, err := StateFork(s.BeaconState)
 		if err != nil {
-			return fmt.Errorf("failed to upgrade phase0 to altair state: %v", err)
+			return err
+		}
+		next := schedule.After(current)
+		if next == nil || !next.Scheduled() || slot != common.Slot(next.Epoch)*spec.SLOTS_PER_EPOCH {
+			return nil
+		}
+		if err := s.upgrade(spec, epc); err != nil {
+			return fmt.Errorf("failed to upgrade %s to %s state: %v", current, next.Name, err)
+		}
+	}
+}
+
+// upgrade upgrades the state to the fork after the fork of the state.
+func (s *StandardUpgradeableBeaconState) upgrade(spec *common.Spec, epc *common.EpochsContext) error {
+	switch pre := s.BeaconState.(type) {
+	case *phase0.BeaconStateView:
+		post, err := altair.UpgradeToAltair(spec, epc, pre)
+		if err != nil {
+			return err
 		}
 		if err := epc.LoadSyncCommittees(post); err != nil {
 			return fmt.Errorf("failed to pre-compute sync committees: %v", err)
 		}
 		s.BeaconState = post
-	}
-	if tpre, ok := s.BeaconState.(*altair.BeaconStateView); ok && slot == common.Slot(spec.BELLATRIX_FORK_EPOCH)*spec.SLOTS_PER_EPOCH {
-		post, err := bellatrix.UpgradeToBellatrix(spec, epc, tpre)
+	case *altair.BeaconStateView:
+		post, err := bellatrix.UpgradeToBellatrix(spec, epc, pre)
 		if err != nil {
-			return fmt.Errorf("failed to upgrade atalir to bellatrix state: %v", err)
+			return err
 		}
 		s.BeaconState = post
-	}
-	if tpre, ok := s.BeaconState.(*bellatrix.BeaconStateView); ok && slot == common.Slot(spec.CAPELLA_FORK_EPOCH)*spec.SLOTS_PER_EPOCH {
-		post, err := capella.UpgradeToCapella(spec, epc, tpre)
+	case *bellatrix.BeaconStateView:
+		post, err := capella.UpgradeToCapella(spec, epc, pre)
 		if err != nil {
-			return fmt.Errorf("failed to upgrade bellatrix to capella state: %v", err)
+			return err
 		}
 		s.BeaconState = post
-	}
-	if tpre, ok := s.BeaconState.(*capella.BeaconStateView); ok && slot == common.Slot(spec.DENEB_FORK_EPOCH)*spec.SLOTS_PER_EPOCH {
-		post, err := deneb.UpgradeToDeneb(spec, epc, tpre)
+	case *capella.BeaconStateView:
+		post, err := deneb.UpgradeToDeneb(spec, epc, pre)
 		if err != nil {
-			return fmt.Errorf("failed to upgrade bellatrix to capella state: %v", err)
+			return err
 		}
 		s.BeaconState = post
+	default:
+		return fmt.Errorf("no upgrade from state type %T", pre)
 	}
 	return nil
 }
@@ -0,0 +1,102 @@
+package beacon
+
+import (
+	"context"
+	"math/big"
+	"testing"
+
+	kbls "github.com/kilic/bls12-381"
+	blsu "github.com/protolambda/bls12-381-util"
+
+	"github.com/protolambda/zrnt/eth2/beacon/altair"
+	"github.com/protolambda/zrnt/eth2/beacon/capella"
+	"github.com/protolambda/zrnt/eth2/beacon/common"
+	"github.com/protolambda/zrnt/eth2/beacon/phase0"
+	"github.com/protolambda/zrnt/eth2/configs"
+)
+
+func testGenesis(t *testing.T, spec *common.Spec) (*StandardUpgradeableBeaconState, *common.EpochsContext) {
+	g1 := kbls.NewG1()
+	validators := make([]phase0.KickstartValidatorData, 0, 64)
+	for i := int64(0); i < 64; i++ {
+		var pub kbls.PointG1
+		g1.MulScalarBig(&pub, g1.One(), big.NewInt(i+1))
+		validators = append(validators, phase0.KickstartValidatorData{
+			Pubkey:                common.BLSPubkey((*blsu.Pubkey)(&pub).Serialize()),
+			WithdrawalCredentials: common.Root{0xbb},
+			Balance:               spec.MAX_EFFECTIVE_BALANCE,
+		})
+	}
+	state, epc, err := phase0.KickStartState(spec, common.Root{123}, 1564000000, validators)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := &StandardUpgradeableBeaconState{BeaconState: state}
+	if err := s.UpgradeMaybe(context.Background(), spec, epc); err != nil {
+		t.Fatal(err)
+	}
+	return s, epc
+}
+
+func TestUpgradeMaybeGenesisForks(t *testing.T) {
+	spec := *configs.Minimal
+	spec.ALTAIR_FORK_EPOCH, spec.BELLATRIX_FORK_EPOCH, spec.CAPELLA_FORK_EPOCH = 0, 0, 0
+	spec.DENEB_FORK_EPOCH = common.FAR_FUTURE_EPOCH
+	state, epc := testGenesis(t, &spec)
+	if _, ok := state.BeaconState.(*capella.BeaconStateView); !ok {
+		t.Fatalf("expected capella genesis state, got %T", state.BeaconState)
+	}
+	fork, err := state.Fork()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fork.CurrentVersion != spec.CAPELLA_FORK_VERSION || fork.PreviousVersion != spec.BELLATRIX_FORK_VERSION {
+		t.Fatalf("unexpected fork: %+v", fork)
+	}
+	if err := common.ProcessSlots(context.Background(), &spec, epc, state, spec.SLOTS_PER_EPOCH*3); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := state.BeaconState.(*capella.BeaconStateView); !ok {
+		t.Fatalf("expected the disabled fork to not upgrade the state, got %T", state.BeaconState)
+	}
+}
+
+func TestUpgradeMaybeDisabledFork(t *testing.T) {
+	spec := *configs.Minimal
+	spec.ALTAIR_FORK_EPOCH = 1
+	spec.BELLATRIX_FORK_EPOCH = common.FAR_FUTURE_EPOCH
+	state, epc := testGenesis(t, &spec)
+	if _, ok := state.BeaconState.(*phase0.BeaconStateView); !ok {
+		t.Fatalf("expected phase0 genesis state, got %T", state.BeaconState)
+	}
+	if err := common.ProcessSlots(context.Background(), &spec, epc, state, spec.SLOTS_PER_EPOCH*3); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := state.BeaconState.(*altair.BeaconStateView); !ok {
+		t.Fatalf("expected altair state, got %T", state.BeaconState)
+	}
+}
+
+func TestForkDecoder(t *testing.T) {
+	spec := *configs.Minimal
+	spec.ALTAIR_FORK_EPOCH, spec.BELLATRIX_FORK_EPOCH = 0, 2
+	valRoot := common.Root{1}
+	d := NewForkDecoder(&spec, valRoot)
+	if d.ForkDigest(0) != d.Altair || d.ForkDigest(1) != d.Altair || d.ForkDigest(2) != d.Bellatrix || d.ForkDigest(100) != d.Bellatrix {
+		t.Fatal("unexpected fork digests by epoch")
+	}
+	if d.Deneb != common.ComputeForkDigest(spec.DENEB_FORK_VERSION, valRoot) {
+		t.Fatal("unexpected deneb digest")
+	}
+	// blocks of forks that are not scheduled can still be decoded
+	alloc, err := d.BlockAllocator(d.Capella)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := alloc().(*capella.SignedBeaconBlock); !ok {
+		t.Fatalf("unexpected block type %T", alloc())
+	}
+	if _, err := d.BlockAllocator(common.ForkDigest{0xff}); err == nil {
+		t.Fatal("expected unknown digest to fail")
+	}
+}
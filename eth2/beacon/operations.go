@@ -0,0 +1,48 @@
+package beacon
+
+import (
+	"fmt"
+
+	"github.com/protolambda/zrnt/eth2/beacon/altair"
+	"github.com/protolambda/zrnt/eth2/beacon/bellatrix"
+	"github.com/protolambda/zrnt/eth2/beacon/capella"
+	"github.com/protolambda/zrnt/eth2/beacon/common"
+	"github.com/protolambda/zrnt/eth2/beacon/deneb"
+	"github.com/protolambda/zrnt/eth2/beacon/phase0"
+)
+
+// EnvelopeAttestations returns the attestations included in the body of the block, regardless of the fork.
+func EnvelopeAttestations(benv *common.BeaconBlockEnvelope) (phase0.Attestations, error) {
+	switch x := benv.Body.(type) {
+	case *phase0.BeaconBlockBody:
+		return x.Attestations, nil
+	case *altair.BeaconBlockBody:
+		return x.Attestations, nil
+	case *bellatrix.BeaconBlockBody:
+		return x.Attestations, nil
+	case *capella.BeaconBlockBody:
+		return x.Attestations, nil
+	case *deneb.BeaconBlockBody:
+		return x.Attestations, nil
+	default:
+		return nil, fmt.Errorf("cannot get attestations from block, unrecognized body type: %T", x)
+	}
+}
+
+// EnvelopeSyncAggregate returns the sync aggregate included in the body of the block, or nil if the fork has none.
+func EnvelopeSyncAggregate(benv *common.BeaconBlockEnvelope) (*altair.SyncAggregate, error) {
+	switch x := benv.Body.(type) {
+	case *phase0.BeaconBlockBody:
+		return nil, nil
+	case *altair.BeaconBlockBody:
+		return &x.SyncAggregate, nil
+	case *bellatrix.BeaconBlockBody:
+		return &x.SyncAggregate, nil
+	case *capella.BeaconBlockBody:
+		return &x.SyncAggregate, nil
+	case *deneb.BeaconBlockBody:
+		return &x.SyncAggregate, nil
+	default:
+		return nil, fmt.Errorf("cannot get sync aggregate from block, unrecognized body type: %T", x)
+	}
+}
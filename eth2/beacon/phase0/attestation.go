@@ -7,6 +7,8 @@ import (
 
 	"sort"
 
+	"github.com/minio/sha256-simd"
+
 	"github.com/protolambda/zrnt/eth2/beacon/common"
 	"github.com/protolambda/ztyp/codec"
 	"github.com/protolambda/ztyp/tree"
@@ -53,6 +55,10 @@ func (a *Attestation) HashTreeRoot(spec *common.Spec, hFn tree.HashFn) common.Ro
 
 type Attestations []Attestation
 
+func (li Attestations) MarshalJSON() ([]byte, error) {
+	return common.MarshalJSONList(len(li), []Attestation(li))
+}
+
 func (a *Attestations) Deserialize(spec *common.Spec, dr *codec.DecodingReader) error {
 	return dr.List(func() codec.Deserializable {
 		i := len(*a)
@@ -88,25 +94,97 @@ func (li Attestations) HashTreeRoot(spec *common.Spec, hFn tree.HashFn) common.R
 	}, length, uint64(spec.MAX_ATTESTATIONS))
 }
 
-func ProcessAttestations(ctx context.Context, spec *common.Spec, epc *common.EpochsContext, state Phase0PendingAttestationsBeaconState, ops []Attestation) error {
+// ProcessAttestations processes the attestations of a block, verifying the signatures in parallel.
+// See ProcessAttestationsParallel.
+func ProcessAttestations(ctx context.Context, spec *common.Spec, epc *common.EpochsContext, tr *common.Transition, state Phase0PendingAttestationsBeaconState, ops []Attestation) error {
+	return ProcessAttestationsParallel(ctx, spec, epc, tr, state, ops, 0)
+}
+
+// ProcessAttestationsParallel processes the attestations in three steps:
+//  1. all attestations are checked and converted to indexed form, sequentially.
+//  2. the signatures of all attestations are verified individually, by a pool of workers.
+//     If parallelism <= 0, a worker per CPU is used. During a batched block transition,
+//     the signatures are added to the signature batch of the block instead, and skipped in a trusted transition.
+//  3. only if all attestations are valid, the state is updated with the attestations, sequentially and in order.
+//
+// The error identifies the index of the first invalid attestation.
+func ProcessAttestationsParallel(ctx context.Context, spec *common.Spec, epc *common.EpochsContext, tr *common.Transition,
+	state Phase0PendingAttestationsBeaconState, ops []Attestation, parallelism int) error {
+	indexed := make([]*IndexedAttestation, len(ops))
+	domains := make([]common.BLSDomain, len(ops))
 	for i := range ops {
 		if err := ctx.Err(); err != nil {
 			return err
 		}
-		if err := ProcessAttestation(spec, epc, state, &ops[i]); err != nil {
+		indexedAtt, err := ValidateAttestationNoSignature(spec, epc, state, &ops[i])
+		if err != nil {
+			return fmt.Errorf("attestation %d is invalid: %v", i, err)
+		}
+		dom, err := common.GetDomain(state, common.DOMAIN_BEACON_ATTESTER, indexedAtt.Data.Target.Epoch)
+		if err != nil {
+			return err
+		}
+		indexed[i] = indexedAtt
+		domains[i] = dom
+	}
+	if tr != nil && (tr.SignatureBatch != nil || tr.SkipSignatures) {
+		// the signatures are verified together with the other signatures of the block, or skipped
+		for i := range ops {
+			desc := fmt.Sprintf("attestation %d", i)
+			if err := VerifyIndexedAttestationSignature(spec, epc, tr, desc, domains[i], indexed[i]); err != nil {
+				return fmt.Errorf("attestation %d is invalid: attestation could not be verified in its indexed form: %v", i, err)
+			}
+		}
+	} else {
+		err := common.ParallelRange(ctx, len(ops), parallelism, func(i int) error {
+			if err := ValidateIndexedAttestationSignature(spec, domains[i], epc.ValidatorPubkeyCache, indexed[i]); err != nil {
+				return fmt.Errorf("attestation %d is invalid: attestation could not be verified in its indexed form: %v", i, err)
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+	}
+	tr.CountSignatures(string(common.OpAttestation), len(ops))
+	for i := range ops {
+		if err := ctx.Err(); err != nil {
 			return err
 		}
+		tr.TraceBeforeOp(state, common.OpAttestation, i)
+		err := applyAttestation(spec, epc, state, &ops[i], indexed[i])
+		tr.TraceAfterOp(state, common.OpAttestation, i, err)
+		if err != nil {
+			return fmt.Errorf("failed to apply attestation %d: %v", i, err)
+		}
 	}
 	return nil
 }
 
 func ProcessAttestation(spec *common.Spec, epc *common.EpochsContext, state Phase0PendingAttestationsBeaconState, attestation *Attestation) error {
+	indexedAtt, err := ValidateAttestationNoSignature(spec, epc, state, attestation)
+	if err != nil {
+		return err
+	}
+	dom, err := common.GetDomain(state, common.DOMAIN_BEACON_ATTESTER, indexedAtt.Data.Target.Epoch)
+	if err != nil {
+		return err
+	}
+	if err := VerifyIndexedAttestationSignature(spec, epc, nil, "attestation", dom, indexedAtt); err != nil {
+		return fmt.Errorf("attestation could not be verified in its indexed form: %v", err)
+	}
+	return applyAttestation(spec, epc, state, attestation, indexedAtt)
+}
+
+// ValidateAttestationNoSignature checks the attestation against the state, except for the signature,
+// and returns it in indexed form.
+func ValidateAttestationNoSignature(spec *common.Spec, epc *common.EpochsContext, state common.BeaconState, attestation *Attestation) (*IndexedAttestation, error) {
 	data := &attestation.Data
 
 	// Check slot
 	currentSlot, err := state.Slot()
 	if err != nil {
-		return err
+		return nil, err
 	}
 
 	currentEpoch := spec.SlotToEpoch(currentSlot)
@@ -114,58 +192,72 @@ func ProcessAttestation(spec *common.Spec, epc *common.EpochsContext, state Phas
 
 	// Check target
 	if data.Target.Epoch < previousEpoch {
-		return errors.New("attestation data is invalid, target is too far in past")
+		return nil, errors.New("attestation data is invalid, target is too far in past")
 	} else if data.Target.Epoch > currentEpoch {
-		return errors.New("attestation data is invalid, target is in future")
+		return nil, errors.New("attestation data is invalid, target is in future")
 	}
 	// And if it matches the slot
 	if data.Target.Epoch != spec.SlotToEpoch(data.Slot) {
-		return errors.New("attestation data is invalid, slot epoch does not match target epoch")
+		return nil, errors.New("attestation data is invalid, slot epoch does not match target epoch")
 	}
 
 	if !(currentSlot <= data.Slot+spec.SLOTS_PER_EPOCH) {
-		return errors.New("attestation slot is too old")
+		return nil, errors.New("attestation slot is too old")
 	}
 	if !(data.Slot+spec.MIN_ATTESTATION_INCLUSION_DELAY <= currentSlot) {
-		return errors.New("attestation is too new")
+		return nil, errors.New("attestation is too new")
 	}
 
 	// Check committee index
 	if commCount, err := epc.GetCommitteeCountPerSlot(data.Target.Epoch); err != nil {
-		return err
+		return nil, err
 	} else if uint64(data.Index) >= commCount {
-		return errors.New("attestation data is invalid, committee index out of range")
+		return nil, errors.New("attestation data is invalid, committee index out of range")
 	}
 
 	// Check source
 	if data.Target.Epoch == currentEpoch {
 		currentJustified, err := state.CurrentJustifiedCheckpoint()
 		if err != nil {
-			return err
+			return nil, err
 		}
 		if data.Source != currentJustified {
-			return errors.New("attestation source does not match current justified checkpoint")
+			return nil, errors.New("attestation source does not match current justified checkpoint")
 		}
 	} else {
 		previousJustified, err := state.PreviousJustifiedCheckpoint()
 		if err != nil {
-			return err
+			return nil, err
 		}
 		if data.Source != previousJustified {
-			return errors.New("attestation source does not match previous justified checkpoint")
+			return nil, errors.New("attestation source does not match previous justified checkpoint")
 		}
 	}
 
-	// Check signature and bitfields
+	// Check bitfields
 	committee, err := epc.GetBeaconCommittee(data.Slot, data.Index)
 	if err != nil {
-		return err
+		return nil, err
 	}
-	if indexedAtt, err := attestation.ConvertToIndexed(spec, committee); err != nil {
-		return fmt.Errorf("attestation could not be converted to an indexed attestation: %v", err)
-	} else if err := ValidateIndexedAttestation(spec, epc, state, indexedAtt); err != nil {
-		return fmt.Errorf("attestation could not be verified in its indexed form: %v", err)
+	indexedAtt, err := attestation.ConvertToIndexedWithCache(spec, epc, committee)
+	if err != nil {
+		return nil, fmt.Errorf("attestation could not be converted to an indexed attestation: %v", err)
+	}
+	if err := ValidateIndexedAttestation(spec, epc, state, indexedAtt, false); err != nil {
+		return nil, fmt.Errorf("attestation could not be verified in its indexed form: %v", err)
+	}
+	return indexedAtt, nil
+}
+
+// applyAttestation adds the already validated attestation to the state.
+func applyAttestation(spec *common.Spec, epc *common.EpochsContext, state Phase0PendingAttestationsBeaconState,
+	attestation *Attestation, indexedAtt *IndexedAttestation) error {
+	data := &attestation.Data
+	currentSlot, err := state.Slot()
+	if err != nil {
+		return err
 	}
+	currentEpoch := spec.SlotToEpoch(currentSlot)
 
 	proposerIndex, err := epc.GetBeaconProposer(currentSlot)
 	if err != nil {
@@ -197,6 +289,33 @@ func ProcessAttestation(spec *common.Spec, epc *common.EpochsContext, state Phas
 			return err
 		}
 	}
+	return tallyTargetAttesters(spec, state, indexedAtt)
+}
+
+// tallyTargetAttesters counts the attesters towards the target stake of the participation tallies of the state,
+// if the attestation is for the actual target of the epoch.
+func tallyTargetAttesters(spec *common.Spec, state common.BeaconState, indexedAtt *IndexedAttestation) error {
+	tallies := common.StateParticipationTallies(state)
+	if tallies == nil {
+		return nil
+	}
+	data := &indexedAtt.Data
+	actualTargetBlockRoot, err := common.GetBlockRoot(spec, state, data.Target.Epoch)
+	if err != nil {
+		return err
+	}
+	if data.Target.Root != actualTargetBlockRoot {
+		return nil
+	}
+	vals, err := state.Validators()
+	if err != nil {
+		return err
+	}
+	for _, vi := range indexedAtt.AttestingIndices {
+		if err := tallies.AddTargetAttester(vals, data.Target.Epoch, vi); err != nil {
+			return err
+		}
+	}
 	return nil
 }
 
@@ -224,6 +343,39 @@ func (attestation *Attestation) ConvertToIndexed(spec *common.Spec, committee []
 	}, nil
 }
 
+// ConvertToIndexedWithCache converts the attestation like ConvertToIndexed, but re-uses the attesting indices of
+// an earlier conversion of the same data and bits within the same shuffling, if the context has an IndexedAttestationCache.
+// The committee must be the committee of the attestation in the context.
+// The attesting indices may be shared with the cache, and must not be modified.
+func (attestation *Attestation) ConvertToIndexedWithCache(spec *common.Spec, epc *common.EpochsContext, committee []common.ValidatorIndex) (*IndexedAttestation, error) {
+	cache := epc.IndexedAttestationCache
+	if cache == nil {
+		return attestation.ConvertToIndexed(spec, committee)
+	}
+	shufflingID, err := epc.ShufflingID(spec.SlotToEpoch(attestation.Data.Slot))
+	if err != nil {
+		return nil, err
+	}
+	key := common.IndexedAttestationKey{
+		Shuffling:  shufflingID,
+		DataRoot:   attestation.Data.HashTreeRoot(tree.GetHashFn()),
+		BitsDigest: sha256.Sum256(attestation.AggregationBits),
+	}
+	if indices, ok := cache.Get(key); ok {
+		return &IndexedAttestation{
+			AttestingIndices: indices,
+			Data:             attestation.Data,
+			Signature:        attestation.Signature,
+		}, nil
+	}
+	indexedAtt, err := attestation.ConvertToIndexed(spec, committee)
+	if err != nil {
+		return nil, err
+	}
+	cache.Add(key, indexedAtt.AttestingIndices)
+	return indexedAtt, nil
+}
+
 func ComputeSubnetForAttestation(spec *common.Spec, committeesPerSlot uint64, slot common.Slot, committeeIndex common.CommitteeIndex) (uint64, error) {
 	maxCommitteeIndex := common.CommitteeIndex(committeesPerSlot * uint64(spec.SLOTS_PER_EPOCH))
 	if committeeIndex >= maxCommitteeIndex {
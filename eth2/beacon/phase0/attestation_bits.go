@@ -21,7 +21,22 @@ func (li AttestationBits) View(spec *common.Spec) *AttestationBitsView {
 }
 
 func (li *AttestationBits) Deserialize(spec *common.Spec, dr *codec.DecodingReader) error {
-	return dr.BitList((*[]byte)(li), uint64(spec.MAX_VALIDATORS_PER_COMMITTEE))
+	// Not using dr.BitList: its byte limit does not account for the delimit bit,
+	// and rejects full committees when the limit is a multiple of 8 bits.
+	bitLimit := uint64(spec.MAX_VALIDATORS_PER_COMMITTEE)
+	byteLen := dr.Scope()
+	if err := bitfields.BitlistCheckByteLen(byteLen, bitLimit); err != nil {
+		return err
+	}
+	if uint64(cap(*li)) < byteLen {
+		*li = make(AttestationBits, byteLen)
+	} else {
+		*li = (*li)[:byteLen]
+	}
+	if _, err := dr.Read(*li); err != nil {
+		return err
+	}
+	return bitfields.BitlistCheck(*li, bitLimit)
 }
 
 func (a AttestationBits) Serialize(spec *common.Spec, w *codec.EncodingWriter) error {
@@ -115,6 +130,22 @@ func (cb AttestationBits) Covers(other AttestationBits) (bool, error) {
 	return bitfields.Covers(cb, other)
 }
 
+// Returns true if other has any bit set to 1 that this bitfield also has set to 1
+func (cb AttestationBits) Overlaps(other AttestationBits) (bool, error) {
+	bitLen := cb.BitLen()
+	if otherLen := other.BitLen(); bitLen != otherLen {
+		return false, fmt.Errorf("bitfield length mismatch: %d <> %d", bitLen, otherLen)
+	}
+	last := len(cb) - 1
+	for i := 0; i < last; i++ {
+		if cb[i]&other[i] != 0 {
+			return true, nil
+		}
+	}
+	// ignore the delimiter bit
+	return (cb[last]&other[last])&^(1<<(bitLen%8)) != 0, nil
+}
+
 func (cb AttestationBits) OnesCount() uint64 {
 	return bitfields.BitlistOnesCount(cb)
 }
@@ -140,6 +171,13 @@ func (cb AttestationBits) SingleParticipant(committee []common.ValidatorIndex) (
 	return *found, nil
 }
 
+// NewAttestationBits creates a bitlist of the given length, with all bits set to 0.
+func NewAttestationBits(bitLen uint64) AttestationBits {
+	out := make(AttestationBits, bitLen/8+1)
+	out[bitLen/8] = 1 << (bitLen % 8)
+	return out
+}
+
 func (cb AttestationBits) Copy() AttestationBits {
 	// append won't find capacity, and thus put contents into new array, and then returns typed slice of it.
 	return append(AttestationBits(nil), cb...)
@@ -0,0 +1,124 @@
+package phase0
+
+import (
+	"context"
+	"encoding/binary"
+	"strings"
+	"testing"
+
+	blsu "github.com/protolambda/bls12-381-util"
+	"github.com/protolambda/zrnt/eth2/beacon/common"
+	"github.com/protolambda/zrnt/eth2/configs"
+	"github.com/protolambda/ztyp/tree"
+)
+
+// testFullAttestation creates an attestation with full participation of the committee,
+// signed with the test keys of testKickstartValidators (secret key of validator i is i+1).
+func testFullAttestation(t *testing.T, spec *common.Spec, epc *common.EpochsContext, state common.BeaconState,
+	slot common.Slot, index common.CommitteeIndex) Attestation {
+	committee, err := epc.GetBeaconCommittee(slot, index)
+	if err != nil {
+		t.Fatal(err)
+	}
+	currentSlot, err := state.Slot()
+	if err != nil {
+		t.Fatal(err)
+	}
+	target := spec.SlotToEpoch(slot)
+	var source common.Checkpoint
+	if target == spec.SlotToEpoch(currentSlot) {
+		source, err = state.CurrentJustifiedCheckpoint()
+	} else {
+		source, err = state.PreviousJustifiedCheckpoint()
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	targetRoot, err := common.GetBlockRoot(spec, state, target)
+	if err != nil {
+		t.Fatal(err)
+	}
+	att := Attestation{
+		AggregationBits: NewAttestationBits(uint64(len(committee))),
+		Data: AttestationData{
+			Slot:   slot,
+			Index:  index,
+			Source: source,
+			Target: common.Checkpoint{Epoch: target, Root: targetRoot},
+		},
+	}
+	var skSum uint64
+	for i, vi := range committee {
+		att.AggregationBits.SetBit(uint64(i), true)
+		skSum += uint64(vi) + 1
+	}
+	var data [32]byte
+	binary.BigEndian.PutUint64(data[24:], skSum)
+	var sk blsu.SecretKey
+	if err := sk.Deserialize(&data); err != nil {
+		t.Fatal(err)
+	}
+	dom, err := common.GetDomain(state, common.DOMAIN_BEACON_ATTESTER, target)
+	if err != nil {
+		t.Fatal(err)
+	}
+	root := common.ComputeSigningRoot(att.Data.HashTreeRoot(tree.GetHashFn()), dom)
+	att.Signature = blsu.Sign(&sk, root[:]).Serialize()
+	return att
+}
+
+func TestProcessAttestationsParallel(t *testing.T) {
+	spec := configs.Minimal
+	ctx := context.Background()
+	state, epc, err := KickStartState(spec, common.Root{123}, 1564000000, testKickstartValidators(t, 64))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := common.ProcessSlots(ctx, spec, epc, testUpgradeableState{state}, spec.SLOTS_PER_EPOCH+1); err != nil {
+		t.Fatal(err)
+	}
+	var atts []Attestation
+	for slot := common.Slot(2); slot <= spec.SLOTS_PER_EPOCH; slot++ {
+		count, err := epc.GetCommitteeCountPerSlot(spec.SlotToEpoch(slot))
+		if err != nil {
+			t.Fatal(err)
+		}
+		for index := common.CommitteeIndex(0); uint64(index) < count; index++ {
+			atts = append(atts, testFullAttestation(t, spec, epc, state, slot, index))
+		}
+	}
+
+	// a single bad signature
+	bad := make([]Attestation, len(atts))
+	copy(bad, atts)
+	bad[5].Signature = atts[4].Signature
+	pre, err := AsBeaconStateView(state.Copy())
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = ProcessAttestationsParallel(ctx, spec, epc, nil, pre, bad, 4)
+	if err == nil || !strings.Contains(err.Error(), "attestation 5 is invalid") {
+		t.Fatalf("expected attestation 5 to be invalid, got: %v", err)
+	}
+	// no state changes if any attestation is invalid
+	if pre.HashTreeRoot(tree.GetHashFn()) != state.HashTreeRoot(tree.GetHashFn()) {
+		t.Fatal("expected state to be unchanged")
+	}
+
+	// same result as serial processing
+	serial, err := AsBeaconStateView(state.Copy())
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := range atts {
+		if err := ProcessAttestation(spec, epc, serial, &atts[i]); err != nil {
+			t.Fatalf("attestation %d: %v", i, err)
+		}
+	}
+	if err := ProcessAttestationsParallel(ctx, spec, epc, nil, state, atts, 4); err != nil {
+		t.Fatal(err)
+	}
+	if state.HashTreeRoot(tree.GetHashFn()) != serial.HashTreeRoot(tree.GetHashFn()) {
+		t.Fatal("expected same state as serial processing")
+	}
+}
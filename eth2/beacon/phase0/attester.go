@@ -2,6 +2,7 @@ package phase0
 
 import (
 	"context"
+	"sync"
 
 	"github.com/protolambda/zrnt/eth2/beacon/common"
 )
@@ -59,7 +60,29 @@ type Phase0PendingAttestationsBeaconState interface {
 	CurrentEpochAttestations() (*PendingAttestationsView, error)
 }
 
-func ComputeEpochAttesterData(ctx context.Context, spec *common.Spec, epc *common.EpochsContext,
+// Attester statuses are phase0 specific, and pooled here instead of in the common epoch process scratch.
+var attesterStatusesPool sync.Pool
+
+// newAttesterStatuses allocates zeroed statuses, or re-uses them from the pool if pooled is true.
+func newAttesterStatuses(pooled bool, count uint64) []AttesterStatus {
+	if pooled {
+		if v, ok := attesterStatusesPool.Get().(*[]AttesterStatus); ok && uint64(cap(*v)) >= count {
+			out := (*v)[:count]
+			for i := range out {
+				out[i] = AttesterStatus{}
+			}
+			return out
+		}
+	}
+	return make([]AttesterStatus, count, count)
+}
+
+// releaseAttesterStatuses returns the statuses to the pool. They must not be used afterwards.
+func releaseAttesterStatuses(statuses []AttesterStatus) {
+	attesterStatusesPool.Put(&statuses)
+}
+
+func ComputeEpochAttesterData(ctx context.Context, spec *common.Spec, epc *common.EpochsContext, scratch *common.EpochProcessScratch,
 	flats []common.FlatValidator, state Phase0PendingAttestationsBeaconState) (out *EpochAttesterData, err error) {
 
 	count := common.ValidatorIndex(len(flats))
@@ -69,7 +92,7 @@ func ComputeEpochAttesterData(ctx context.Context, spec *common.Spec, epc *commo
 	out = &EpochAttesterData{
 		PrevEpoch: prevEpoch,
 		CurrEpoch: currentEpoch,
-		Statuses:  make([]AttesterStatus, count, count),
+		Statuses:  newAttesterStatuses(scratch != nil, uint64(count)),
 		Flats:     flats,
 	}
 
@@ -11,14 +11,29 @@ import (
 	. "github.com/protolambda/ztyp/view"
 )
 
-func ProcessAttesterSlashings(ctx context.Context, spec *common.Spec, epc *common.EpochsContext, state common.BeaconState, ops []AttesterSlashing) error {
+// ProcessAttesterSlashings processes the attester slashings of a block, in order.
+// Slashings may overlap, but a slashing of which all validators in both attestations were also
+// in both attestations of earlier slashings of the block is rejected with a DuplicateSlashingError,
+// before its signatures are verified.
+func ProcessAttesterSlashings(ctx context.Context, spec *common.Spec, epc *common.EpochsContext, tr *common.Transition, state common.BeaconState, ops []AttesterSlashing) error {
+	slashed := make(slashedInBlock)
 	for i := range ops {
 		if err := ctx.Err(); err != nil {
 			return err
 		}
-		if err := ProcessAttesterSlashing(spec, epc, state, &ops[i]); err != nil {
+		// unsorted indices may be missed here, but are rejected by the validation of the slashing
+		both := SlashableIndices(&ops[i].Attestation1, &ops[i].Attestation2)
+		tr.TraceBeforeOp(state, common.OpAttesterSlashing, i)
+		err := slashed.duplicate(common.OpAttesterSlashing, i, both)
+		if err == nil {
+			err = ProcessAttesterSlashing(spec, epc, tr, state, &ops[i])
+		}
+		tr.TraceAfterOp(state, common.OpAttesterSlashing, i, err)
+		if err != nil {
 			return err
 		}
+		// every validator in both attestations is slashed or not slashable after a valid slashing
+		slashed.add(i, both)
 	}
 	return nil
 }
@@ -61,6 +76,10 @@ func AttesterSlashingType(spec *common.Spec) *ContainerTypeDef {
 
 type AttesterSlashings []AttesterSlashing
 
+func (li AttesterSlashings) MarshalJSON() ([]byte, error) {
+	return common.MarshalJSONList(len(li), []AttesterSlashing(li))
+}
+
 func (a *AttesterSlashings) Deserialize(spec *common.Spec, dr *codec.DecodingReader) error {
 	return dr.List(func() codec.Deserializable {
 		i := len(*a)
@@ -96,61 +115,84 @@ func (li AttesterSlashings) HashTreeRoot(spec *common.Spec, hFn tree.HashFn) com
 	}, length, uint64(spec.MAX_ATTESTER_SLASHINGS))
 }
 
-func ProcessAttesterSlashing(spec *common.Spec, epc *common.EpochsContext, state common.BeaconState, attesterSlashing *AttesterSlashing) error {
+// ValidateAttesterSlashing checks the attester slashing against the state, without applying it.
+// The validators that would be slashed by processing the slashing are returned, this set is never empty if valid.
+func ValidateAttesterSlashing(spec *common.Spec, epc *common.EpochsContext, tr *common.Transition, state common.BeaconState, attesterSlashing *AttesterSlashing) (common.ValidatorSet, error) {
 	sa1 := &attesterSlashing.Attestation1
 	sa2 := &attesterSlashing.Attestation2
 
 	if !IsSlashableAttestationData(&sa1.Data, &sa2.Data) {
-		return errors.New("attester slashing has no valid reasoning")
+		return nil, errors.New("attester slashing has no valid reasoning")
 	}
 
-	if err := ValidateIndexedAttestation(spec, epc, state, sa1); err != nil {
-		return errors.New("attestation 1 of attester slashing cannot be verified")
+	if err := validateSlashingAttestation(spec, epc, tr, state, sa1); err != nil {
+		return nil, errors.New("attestation 1 of attester slashing cannot be verified")
 	}
-	if err := ValidateIndexedAttestation(spec, epc, state, sa2); err != nil {
-		return errors.New("attestation 2 of attester slashing cannot be verified")
+	if err := validateSlashingAttestation(spec, epc, tr, state, sa2); err != nil {
+		return nil, errors.New("attestation 2 of attester slashing cannot be verified")
 	}
 
 	currentEpoch := epc.CurrentEpoch.Epoch
 
-	// keep track of effectiveness
-	slashedAny := false
-	var errorAny error
+	flats := common.StateFlatValidators(state)
+	// the indices are sorted, as validated above
+	slashable := SlashableIndices(sa1, sa2)
+	err := slashable.Filter(func(i common.ValidatorIndex) (bool, error) {
+		validator, err := flats.Validator(state, i)
+		if err != nil {
+			return false, err
+		}
+		return validator.IsSlashable(currentEpoch), nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error during attester-slashing validators slashable check: %v", err)
+	}
+	if len(slashable) == 0 {
+		return nil, errors.New("attester slashing is not effective, hence invalid")
+	}
+	return slashable, nil
+}
+
+// validateSlashingAttestation is ValidateIndexedAttestation, with the signature verified as part of the transition.
+func validateSlashingAttestation(spec *common.Spec, epc *common.EpochsContext, tr *common.Transition,
+	state common.BeaconState, indexedAttestation *IndexedAttestation) error {
+	if err := ValidateIndexedAttestation(spec, epc, state, indexedAttestation, false); err != nil {
+		return err
+	}
+	dom, err := common.GetDomain(state, common.DOMAIN_BEACON_ATTESTER, indexedAttestation.Data.Target.Epoch)
+	if err != nil {
+		return err
+	}
+	tr.CountSignatures("indexed_attestation", 1)
+	return VerifyIndexedAttestationSignature(spec, epc, tr, "indexed attestation", dom, indexedAttestation)
+}
 
-	validators, err := state.Validators()
+func ProcessAttesterSlashing(spec *common.Spec, epc *common.EpochsContext, tr *common.Transition, state common.BeaconState, attesterSlashing *AttesterSlashing) error {
+	slashable, err := ValidateAttesterSlashing(spec, epc, tr, state, attesterSlashing)
 	if err != nil {
 		return err
 	}
 	// run slashings where applicable
-	// use ZigZagJoin for efficient intersection: the indicies are already sorted (as validated above)
-	common.ValidatorSet(sa1.AttestingIndices).ZigZagJoin(common.ValidatorSet(sa2.AttestingIndices), func(i common.ValidatorIndex) {
-		if errorAny != nil {
-			return
-		}
-		validator, err := validators.Validator(i)
-		if err != nil {
-			errorAny = err
-			return
+	for _, i := range slashable {
+		if err := SlashValidator(spec, epc, state, i, nil); err != nil {
+			return fmt.Errorf("failed to slash validator %d: %v", i, err)
 		}
-		if slashable, err := IsSlashable(validator, currentEpoch); err != nil {
-			errorAny = err
-		} else if slashable {
-			if err := SlashValidator(spec, epc, state, i, nil); err != nil {
-				errorAny = err
-			} else {
-				slashedAny = true
-			}
-		}
-	}, nil)
-	if errorAny != nil {
-		return fmt.Errorf("error during attester-slashing validators slashable check: %v", errorAny)
-	}
-	if !slashedAny {
-		return errors.New("attester slashing %d is not effective, hence invalid")
 	}
 	return nil
 }
 
+// SlashableIndices returns the validators that attested to both attestations, the validators to slash
+// if the attestation data is slashable, and if they are still slashable. The indices of both attestations must be sorted.
+func SlashableIndices(a *IndexedAttestation, b *IndexedAttestation) common.ValidatorSet {
+	var out common.ValidatorSet
+	common.ValidatorSet(a.AttestingIndices).ZigZagJoin(common.ValidatorSet(b.AttestingIndices), func(i common.ValidatorIndex) {
+		out = append(out, i)
+	}, nil)
+	return out
+}
+
+// IsSlashableAttestationData checks if the attestation data a and b are a double vote, or if a surrounds b.
+// The check is not symmetric: an attester slashing where b surrounds a is not valid.
 func IsSlashableAttestationData(a *AttestationData, b *AttestationData) bool {
 	return IsSurroundVote(a, b) || IsDoubleVote(a, b)
 }
@@ -0,0 +1,62 @@
+package phase0
+
+import (
+	"testing"
+
+	"github.com/protolambda/zrnt/eth2/beacon/common"
+)
+
+func TestIsSlashableAttestationData(t *testing.T) {
+	vote := func(source common.Epoch, target common.Epoch, root byte) *AttestationData {
+		return &AttestationData{
+			BeaconBlockRoot: common.Root{root},
+			Source:          common.Checkpoint{Epoch: source},
+			Target:          common.Checkpoint{Epoch: target, Root: common.Root{root}},
+		}
+	}
+	cases := []struct {
+		name      string
+		a, b      *AttestationData
+		slashable bool
+	}{
+		{"equal", vote(1, 2, 1), vote(1, 2, 1), false},
+		{"double vote", vote(1, 2, 1), vote(1, 2, 2), true},
+		{"double vote, other source", vote(0, 2, 1), vote(1, 2, 1), true},
+		{"a surrounds b", vote(1, 5, 1), vote(2, 4, 2), true},
+		{"b surrounds a", vote(2, 4, 2), vote(1, 5, 1), false},
+		{"same source, nested target", vote(1, 5, 1), vote(1, 4, 2), false},
+		{"consecutive", vote(1, 2, 1), vote(2, 3, 2), false},
+	}
+	for _, c := range cases {
+		if got := IsSlashableAttestationData(c.a, c.b); got != c.slashable {
+			t.Errorf("%s: expected slashable %v, got %v", c.name, c.slashable, got)
+		}
+	}
+}
+
+func TestSlashableIndices(t *testing.T) {
+	indexed := func(indices ...common.ValidatorIndex) *IndexedAttestation {
+		return &IndexedAttestation{AttestingIndices: indices}
+	}
+	cases := []struct {
+		name     string
+		a, b     *IndexedAttestation
+		expected []common.ValidatorIndex
+	}{
+		{"disjoint", indexed(1, 3), indexed(2, 4), nil},
+		{"overlap", indexed(1, 2, 5, 9), indexed(2, 3, 9), []common.ValidatorIndex{2, 9}},
+		{"subset", indexed(4), indexed(1, 4, 7), []common.ValidatorIndex{4}},
+		{"empty", indexed(), indexed(1), nil},
+	}
+	for _, c := range cases {
+		got := SlashableIndices(c.a, c.b)
+		if len(got) != len(c.expected) {
+			t.Fatalf("%s: expected %v, got %v", c.name, c.expected, got)
+		}
+		for i := range got {
+			if got[i] != c.expected[i] {
+				t.Fatalf("%s: expected %v, got %v", c.name, c.expected, got)
+			}
+		}
+	}
+}
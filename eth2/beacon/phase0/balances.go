@@ -9,6 +9,10 @@ import (
 
 type Balances []common.Gwei
 
+func (li Balances) MarshalJSON() ([]byte, error) {
+	return common.MarshalJSONList(len(li), []common.Gwei(li))
+}
+
 func (a *Balances) Deserialize(spec *common.Spec, dr *codec.DecodingReader) error {
 	return dr.List(func() codec.Deserializable {
 		i := len(*a)
@@ -0,0 +1,180 @@
+package phase0
+
+import (
+	"testing"
+
+	"github.com/protolambda/zrnt/eth2/beacon/common"
+	"github.com/protolambda/zrnt/eth2/configs"
+	"github.com/protolambda/ztyp/tree"
+)
+
+func TestApplyBalanceDeltas(t *testing.T) {
+	spec := configs.Minimal
+	// not a multiple of 4, to have a partially filled last chunk
+	state, _, err := KickStartState(spec, common.Root{123}, 1564000000, testKickstartValidators(t, 67))
+	if err != nil {
+		t.Fatal(err)
+	}
+	count := uint64(67)
+	deltas := common.NewDeltas(count)
+	for i := uint64(0); i < count; i++ {
+		switch i % 5 {
+		case 0:
+			deltas.Rewards[i] = common.Gwei(i * 1000)
+		case 1:
+			deltas.Penalties[i] = common.Gwei(i * 3000)
+		case 2:
+			// saturating
+			deltas.Penalties[i] = spec.MAX_EFFECTIVE_BALANCE * 2
+		case 3:
+			deltas.Rewards[i] = 12345
+			deltas.Penalties[i] = 12345
+		}
+	}
+	// whole chunk without changes
+	for i := uint64(8); i < 12; i++ {
+		deltas.Rewards[i] = 0
+		deltas.Penalties[i] = 0
+	}
+	copyState := func() *BeaconStateView {
+		s, err := AsBeaconStateView(state.Copy())
+		if err != nil {
+			t.Fatal(err)
+		}
+		return s
+	}
+	batched := copyState()
+	if err := common.ApplyBalanceDeltas(spec, batched, deltas.Rewards, deltas.Penalties); err != nil {
+		t.Fatal(err)
+	}
+	perIndex := copyState()
+	bals, err := perIndex.Balances()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := uint64(0); i < count; i++ {
+		if err := common.IncreaseBalance(bals, common.ValidatorIndex(i), deltas.Rewards[i]); err != nil {
+			t.Fatal(err)
+		}
+		if err := common.DecreaseBalance(bals, common.ValidatorIndex(i), deltas.Penalties[i]); err != nil {
+			t.Fatal(err)
+		}
+	}
+	hFn := tree.GetHashFn()
+	if a, b := batched.HashTreeRoot(hFn), perIndex.HashTreeRoot(hFn); a != b {
+		t.Fatalf("batched state root %s does not match per-index state root %s", a, b)
+	}
+	if bal, err := bals.GetBalance(2); err != nil {
+		t.Fatal(err)
+	} else if bal != 0 {
+		t.Fatalf("expected balance clipped to 0, got %d", bal)
+	}
+
+	unchanged := copyState()
+	pre := unchanged.HashTreeRoot(hFn)
+	none := common.NewDeltas(count)
+	if err := common.ApplyBalanceDeltas(spec, unchanged, none.Rewards, none.Penalties); err != nil {
+		t.Fatal(err)
+	}
+	if post := unchanged.HashTreeRoot(hFn); post != pre {
+		t.Fatalf("expected unchanged state root %s, got %s", pre, post)
+	}
+	if err := common.ApplyBalanceDeltas(spec, unchanged, none.Rewards[1:], none.Penalties); err == nil {
+		t.Fatal("expected error for deltas of different length")
+	}
+}
+
+// Crafted states with balances near the max uint64 saturate instead of wrapping around.
+func TestBalanceSaturation(t *testing.T) {
+	spec := configs.Minimal
+	state, epc, err := KickStartState(spec, common.Root{123}, 1564000000, testKickstartValidators(t, 8))
+	if err != nil {
+		t.Fatal(err)
+	}
+	const max = ^common.Gwei(0)
+	bals, err := state.Balances()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, bal := range []common.Gwei{max - 1, max, max - 10, 10} {
+		if err := bals.SetBalance(common.ValidatorIndex(i), bal); err != nil {
+			t.Fatal(err)
+		}
+	}
+	deltas := common.NewDeltas(8)
+	deltas.Rewards[0], deltas.Rewards[1], deltas.Rewards[2] = 5, max, 5
+	deltas.Penalties[2], deltas.Penalties[3] = 20, max
+	// summing the components saturates too
+	sum := common.NewDeltas(8)
+	sum.Add(deltas)
+	sum.Add(deltas)
+	if sum.Rewards[1] != max || sum.Penalties[3] != max || sum.Rewards[0] != 10 {
+		t.Fatalf("unexpected sum of deltas: %v", sum)
+	}
+	expected := []common.Gwei{max, max, max - 25, 0}
+
+	copyState := func() *BeaconStateView {
+		s, err := AsBeaconStateView(state.Copy())
+		if err != nil {
+			t.Fatal(err)
+		}
+		return s
+	}
+	check := func(name string, s *BeaconStateView) {
+		bals, err := s.Balances()
+		if err != nil {
+			t.Fatal(err)
+		}
+		for i, exp := range expected {
+			if bal, err := bals.GetBalance(common.ValidatorIndex(i)); err != nil {
+				t.Fatal(err)
+			} else if bal != exp {
+				t.Fatalf("%s: validator %d: expected balance %d, got %d", name, i, exp, bal)
+			}
+		}
+	}
+	batched := copyState()
+	if err := common.ApplyBalanceDeltas(spec, batched, deltas.Rewards, deltas.Penalties); err != nil {
+		t.Fatal(err)
+	}
+	check("batched", batched)
+	perIndex := copyState()
+	perIndexBals, err := perIndex.Balances()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := range expected {
+		if err := common.IncreaseBalance(perIndexBals, common.ValidatorIndex(i), deltas.Rewards[i]); err != nil {
+			t.Fatal(err)
+		}
+		if err := common.DecreaseBalance(perIndexBals, common.ValidatorIndex(i), deltas.Penalties[i]); err != nil {
+			t.Fatal(err)
+		}
+	}
+	check("per index", perIndex)
+	list := copyState()
+	out, err := common.ApplyDeltas(list, deltas)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := list.SetBalances(out); err != nil {
+		t.Fatal(err)
+	}
+	check("list", list)
+
+	// the whistleblower reward of a slashing
+	slashed := copyState()
+	whistleblower := common.ValidatorIndex(1)
+	if err := SlashValidator(spec, epc, slashed, 5, &whistleblower); err != nil {
+		t.Fatal(err)
+	}
+	slashedBals, err := slashed.Balances()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bal, err := slashedBals.GetBalance(whistleblower); err != nil {
+		t.Fatal(err)
+	} else if bal != max {
+		t.Fatalf("expected whistleblower balance capped at the max, got %d", bal)
+	}
+}
@@ -0,0 +1,26 @@
+package phase0
+
+import (
+	"github.com/protolambda/zrnt/eth2/beacon/common"
+	"github.com/protolambda/ztyp/tree"
+)
+
+// HashTreeRoots computes the block roots (hash-tree-root of the block message) of the given blocks with a pool of workers.
+// If parallelism <= 0, a worker per CPU is used.
+func HashTreeRoots(spec *common.Spec, blocks []*SignedBeaconBlock, parallelism int) []common.Root {
+	roots := make([]common.Root, len(blocks))
+	common.ParallelHashEach(len(blocks), parallelism, func(i int, hFn tree.HashFn) {
+		roots[i] = blocks[i].Message.HashTreeRoot(spec, hFn)
+	})
+	return roots
+}
+
+// AttestationDataRoots computes the hash-tree-root of the data of each of the given attestations with a pool of workers.
+// If parallelism <= 0, a worker per CPU is used.
+func AttestationDataRoots(atts []*Attestation, parallelism int) []common.Root {
+	roots := make([]common.Root, len(atts))
+	common.ParallelHashEach(len(atts), parallelism, func(i int, hFn tree.HashFn) {
+		roots[i] = atts[i].Data.HashTreeRoot(hFn)
+	})
+	return roots
+}
@@ -0,0 +1,66 @@
+package phase0
+
+import (
+	"testing"
+
+	"github.com/protolambda/zrnt/eth2/beacon/common"
+	"github.com/protolambda/zrnt/eth2/configs"
+	"github.com/protolambda/ztyp/tree"
+)
+
+func testBatchBlocks(spec *common.Spec, count int) []*SignedBeaconBlock {
+	blocks := make([]*SignedBeaconBlock, count)
+	for i := range blocks {
+		b := &SignedBeaconBlock{Message: BeaconBlock{
+			Slot:          common.Slot(i),
+			ProposerIndex: common.ValidatorIndex(i % 7),
+			ParentRoot:    common.Root{byte(i)},
+		}}
+		for j := uint64(0); j < uint64(spec.MAX_ATTESTATIONS); j++ {
+			bits := NewAttestationBits(uint64(spec.TARGET_COMMITTEE_SIZE))
+			bits.SetBit(j%uint64(spec.TARGET_COMMITTEE_SIZE), true)
+			b.Message.Body.Attestations = append(b.Message.Body.Attestations, Attestation{
+				AggregationBits: bits,
+				Data: AttestationData{
+					Slot:            common.Slot(i),
+					Index:           common.CommitteeIndex(j),
+					BeaconBlockRoot: common.Root{byte(i), byte(j)},
+				},
+			})
+		}
+		blocks[i] = b
+	}
+	return blocks
+}
+
+func TestHashTreeRoots(t *testing.T) {
+	spec := configs.Minimal
+	blocks := testBatchBlocks(spec, 20)
+	var atts []*Attestation
+	for _, b := range blocks {
+		for j := range b.Message.Body.Attestations {
+			atts = append(atts, &b.Message.Body.Attestations[j])
+		}
+	}
+	hFn := tree.GetHashFn()
+	for _, parallelism := range []int{0, 1, 3, 100} {
+		roots := HashTreeRoots(spec, blocks, parallelism)
+		if len(roots) != len(blocks) {
+			t.Fatalf("expected %d roots, got %d", len(blocks), len(roots))
+		}
+		for i, b := range blocks {
+			if expected := b.Message.HashTreeRoot(spec, hFn); roots[i] != expected {
+				t.Fatalf("parallelism %d: block %d root %s does not match serial root %s", parallelism, i, roots[i], expected)
+			}
+		}
+		dataRoots := AttestationDataRoots(atts, parallelism)
+		for i, att := range atts {
+			if expected := att.Data.HashTreeRoot(hFn); dataRoots[i] != expected {
+				t.Fatalf("parallelism %d: attestation %d data root %s does not match serial root %s", parallelism, i, dataRoots[i], expected)
+			}
+		}
+	}
+	if roots := HashTreeRoots(spec, nil, 4); len(roots) != 0 {
+		t.Fatal("expected no roots")
+	}
+}
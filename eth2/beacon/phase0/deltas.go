@@ -7,29 +7,75 @@ import (
 	"github.com/protolambda/zrnt/eth2/util/math"
 )
 
+// RewardsAndPenalties are the attestation deltas of the validators of an epoch transition, by component.
 type RewardsAndPenalties struct {
-	Source         *common.Deltas
-	Target         *common.Deltas
-	Head           *common.Deltas
-	InclusionDelay *common.Deltas
-	Inactivity     *common.Deltas
+	Source         *common.Deltas `json:"source" yaml:"source"`
+	Target         *common.Deltas `json:"target" yaml:"target"`
+	Head           *common.Deltas `json:"head" yaml:"head"`
+	InclusionDelay *common.Deltas `json:"inclusion_delay" yaml:"inclusion_delay"`
+	Inactivity     *common.Deltas `json:"inactivity" yaml:"inactivity"`
 }
 
 func NewRewardsAndPenalties(validatorCount uint64) *RewardsAndPenalties {
+	return newRewardsAndPenalties(nil, validatorCount)
+}
+
+func newRewardsAndPenalties(scratch *common.EpochProcessScratch, validatorCount uint64) *RewardsAndPenalties {
 	return &RewardsAndPenalties{
-		Source:         common.NewDeltas(validatorCount),
-		Target:         common.NewDeltas(validatorCount),
-		Head:           common.NewDeltas(validatorCount),
-		InclusionDelay: common.NewDeltas(validatorCount),
-		Inactivity:     common.NewDeltas(validatorCount),
+		Source:         scratch.Deltas(validatorCount),
+		Target:         scratch.Deltas(validatorCount),
+		Head:           scratch.Deltas(validatorCount),
+		InclusionDelay: scratch.Deltas(validatorCount),
+		Inactivity:     scratch.Deltas(validatorCount),
 	}
 }
 
+// Total sums the components, to the deltas that the epoch transition applies to the balances.
+func (r *RewardsAndPenalties) Total() *common.Deltas {
+	count := len(r.Source.Rewards)
+	out := common.NewDeltas(uint64(count))
+	r.addRange(out, 0, count)
+	return out
+}
+
+// addRange adds the components of the validators in the index range [start, end) to the sum.
+func (r *RewardsAndPenalties) addRange(sum *common.Deltas, start int, end int) {
+	sum.AddRange(r.Source, start, end)
+	sum.AddRange(r.Target, start, end)
+	sum.AddRange(r.Head, start, end)
+	sum.AddRange(r.InclusionDelay, start, end)
+	sum.AddRange(r.Inactivity, start, end)
+}
+
+// AttestationDeltas computes the attestation rewards and penalties that the epoch transition of the state applies,
+// without changing the state. The state should be at the last slot of the epoch, for all attestations to be included.
+// There are no deltas in the genesis epoch.
+func AttestationDeltas(ctx context.Context, spec *common.Spec, epc *common.EpochsContext,
+	state Phase0PendingAttestationsBeaconState) (*RewardsAndPenalties, error) {
+	vals, err := state.Validators()
+	if err != nil {
+		return nil, err
+	}
+	flats, err := common.FlattenValidators(vals)
+	if err != nil {
+		return nil, err
+	}
+	if epc.CurrentEpoch.Epoch == common.GENESIS_EPOCH {
+		return NewRewardsAndPenalties(uint64(len(flats))), nil
+	}
+	attesterData, err := ComputeEpochAttesterData(ctx, spec, epc, nil, flats, state)
+	if err != nil {
+		return nil, err
+	}
+	return AttestationRewardsAndPenalties(ctx, spec, epc, nil, attesterData, state)
+}
+
+// AttestationRewardsAndPenalties computes the attestation deltas of the epoch transition, by component.
 func AttestationRewardsAndPenalties(ctx context.Context, spec *common.Spec,
-	epc *common.EpochsContext, attesterData *EpochAttesterData, state common.BeaconState) (*RewardsAndPenalties, error) {
+	epc *common.EpochsContext, scratch *common.EpochProcessScratch, attesterData *EpochAttesterData, state common.BeaconState) (*RewardsAndPenalties, error) {
 
 	validatorCount := common.ValidatorIndex(uint64(len(attesterData.Statuses)))
-	res := NewRewardsAndPenalties(uint64(validatorCount))
+	res := newRewardsAndPenalties(scratch, uint64(validatorCount))
 
 	previousEpoch := epc.PreviousEpoch.Epoch
 
@@ -59,87 +105,105 @@ func AttestationRewardsAndPenalties(ctx context.Context, spec *common.Spec,
 
 	isInactivityLeak := finalityDelay > spec.MIN_EPOCHS_TO_INACTIVITY_PENALTY
 
-	for i := common.ValidatorIndex(0); i < validatorCount; i++ {
-		// every 1024 validators, check if the context is done.
-		if i&((1<<10)-1) == 0 {
-			if err := ctx.Err(); err != nil {
-				return nil, err
-			}
-		}
-		status := &attesterStatuses[i]
-		effBalance := attesterData.Flats[i].EffectiveBalance
-		baseReward := effBalance * common.Gwei(spec.BASE_REWARD_FACTOR) /
+	baseRewardOf := func(i common.ValidatorIndex) common.Gwei {
+		return attesterData.Flats[i].EffectiveBalance * common.Gwei(spec.BASE_REWARD_FACTOR) /
 			balanceSqRoot / common.BASE_REWARDS_PER_EPOCH
+	}
 
-		// Inclusion delay
-		if status.Flags.HasMarkers(PrevSourceAttester | UnslashedAttester) {
-			// Inclusion speed bonus
-			proposerReward := baseReward / common.Gwei(spec.PROPOSER_REWARD_QUOTIENT)
-			res.InclusionDelay.Rewards[status.AttestedProposer] += proposerReward
-			maxAttesterReward := baseReward - proposerReward
-			res.InclusionDelay.Rewards[i] += maxAttesterReward / common.Gwei(status.InclusionDelay)
-		}
-
-		if status.Flags&EligibleAttester != 0 {
-			// Since full base reward will be canceled out by inactivity penalty deltas,
-			// optimal participation receives full base reward compensation here.
+	// The deltas of every validator only depend on its own status, the validators can be processed in parallel.
+	err = common.ParallelChunks(ctx, int(validatorCount), epc.EpochProcessParallelism, func(start int, end int) error {
+		for i := common.ValidatorIndex(start); i < common.ValidatorIndex(end); i++ {
+			// every 1024 validators, check if the context is done.
+			if i&((1<<10)-1) == 0 {
+				if err := ctx.Err(); err != nil {
+					return err
+				}
+			}
+			status := &attesterStatuses[i]
+			effBalance := attesterData.Flats[i].EffectiveBalance
+			baseReward := baseRewardOf(i)
 
-			// Expected FFG source
+			// Inclusion delay
 			if status.Flags.HasMarkers(PrevSourceAttester | UnslashedAttester) {
-				if isInactivityLeak {
-					res.Source.Rewards[i] += baseReward
+				// Inclusion speed bonus, the proposer part is rewarded below
+				proposerReward := baseReward / common.Gwei(spec.PROPOSER_REWARD_QUOTIENT)
+				maxAttesterReward := baseReward - proposerReward
+				res.InclusionDelay.Rewards[i] += maxAttesterReward / common.Gwei(status.InclusionDelay)
+			}
+
+			if status.Flags&EligibleAttester != 0 {
+				// Since full base reward will be canceled out by inactivity penalty deltas,
+				// optimal participation receives full base reward compensation here.
+
+				// Expected FFG source
+				if status.Flags.HasMarkers(PrevSourceAttester | UnslashedAttester) {
+					if isInactivityLeak {
+						res.Source.Rewards[i] += baseReward
+					} else {
+						// Justification-participation reward
+						res.Source.Rewards[i] += baseReward * prevEpochSourceStake / totalBalance
+					}
 				} else {
-					// Justification-participation reward
-					res.Source.Rewards[i] += baseReward * prevEpochSourceStake / totalBalance
+					//Justification-non-participation R-penalty
+					res.Source.Penalties[i] += baseReward
 				}
-			} else {
-				//Justification-non-participation R-penalty
-				res.Source.Penalties[i] += baseReward
-			}
 
-			// Expected FFG target
-			if status.Flags.HasMarkers(PrevTargetAttester | UnslashedAttester) {
-				if isInactivityLeak {
-					res.Target.Rewards[i] += baseReward
+				// Expected FFG target
+				if status.Flags.HasMarkers(PrevTargetAttester | UnslashedAttester) {
+					if isInactivityLeak {
+						res.Target.Rewards[i] += baseReward
+					} else {
+						// Boundary-attestation reward
+						res.Target.Rewards[i] += baseReward * prevEpochTargetStake / totalBalance
+					}
 				} else {
-					// Boundary-attestation reward
-					res.Target.Rewards[i] += baseReward * prevEpochTargetStake / totalBalance
+					//Boundary-attestation-non-participation R-penalty
+					res.Target.Penalties[i] += baseReward
 				}
-			} else {
-				//Boundary-attestation-non-participation R-penalty
-				res.Target.Penalties[i] += baseReward
-			}
 
-			// Expected head
-			if status.Flags.HasMarkers(PrevHeadAttester | UnslashedAttester) {
-				if isInactivityLeak {
-					res.Head.Rewards[i] += baseReward
+				// Expected head
+				if status.Flags.HasMarkers(PrevHeadAttester | UnslashedAttester) {
+					if isInactivityLeak {
+						res.Head.Rewards[i] += baseReward
+					} else {
+						// Canonical-participation reward
+						res.Head.Rewards[i] += baseReward * prevEpochHeadStake / totalBalance
+					}
 				} else {
-					// Canonical-participation reward
-					res.Head.Rewards[i] += baseReward * prevEpochHeadStake / totalBalance
+					// Non-canonical-participation R-penalty
+					res.Head.Penalties[i] += baseReward
 				}
-			} else {
-				// Non-canonical-participation R-penalty
-				res.Head.Penalties[i] += baseReward
-			}
 
-			// Take away max rewards if we're not finalizing
-			if isInactivityLeak {
-				// If validator is performing optimally this cancels all rewards for a neutral balance
-				proposerReward := baseReward / common.Gwei(spec.PROPOSER_REWARD_QUOTIENT)
-				res.Inactivity.Penalties[i] += common.BASE_REWARDS_PER_EPOCH*baseReward - proposerReward
-				if !status.Flags.HasMarkers(PrevTargetAttester | UnslashedAttester) {
-					res.Inactivity.Penalties[i] += effBalance * common.Gwei(finalityDelay) / common.Gwei(settings.InactivityPenaltyQuotient)
+				// Take away max rewards if we're not finalizing
+				if isInactivityLeak {
+					// If validator is performing optimally this cancels all rewards for a neutral balance
+					proposerReward := baseReward / common.Gwei(spec.PROPOSER_REWARD_QUOTIENT)
+					res.Inactivity.Penalties[i] += common.BASE_REWARDS_PER_EPOCH*baseReward - proposerReward
+					if !status.Flags.HasMarkers(PrevTargetAttester | UnslashedAttester) {
+						res.Inactivity.Penalties[i] += effBalance * common.Gwei(finalityDelay) / common.Gwei(settings.InactivityPenaltyQuotient)
+					}
 				}
 			}
 		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// The proposers of the included attestations are rewarded separately, serially, since proposers are shared.
+	for i := common.ValidatorIndex(0); i < validatorCount; i++ {
+		status := &attesterStatuses[i]
+		if status.Flags.HasMarkers(PrevSourceAttester | UnslashedAttester) {
+			res.InclusionDelay.Rewards[status.AttestedProposer] += baseRewardOf(i) / common.Gwei(spec.PROPOSER_REWARD_QUOTIENT)
+		}
 	}
 
 	return res, nil
 }
 
 func ProcessEpochRewardsAndPenalties(ctx context.Context, spec *common.Spec, epc *common.EpochsContext,
-	attesterData *EpochAttesterData, state common.BeaconState) error {
+	scratch *common.EpochProcessScratch, attesterData *EpochAttesterData, state common.BeaconState) error {
 	if err := ctx.Err(); err != nil {
 		return err
 	}
@@ -148,19 +212,17 @@ func ProcessEpochRewardsAndPenalties(ctx context.Context, spec *common.Spec, epc
 		return nil
 	}
 	valCount := uint64(len(attesterData.Statuses))
-	sum := common.NewDeltas(valCount)
-	rewAndPenalties, err := AttestationRewardsAndPenalties(ctx, spec, epc, attesterData, state)
+	sum := scratch.Deltas(valCount)
+	rewAndPenalties, err := AttestationRewardsAndPenalties(ctx, spec, epc, scratch, attesterData, state)
 	if err != nil {
 		return err
 	}
-	sum.Add(rewAndPenalties.Source)
-	sum.Add(rewAndPenalties.Target)
-	sum.Add(rewAndPenalties.Head)
-	sum.Add(rewAndPenalties.InclusionDelay)
-	sum.Add(rewAndPenalties.Inactivity)
-	balances, err := common.ApplyDeltas(state, sum)
+	err = common.ParallelChunks(ctx, int(valCount), epc.EpochProcessParallelism, func(start int, end int) error {
+		rewAndPenalties.addRange(sum, start, end)
+		return nil
+	})
 	if err != nil {
 		return err
 	}
-	return state.SetBalances(balances)
+	return common.ApplyBalanceDeltas(spec, state, sum.Rewards, sum.Penalties)
 }
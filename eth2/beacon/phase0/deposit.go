@@ -20,6 +20,10 @@ func BlockDepositsType(spec *common.Spec) ListTypeDef {
 
 type Deposits []common.Deposit
 
+func (li Deposits) MarshalJSON() ([]byte, error) {
+	return common.MarshalJSONList(len(li), []common.Deposit(li))
+}
+
 func (a *Deposits) Deserialize(spec *common.Spec, dr *codec.DecodingReader) error {
 	return dr.List(func() codec.Deserializable {
 		i := len(*a)
@@ -53,7 +57,7 @@ func (li Deposits) HashTreeRoot(spec *common.Spec, hFn tree.HashFn) common.Root
 }
 
 // Verify that outstanding deposits are processed up to the maximum number of deposits, then process all in order.
-func ProcessDeposits(ctx context.Context, spec *common.Spec, epc *common.EpochsContext, state common.BeaconState, ops []common.Deposit) error {
+func ProcessDeposits(ctx context.Context, spec *common.Spec, epc *common.EpochsContext, tr *common.Transition, state common.BeaconState, ops []common.Deposit) error {
 	inputCount := uint64(len(ops))
 	eth1Data, err := state.Eth1Data()
 	if err != nil {
@@ -76,7 +80,10 @@ func ProcessDeposits(ctx context.Context, spec *common.Spec, epc *common.EpochsC
 		if err := ctx.Err(); err != nil {
 			return err
 		}
-		if err := ProcessDeposit(spec, epc, state, &ops[i], false); err != nil {
+		tr.TraceBeforeOp(state, common.OpDeposit, i)
+		err := ProcessDeposit(spec, epc, tr, state, &ops[i], false)
+		tr.TraceAfterOp(state, common.OpDeposit, i, err)
+		if err != nil {
 			return err
 		}
 	}
@@ -84,7 +91,7 @@ func ProcessDeposits(ctx context.Context, spec *common.Spec, epc *common.EpochsC
 }
 
 // Process an Eth1 deposit, registering a validator or increasing its balance.
-func ProcessDeposit(spec *common.Spec, epc *common.EpochsContext, state common.BeaconState, dep *common.Deposit, ignoreSignatureAndProof bool) error {
+func ProcessDeposit(spec *common.Spec, epc *common.EpochsContext, tr *common.Transition, state common.BeaconState, dep *common.Deposit, ignoreSignatureAndProof bool) error {
 	depositIndex, err := state.Eth1DepositIndex()
 	if err != nil {
 		return err
@@ -145,11 +152,14 @@ func ProcessDeposit(spec *common.Spec, epc *common.EpochsContext, state common.B
 			return nil
 		}
 		// Verify the deposit signature (proof of possession) which is not checked by the deposit contract
-		if !ignoreSignatureAndProof && !blsu.Verify(blsPub, signingRoot[:], sig) {
-			// invalid signatures are OK,
-			// the depositor will not receive anything because of their mistake,
-			// and the chain continues.
-			return nil
+		if !ignoreSignatureAndProof {
+			tr.CountSignatures(string(common.OpDeposit), 1)
+			if !blsu.Verify(blsPub, signingRoot[:], sig) {
+				// invalid signatures are OK,
+				// the depositor will not receive anything because of their mistake,
+				// and the chain continues.
+				return nil
+			}
 		}
 
 		// Add validator and balance entries
@@ -159,6 +169,9 @@ func ProcessDeposit(spec *common.Spec, epc *common.EpochsContext, state common.B
 		if err := state.AddValidator(spec, pubkey, withdrawalCreds, balance); err != nil {
 			return err
 		}
+		if err := common.StateFlatValidators(state).AddValidator(state, valIndex); err != nil {
+			return err
+		}
 		if pc, err := epc.ValidatorPubkeyCache.AddValidator(valIndex, pubkey); err != nil {
 			return err
 		} else {
@@ -0,0 +1,49 @@
+package phase0
+
+import (
+	"fmt"
+
+	"github.com/protolambda/zrnt/eth2/beacon/common"
+)
+
+// DuplicateSlashingError is the error of a slashing that only slashes validators that an earlier slashing
+// of the same kind in the same block already slashed. The spec rejects such a slashing too,
+// since the validators are no longer slashable, but the error names the earlier slashing.
+type DuplicateSlashingError struct {
+	Kind common.OpKind
+	// Index of the slashing in the block
+	Index int
+	// Index of the earlier slashing in the block
+	Earlier int
+	// Validators of the slashing that are already slashed
+	Validators []common.ValidatorIndex
+}
+
+func (e *DuplicateSlashingError) Error() string {
+	return fmt.Sprintf("%s %d duplicates %s %d: validators %v are already slashed",
+		e.Kind, e.Index, e.Kind, e.Earlier, e.Validators)
+}
+
+// slashedInBlock tracks the validators slashed by the slashings of a block, by the index of the slashing.
+type slashedInBlock map[common.ValidatorIndex]int
+
+// duplicate returns an error if all the given validators are slashed already, nil if there are no validators.
+func (s slashedInBlock) duplicate(kind common.OpKind, index int, validators []common.ValidatorIndex) error {
+	if len(validators) == 0 {
+		return nil
+	}
+	for _, v := range validators {
+		if _, ok := s[v]; !ok {
+			return nil
+		}
+	}
+	return &DuplicateSlashingError{Kind: kind, Index: index, Earlier: s[validators[0]], Validators: validators}
+}
+
+func (s slashedInBlock) add(index int, validators []common.ValidatorIndex) {
+	for _, v := range validators {
+		if _, ok := s[v]; !ok {
+			s[v] = index
+		}
+	}
+}
@@ -0,0 +1,121 @@
+package phase0
+
+import (
+	"context"
+	"testing"
+
+	"github.com/protolambda/zrnt/eth2/beacon/common"
+	"github.com/protolambda/zrnt/eth2/configs"
+)
+
+func copyState(t testing.TB, state *BeaconStateView) *BeaconStateView {
+	out, err := AsBeaconStateView(state.Copy())
+	if err != nil {
+		t.Fatal(err)
+	}
+	return out
+}
+
+func TestEpochsContextCacheSiblings(t *testing.T) {
+	spec := configs.Minimal
+	ctx := context.Background()
+	state, epc, err := KickStartState(spec, common.Root{123}, 1564000000, testKickstartValidators(t, 64))
+	if err != nil {
+		t.Fatal(err)
+	}
+	start, _ := spec.EpochStartSlot(3)
+	if err := common.ProcessSlots(ctx, spec, epc, testUpgradeableState{state}, start+2); err != nil {
+		t.Fatal(err)
+	}
+	// sibling branch: different block in the same epoch, same decision root
+	sibling := copyState(t, state)
+	if err := sibling.SetEth1Data(common.Eth1Data{BlockHash: common.Root{0xaa}}); err != nil {
+		t.Fatal(err)
+	}
+
+	cache := common.NewEpochsContextCache(4)
+	computes := 0
+	get := func(state *BeaconStateView) *common.EpochsContext {
+		out, err := cache.GetOrCompute(spec, state, func() (*common.EpochsContext, error) {
+			computes++
+			return common.NewEpochsContext(spec, state)
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return out
+	}
+	a := get(state)
+	if b := get(sibling); a != b || computes != 1 {
+		t.Fatalf("expected siblings to share the context, computed %d contexts", computes)
+	}
+	if hits, misses := cache.Stats(); hits != 1 || misses != 1 {
+		t.Fatalf("expected 1 hit and 1 miss, got %d hits, %d misses", hits, misses)
+	}
+
+	// crossing the epoch boundary with a clone leaves the shared context unchanged
+	next := copyState(t, state)
+	nextStart, _ := spec.EpochStartSlot(4)
+	if err := common.ProcessSlots(ctx, spec, a.Clone(), testUpgradeableState{next}, nextStart); err != nil {
+		t.Fatal(err)
+	}
+	if a.CurrentEpoch.Epoch != 3 {
+		t.Fatalf("shared context changed to epoch %d", a.CurrentEpoch.Epoch)
+	}
+	if c := get(next); c == a || computes != 2 || c.CurrentEpoch.Epoch != 4 {
+		t.Fatalf("expected a new context for the next epoch, computed %d contexts", computes)
+	}
+
+	// a different block at the end of the previous epoch decides a different context
+	other := copyState(t, next)
+	if err := common.SetRecentRoots(spec, other, nextStart-1, common.Root{0xcc}, common.Root{0xdd}); err != nil {
+		t.Fatal(err)
+	}
+	get(other)
+	if computes != 3 {
+		t.Fatalf("expected a new context for another decision root, computed %d contexts", computes)
+	}
+	if cache.Len() != 3 {
+		t.Fatalf("expected 3 cached contexts, got %d", cache.Len())
+	}
+}
+
+// Contexts of the states of sibling blocks in an epoch, with and without the cache.
+func BenchmarkEpochsContextCache(b *testing.B) {
+	spec := configs.Minimal
+	state, epc, err := KickStartState(spec, common.Root{123}, 1564000000, testKickstartValidators(b, 256))
+	if err != nil {
+		b.Fatal(err)
+	}
+	start, _ := spec.EpochStartSlot(3)
+	if err := common.ProcessSlots(context.Background(), spec, epc, testUpgradeableState{state}, start+2); err != nil {
+		b.Fatal(err)
+	}
+	siblings := make([]*BeaconStateView, 8)
+	for i := range siblings {
+		siblings[i] = copyState(b, state)
+		if err := siblings[i].SetEth1Data(common.Eth1Data{BlockHash: common.Root{byte(i)}}); err != nil {
+			b.Fatal(err)
+		}
+	}
+	b.Run("uncached", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			if _, err := common.NewEpochsContext(spec, siblings[i%len(siblings)]); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+	b.Run("cached", func(b *testing.B) {
+		cache := common.NewEpochsContextCache(4)
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			state := siblings[i%len(siblings)]
+			if _, err := cache.GetOrCompute(spec, state, func() (*common.EpochsContext, error) {
+				return common.NewEpochsContext(spec, state)
+			}); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+}
@@ -12,6 +12,10 @@ import (
 
 type Eth1DataVotes []common.Eth1Data
 
+func (li Eth1DataVotes) MarshalJSON() ([]byte, error) {
+	return common.MarshalJSONList(len(li), []common.Eth1Data(li))
+}
+
 func (a *Eth1DataVotes) Deserialize(spec *common.Spec, dr *codec.DecodingReader) error {
 	return dr.List(func() codec.Deserializable {
 		i := len(*a)
@@ -122,3 +126,31 @@ func ProcessEth1Vote(ctx context.Context, spec *common.Spec, epc *common.EpochsC
 	}
 	return nil
 }
+
+func (v *Eth1DataVotesView) Raw() (Eth1DataVotes, error) {
+	length, err := v.Length()
+	if err != nil {
+		return nil, err
+	}
+	out := make(Eth1DataVotes, 0, length)
+	iter := v.ReadonlyIter()
+	for {
+		el, ok, err := iter.Next()
+		if err != nil {
+			return nil, err
+		}
+		if !ok {
+			break
+		}
+		dat, err := common.AsEth1Data(el, nil)
+		if err != nil {
+			return nil, err
+		}
+		raw, err := dat.Raw()
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, raw)
+	}
+	return out, nil
+}
@@ -0,0 +1,121 @@
+package phase0
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/protolambda/zrnt/eth2/beacon/common"
+)
+
+// Eth1Block is a candidate eth1 block to vote for.
+type Eth1Block struct {
+	Timestamp common.Timestamp
+	Data      common.Eth1Data
+}
+
+// Eth1Provider provides the eth1 blocks to consider for eth1 data votes during block production.
+type Eth1Provider interface {
+	// Eth1DataForRange returns the eth1 blocks with a timestamp in the range [minTime, maxTime] (inclusive),
+	// with the deposit count and root after processing the block, ordered by ascending timestamp.
+	Eth1DataForRange(ctx context.Context, minTime common.Timestamp, maxTime common.Timestamp) ([]Eth1Block, error)
+}
+
+// VotingPeriodStartTime returns the time of the start of the eth1 voting period that the state is in.
+func VotingPeriodStartTime(spec *common.Spec, state common.BeaconState) (common.Timestamp, error) {
+	slot, err := state.Slot()
+	if err != nil {
+		return 0, err
+	}
+	genesisTime, err := state.GenesisTime()
+	if err != nil {
+		return 0, err
+	}
+	epoch := spec.SlotToEpoch(slot)
+	periodStartEpoch := epoch - (epoch % spec.EPOCHS_PER_ETH1_VOTING_PERIOD)
+	periodStartSlot, err := spec.EpochStartSlot(periodStartEpoch)
+	if err != nil {
+		return 0, err
+	}
+	return spec.TimeAtSlot(periodStartSlot, genesisTime)
+}
+
+// GetEth1Vote picks the eth1 data to vote for in a block on top of the given state (already processed up to the block slot),
+// following the honest validator strategy:
+// candidates are eth1 blocks between 1 and 2 follow-distances before the start of the voting period,
+// that do not decrease the deposit count of the state.
+// The candidate with the most votes in the state is picked, the earliest vote breaking ties.
+// If no votes match a candidate, the latest candidate is picked, or the current state eth1 data if there are no candidates.
+func GetEth1Vote(ctx context.Context, spec *common.Spec, state common.BeaconState, provider Eth1Provider) (common.Eth1Data, error) {
+	stateEth1Data, err := state.Eth1Data()
+	if err != nil {
+		return common.Eth1Data{}, err
+	}
+	periodStart, err := VotingPeriodStartTime(spec, state)
+	if err != nil {
+		return common.Eth1Data{}, err
+	}
+	followTime := common.Timestamp(spec.SECONDS_PER_ETH1_BLOCK) * common.Timestamp(spec.ETH1_FOLLOW_DISTANCE)
+	if periodStart < followTime {
+		// no eth1 blocks can be considered yet
+		return stateEth1Data, nil
+	}
+	maxTime := periodStart - followTime
+	var minTime common.Timestamp
+	if maxTime > followTime {
+		minTime = maxTime - followTime
+	}
+	blocks, err := provider.Eth1DataForRange(ctx, minTime, maxTime)
+	if err != nil {
+		return common.Eth1Data{}, fmt.Errorf("failed to get eth1 data candidates: %v", err)
+	}
+	candidates := make(map[common.Eth1Data]struct{}, len(blocks))
+	defaultVote := stateEth1Data
+	for _, b := range blocks {
+		// do not trust the provider to stick to the requested range
+		if b.Timestamp < minTime || b.Timestamp > maxTime {
+			continue
+		}
+		if b.Data.DepositCount < stateEth1Data.DepositCount {
+			continue
+		}
+		candidates[b.Data] = struct{}{}
+		defaultVote = b.Data
+	}
+
+	votesView, err := state.Eth1DataVotes()
+	if err != nil {
+		return common.Eth1Data{}, err
+	}
+	rawVotesView, ok := votesView.(*Eth1DataVotesView)
+	if !ok {
+		return common.Eth1Data{}, fmt.Errorf("unrecognized eth1 data votes type: %T", votesView)
+	}
+	votes, err := rawVotesView.Raw()
+	if err != nil {
+		return common.Eth1Data{}, err
+	}
+	counts := make(map[common.Eth1Data]uint64)
+	// votes in order of first appearance, to break ties
+	var order []common.Eth1Data
+	for _, v := range votes {
+		if _, ok := candidates[v]; !ok {
+			continue
+		}
+		if counts[v] == 0 {
+			order = append(order, v)
+		}
+		counts[v] += 1
+	}
+	var best common.Eth1Data
+	bestCount := uint64(0)
+	for _, v := range order {
+		if c := counts[v]; c > bestCount {
+			best = v
+			bestCount = c
+		}
+	}
+	if bestCount == 0 {
+		return defaultVote, nil
+	}
+	return best, nil
+}
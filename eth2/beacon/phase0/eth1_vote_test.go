@@ -0,0 +1,91 @@
+package phase0
+
+import (
+	"context"
+	"testing"
+
+	"github.com/protolambda/zrnt/eth2/beacon/common"
+	"github.com/protolambda/zrnt/eth2/configs"
+)
+
+type mockEth1Provider []Eth1Block
+
+func (m mockEth1Provider) Eth1DataForRange(ctx context.Context, minTime common.Timestamp, maxTime common.Timestamp) ([]Eth1Block, error) {
+	var out []Eth1Block
+	for _, b := range m {
+		if b.Timestamp >= minTime && b.Timestamp <= maxTime {
+			out = append(out, b)
+		}
+	}
+	return out, nil
+}
+
+func TestGetEth1Vote(t *testing.T) {
+	spec := configs.Minimal
+	genesisTime := common.Timestamp(1000)
+	epoch := spec.EPOCHS_PER_ETH1_VOTING_PERIOD * 2
+	slot, _ := spec.EpochStartSlot(epoch)
+	periodStart, _ := spec.TimeAtSlot(slot, genesisTime)
+	followTime := common.Timestamp(spec.SECONDS_PER_ETH1_BLOCK) * common.Timestamp(spec.ETH1_FOLLOW_DISTANCE)
+
+	current := common.Eth1Data{DepositCount: 10, BlockHash: common.Root{0x10}}
+	a := common.Eth1Data{DepositCount: 10, BlockHash: common.Root{0xa}}
+	b := common.Eth1Data{DepositCount: 11, BlockHash: common.Root{0xb}}
+	tooNew := common.Eth1Data{DepositCount: 12, BlockHash: common.Root{0xc}}
+	stale := common.Eth1Data{DepositCount: 9, BlockHash: common.Root{0xd}}
+	provider := mockEth1Provider{
+		{Timestamp: periodStart - 2*followTime - 1, Data: stale},
+		{Timestamp: periodStart - 2*followTime, Data: a},
+		{Timestamp: periodStart - followTime, Data: b},
+		{Timestamp: periodStart - followTime + 1, Data: tooNew},
+	}
+
+	newState := func(votes ...common.Eth1Data) common.BeaconState {
+		state := NewBeaconStateView(spec)
+		if err := state.SetGenesisTime(genesisTime); err != nil {
+			t.Fatal(err)
+		}
+		// some slot in the middle of the voting period
+		if err := state.SetSlot(slot + 3); err != nil {
+			t.Fatal(err)
+		}
+		if err := state.SetEth1Data(current); err != nil {
+			t.Fatal(err)
+		}
+		votesView, err := state.Eth1DataVotes()
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, v := range votes {
+			if err := votesView.Append(v); err != nil {
+				t.Fatal(err)
+			}
+		}
+		return state
+	}
+
+	cases := []struct {
+		name     string
+		votes    []common.Eth1Data
+		provider Eth1Provider
+		expected common.Eth1Data
+	}{
+		{"majority", []common.Eth1Data{b, tooNew, a, tooNew, a, tooNew}, provider, a},
+		{"tie", []common.Eth1Data{b, a, a, b}, provider, b},
+		{"no majority", []common.Eth1Data{tooNew, stale}, provider, b},
+		{"no votes", nil, provider, b},
+		{"stale provider", []common.Eth1Data{stale}, mockEth1Provider{{Timestamp: periodStart - followTime, Data: stale}}, current},
+		{"empty provider", []common.Eth1Data{a}, mockEth1Provider{}, current},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			vote, err := GetEth1Vote(context.Background(), spec, newState(c.votes...), c.provider)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if vote != c.expected {
+				t.Fatalf("expected vote %v, got %v", c.expected, vote)
+			}
+		})
+	}
+}
@@ -6,6 +6,7 @@ import (
 	"github.com/protolambda/zrnt/eth2/beacon/common"
 )
 
+// ProcessEffectiveBalanceUpdates updates the effective balances of the state, and of the flat validators.
 func ProcessEffectiveBalanceUpdates(ctx context.Context, spec *common.Spec, epc *common.EpochsContext, flats []common.FlatValidator, state common.BeaconState) error {
 	if err := ctx.Err(); err != nil {
 		return err
@@ -44,6 +45,7 @@ func ProcessEffectiveBalanceUpdates(ctx context.Context, spec *common.Spec, epc
 			if err := val.SetEffectiveBalance(effBalance); err != nil {
 				return err
 			}
+			flats[i].EffectiveBalance = effBalance
 		}
 	}
 	return nil
@@ -0,0 +1,134 @@
+package phase0
+
+import (
+	"context"
+	"testing"
+
+	"github.com/protolambda/zrnt/eth2/beacon/common"
+	"github.com/protolambda/zrnt/eth2/configs"
+)
+
+func checkFlatValidators(t *testing.T, state *BeaconStateView) {
+	t.Helper()
+	vals, err := state.Validators()
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected, err := common.FlattenValidators(vals)
+	if err != nil {
+		t.Fatal(err)
+	}
+	count := 0
+	err = state.FlatValidators().Each(state, func(i common.ValidatorIndex, v *common.FlatValidator) {
+		if int(i) < len(expected) && *v != expected[i] {
+			t.Errorf("flat validator %d does not match state: %+v <> %+v", i, *v, expected[i])
+		}
+		count++
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if count != len(expected) {
+		t.Fatalf("expected %d flat validators, got %d", len(expected), count)
+	}
+}
+
+func TestFlatValidatorCachePatches(t *testing.T) {
+	spec := configs.Minimal
+	keys := testKickstartValidators(t, 65)
+	state, epc, err := KickStartState(spec, common.Root{123}, 1564000000, keys[:64])
+	if err != nil {
+		t.Fatal(err)
+	}
+	// load the snapshot before changing the registry
+	if v, err := state.FlatValidators().Validator(state, 3); err != nil {
+		t.Fatal(err)
+	} else if !v.IsSlashable(epc.CurrentEpoch.Epoch) {
+		t.Fatal("expected validator to be slashable")
+	}
+	copied, err := state.CopyState()
+	if err != nil {
+		t.Fatal(err)
+	}
+	other := copied.(*BeaconStateView)
+	otherEpc := epc.Clone()
+
+	if err := SlashValidator(spec, epc, state, 3, nil); err != nil {
+		t.Fatal(err)
+	}
+	if v, err := state.FlatValidators().Validator(state, 3); err != nil {
+		t.Fatal(err)
+	} else if v.IsSlashable(epc.CurrentEpoch.Epoch) {
+		t.Fatal("slashed validator must not be slashable anymore")
+	}
+	if err := InitiateValidatorExit(spec, epc, state, 5); err != nil {
+		t.Fatal(err)
+	}
+	checkFlatValidators(t, state)
+
+	// the copy still sees its own registry
+	if v, err := other.FlatValidators().Validator(other, 3); err != nil {
+		t.Fatal(err)
+	} else if !v.IsSlashable(otherEpc.CurrentEpoch.Epoch) {
+		t.Fatal("slashing must not change the snapshot of the copy")
+	}
+	checkFlatValidators(t, other)
+
+	dep := &common.Deposit{Data: common.DepositData{
+		Pubkey:                keys[64].Pubkey,
+		WithdrawalCredentials: keys[64].WithdrawalCredentials,
+		Amount:                keys[64].Balance,
+	}}
+	if err := ProcessDeposit(spec, epc, nil, state, dep, true); err != nil {
+		t.Fatal(err)
+	}
+	checkFlatValidators(t, state)
+}
+
+func TestFlatValidatorCacheInvalidation(t *testing.T) {
+	spec := configs.Minimal
+	state, epc, err := KickStartState(spec, common.Root{123}, 1564000000, testKickstartValidators(t, 64))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := InitiateValidatorExit(spec, epc, state, 7); err != nil {
+		t.Fatal(err)
+	}
+	// the effective balance update of the epoch transition is not patched into the snapshot
+	bals, err := state.Balances()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := bals.SetBalance(9, spec.EJECTION_BALANCE/2); err != nil {
+		t.Fatal(err)
+	}
+	slot, _ := spec.EpochStartSlot(2)
+	if err := common.ProcessSlots(context.Background(), spec, epc, testUpgradeableState{state}, slot); err != nil {
+		t.Fatal(err)
+	}
+	if v, err := state.FlatValidators().Validator(state, 9); err != nil {
+		t.Fatal(err)
+	} else if v.EffectiveBalance > spec.EJECTION_BALANCE {
+		t.Fatalf("expected lowered effective balance, got %+v", v)
+	}
+	checkFlatValidators(t, state)
+
+	// a change to the registry outside of the state transition is not patched either
+	vals, err := state.Validators()
+	if err != nil {
+		t.Fatal(err)
+	}
+	v, err := vals.Validator(11)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := v.MakeSlashed(); err != nil {
+		t.Fatal(err)
+	}
+	if fv, err := state.FlatValidators().Validator(state, 11); err != nil {
+		t.Fatal(err)
+	} else if !fv.Slashed {
+		t.Fatal("expected the snapshot to be loaded again after a direct change")
+	}
+	checkFlatValidators(t, state)
+}
@@ -23,6 +23,10 @@ func NewDepositRootsView() *DepositRootsView {
 	return &DepositRootsView{DepositRootsType.New()}
 }
 
+// GenesisFromEth1 is initialize_beacon_state_from_eth1 of the spec: it processes the deposits, activates
+// the validators with the max effective balance, and sets the genesis time to the eth1 time plus the genesis delay.
+// Proofs and signatures of the deposits are checked against the incremental deposit roots, unless ignored.
+// The state is returned with its epochs context. Check the state with IsValidGenesisState.
 func GenesisFromEth1(spec *common.Spec, eth1BlockHash common.Root, time common.Timestamp, deps []common.Deposit, ignoreSignaturesAndProofs bool) (*BeaconStateView, *common.EpochsContext, error) {
 	state := NewBeaconStateView(spec)
 	if err := state.SetGenesisTime(time + spec.GENESIS_DELAY); err != nil {
@@ -91,7 +95,7 @@ func GenesisFromEth1(spec *common.Spec, eth1BlockHash common.Root, time common.T
 			return nil, nil, err
 		}
 		// in the rare case someone tries to create a genesis block using invalid data, error.
-		if err := ProcessDeposit(spec, epc, state, &deps[i], ignoreSignaturesAndProofs); err != nil {
+		if err := ProcessDeposit(spec, epc, nil, state, &deps[i], ignoreSignaturesAndProofs); err != nil {
 			return nil, nil, err
 		}
 	}
@@ -140,7 +144,13 @@ func GenesisFromEth1(spec *common.Spec, eth1BlockHash common.Root, time common.T
 			}
 		}
 	}
-	if err := state.SetGenesisValidatorsRoot(vals.HashTreeRoot(hFn)); err != nil {
+	var valsRoot common.Root
+	if ph, ok := vals.(common.ParallelHasher); ok {
+		valsRoot = ph.ParallelHashTreeRoot()
+	} else {
+		valsRoot = vals.HashTreeRoot(hFn)
+	}
+	if err := state.SetGenesisValidatorsRoot(valsRoot); err != nil {
 		return nil, nil, err
 	}
 	// Complete computation of epc
@@ -150,9 +160,12 @@ func GenesisFromEth1(spec *common.Spec, eth1BlockHash common.Root, time common.T
 	if err := epc.LoadProposers(state); err != nil {
 		return nil, nil, err
 	}
+	// there is no participation yet at genesis, the tallies are complete from the start
+	state.ParticipationTallies().Reset(common.GENESIS_EPOCH)
 	return state, epc, nil
 }
 
+// IsValidGenesisState checks the genesis time and the number of active validators of a genesis candidate.
 func IsValidGenesisState(spec *common.Spec, state common.BeaconState) (bool, error) {
 	genTime, err := state.GenesisTime()
 	if err != nil {
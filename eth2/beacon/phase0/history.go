@@ -111,6 +111,10 @@ func AsHistoricalBatch(v View, err error) (*HistoricalBatchView, error) {
 // roots of HistoricalBatch
 type HistoricalRoots []common.Root
 
+func (li HistoricalRoots) MarshalJSON() ([]byte, error) {
+	return common.MarshalJSONList(len(li), []common.Root(li))
+}
+
 func (a *HistoricalRoots) Deserialize(spec *common.Spec, dr *codec.DecodingReader) error {
 	return tree.ReadRootsLimited(dr, (*[]common.Root)(a), uint64(spec.HISTORICAL_ROOTS_LIMIT))
 }
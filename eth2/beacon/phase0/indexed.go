@@ -46,6 +46,8 @@ func IndexedAttestationType(spec *common.Spec) *ContainerTypeDef {
 	})
 }
 
+// ValidateIndexedAttestationIndicesSet checks that the indices are sorted and unique,
+// and that there is at least one and at most MAX_VALIDATORS_PER_COMMITTEE of them.
 func ValidateIndexedAttestationIndicesSet(spec *common.Spec, indexedAttestation *IndexedAttestation) (common.ValidatorSet, error) {
 	// wrap it in validator-sets. Does not sort it, but does make checking if it is a lot easier.
 	indices := common.ValidatorSet(indexedAttestation.AttestingIndices)
@@ -74,6 +76,8 @@ func ValidateIndexedAttestationIndicesSet(spec *common.Spec, indexedAttestation
 	return indices, nil
 }
 
+// ValidateIndexedAttestationNoSignature checks the indices of the indexed attestation against the state,
+// without the signature. Attestations of a block are checked with this too, their signatures are checked separately.
 func ValidateIndexedAttestationNoSignature(spec *common.Spec, state common.BeaconState, indexedAttestation *IndexedAttestation) error {
 	indices, err := ValidateIndexedAttestationIndicesSet(spec, indexedAttestation)
 	if err != nil {
@@ -96,28 +100,39 @@ func ValidateIndexedAttestationNoSignature(spec *common.Spec, state common.Beaco
 	return nil
 }
 
-func ValidateIndexedAttestationSignature(spec *common.Spec, dom common.BLSDomain, pubCache *common.PubkeyCache, indexedAttestation *IndexedAttestation) error {
-	pubkeys := make([]*blsu.Pubkey, 0, len(indexedAttestation.AttestingIndices))
+func indexedAttestationSignatureSet(dom common.BLSDomain, pubCache *common.PubkeyCache,
+	indexedAttestation *IndexedAttestation) (pubkeys []*blsu.Pubkey, signingRoot common.Root, sig *blsu.Signature, err error) {
+	pubkeys = make([]*blsu.Pubkey, 0, len(indexedAttestation.AttestingIndices))
 	for _, i := range indexedAttestation.AttestingIndices {
 		pub, ok := pubCache.Pubkey(i)
 		if !ok {
-			return fmt.Errorf("could not find pubkey for index %d", i)
+			return nil, common.Root{}, nil, fmt.Errorf("could not find pubkey for index %d", i)
 		}
 		blsPub, err := pub.Pubkey()
 		if err != nil {
-			return fmt.Errorf("failed to deserialize pubkey in cache: %v", err)
+			return nil, common.Root{}, nil, fmt.Errorf("failed to deserialize pubkey in cache: %v", err)
 		}
 		pubkeys = append(pubkeys, blsPub)
 	}
 	// empty attestation. (Double check, since this function is public, the user might not have validated if it's empty or not)
 	if len(pubkeys) <= 0 {
-		return errors.New("in phase 0 no empty attestation signatures are allowed")
+		return nil, common.Root{}, nil, errors.New("in phase 0 no empty attestation signatures are allowed")
 	}
 
-	signingRoot := common.ComputeSigningRoot(indexedAttestation.Data.HashTreeRoot(tree.GetHashFn()), dom)
-	sig, err := indexedAttestation.Signature.Signature()
+	signingRoot = common.ComputeSigningRoot(indexedAttestation.Data.HashTreeRoot(tree.GetHashFn()), dom)
+	sig, err = indexedAttestation.Signature.Signature()
 	if err != nil {
-		return fmt.Errorf("failed to deserialize and sub-group check indexed attestation signature: %v", err)
+		return nil, common.Root{}, nil, fmt.Errorf("failed to deserialize and sub-group check indexed attestation signature: %v", err)
+	}
+	return pubkeys, signingRoot, sig, nil
+}
+
+// ValidateIndexedAttestationSignature checks the aggregate signature of the indexed attestation in the domain,
+// the indices must be valid.
+func ValidateIndexedAttestationSignature(spec *common.Spec, dom common.BLSDomain, pubCache *common.PubkeyCache, indexedAttestation *IndexedAttestation) error {
+	pubkeys, signingRoot, sig, err := indexedAttestationSignatureSet(dom, pubCache, indexedAttestation)
+	if err != nil {
+		return err
 	}
 	if !blsu.Eth2FastAggregateVerify(pubkeys, signingRoot[:], sig) {
 		return errors.New("could not verify BLS signature for indexed attestation")
@@ -125,11 +140,37 @@ func ValidateIndexedAttestationSignature(spec *common.Spec, dom common.BLSDomain
 	return nil
 }
 
-// Verify validity of slashable_attestation fields.
-func ValidateIndexedAttestation(spec *common.Spec, epc *common.EpochsContext, state common.BeaconState, indexedAttestation *IndexedAttestation) error {
+// VerifyIndexedAttestationSignature is like ValidateIndexedAttestationSignature, but verifies the signature
+// as part of the transition: if the transition has a signature batch, the signature is added to the batch of the block.
+// The description tells what the signature is of, to report it if it is invalid.
+// During a trusted block transition, the signature is not checked. The transition may be nil.
+func VerifyIndexedAttestationSignature(spec *common.Spec, epc *common.EpochsContext, tr *common.Transition, description string,
+	dom common.BLSDomain, indexedAttestation *IndexedAttestation) error {
+	if tr != nil && tr.SkipSignatures {
+		return nil
+	}
+	pubkeys, signingRoot, sig, err := indexedAttestationSignatureSet(dom, epc.ValidatorPubkeyCache, indexedAttestation)
+	if err != nil {
+		return err
+	}
+	if !tr.VerifyAggregateSignature(description, pubkeys, signingRoot[:], sig) {
+		return errors.New("could not verify BLS signature for indexed attestation")
+	}
+	return nil
+}
+
+// ValidateIndexedAttestation checks the indices of the indexed attestation, like is_valid_indexed_attestation
+// of the spec, without processing it. If verifySignature is true, the aggregate signature is verified too,
+// in the attester domain of the target epoch. Block processing checks the indices with this,
+// and verifies the signature separately, as part of the transition.
+func ValidateIndexedAttestation(spec *common.Spec, epc *common.EpochsContext, state common.BeaconState,
+	indexedAttestation *IndexedAttestation, verifySignature bool) error {
 	if err := ValidateIndexedAttestationNoSignature(spec, state, indexedAttestation); err != nil {
 		return err
 	}
+	if !verifySignature {
+		return nil
+	}
 	dom, err := common.GetDomain(state, common.DOMAIN_BEACON_ATTESTER, indexedAttestation.Data.Target.Epoch)
 	if err != nil {
 		return err
@@ -0,0 +1,91 @@
+package phase0
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/protolambda/zrnt/eth2/beacon/common"
+	"github.com/protolambda/zrnt/eth2/configs"
+)
+
+func testConvertIndexed(t *testing.T, spec *common.Spec, epc *common.EpochsContext, att *Attestation) (cached []common.ValidatorIndex, uncached []common.ValidatorIndex) {
+	t.Helper()
+	committee, err := epc.GetBeaconCommittee(att.Data.Slot, att.Data.Index)
+	if err != nil {
+		t.Fatal(err)
+	}
+	withCache, err := att.ConvertToIndexedWithCache(spec, epc, committee)
+	if err != nil {
+		t.Fatal(err)
+	}
+	withoutCache, err := att.ConvertToIndexed(spec, committee)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return withCache.AttestingIndices, withoutCache.AttestingIndices
+}
+
+func TestIndexedAttestationCache(t *testing.T) {
+	spec := configs.Minimal
+	keys := testKickstartValidators(t, 64)
+	shufflings := common.NewShufflingCache(8)
+	cache := common.NewIndexedAttestationCache(64)
+	newBranch := func(eth1Root common.Root) *common.EpochsContext {
+		state, _, err := KickStartState(spec, eth1Root, 1564000000, keys)
+		if err != nil {
+			t.Fatal(err)
+		}
+		epc, err := common.NewEpochsContextWithShufflingCache(spec, state, shufflings)
+		if err != nil {
+			t.Fatal(err)
+		}
+		epc.IndexedAttestationCache = cache
+		return epc
+	}
+	// a different eth1 root results in a different seed, and thus different committees
+	branchA := newBranch(common.Root{123})
+	branchB := newBranch(common.Root{124})
+	// the same shuffling, shared through the shuffling cache
+	siblingA := newBranch(common.Root{123})
+
+	different := 0
+	for slot := common.Slot(0); slot < spec.SLOTS_PER_EPOCH; slot++ {
+		committee, err := branchA.GetBeaconCommittee(slot, 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		// the same attestation is seen on both branches
+		att := &Attestation{
+			AggregationBits: NewAttestationBits(uint64(len(committee))),
+			Data:            AttestationData{Slot: slot, Index: 0},
+		}
+		att.AggregationBits.SetBit(0, true)
+		att.AggregationBits.SetBit(2, true)
+
+		cachedA, expectedA := testConvertIndexed(t, spec, branchA, att)
+		cachedB, expectedB := testConvertIndexed(t, spec, branchB, att)
+		if !reflect.DeepEqual(cachedA, expectedA) {
+			t.Fatalf("slot %d: cached indices %v do not match %v", slot, cachedA, expectedA)
+		}
+		if !reflect.DeepEqual(cachedB, expectedB) {
+			t.Fatalf("slot %d: cached indices of other branch %v do not match %v", slot, cachedB, expectedB)
+		}
+		if !reflect.DeepEqual(expectedA, expectedB) {
+			different++
+		}
+		hits, _ := cache.Stats()
+		cachedSibling, _ := testConvertIndexed(t, spec, siblingA, att)
+		if !reflect.DeepEqual(cachedSibling, expectedA) {
+			t.Fatalf("slot %d: cached indices of sibling %v do not match %v", slot, cachedSibling, expectedA)
+		}
+		if after, _ := cache.Stats(); after != hits+1 {
+			t.Fatalf("slot %d: expected the sibling with the same shuffling to hit the cache", slot)
+		}
+	}
+	if different == 0 {
+		t.Fatal("expected the branches to have different committees")
+	}
+	if n := cache.Len(); n != 2*int(spec.SLOTS_PER_EPOCH) {
+		t.Fatalf("expected an entry per branch and slot, got %d", n)
+	}
+}
@@ -0,0 +1,87 @@
+package phase0
+
+import (
+	"encoding/binary"
+	"strings"
+	"testing"
+
+	blsu "github.com/protolambda/bls12-381-util"
+	"github.com/protolambda/ztyp/tree"
+
+	"github.com/protolambda/zrnt/eth2/beacon/common"
+	"github.com/protolambda/zrnt/eth2/configs"
+)
+
+// testIndexedAttestation is signed by the given signers, with the secret keys of testKickstartValidators.
+func testIndexedAttestation(t *testing.T, state *BeaconStateView, indices []common.ValidatorIndex, signers ...common.ValidatorIndex) *IndexedAttestation {
+	data := AttestationData{BeaconBlockRoot: common.Root{1}, Target: common.Checkpoint{Epoch: 0}}
+	dom, err := common.GetDomain(state, common.DOMAIN_BEACON_ATTESTER, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	msg := common.ComputeSigningRoot(data.HashTreeRoot(tree.GetHashFn()), dom)
+	var sigs []*blsu.Signature
+	for _, i := range signers {
+		var raw [32]byte
+		binary.BigEndian.PutUint64(raw[24:], uint64(i)+1)
+		var sk blsu.SecretKey
+		if err := sk.Deserialize(&raw); err != nil {
+			t.Fatal(err)
+		}
+		sigs = append(sigs, blsu.Sign(&sk, msg[:]))
+	}
+	out := &IndexedAttestation{AttestingIndices: indices, Data: data}
+	if len(sigs) > 0 {
+		sig, err := blsu.Aggregate(sigs)
+		if err != nil {
+			t.Fatal(err)
+		}
+		out.Signature = sig.Serialize()
+	}
+	return out
+}
+
+func TestValidateIndexedAttestation(t *testing.T) {
+	spec := configs.Minimal
+	state, epc, err := KickStartState(spec, common.Root{123}, 1564000000, testKickstartValidators(t, 16))
+	if err != nil {
+		t.Fatal(err)
+	}
+	valid := testIndexedAttestation(t, state, []common.ValidatorIndex{1, 5, 9}, 1, 5, 9)
+	if err := ValidateIndexedAttestation(spec, epc, state, valid, true); err != nil {
+		t.Fatal(err)
+	}
+
+	tooMany := make([]common.ValidatorIndex, spec.MAX_VALIDATORS_PER_COMMITTEE+1)
+	for i := range tooMany {
+		tooMany[i] = common.ValidatorIndex(i)
+	}
+	invalid := []struct {
+		name string
+		att  *IndexedAttestation
+		err  string
+	}{
+		{"unsorted", testIndexedAttestation(t, state, []common.ValidatorIndex{5, 1, 9}, 1, 5, 9), "not sorted"},
+		{"duplicate", testIndexedAttestation(t, state, []common.ValidatorIndex{1, 5, 5}, 1, 5, 5), "duplicate"},
+		{"empty", testIndexedAttestation(t, state, nil), "no empty attestation"},
+		{"too many", testIndexedAttestation(t, state, tooMany, 1), "invalid indices count"},
+		{"out of range", testIndexedAttestation(t, state, []common.ValidatorIndex{1, 16}, 1), "out of range"},
+	}
+	for _, c := range invalid {
+		if err := ValidateIndexedAttestation(spec, epc, state, c.att, false); err == nil || !strings.Contains(err.Error(), c.err) {
+			t.Fatalf("%s: expected error %q, got %v", c.name, c.err, err)
+		}
+		if err := ValidateIndexedAttestation(spec, epc, state, c.att, true); err == nil || !strings.Contains(err.Error(), c.err) {
+			t.Fatalf("%s: expected error %q with signature, got %v", c.name, c.err, err)
+		}
+	}
+
+	// an aggregate of only some of the attesters is checked with the signature only
+	partial := testIndexedAttestation(t, state, []common.ValidatorIndex{1, 5, 9}, 1, 5)
+	if err := ValidateIndexedAttestation(spec, epc, state, partial, false); err != nil {
+		t.Fatal(err)
+	}
+	if err := ValidateIndexedAttestation(spec, epc, state, partial, true); err == nil || !strings.Contains(err.Error(), "BLS signature") {
+		t.Fatalf("expected invalid signature, got %v", err)
+	}
+}
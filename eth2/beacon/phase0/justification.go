@@ -2,6 +2,7 @@ package phase0
 
 import (
 	"context"
+	"fmt"
 
 	"github.com/protolambda/zrnt/eth2/beacon/common"
 )
@@ -16,6 +17,40 @@ type JustificationStakeData struct {
 	CurrEpochUnslashedTargetStake common.Gwei
 }
 
+// CheckParticipationTallies enables the verification of the participation tallies of the state
+// against the target stakes summed up during the epoch transition. A divergence fails the epoch transition.
+var CheckParticipationTallies = false
+
+// NewJustificationStakeData prepares the stake data of the epoch transition for justification.
+// The target stakes are taken from the participation tallies of the state if these are complete,
+// and from the given stakes summed up from the participation of the state otherwise.
+func NewJustificationStakeData(spec *common.Spec, epc *common.EpochsContext, tallies *common.ParticipationTallies,
+	prevEpochUnslashedTargetStake common.Gwei, currEpochUnslashedTargetStake common.Gwei) (*JustificationStakeData, error) {
+	out := &JustificationStakeData{
+		CurrentEpoch:                  epc.CurrentEpoch.Epoch,
+		TotalActiveStake:              epc.TotalActiveStake,
+		PrevEpochUnslashedTargetStake: prevEpochUnslashedTargetStake,
+		CurrEpochUnslashedTargetStake: currEpochUnslashedTargetStake,
+	}
+	prev, curr, ok := tallies.TargetStakes(epc.PreviousEpoch.Epoch, epc.CurrentEpoch.Epoch)
+	if !ok {
+		return out, nil
+	}
+	if prev < spec.EFFECTIVE_BALANCE_INCREMENT {
+		prev = spec.EFFECTIVE_BALANCE_INCREMENT
+	}
+	if curr < spec.EFFECTIVE_BALANCE_INCREMENT {
+		curr = spec.EFFECTIVE_BALANCE_INCREMENT
+	}
+	if CheckParticipationTallies && (prev != prevEpochUnslashedTargetStake || curr != currEpochUnslashedTargetStake) {
+		return nil, fmt.Errorf("participation tallies diverged: previous epoch target stake %d <> %d, current epoch target stake %d <> %d",
+			prev, prevEpochUnslashedTargetStake, curr, currEpochUnslashedTargetStake)
+	}
+	out.PrevEpochUnslashedTargetStake = prev
+	out.CurrEpochUnslashedTargetStake = curr
+	return out, nil
+}
+
 func ProcessEpochJustification(ctx context.Context, spec *common.Spec, data *JustificationStakeData, state common.BeaconState) error {
 	if err := ctx.Err(); err != nil {
 		return err
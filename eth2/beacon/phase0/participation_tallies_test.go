@@ -0,0 +1,98 @@
+package phase0
+
+import (
+	"context"
+	"testing"
+
+	"github.com/protolambda/zrnt/eth2/beacon/common"
+	"github.com/protolambda/zrnt/eth2/configs"
+)
+
+func TestParticipationTallies(t *testing.T) {
+	defer func(prev bool) { CheckParticipationTallies = prev }(CheckParticipationTallies)
+	CheckParticipationTallies = true
+
+	spec := configs.Minimal
+	ctx := context.Background()
+	state, epc, err := KickStartState(spec, common.Root{123}, 1564000000, testKickstartValidators(t, 64))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var other *BeaconStateView
+	var otherEpc *common.EpochsContext
+	// attest every slot, except for the first slot of every epoch, in the next slot.
+	// Attestations of the last slot of an epoch are included in the next epoch.
+	for slot := common.Slot(1); slot < 6*spec.SLOTS_PER_EPOCH; slot++ {
+		if err := common.ProcessSlots(ctx, spec, epc, testUpgradeableState{state}, slot); err != nil {
+			t.Fatalf("slot %d: %v", slot, err)
+		}
+		if other != nil {
+			if err := common.ProcessSlots(ctx, spec, otherEpc, testUpgradeableState{other}, slot); err != nil {
+				t.Fatalf("other, slot %d: %v", slot, err)
+			}
+		}
+		epoch := spec.SlotToEpoch(slot)
+		if slot%spec.SLOTS_PER_EPOCH == 1 {
+			if _, _, ok := state.ParticipationTallies().TargetStakes(epc.PreviousEpoch.Epoch, epoch); !ok {
+				t.Fatalf("expected complete tallies in epoch %d", epoch)
+			}
+		}
+		if (slot-1)%spec.SLOTS_PER_EPOCH == 0 {
+			continue
+		}
+		count, err := epc.GetCommitteeCountPerSlot(spec.SlotToEpoch(slot - 1))
+		if err != nil {
+			t.Fatal(err)
+		}
+		var att Attestation
+		for index := common.CommitteeIndex(0); uint64(index) < count; index++ {
+			att = testFullAttestation(t, spec, epc, state, slot-1, index)
+			if err := ProcessAttestation(spec, epc, state, &att); err != nil {
+				t.Fatalf("slot %d: %v", slot, err)
+			}
+			if other != nil {
+				if err := ProcessAttestation(spec, otherEpc, other, &att); err != nil {
+					t.Fatalf("other, slot %d: %v", slot, err)
+				}
+			}
+		}
+		if slot == 3*spec.SLOTS_PER_EPOCH+2 {
+			// continue a copy without the slashing, the copy must not see the changes of the original
+			copied, err := state.CopyState()
+			if err != nil {
+				t.Fatal(err)
+			}
+			other = copied.(*BeaconStateView)
+			otherEpc = epc.Clone()
+			// slash an attester of the previous and current epoch
+			committee, err := epc.GetBeaconCommittee(att.Data.Slot, att.Data.Index)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := SlashValidator(spec, epc, state, committee[0], nil); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	justified, err := state.CurrentJustifiedCheckpoint()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if justified.Epoch < 3 {
+		t.Fatalf("expected justification with the tallies, got %d", justified.Epoch)
+	}
+	prev, _, ok := state.ParticipationTallies().TargetStakes(epc.PreviousEpoch.Epoch, epc.CurrentEpoch.Epoch)
+	otherPrev, _, otherOk := other.ParticipationTallies().TargetStakes(otherEpc.PreviousEpoch.Epoch, otherEpc.CurrentEpoch.Epoch)
+	if !ok || !otherOk || prev >= otherPrev {
+		t.Fatalf("expected the slashed attester to be counted in the copy only: %d <> %d", prev, otherPrev)
+	}
+
+	// a decoded state starts with incomplete tallies
+	decoded, err := AsBeaconStateView(state.ContainerView.Copy())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, _, ok := decoded.ParticipationTallies().TargetStakes(epc.PreviousEpoch.Epoch, epc.CurrentEpoch.Epoch); ok {
+		t.Fatal("expected incomplete tallies of a state without history")
+	}
+}
@@ -183,6 +183,10 @@ func AsPendingAttestation(v View, err error) (*PendingAttestationView, error) {
 
 type PendingAttestations []*PendingAttestation
 
+func (li PendingAttestations) MarshalJSON() ([]byte, error) {
+	return common.MarshalJSONList(len(li), []*PendingAttestation(li))
+}
+
 func (a *PendingAttestations) Deserialize(spec *common.Spec, dr *codec.DecodingReader) error {
 	return dr.List(func() codec.Deserializable {
 		i := len(*a)
@@ -5,8 +5,6 @@ import (
 	"errors"
 	"fmt"
 
-	blsu "github.com/protolambda/bls12-381-util"
-
 	"github.com/protolambda/zrnt/eth2/beacon/common"
 	"github.com/protolambda/ztyp/codec"
 	"github.com/protolambda/ztyp/tree"
@@ -50,6 +48,10 @@ func BlockProposerSlashingsType(spec *common.Spec) ListTypeDef {
 
 type ProposerSlashings []ProposerSlashing
 
+func (li ProposerSlashings) MarshalJSON() ([]byte, error) {
+	return common.MarshalJSONList(len(li), []ProposerSlashing(li))
+}
+
 func (a *ProposerSlashings) Deserialize(spec *common.Spec, dr *codec.DecodingReader) error {
 	return dr.List(func() codec.Deserializable {
 		i := len(*a)
@@ -82,14 +84,26 @@ func (li ProposerSlashings) HashTreeRoot(spec *common.Spec, hFn tree.HashFn) com
 	}, length, uint64(spec.MAX_PROPOSER_SLASHINGS))
 }
 
-func ProcessProposerSlashings(ctx context.Context, spec *common.Spec, epc *common.EpochsContext, state common.BeaconState, ops []ProposerSlashing) error {
+// ProcessProposerSlashings processes the proposer slashings of a block, in order.
+// A slashing of a proposer that an earlier slashing of the block already slashed is rejected
+// with a DuplicateSlashingError, before its signatures are verified.
+func ProcessProposerSlashings(ctx context.Context, spec *common.Spec, epc *common.EpochsContext, tr *common.Transition, state common.BeaconState, ops []ProposerSlashing) error {
+	slashed := make(slashedInBlock, len(ops))
 	for i := range ops {
 		if err := ctx.Err(); err != nil {
 			return err
 		}
-		if err := ProcessProposerSlashing(spec, epc, state, &ops[i]); err != nil {
+		proposer := []common.ValidatorIndex{ops[i].SignedHeader1.Message.ProposerIndex}
+		tr.TraceBeforeOp(state, common.OpProposerSlashing, i)
+		err := slashed.duplicate(common.OpProposerSlashing, i, proposer)
+		if err == nil {
+			err = ProcessProposerSlashing(spec, epc, tr, state, &ops[i])
+		}
+		tr.TraceAfterOp(state, common.OpProposerSlashing, i, err)
+		if err != nil {
 			return err
 		}
+		slashed.add(i, proposer)
 	}
 	return nil
 }
@@ -110,7 +124,7 @@ func ValidateProposerSlashingNoSignature(spec *common.Spec, ps *ProposerSlashing
 	return nil
 }
 
-func ValidateProposerSlashing(spec *common.Spec, epc *common.EpochsContext, state common.BeaconState, ps *ProposerSlashing) error {
+func ValidateProposerSlashing(spec *common.Spec, epc *common.EpochsContext, tr *common.Transition, state common.BeaconState, ps *ProposerSlashing) error {
 	if err := ValidateProposerSlashingNoSignature(spec, ps); err != nil {
 		return err
 	}
@@ -127,17 +141,11 @@ func ValidateProposerSlashing(spec *common.Spec, epc *common.EpochsContext, stat
 	}
 	currentEpoch := epc.CurrentEpoch.Epoch
 	// Verify the proposer is slashable
-	validators, err := state.Validators()
+	validator, err := common.StateFlatValidators(state).Validator(state, proposerIndex)
 	if err != nil {
 		return err
 	}
-	validator, err := validators.Validator(proposerIndex)
-	if err != nil {
-		return err
-	}
-	if slashable, err := IsSlashable(validator, currentEpoch); err != nil {
-		return err
-	} else if !slashable {
+	if !validator.IsSlashable(currentEpoch) {
 		return errors.New("proposer slashing requires proposer to be slashable")
 	}
 	domain, err := common.GetDomain(state, common.DOMAIN_BEACON_PROPOSER, spec.SlotToEpoch(ps.SignedHeader1.Message.Slot))
@@ -163,17 +171,18 @@ func ValidateProposerSlashing(spec *common.Spec, epc *common.EpochsContext, stat
 		return err
 	}
 	// Verify signatures
-	if !blsu.Verify(blsPub, sigRoot1[:], sig1) {
+	tr.CountSignatures(string(common.OpProposerSlashing), 2)
+	if !tr.VerifySignature(fmt.Sprintf("proposer slashing header 1 of proposer %d", proposerIndex), blsPub, sigRoot1[:], sig1) {
 		return errors.New("proposer slashing header 1 has invalid BLS signature")
 	}
-	if !blsu.Verify(blsPub, sigRoot2[:], sig2) {
+	if !tr.VerifySignature(fmt.Sprintf("proposer slashing header 2 of proposer %d", proposerIndex), blsPub, sigRoot2[:], sig2) {
 		return errors.New("proposer slashing header 2 has invalid BLS signature")
 	}
 	return nil
 }
 
-func ProcessProposerSlashing(spec *common.Spec, epc *common.EpochsContext, state common.BeaconState, ps *ProposerSlashing) error {
-	if err := ValidateProposerSlashing(spec, epc, state, ps); err != nil {
+func ProcessProposerSlashing(spec *common.Spec, epc *common.EpochsContext, tr *common.Transition, state common.BeaconState, ps *ProposerSlashing) error {
+	if err := ValidateProposerSlashing(spec, epc, tr, state, ps); err != nil {
 		return err
 	}
 	return SlashValidator(spec, epc, state, ps.SignedHeader1.Message.ProposerIndex, nil)
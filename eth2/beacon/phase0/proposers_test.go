@@ -0,0 +1,163 @@
+package phase0
+
+import (
+	"sync"
+	"testing"
+
+	"github.com/protolambda/zrnt/eth2/beacon/common"
+	"github.com/protolambda/zrnt/eth2/configs"
+)
+
+func TestLazyProposers(t *testing.T) {
+	spec := configs.Minimal
+	state, epc, err := KickStartState(spec, common.Root{123}, 1564000000, testKickstartValidators(t, 64))
+	if err != nil {
+		t.Fatal(err)
+	}
+	slot, _ := spec.EpochStartSlot(3)
+	if err := state.SetSlot(slot); err != nil {
+		t.Fatal(err)
+	}
+	if err := epc.LoadShuffling(state); err != nil {
+		t.Fatal(err)
+	}
+	load := func() *common.ProposersEpoch {
+		props, err := common.ComputeProposers(spec, state, 3, epc.CurrentEpoch.ActiveIndices)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return props
+	}
+	all, err := load().ComputeAllProposers()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if uint64(len(all)) != uint64(spec.SLOTS_PER_EPOCH) {
+		t.Fatalf("expected %d proposers, got %d", spec.SLOTS_PER_EPOCH, len(all))
+	}
+
+	// lazy lookups, in reverse order and concurrently, must match the eager computation
+	lazy := load()
+	var wg sync.WaitGroup
+	for w := 0; w < 4; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := int(spec.SLOTS_PER_EPOCH) - 1; i >= 0; i-- {
+				got, err := lazy.GetBeaconProposer(slot + common.Slot(i))
+				if err != nil {
+					t.Error(err)
+					return
+				}
+				if got != all[i] {
+					t.Errorf("slot %d: lazy proposer %d does not match eager proposer %d", slot+common.Slot(i), got, all[i])
+				}
+			}
+		}()
+	}
+	wg.Wait()
+
+	// the eager path after a single lookup
+	partial := load()
+	if _, err := partial.GetBeaconProposer(slot + 5); err != nil {
+		t.Fatal(err)
+	}
+	again, err := partial.ComputeAllProposers()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := range all {
+		if again[i] != all[i] {
+			t.Fatalf("slot %d: proposer %d does not match %d", slot+common.Slot(i), again[i], all[i])
+		}
+	}
+	if _, err := lazy.GetBeaconProposer(slot + spec.SLOTS_PER_EPOCH); err == nil {
+		t.Fatal("expected error for lookup outside of the epoch")
+	}
+}
+
+func TestProposerCache(t *testing.T) {
+	spec := configs.Minimal
+	state, _, err := KickStartState(spec, common.Root{123}, 1564000000, testKickstartValidators(t, 64))
+	if err != nil {
+		t.Fatal(err)
+	}
+	slot, _ := spec.EpochStartSlot(3)
+	if err := state.SetSlot(slot); err != nil {
+		t.Fatal(err)
+	}
+	cache := common.NewProposerCache(4)
+	load := func(state *BeaconStateView) *common.EpochsContext {
+		epc, err := common.NewEpochsContextWithCaches(spec, state, nil, cache)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return epc
+	}
+	expected, err := load(state).Proposers.ComputeAllProposers()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// a sibling branch with different balances, but the same registry, shares the proposers
+	sibling, err := AsBeaconStateView(state.Copy())
+	if err != nil {
+		t.Fatal(err)
+	}
+	bals, err := sibling.Balances()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := bals.SetBalance(7, spec.MAX_EFFECTIVE_BALANCE/2); err != nil {
+		t.Fatal(err)
+	}
+	siblingEpc := load(sibling)
+	if hits, misses := cache.Stats(); hits != 1 || misses != 1 {
+		t.Fatalf("expected the sibling to share the proposers, got %d hits, %d misses", hits, misses)
+	}
+	for i := range expected {
+		got, err := siblingEpc.GetBeaconProposer(slot + common.Slot(i))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != expected[i] {
+			t.Fatalf("slot %d: shared proposer %d does not match %d", slot+common.Slot(i), got, expected[i])
+		}
+	}
+
+	// a branch with an extra slashing has a different registry, and computes its own proposers
+	slashed, err := AsBeaconStateView(state.Copy())
+	if err != nil {
+		t.Fatal(err)
+	}
+	slashedEpc := load(slashed)
+	if err := SlashValidator(spec, slashedEpc, slashed, 9, nil); err != nil {
+		t.Fatal(err)
+	}
+	if err := slashedEpc.LoadProposers(slashed); err != nil {
+		t.Fatal(err)
+	}
+	if hits, misses := cache.Stats(); hits != 2 || misses != 2 {
+		t.Fatalf("expected the slashed branch to compute its own proposers, got %d hits, %d misses", hits, misses)
+	}
+	if cache.Len() != 2 {
+		t.Fatalf("expected 2 cached proposer sequences, got %d", cache.Len())
+	}
+	uncached, err := common.ComputeProposers(spec, slashed, 3, slashedEpc.CurrentEpoch.ActiveIndices)
+	if err != nil {
+		t.Fatal(err)
+	}
+	uncachedAll, err := uncached.ComputeAllProposers()
+	if err != nil {
+		t.Fatal(err)
+	}
+	slashedAll, err := slashedEpc.Proposers.ComputeAllProposers()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := range uncachedAll {
+		if slashedAll[i] != uncachedAll[i] {
+			t.Fatalf("slot %d: proposer %d does not match uncached proposer %d", slot+common.Slot(i), slashedAll[i], uncachedAll[i])
+		}
+	}
+}
@@ -5,8 +5,6 @@ import (
 	"errors"
 	"fmt"
 
-	blsu "github.com/protolambda/bls12-381-util"
-
 	"github.com/protolambda/zrnt/eth2/beacon/common"
 	. "github.com/protolambda/zrnt/eth2/util/hashing"
 	"github.com/protolambda/ztyp/codec"
@@ -87,10 +85,10 @@ func SeedRandao(spec *common.Spec, seed common.Root) (*RandaoMixesView, error) {
 	return &RandaoMixesView{ComplexVectorView: vecView}, nil
 }
 
-func ProcessRandaoReveal(ctx context.Context, spec *common.Spec, epc *common.EpochsContext, state common.BeaconState, reveal common.BLSSignature) error {
-	if err := ctx.Err(); err != nil {
-		return err
-	}
+// VerifyRandaoReveal checks the reveal is the signature of the proposer of the state slot over the epoch of the slot.
+// The state must be processed up to the slot of the block. Like block processing,
+// it respects the signature batch and skipping of the transition, which may be nil.
+func VerifyRandaoReveal(spec *common.Spec, epc *common.EpochsContext, tr *common.Transition, state common.BeaconState, reveal common.BLSSignature) error {
 	slot, err := state.Slot()
 	if err != nil {
 		return err
@@ -117,10 +115,44 @@ func ProcessRandaoReveal(ctx context.Context, spec *common.Spec, epc *common.Epo
 	if err != nil {
 		return fmt.Errorf("failed to deserialize and sub-group check randao reveal: %v", err)
 	}
-	// Verify RANDAO reveal
-	if !blsu.Verify(blsPub, sigRoot[:], revealSig) {
+	tr.CountSignatures("randao", 1)
+	if !tr.VerifySignature("randao reveal", blsPub, sigRoot[:], revealSig) {
 		return errors.New("randao invalid")
 	}
+	return nil
+}
+
+// PredictNextRandaoMix returns the mix of the current epoch after mixing in the reveal, without changing the state.
+// The reveal is not verified.
+func PredictNextRandaoMix(spec *common.Spec, state common.BeaconState, reveal common.BLSSignature) (common.Root, error) {
+	slot, err := state.Slot()
+	if err != nil {
+		return common.Root{}, err
+	}
+	mixes, err := state.RandaoMixes()
+	if err != nil {
+		return common.Root{}, err
+	}
+	randMix, err := mixes.GetRandomMix(spec.SlotToEpoch(slot))
+	if err != nil {
+		return common.Root{}, err
+	}
+	return XorBytes32(randMix, Hash(reveal[:])), nil
+}
+
+func ProcessRandaoReveal(ctx context.Context, spec *common.Spec, epc *common.EpochsContext, tr *common.Transition, state common.BeaconState, reveal common.BLSSignature) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	// Verify RANDAO reveal
+	if err := VerifyRandaoReveal(spec, epc, tr, state, reveal); err != nil {
+		return err
+	}
+	slot, err := state.Slot()
+	if err != nil {
+		return err
+	}
+	epoch := spec.SlotToEpoch(slot)
 	mixes, err := state.RandaoMixes()
 	if err != nil {
 		return err
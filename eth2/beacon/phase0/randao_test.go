@@ -0,0 +1,74 @@
+package phase0
+
+import (
+	"context"
+	"encoding/binary"
+	"testing"
+
+	blsu "github.com/protolambda/bls12-381-util"
+	"github.com/protolambda/ztyp/tree"
+
+	"github.com/protolambda/zrnt/eth2/beacon/common"
+	"github.com/protolambda/zrnt/eth2/configs"
+)
+
+// testRandaoReveal is signed by the validator over the epoch, with the secret keys of testKickstartValidators.
+func testRandaoReveal(t *testing.T, state *BeaconStateView, signer common.ValidatorIndex, epoch common.Epoch) common.BLSSignature {
+	dom, err := common.GetDomain(state, common.DOMAIN_RANDAO, epoch)
+	if err != nil {
+		t.Fatal(err)
+	}
+	msg := common.ComputeSigningRoot(epoch.HashTreeRoot(tree.GetHashFn()), dom)
+	var raw [32]byte
+	binary.BigEndian.PutUint64(raw[24:], uint64(signer)+1)
+	var sk blsu.SecretKey
+	if err := sk.Deserialize(&raw); err != nil {
+		t.Fatal(err)
+	}
+	return blsu.Sign(&sk, msg[:]).Serialize()
+}
+
+func TestRandaoReveal(t *testing.T) {
+	spec := configs.Minimal
+	state, epc, err := KickStartState(spec, common.Root{123}, 1564000000, testKickstartValidators(t, 64))
+	if err != nil {
+		t.Fatal(err)
+	}
+	proposer, err := epc.GetBeaconProposer(0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	reveal := testRandaoReveal(t, state, proposer, 0)
+	if err := VerifyRandaoReveal(spec, epc, nil, state, reveal); err != nil {
+		t.Fatal(err)
+	}
+	if err := VerifyRandaoReveal(spec, epc, nil, state, testRandaoReveal(t, state, proposer, 1)); err == nil {
+		t.Fatal("expected reveal of the wrong epoch to be invalid")
+	}
+	if err := VerifyRandaoReveal(spec, epc, nil, state, testRandaoReveal(t, state, (proposer+1)%64, 0)); err == nil {
+		t.Fatal("expected reveal of another validator to be invalid")
+	}
+
+	root := state.HashTreeRoot(tree.GetHashFn())
+	predicted, err := PredictNextRandaoMix(spec, state, reveal)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if state.HashTreeRoot(tree.GetHashFn()) != root {
+		t.Fatal("prediction changed the state")
+	}
+	if err := ProcessRandaoReveal(context.Background(), spec, epc, nil, state, reveal); err != nil {
+		t.Fatal(err)
+	}
+	mixes, err := state.RandaoMixes()
+	if err != nil {
+		t.Fatal(err)
+	}
+	mix, err := mixes.GetRandomMix(0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if mix != predicted {
+		t.Fatalf("predicted mix %s, got %s", predicted, mix)
+	}
+}
@@ -43,6 +43,10 @@ func (p RegistryIndices) HashTreeRoot(spec *common.Spec, hFn tree.HashFn) common
 
 type ValidatorRegistry []*Validator
 
+func (li ValidatorRegistry) MarshalJSON() ([]byte, error) {
+	return common.MarshalJSONList(len(li), []*Validator(li))
+}
+
 func (a *ValidatorRegistry) Deserialize(spec *common.Spec, dr *codec.DecodingReader) error {
 	return dr.List(func() codec.Deserializable {
 		i := len(*a)
@@ -114,6 +118,15 @@ func (registry *ValidatorsRegistryView) IsValidIndex(index common.ValidatorIndex
 	return uint64(index) < count, nil
 }
 
+// ParallelHashTreeRoot computes the registry root with a worker per CPU,
+// or serially if there are not enough validators to benefit from it.
+func (registry *ValidatorsRegistryView) ParallelHashTreeRoot() common.Root {
+	if count, err := registry.Length(); err != nil || count < common.ParallelHashThreshold {
+		return registry.HashTreeRoot(tree.GetHashFn())
+	}
+	return common.ParallelMerkleRoot(registry.Backing(), 0)
+}
+
 type RegistryProcessData struct {
 	IndicesToSetActivationEligibility []common.ValidatorIndex
 	// Ignores churn. Apply churn-limit manually.
@@ -0,0 +1,102 @@
+package phase0
+
+import (
+	"bytes"
+	"encoding/binary"
+	"testing"
+
+	"github.com/protolambda/zrnt/eth2/beacon/common"
+	"github.com/protolambda/zrnt/eth2/configs"
+	"github.com/protolambda/ztyp/codec"
+	"github.com/protolambda/ztyp/tree"
+)
+
+func testRegistry(count uint64) ValidatorRegistry {
+	out := make(ValidatorRegistry, 0, count)
+	for i := uint64(0); i < count; i++ {
+		v := &Validator{
+			EffectiveBalance:           32_000_000_000,
+			ActivationEligibilityEpoch: common.Epoch(i % 7),
+			ActivationEpoch:            common.Epoch(i % 11),
+			ExitEpoch:                  common.FAR_FUTURE_EPOCH,
+			WithdrawableEpoch:          common.FAR_FUTURE_EPOCH,
+		}
+		binary.LittleEndian.PutUint64(v.Pubkey[:], i)
+		binary.LittleEndian.PutUint64(v.WithdrawalCredentials[1:], i)
+		out = append(out, v)
+	}
+	return out
+}
+
+func testRegistryView(t *testing.T, spec *common.Spec, raw ValidatorRegistry) *ValidatorsRegistryView {
+	var buf bytes.Buffer
+	if err := raw.Serialize(spec, codec.NewEncodingWriter(&buf)); err != nil {
+		t.Fatal(err)
+	}
+	view, err := AsValidatorsRegistry(ValidatorsRegistryType(spec).Deserialize(
+		codec.NewDecodingReader(bytes.NewReader(buf.Bytes()), uint64(buf.Len()))))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return view
+}
+
+func TestValidatorsRegistryParallelHashTreeRoot(t *testing.T) {
+	spec := configs.Minimal
+	for _, count := range []uint64{0, 1, 3, 100, common.ParallelHashThreshold + 123} {
+		raw := testRegistry(count)
+		expected := raw.HashTreeRoot(spec, tree.GetHashFn())
+		for _, workers := range []int{1, 2, 3, 8, 64} {
+			view := testRegistryView(t, spec, raw)
+			if got := common.ParallelMerkleRoot(view.Backing(), workers); got != expected {
+				t.Fatalf("count %d, workers %d: got %s, expected %s", count, workers, got, expected)
+			}
+		}
+		view := testRegistryView(t, spec, raw)
+		if got := view.ParallelHashTreeRoot(); got != expected {
+			t.Fatalf("count %d: got %s, expected %s", count, got, expected)
+		}
+		if count == 0 {
+			continue
+		}
+		// change a validator after hashing, only part of the tree has to be re-hashed
+		val, err := view.Validator(common.ValidatorIndex(count / 2))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := val.MakeSlashed(); err != nil {
+			t.Fatal(err)
+		}
+		raw[count/2].Slashed = true
+		expected = raw.HashTreeRoot(spec, tree.GetHashFn())
+		if got := view.ParallelHashTreeRoot(); got != expected {
+			t.Fatalf("count %d, after change: got %s, expected %s", count, got, expected)
+		}
+	}
+}
+
+// Validators set to the same value share their nodes, across the subtrees that are hashed by different workers.
+// Run with -race: every node must be hashed by a single worker.
+func TestValidatorsRegistryParallelHashTreeRootShared(t *testing.T) {
+	spec := configs.Minimal
+	count := uint64(common.ParallelHashThreshold + 123)
+	raw := testRegistry(count)
+	for _, workers := range []int{2, 3, 8, 64} {
+		view := testRegistryView(t, spec, raw)
+		shared, err := view.Validator(5)
+		if err != nil {
+			t.Fatal(err)
+		}
+		expectedRaw := append(ValidatorRegistry(nil), raw...)
+		for i := uint64(7); i < count; i += 97 {
+			if err := view.Set(i, shared.(*ValidatorView)); err != nil {
+				t.Fatal(err)
+			}
+			expectedRaw[i] = raw[5]
+		}
+		expected := expectedRaw.HashTreeRoot(spec, tree.GetHashFn())
+		if got := common.ParallelMerkleRoot(view.Backing(), workers); got != expected {
+			t.Fatalf("workers %d: got %s, expected %s", workers, got, expected)
+		}
+	}
+}
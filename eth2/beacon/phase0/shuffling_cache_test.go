@@ -0,0 +1,156 @@
+package phase0
+
+import (
+	"encoding/binary"
+	"testing"
+
+	blsu "github.com/protolambda/bls12-381-util"
+	"github.com/protolambda/zrnt/eth2/beacon/common"
+	"github.com/protolambda/zrnt/eth2/configs"
+)
+
+func testKickstartValidators(t testing.TB, count uint64) []KickstartValidatorData {
+	validators := make([]KickstartValidatorData, 0, count)
+	for i := uint64(0); i < count; i++ {
+		var data [32]byte
+		binary.BigEndian.PutUint64(data[24:], i+1)
+		var sk blsu.SecretKey
+		if err := sk.Deserialize(&data); err != nil {
+			t.Fatal(err)
+		}
+		pub, err := blsu.SkToPk(&sk)
+		if err != nil {
+			t.Fatal(err)
+		}
+		validators = append(validators, KickstartValidatorData{
+			Pubkey:                pub.Serialize(),
+			WithdrawalCredentials: common.Root{0xbb},
+			Balance:               configs.Minimal.MAX_EFFECTIVE_BALANCE,
+		})
+	}
+	return validators
+}
+
+func TestShufflingCacheSiblings(t *testing.T) {
+	spec := configs.Minimal
+	state, _, err := KickStartState(spec, common.Root{123}, 1564000000, testKickstartValidators(t, 64))
+	if err != nil {
+		t.Fatal(err)
+	}
+	slot, _ := spec.EpochStartSlot(3)
+	if err := state.SetSlot(slot + 2); err != nil {
+		t.Fatal(err)
+	}
+	// sibling branch: different block, same shuffling
+	sibling, err := AsBeaconStateView(state.Copy())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := sibling.SetEth1Data(common.Eth1Data{BlockHash: common.Root{0xaa}}); err != nil {
+		t.Fatal(err)
+	}
+
+	cache := common.NewShufflingCache(4)
+	a, err := common.NewEpochsContextWithShufflingCache(spec, state, cache)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if hits, misses := cache.Stats(); hits != 0 || misses != 3 {
+		t.Fatalf("expected 3 misses for first context, got %d hits, %d misses", hits, misses)
+	}
+	b, err := common.NewEpochsContextWithShufflingCache(spec, sibling, cache)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if hits, misses := cache.Stats(); hits != 3 || misses != 3 {
+		t.Fatalf("expected 3 hits for sibling context, got %d hits, %d misses", hits, misses)
+	}
+	if a.CurrentEpoch != b.CurrentEpoch || a.PreviousEpoch != b.PreviousEpoch || a.NextEpoch != b.NextEpoch {
+		t.Fatal("expected shufflings to be shared")
+	}
+	// compare against an uncached context
+	expected, err := common.NewEpochsContext(spec, sibling)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for s := slot; s < slot+spec.SLOTS_PER_EPOCH; s++ {
+		got, err := b.GetBeaconCommittee(s, 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		exp, err := expected.GetBeaconCommittee(s, 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(got) != len(exp) {
+			t.Fatalf("slot %d: committee length %d, expected %d", s, len(got), len(exp))
+		}
+		for i := range got {
+			if got[i] != exp[i] {
+				t.Fatalf("slot %d: committee member %d is %d, expected %d", s, i, got[i], exp[i])
+			}
+		}
+	}
+
+	// a different randao mix results in a different seed, and a different shuffling
+	mixes, err := sibling.RandaoMixes()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := mixes.SetRandomMix(0, common.Root{1}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := common.NewEpochsContextWithShufflingCache(spec, sibling, cache); err != nil {
+		t.Fatal(err)
+	}
+	if _, misses := cache.Stats(); misses == 3 {
+		t.Fatal("expected new misses after changing the seed")
+	}
+	if cache.Len() > 4 {
+		t.Fatalf("cache exceeded its bound: %d entries", cache.Len())
+	}
+}
+
+// A cache can be shared between specs: the shufflings of a different preset are not mixed up.
+func TestShufflingCacheSpecs(t *testing.T) {
+	spec := configs.Minimal
+	state, _, err := KickStartState(spec, common.Root{123}, 1564000000, testKickstartValidators(t, 64))
+	if err != nil {
+		t.Fatal(err)
+	}
+	cache := common.NewShufflingCache(16)
+	a, err := common.NewEpochsContextWithShufflingCache(spec, state, cache)
+	if err != nil {
+		t.Fatal(err)
+	}
+	renamed := *spec
+	renamed.PresetName = "custom"
+	if _, err := common.NewEpochsContextWithShufflingCache(&renamed, state, cache); err != nil {
+		t.Fatal(err)
+	}
+	if hits, _ := cache.Stats(); hits != 0 {
+		t.Fatalf("expected no hits for a different preset, got %d", hits)
+	}
+	// same preset name, but a different shuffling
+	rounds := *spec
+	rounds.SHUFFLE_ROUND_COUNT = 5
+	b, err := common.NewEpochsContextWithShufflingCache(&rounds, state, cache)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if hits, _ := cache.Stats(); hits != 0 {
+		t.Fatalf("expected no hits for different preset values, got %d", hits)
+	}
+	expected, err := common.NewEpochsContext(&rounds, state)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if a.CurrentEpoch == b.CurrentEpoch {
+		t.Fatal("expected a different shuffling")
+	}
+	for i, vi := range b.CurrentEpoch.Shuffling {
+		if vi != expected.CurrentEpoch.Shuffling[i] {
+			t.Fatalf("shuffling position %d is %d, expected %d", i, vi, expected.CurrentEpoch.Shuffling[i])
+		}
+	}
+}
@@ -126,12 +126,20 @@ func SlashValidator(spec *common.Spec, epc *common.EpochsContext, state common.B
 		if err := v.SetWithdrawableEpoch(withdrawalEpoch); err != nil {
 			return err
 		}
+	} else {
+		withdrawalEpoch = prevWithdrawalEpoch
 	}
+	common.StateFlatValidators(state).Update(state, slashedIndex, func(v *common.FlatValidator) {
+		v.Slashed = true
+		v.WithdrawableEpoch = withdrawalEpoch
+	})
 
 	effectiveBalance, err := v.EffectiveBalance()
 	if err != nil {
 		return err
 	}
+	// slashed validators do not count towards justification
+	common.StateParticipationTallies(state).RemoveAttester(slashedIndex, effectiveBalance)
 
 	slashings, err := state.Slashings()
 	if err != nil {
@@ -172,7 +180,8 @@ func SlashValidator(spec *common.Spec, epc *common.EpochsContext, state common.B
 	return nil
 }
 
-func ProcessEpochSlashings(ctx context.Context, spec *common.Spec, epc *common.EpochsContext, flats []common.FlatValidator, state common.BeaconState) error {
+func ProcessEpochSlashings(ctx context.Context, spec *common.Spec, epc *common.EpochsContext, scratch *common.EpochProcessScratch,
+	flats []common.FlatValidator, state common.BeaconState) error {
 	if err := ctx.Err(); err != nil {
 		return err
 	}
@@ -204,11 +213,7 @@ func ProcessEpochSlashings(ctx context.Context, spec *common.Spec, epc *common.E
 		adjustedTotalSlashingBalance = slashingsWeight
 	}
 
-	bals, err := state.Balances()
-	if err != nil {
-		return err
-	}
-
+	var penalties *common.Deltas
 	slashingsEpoch := epc.CurrentEpoch.Epoch + (spec.EPOCHS_PER_SLASHINGS_VECTOR / 2)
 	for i := 0; i < len(flats); i++ {
 		flat := &flats[i]
@@ -219,10 +224,14 @@ func ProcessEpochSlashings(ctx context.Context, spec *common.Spec, epc *common.E
 			penaltyNumerator *= adjustedTotalSlashingBalance
 			penalty := penaltyNumerator / totalActiveStake * spec.EFFECTIVE_BALANCE_INCREMENT
 
-			if err := common.DecreaseBalance(bals, common.ValidatorIndex(i), penalty); err != nil {
-				return err
+			if penalties == nil {
+				penalties = scratch.Deltas(uint64(len(flats)))
 			}
+			penalties.Penalties[i] = penalty
 		}
 	}
-	return nil
+	if penalties == nil {
+		return nil
+	}
+	return common.ApplyBalanceDeltas(spec, state, penalties.Rewards, penalties.Penalties)
 }
@@ -0,0 +1,101 @@
+package phase0
+
+import (
+	"bytes"
+	"context"
+	"sync"
+	"testing"
+
+	"github.com/protolambda/ztyp/codec"
+	"github.com/protolambda/ztyp/tree"
+
+	"github.com/protolambda/zrnt/eth2/beacon/common"
+	"github.com/protolambda/zrnt/eth2/configs"
+)
+
+const testSpecScopeVotes = 40
+
+// Runs the first epoch of a chain, with more eth1 votes than a minimal voting period fits.
+func testSpecScopeTransition(spec *common.Spec, keys []KickstartValidatorData) (state *BeaconStateView, accepted uint64, err error) {
+	state, epc, err := KickStartState(spec, common.Root{123}, 1564000000, keys)
+	if err != nil {
+		return nil, 0, err
+	}
+	for i := uint64(0); i < testSpecScopeVotes; i++ {
+		vote := common.Eth1Data{DepositCount: common.DepositIndex(len(keys)), BlockHash: common.Root{byte(i)}}
+		if err := ProcessEth1Vote(context.Background(), spec, epc, state, vote); err != nil {
+			break
+		}
+		accepted++
+	}
+	slot, err := spec.EpochStartSlot(1)
+	if err != nil {
+		return nil, 0, err
+	}
+	if err := common.ProcessSlots(context.Background(), spec, epc, testUpgradeableState{state}, slot); err != nil {
+		return nil, 0, err
+	}
+	return state, accepted, nil
+}
+
+// A mainnet and a minimal chain can be processed side by side, each with the limits of its own spec.
+func TestSpecScopeConcurrent(t *testing.T) {
+	specs := []*common.Spec{configs.Mainnet, configs.Minimal}
+	keys := testKickstartValidators(t, 64)
+	states := make([]*BeaconStateView, len(specs))
+	accepted := make([]uint64, len(specs))
+	errs := make([]error, len(specs))
+	var wg sync.WaitGroup
+	for i, spec := range specs {
+		wg.Add(1)
+		go func(i int, spec *common.Spec) {
+			defer wg.Done()
+			states[i], accepted[i], errs[i] = testSpecScopeTransition(spec, keys)
+		}(i, spec)
+	}
+	wg.Wait()
+
+	for i, spec := range specs {
+		if errs[i] != nil {
+			t.Fatalf("%s: %v", spec.PresetName, errs[i])
+		}
+		period := uint64(spec.EPOCHS_PER_ETH1_VOTING_PERIOD) * uint64(spec.SLOTS_PER_EPOCH)
+		expected := uint64(testSpecScopeVotes)
+		if period < expected {
+			expected = period
+		}
+		if accepted[i] != expected {
+			t.Errorf("%s: expected %d accepted eth1 votes, got %d", spec.PresetName, expected, accepted[i])
+		}
+		slot, err := states[i].Slot()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if slot != common.Slot(spec.SLOTS_PER_EPOCH) {
+			t.Errorf("%s: expected state at slot %d, got %d", spec.PresetName, spec.SLOTS_PER_EPOCH, slot)
+		}
+	}
+	if accepted[0] == accepted[1] {
+		t.Fatal("expected different eth1 vote limits")
+	}
+
+	// the mainnet state does not fit the minimal state type
+	var buf bytes.Buffer
+	if err := states[0].Serialize(codec.NewEncodingWriter(&buf)); err != nil {
+		t.Fatal(err)
+	}
+	decode := func(spec *common.Spec) (*BeaconStateView, error) {
+		return AsBeaconStateView(BeaconStateType(spec).Deserialize(
+			codec.NewDecodingReader(bytes.NewReader(buf.Bytes()), uint64(buf.Len()))))
+	}
+	if _, err := decode(configs.Minimal); err == nil {
+		t.Fatal("expected minimal state type to reject the mainnet eth1 votes")
+	}
+	decoded, err := decode(configs.Mainnet)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if decoded.HashTreeRoot(tree.GetHashFn()) != states[0].HashTreeRoot(tree.GetHashFn()) {
+		t.Fatal("decoded mainnet state does not match")
+	}
+}
@@ -160,17 +160,35 @@ func BeaconStateType(spec *common.Spec) *ContainerTypeDef {
 //	state, err := beacon.AsBeaconStateView(beacon.BeaconStateType.Deserialize(codec.NewDecodingReader(reader, size)))
 func AsBeaconStateView(v View, err error) (*BeaconStateView, error) {
 	c, err := AsContainer(v, err)
-	return &BeaconStateView{c}, err
+	return &BeaconStateView{ContainerView: c, tallies: common.NewParticipationTallies(), flats: common.NewFlatValidatorCache()}, err
 }
 
 type BeaconStateView struct {
 	*ContainerView
+	rootMemo common.StateRootMemo
+	tallies  *common.ParticipationTallies
+	flats    *common.FlatValidatorCache
 }
 
 var _ common.BeaconState = (*BeaconStateView)(nil)
 
 func NewBeaconStateView(spec *common.Spec) *BeaconStateView {
-	return &BeaconStateView{ContainerView: BeaconStateType(spec).New()}
+	return &BeaconStateView{ContainerView: BeaconStateType(spec).New(), tallies: common.NewParticipationTallies(), flats: common.NewFlatValidatorCache()}
+}
+
+// HashTreeRoot returns the state root, memoized until the state is mutated.
+func (state *BeaconStateView) HashTreeRoot(hFn tree.HashFn) common.Root {
+	return state.rootMemo.HashTreeRoot(state.Backing(), hFn)
+}
+
+// ParticipationTallies returns the target-attesting stake tallies of the state, see common.ParticipationTallies.
+func (state *BeaconStateView) ParticipationTallies() *common.ParticipationTallies {
+	return state.tallies
+}
+
+// FlatValidators returns the flat validator snapshot of the state, see common.FlatValidatorCache.
+func (state *BeaconStateView) FlatValidators() *common.FlatValidatorCache {
+	return state.flats
 }
 
 func (state *BeaconStateView) GenesisTime() (common.Timestamp, error) {
@@ -409,6 +427,15 @@ func (state *BeaconStateView) ForkSettings(spec *common.Spec) *common.ForkSettin
 	}
 }
 
+// View converts the flattened state into a tree-structured state, the reverse of BeaconStateView.Raw.
+func (v *BeaconState) View(spec *common.Spec) (*BeaconStateView, error) {
+	var buf bytes.Buffer
+	if err := v.Serialize(spec, codec.NewEncodingWriter(&buf)); err != nil {
+		return nil, err
+	}
+	return AsBeaconStateView(BeaconStateType(spec).Deserialize(codec.NewDecodingReader(bytes.NewReader(buf.Bytes()), uint64(len(buf.Bytes())))))
+}
+
 // Raw converts the tree-structured state into a flattened native Go structure.
 func (state *BeaconStateView) Raw(spec *common.Spec) (*BeaconState, error) {
 	var buf bytes.Buffer
@@ -424,5 +451,11 @@ func (state *BeaconStateView) Raw(spec *common.Spec) (*BeaconState, error) {
 }
 
 func (state *BeaconStateView) CopyState() (common.BeaconState, error) {
-	return AsBeaconStateView(state.ContainerView.Copy())
+	out, err := AsBeaconStateView(state.ContainerView.Copy())
+	if err != nil {
+		return nil, err
+	}
+	out.tallies = state.tallies.Clone()
+	out.flats = state.flats.Clone()
+	return out, nil
 }
@@ -1,10 +1,16 @@
 package phase0
 
 import (
+	"bytes"
+	"context"
 	"encoding/json"
+	"sync"
 	"testing"
 
+	"github.com/protolambda/zrnt/eth2/beacon/common"
 	"github.com/protolambda/zrnt/eth2/configs"
+	"github.com/protolambda/ztyp/codec"
+	"github.com/protolambda/ztyp/tree"
 	"gopkg.in/yaml.v3"
 )
 
@@ -45,3 +51,95 @@ func TestWrapperYAMLProxy(t *testing.T) {
 		t.Fatalf("failed to marshal/unmarshal JSON roundtrip wrapped BeaconState: %d <> %d", other.Slot, state.Slot)
 	}
 }
+
+// The state view memoizes its root: repeated state root queries do not re-hash anything,
+// and a mutation through the view only re-hashes the path of the changed node.
+func TestStateRootMemo(t *testing.T) {
+	spec := configs.Minimal
+	state, epc, err := KickStartState(spec, common.Root{123}, 1564000000, testKickstartValidators(t, 64))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := common.ProcessSlots(context.Background(), spec, epc, testUpgradeableState{state}, 3); err != nil {
+		t.Fatal(err)
+	}
+	hashes := 0
+	baseHFn := tree.GetHashFn()
+	hFn := tree.HashFn(func(a tree.Root, b tree.Root) tree.Root {
+		hashes++
+		return baseHFn(a, b)
+	})
+	freshRoot := func() common.Root {
+		var buf bytes.Buffer
+		if err := state.Serialize(codec.NewEncodingWriter(&buf)); err != nil {
+			t.Fatal(err)
+		}
+		fresh, err := AsBeaconStateView(BeaconStateType(spec).Deserialize(
+			codec.NewDecodingReader(bytes.NewReader(buf.Bytes()), uint64(buf.Len()))))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return fresh.HashTreeRoot(baseHFn)
+	}
+
+	root := state.HashTreeRoot(hFn)
+	hashes = 0
+	if state.HashTreeRoot(hFn) != root || hashes != 0 {
+		t.Fatalf("expected memoized state root, got %d hashes", hashes)
+	}
+
+	vals, err := state.Validators()
+	if err != nil {
+		t.Fatal(err)
+	}
+	v, err := vals.Validator(37)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := v.SetEffectiveBalance(spec.EFFECTIVE_BALANCE_INCREMENT); err != nil {
+		t.Fatal(err)
+	}
+	hashes = 0
+	changed := state.HashTreeRoot(hFn)
+	if changed == root {
+		t.Fatal("expected state root to change after mutating a validator")
+	}
+	if changed != freshRoot() {
+		t.Fatal("memoized state root does not match the root of a fresh copy")
+	}
+	// validator fields, validator index in the registry, registry length mix-in, and the state fields
+	if limit := 3 + 40 + 1 + 5; hashes == 0 || hashes > limit {
+		t.Fatalf("expected only the path of the validator to be re-hashed, got %d hashes", hashes)
+	}
+	hashes = 0
+	if state.HashTreeRoot(hFn) != changed || hashes != 0 {
+		t.Fatalf("expected memoized state root after the change, got %d hashes", hashes)
+	}
+}
+
+// Run with -race: concurrent root queries of the same state must not race on the memo.
+func TestStateRootMemoConcurrent(t *testing.T) {
+	spec := configs.Minimal
+	state, _, err := KickStartState(spec, common.Root{123}, 1564000000, testKickstartValidators(t, 64))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := state.SetSlot(7); err != nil {
+		t.Fatal(err)
+	}
+	roots := make([]common.Root, 8)
+	var wg sync.WaitGroup
+	wg.Add(len(roots))
+	for i := range roots {
+		go func(i int) {
+			defer wg.Done()
+			roots[i] = state.HashTreeRoot(tree.GetHashFn())
+		}(i)
+	}
+	wg.Wait()
+	for i := range roots {
+		if roots[i] != roots[0] {
+			t.Fatalf("root %d differs: %s <> %s", i, roots[i], roots[0])
+		}
+	}
+}
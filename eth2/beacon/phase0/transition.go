@@ -7,59 +7,74 @@ import (
 	"github.com/protolambda/zrnt/eth2/beacon/common"
 )
 
-func (state *BeaconStateView) ProcessEpoch(ctx context.Context, spec *common.Spec, epc *common.EpochsContext) error {
+func (state *BeaconStateView) ProcessEpoch(ctx context.Context, spec *common.Spec, epc *common.EpochsContext, tr *common.Transition) error {
+	scratch := tr.EpochScratch()
 	vals, err := state.Validators()
 	if err != nil {
 		return err
 	}
-	flats, err := common.FlattenValidators(vals)
+	flats, err := scratch.FlattenValidators(vals)
 	if err != nil {
 		return err
 	}
-	attesterData, err := ComputeEpochAttesterData(ctx, spec, epc, flats, state)
+	attesterData, err := ComputeEpochAttesterData(ctx, spec, epc, scratch, flats, state)
 	if err != nil {
 		return err
 	}
-	just := JustificationStakeData{
-		CurrentEpoch:                  epc.CurrentEpoch.Epoch,
-		TotalActiveStake:              epc.TotalActiveStake,
-		PrevEpochUnslashedTargetStake: attesterData.PrevEpochUnslashedStake.TargetStake,
-		CurrEpochUnslashedTargetStake: attesterData.CurrEpochUnslashedTargetStake,
+	if scratch != nil {
+		defer releaseAttesterStatuses(attesterData.Statuses)
 	}
-	if err := ProcessEpochJustification(ctx, spec, &just, state); err != nil {
+	just, err := NewJustificationStakeData(spec, epc, state.ParticipationTallies(),
+		attesterData.PrevEpochUnslashedStake.TargetStake, attesterData.CurrEpochUnslashedTargetStake)
+	if err != nil {
+		return err
+	}
+	if err := ProcessEpochJustification(ctx, spec, just, state); err != nil {
 		return err
 	}
-	if err := ProcessEpochRewardsAndPenalties(ctx, spec, epc, attesterData, state); err != nil {
+	tr.TraceEpochStage(state, common.EpochStageJustification)
+	if err := ProcessEpochRewardsAndPenalties(ctx, spec, epc, scratch, attesterData, state); err != nil {
 		return err
 	}
+	tr.TraceEpochStage(state, common.EpochStageRewardsAndPenalties)
 	if err := ProcessEpochRegistryUpdates(ctx, spec, epc, flats, state); err != nil {
 		return err
 	}
-	if err := ProcessEpochSlashings(ctx, spec, epc, flats, state); err != nil {
+	tr.TraceEpochStage(state, common.EpochStageRegistryUpdates)
+	if err := ProcessEpochSlashings(ctx, spec, epc, scratch, flats, state); err != nil {
 		return err
 	}
+	tr.TraceEpochStage(state, common.EpochStageSlashings)
 	if err := ProcessEth1DataReset(ctx, spec, epc, state); err != nil {
 		return err
 	}
+	tr.TraceEpochStage(state, common.EpochStageEth1DataReset)
 	if err := ProcessEffectiveBalanceUpdates(ctx, spec, epc, flats, state); err != nil {
 		return err
 	}
+	tr.TraceEpochStage(state, common.EpochStageEffectiveBalanceUpdates)
 	if err := ProcessSlashingsReset(ctx, spec, epc, state); err != nil {
 		return err
 	}
+	tr.TraceEpochStage(state, common.EpochStageSlashingsReset)
 	if err := ProcessRandaoMixesReset(ctx, spec, epc, state); err != nil {
 		return err
 	}
+	tr.TraceEpochStage(state, common.EpochStageRandaoMixesReset)
 	if err := ProcessHistoricalRootsUpdate(ctx, spec, epc, state); err != nil {
 		return err
 	}
+	tr.TraceEpochStage(state, common.EpochStageHistoricalRootsUpdate)
 	if err := ProcessParticipationRecordUpdates(ctx, spec, epc, state); err != nil {
 		return err
 	}
+	tr.TraceEpochStage(state, common.EpochStageParticipationRecordUpdates)
+	// the effective balances of the flat validators are updated, the previous tally is summed up with these
+	state.ParticipationTallies().Rotate(epc.NextEpoch.Epoch, flats)
 	return nil
 }
 
-func (state *BeaconStateView) ProcessBlock(ctx context.Context, spec *common.Spec, epc *common.EpochsContext, benv *common.BeaconBlockEnvelope) error {
+func (state *BeaconStateView) ProcessBlock(ctx context.Context, spec *common.Spec, epc *common.EpochsContext, tr *common.Transition, benv *common.BeaconBlockEnvelope) error {
 	body, ok := benv.Body.(*BeaconBlockBody)
 	if !ok {
 		return fmt.Errorf("unexpected block type %T in phase0 ProcessBlock", benv.Body)
@@ -75,31 +90,35 @@ func (state *BeaconStateView) ProcessBlock(ctx context.Context, spec *common.Spe
 	if err := common.ProcessHeader(ctx, spec, state, &benv.BeaconBlockHeader, proposerIndex); err != nil {
 		return err
 	}
-	if err := ProcessRandaoReveal(ctx, spec, epc, state, body.RandaoReveal); err != nil {
+	tr.TraceBlockStage(state, common.BlockStageHeader)
+	if err := ProcessRandaoReveal(ctx, spec, epc, tr, state, body.RandaoReveal); err != nil {
 		return err
 	}
+	tr.TraceBlockStage(state, common.BlockStageRandao)
 	if err := ProcessEth1Vote(ctx, spec, epc, state, body.Eth1Data); err != nil {
 		return err
 	}
+	tr.TraceBlockStage(state, common.BlockStageEth1Data)
 	// Safety checks, in case the user of the function provided too many operations
 	if err := body.CheckLimits(spec); err != nil {
 		return err
 	}
 
-	if err := ProcessProposerSlashings(ctx, spec, epc, state, body.ProposerSlashings); err != nil {
+	if err := ProcessProposerSlashings(ctx, spec, epc, tr, state, body.ProposerSlashings); err != nil {
 		return err
 	}
-	if err := ProcessAttesterSlashings(ctx, spec, epc, state, body.AttesterSlashings); err != nil {
+	if err := ProcessAttesterSlashings(ctx, spec, epc, tr, state, body.AttesterSlashings); err != nil {
 		return err
 	}
-	if err := ProcessAttestations(ctx, spec, epc, state, body.Attestations); err != nil {
+	if err := ProcessAttestations(ctx, spec, epc, tr, state, body.Attestations); err != nil {
 		return err
 	}
-	if err := ProcessDeposits(ctx, spec, epc, state, body.Deposits); err != nil {
+	if err := ProcessDeposits(ctx, spec, epc, tr, state, body.Deposits); err != nil {
 		return err
 	}
-	if err := ProcessVoluntaryExits(ctx, spec, epc, state, body.VoluntaryExits); err != nil {
+	if err := ProcessVoluntaryExits(ctx, spec, epc, tr, state, body.VoluntaryExits); err != nil {
 		return err
 	}
+	tr.TraceBlockStage(state, common.BlockStageOperations)
 	return nil
 }
@@ -0,0 +1,121 @@
+package phase0
+
+import (
+	"context"
+	"testing"
+
+	"github.com/protolambda/zrnt/eth2/beacon/common"
+	"github.com/protolambda/zrnt/eth2/configs"
+	"github.com/protolambda/ztyp/tree"
+)
+
+type testUpgradeableState struct {
+	*BeaconStateView
+}
+
+func (s testUpgradeableState) UpgradeMaybe(ctx context.Context, spec *common.Spec, epc *common.EpochsContext) error {
+	return nil
+}
+
+// The epoch transition with pooled scratch buffers must result in the same states as without.
+func TestProcessEpochScratch(t *testing.T) {
+	spec := configs.Minimal
+	ctx := context.Background()
+	state, epc, err := KickStartState(spec, common.Root{123}, 1564000000, testKickstartValidators(t, 64))
+	if err != nil {
+		t.Fatal(err)
+	}
+	other, err := AsBeaconStateView(state.Copy())
+	if err != nil {
+		t.Fatal(err)
+	}
+	otherEpc := epc.Clone()
+	for epoch := common.Epoch(1); epoch <= 4; epoch++ {
+		slot, _ := spec.EpochStartSlot(epoch)
+		// pooled scratch
+		if err := common.ProcessSlots(ctx, spec, epc, testUpgradeableState{state}, slot); err != nil {
+			t.Fatal(err)
+		}
+		// no scratch
+		for {
+			otherSlot, err := other.Slot()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if otherSlot == slot {
+				break
+			}
+			if err := common.ProcessSlot(ctx, spec, other); err != nil {
+				t.Fatal(err)
+			}
+			if otherSlot+1 == slot {
+				if err := other.ProcessEpoch(ctx, spec, otherEpc, nil); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if err := other.SetSlot(otherSlot + 1); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if err := otherEpc.RotateEpochs(other); err != nil {
+			t.Fatal(err)
+		}
+		if a, b := state.HashTreeRoot(tree.GetHashFn()), other.HashTreeRoot(tree.GetHashFn()); a != b {
+			t.Fatalf("epoch %d: state root with scratch %s does not match %s", epoch, a, b)
+		}
+	}
+}
+
+// The epoch transition with parallel per-validator computations must result in the same states as serially.
+func TestProcessEpochParallelism(t *testing.T) {
+	spec := configs.Minimal
+	ctx := context.Background()
+	state, epc, err := KickStartState(spec, common.Root{123}, 1564000000, testKickstartValidators(t, 64))
+	if err != nil {
+		t.Fatal(err)
+	}
+	other, err := AsBeaconStateView(state.Copy())
+	if err != nil {
+		t.Fatal(err)
+	}
+	otherEpc := epc.Clone()
+	otherEpc.EpochProcessParallelism = 4
+	for slot := common.Slot(1); slot < 5*spec.SLOTS_PER_EPOCH; slot++ {
+		if err := common.ProcessSlots(ctx, spec, epc, testUpgradeableState{state}, slot); err != nil {
+			t.Fatal(err)
+		}
+		if err := common.ProcessSlots(ctx, spec, otherEpc, testUpgradeableState{other}, slot); err != nil {
+			t.Fatal(err)
+		}
+		if a, b := state.HashTreeRoot(tree.GetHashFn()), other.HashTreeRoot(tree.GetHashFn()); a != b {
+			t.Fatalf("slot %d: state root with parallelism %s does not match %s", slot, b, a)
+		}
+		// partial participation, for both rewards and penalties
+		if slot%3 == 0 {
+			continue
+		}
+		att := testFullAttestation(t, spec, epc, state, slot-1, common.CommitteeIndex(slot%2))
+		if err := ProcessAttestation(spec, epc, state, &att); err != nil {
+			t.Fatal(err)
+		}
+		if err := ProcessAttestation(spec, otherEpc, other, &att); err != nil {
+			t.Fatal(err)
+		}
+	}
+	bals, err := state.Balances()
+	if err != nil {
+		t.Fatal(err)
+	}
+	rewarded, penalized := false, false
+	for i := common.ValidatorIndex(0); i < 64; i++ {
+		bal, err := bals.GetBalance(i)
+		if err != nil {
+			t.Fatal(err)
+		}
+		rewarded = rewarded || bal > spec.MAX_EFFECTIVE_BALANCE
+		penalized = penalized || bal < spec.MAX_EFFECTIVE_BALANCE
+	}
+	if !rewarded || !penalized {
+		t.Fatal("expected both rewards and penalties")
+	}
+}
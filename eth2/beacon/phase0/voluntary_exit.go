@@ -5,7 +5,6 @@ import (
 	"errors"
 	"fmt"
 
-	blsu "github.com/protolambda/bls12-381-util"
 	"github.com/protolambda/zrnt/eth2/beacon/common"
 	"github.com/protolambda/ztyp/codec"
 	"github.com/protolambda/ztyp/tree"
@@ -18,6 +17,10 @@ func BlockVoluntaryExitsType(spec *common.Spec) ListTypeDef {
 
 type VoluntaryExits []SignedVoluntaryExit
 
+func (li VoluntaryExits) MarshalJSON() ([]byte, error) {
+	return common.MarshalJSONList(len(li), []SignedVoluntaryExit(li))
+}
+
 func (a *VoluntaryExits) Deserialize(spec *common.Spec, dr *codec.DecodingReader) error {
 	return dr.List(func() codec.Deserializable {
 		i := len(*a)
@@ -50,12 +53,23 @@ func (li VoluntaryExits) HashTreeRoot(spec *common.Spec, hFn tree.HashFn) common
 	}, length, uint64(spec.MAX_VOLUNTARY_EXITS))
 }
 
-func ProcessVoluntaryExits(ctx context.Context, spec *common.Spec, epc *common.EpochsContext, state common.BeaconState, ops []SignedVoluntaryExit) error {
+func ProcessVoluntaryExits(ctx context.Context, spec *common.Spec, epc *common.EpochsContext, tr *common.Transition, state common.BeaconState, ops []SignedVoluntaryExit) error {
+	if len(ops) == 0 {
+		return nil
+	}
+	// read the exit queue once for all exits, instead of iterating the registry for every exit
+	queue, err := loadExitQueue(spec, epc, state, nil)
+	if err != nil {
+		return err
+	}
 	for i := range ops {
 		if err := ctx.Err(); err != nil {
 			return err
 		}
-		if err := ProcessVoluntaryExit(spec, epc, state, &ops[i]); err != nil {
+		tr.TraceBeforeOp(state, common.OpVoluntaryExit, i)
+		err := processVoluntaryExit(spec, epc, tr, state, &ops[i], queue)
+		tr.TraceAfterOp(state, common.OpVoluntaryExit, i, err)
+		if err != nil {
 			return err
 		}
 	}
@@ -123,7 +137,7 @@ var SignedVoluntaryExitType = ContainerType("SignedVoluntaryExit", []FieldDef{
 	{"signature", common.BLSSignatureType},
 })
 
-func ValidateVoluntaryExit(spec *common.Spec, epc *common.EpochsContext, state common.BeaconState, signedExit *SignedVoluntaryExit) error {
+func ValidateVoluntaryExit(spec *common.Spec, epc *common.EpochsContext, tr *common.Transition, state common.BeaconState, signedExit *SignedVoluntaryExit) error {
 	exit := &signedExit.Message
 	currentEpoch := epc.CurrentEpoch.Epoch
 	vals, err := state.Validators()
@@ -135,34 +149,24 @@ func ValidateVoluntaryExit(spec *common.Spec, epc *common.EpochsContext, state c
 	} else if !valid {
 		return errors.New("invalid exit validator index")
 	}
-	validator, err := vals.Validator(exit.ValidatorIndex)
+	validator, err := common.StateFlatValidators(state).Validator(state, exit.ValidatorIndex)
 	if err != nil {
 		return err
 	}
 	// Verify that the validator is active
-	if isActive, err := IsActive(validator, currentEpoch); err != nil {
-		return err
-	} else if !isActive {
+	if !validator.IsActive(currentEpoch) {
 		return errors.New("validator must be active to be able to voluntarily exit")
 	}
-	scheduledExitEpoch, err := validator.ExitEpoch()
-	if err != nil {
-		return err
-	}
 	// Verify exit has not been initiated
-	if scheduledExitEpoch != common.FAR_FUTURE_EPOCH {
+	if validator.ExitEpoch != common.FAR_FUTURE_EPOCH {
 		return errors.New("validator already exited")
 	}
 	// Exits must specify an epoch when they become valid; they are not valid before then
 	if currentEpoch < exit.Epoch {
 		return errors.New("invalid exit epoch")
 	}
-	registeredActivationEpoch, err := validator.ActivationEpoch()
-	if err != nil {
-		return err
-	}
 	// Verify the validator has been active long enough
-	if currentEpoch < registeredActivationEpoch+spec.SHARD_COMMITTEE_PERIOD {
+	if currentEpoch < validator.ActivationEpoch+spec.SHARD_COMMITTEE_PERIOD {
 		return errors.New("exit is too soon")
 	}
 	pubkey, ok := epc.ValidatorPubkeyCache.Pubkey(exit.ValidatorIndex)
@@ -183,21 +187,32 @@ func ValidateVoluntaryExit(spec *common.Spec, epc *common.EpochsContext, state c
 		return fmt.Errorf("failed to deserialize and sub-group check exit signature: %v", err)
 	}
 	// Verify signature
-	if !blsu.Verify(blsPub, sigRoot[:], sig) {
+	tr.CountSignatures(string(common.OpVoluntaryExit), 1)
+	if !tr.VerifySignature(fmt.Sprintf("voluntary exit of validator %d", exit.ValidatorIndex), blsPub, sigRoot[:], sig) {
 		return errors.New("voluntary exit signature could not be verified")
 	}
 	return nil
 }
 
-func ProcessVoluntaryExit(spec *common.Spec, epc *common.EpochsContext, state common.BeaconState, signedExit *SignedVoluntaryExit) error {
-	if err := ValidateVoluntaryExit(spec, epc, state, signedExit); err != nil {
+func ProcessVoluntaryExit(spec *common.Spec, epc *common.EpochsContext, tr *common.Transition, state common.BeaconState, signedExit *SignedVoluntaryExit) error {
+	return processVoluntaryExit(spec, epc, tr, state, signedExit, nil)
+}
+
+func processVoluntaryExit(spec *common.Spec, epc *common.EpochsContext, tr *common.Transition, state common.BeaconState, signedExit *SignedVoluntaryExit, queue *exitQueue) error {
+	if err := ValidateVoluntaryExit(spec, epc, tr, state, signedExit); err != nil {
 		return err
 	}
-	return InitiateValidatorExit(spec, epc, state, signedExit.Message.ValidatorIndex)
+	return initiateValidatorExit(spec, epc, state, signedExit.Message.ValidatorIndex, queue)
 }
 
 // Initiate the exit of the validator of the given index
 func InitiateValidatorExit(spec *common.Spec, epc *common.EpochsContext, state common.BeaconState, index common.ValidatorIndex) error {
+	return initiateValidatorExit(spec, epc, state, index, nil)
+}
+
+// initiateValidatorExit initiates the exit of the validator, with the exit queue of the state.
+// The queue is read from the state if nil.
+func initiateValidatorExit(spec *common.Spec, epc *common.EpochsContext, state common.BeaconState, index common.ValidatorIndex, queue *exitQueue) error {
 	validators, err := state.Validators()
 	if err != nil {
 		return err
@@ -214,46 +229,113 @@ func InitiateValidatorExit(spec *common.Spec, epc *common.EpochsContext, state c
 	if exitEp != common.FAR_FUTURE_EPOCH {
 		return nil
 	}
-	currentEpoch := epc.CurrentEpoch.Epoch
 
-	// Set validator exit epoch and withdrawable epoch
-	valIterNext := validators.Iter()
-
-	exitQueueEnd := spec.ComputeActivationExitEpoch(currentEpoch)
-	exitQueueEndChurn := uint64(0)
-	for {
-		val, ok, err := valIterNext()
-		if err != nil {
+	if queue == nil {
+		if queue, err = loadExitQueue(spec, epc, state, nil); err != nil {
 			return err
 		}
-		if !ok {
-			break
-		}
-		valExit, err := val.ExitEpoch()
-		if err != nil {
-			return err
-		}
-		if valExit == common.FAR_FUTURE_EPOCH {
-			continue
-		}
-		if valExit == exitQueueEnd {
-			exitQueueEndChurn++
-		} else if valExit > exitQueueEnd {
-			exitQueueEnd = valExit
-			exitQueueEndChurn = 1
-		}
-	}
-	churnLimit := spec.GetChurnLimit(uint64(len(epc.CurrentEpoch.ActiveIndices)))
-	if exitQueueEndChurn >= churnLimit {
-		exitQueueEnd++
 	}
-
-	exitEp = exitQueueEnd
+	// Set validator exit epoch and withdrawable epoch
+	exitEp = queue.next(epc.ChurnLimit())
 	if err := v.SetExitEpoch(exitEp); err != nil {
 		return err
 	}
 	if err := v.SetWithdrawableEpoch(exitEp + spec.MIN_VALIDATOR_WITHDRAWABILITY_DELAY); err != nil {
 		return err
 	}
+	queue.add(exitEp)
+	common.StateFlatValidators(state).Update(state, index, func(v *common.FlatValidator) {
+		v.ExitEpoch = exitEp
+		v.WithdrawableEpoch = exitEp + spec.MIN_VALIDATOR_WITHDRAWABILITY_DELAY
+	})
 	return nil
 }
+
+// exitQueue is the end of the exit queue of a state, and the number of validators that exit at the end.
+// It is only valid for the state it was loaded from, and only while the exits of the state
+// are initiated through it: it is kept up to date with the exits, instead of reading the registry again.
+type exitQueue struct {
+	end   common.Epoch
+	churn uint64
+}
+
+// loadExitQueue reads the exit queue of the state. onExit, if not nil, is called with every validator that initiated an exit.
+func loadExitQueue(spec *common.Spec, epc *common.EpochsContext, state common.BeaconState,
+	onExit func(i common.ValidatorIndex, exitEpoch common.Epoch)) (*exitQueue, error) {
+	q := &exitQueue{end: spec.ComputeActivationExitEpoch(epc.CurrentEpoch.Epoch)}
+	// the exit epochs are read from the flat validators of the state, not from the state tree
+	err := common.StateFlatValidators(state).Each(state, func(i common.ValidatorIndex, v *common.FlatValidator) {
+		if v.ExitEpoch == common.FAR_FUTURE_EPOCH {
+			return
+		}
+		if onExit != nil {
+			onExit(i, v.ExitEpoch)
+		}
+		q.add(v.ExitEpoch)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return q, nil
+}
+
+// next returns the exit epoch of the next validator to exit: the end of the exit queue,
+// or the epoch after it if the churn limit is reached.
+func (q *exitQueue) next(churnLimit uint64) common.Epoch {
+	if q.churn >= churnLimit {
+		return q.end + 1
+	}
+	return q.end
+}
+
+// add counts a validator that exits in the given epoch.
+func (q *exitQueue) add(exitEpoch common.Epoch) {
+	if exitEpoch == q.end {
+		q.churn++
+	} else if exitEpoch > q.end {
+		q.end = exitEpoch
+		q.churn = 1
+	}
+}
+
+// ProjectExit returns the exit epoch and withdrawable epoch that the validator would get if it exited now,
+// without changing the state. The queue position is the number of other validators that exit after
+// the current epoch, up to and including the exit epoch. If the validator already initiated its exit,
+// its current exit and withdrawable epochs are returned.
+func ProjectExit(spec *common.Spec, epc *common.EpochsContext, state common.BeaconState, index common.ValidatorIndex) (
+	exitEpoch common.Epoch, withdrawableEpoch common.Epoch, queuePosition uint64, err error) {
+	validators, err := state.Validators()
+	if err != nil {
+		return 0, 0, 0, err
+	}
+	v, err := validators.Validator(index)
+	if err != nil {
+		return 0, 0, 0, err
+	}
+	if exitEpoch, err = v.ExitEpoch(); err != nil {
+		return 0, 0, 0, err
+	}
+	currentEpoch := epc.CurrentEpoch.Epoch
+	pending := make(map[common.Epoch]uint64)
+	queue, err := loadExitQueue(spec, epc, state, func(i common.ValidatorIndex, exit common.Epoch) {
+		if i != index && exit > currentEpoch {
+			pending[exit]++
+		}
+	})
+	if err != nil {
+		return 0, 0, 0, err
+	}
+	queueEnd := queue.next(epc.ChurnLimit())
+	if exitEpoch == common.FAR_FUTURE_EPOCH {
+		exitEpoch = queueEnd
+		withdrawableEpoch = exitEpoch + spec.MIN_VALIDATOR_WITHDRAWABILITY_DELAY
+	} else if withdrawableEpoch, err = v.WithdrawableEpoch(); err != nil {
+		return 0, 0, 0, err
+	}
+	for epoch, count := range pending {
+		if epoch <= exitEpoch {
+			queuePosition += count
+		}
+	}
+	return exitEpoch, withdrawableEpoch, queuePosition, nil
+}
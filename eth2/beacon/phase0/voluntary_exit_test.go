@@ -0,0 +1,143 @@
+package phase0
+
+import (
+	"testing"
+
+	"github.com/protolambda/ztyp/tree"
+
+	"github.com/protolambda/zrnt/eth2/beacon/common"
+	"github.com/protolambda/zrnt/eth2/configs"
+)
+
+// Projections of many exits in one epoch must match the exits when processed.
+func TestProjectExit(t *testing.T) {
+	spec := configs.Minimal
+	state, epc, err := KickStartState(spec, common.Root{123}, 1564000000, testKickstartValidators(t, 64))
+	if err != nil {
+		t.Fatal(err)
+	}
+	churn := epc.ChurnLimit()
+	if churn != uint64(spec.MIN_PER_EPOCH_CHURN_LIMIT) {
+		t.Fatalf("expected min churn limit for 64 validators, got %d", churn)
+	}
+	hFn := tree.GetHashFn()
+	exits := churn*3 + 1
+	for i := common.ValidatorIndex(0); i < common.ValidatorIndex(exits); i++ {
+		root := state.HashTreeRoot(hFn)
+		exitEpoch, withdrawableEpoch, position, err := ProjectExit(spec, epc, state, i)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if state.HashTreeRoot(hFn) != root {
+			t.Fatal("projection changed the state")
+		}
+		if position != uint64(i) {
+			t.Fatalf("validator %d: expected queue position %d, got %d", i, i, position)
+		}
+		if expected := spec.ComputeActivationExitEpoch(0) + common.Epoch(uint64(i)/churn); exitEpoch != expected {
+			t.Fatalf("validator %d: expected exit epoch %d, got %d", i, expected, exitEpoch)
+		}
+		if err := InitiateValidatorExit(spec, epc, state, i); err != nil {
+			t.Fatal(err)
+		}
+		vals, err := state.Validators()
+		if err != nil {
+			t.Fatal(err)
+		}
+		v, err := vals.Validator(i)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if ep, _ := v.ExitEpoch(); ep != exitEpoch {
+			t.Fatalf("validator %d: projected exit epoch %d, got %d", i, exitEpoch, ep)
+		}
+		if ep, _ := v.WithdrawableEpoch(); ep != withdrawableEpoch {
+			t.Fatalf("validator %d: projected withdrawable epoch %d, got %d", i, withdrawableEpoch, ep)
+		}
+	}
+	// an exiting validator keeps its epochs, the other exits up to its epoch are ahead or alongside it
+	exitEpoch, _, position, err := ProjectExit(spec, epc, state, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if exitEpoch != spec.ComputeActivationExitEpoch(0) || position != churn-1 {
+		t.Fatalf("unexpected projection of an exiting validator: epoch %d, position %d", exitEpoch, position)
+	}
+}
+
+// The exits of a block share an exit queue, which must assign the same epochs as reading the queue from the state for every exit.
+func TestExitQueue(t *testing.T) {
+	spec := configs.Minimal
+	state, epc, err := KickStartState(spec, common.Root{123}, 1564000000, testKickstartValidators(t, 64))
+	if err != nil {
+		t.Fatal(err)
+	}
+	other, err := AsBeaconStateView(state.Copy())
+	if err != nil {
+		t.Fatal(err)
+	}
+	// a slashed validator is already in the queue before the exits
+	if err := SlashValidator(spec, epc, state, 40, nil); err != nil {
+		t.Fatal(err)
+	}
+	if err := SlashValidator(spec, epc, other, 40, nil); err != nil {
+		t.Fatal(err)
+	}
+	queue, err := loadExitQueue(spec, epc, state, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	exits := common.ValidatorIndex(epc.ChurnLimit()*2 + 1)
+	for i := common.ValidatorIndex(0); i < exits; i++ {
+		if err := initiateValidatorExit(spec, epc, state, i, queue); err != nil {
+			t.Fatal(err)
+		}
+		if err := InitiateValidatorExit(spec, epc, other, i); err != nil {
+			t.Fatal(err)
+		}
+	}
+	hFn := tree.GetHashFn()
+	if state.HashTreeRoot(hFn) != other.HashTreeRoot(hFn) {
+		t.Fatal("exits with a shared queue changed the state differently")
+	}
+}
+
+// The context is shared between states of the same epoch, the exits of one state must not affect the other.
+func TestExitWithSharedContext(t *testing.T) {
+	spec := configs.Minimal
+	state, epc, err := KickStartState(spec, common.Root{123}, 1564000000, testKickstartValidators(t, 64))
+	if err != nil {
+		t.Fatal(err)
+	}
+	other, err := AsBeaconStateView(state.Copy())
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := common.ValidatorIndex(0); i < common.ValidatorIndex(epc.ChurnLimit()); i++ {
+		if err := InitiateValidatorExit(spec, epc, other, i); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := SlashValidator(spec, epc, other, 10, nil); err != nil {
+		t.Fatal(err)
+	}
+	if err := InitiateValidatorExit(spec, epc, state, 10); err != nil {
+		t.Fatal(err)
+	}
+	vals, err := state.Validators()
+	if err != nil {
+		t.Fatal(err)
+	}
+	v, err := vals.Validator(10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ep, _ := v.ExitEpoch(); ep != spec.ComputeActivationExitEpoch(0) {
+		t.Fatalf("expected the first exit epoch, the exits of the other state are not in the queue, got %d", ep)
+	}
+	if slashable, err := IsSlashable(v, epc.CurrentEpoch.Epoch); err != nil {
+		t.Fatal(err)
+	} else if !slashable {
+		t.Fatal("the slashing of the other state must not make the validator unslashable")
+	}
+}
@@ -0,0 +1,330 @@
+package testutil
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+
+	"github.com/protolambda/ztyp/tree"
+
+	"github.com/protolambda/zrnt/eth2/beacon"
+	"github.com/protolambda/zrnt/eth2/beacon/altair"
+	"github.com/protolambda/zrnt/eth2/beacon/bellatrix"
+	"github.com/protolambda/zrnt/eth2/beacon/capella"
+	"github.com/protolambda/zrnt/eth2/beacon/common"
+	"github.com/protolambda/zrnt/eth2/beacon/deneb"
+	"github.com/protolambda/zrnt/eth2/beacon/phase0"
+)
+
+// TestBlock is a signed block of a test chain, with its post-state.
+type TestBlock struct {
+	// Signed block, of the block type of the fork of its slot
+	Signed    common.SpecObj
+	Envelope  *common.BeaconBlockEnvelope
+	PostState common.BeaconState
+}
+
+type TestChain struct {
+	Spec    *common.Spec
+	Genesis common.BeaconState
+	// Root of the genesis block: the latest block header of the genesis state
+	GenesisRoot common.Root
+	// Canonical blocks, by increasing slot
+	Blocks []*TestBlock
+	// Blocks of the branch that forks off the canonical chain at the fork slot, nil if there is no fork.
+	// The first block of the branch is at the fork slot, and builds on the canonical block before it.
+	Fork []*TestBlock
+}
+
+type ChainOptions struct {
+	// Seed of the random choices: skipped slots and attesters
+	Seed int64
+	// Number of validators, 64 if zero
+	Validators uint64
+	// Participation of every committee in the attestations of the next block, in percent
+	Participation uint8
+	// Share of the slots without block, in percent
+	SkipSlots uint8
+	// SkipSpecValidation generates a chain with a spec that does not pass common.Spec.Validate
+	SkipSpecValidation bool
+}
+
+// GenerateTestChain produces the signed blocks of a chain of the given number of epochs,
+// with attestations in every block, and optionally a branch that forks off at the given slot.
+// The chain is deterministic: the same spec and options produce the same blocks.
+func GenerateTestChain(spec *common.Spec, epochs common.Epoch, forkAtSlot *common.Slot, opts ChainOptions) (*TestChain, error) {
+	if !opts.SkipSpecValidation {
+		if err := spec.Validate(); err != nil {
+			return nil, err
+		}
+	}
+	count := opts.Validators
+	if count == 0 {
+		count = 64
+	}
+	rng := rand.New(rand.NewSource(opts.Seed))
+	p, err := newProducer(spec, count, 0, rng)
+	if err != nil {
+		return nil, err
+	}
+	genesis, err := p.state.CopyState()
+	if err != nil {
+		return nil, err
+	}
+	header, err := genesis.LatestBlockHeader()
+	if err != nil {
+		return nil, err
+	}
+	header.StateRoot = genesis.HashTreeRoot(tree.GetHashFn())
+	chain := &TestChain{Spec: spec, Genesis: genesis, GenesisRoot: header.HashTreeRoot(tree.GetHashFn())}
+
+	end := common.Slot(epochs) * spec.SLOTS_PER_EPOCH
+	var branch *producer
+	for slot := common.Slot(1); slot <= end; slot++ {
+		if forkAtSlot != nil && slot == *forkAtSlot {
+			if branch, err = p.copy(rand.New(rand.NewSource(rng.Int63()))); err != nil {
+				return nil, err
+			}
+		}
+		if rng.Intn(100) < int(opts.SkipSlots) {
+			continue
+		}
+		b, err := p.produce(slot, opts.Participation, common.Root{})
+		if err != nil {
+			return nil, fmt.Errorf("failed to produce block at slot %d: %v", slot, err)
+		}
+		chain.Blocks = append(chain.Blocks, b)
+	}
+	if branch != nil {
+		for slot := *forkAtSlot; slot <= end; slot++ {
+			// the first block of the branch must differ from the canonical block at the same slot
+			if slot != *forkAtSlot && branch.rng.Intn(100) < int(opts.SkipSlots) {
+				continue
+			}
+			b, err := branch.produce(slot, opts.Participation, common.Root{'f', 'o', 'r', 'k'})
+			if err != nil {
+				return nil, fmt.Errorf("failed to produce fork block at slot %d: %v", slot, err)
+			}
+			chain.Fork = append(chain.Fork, b)
+		}
+	}
+	return chain, nil
+}
+
+// producer produces the blocks on top of its state, and applies them.
+type producer struct {
+	spec  *common.Spec
+	rng   *rand.Rand
+	state *beacon.StandardUpgradeableBeaconState
+	epc   *common.EpochsContext
+}
+
+// newProducer creates a genesis state of the validators with their interop keys, upgraded to the fork of epoch 0.
+// The balances of the validators vary up to the spread around the max effective balance.
+func newProducer(spec *common.Spec, count uint64, spread common.Gwei, rng *rand.Rand) (*producer, error) {
+	validators := Validators(spec, count)
+	if spread > 0 {
+		for i := range validators {
+			validators[i].Balance = validators[i].Balance - spread + common.Gwei(rng.Int63n(int64(2*spread)+1))
+		}
+	}
+	state, epc, err := phase0.KickStartState(spec, common.Root{123}, 1564000000, validators)
+	if err != nil {
+		return nil, err
+	}
+	p := &producer{spec: spec, rng: rng, state: &beacon.StandardUpgradeableBeaconState{BeaconState: state}, epc: epc}
+	if err := p.state.UpgradeMaybe(context.Background(), spec, epc); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+func (p *producer) copy(rng *rand.Rand) (*producer, error) {
+	state, err := p.state.CopyState()
+	if err != nil {
+		return nil, err
+	}
+	return &producer{spec: p.spec, rng: rng, state: &beacon.StandardUpgradeableBeaconState{BeaconState: state}, epc: p.epc.Clone()}, nil
+}
+
+func (p *producer) processSlots(slot common.Slot) error {
+	current, err := p.state.Slot()
+	if err != nil {
+		return err
+	}
+	if current >= slot {
+		return nil
+	}
+	return common.ProcessSlots(context.Background(), p.spec, p.epc, p.state, slot)
+}
+
+// attestations creates an aggregate attestation for every committee of the slot,
+// with the given share of the committee attesting.
+func (p *producer) attestations(slot common.Slot, participation uint8) ([]phase0.Attestation, error) {
+	spec, state := p.spec, p.state
+	currentSlot, err := state.Slot()
+	if err != nil {
+		return nil, err
+	}
+	target := spec.SlotToEpoch(slot)
+	var source common.Checkpoint
+	if target == spec.SlotToEpoch(currentSlot) {
+		source, err = state.CurrentJustifiedCheckpoint()
+	} else {
+		source, err = state.PreviousJustifiedCheckpoint()
+	}
+	if err != nil {
+		return nil, err
+	}
+	targetRoot, err := common.GetBlockRoot(spec, state, target)
+	if err != nil {
+		return nil, err
+	}
+	headRoot, err := common.GetBlockRootAtSlot(spec, state, slot)
+	if err != nil {
+		return nil, err
+	}
+	domain, err := common.GetDomain(state, common.DOMAIN_BEACON_ATTESTER, target)
+	if err != nil {
+		return nil, err
+	}
+	count, err := p.epc.GetCommitteeCountPerSlot(target)
+	if err != nil {
+		return nil, err
+	}
+	var out []phase0.Attestation
+	for index := common.CommitteeIndex(0); uint64(index) < count; index++ {
+		committee, err := p.epc.GetBeaconCommittee(slot, index)
+		if err != nil {
+			return nil, err
+		}
+		att := phase0.Attestation{
+			AggregationBits: phase0.NewAttestationBits(uint64(len(committee))),
+			Data: phase0.AttestationData{
+				Slot:            slot,
+				Index:           index,
+				BeaconBlockRoot: headRoot,
+				Source:          source,
+				Target:          common.Checkpoint{Epoch: target, Root: targetRoot},
+			},
+		}
+		var attesters []common.ValidatorIndex
+		for i, vi := range committee {
+			if p.rng.Intn(100) < int(participation) {
+				att.AggregationBits.SetBit(uint64(i), true)
+				attesters = append(attesters, vi)
+			}
+		}
+		if len(attesters) == 0 {
+			continue
+		}
+		att.Signature = Sign(att.Data.HashTreeRoot(tree.GetHashFn()), domain, attesters...)
+		out = append(out, att)
+	}
+	return out, nil
+}
+
+// produce proposes a block at the slot, with attestations of the previous slot, and applies it.
+func (p *producer) produce(slot common.Slot, participation uint8, graffiti common.Root) (*TestBlock, error) {
+	spec := p.spec
+	if err := p.processSlots(slot); err != nil {
+		return nil, err
+	}
+	var atts []phase0.Attestation
+	if participation > 0 && slot > 0 {
+		var err error
+		if atts, err = p.attestations(slot-1, participation); err != nil {
+			return nil, fmt.Errorf("failed to create attestations: %v", err)
+		}
+	}
+	proposer, err := p.epc.GetBeaconProposer(slot)
+	if err != nil {
+		return nil, err
+	}
+	header, err := p.state.LatestBlockHeader()
+	if err != nil {
+		return nil, err
+	}
+	eth1Data, err := p.state.Eth1Data()
+	if err != nil {
+		return nil, err
+	}
+	epoch := spec.SlotToEpoch(slot)
+	randaoDomain, err := common.GetDomain(p.state, common.DOMAIN_RANDAO, epoch)
+	if err != nil {
+		return nil, err
+	}
+	randaoReveal := Sign(epoch.HashTreeRoot(tree.GetHashFn()), randaoDomain, proposer)
+	parentRoot := header.HashTreeRoot(tree.GetHashFn())
+	syncAggregate := altair.SyncAggregate{
+		SyncCommitteeBits:      make(altair.SyncCommitteeBits, spec.SYNC_COMMITTEE_SIZE/8),
+		SyncCommitteeSignature: common.BLSSignature{0xc0},
+	}
+
+	var block interface {
+		common.SpecObj
+		common.EnvelopeBuilder
+	}
+	var signature *common.BLSSignature
+	var stateRoot *common.Root
+	switch p.state.BeaconState.(type) {
+	case *phase0.BeaconStateView:
+		b := &phase0.SignedBeaconBlock{Message: phase0.BeaconBlock{
+			Slot: slot, ProposerIndex: proposer, ParentRoot: parentRoot,
+			Body: phase0.BeaconBlockBody{RandaoReveal: randaoReveal, Eth1Data: eth1Data, Graffiti: graffiti,
+				Attestations: atts},
+		}}
+		block, signature, stateRoot = b, &b.Signature, &b.Message.StateRoot
+	case *altair.BeaconStateView:
+		b := &altair.SignedBeaconBlock{Message: altair.BeaconBlock{
+			Slot: slot, ProposerIndex: proposer, ParentRoot: parentRoot,
+			Body: altair.BeaconBlockBody{RandaoReveal: randaoReveal, Eth1Data: eth1Data, Graffiti: graffiti,
+				Attestations: atts, SyncAggregate: syncAggregate},
+		}}
+		block, signature, stateRoot = b, &b.Signature, &b.Message.StateRoot
+	case *bellatrix.BeaconStateView:
+		b := &bellatrix.SignedBeaconBlock{Message: bellatrix.BeaconBlock{
+			Slot: slot, ProposerIndex: proposer, ParentRoot: parentRoot,
+			Body: bellatrix.BeaconBlockBody{RandaoReveal: randaoReveal, Eth1Data: eth1Data, Graffiti: graffiti,
+				Attestations: atts, SyncAggregate: syncAggregate},
+		}}
+		block, signature, stateRoot = b, &b.Signature, &b.Message.StateRoot
+	case *capella.BeaconStateView:
+		b := &capella.SignedBeaconBlock{Message: capella.BeaconBlock{
+			Slot: slot, ProposerIndex: proposer, ParentRoot: parentRoot,
+			Body: capella.BeaconBlockBody{RandaoReveal: randaoReveal, Eth1Data: eth1Data, Graffiti: graffiti,
+				Attestations: atts, SyncAggregate: syncAggregate},
+		}}
+		block, signature, stateRoot = b, &b.Signature, &b.Message.StateRoot
+	case *deneb.BeaconStateView:
+		b := &deneb.SignedBeaconBlock{Message: deneb.BeaconBlock{
+			Slot: slot, ProposerIndex: proposer, ParentRoot: parentRoot,
+			Body: deneb.BeaconBlockBody{RandaoReveal: randaoReveal, Eth1Data: eth1Data, Graffiti: graffiti,
+				Attestations: atts, SyncAggregate: syncAggregate},
+		}}
+		block, signature, stateRoot = b, &b.Signature, &b.Message.StateRoot
+	default:
+		return nil, fmt.Errorf("unsupported state type %T", p.state.BeaconState)
+	}
+
+	genesisValRoot, err := p.state.GenesisValidatorsRoot()
+	if err != nil {
+		return nil, err
+	}
+	digest := common.ComputeForkDigest(spec.ForkVersion(slot), genesisValRoot)
+	if err := p.state.ProcessBlock(context.Background(), spec, p.epc, nil, block.Envelope(spec, digest)); err != nil {
+		return nil, fmt.Errorf("failed to process block: %v", err)
+	}
+	*stateRoot = p.state.HashTreeRoot(tree.GetHashFn())
+	proposerDomain, err := common.GetDomain(p.state, common.DOMAIN_BEACON_PROPOSER, epoch)
+	if err != nil {
+		return nil, err
+	}
+	*signature = Sign(block.Envelope(spec, digest).BlockRoot, proposerDomain, proposer)
+
+	post, err := p.state.CopyState()
+	if err != nil {
+		return nil, err
+	}
+	return &TestBlock{Signed: block, Envelope: block.Envelope(spec, digest), PostState: post}, nil
+}
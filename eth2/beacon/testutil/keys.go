@@ -0,0 +1,111 @@
+// Package testutil generates deterministic states and chains for tests, with the interop validator keys.
+package testutil
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"math/big"
+	"sync"
+
+	blsu "github.com/protolambda/bls12-381-util"
+
+	"github.com/protolambda/zrnt/eth2/beacon/common"
+	"github.com/protolambda/zrnt/eth2/beacon/phase0"
+)
+
+// order of the BLS12-381 curve, secret keys are scalars modulo the order.
+var curveOrder, _ = new(big.Int).SetString("73eda753299d7d483339d80809a1d80553bda402fffe5bfeffffffff00000001", 16)
+
+type interopKey struct {
+	scalar *big.Int
+	sk     *blsu.SecretKey
+	pub    common.BLSPubkey
+}
+
+var (
+	interopKeysLock sync.Mutex
+	// interop keys by validator index, derived on first use
+	interopKeys []*interopKey
+)
+
+func getInteropKey(index common.ValidatorIndex) *interopKey {
+	interopKeysLock.Lock()
+	defer interopKeysLock.Unlock()
+	for uint64(len(interopKeys)) <= uint64(index) {
+		interopKeys = append(interopKeys, nil)
+	}
+	if k := interopKeys[index]; k != nil {
+		return k
+	}
+	// The interop secret key is the little-endian sha256 of the little-endian index, modulo the curve order.
+	var input [32]byte
+	for i, v := 0, uint64(index); i < 8; i, v = i+1, v>>8 {
+		input[i] = byte(v)
+	}
+	h := sha256.Sum256(input[:])
+	for i, j := 0, len(h)-1; i < j; i, j = i+1, j-1 {
+		h[i], h[j] = h[j], h[i]
+	}
+	scalar := new(big.Int).Mod(new(big.Int).SetBytes(h[:]), curveOrder)
+	sk := scalarToKey(scalar)
+	pub, err := blsu.SkToPk(sk)
+	if err != nil {
+		panic(fmt.Errorf("invalid interop key %d: %v", index, err))
+	}
+	k := &interopKey{scalar: scalar, sk: sk, pub: pub.Serialize()}
+	interopKeys[index] = k
+	return k
+}
+
+func scalarToKey(scalar *big.Int) *blsu.SecretKey {
+	var data [32]byte
+	scalar.FillBytes(data[:])
+	var sk blsu.SecretKey
+	if err := sk.Deserialize(&data); err != nil {
+		panic(fmt.Errorf("invalid secret key scalar: %v", err))
+	}
+	return &sk
+}
+
+// InteropKey returns the interop secret key of the validator.
+func InteropKey(index common.ValidatorIndex) *blsu.SecretKey {
+	return getInteropKey(index).sk
+}
+
+// InteropPubkey returns the interop public key of the validator.
+func InteropPubkey(index common.ValidatorIndex) common.BLSPubkey {
+	return getInteropKey(index).pub
+}
+
+// AggregateKey returns the sum of the interop secret keys of the validators:
+// a signature with it equals the aggregate of the signatures of the validators.
+func AggregateKey(indices []common.ValidatorIndex) *blsu.SecretKey {
+	sum := new(big.Int)
+	for _, i := range indices {
+		sum.Add(sum, getInteropKey(i).scalar)
+	}
+	return scalarToKey(sum.Mod(sum, curveOrder))
+}
+
+// Sign signs the object root in the domain, with the aggregate interop key of the validators.
+func Sign(root common.Root, domain common.BLSDomain, indices ...common.ValidatorIndex) common.BLSSignature {
+	msg := common.ComputeSigningRoot(root, domain)
+	return blsu.Sign(AggregateKey(indices), msg[:]).Serialize()
+}
+
+// Validators returns the genesis data of the validators, with their interop keys and the max effective balance.
+func Validators(spec *common.Spec, count uint64) []phase0.KickstartValidatorData {
+	out := make([]phase0.KickstartValidatorData, 0, count)
+	for i := uint64(0); i < count; i++ {
+		pub := InteropPubkey(common.ValidatorIndex(i))
+		withdrawalCred := common.Root{common.BLS_WITHDRAWAL_PREFIX}
+		h := sha256.Sum256(pub[:])
+		copy(withdrawalCred[1:], h[1:])
+		out = append(out, phase0.KickstartValidatorData{
+			Pubkey:                pub,
+			WithdrawalCredentials: withdrawalCred,
+			Balance:               spec.MAX_EFFECTIVE_BALANCE,
+		})
+	}
+	return out
+}
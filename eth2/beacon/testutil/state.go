@@ -0,0 +1,68 @@
+package testutil
+
+import (
+	"fmt"
+	"math/rand"
+
+	"github.com/protolambda/zrnt/eth2/beacon/common"
+	"github.com/protolambda/zrnt/eth2/beacon/phase0"
+)
+
+// StateOptions configures GenerateTestState. The zero value is a genesis state.
+type StateOptions struct {
+	// Seed of the random choices: attesters, balances, slashed and exiting validators
+	Seed int64
+	// Slot of the state
+	Slot common.Slot
+	// Participation of every committee up to the slot, in percent. If zero, no blocks are proposed,
+	// and the slots are processed without blocks. Otherwise there is a block at every slot,
+	// with the attestations of the previous slot: these are pending attestations in phase0 states,
+	// and participation flags in later states.
+	Participation uint8
+	// Number of slashed validators, slashed at the slot
+	Slashed uint64
+	// Number of validators that initiated their exit at the slot, excl. the slashed validators
+	Exiting uint64
+	// Genesis balances vary up to this amount around the max effective balance
+	BalanceSpread common.Gwei
+}
+
+// GenerateTestState creates a state of the validators, with their interop keys, at the fork of the slot.
+// The state is deterministic: the same spec, validators and options produce the same state.
+func GenerateTestState(spec *common.Spec, validators uint64, opts StateOptions) (common.BeaconState, *common.EpochsContext, error) {
+	if opts.Slashed+opts.Exiting > validators {
+		return nil, nil, fmt.Errorf("cannot slash %d and exit %d of %d validators", opts.Slashed, opts.Exiting, validators)
+	}
+	rng := rand.New(rand.NewSource(opts.Seed))
+	p, err := newProducer(spec, validators, opts.BalanceSpread, rng)
+	if err != nil {
+		return nil, nil, err
+	}
+	if opts.Participation > 0 {
+		for slot := common.Slot(1); slot <= opts.Slot; slot++ {
+			if _, err := p.produce(slot, opts.Participation, common.Root{}); err != nil {
+				return nil, nil, fmt.Errorf("failed to produce block at slot %d: %v", slot, err)
+			}
+		}
+	} else if err := p.processSlots(opts.Slot); err != nil {
+		return nil, nil, err
+	}
+	picked := rng.Perm(int(validators))
+	for i, v := range picked[:opts.Slashed+opts.Exiting] {
+		index := common.ValidatorIndex(v)
+		if uint64(i) < opts.Slashed {
+			err = phase0.SlashValidator(spec, p.epc, p.state, index, nil)
+		} else {
+			err = phase0.InitiateValidatorExit(spec, p.epc, p.state, index)
+		}
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to slash or exit validator %d: %v", index, err)
+		}
+	}
+	// the state may have changed since the latest epoch transition, use a fresh context
+	epc, err := common.NewEpochsContext(spec, p.state.BeaconState)
+	if err != nil {
+		return nil, nil, err
+	}
+	return p.state.BeaconState, epc, nil
+}
@@ -0,0 +1,201 @@
+package testutil
+
+import (
+	"context"
+	"testing"
+
+	blsu "github.com/protolambda/bls12-381-util"
+	"github.com/protolambda/ztyp/tree"
+
+	"github.com/protolambda/zrnt/eth2/beacon"
+	"github.com/protolambda/zrnt/eth2/beacon/altair"
+	"github.com/protolambda/zrnt/eth2/beacon/common"
+	"github.com/protolambda/zrnt/eth2/beacon/phase0"
+	"github.com/protolambda/zrnt/eth2/configs"
+)
+
+func TestInteropKeys(t *testing.T) {
+	// the first interop keys, as used by the clients in interop testnets
+	for i, expected := range []string{
+		"0xa99a76ed7796f7be22d5b7e85deeb7c5677e88e511e0b337618f8c4eb61349b4bf2d153f649f7b53359fe8b94a38e44c",
+		"0xb89bebc699769726a318c8e9971bd3171297c61aea4a6578a7a4f94b547dcba5bac16a89108b6b6a1fe3695d1a874a0b",
+	} {
+		if pub := InteropPubkey(common.ValidatorIndex(i)); pub.String() != expected {
+			t.Errorf("unexpected pubkey of validator %d: %s", i, pub)
+		}
+	}
+	// the aggregate key signs the aggregate signature of the validators
+	msg := []byte("hello")
+	var sigs []*blsu.Signature
+	for i := common.ValidatorIndex(0); i < 3; i++ {
+		sigs = append(sigs, blsu.Sign(InteropKey(i), msg))
+	}
+	agg, err := blsu.Aggregate(sigs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if blsu.Sign(AggregateKey([]common.ValidatorIndex{0, 1, 2}), msg).Serialize() != agg.Serialize() {
+		t.Fatal("signature of aggregate key does not match aggregate signature")
+	}
+}
+
+func TestGenerateTestState(t *testing.T) {
+	spec := *configs.Minimal
+	spec.ALTAIR_FORK_EPOCH = 1
+	opts := StateOptions{Seed: 4, Slot: 12, Participation: 80, Slashed: 2, Exiting: 3, BalanceSpread: 1_000_000_000}
+	a, epc, err := GenerateTestState(&spec, 64, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, _, err := GenerateTestState(&spec, 64, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if a.HashTreeRoot(tree.GetHashFn()) != b.HashTreeRoot(tree.GetHashFn()) {
+		t.Fatal("expected the same state from the same seed")
+	}
+	opts.Seed += 1
+	if c, _, err := GenerateTestState(&spec, 64, opts); err != nil {
+		t.Fatal(err)
+	} else if a.HashTreeRoot(tree.GetHashFn()) == c.HashTreeRoot(tree.GetHashFn()) {
+		t.Fatal("expected a different state from a different seed")
+	}
+
+	state, ok := a.(*altair.BeaconStateView)
+	if !ok {
+		t.Fatalf("expected an altair state, got %T", a)
+	}
+	if epc.CurrentEpoch.Epoch != 1 {
+		t.Fatalf("unexpected epoch context at epoch %d", epc.CurrentEpoch.Epoch)
+	}
+	vals, err := state.Validators()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var slashed, exiting int
+	for i := common.ValidatorIndex(0); i < 64; i++ {
+		v, err := vals.Validator(i)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if s, _ := v.Slashed(); s {
+			slashed++
+		} else if e, _ := v.ExitEpoch(); e != common.FAR_FUTURE_EPOCH {
+			exiting++
+		}
+	}
+	if slashed != 2 || exiting != 3 {
+		t.Fatalf("expected 2 slashed and 3 exiting validators, got %d and %d", slashed, exiting)
+	}
+	flags, err := state.CurrentEpochParticipation()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var participants int
+	for i := common.ValidatorIndex(0); i < 64; i++ {
+		if f, err := flags.GetFlags(i); err != nil {
+			t.Fatal(err)
+		} else if f != 0 {
+			participants++
+		}
+	}
+	if participants == 0 {
+		t.Fatal("expected participation flags")
+	}
+}
+
+func TestGenerateTestChain(t *testing.T) {
+	spec := *configs.Minimal
+	spec.ALTAIR_FORK_EPOCH = 1
+	forkAt := common.Slot(11)
+	opts := ChainOptions{Seed: 2, Participation: 90, SkipSlots: 20}
+	chain, err := GenerateTestChain(&spec, 3, &forkAt, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	again, err := GenerateTestChain(&spec, 3, &forkAt, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(chain.Blocks) != len(again.Blocks) || len(chain.Fork) != len(again.Fork) {
+		t.Fatal("expected the same chain from the same seed")
+	}
+	for i, b := range chain.Blocks {
+		if b.Envelope.BlockRoot != again.Blocks[i].Envelope.BlockRoot {
+			t.Fatalf("expected the same block %d from the same seed", i)
+		}
+	}
+	if len(chain.Blocks) == 0 || len(chain.Fork) == 0 {
+		t.Fatalf("expected blocks on both branches, got %d and %d", len(chain.Blocks), len(chain.Fork))
+	}
+
+	// apply the blocks with signature and state root checks
+	apply := func(pre common.BeaconState, blocks []*TestBlock) common.BeaconState {
+		state, err := pre.CopyState()
+		if err != nil {
+			t.Fatal(err)
+		}
+		epc, err := common.NewEpochsContext(&spec, state)
+		if err != nil {
+			t.Fatal(err)
+		}
+		up := &beacon.StandardUpgradeableBeaconState{BeaconState: state}
+		for _, b := range blocks {
+			if err := common.StateTransition(context.Background(), &spec, epc, up, b.Envelope, true); err != nil {
+				t.Fatalf("block at slot %d: %v", b.Envelope.Slot, err)
+			}
+			if up.HashTreeRoot(tree.GetHashFn()) != b.PostState.HashTreeRoot(tree.GetHashFn()) {
+				t.Fatalf("unexpected post-state of block at slot %d", b.Envelope.Slot)
+			}
+		}
+		return up.BeaconState
+	}
+	head := apply(chain.Genesis, chain.Blocks)
+	if _, ok := head.(*altair.BeaconStateView); !ok {
+		t.Fatalf("expected an altair head state, got %T", head)
+	}
+	// the canonical blocks have attestations, and the chain justifies the genesis epoch
+	if cp, err := head.CurrentJustifiedCheckpoint(); err != nil {
+		t.Fatal(err)
+	} else if cp.Epoch == 0 {
+		t.Fatal("expected justification")
+	}
+
+	// the fork builds on the last canonical block before the fork slot
+	pre, parent := chain.Genesis, chain.GenesisRoot
+	for _, b := range chain.Blocks {
+		if b.Envelope.Slot >= forkAt {
+			break
+		}
+		pre, parent = b.PostState, b.Envelope.BlockRoot
+	}
+	if chain.Fork[0].Envelope.Slot != forkAt || chain.Fork[0].Envelope.ParentRoot != parent {
+		t.Fatal("expected the fork to branch off at the fork slot")
+	}
+	apply(pre, chain.Fork)
+	for _, b := range chain.Blocks {
+		if b.Envelope.BlockRoot == chain.Fork[0].Envelope.BlockRoot {
+			t.Fatal("expected different blocks on the fork")
+		}
+	}
+}
+
+func TestGenerateTestStatePhase0(t *testing.T) {
+	state, _, err := GenerateTestState(configs.Minimal, 16, StateOptions{Slot: 10, Participation: 100})
+	if err != nil {
+		t.Fatal(err)
+	}
+	s, ok := state.(*phase0.BeaconStateView)
+	if !ok {
+		t.Fatalf("expected a phase0 state, got %T", state)
+	}
+	atts, err := s.CurrentEpochAttestations()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n, err := atts.Length(); err != nil {
+		t.Fatal(err)
+	} else if n == 0 {
+		t.Fatal("expected pending attestations")
+	}
+}
@@ -0,0 +1,161 @@
+package transition
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+
+	"github.com/protolambda/ztyp/codec"
+	"github.com/protolambda/ztyp/tree"
+
+	"github.com/protolambda/zrnt/eth2/beacon"
+	"github.com/protolambda/zrnt/eth2/beacon/common"
+	"github.com/protolambda/zrnt/eth2/beacon/phase0"
+)
+
+// Anchor is a trusted state and the latest block of it, to start a chain from, like a weak-subjectivity checkpoint.
+type Anchor struct {
+	State         common.BeaconState
+	EpochsContext *common.EpochsContext
+	// The latest block of the state. The state may be at a later slot, after empty slots.
+	Block *common.BeaconBlockEnvelope
+	// Slot of the state
+	Slot common.Slot
+}
+
+type AnchorOptions struct {
+	// AllowMidEpoch accepts states that are not at the start of an epoch.
+	// Checkpoint states are at the start of an epoch, for the epoch transition to be processed already.
+	AllowMidEpoch bool
+	// SkipSpecValidation accepts a spec that does not pass common.Spec.Validate, e.g. in tests of unusual specs.
+	SkipSpecValidation bool
+}
+
+func (opts *AnchorOptions) validateSpec(spec *common.Spec) error {
+	if opts.SkipSpecValidation {
+		return nil
+	}
+	return spec.Validate()
+}
+
+// NewAnchorFromCheckpoint decodes a downloaded checkpoint state and its latest block, of any fork,
+// and checks that the block is the latest block of the state.
+func NewAnchorFromCheckpoint(spec *common.Spec, stateSSZ []byte, blockSSZ []byte, opts AnchorOptions) (*Anchor, error) {
+	return NewAnchorFromCheckpointReader(spec, bytes.NewReader(stateSSZ), uint64(len(stateSSZ)), blockSSZ, opts)
+}
+
+// NewAnchorFromCheckpointReader is NewAnchorFromCheckpoint with a state of the given length that is read incrementally,
+// see DecodeStateFromReader.
+func NewAnchorFromCheckpointReader(spec *common.Spec, stateReader io.Reader, stateLength uint64, blockSSZ []byte, opts AnchorOptions) (*Anchor, error) {
+	if err := opts.validateSpec(spec); err != nil {
+		return nil, err
+	}
+	state, _, err := DecodeStateFromReader(spec, stateReader, stateLength)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode checkpoint state: %v", err)
+	}
+	slot, err := state.Slot()
+	if err != nil {
+		return nil, err
+	}
+	if !opts.AllowMidEpoch && slot%spec.SLOTS_PER_EPOCH != 0 {
+		return nil, fmt.Errorf("checkpoint state at slot %d is not at the start of an epoch", slot)
+	}
+	genesisValRoot, err := state.GenesisValidatorsRoot()
+	if err != nil {
+		return nil, err
+	}
+	benv, err := DecodeBlock(spec, genesisValRoot, blockSSZ)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode checkpoint block: %v", err)
+	}
+	if benv.Slot > slot {
+		return nil, fmt.Errorf("checkpoint block at slot %d is after the state at slot %d", benv.Slot, slot)
+	}
+	// The latest header of the state is the block, with the state root filled in by the next slot processing, if any.
+	header, err := state.LatestBlockHeader()
+	if err != nil {
+		return nil, err
+	}
+	if header.StateRoot == (common.Root{}) {
+		header.StateRoot = state.HashTreeRoot(tree.GetHashFn())
+	}
+	if header.StateRoot != benv.StateRoot {
+		return nil, fmt.Errorf("checkpoint block has state root %s, but the state has %s", benv.StateRoot, header.StateRoot)
+	}
+	if root := header.HashTreeRoot(tree.GetHashFn()); root != benv.BlockRoot {
+		return nil, fmt.Errorf("checkpoint block has root %s, but the latest block of the state is %s", benv.BlockRoot, root)
+	}
+	epc, err := common.NewEpochsContext(spec, state)
+	if err != nil {
+		return nil, fmt.Errorf("failed to build epochs context: %v", err)
+	}
+	return &Anchor{State: state, EpochsContext: epc, Block: benv, Slot: slot}, nil
+}
+
+// NewAnchorFromGenesis anchors a chain at a genesis state, like one of phase0.GenesisFromEth1.
+// The block is the genesis block: the latest block header of the state, with an empty phase0 body.
+// The epochs context is computed if nil.
+func NewAnchorFromGenesis(spec *common.Spec, state common.BeaconState, epc *common.EpochsContext) (*Anchor, error) {
+	return NewAnchorFromGenesisWithOptions(spec, state, epc, AnchorOptions{})
+}
+
+// NewAnchorFromGenesisWithOptions is NewAnchorFromGenesis with options. The genesis state is always at the start of an epoch.
+func NewAnchorFromGenesisWithOptions(spec *common.Spec, state common.BeaconState, epc *common.EpochsContext, opts AnchorOptions) (*Anchor, error) {
+	if err := opts.validateSpec(spec); err != nil {
+		return nil, err
+	}
+	slot, err := state.Slot()
+	if err != nil {
+		return nil, err
+	}
+	if slot != common.GENESIS_SLOT {
+		return nil, fmt.Errorf("genesis state is at slot %d", slot)
+	}
+	header, err := state.LatestBlockHeader()
+	if err != nil {
+		return nil, err
+	}
+	if header.StateRoot == (common.Root{}) {
+		header.StateRoot = state.HashTreeRoot(tree.GetHashFn())
+	}
+	genesisValRoot, err := state.GenesisValidatorsRoot()
+	if err != nil {
+		return nil, err
+	}
+	block := &phase0.SignedBeaconBlock{Message: phase0.BeaconBlock{
+		Slot:          header.Slot,
+		ProposerIndex: header.ProposerIndex,
+		ParentRoot:    header.ParentRoot,
+		StateRoot:     header.StateRoot,
+	}}
+	benv := block.Envelope(spec, common.ComputeForkDigest(spec.GENESIS_FORK_VERSION, genesisValRoot))
+	if root := header.HashTreeRoot(tree.GetHashFn()); root != benv.BlockRoot {
+		return nil, fmt.Errorf("latest block %s of the state is not a genesis block with an empty body", root)
+	}
+	if epc == nil {
+		if epc, err = common.NewEpochsContext(spec, state); err != nil {
+			return nil, fmt.Errorf("failed to build epochs context: %v", err)
+		}
+	}
+	return &Anchor{State: state, EpochsContext: epc, Block: benv, Slot: slot}, nil
+}
+
+// DecodeBlock decodes an encoded signed beacon block of any fork, detected by the slot of the block.
+func DecodeBlock(spec *common.Spec, genesisValRoot common.Root, signedBlockSSZ []byte) (*common.BeaconBlockEnvelope, error) {
+	slot, err := BlockSlot(signedBlockSSZ)
+	if err != nil {
+		return nil, err
+	}
+	decoder := beacon.NewForkDecoder(spec, genesisValRoot)
+	digest := decoder.ForkDigest(spec.SlotToEpoch(slot))
+	alloc, err := decoder.BlockAllocator(digest)
+	if err != nil {
+		return nil, err
+	}
+	block := alloc()
+	if err := block.Deserialize(spec, codec.NewDecodingReader(bytes.NewReader(signedBlockSSZ), uint64(len(signedBlockSSZ)))); err != nil {
+		return nil, err
+	}
+	return block.Envelope(spec, digest), nil
+}
@@ -0,0 +1,173 @@
+package transition
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/protolambda/ztyp/codec"
+	"github.com/protolambda/ztyp/tree"
+
+	"github.com/protolambda/zrnt/eth2/beacon"
+	"github.com/protolambda/zrnt/eth2/beacon/common"
+	"github.com/protolambda/zrnt/eth2/beacon/deposits"
+	"github.com/protolambda/zrnt/eth2/beacon/phase0"
+	"github.com/protolambda/zrnt/eth2/beacon/testutil"
+	"github.com/protolambda/zrnt/eth2/configs"
+)
+
+func TestNewAnchorFromCheckpoint(t *testing.T) {
+	spec := *configs.Minimal
+	spec.ALTAIR_FORK_EPOCH = 1
+	chain, err := testutil.GenerateTestChain(&spec, 2, nil, testutil.ChainOptions{Participation: 100})
+	if err != nil {
+		t.Fatal(err)
+	}
+	blockAt := func(slot common.Slot) (*testutil.TestBlock, []byte) {
+		for _, b := range chain.Blocks {
+			if b.Envelope.Slot == slot {
+				var buf bytes.Buffer
+				if err := b.Signed.Serialize(&spec, codec.NewEncodingWriter(&buf)); err != nil {
+					t.Fatal(err)
+				}
+				return b, buf.Bytes()
+			}
+		}
+		t.Fatalf("no block at slot %d", slot)
+		return nil, nil
+	}
+	encode := func(state common.BeaconState) []byte {
+		var buf bytes.Buffer
+		if err := state.Serialize(codec.NewEncodingWriter(&buf)); err != nil {
+			t.Fatal(err)
+		}
+		return buf.Bytes()
+	}
+
+	// the first altair block, at the start of the epoch
+	b, blockSSZ := blockAt(8)
+	stateSSZ := encode(b.PostState)
+	anchor, err := NewAnchorFromCheckpoint(&spec, stateSSZ, blockSSZ, AnchorOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if anchor.Slot != 8 || anchor.Block.BlockRoot != b.Envelope.BlockRoot {
+		t.Fatalf("unexpected anchor at slot %d with block %s", anchor.Slot, anchor.Block.BlockRoot)
+	}
+	if _, err := anchor.EpochsContext.GetBeaconProposer(9); err != nil {
+		t.Fatal(err)
+	}
+
+	// the state after empty slots, at the start of the epoch
+	b7, block7SSZ := blockAt(7)
+	state, _, err := DecodeState(&spec, encode(b7.PostState))
+	if err != nil {
+		t.Fatal(err)
+	}
+	epc, err := common.NewEpochsContext(&spec, state)
+	if err != nil {
+		t.Fatal(err)
+	}
+	upgradeable := &beacon.StandardUpgradeableBeaconState{BeaconState: state}
+	if err := common.ProcessSlots(context.Background(), &spec, epc, upgradeable, 8); err != nil {
+		t.Fatal(err)
+	}
+	anchor, err = NewAnchorFromCheckpoint(&spec, encode(upgradeable.BeaconState), block7SSZ, AnchorOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if anchor.Slot != 8 || anchor.Block.Slot != 7 {
+		t.Fatalf("unexpected anchor at slot %d with block at slot %d", anchor.Slot, anchor.Block.Slot)
+	}
+
+	// not the latest block of the state
+	if _, err := NewAnchorFromCheckpoint(&spec, stateSSZ, block7SSZ, AnchorOptions{}); err == nil {
+		t.Fatal("expected error for block that is not the latest block of the state")
+	}
+	// mid-epoch states are only accepted with the option
+	b5, block5SSZ := blockAt(5)
+	state5SSZ := encode(b5.PostState)
+	if _, err := NewAnchorFromCheckpoint(&spec, state5SSZ, block5SSZ, AnchorOptions{}); err == nil {
+		t.Fatal("expected error for mid-epoch state")
+	}
+	if _, err := NewAnchorFromCheckpoint(&spec, state5SSZ, block5SSZ, AnchorOptions{AllowMidEpoch: true}); err != nil {
+		t.Fatal(err)
+	}
+	// a block after the state
+	if _, err := NewAnchorFromCheckpoint(&spec, state5SSZ, block7SSZ, AnchorOptions{AllowMidEpoch: true}); err == nil {
+		t.Fatal("expected error for block after the state")
+	}
+}
+
+func genesisFromDeposits(t *testing.T, spec *common.Spec) (*phase0.BeaconStateView, *common.EpochsContext) {
+	var keys [][]byte
+	for i := common.ValidatorIndex(0); i < 64; i++ {
+		raw := testutil.InteropKey(i).Serialize()
+		keys = append(keys, raw[:])
+	}
+	deps, _, err := deposits.BuildGenesisDeposits(spec, keys, spec.MAX_EFFECTIVE_BALANCE)
+	if err != nil {
+		t.Fatal(err)
+	}
+	state, epc, err := phase0.GenesisFromEth1(spec, common.Root{0x42}, spec.MIN_GENESIS_TIME, deps, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return state, epc
+}
+
+func TestNewAnchorFromGenesis(t *testing.T) {
+	spec := configs.Minimal
+	state, epc := genesisFromDeposits(t, spec)
+	if valid, err := phase0.IsValidGenesisState(spec, state); err != nil || !valid {
+		t.Fatalf("expected valid genesis state, got %v (%v)", valid, err)
+	}
+	hFn := tree.GetHashFn()
+	root := state.HashTreeRoot(hFn)
+	if other, _ := genesisFromDeposits(t, spec); other.HashTreeRoot(hFn) != root {
+		t.Fatal("genesis state root is not stable")
+	}
+	genesisTime, err := state.GenesisTime()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if genesisTime != spec.MIN_GENESIS_TIME+spec.GENESIS_DELAY {
+		t.Fatalf("unexpected genesis time %d", genesisTime)
+	}
+
+	anchor, err := NewAnchorFromGenesis(spec, state, epc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if anchor.Slot != 0 || anchor.Block.StateRoot != root {
+		t.Fatalf("unexpected anchor at slot %d, with state root %s", anchor.Slot, anchor.Block.StateRoot)
+	}
+	// the next block builds on the genesis block of the anchor
+	upgradeable := &beacon.StandardUpgradeableBeaconState{BeaconState: anchor.State}
+	if err := common.ProcessSlots(context.Background(), spec, anchor.EpochsContext, upgradeable, 1); err != nil {
+		t.Fatal(err)
+	}
+	header, err := upgradeable.LatestBlockHeader()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if header.HashTreeRoot(hFn) != anchor.Block.BlockRoot {
+		t.Fatal("anchor block is not the latest block of the state")
+	}
+	if _, err := NewAnchorFromGenesis(spec, upgradeable, nil); err == nil {
+		t.Fatal("expected error for a state after genesis")
+	}
+
+	// an invalid spec is only accepted when validation is skipped
+	weird := *spec
+	weird.SHUFFLE_ROUND_COUNT = 0
+	state, epc = genesisFromDeposits(t, spec)
+	var specErrs common.SpecErrors
+	if _, err := NewAnchorFromGenesis(&weird, state, epc); !errors.As(err, &specErrs) || len(specErrs) != 1 {
+		t.Fatalf("expected a single spec violation, got %v", err)
+	}
+	if _, err := NewAnchorFromGenesisWithOptions(&weird, state, epc, AnchorOptions{SkipSpecValidation: true}); err != nil {
+		t.Fatal(err)
+	}
+}
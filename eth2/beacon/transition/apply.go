@@ -0,0 +1,329 @@
+// Package transition applies blocks to serialized states, for tooling like CLIs and differential fuzzing.
+package transition
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/protolambda/ztyp/codec"
+	"github.com/protolambda/ztyp/tree"
+
+	"github.com/protolambda/zrnt/eth2/beacon"
+	"github.com/protolambda/zrnt/eth2/beacon/altair"
+	"github.com/protolambda/zrnt/eth2/beacon/bellatrix"
+	"github.com/protolambda/zrnt/eth2/beacon/capella"
+	"github.com/protolambda/zrnt/eth2/beacon/common"
+	"github.com/protolambda/zrnt/eth2/beacon/deneb"
+	"github.com/protolambda/zrnt/eth2/beacon/phase0"
+	"github.com/protolambda/zrnt/eth2/metrics"
+)
+
+type Options struct {
+	// VerifySignatures checks the proposer signature of every block.
+	// The signatures of the operations in the blocks are always verified by the block processing.
+	VerifySignatures bool
+	// VerifyStateRoots checks the state root of every block against the post-state.
+	VerifyStateRoots bool
+	// BatchSignatures verifies the signatures of every block at once, after processing the block.
+	// An invalid signature fails the block at the signature stage.
+	BatchSignatures bool
+	// Tracer follows the steps of the transition, optional.
+	Tracer common.Tracer
+	// TraceStateRoots passes the state root of every step to the tracer.
+	TraceStateRoots bool
+	// Metrics receives the metrics of the transition, optional.
+	Metrics metrics.Sink
+	// ParallelHashing hashes the validator registry with a worker per CPU before the state root of every slot.
+	// The states are decoded for the transition and hashed by nothing else, so this is safe to enable for large registries.
+	ParallelHashing bool
+}
+
+// The stages of applying a block, to report where a block failed.
+const (
+	StageDecode    = "decode"
+	StageSlots     = "slots"
+	StageSignature = "signature"
+	StageBlock     = "block"
+	StageStateRoot = "state_root"
+)
+
+// BlockError is the error of the block that failed to apply.
+type BlockError struct {
+	// Index of the block in the list of blocks
+	Index int
+	// Slot of the block, zero if the block could not be decoded
+	Slot  common.Slot
+	Stage string
+	Err   error
+}
+
+func (e *BlockError) Error() string {
+	return fmt.Sprintf("block %d (slot %d) failed at %s: %v", e.Index, e.Slot, e.Stage, e.Err)
+}
+
+func (e *BlockError) Unwrap() error {
+	return e.Err
+}
+
+type BlockReport struct {
+	Index     int
+	Slot      common.Slot
+	BlockRoot common.Root
+	// Fork digest of the block, as detected from its slot
+	ForkDigest common.ForkDigest
+	// Time spent on processing the empty slots up to the block, incl. epoch transitions
+	SlotsTime time.Duration
+	// Time spent on processing the block, incl. signature and state root verification
+	BlockTime time.Duration
+}
+
+type Report struct {
+	// Fork version of the pre-state
+	PreStateVersion common.Version
+	// Reports of the blocks that were applied, and of the block that failed, if any
+	Blocks []BlockReport
+	// Index of the failed block, -1 if all blocks were applied
+	Failed int
+	// Error of the failed block, nil if all blocks were applied
+	Err *BlockError
+	// Root of the post-state, zero if a block failed.
+	// With ApplyBlocksPrefix, the root of the state after the last valid block.
+	PostStateRoot common.Root
+	// Time spent on decoding the pre-state and building the epochs context
+	LoadTime time.Duration
+}
+
+// ApplyBlocks decodes the pre-state and applies the blocks to it, and returns the encoded post-state.
+// The report is returned also if a block fails: it describes the failed block.
+func ApplyBlocks(ctx context.Context, spec *common.Spec, preStateSSZ []byte, blocksSSZ [][]byte, opts Options) (postStateSSZ []byte, report *Report, err error) {
+	var buf bytes.Buffer
+	report, err = ApplyBlocksTo(ctx, spec, preStateSSZ, blocksSSZ, opts, &buf)
+	if err != nil {
+		return nil, report, err
+	}
+	return buf.Bytes(), report, nil
+}
+
+// ApplyBlocksTo is like ApplyBlocks, but streams the post-state to the writer.
+// Nothing is written if a block fails.
+func ApplyBlocksTo(ctx context.Context, spec *common.Spec, preStateSSZ []byte, blocksSSZ [][]byte, opts Options, w io.Writer) (*Report, error) {
+	return applyBlocks(ctx, spec, preStateSSZ, blocksSSZ, opts, false, w)
+}
+
+// ApplyBlocksPrefix is like ApplyBlocks, but keeps the valid prefix of the blocks: the state is copied before every block,
+// and if a block fails, the state after the last valid block is returned along with the block error.
+// The caller can resume from that state, with the blocks after the valid prefix.
+func ApplyBlocksPrefix(ctx context.Context, spec *common.Spec, preStateSSZ []byte, blocksSSZ [][]byte, opts Options) (postStateSSZ []byte, report *Report, err error) {
+	var buf bytes.Buffer
+	report, err = applyBlocks(ctx, spec, preStateSSZ, blocksSSZ, opts, true, &buf)
+	var blockErr *BlockError
+	if err != nil && !errors.As(err, &blockErr) {
+		return nil, report, err
+	}
+	return buf.Bytes(), report, err
+}
+
+func applyBlocks(ctx context.Context, spec *common.Spec, preStateSSZ []byte, blocksSSZ [][]byte, opts Options,
+	keepPrefix bool, w io.Writer) (*Report, error) {
+	report := &Report{Failed: -1}
+	start := time.Now()
+	state, version, err := DecodeState(spec, preStateSSZ)
+	if err != nil {
+		return report, fmt.Errorf("failed to decode pre-state: %v", err)
+	}
+	report.PreStateVersion = version
+	epc, err := common.NewEpochsContext(spec, state)
+	if err != nil {
+		return report, fmt.Errorf("failed to build epochs context: %v", err)
+	}
+	genesisValRoot, err := state.GenesisValidatorsRoot()
+	if err != nil {
+		return report, err
+	}
+	report.LoadTime = time.Since(start)
+
+	decoder := beacon.NewForkDecoder(spec, genesisValRoot)
+	upgradeable := &beacon.StandardUpgradeableBeaconState{BeaconState: state}
+	var batch *common.SignatureBatch
+	if opts.BatchSignatures {
+		batch = common.NewSignatureBatch()
+	}
+	var blockErr *BlockError
+	for i, data := range blocksSSZ {
+		// the copy shares the tree of the state, a block only adds new nodes for what it changes
+		var last common.BeaconState
+		if keepPrefix {
+			var copyErr error
+			if last, copyErr = upgradeable.BeaconState.CopyState(); copyErr != nil {
+				return report, fmt.Errorf("failed to copy state before block %d: %v", i, copyErr)
+			}
+		}
+		blockReport, err := applyBlock(ctx, spec, epc, decoder, upgradeable, data, batch, opts)
+		blockReport.Index = i
+		report.Blocks = append(report.Blocks, blockReport)
+		if err != nil {
+			err.Index = i
+			report.Failed = i
+			report.Err = err
+			if !keepPrefix {
+				return report, err
+			}
+			upgradeable.BeaconState = last
+			blockErr = err
+			break
+		}
+	}
+
+	post := upgradeable.BeaconState
+	report.PostStateRoot = post.HashTreeRoot(tree.GetHashFn())
+	if err := post.Serialize(codec.NewEncodingWriter(w)); err != nil {
+		return report, fmt.Errorf("failed to encode post-state: %v", err)
+	}
+	if blockErr != nil {
+		return report, blockErr
+	}
+	return report, nil
+}
+
+func applyBlock(ctx context.Context, spec *common.Spec, epc *common.EpochsContext, decoder *beacon.ForkDecoder,
+	state *beacon.StandardUpgradeableBeaconState, data []byte, batch *common.SignatureBatch, opts Options) (out BlockReport, blockErr *BlockError) {
+	fail := func(stage string, err error) (BlockReport, *BlockError) {
+		return out, &BlockError{Slot: out.Slot, Stage: stage, Err: err}
+	}
+	slot, err := BlockSlot(data)
+	if err != nil {
+		return fail(StageDecode, err)
+	}
+	out.Slot = slot
+	out.ForkDigest = decoder.ForkDigest(spec.SlotToEpoch(slot))
+	alloc, err := decoder.BlockAllocator(out.ForkDigest)
+	if err != nil {
+		return fail(StageDecode, err)
+	}
+	block := alloc()
+	if err := block.Deserialize(spec, codec.NewDecodingReader(bytes.NewReader(data), uint64(len(data)))); err != nil {
+		return fail(StageDecode, err)
+	}
+	benv := block.Envelope(spec, out.ForkDigest)
+	out.BlockRoot = benv.BlockRoot
+
+	topts := opts.transitionOptions()
+	start := time.Now()
+	if err := common.ProcessSlotsWithOptions(ctx, spec, epc, state, benv.Slot, topts); err != nil {
+		return fail(StageSlots, err)
+	}
+	out.SlotsTime = time.Since(start)
+
+	start = time.Now()
+	defer func() {
+		out.BlockTime = time.Since(start)
+	}()
+	if batch != nil {
+		batch.Reset()
+	}
+	tr := topts.NewTransition()
+	tr.SignatureBatch = batch
+	if opts.VerifySignatures {
+		if err := common.VerifyProposerSignature(spec, epc, tr, state, benv); err != nil {
+			return fail(StageSignature, err)
+		}
+	}
+	blockStart := time.Now()
+	tr.StartStages()
+	if err := state.ProcessBlock(ctx, spec, epc, tr, benv); err != nil {
+		return fail(StageBlock, err)
+	}
+	if batch != nil {
+		if err := batch.Verify(); err != nil {
+			return fail(StageSignature, err)
+		}
+	}
+	if tr.Metrics != nil {
+		tr.Metrics.Observe(metrics.BlockTransitionSeconds, time.Since(blockStart).Seconds())
+		epc.ReportCacheMetrics(tr.Metrics)
+	}
+	if opts.VerifyStateRoots {
+		if root := state.HashTreeRoot(tree.GetHashFn()); root != benv.StateRoot {
+			return fail(StageStateRoot, fmt.Errorf("block has state root %s, but post-state root is %s", benv.StateRoot, root))
+		}
+	}
+	return out, nil
+}
+
+// transitionOptions are the options of the slots and blocks. The checks are done by applyBlock,
+// to report the stage at which a block fails.
+func (opts *Options) transitionOptions() common.TransitionOptions {
+	return common.TransitionOptions{
+		Tracer:          opts.Tracer,
+		TraceStateRoots: opts.TraceStateRoots,
+		Metrics:         opts.Metrics,
+		ParallelHashing: opts.ParallelHashing,
+	}
+}
+
+// BlockSlot reads the slot of an encoded signed beacon block, of any fork.
+func BlockSlot(signedBlockSSZ []byte) (common.Slot, error) {
+	if len(signedBlockSSZ) < 4 {
+		return 0, errors.New("signed block too short")
+	}
+	offset := uint64(binary.LittleEndian.Uint32(signedBlockSSZ[0:4]))
+	if offset+8 > uint64(len(signedBlockSSZ)) {
+		return 0, fmt.Errorf("invalid block offset %d", offset)
+	}
+	return common.Slot(binary.LittleEndian.Uint64(signedBlockSSZ[offset : offset+8])), nil
+}
+
+// the fork version of the state starts after the genesis time, genesis validators root, slot and previous version.
+const stateVersionOffset = 8 + 32 + 8 + 4
+
+// DecodeState decodes an encoded beacon state of any fork, detected by the current fork version of the state.
+func DecodeState(spec *common.Spec, data []byte) (common.BeaconState, common.Version, error) {
+	return DecodeStateFromReader(spec, bytes.NewReader(data), uint64(len(data)))
+}
+
+// DecodeStateFromReader decodes a beacon state of the given encoded length from the reader, like DecodeState.
+// The state is read incrementally into the tree of the view, without buffering the encoded state,
+// e.g. to load a large checkpoint state from a file or a response body.
+// Reader errors, including a reader that ends early, are returned, and no partial state.
+func DecodeStateFromReader(spec *common.Spec, r io.Reader, length uint64) (common.BeaconState, common.Version, error) {
+	var version common.Version
+	if length < stateVersionOffset+4 {
+		return nil, version, errors.New("state too short")
+	}
+	// the fixed fields before the fork version are read ahead, and decoded again as part of the state
+	var head [stateVersionOffset + 4]byte
+	if _, err := io.ReadFull(r, head[:]); err != nil {
+		return nil, version, fmt.Errorf("failed to read state: %v", err)
+	}
+	copy(version[:], head[stateVersionOffset:])
+	dr := codec.NewDecodingReader(io.MultiReader(bytes.NewReader(head[:]), r), length)
+	var state common.BeaconState
+	var err error
+	fork, ok := spec.ForkSchedule().ForkForVersion(version)
+	if !ok {
+		return nil, version, fmt.Errorf("unrecognized fork version %s", version)
+	}
+	switch fork.Name {
+	case common.Phase0:
+		state, err = phase0.AsBeaconStateView(phase0.BeaconStateType(spec).Deserialize(dr))
+	case common.Altair:
+		state, err = altair.AsBeaconStateView(altair.BeaconStateType(spec).Deserialize(dr))
+	case common.Bellatrix:
+		state, err = bellatrix.AsBeaconStateView(bellatrix.BeaconStateType(spec).Deserialize(dr))
+	case common.Capella:
+		state, err = capella.AsBeaconStateView(capella.BeaconStateType(spec).Deserialize(dr))
+	case common.Deneb:
+		state, err = deneb.AsBeaconStateView(deneb.BeaconStateType(spec).Deserialize(dr))
+	default:
+		return nil, version, fmt.Errorf("unsupported fork %s", fork.Name)
+	}
+	if err != nil {
+		return nil, version, err
+	}
+	return state, version, nil
+}
@@ -0,0 +1,294 @@
+package transition
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/protolambda/ztyp/codec"
+	"github.com/protolambda/ztyp/tree"
+
+	"github.com/protolambda/zrnt/eth2/beacon"
+	"github.com/protolambda/zrnt/eth2/beacon/altair"
+	"github.com/protolambda/zrnt/eth2/beacon/common"
+	"github.com/protolambda/zrnt/eth2/beacon/phase0"
+	"github.com/protolambda/zrnt/eth2/beacon/testutil"
+	"github.com/protolambda/zrnt/eth2/configs"
+)
+
+type testChain struct {
+	t    testing.TB
+	spec *common.Spec
+	// the state and context of the head of the chain
+	state *beacon.StandardUpgradeableBeaconState
+	epc   *common.EpochsContext
+}
+
+// A minimal chain that upgrades to altair at epoch 1.
+func newTestChain(t testing.TB) *testChain {
+	spec := *configs.Minimal
+	spec.ALTAIR_FORK_EPOCH = 1
+	return newTestChainWith(t, &spec, 64)
+}
+
+// newTestChainWith starts a chain of the given validators, with their interop keys.
+func newTestChainWith(t testing.TB, spec *common.Spec, validatorCount uint64) *testChain {
+	state, epc, err := phase0.KickStartState(spec, common.Root{123}, 1564000000, testutil.Validators(spec, validatorCount))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &testChain{t: t, spec: spec, state: &beacon.StandardUpgradeableBeaconState{BeaconState: state}, epc: epc}
+}
+
+func (c *testChain) encodeState() []byte {
+	var buf bytes.Buffer
+	if err := c.state.Serialize(codec.NewEncodingWriter(&buf)); err != nil {
+		c.t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func (c *testChain) sign(index common.ValidatorIndex, domainType common.BLSDomainType, epoch common.Epoch, root common.Root) common.BLSSignature {
+	dom, err := common.GetDomain(c.state, domainType, epoch)
+	if err != nil {
+		c.t.Fatal(err)
+	}
+	return testutil.Sign(root, dom, index)
+}
+
+// addBlock proposes a block with the attestations at the given slot, applies it to the head, and returns the encoded block.
+func (c *testChain) addBlock(slot common.Slot, atts ...phase0.Attestation) []byte {
+	t, spec := c.t, c.spec
+	c.processSlots(slot)
+	proposer, err := c.epc.GetBeaconProposer(slot)
+	if err != nil {
+		t.Fatal(err)
+	}
+	header, err := c.state.LatestBlockHeader()
+	if err != nil {
+		t.Fatal(err)
+	}
+	eth1Data, err := c.state.Eth1Data()
+	if err != nil {
+		t.Fatal(err)
+	}
+	epoch := spec.SlotToEpoch(slot)
+	randaoReveal := c.sign(proposer, common.DOMAIN_RANDAO, epoch, epoch.HashTreeRoot(tree.GetHashFn()))
+	parentRoot := header.HashTreeRoot(tree.GetHashFn())
+
+	var block interface {
+		common.SpecObj
+		common.EnvelopeBuilder
+	}
+	var signature *common.BLSSignature
+	var stateRoot *common.Root
+	if _, ok := c.state.BeaconState.(*phase0.BeaconStateView); ok {
+		b := &phase0.SignedBeaconBlock{Message: phase0.BeaconBlock{
+			Slot: slot, ProposerIndex: proposer, ParentRoot: parentRoot,
+			Body: phase0.BeaconBlockBody{RandaoReveal: randaoReveal, Eth1Data: eth1Data, Attestations: atts},
+		}}
+		block, signature, stateRoot = b, &b.Signature, &b.Message.StateRoot
+	} else {
+		b := &altair.SignedBeaconBlock{Message: altair.BeaconBlock{
+			Slot: slot, ProposerIndex: proposer, ParentRoot: parentRoot,
+			Body: altair.BeaconBlockBody{RandaoReveal: randaoReveal, Eth1Data: eth1Data, Attestations: atts,
+				SyncAggregate: altair.SyncAggregate{
+					SyncCommitteeBits:      make(altair.SyncCommitteeBits, spec.SYNC_COMMITTEE_SIZE/8),
+					SyncCommitteeSignature: common.BLSSignature{0xc0},
+				}},
+		}}
+		block, signature, stateRoot = b, &b.Signature, &b.Message.StateRoot
+	}
+	digest := common.ComputeForkDigest(spec.ForkVersion(slot), c.mustGenesisValRoot())
+	if err := c.state.ProcessBlock(context.Background(), spec, c.epc, nil, block.Envelope(spec, digest)); err != nil {
+		t.Fatal(err)
+	}
+	*stateRoot = c.state.HashTreeRoot(tree.GetHashFn())
+	*signature = c.sign(proposer, common.DOMAIN_BEACON_PROPOSER, epoch, block.Envelope(spec, digest).BlockRoot)
+
+	var buf bytes.Buffer
+	if err := block.Serialize(spec, codec.NewEncodingWriter(&buf)); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+// processSlots advances the head to the slot, if it is not there already.
+func (c *testChain) processSlots(slot common.Slot) {
+	current, err := c.state.Slot()
+	if err != nil {
+		c.t.Fatal(err)
+	}
+	if current < slot {
+		if err := common.ProcessSlots(context.Background(), c.spec, c.epc, c.state, slot); err != nil {
+			c.t.Fatal(err)
+		}
+	}
+}
+
+func (c *testChain) mustGenesisValRoot() common.Root {
+	root, err := c.state.GenesisValidatorsRoot()
+	if err != nil {
+		c.t.Fatal(err)
+	}
+	return root
+}
+
+var testOpts = Options{VerifySignatures: true, VerifyStateRoots: true}
+
+func TestApplyBlocks(t *testing.T) {
+	chain := newTestChain(t)
+	pre := chain.encodeState()
+	// phase0 blocks, then altair blocks after the fork, with a gap of empty slots in between
+	var blocks [][]byte
+	for _, slot := range []common.Slot{1, 2, 5, 10, 11} {
+		blocks = append(blocks, chain.addBlock(slot))
+	}
+	expected := chain.encodeState()
+
+	post, report, err := ApplyBlocks(context.Background(), chain.spec, pre, blocks, testOpts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(post, expected) {
+		t.Fatal("post-state does not match")
+	}
+	if report.Failed != -1 || report.Err != nil || len(report.Blocks) != len(blocks) {
+		t.Fatalf("unexpected report: %+v", report)
+	}
+	if report.PreStateVersion != chain.spec.GENESIS_FORK_VERSION {
+		t.Fatalf("expected phase0 pre-state, got version %s", report.PreStateVersion)
+	}
+	if report.PostStateRoot != chain.state.HashTreeRoot(tree.GetHashFn()) {
+		t.Fatal("unexpected post-state root")
+	}
+	batchOpts := testOpts
+	batchOpts.BatchSignatures = true
+	if batched, _, err := ApplyBlocks(context.Background(), chain.spec, pre, blocks, batchOpts); err != nil {
+		t.Fatal(err)
+	} else if !bytes.Equal(batched, expected) {
+		t.Fatal("batched post-state does not match")
+	}
+	if last := report.Blocks[4]; last.Slot != 11 || last.ForkDigest != common.ComputeForkDigest(chain.spec.ALTAIR_FORK_VERSION, chain.mustGenesisValRoot()) {
+		t.Fatalf("expected altair block at slot 11, got %+v", last)
+	}
+
+	// the post-state is an altair state, and can be continued from
+	next := chain.addBlock(12)
+	post2, _, err := ApplyBlocks(context.Background(), chain.spec, post, [][]byte{next}, testOpts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(post2, chain.encodeState()) {
+		t.Fatal("post-state of altair pre-state does not match")
+	}
+	// deterministic output
+	again, _, err := ApplyBlocks(context.Background(), chain.spec, pre, blocks, testOpts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(again, post) {
+		t.Fatal("expected the same post-state")
+	}
+}
+
+func TestApplyBlocksFailure(t *testing.T) {
+	chain := newTestChain(t)
+	pre := chain.encodeState()
+	var blocks [][]byte
+	for _, slot := range []common.Slot{1, 2, 3} {
+		blocks = append(blocks, chain.addBlock(slot))
+	}
+	corrupt := func(index int, offset int) [][]byte {
+		out := append([][]byte(nil), blocks...)
+		out[index] = append([]byte(nil), blocks[index]...)
+		out[index][offset] ^= 0xff
+		return out
+	}
+	check := func(name string, ctx context.Context, blocks [][]byte, opts Options, failed int, stage string) {
+		post, report, err := ApplyBlocks(ctx, chain.spec, pre, blocks, opts)
+		var blockErr *BlockError
+		if !errors.As(err, &blockErr) {
+			t.Fatalf("%s: expected block error, got %v", name, err)
+		}
+		if post != nil || report.Failed != failed || blockErr.Index != failed || blockErr.Stage != stage {
+			t.Fatalf("%s: expected block %d to fail at %s, got %v (report failed %d)", name, failed, stage, err, report.Failed)
+		}
+		if len(report.Blocks) != failed+1 {
+			t.Fatalf("%s: expected reports up to the failed block, got %d", name, len(report.Blocks))
+		}
+	}
+	// the state root follows the slot, proposer index and parent root of the block
+	stateRootOffset := 100 + 8 + 8 + 32
+	check("state root", context.Background(), corrupt(1, stateRootOffset), Options{VerifyStateRoots: true}, 1, StageStateRoot)
+	// the signature is checked first, and signs the state root too
+	check("signed state root", context.Background(), corrupt(1, stateRootOffset), testOpts, 1, StageSignature)
+	// the signature follows the offset of the block message
+	check("signature", context.Background(), corrupt(2, 4), testOpts, 2, StageSignature)
+	batchOpts := testOpts
+	batchOpts.BatchSignatures = true
+	check("batched signature", context.Background(), corrupt(2, 4), batchOpts, 2, StageSignature)
+	check("decode", context.Background(), [][]byte{blocks[0], {1, 2}}, testOpts, 1, StageDecode)
+	check("slots", context.Background(), [][]byte{blocks[0], blocks[0]}, testOpts, 1, StageSlots)
+	check("parent", context.Background(), [][]byte{blocks[1]}, testOpts, 0, StageBlock)
+
+	// without verification, the corrupted blocks are applied
+	if _, _, err := ApplyBlocks(context.Background(), chain.spec, pre, corrupt(1, stateRootOffset), Options{}); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := ApplyBlocks(context.Background(), chain.spec, pre, corrupt(2, 4), Options{}); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	check("cancelled", ctx, blocks, testOpts, 0, StageSlots)
+}
+
+func TestApplyBlocksPrefix(t *testing.T) {
+	chain := newTestChain(t)
+	pre := chain.encodeState()
+	var blocks [][]byte
+	var states [][]byte
+	for _, slot := range []common.Slot{1, 2, 3, 9} {
+		blocks = append(blocks, chain.addBlock(slot))
+		states = append(states, chain.encodeState())
+	}
+	// the last block is an altair block, resuming crosses the fork
+	invalid := append([][]byte(nil), blocks...)
+	invalid[2] = append([]byte(nil), blocks[2]...)
+	invalid[2][4] ^= 0xff
+
+	post, report, err := ApplyBlocksPrefix(context.Background(), chain.spec, pre, invalid, testOpts)
+	var blockErr *BlockError
+	if !errors.As(err, &blockErr) || blockErr.Index != 2 || blockErr.Stage != StageSignature {
+		t.Fatalf("expected block 2 to fail at the signature, got %v", err)
+	}
+	if report.Failed != 2 || len(report.Blocks) != 3 {
+		t.Fatalf("unexpected report: %+v", report)
+	}
+	if !bytes.Equal(post, states[1]) {
+		t.Fatal("expected the state of the valid prefix")
+	}
+	if root := report.PostStateRoot; root == (common.Root{}) {
+		t.Fatal("expected the root of the valid prefix")
+	}
+
+	// resume from the valid prefix
+	post, report, err = ApplyBlocksPrefix(context.Background(), chain.spec, post, blocks[2:], testOpts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.Failed != -1 || !bytes.Equal(post, states[3]) {
+		t.Fatal("expected the post-state of all blocks after resuming")
+	}
+	if report.PostStateRoot != chain.state.HashTreeRoot(tree.GetHashFn()) {
+		t.Fatal("unexpected post-state root")
+	}
+
+	// an invalid pre-state has no valid prefix
+	if post, _, err := ApplyBlocksPrefix(context.Background(), chain.spec, []byte{1, 2, 3}, blocks, testOpts); err == nil || post != nil {
+		t.Fatalf("expected pre-state error, got %v", err)
+	}
+}
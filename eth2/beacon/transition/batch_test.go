@@ -0,0 +1,139 @@
+package transition
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/protolambda/zrnt/eth2/beacon"
+	"github.com/protolambda/zrnt/eth2/beacon/common"
+	"github.com/protolambda/zrnt/eth2/beacon/phase0"
+	"github.com/protolambda/zrnt/eth2/beacon/testutil"
+	"github.com/protolambda/zrnt/eth2/configs"
+)
+
+func batchTestChain(t testing.TB, validators uint64) *testutil.TestChain {
+	spec := *configs.Minimal
+	spec.ALTAIR_FORK_EPOCH = 1
+	chain, err := testutil.GenerateTestChain(&spec, 2, nil, testutil.ChainOptions{Validators: validators, Participation: 100})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return chain
+}
+
+// preState returns a copy of the state before the block at index i of the chain, and its context.
+func preState(t testing.TB, chain *testutil.TestChain, i int) (*beacon.StandardUpgradeableBeaconState, *common.EpochsContext) {
+	pre := chain.Genesis
+	if i > 0 {
+		pre = chain.Blocks[i-1].PostState
+	}
+	state, err := pre.CopyState()
+	if err != nil {
+		t.Fatal(err)
+	}
+	epc, err := common.NewEpochsContext(chain.Spec, state)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &beacon.StandardUpgradeableBeaconState{BeaconState: state}, epc
+}
+
+// blockWithAttestations returns the index of the first block of the fork of the given epoch with at least n attestations.
+func blockWithAttestations(t testing.TB, chain *testutil.TestChain, epoch common.Epoch, n int) int {
+	for i, b := range chain.Blocks {
+		if chain.Spec.SlotToEpoch(b.Envelope.Slot) != epoch {
+			continue
+		}
+		atts, err := beacon.EnvelopeAttestations(b.Envelope)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(atts) >= n {
+			return i
+		}
+	}
+	t.Fatalf("no block with %d attestations in epoch %d", n, epoch)
+	return 0
+}
+
+func TestBatchedTransition(t *testing.T) {
+	ctx := context.Background()
+	chain := batchTestChain(t, 0)
+	state, epc := preState(t, chain, 0)
+	batch := common.NewSignatureBatch()
+	for _, b := range chain.Blocks {
+		if err := common.StateTransitionWithBatch(ctx, chain.Spec, epc, state, b.Envelope, true, batch); err != nil {
+			t.Fatalf("block at slot %d: %v", b.Envelope.Slot, err)
+		}
+		if batch.Len() == 0 {
+			t.Fatal("expected the signatures of the block in the batch")
+		}
+	}
+
+	for _, epoch := range []common.Epoch{0, 1} {
+		i := blockWithAttestations(t, chain, epoch, 2)
+		benv := chain.Blocks[i].Envelope
+		atts, _ := beacon.EnvelopeAttestations(benv)
+		// a valid signature, of another attestation
+		orig := atts[1].Signature
+		atts[1].Signature = atts[0].Signature
+		state, epc := preState(t, chain, i)
+		err := common.StateTransitionWithBatch(ctx, chain.Spec, epc, state, benv, false, batch)
+		if err == nil || !strings.Contains(err.Error(), "attestation 1") {
+			t.Fatalf("epoch %d: expected invalid signature of attestation 1, got %v", epoch, err)
+		}
+		state, epc = preState(t, chain, i)
+		if err := common.StateTransition(ctx, chain.Spec, epc, state, benv, false); err == nil {
+			t.Fatalf("epoch %d: expected invalid attestation without batch", epoch)
+		}
+		atts[1].Signature = orig
+	}
+
+	// a bad proposer signature
+	benv := *chain.Blocks[2].Envelope
+	benv.Signature = chain.Blocks[3].Envelope.Signature
+	state, epc = preState(t, chain, 2)
+	err := common.StateTransitionWithBatch(ctx, chain.Spec, epc, state, &benv, true, batch)
+	if err == nil || !strings.Contains(err.Error(), "of block") {
+		t.Fatalf("expected invalid block signature, got %v", err)
+	}
+}
+
+// A block with the maximum number of attestations, verified one by one or as a batch.
+func BenchmarkBlockSignatures(b *testing.B) {
+	ctx := context.Background()
+	chain := batchTestChain(b, 256)
+	i := blockWithAttestations(b, chain, 0, 1)
+	benv := chain.Blocks[i].Envelope
+	body := benv.Body.(*phase0.BeaconBlockBody)
+	atts := body.Attestations
+	full := make(phase0.Attestations, 0, chain.Spec.MAX_ATTESTATIONS)
+	for len(full) < int(chain.Spec.MAX_ATTESTATIONS) {
+		full = append(full, atts[len(full)%len(atts)])
+	}
+	body.Attestations = full
+	defer func() {
+		body.Attestations = atts
+	}()
+	run := func(b *testing.B, batch *common.SignatureBatch) {
+		for n := 0; n < b.N; n++ {
+			b.StopTimer()
+			state, epc := preState(b, chain, i)
+			if err := common.ProcessSlots(ctx, chain.Spec, epc, state, benv.Slot); err != nil {
+				b.Fatal(err)
+			}
+			b.StartTimer()
+			// the block root changed with the attestations: skip the proposer signature and state root
+			if err := common.PostSlotTransitionWithBatch(ctx, chain.Spec, epc, state, benv, false, batch); err != nil {
+				b.Fatal(err)
+			}
+		}
+	}
+	b.Run("individual", func(b *testing.B) {
+		run(b, nil)
+	})
+	b.Run("batch", func(b *testing.B) {
+		run(b, common.NewSignatureBatch())
+	})
+}
@@ -0,0 +1,94 @@
+package transition
+
+import (
+	"bufio"
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+	"testing/iotest"
+
+	"github.com/protolambda/ztyp/codec"
+	"github.com/protolambda/ztyp/tree"
+
+	"github.com/protolambda/zrnt/eth2/beacon/common"
+)
+
+func encodeState(t testing.TB, state common.BeaconState) []byte {
+	var buf bytes.Buffer
+	if err := state.Serialize(codec.NewEncodingWriter(&buf)); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestDecodeStateFromReader(t *testing.T) {
+	chain := batchTestChain(t, 0)
+	hFn := tree.GetHashFn()
+	for _, pre := range []common.BeaconState{chain.Genesis, chain.Blocks[len(chain.Blocks)-1].PostState} {
+		data := encodeState(t, pre)
+		buffered, version, err := DecodeState(chain.Spec, data)
+		if err != nil {
+			t.Fatal(err)
+		}
+		// a byte at a time, followed by other data
+		r := bytes.NewReader(append(append([]byte{}, data...), 1, 2, 3))
+		streamed, streamedVersion, err := DecodeStateFromReader(chain.Spec, iotest.OneByteReader(r), uint64(len(data)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if streamedVersion != version || streamed.HashTreeRoot(hFn) != buffered.HashTreeRoot(hFn) {
+			t.Fatalf("version %s: streamed state differs from the buffered state", version)
+		}
+		if r.Len() != 3 {
+			t.Fatalf("expected the data after the state to be left unread, %d bytes left", r.Len())
+		}
+
+		// truncated input
+		for _, n := range []int{0, 20, stateVersionOffset + 4, len(data) / 2, len(data) - 1} {
+			state, _, err := DecodeStateFromReader(chain.Spec, bytes.NewReader(data[:n]), uint64(len(data)))
+			if err == nil || state != nil {
+				t.Fatalf("version %s: expected error for input truncated to %d bytes", version, n)
+			}
+		}
+		if state, _, err := DecodeStateFromReader(chain.Spec, bytes.NewReader(data), uint64(len(data)-1)); err == nil || state != nil {
+			t.Fatalf("version %s: expected error for a state that does not fit the length", version)
+		}
+	}
+}
+
+// Loading a state from a file, buffered or streamed. The bytes allocated per op include the buffered encoding.
+func BenchmarkDecodeState(b *testing.B) {
+	chain := batchTestChain(b, 1024)
+	data := encodeState(b, chain.Blocks[len(chain.Blocks)-1].PostState)
+	path := filepath.Join(b.TempDir(), "state.ssz")
+	if err := os.WriteFile(path, data, 0o644); err != nil {
+		b.Fatal(err)
+	}
+	b.Run("buffered", func(b *testing.B) {
+		b.ReportAllocs()
+		for n := 0; n < b.N; n++ {
+			data, err := os.ReadFile(path)
+			if err != nil {
+				b.Fatal(err)
+			}
+			if _, _, err := DecodeState(chain.Spec, data); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+	b.Run("streamed", func(b *testing.B) {
+		b.ReportAllocs()
+		for n := 0; n < b.N; n++ {
+			f, err := os.Open(path)
+			if err != nil {
+				b.Fatal(err)
+			}
+			_, _, err = DecodeStateFromReader(chain.Spec, bufio.NewReader(f), uint64(len(data)))
+			f.Close()
+			if err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+}
@@ -0,0 +1,108 @@
+package transition
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	"github.com/protolambda/zrnt/eth2/beacon"
+	"github.com/protolambda/zrnt/eth2/beacon/common"
+	"github.com/protolambda/zrnt/eth2/beacon/phase0"
+	"github.com/protolambda/zrnt/eth2/beacon/testutil"
+	"github.com/protolambda/zrnt/eth2/configs"
+)
+
+func balancesOf(t *testing.T, state common.BeaconState) []common.Gwei {
+	bals, err := state.Balances()
+	if err != nil {
+		t.Fatal(err)
+	}
+	count, err := bals.Length()
+	if err != nil {
+		t.Fatal(err)
+	}
+	out := make([]common.Gwei, count)
+	for i := range out {
+		if out[i], err = bals.GetBalance(common.ValidatorIndex(i)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return out
+}
+
+// The deltas of an epoch must reconcile with the balance changes of the epoch transition.
+func TestAttestationDeltas(t *testing.T) {
+	ctx := context.Background()
+	spec := *configs.Minimal
+	chain, err := testutil.GenerateTestChain(&spec, 3, nil, testutil.ChainOptions{Participation: 75})
+	if err != nil {
+		t.Fatal(err)
+	}
+	checked := 0
+	for _, b := range chain.Blocks {
+		// the last block of an epoch
+		if (b.Envelope.Slot+1)%spec.SLOTS_PER_EPOCH != 0 {
+			continue
+		}
+		copied, err := b.PostState.CopyState()
+		if err != nil {
+			t.Fatal(err)
+		}
+		state := copied.(*phase0.BeaconStateView)
+		epc, err := common.NewEpochsContext(&spec, state)
+		if err != nil {
+			t.Fatal(err)
+		}
+		deltas, err := phase0.AttestationDeltas(ctx, &spec, epc, state)
+		if err != nil {
+			t.Fatal(err)
+		}
+		pre := balancesOf(t, state)
+		if err := common.ProcessSlots(ctx, &spec, epc, &beacon.StandardUpgradeableBeaconState{BeaconState: state}, b.Envelope.Slot+1); err != nil {
+			t.Fatal(err)
+		}
+		post := balancesOf(t, state)
+		total := deltas.Total()
+		var rewarded, penalized int
+		for i := range pre {
+			expected := pre[i] + total.Rewards[i]
+			if total.Penalties[i] > expected {
+				expected = 0
+			} else {
+				expected -= total.Penalties[i]
+			}
+			if post[i] != expected {
+				t.Fatalf("slot %d: validator %d: expected balance %d, got %d", b.Envelope.Slot, i, expected, post[i])
+			}
+			if total.Rewards[i] > total.Penalties[i] {
+				rewarded++
+			} else if total.Penalties[i] > total.Rewards[i] {
+				penalized++
+			}
+		}
+		if spec.SlotToEpoch(b.Envelope.Slot) > 0 && (rewarded == 0 || penalized == 0) {
+			t.Fatalf("slot %d: expected rewarded and penalized validators, got %d and %d", b.Envelope.Slot, rewarded, penalized)
+		}
+		checked++
+	}
+	if checked < 2 {
+		t.Fatalf("expected to check multiple epochs, checked %d", checked)
+	}
+}
+
+func TestRewardsAndPenaltiesJSON(t *testing.T) {
+	deltas := phase0.NewRewardsAndPenalties(2)
+	deltas.Head.Rewards[1] = 123
+	deltas.Inactivity.Penalties[0] = 45
+	data, err := json.Marshal(deltas)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var decoded phase0.RewardsAndPenalties
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		t.Fatal(err)
+	}
+	if decoded.Head.Rewards[1] != 123 || decoded.Inactivity.Penalties[0] != 45 || len(decoded.InclusionDelay.Rewards) != 2 {
+		t.Fatalf("unexpected decoded deltas from %s", data)
+	}
+}
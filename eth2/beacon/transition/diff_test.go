@@ -0,0 +1,292 @@
+//go:build difftest
+// +build difftest
+
+package transition
+
+import (
+	"bytes"
+	"context"
+	"flag"
+	"fmt"
+	"math/rand"
+	"testing"
+
+	"github.com/protolambda/ztyp/codec"
+	"github.com/protolambda/ztyp/tree"
+
+	"github.com/protolambda/zrnt/eth2/beacon"
+	"github.com/protolambda/zrnt/eth2/beacon/altair"
+	"github.com/protolambda/zrnt/eth2/beacon/common"
+	"github.com/protolambda/zrnt/eth2/beacon/phase0"
+	"github.com/protolambda/zrnt/eth2/beacon/testutil"
+	"github.com/protolambda/zrnt/eth2/configs"
+)
+
+// The differential transition test is a long test, run it with:
+//
+//	go test -tags difftest -run TestDifferentialTransition ./eth2/beacon/transition -diff.runs 100
+var (
+	diffRuns = flag.Int("diff.runs", 20, "number of random chains to run through both transition paths")
+	diffSeed = flag.Int64("diff.seed", 1, "seed of the first random chain, the next chains use the next seeds")
+)
+
+// diffPlan describes a chain to generate: the validators at genesis, and the blocks on top of genesis.
+type diffPlan struct {
+	Validators uint64
+	Blocks     []diffBlock
+}
+
+type diffBlock struct {
+	Slot common.Slot
+	// Slots between the attested slot and the block, minus 1
+	Delay common.Slot
+	// Share of every committee of the attested slot that attests, in percent
+	Participation uint8
+	// Seed of the selection of attesters
+	Seed int64
+}
+
+func (p diffPlan) String() string {
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "%d validators, %d blocks:", p.Validators, len(p.Blocks))
+	for _, b := range p.Blocks {
+		fmt.Fprintf(&buf, " {slot %d, delay %d, participation %d%%, seed %d}", b.Slot, b.Delay, b.Participation, b.Seed)
+	}
+	return buf.String()
+}
+
+func randomDiffPlan(rng *rand.Rand) diffPlan {
+	plan := diffPlan{Validators: 32 * uint64(1+rng.Intn(3))}
+	slot := common.Slot(0)
+	// a few epochs, across the altair upgrade
+	for slot < 40 {
+		if rng.Intn(10) == 0 {
+			slot += common.Slot(5 + rng.Intn(10))
+		} else {
+			slot += common.Slot(1 + rng.Intn(2))
+		}
+		plan.Blocks = append(plan.Blocks, diffBlock{
+			Slot:          slot,
+			Delay:         common.Slot(rng.Intn(3)),
+			Participation: uint8(rng.Intn(101)),
+			Seed:          rng.Int63(),
+		})
+	}
+	return plan
+}
+
+// divergence describes the first post-state where the transition paths diverge.
+type divergence struct {
+	Block    int
+	Slot     common.Slot
+	Path     string
+	Expected common.Root
+	Got      common.Root
+}
+
+func (d *divergence) String() string {
+	return fmt.Sprintf("block %d (slot %d): %s post-state root %s, expected %s", d.Block, d.Slot, d.Path, d.Got, d.Expected)
+}
+
+// attest creates an aggregate attestation of the share of the committee.
+func (c *testChain) attest(rng *rand.Rand, slot common.Slot, index common.CommitteeIndex, participation uint8) (phase0.Attestation, bool) {
+	t, spec := c.t, c.spec
+	committee, err := c.epc.GetBeaconCommittee(slot, index)
+	if err != nil {
+		t.Fatal(err)
+	}
+	currentSlot, err := c.state.Slot()
+	if err != nil {
+		t.Fatal(err)
+	}
+	target := spec.SlotToEpoch(slot)
+	var source common.Checkpoint
+	if target == spec.SlotToEpoch(currentSlot) {
+		source, err = c.state.CurrentJustifiedCheckpoint()
+	} else {
+		source, err = c.state.PreviousJustifiedCheckpoint()
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	targetRoot, err := common.GetBlockRoot(spec, c.state, target)
+	if err != nil {
+		t.Fatal(err)
+	}
+	headRoot, err := common.GetBlockRootAtSlot(spec, c.state, slot)
+	if err != nil {
+		t.Fatal(err)
+	}
+	att := phase0.Attestation{
+		AggregationBits: phase0.NewAttestationBits(uint64(len(committee))),
+		Data: phase0.AttestationData{
+			Slot:            slot,
+			Index:           index,
+			BeaconBlockRoot: headRoot,
+			Source:          source,
+			Target:          common.Checkpoint{Epoch: target, Root: targetRoot},
+		},
+	}
+	var attesters []common.ValidatorIndex
+	for i, vi := range committee {
+		if rng.Intn(100) < int(participation) {
+			att.AggregationBits.SetBit(uint64(i), true)
+			attesters = append(attesters, vi)
+		}
+	}
+	if len(attesters) == 0 {
+		return att, false
+	}
+	dom, err := common.GetDomain(c.state, common.DOMAIN_BEACON_ATTESTER, target)
+	if err != nil {
+		t.Fatal(err)
+	}
+	att.Signature = testutil.Sign(att.Data.HashTreeRoot(tree.GetHashFn()), dom, attesters...)
+	return att, true
+}
+
+// checkStructRoot decodes the post-state into the flat struct of its fork, and returns the struct root.
+func checkStructRoot(t testing.TB, spec *common.Spec, state common.BeaconState) common.Root {
+	var buf bytes.Buffer
+	if err := state.Serialize(codec.NewEncodingWriter(&buf)); err != nil {
+		t.Fatal(err)
+	}
+	var obj common.SpecObj
+	switch state.(type) {
+	case *phase0.BeaconStateView:
+		obj = new(phase0.BeaconState)
+	case *altair.BeaconStateView:
+		obj = new(altair.BeaconState)
+	default:
+		t.Fatalf("unexpected state type %T", state)
+	}
+	if err := obj.Deserialize(spec, codec.NewDecodingReader(bytes.NewReader(buf.Bytes()), uint64(buf.Len()))); err != nil {
+		t.Fatal(err)
+	}
+	return obj.HashTreeRoot(spec, tree.GetHashFn())
+}
+
+// runDiffPlan produces the blocks of the plan with the reference transition: a context without caches,
+// serial epoch processing, and no participation tallies. It applies the same blocks with the optimized transition:
+// a context with all caches, parallel epoch processing, and the participation tallies of the state.
+// The post-states must match, and so must their flat struct roots.
+func runDiffPlan(t testing.TB, plan diffPlan) *divergence {
+	spec := *configs.Minimal
+	spec.ALTAIR_FORK_EPOCH = 2
+	ref := newTestChainWith(t, &spec, plan.Validators)
+
+	genesis, _, err := DecodeState(&spec, ref.encodeState())
+	if err != nil {
+		t.Fatal(err)
+	}
+	opt := &beacon.StandardUpgradeableBeaconState{BeaconState: genesis}
+	optEpc, err := common.NewEpochsContextWithCaches(&spec, opt, common.NewShufflingCache(4), common.NewProposerCache(4))
+	if err != nil {
+		t.Fatal(err)
+	}
+	optEpc.IndexedAttestationCache = common.NewIndexedAttestationCache(64)
+	optEpc.CommitteeCache = common.NewCommitteeCache(16)
+	optEpc.EpochProcessParallelism = 4
+
+	for i, b := range plan.Blocks {
+		// the reference sums up the participation at every epoch transition
+		ref.state.ParticipationTallies().Invalidate()
+		ref.processSlots(b.Slot)
+		var atts []phase0.Attestation
+		if attSlot := b.Slot - 1 - b.Delay; b.Slot > b.Delay && attSlot+spec.SLOTS_PER_EPOCH >= b.Slot {
+			rng := rand.New(rand.NewSource(b.Seed))
+			count, err := ref.epc.GetCommitteeCountPerSlot(spec.SlotToEpoch(attSlot))
+			if err != nil {
+				t.Fatal(err)
+			}
+			for index := common.CommitteeIndex(0); uint64(index) < count; index++ {
+				if att, ok := ref.attest(rng, attSlot, index, b.Participation); ok {
+					atts = append(atts, att)
+				}
+			}
+		}
+		data := ref.addBlock(b.Slot, atts...)
+		expected := ref.state.HashTreeRoot(tree.GetHashFn())
+
+		if structRoot := checkStructRoot(t, &spec, ref.state.BeaconState); structRoot != expected {
+			return &divergence{Block: i, Slot: b.Slot, Path: "flat struct", Expected: expected, Got: structRoot}
+		}
+
+		digest := common.ComputeForkDigest(spec.ForkVersion(b.Slot), ref.mustGenesisValRoot())
+		alloc, err := beacon.NewForkDecoder(&spec, ref.mustGenesisValRoot()).BlockAllocator(digest)
+		if err != nil {
+			t.Fatal(err)
+		}
+		block := alloc()
+		if err := block.Deserialize(&spec, codec.NewDecodingReader(bytes.NewReader(data), uint64(len(data)))); err != nil {
+			t.Fatal(err)
+		}
+		// the state root of the block is the reference root, the optimized transition does not check it
+		if err := common.StateTransition(context.Background(), &spec, optEpc, opt, block.Envelope(&spec, digest), false); err != nil {
+			return &divergence{Block: i, Slot: b.Slot, Path: fmt.Sprintf("optimized (error: %v)", err), Expected: expected}
+		}
+		if got := opt.HashTreeRoot(tree.GetHashFn()); got != expected {
+			return &divergence{Block: i, Slot: b.Slot, Path: "optimized", Expected: expected, Got: got}
+		}
+	}
+	return nil
+}
+
+// shrinkDiffPlan reduces a diverging plan to a smaller plan that still diverges.
+func shrinkDiffPlan(t testing.TB, plan diffPlan, div *divergence) (diffPlan, *divergence) {
+	// the blocks after the divergence do not matter
+	plan.Blocks = plan.Blocks[:div.Block+1]
+	try := func(candidate diffPlan) bool {
+		d := runDiffPlan(t, candidate)
+		if d == nil {
+			return false
+		}
+		candidate.Blocks = candidate.Blocks[:d.Block+1]
+		plan, div = candidate, d
+		return true
+	}
+	for changed := true; changed; {
+		changed = false
+		for i := 0; i < len(plan.Blocks); i++ {
+			candidate := plan
+			candidate.Blocks = append(append([]diffBlock(nil), plan.Blocks[:i]...), plan.Blocks[i+1:]...)
+			if len(candidate.Blocks) > 0 && try(candidate) {
+				changed = true
+				i--
+			}
+		}
+		for i := range plan.Blocks {
+			if plan.Blocks[i].Participation == 0 {
+				continue
+			}
+			candidate := plan
+			candidate.Blocks = append([]diffBlock(nil), plan.Blocks...)
+			candidate.Blocks[i].Participation = 0
+			if try(candidate) {
+				changed = true
+			}
+		}
+		if plan.Validators > 32 {
+			candidate := plan
+			candidate.Validators -= 32
+			if try(candidate) {
+				changed = true
+			}
+		}
+	}
+	return plan, div
+}
+
+func TestDifferentialTransition(t *testing.T) {
+	defer func(prev bool) { phase0.CheckParticipationTallies = prev }(phase0.CheckParticipationTallies)
+	phase0.CheckParticipationTallies = true
+	for i := 0; i < *diffRuns; i++ {
+		seed := *diffSeed + int64(i)
+		plan := randomDiffPlan(rand.New(rand.NewSource(seed)))
+		if div := runDiffPlan(t, plan); div != nil {
+			t.Logf("seed %d diverges at %s", seed, div)
+			plan, div = shrinkDiffPlan(t, plan, div)
+			t.Fatalf("seed %d diverges, minimal plan: %s\ndivergence: %s", seed, plan, div)
+		}
+	}
+}
@@ -0,0 +1,170 @@
+//go:build go1.18
+// +build go1.18
+
+package transition
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/golang/snappy"
+	"github.com/protolambda/ztyp/codec"
+	"github.com/protolambda/ztyp/tree"
+	"github.com/protolambda/ztyp/view"
+
+	"github.com/protolambda/zrnt/eth2/beacon/altair"
+	"github.com/protolambda/zrnt/eth2/beacon/bellatrix"
+	"github.com/protolambda/zrnt/eth2/beacon/capella"
+	"github.com/protolambda/zrnt/eth2/beacon/common"
+	"github.com/protolambda/zrnt/eth2/beacon/deneb"
+	"github.com/protolambda/zrnt/eth2/beacon/phase0"
+	"github.com/protolambda/zrnt/eth2/configs"
+)
+
+// addVectorSeeds adds the serialized SSZ objects of the type name in the spec test vectors to the fuzz corpus.
+// The vectors are located with the ZRNT_SPEC_TESTS environment variable, like the spec tests,
+// and are skipped if missing.
+func addVectorSeeds(f *testing.F, typeName string) {
+	root := os.Getenv("ZRNT_SPEC_TESTS")
+	if root == "" {
+		root = filepath.Join("..", "..", "..", "tests", "spec", "eth2.0-spec-tests")
+	}
+	// tests/<preset>/<fork>/ssz_static/<type>/<suite>/<case>/serialized.ssz_snappy
+	paths, err := filepath.Glob(filepath.Join(root, "tests", "minimal", "*", "ssz_static", typeName, "*", "*", "serialized.ssz_snappy"))
+	if err != nil {
+		f.Fatal(err)
+	}
+	for _, p := range paths {
+		data, err := ioutil.ReadFile(p)
+		if err != nil {
+			f.Fatal(err)
+		}
+		if data, err = snappy.Decode(nil, data); err != nil {
+			f.Fatalf("failed to decompress %s: %v", p, err)
+		}
+		f.Add(data)
+	}
+}
+
+func encodeSpecObj(f *testing.F, spec *common.Spec, obj common.SpecObj) []byte {
+	var buf bytes.Buffer
+	if err := obj.Serialize(spec, codec.NewEncodingWriter(&buf)); err != nil {
+		f.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+// sszType is a struct type to fuzz, and the view type that it must agree with.
+type sszType struct {
+	alloc func() common.SpecObj
+	view  view.TypeDef
+}
+
+// checkDecode decodes the data into every type, and checks that the struct decoding agrees with the
+// view decoding on canonical encodings, and that decoded objects encode back to the same data, with the same root.
+func checkDecode(t *testing.T, spec *common.Spec, data []byte, types map[string]sszType) {
+	for name, typ := range types {
+		obj := typ.alloc()
+		err := obj.Deserialize(spec, codec.NewDecodingReader(bytes.NewReader(data), uint64(len(data))))
+		v, viewErr := typ.view.Deserialize(codec.NewDecodingReader(bytes.NewReader(data), uint64(len(data))))
+		if err != nil {
+			// The view decoding is more lenient with offsets, but canonical encodings must decode either way.
+			if viewErr == nil {
+				var buf bytes.Buffer
+				if v.Serialize(codec.NewEncodingWriter(&buf)) == nil && bytes.Equal(buf.Bytes(), data) {
+					t.Fatalf("%s: struct decoding rejects canonical encoding: %v", name, err)
+				}
+			}
+			continue
+		}
+		if viewErr != nil {
+			t.Fatalf("%s: view decoding rejects decoded struct: %v", name, viewErr)
+		}
+		var buf bytes.Buffer
+		if err := obj.Serialize(spec, codec.NewEncodingWriter(&buf)); err != nil {
+			t.Fatalf("%s: failed to encode decoded object: %v", name, err)
+		}
+		if !bytes.Equal(buf.Bytes(), data) {
+			t.Fatalf("%s: encoding does not match the decoded data:\n%x\n%x", name, data, buf.Bytes())
+		}
+		if a, b := obj.HashTreeRoot(spec, tree.GetHashFn()), v.HashTreeRoot(tree.GetHashFn()); a != b {
+			t.Fatalf("%s: struct root %s does not match view root %s", name, a, b)
+		}
+	}
+}
+
+func FuzzSignedBeaconBlockDecode(f *testing.F) {
+	spec := configs.Minimal
+	types := map[string]sszType{
+		"phase0":    {func() common.SpecObj { return new(phase0.SignedBeaconBlock) }, phase0.SignedBeaconBlockType(spec)},
+		"altair":    {func() common.SpecObj { return new(altair.SignedBeaconBlock) }, altair.SignedBeaconBlockType(spec)},
+		"bellatrix": {func() common.SpecObj { return new(bellatrix.SignedBeaconBlock) }, bellatrix.SignedBeaconBlockType(spec)},
+		"capella":   {func() common.SpecObj { return new(capella.SignedBeaconBlock) }, capella.SignedBeaconBlockType(spec)},
+		"deneb":     {func() common.SpecObj { return new(deneb.SignedBeaconBlock) }, deneb.SignedBeaconBlockType(spec)},
+	}
+	// a phase0 and an altair block of the test chain
+	chain := newTestChain(f)
+	f.Add(chain.addBlock(1))
+	f.Add(chain.addBlock(9))
+	addVectorSeeds(f, "SignedBeaconBlock")
+	f.Fuzz(func(t *testing.T, data []byte) {
+		checkDecode(t, spec, data, types)
+	})
+}
+
+func FuzzAttestationDecode(f *testing.F) {
+	spec := configs.Minimal
+	types := map[string]sszType{
+		"phase0": {func() common.SpecObj { return new(phase0.Attestation) }, phase0.AttestationType(spec)},
+	}
+	f.Add(encodeSpecObj(f, spec, &phase0.Attestation{AggregationBits: phase0.AttestationBits{0x0f}}))
+	addVectorSeeds(f, "Attestation")
+	f.Fuzz(func(t *testing.T, data []byte) {
+		checkDecode(t, spec, data, types)
+	})
+}
+
+func FuzzExecutionPayloadDecode(f *testing.F) {
+	spec := configs.Minimal
+	types := map[string]sszType{
+		"bellatrix": {func() common.SpecObj { return new(bellatrix.ExecutionPayload) }, bellatrix.ExecutionPayloadType(spec)},
+		"capella":   {func() common.SpecObj { return new(capella.ExecutionPayload) }, capella.ExecutionPayloadType(spec)},
+		"deneb":     {func() common.SpecObj { return new(deneb.ExecutionPayload) }, deneb.ExecutionPayloadType(spec)},
+	}
+	for _, typ := range types {
+		f.Add(encodeSpecObj(f, spec, typ.alloc()))
+	}
+	addVectorSeeds(f, "ExecutionPayload")
+	f.Fuzz(func(t *testing.T, data []byte) {
+		checkDecode(t, spec, data, types)
+	})
+}
+
+// FuzzBlockTransition applies a block to a small phase0 pre-state, without verifying the proposer signature.
+// Blocks may fail, but only with a BlockError, and never with a panic.
+func FuzzBlockTransition(f *testing.F) {
+	chain := newTestChain(f)
+	pre := chain.encodeState()
+	spec := chain.spec
+	for _, slot := range []common.Slot{1, 2, 4} {
+		f.Add(chain.addBlock(slot))
+	}
+	f.Fuzz(func(t *testing.T, data []byte) {
+		_, report, err := ApplyBlocks(context.Background(), spec, pre, [][]byte{data}, Options{})
+		if err == nil {
+			return
+		}
+		var blockErr *BlockError
+		if !errors.As(err, &blockErr) {
+			t.Fatalf("expected a block error, got %T: %v", err, err)
+		}
+		if report.Failed != 0 || report.Err != blockErr {
+			t.Fatalf("unexpected report of failed block: %+v", report)
+		}
+	})
+}
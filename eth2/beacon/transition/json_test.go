@@ -0,0 +1,103 @@
+package transition
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/protolambda/ztyp/codec"
+	"github.com/protolambda/ztyp/tree"
+
+	"github.com/protolambda/zrnt/eth2/beacon/altair"
+	"github.com/protolambda/zrnt/eth2/beacon/common"
+	"github.com/protolambda/zrnt/eth2/beacon/deneb"
+	"github.com/protolambda/zrnt/eth2/beacon/phase0"
+)
+
+// checkAPIJSON fails on values that the beacon API encodes as strings: numbers, and null for empty lists.
+func checkAPIJSON(t *testing.T, path string, v interface{}) {
+	switch x := v.(type) {
+	case map[string]interface{}:
+		for k, e := range x {
+			checkAPIJSON(t, path+"."+k, e)
+		}
+	case []interface{}:
+		for i, e := range x {
+			checkAPIJSON(t, fmt.Sprintf("%s[%d]", path, i), e)
+		}
+	case string, bool:
+	default:
+		t.Fatalf("%s: unexpected JSON value %v", path, v)
+	}
+}
+
+// Fixtures in the format of the beacon API must decode, and encode to the same JSON.
+func TestJSONFixtures(t *testing.T) {
+	for name, obj := range map[string]interface{}{
+		"attestation":             new(phase0.Attestation),
+		"deneb_execution_payload": new(deneb.ExecutionPayload),
+	} {
+		data, err := os.ReadFile(filepath.Join("testdata", name+".json"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := json.Unmarshal(data, obj); err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		out, err := json.MarshalIndent(obj, "", "  ")
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		if string(out)+"\n" != string(data) {
+			t.Fatalf("%s: encoding does not match the fixture:\n%s", name, out)
+		}
+	}
+}
+
+func TestJSONRoundTrip(t *testing.T) {
+	chain := batchTestChain(t, 0)
+	spec := chain.Spec
+	hFn := tree.GetHashFn()
+	roundTrip := func(name string, obj common.SpecObj) {
+		data, err := json.Marshal(obj)
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		var generic interface{}
+		if err := json.Unmarshal(data, &generic); err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		checkAPIJSON(t, name, generic)
+		decoded := reflect.New(reflect.TypeOf(obj).Elem()).Interface().(common.SpecObj)
+		if err := json.Unmarshal(data, decoded); err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		if decoded.HashTreeRoot(spec, hFn) != obj.HashTreeRoot(spec, hFn) {
+			t.Fatalf("%s: decoded object differs", name)
+		}
+	}
+	for _, i := range []int{0, blockWithAttestations(t, chain, 0, 1), blockWithAttestations(t, chain, 1, 1)} {
+		b := chain.Blocks[i]
+		roundTrip(reflect.TypeOf(b.Signed).String(), b.Signed)
+	}
+
+	last := chain.Blocks[len(chain.Blocks)-1].PostState
+	var buf bytes.Buffer
+	if err := last.Serialize(codec.NewEncodingWriter(&buf)); err != nil {
+		t.Fatal(err)
+	}
+	var state altair.BeaconState
+	if err := state.Deserialize(spec, codec.NewDecodingReader(bytes.NewReader(buf.Bytes()), uint64(buf.Len()))); err != nil {
+		t.Fatal(err)
+	}
+	if len(state.HistoricalRoots) != 0 {
+		t.Fatal("expected empty historical roots")
+	}
+	roundTrip("state", &state)
+	// a phase0 block without operations
+	roundTrip("empty block", new(phase0.SignedBeaconBlock))
+}
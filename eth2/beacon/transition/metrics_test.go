@@ -0,0 +1,107 @@
+package transition
+
+import (
+	"bytes"
+	"context"
+	"testing"
+
+	"github.com/protolambda/ztyp/codec"
+
+	"github.com/protolambda/zrnt/eth2/beacon"
+	"github.com/protolambda/zrnt/eth2/beacon/common"
+	"github.com/protolambda/zrnt/eth2/beacon/testutil"
+	"github.com/protolambda/zrnt/eth2/configs"
+	"github.com/protolambda/zrnt/eth2/metrics"
+)
+
+func TestMetrics(t *testing.T) {
+	spec := *configs.Minimal
+	spec.ALTAIR_FORK_EPOCH = 1
+	chain, err := testutil.GenerateTestChain(&spec, 2, nil, testutil.ChainOptions{Participation: 100})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var pre bytes.Buffer
+	if err := chain.Genesis.Serialize(codec.NewEncodingWriter(&pre)); err != nil {
+		t.Fatal(err)
+	}
+	state, _, err := DecodeState(&spec, pre.Bytes())
+	if err != nil {
+		t.Fatal(err)
+	}
+	epc, err := common.NewEpochsContextWithCaches(&spec, state, common.NewShufflingCache(4), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	epc.IndexedAttestationCache = common.NewIndexedAttestationCache(128)
+	sink := metrics.NewMemorySink()
+	opts := common.FullVerification()
+	opts.Metrics = sink
+
+	// the blocks of the first epoch, and the first altair block, after the epoch transition
+	upgradeable := &beacon.StandardUpgradeableBeaconState{BeaconState: state}
+	var blocks [][]byte
+	for _, b := range chain.Blocks {
+		if b.Envelope.Slot > common.Slot(spec.SLOTS_PER_EPOCH) {
+			break
+		}
+		if err := common.StateTransitionWithOptions(context.Background(), &spec, epc, upgradeable, b.Envelope, opts); err != nil {
+			t.Fatal(err)
+		}
+		var buf bytes.Buffer
+		if err := b.Signed.Serialize(&spec, codec.NewEncodingWriter(&buf)); err != nil {
+			t.Fatal(err)
+		}
+		blocks = append(blocks, buf.Bytes())
+	}
+	n := len(blocks)
+
+	snap := sink.Snapshot()
+	if h := snap.Histograms[metrics.EpochTransitionSeconds]; len(h) != 1 {
+		t.Fatalf("expected 1 epoch transition, got %d", len(h))
+	}
+	if h := snap.Histograms[metrics.BlockTransitionSeconds]; len(h) != n {
+		t.Fatalf("expected %d block transitions, got %d", n, len(h))
+	}
+	stage := func(name string, stage string) int {
+		return len(snap.Histograms[metrics.Key(name, metrics.Label{Name: metrics.LabelStage, Value: stage})])
+	}
+	if stage(metrics.BlockStageSeconds, "header") != n || stage(metrics.BlockStageSeconds, "operations") != n ||
+		stage(metrics.BlockStageSeconds, "sync_aggregate") != 1 {
+		t.Fatalf("unexpected block stage metrics: %v", snap.Histograms)
+	}
+	if stage(metrics.EpochStageSeconds, "justification_and_finalization") != 1 ||
+		stage(metrics.EpochStageSeconds, "participation_record_updates") != 1 {
+		t.Fatalf("unexpected epoch stage metrics: %v", snap.Histograms)
+	}
+	signatures := func(kind string) float64 {
+		return snap.Counters[metrics.Key(metrics.SignatureVerifications, metrics.Label{Name: metrics.LabelKind, Value: kind})]
+	}
+	if signatures("block") != float64(n) || signatures("randao") != float64(n) ||
+		signatures("attestation") == 0 || signatures("sync_aggregate") != 1 {
+		t.Fatalf("unexpected signature counts: %v", snap.Counters)
+	}
+	cache := func(name string, cache string) (float64, bool) {
+		v, ok := snap.Gauges[metrics.Key(name, metrics.Label{Name: metrics.LabelCache, Value: cache})]
+		return v, ok
+	}
+	if _, ok := cache(metrics.CacheMisses, "shuffling"); !ok {
+		t.Fatalf("expected shuffling cache metrics: %v", snap.Gauges)
+	}
+	if misses, _ := cache(metrics.CacheMisses, "indexed_attestation"); misses == 0 {
+		t.Fatalf("expected indexed attestation cache misses: %v", snap.Gauges)
+	}
+	if _, ok := cache(metrics.CacheHits, "proposer"); ok {
+		t.Fatal("unexpected metrics of absent proposer cache")
+	}
+
+	// the same through the transition options
+	optsSink := metrics.NewMemorySink()
+	if _, _, err := ApplyBlocks(context.Background(), &spec, pre.Bytes(), blocks, Options{VerifySignatures: true, Metrics: optsSink}); err != nil {
+		t.Fatal(err)
+	}
+	optsSnap := optsSink.Snapshot()
+	if len(optsSnap.Histograms[metrics.BlockTransitionSeconds]) != n || len(optsSnap.Histograms[metrics.EpochTransitionSeconds]) != 1 {
+		t.Fatalf("unexpected transition metrics: %v", optsSnap.Histograms)
+	}
+}
@@ -0,0 +1,108 @@
+package transition
+
+import (
+	"testing"
+
+	"github.com/protolambda/ztyp/tree"
+
+	"github.com/protolambda/zrnt/eth2/beacon/altair"
+	"github.com/protolambda/zrnt/eth2/beacon/bellatrix"
+	"github.com/protolambda/zrnt/eth2/beacon/common"
+	"github.com/protolambda/zrnt/eth2/beacon/phase0"
+)
+
+// Flat states converted from and to views must keep the hash tree root of the view.
+func TestStateRawRoundTrip(t *testing.T) {
+	chain := batchTestChain(t, 0)
+	spec := chain.Spec
+	hFn := tree.GetHashFn()
+	var phase0State *phase0.BeaconStateView
+	var altairState *altair.BeaconStateView
+	for _, b := range chain.Blocks {
+		switch s := b.PostState.(type) {
+		case *phase0.BeaconStateView:
+			phase0State = s
+		case *altair.BeaconStateView:
+			altairState = s
+		}
+	}
+	if phase0State == nil || altairState == nil {
+		t.Fatal("expected phase0 and altair states")
+	}
+
+	raw0, err := phase0State.Raw(spec)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(raw0.Validators) != 64 || len(raw0.Balances) != 64 || len(raw0.CurrentEpochAttestations) == 0 ||
+		raw0.BlockRoots[1] == (common.Root{}) || raw0.LatestBlockHeader.Slot == 0 {
+		t.Fatal("expected a populated phase0 state")
+	}
+	if raw0.HashTreeRoot(spec, hFn) != phase0State.HashTreeRoot(hFn) {
+		t.Fatal("flat phase0 state has another root")
+	}
+	view0, err := raw0.View(spec)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if view0.HashTreeRoot(hFn) != phase0State.HashTreeRoot(hFn) {
+		t.Fatal("phase0 view of the flat state has another root")
+	}
+
+	rawAltair, err := altairState.Raw(spec)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rawAltair.PreviousEpochParticipation) != 64 || len(rawAltair.InactivityScores) != 64 {
+		t.Fatal("expected a populated altair state")
+	}
+	viewAltair, err := rawAltair.View(spec)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if viewAltair.HashTreeRoot(hFn) != altairState.HashTreeRoot(hFn) {
+		t.Fatal("altair view of the flat state has another root")
+	}
+
+	// a merge state, with a modified flat state
+	epc, err := common.NewEpochsContext(spec, altairState)
+	if err != nil {
+		t.Fatal(err)
+	}
+	copied, err := altairState.CopyState()
+	if err != nil {
+		t.Fatal(err)
+	}
+	mergeState, err := bellatrix.UpgradeToBellatrix(spec, epc, copied.(*altair.BeaconStateView))
+	if err != nil {
+		t.Fatal(err)
+	}
+	rawMerge, err := mergeState.Raw(spec)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rawMerge.LatestExecutionPayloadHeader.BlockHash = common.Hash32{1}
+	rawMerge.LatestExecutionPayloadHeader.BlockNumber = 123
+	rawMerge.Balances[3] += 1
+	viewMerge, err := rawMerge.View(spec)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if viewMerge.HashTreeRoot(hFn) != rawMerge.HashTreeRoot(spec, hFn) {
+		t.Fatal("merge view of the flat state has another root")
+	}
+	headerView, err := viewMerge.LatestExecutionPayloadHeader()
+	if err != nil {
+		t.Fatal(err)
+	}
+	header, err := headerView.Raw()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if header.BlockHash != (common.Hash32{1}) || header.BlockNumber != 123 {
+		t.Fatalf("unexpected execution payload header: %v", header)
+	}
+	if bal := balancesOf(t, viewMerge)[3]; bal != rawMerge.Balances[3] {
+		t.Fatalf("expected modified balance %d, got %d", rawMerge.Balances[3], bal)
+	}
+}
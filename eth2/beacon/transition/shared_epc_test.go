@@ -0,0 +1,98 @@
+package transition
+
+import (
+	"context"
+	"testing"
+
+	"github.com/protolambda/zrnt/eth2/beacon"
+	"github.com/protolambda/zrnt/eth2/beacon/common"
+	"github.com/protolambda/zrnt/eth2/beacon/phase0"
+	"github.com/protolambda/zrnt/eth2/beacon/testutil"
+	"github.com/protolambda/zrnt/eth2/configs"
+)
+
+// The epochs context is shared between the states of the same epoch:
+// processing a block of another branch must not change how the canonical chain is processed.
+func TestSharedContextAfterForkBlock(t *testing.T) {
+	defer func(prev bool) { phase0.CheckParticipationTallies = prev }(phase0.CheckParticipationTallies)
+	phase0.CheckParticipationTallies = true
+	ctx := context.Background()
+	spec := configs.Minimal
+	forkAt := common.Slot(11)
+	for seed := int64(1); seed <= 5; seed++ {
+		for _, participation := range []uint8{60, 70} {
+			opts := testutil.ChainOptions{Seed: seed, Participation: participation}
+			chain, err := testutil.GenerateTestChain(spec, 4, &forkAt, opts)
+			if err != nil {
+				t.Fatal(err)
+			}
+			state, err := chain.Genesis.CopyState()
+			if err != nil {
+				t.Fatal(err)
+			}
+			epc, err := common.NewEpochsContext(spec, state)
+			if err != nil {
+				t.Fatal(err)
+			}
+			up := &beacon.StandardUpgradeableBeaconState{BeaconState: state}
+			forked := false
+			for _, b := range chain.Blocks {
+				if !forked && b.Envelope.Slot >= forkAt {
+					other, err := up.CopyState()
+					if err != nil {
+						t.Fatal(err)
+					}
+					otherUp := &beacon.StandardUpgradeableBeaconState{BeaconState: other}
+					if err := common.StateTransition(ctx, spec, epc, otherUp, chain.Fork[0].Envelope, true); err != nil {
+						t.Fatalf("seed %d, participation %d: fork block: %v", seed, participation, err)
+					}
+					forked = true
+				}
+				if err := common.StateTransition(ctx, spec, epc, up, b.Envelope, true); err != nil {
+					t.Fatalf("seed %d, participation %d: block at slot %d: %v", seed, participation, b.Envelope.Slot, err)
+				}
+			}
+			if _, _, ok := up.ParticipationTallies().TargetStakes(epc.PreviousEpoch.Epoch, epc.CurrentEpoch.Epoch); !ok {
+				t.Fatalf("seed %d, participation %d: expected complete participation tallies", seed, participation)
+			}
+		}
+	}
+}
+
+// The participation tallies of the state are dropped at the altair upgrade, which translates the participation,
+// and complete again after two epochs. Later upgrades keep them.
+func TestParticipationTalliesAcrossForks(t *testing.T) {
+	defer func(prev bool) { phase0.CheckParticipationTallies = prev }(phase0.CheckParticipationTallies)
+	phase0.CheckParticipationTallies = true
+
+	ctx := context.Background()
+	spec := *configs.Minimal
+	spec.ALTAIR_FORK_EPOCH = 2
+	spec.BELLATRIX_FORK_EPOCH = 5
+	chain, err := testutil.GenerateTestChain(&spec, 7, nil, testutil.ChainOptions{Seed: 3, Participation: 80})
+	if err != nil {
+		t.Fatal(err)
+	}
+	state, err := chain.Genesis.CopyState()
+	if err != nil {
+		t.Fatal(err)
+	}
+	epc, err := common.NewEpochsContext(&spec, state)
+	if err != nil {
+		t.Fatal(err)
+	}
+	up := &beacon.StandardUpgradeableBeaconState{BeaconState: state}
+	for _, b := range chain.Blocks {
+		if err := common.StateTransition(ctx, &spec, epc, up, b.Envelope, true); err != nil {
+			t.Fatalf("block at slot %d: %v", b.Envelope.Slot, err)
+		}
+		epoch := spec.SlotToEpoch(b.Envelope.Slot)
+		_, _, ok := up.ParticipationTallies().TargetStakes(epc.PreviousEpoch.Epoch, epoch)
+		if complete := epoch < spec.ALTAIR_FORK_EPOCH || epoch >= spec.ALTAIR_FORK_EPOCH+2; ok != complete {
+			t.Fatalf("block at slot %d: expected complete tallies: %v, got %v", b.Envelope.Slot, complete, ok)
+		}
+	}
+	if fork, err := beacon.StateFork(up.BeaconState); err != nil || fork != common.Bellatrix {
+		t.Fatalf("expected a bellatrix state, got %s (%v)", fork, err)
+	}
+}
@@ -0,0 +1,129 @@
+package transition
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/protolambda/ztyp/tree"
+
+	"github.com/protolambda/zrnt/eth2/beacon"
+	"github.com/protolambda/zrnt/eth2/beacon/common"
+	"github.com/protolambda/zrnt/eth2/beacon/phase0"
+	"github.com/protolambda/zrnt/eth2/beacon/testutil"
+)
+
+func (c *testChain) proposerSlashing(proposer common.ValidatorIndex, slot common.Slot) phase0.ProposerSlashing {
+	h1 := common.BeaconBlockHeader{Slot: slot, ProposerIndex: proposer, BodyRoot: common.Root{1}}
+	h2 := h1
+	h2.BodyRoot = common.Root{2}
+	epoch := c.spec.SlotToEpoch(slot)
+	return phase0.ProposerSlashing{
+		SignedHeader1: common.SignedBeaconBlockHeader{Message: h1,
+			Signature: c.sign(proposer, common.DOMAIN_BEACON_PROPOSER, epoch, h1.HashTreeRoot(tree.GetHashFn()))},
+		SignedHeader2: common.SignedBeaconBlockHeader{Message: h2,
+			Signature: c.sign(proposer, common.DOMAIN_BEACON_PROPOSER, epoch, h2.HashTreeRoot(tree.GetHashFn()))},
+	}
+}
+
+// attesterSlashing is a double vote of the validators in epoch 0, the indices must be sorted.
+func (c *testChain) attesterSlashing(indices ...common.ValidatorIndex) phase0.AttesterSlashing {
+	dom, err := common.GetDomain(c.state, common.DOMAIN_BEACON_ATTESTER, 0)
+	if err != nil {
+		c.t.Fatal(err)
+	}
+	indexed := func(blockRoot common.Root) phase0.IndexedAttestation {
+		data := phase0.AttestationData{BeaconBlockRoot: blockRoot}
+		return phase0.IndexedAttestation{
+			AttestingIndices: indices,
+			Data:             data,
+			Signature:        testutil.Sign(data.HashTreeRoot(tree.GetHashFn()), dom, indices...),
+		}
+	}
+	return phase0.AttesterSlashing{Attestation1: indexed(common.Root{1}), Attestation2: indexed(common.Root{2})}
+}
+
+// processSlashings processes a block with the slashings on a copy of the head, at the slot after the head.
+func (c *testChain) processSlashings(ps []phase0.ProposerSlashing, as []phase0.AttesterSlashing) error {
+	t, spec := c.t, c.spec
+	copied, err := c.state.CopyState()
+	if err != nil {
+		t.Fatal(err)
+	}
+	state := &beacon.StandardUpgradeableBeaconState{BeaconState: copied}
+	epc := c.epc.Clone()
+	slot, err := state.Slot()
+	if err != nil {
+		t.Fatal(err)
+	}
+	slot++
+	if err := common.ProcessSlots(context.Background(), spec, epc, state, slot); err != nil {
+		t.Fatal(err)
+	}
+	proposer, err := epc.GetBeaconProposer(slot)
+	if err != nil {
+		t.Fatal(err)
+	}
+	header, err := state.LatestBlockHeader()
+	if err != nil {
+		t.Fatal(err)
+	}
+	eth1Data, err := state.Eth1Data()
+	if err != nil {
+		t.Fatal(err)
+	}
+	epoch := spec.SlotToEpoch(slot)
+	block := &phase0.SignedBeaconBlock{Message: phase0.BeaconBlock{
+		Slot: slot, ProposerIndex: proposer, ParentRoot: header.HashTreeRoot(tree.GetHashFn()),
+		Body: phase0.BeaconBlockBody{
+			RandaoReveal:      c.sign(proposer, common.DOMAIN_RANDAO, epoch, epoch.HashTreeRoot(tree.GetHashFn())),
+			Eth1Data:          eth1Data,
+			ProposerSlashings: ps,
+			AttesterSlashings: as,
+		},
+	}}
+	digest := common.ComputeForkDigest(spec.ForkVersion(slot), c.mustGenesisValRoot())
+	return state.ProcessBlock(context.Background(), spec, epc, nil, block.Envelope(spec, digest))
+}
+
+func TestDuplicateSlashings(t *testing.T) {
+	chain := newTestChain(t)
+	chain.addBlock(1)
+	expectDuplicate := func(name string, err error, kind common.OpKind, index int, earlier int) {
+		var dupErr *phase0.DuplicateSlashingError
+		if !errors.As(err, &dupErr) {
+			t.Fatalf("%s: expected duplicate slashing error, got %v", name, err)
+		}
+		if dupErr.Kind != kind || dupErr.Index != index || dupErr.Earlier != earlier {
+			t.Fatalf("%s: unexpected duplicate: %v", name, dupErr)
+		}
+	}
+
+	ps := []phase0.ProposerSlashing{chain.proposerSlashing(10, 1), chain.proposerSlashing(11, 1)}
+	if err := chain.processSlashings(ps, nil); err != nil {
+		t.Fatal(err)
+	}
+	// the same proposer, also with other headers
+	ps = append(ps, chain.proposerSlashing(10, 2))
+	expectDuplicate("proposer", chain.processSlashings(ps, nil), common.OpProposerSlashing, 2, 0)
+	ps = []phase0.ProposerSlashing{ps[0], ps[0]}
+	expectDuplicate("same proposer slashing", chain.processSlashings(ps, nil), common.OpProposerSlashing, 1, 0)
+
+	// overlapping attester slashings are valid if each slashes a new validator
+	as := []phase0.AttesterSlashing{chain.attesterSlashing(20, 21), chain.attesterSlashing(21, 22)}
+	if err := chain.processSlashings(nil, as); err != nil {
+		t.Fatal(err)
+	}
+	// a subset of the validators of an earlier slashing
+	as = []phase0.AttesterSlashing{as[0], chain.attesterSlashing(21)}
+	expectDuplicate("attesters", chain.processSlashings(nil, as), common.OpAttesterSlashing, 1, 0)
+	as = []phase0.AttesterSlashing{as[0], as[0]}
+	expectDuplicate("same attester slashing", chain.processSlashings(nil, as), common.OpAttesterSlashing, 1, 0)
+
+	// a proposer slashing does not make an attester slashing of the same validator a duplicate
+	ps = []phase0.ProposerSlashing{chain.proposerSlashing(20, 1)}
+	as = []phase0.AttesterSlashing{chain.attesterSlashing(20, 21)}
+	if err := chain.processSlashings(ps, as); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,72 @@
+package transition
+
+import (
+	"encoding/json"
+	"io"
+
+	"github.com/protolambda/zrnt/eth2/beacon/common"
+)
+
+// TraceEvent is a line of the JSON trace.
+type TraceEvent struct {
+	Event string `json:"event"`
+	// Operation kind, or stage name
+	Name  string `json:"name"`
+	Index *int   `json:"index,omitempty"`
+	Err   string `json:"error,omitempty"`
+	// State root after the step, only if state roots are traced
+	StateRoot *common.Root `json:"state_root,omitempty"`
+}
+
+// The events of the JSON trace.
+const (
+	TraceBeforeOp   = "before_op"
+	TraceAfterOp    = "after_op"
+	TraceBlockStage = "block_stage"
+	TraceEpochStage = "epoch_stage"
+)
+
+// JSONTracer writes every step of the transition as a JSON object, one per line,
+// to diff the traces of two runs with standard line-based tools.
+type JSONTracer struct {
+	enc *json.Encoder
+	err error
+}
+
+var _ common.Tracer = (*JSONTracer)(nil)
+
+func NewJSONTracer(w io.Writer) *JSONTracer {
+	return &JSONTracer{enc: json.NewEncoder(w)}
+}
+
+// Err returns the first error of writing the trace, if any. Writing stops after an error.
+func (t *JSONTracer) Err() error {
+	return t.err
+}
+
+func (t *JSONTracer) write(ev *TraceEvent) {
+	if t.err != nil {
+		return
+	}
+	t.err = t.enc.Encode(ev)
+}
+
+func (t *JSONTracer) BeforeOp(kind common.OpKind, index int, stateRoot *common.Root) {
+	t.write(&TraceEvent{Event: TraceBeforeOp, Name: string(kind), Index: &index, StateRoot: stateRoot})
+}
+
+func (t *JSONTracer) AfterOp(kind common.OpKind, index int, err error, stateRoot *common.Root) {
+	ev := &TraceEvent{Event: TraceAfterOp, Name: string(kind), Index: &index, StateRoot: stateRoot}
+	if err != nil {
+		ev.Err = err.Error()
+	}
+	t.write(ev)
+}
+
+func (t *JSONTracer) AfterBlockStage(stage common.BlockStage, stateRoot *common.Root) {
+	t.write(&TraceEvent{Event: TraceBlockStage, Name: string(stage), StateRoot: stateRoot})
+}
+
+func (t *JSONTracer) AfterEpochStage(stage common.EpochStage, stateRoot *common.Root) {
+	t.write(&TraceEvent{Event: TraceEpochStage, Name: string(stage), StateRoot: stateRoot})
+}
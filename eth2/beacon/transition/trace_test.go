@@ -0,0 +1,159 @@
+package transition
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/protolambda/ztyp/codec"
+
+	"github.com/protolambda/zrnt/eth2/beacon/altair"
+	"github.com/protolambda/zrnt/eth2/beacon/common"
+	"github.com/protolambda/zrnt/eth2/beacon/phase0"
+	"github.com/protolambda/zrnt/eth2/beacon/testutil"
+	"github.com/protolambda/zrnt/eth2/configs"
+)
+
+type recordingTracer struct {
+	events []string
+	roots  []*common.Root
+}
+
+func (r *recordingTracer) BeforeOp(kind common.OpKind, index int, stateRoot *common.Root) {
+	r.events = append(r.events, fmt.Sprintf("before %s %d", kind, index))
+	r.roots = append(r.roots, stateRoot)
+}
+
+func (r *recordingTracer) AfterOp(kind common.OpKind, index int, err error, stateRoot *common.Root) {
+	r.events = append(r.events, fmt.Sprintf("after %s %d", kind, index))
+	r.roots = append(r.roots, stateRoot)
+}
+
+func (r *recordingTracer) AfterBlockStage(stage common.BlockStage, stateRoot *common.Root) {
+	r.events = append(r.events, string(stage))
+	r.roots = append(r.roots, stateRoot)
+}
+
+func (r *recordingTracer) AfterEpochStage(stage common.EpochStage, stateRoot *common.Root) {
+	r.events = append(r.events, string(stage))
+	r.roots = append(r.roots, stateRoot)
+}
+
+func TestTracer(t *testing.T) {
+	spec := *configs.Minimal
+	spec.ALTAIR_FORK_EPOCH = 1
+	chain, err := testutil.GenerateTestChain(&spec, 2, nil, testutil.ChainOptions{Participation: 100})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var pre bytes.Buffer
+	if err := chain.Genesis.Serialize(codec.NewEncodingWriter(&pre)); err != nil {
+		t.Fatal(err)
+	}
+	// the blocks of the first epoch, and the first altair block, after the epoch transition
+	var blocks [][]byte
+	var expected []string
+	for _, b := range chain.Blocks {
+		if b.Envelope.Slot > common.Slot(spec.SLOTS_PER_EPOCH) {
+			break
+		}
+		altairBlock := b.Envelope.Slot == common.Slot(spec.SLOTS_PER_EPOCH)
+		var buf bytes.Buffer
+		if err := b.Signed.Serialize(&spec, codec.NewEncodingWriter(&buf)); err != nil {
+			t.Fatal(err)
+		}
+		blocks = append(blocks, buf.Bytes())
+		if altairBlock {
+			expected = append(expected, "justification_and_finalization", "rewards_and_penalties", "registry_updates",
+				"slashings", "eth1_data_reset", "effective_balance_updates", "slashings_reset", "randao_mixes_reset",
+				"historical_roots_update", "participation_record_updates")
+		}
+		expected = append(expected, "header", "randao", "eth1_data")
+		var atts phase0.Attestations
+		switch body := b.Envelope.Body.(type) {
+		case *phase0.BeaconBlockBody:
+			atts = body.Attestations
+		case *altair.BeaconBlockBody:
+			atts = body.Attestations
+		}
+		for i := range atts {
+			expected = append(expected, fmt.Sprintf("before attestation %d", i), fmt.Sprintf("after attestation %d", i))
+		}
+		expected = append(expected, "operations")
+		if altairBlock {
+			expected = append(expected, "sync_aggregate")
+		}
+	}
+	if len(blocks) != int(spec.SLOTS_PER_EPOCH) {
+		t.Fatalf("expected a block in every slot, got %d blocks", len(blocks))
+	}
+
+	tracer := &recordingTracer{}
+	opts := Options{VerifySignatures: true, VerifyStateRoots: true, Tracer: tracer, TraceStateRoots: true}
+	_, report, err := ApplyBlocks(context.Background(), &spec, pre.Bytes(), blocks, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(fmt.Sprint(expected), "before attestation 0 after attestation 0") {
+		t.Fatal("expected attestations in the blocks")
+	}
+	if fmt.Sprint(tracer.events) != fmt.Sprint(expected) {
+		t.Fatalf("unexpected trace:\n%v\nexpected:\n%v", tracer.events, expected)
+	}
+	if last := tracer.roots[len(tracer.roots)-1]; last == nil || *last != report.PostStateRoot {
+		t.Fatal("expected the state root of the last step to be the post-state root")
+	}
+
+	// without state roots, and the same steps in the JSON trace
+	var out bytes.Buffer
+	jsonTracer := NewJSONTracer(&out)
+	if _, _, err := ApplyBlocks(context.Background(), &spec, pre.Bytes(), blocks, Options{Tracer: jsonTracer}); err != nil {
+		t.Fatal(err)
+	}
+	if jsonTracer.Err() != nil {
+		t.Fatal(jsonTracer.Err())
+	}
+	scanner := bufio.NewScanner(&out)
+	i := 0
+	for ; scanner.Scan(); i++ {
+		var ev TraceEvent
+		if err := json.Unmarshal(scanner.Bytes(), &ev); err != nil {
+			t.Fatal(err)
+		}
+		if ev.StateRoot != nil {
+			t.Fatal("unexpected state root")
+		}
+		name := ev.Name
+		if ev.Index != nil {
+			name = fmt.Sprintf("%s %s %d", map[string]string{TraceBeforeOp: "before", TraceAfterOp: "after"}[ev.Event], ev.Name, *ev.Index)
+		}
+		if i >= len(expected) || name != expected[i] {
+			t.Fatalf("unexpected JSON trace event %d: %s", i, scanner.Text())
+		}
+	}
+	if i != len(expected) {
+		t.Fatalf("expected %d JSON trace events, got %d", len(expected), i)
+	}
+}
+
+func TestNoTracerNoMetricsAllocs(t *testing.T) {
+	epc := &common.EpochsContext{}
+	for _, tr := range []*common.Transition{nil, {TraceStateRoots: true}} {
+		allocs := testing.AllocsPerRun(100, func() {
+			tr.TraceBeforeOp(nil, common.OpAttestation, 0)
+			tr.TraceAfterOp(nil, common.OpAttestation, 0, nil)
+			tr.TraceBlockStage(nil, common.BlockStageOperations)
+			tr.TraceEpochStage(nil, common.EpochStageSlashings)
+			tr.StartStages()
+			tr.CountSignatures("block", 1)
+			epc.ReportCacheMetrics(nil)
+		})
+		if allocs != 0 {
+			t.Fatalf("expected no allocations without tracer and metrics, got %f", allocs)
+		}
+	}
+}
@@ -0,0 +1,85 @@
+package transition
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/protolambda/zrnt/eth2/beacon"
+	"github.com/protolambda/zrnt/eth2/beacon/common"
+)
+
+// Options of the replay of a block that was already validated.
+var trustedOpts = common.TransitionOptions{VerifyStateRoot: true}
+
+func TestTrustedTransition(t *testing.T) {
+	ctx := context.Background()
+	chain := batchTestChain(t, 0)
+	for _, epoch := range []common.Epoch{0, 1} {
+		i := blockWithAttestations(t, chain, epoch, 2)
+		benv := chain.Blocks[i].Envelope
+		atts, _ := beacon.EnvelopeAttestations(benv)
+		orig := atts[1].Signature
+		atts[1].Signature = atts[0].Signature
+
+		// the signature is not part of the state: the state root of the block is still valid
+		state, epc := preState(t, chain, i)
+		if err := common.StateTransitionWithOptions(ctx, chain.Spec, epc, state, benv, trustedOpts); err != nil {
+			t.Fatalf("epoch %d: expected trusted transition to skip the attestation signature, got %v", epoch, err)
+		}
+		state, epc = preState(t, chain, i)
+		opts := common.FullVerification()
+		opts.VerifyProposer = false
+		err := common.StateTransitionWithOptions(ctx, chain.Spec, epc, state, benv, opts)
+		if err == nil || !strings.Contains(err.Error(), "attestation 1 is invalid") {
+			t.Fatalf("epoch %d: expected invalid attestation, got %v", epoch, err)
+		}
+
+		// other rules of the block are still enforced
+		bad := *benv
+		bad.StateRoot = common.Root{1}
+		state, epc = preState(t, chain, i)
+		if err := common.StateTransitionWithOptions(ctx, chain.Spec, epc, state, &bad, trustedOpts); err == nil {
+			t.Fatalf("epoch %d: expected invalid state root", epoch)
+		}
+		atts[1].Signature = orig
+	}
+
+	// the proposer signature can be verified without the signatures of the operations
+	benv := *chain.Blocks[2].Envelope
+	benv.Signature = chain.Blocks[3].Envelope.Signature
+	state, epc := preState(t, chain, 2)
+	if err := common.StateTransitionWithOptions(ctx, chain.Spec, epc, state, &benv, trustedOpts); err != nil {
+		t.Fatal(err)
+	}
+	opts := trustedOpts
+	opts.VerifyProposer = true
+	state, epc = preState(t, chain, 2)
+	if err := common.StateTransitionWithOptions(ctx, chain.Spec, epc, state, &benv, opts); err == nil {
+		t.Fatal("expected invalid block signature")
+	}
+}
+
+// Replay of all blocks of a chain, with and without the signatures.
+func BenchmarkReplay(b *testing.B) {
+	ctx := context.Background()
+	chain := batchTestChain(b, 256)
+	run := func(b *testing.B, opts common.TransitionOptions) {
+		for n := 0; n < b.N; n++ {
+			b.StopTimer()
+			state, epc := preState(b, chain, 0)
+			b.StartTimer()
+			for _, block := range chain.Blocks {
+				if err := common.StateTransitionWithOptions(ctx, chain.Spec, epc, state, block.Envelope, opts); err != nil {
+					b.Fatal(err)
+				}
+			}
+		}
+	}
+	b.Run("full", func(b *testing.B) {
+		run(b, common.FullVerification())
+	})
+	b.Run("trusted", func(b *testing.B) {
+		run(b, trustedOpts)
+	})
+}
@@ -0,0 +1,171 @@
+// Package clock maps wall-clock time to slots and epochs, and ticks at slot and epoch starts.
+package clock
+
+import (
+	"context"
+	"time"
+
+	"github.com/protolambda/zrnt/eth2/beacon/common"
+)
+
+// TimeSource abstracts the system clock, see ManualTime to control time in tests.
+type TimeSource interface {
+	Now() time.Time
+	// After sends the time on the returned channel after the duration elapsed, like time.After.
+	After(d time.Duration) <-chan time.Time
+}
+
+type systemTime struct{}
+
+func (systemTime) Now() time.Time {
+	return time.Now()
+}
+
+func (systemTime) After(d time.Duration) <-chan time.Time {
+	return time.After(d)
+}
+
+// SystemTime is the time source of the system clock.
+var SystemTime TimeSource = systemTime{}
+
+type Clock struct {
+	spec    *common.Spec
+	genesis time.Time
+	src     TimeSource
+}
+
+// NewClock creates a clock of the chain with the given genesis time, using the system clock.
+func NewClock(spec *common.Spec, genesisTime common.Timestamp) *Clock {
+	return NewClockWithSource(spec, genesisTime, SystemTime)
+}
+
+func NewClockWithSource(spec *common.Spec, genesisTime common.Timestamp, src TimeSource) *Clock {
+	return &Clock{spec: spec, genesis: time.Unix(int64(genesisTime), 0), src: src}
+}
+
+func (c *Clock) slotDuration() time.Duration {
+	return time.Duration(c.spec.SECONDS_PER_SLOT) * time.Second
+}
+
+// slotAt returns the slot at the time, clipped to slot 0 before genesis.
+func (c *Clock) slotAt(t time.Time) common.Slot {
+	if t.Before(c.genesis) {
+		return 0
+	}
+	return common.Slot(t.Sub(c.genesis) / c.slotDuration())
+}
+
+// Now returns the current slot, slot 0 before genesis.
+func (c *Clock) Now() common.Slot {
+	return c.slotAt(c.src.Now())
+}
+
+// EpochNow returns the current epoch, epoch 0 before genesis.
+func (c *Clock) EpochNow() common.Epoch {
+	return c.spec.SlotToEpoch(c.Now())
+}
+
+// SlotAfter returns the slot after the given duration elapsed. The duration may be negative. It clips on genesis.
+func (c *Clock) SlotAfter(delta time.Duration) common.Slot {
+	return c.slotAt(c.src.Now().Add(delta))
+}
+
+// UntilGenesis returns the time left until genesis, 0 after genesis.
+func (c *Clock) UntilGenesis() time.Duration {
+	if d := c.genesis.Sub(c.src.Now()); d > 0 {
+		return d
+	}
+	return 0
+}
+
+func (c *Clock) SlotStart(slot common.Slot) time.Time {
+	return c.genesis.Add(time.Duration(slot) * c.slotDuration())
+}
+
+func (c *Clock) EpochStart(epoch common.Epoch) time.Time {
+	return c.SlotStart(common.Slot(epoch) * c.spec.SLOTS_PER_EPOCH)
+}
+
+// AttestationDeadline is 1/3 into the slot: attesters attest to the head by then, if no block arrived earlier.
+func (c *Clock) AttestationDeadline(slot common.Slot) time.Time {
+	return c.SlotStart(slot).Add(c.slotDuration() / 3)
+}
+
+// AggregationDeadline is 2/3 into the slot: aggregators broadcast their aggregates by then.
+func (c *Clock) AggregationDeadline(slot common.Slot) time.Time {
+	return c.SlotStart(slot).Add(c.slotDuration() * 2 / 3)
+}
+
+// TickSlots sends every slot on the returned channel at the start of the slot, until the context is done.
+// The first tick is the next slot start, or slot 0 at genesis if started before genesis.
+// If the clock jumps ahead, or the receiver falls behind, the skipped slots are not sent.
+// Every slot is sent at most once, also if the clock is adjusted backwards.
+func (c *Clock) TickSlots(ctx context.Context) <-chan common.Slot {
+	out := make(chan common.Slot)
+	go func() {
+		defer close(out)
+		c.tick(ctx, func(n uint64) time.Time {
+			return c.SlotStart(common.Slot(n))
+		}, func(t time.Time) uint64 {
+			return uint64(c.slotAt(t))
+		}, func(n uint64) bool {
+			select {
+			case out <- common.Slot(n):
+				return true
+			case <-ctx.Done():
+				return false
+			}
+		})
+	}()
+	return out
+}
+
+// TickEpochs sends every epoch on the returned channel at the start of the epoch, until the context is done.
+// It behaves like TickSlots, with epochs instead of slots.
+func (c *Clock) TickEpochs(ctx context.Context) <-chan common.Epoch {
+	out := make(chan common.Epoch)
+	go func() {
+		defer close(out)
+		c.tick(ctx, func(n uint64) time.Time {
+			return c.EpochStart(common.Epoch(n))
+		}, func(t time.Time) uint64 {
+			return uint64(c.spec.SlotToEpoch(c.slotAt(t)))
+		}, func(n uint64) bool {
+			select {
+			case out <- common.Epoch(n):
+				return true
+			case <-ctx.Done():
+				return false
+			}
+		})
+	}()
+	return out
+}
+
+// tick calls send at the start of every period, with the period number, until the context is done or send fails.
+func (c *Clock) tick(ctx context.Context, start func(n uint64) time.Time, at func(t time.Time) uint64, send func(n uint64) bool) {
+	var next uint64
+	if now := c.src.Now(); !now.Before(c.genesis) {
+		next = at(now) + 1
+	}
+	for {
+		now := c.src.Now()
+		if wait := start(next).Sub(now); wait > 0 {
+			// wake up at the start, and check the time again, in case the clock was adjusted while waiting.
+			select {
+			case <-c.src.After(wait):
+				continue
+			case <-ctx.Done():
+				return
+			}
+		}
+		// skip over any periods that were missed
+		if current := at(now); current > next {
+			next = current
+		}
+		if !send(next) {
+			return
+		}
+		next++
+	}
+}
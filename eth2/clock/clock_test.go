@@ -0,0 +1,134 @@
+package clock
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/protolambda/zrnt/eth2/beacon/common"
+	"github.com/protolambda/zrnt/eth2/configs"
+	"github.com/protolambda/zrnt/eth2/gossipval"
+)
+
+var _ gossipval.SlotAfter = (*Clock)(nil)
+
+const testGenesis = common.Timestamp(1600000000)
+
+func testClock(offset time.Duration) (*Clock, *ManualTime) {
+	src := NewManualTime(time.Unix(int64(testGenesis), 0).Add(offset))
+	return NewClockWithSource(configs.Minimal, testGenesis, src), src
+}
+
+// waitTicker waits for the ticker to wait for the time to change.
+func waitTicker(t *testing.T, src *ManualTime) {
+	deadline := time.Now().Add(5 * time.Second)
+	for src.Waiters() == 0 {
+		if time.Now().After(deadline) {
+			t.Fatal("ticker is not waiting")
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func expectSlot(t *testing.T, ch <-chan common.Slot, expected common.Slot) {
+	select {
+	case slot := <-ch:
+		if slot != expected {
+			t.Fatalf("expected slot %d, got %d", expected, slot)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("expected slot %d, got no tick", expected)
+	}
+}
+
+func TestClockSlots(t *testing.T) {
+	// minimal: 6 seconds per slot, 8 slots per epoch
+	c, src := testClock(-10 * time.Second)
+	if c.Now() != 0 || c.EpochNow() != 0 {
+		t.Fatal("expected slot 0 before genesis")
+	}
+	if d := c.UntilGenesis(); d != 10*time.Second {
+		t.Fatalf("unexpected time until genesis: %s", d)
+	}
+	if s := c.SlotAfter(22 * time.Second); s != 2 {
+		t.Fatalf("unexpected slot after delay: %d", s)
+	}
+	src.Advance(10*time.Second + 6*9*time.Second + time.Second)
+	if c.Now() != 9 || c.EpochNow() != 1 || c.UntilGenesis() != 0 {
+		t.Fatalf("unexpected slot %d and epoch %d", c.Now(), c.EpochNow())
+	}
+	if s := c.SlotAfter(-time.Hour); s != 0 {
+		t.Fatalf("expected slot after negative delay to clip on genesis, got %d", s)
+	}
+	genesis := time.Unix(int64(testGenesis), 0)
+	if !c.SlotStart(9).Equal(genesis.Add(54*time.Second)) || !c.EpochStart(1).Equal(genesis.Add(48*time.Second)) {
+		t.Fatal("unexpected slot or epoch start")
+	}
+	if !c.AttestationDeadline(1).Equal(genesis.Add(8*time.Second)) || !c.AggregationDeadline(1).Equal(genesis.Add(10*time.Second)) {
+		t.Fatal("unexpected duty deadlines")
+	}
+}
+
+func TestTickSlotsBeforeGenesis(t *testing.T) {
+	c, src := testClock(-time.Minute)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	ticks := c.TickSlots(ctx)
+	waitTicker(t, src)
+	src.Advance(time.Minute)
+	expectSlot(t, ticks, 0)
+	waitTicker(t, src)
+	src.Advance(6 * time.Second)
+	expectSlot(t, ticks, 1)
+}
+
+func TestTickSlotsClockAdjustments(t *testing.T) {
+	c, src := testClock(3 * time.Second)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	ticks := c.TickSlots(ctx)
+	// the first tick is the next slot
+	waitTicker(t, src)
+	src.Advance(3 * time.Second)
+	expectSlot(t, ticks, 1)
+
+	// a small adjustment backwards does not fire slot 1 again
+	waitTicker(t, src)
+	src.Advance(-time.Second)
+	waitTicker(t, src)
+	src.Advance(time.Second)
+	waitTicker(t, src)
+	select {
+	case slot := <-ticks:
+		t.Fatalf("unexpected tick of slot %d", slot)
+	default:
+	}
+	src.Advance(6 * time.Second)
+	expectSlot(t, ticks, 2)
+
+	// a jump ahead skips to the current slot
+	waitTicker(t, src)
+	src.Advance(6*5*time.Second + time.Second)
+	expectSlot(t, ticks, 7)
+
+	cancel()
+	for range ticks {
+	}
+}
+
+func TestTickEpochs(t *testing.T) {
+	c, src := testClock(time.Second)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	ticks := c.TickEpochs(ctx)
+	waitTicker(t, src)
+	src.Advance(6*8*time.Second - time.Second)
+	select {
+	case epoch := <-ticks:
+		if epoch != 1 {
+			t.Fatalf("expected epoch 1, got %d", epoch)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("expected epoch tick")
+	}
+}
@@ -0,0 +1,71 @@
+package clock
+
+import (
+	"sync"
+	"time"
+)
+
+// ManualTime is a time source that only moves when it is set, for tests.
+type ManualTime struct {
+	mu      sync.Mutex
+	now     time.Time
+	waiters []manualWaiter
+}
+
+type manualWaiter struct {
+	at time.Time
+	ch chan time.Time
+}
+
+var _ TimeSource = (*ManualTime)(nil)
+
+func NewManualTime(now time.Time) *ManualTime {
+	return &ManualTime{now: now}
+}
+
+func (m *ManualTime) Now() time.Time {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.now
+}
+
+// After returns a channel that receives the time once the time is set to or past the current time plus the duration.
+func (m *ManualTime) After(d time.Duration) <-chan time.Time {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	ch := make(chan time.Time, 1)
+	at := m.now.Add(d)
+	if !at.After(m.now) {
+		ch <- m.now
+		return ch
+	}
+	m.waiters = append(m.waiters, manualWaiter{at: at, ch: ch})
+	return ch
+}
+
+// Set changes the time, and wakes up the waiters that are due. The time may be set backwards.
+func (m *ManualTime) Set(t time.Time) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.now = t
+	remaining := m.waiters[:0]
+	for _, w := range m.waiters {
+		if w.at.After(t) {
+			remaining = append(remaining, w)
+		} else {
+			w.ch <- t
+		}
+	}
+	m.waiters = remaining
+}
+
+func (m *ManualTime) Advance(d time.Duration) {
+	m.Set(m.Now().Add(d))
+}
+
+// Waiters returns the number of pending After calls, to synchronize tests with waiting tickers.
+func (m *ManualTime) Waiters() int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return len(m.waiters)
+}
@@ -0,0 +1,86 @@
+package configs
+
+import (
+	"encoding/json"
+	"os"
+	"testing"
+
+	"github.com/protolambda/zrnt/eth2/beacon/common"
+)
+
+func TestSpecAPIRoundTrip(t *testing.T) {
+	for _, base := range []*common.Spec{Mainnet, Minimal} {
+		values, err := base.MarshalAPI()
+		if err != nil {
+			t.Fatal(err)
+		}
+		spec, err := common.SpecFromAPI(values)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if spec.Preset != base.Preset || spec.Config != base.Config {
+			t.Fatalf("%s: decoded spec does not match", base.PresetName)
+		}
+	}
+	values, err := Mainnet.MarshalAPI()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for k, expected := range map[string]string{
+		"SLOTS_PER_EPOCH":                "32",
+		"SHUFFLE_ROUND_COUNT":            "90",
+		"DENEB_FORK_EPOCH":               "18446744073709551615",
+		"TERMINAL_TOTAL_DIFFICULTY":      "58750000000000000000000",
+		"CAPELLA_FORK_VERSION":           "0x03000000",
+		"DEPOSIT_CONTRACT_ADDRESS":       "0x00000000219ab540356cbb839cbe05303d7705fa",
+		"DOMAIN_BLS_TO_EXECUTION_CHANGE": "0x0a000000",
+		"ETH1_ADDRESS_WITHDRAWAL_PREFIX": "0x01",
+	} {
+		if values[k] != expected {
+			t.Errorf("expected %s to be %q, got %q", k, expected, values[k])
+		}
+	}
+}
+
+// The mainnet response of a beacon node, with the keys of a newer client than this spec supports.
+func TestSpecAPIClientResponse(t *testing.T) {
+	data, err := os.ReadFile("testdata/mainnet_spec_api.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var resp struct {
+		Data map[string]string `json:"data"`
+	}
+	if err := json.Unmarshal(data, &resp); err != nil {
+		t.Fatal(err)
+	}
+	values, err := Mainnet.MarshalAPI()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for k := range values {
+		if _, ok := resp.Data[k]; !ok {
+			t.Errorf("key %s is not in the client response", k)
+		}
+	}
+	spec, err := common.SpecFromAPI(resp.Data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if spec.PresetName != "mainnet" || spec.SLOTS_PER_EPOCH != 32 || spec.DENEB_FORK_EPOCH != 269568 {
+		t.Fatal("expected mainnet spec with the deneb fork scheduled")
+	}
+	if err := spec.Validate(); err != nil {
+		t.Fatal(err)
+	}
+
+	delete(resp.Data, "MAX_EFFECTIVE_BALANCE")
+	if _, err := common.SpecFromAPI(resp.Data); err == nil {
+		t.Fatal("expected error for missing spec value")
+	}
+	resp.Data["MAX_EFFECTIVE_BALANCE"] = "32000000000"
+	resp.Data["DOMAIN_RANDAO"] = "0x0f000000"
+	if _, err := common.SpecFromAPI(resp.Data); err == nil {
+		t.Fatal("expected error for different constant")
+	}
+}
@@ -158,6 +158,24 @@ func (c *SpecOptions) Spec() (*common.Spec, error) {
 			return nil, fmt.Errorf("failed to decode deneb preset: %v", err)
 		}
 	}
+
+	// name the preset if all forks use the same known preset, so the config can be checked against it
+	spec.PresetName = ""
+	if _, ok := PresetBases[c.Phase0Preset]; ok {
+		named := true
+		for _, p := range []string{c.AltairPreset, c.BellatrixPreset, c.CapellaPreset, c.DenebPreset} {
+			named = named && p == c.Phase0Preset
+		}
+		if named {
+			spec.PresetName = c.Phase0Preset
+		}
+	}
+	if err := spec.CheckPresetBase(); err != nil {
+		return nil, err
+	}
+	if err := validateLoadedSpec(&spec); err != nil {
+		return nil, err
+	}
 	return &spec, nil
 }
 
@@ -0,0 +1,343 @@
+package configs
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+
+	"github.com/protolambda/zrnt/eth2/beacon/common"
+)
+
+// PresetBases are the presets that a loaded config can extend, by PRESET_BASE name.
+var PresetBases = map[string]*common.Spec{
+	"mainnet": Mainnet,
+	"minimal": Minimal,
+}
+
+// ValidateLoadedSpecs enables the validation of loaded specs, see common.Spec.Validate.
+// Disable it to load a config with inconsistent parameters anyway, e.g. for testing.
+var ValidateLoadedSpecs = true
+
+func validateLoadedSpec(spec *common.Spec) error {
+	if !ValidateLoadedSpecs {
+		return nil
+	}
+	return spec.Validate()
+}
+
+// LoadConfigYAML loads a config file in the standard format, e.g. mainnet.yaml or a devnet config,
+// on top of the preset named by its PRESET_BASE (mainnet if missing). See LoadConfigYAMLWithWarnings.
+func LoadConfigYAML(r io.Reader) (*common.Spec, error) {
+	spec, _, err := LoadConfigYAMLWithWarnings(r)
+	return spec, err
+}
+
+// LoadConfigYAMLWithWarnings loads a config, and also returns a warning for every ignored unknown key.
+// The loaded spec is validated, unless ValidateLoadedSpecs is disabled.
+//
+// Keys missing in the config keep the values of the preset base, preset values may be overridden too.
+// Legacy keys of the merge fork are renamed to their bellatrix equivalent.
+// A value that is the name of another key refers to the value of that key,
+// in the config itself, or else in the preset base.
+// Unknown fork epochs are rejected if the fork is scheduled, since the fork cannot be processed.
+func LoadConfigYAMLWithWarnings(r io.Reader) (*common.Spec, []string, error) {
+	doc, err := parseConfigYAML(r)
+	if err != nil {
+		return nil, nil, err
+	}
+	presetBase := doc.presetBase
+	if presetBase == "" {
+		presetBase = "mainnet"
+	}
+	base, ok := PresetBases[presetBase]
+	if !ok {
+		return nil, nil, fmt.Errorf("unknown preset base %q", presetBase)
+	}
+	spec := *base
+	if err := doc.apply(&spec); err != nil {
+		return nil, nil, err
+	}
+	if err := validateLoadedSpec(&spec); err != nil {
+		return nil, nil, err
+	}
+	return &spec, doc.warnings, nil
+}
+
+// LoadConfigYAMLWithPreset loads a config like LoadConfigYAMLWithWarnings, but on top of the given preset,
+// e.g. a preset loaded with LoadPresetDir. The PRESET_BASE of the config, if any, must match the preset name.
+// Keys missing in the config keep the values of the config of the known preset base with the same name,
+// or else of the mainnet config.
+func LoadConfigYAMLWithPreset(r io.Reader, preset *common.Preset) (*common.Spec, []string, error) {
+	doc, err := parseConfigYAML(r)
+	if err != nil {
+		return nil, nil, err
+	}
+	if doc.presetBase != "" && doc.presetBase != preset.PresetName {
+		return nil, nil, fmt.Errorf("config is meant for preset %q, but preset is %q", doc.presetBase, preset.PresetName)
+	}
+	spec := common.Spec{Preset: *preset, Config: Mainnet.Config}
+	if base, ok := PresetBases[preset.PresetName]; ok {
+		spec.Config = base.Config
+	}
+	spec.PRESET_BASE = preset.PresetName
+	if err := doc.apply(&spec); err != nil {
+		return nil, nil, err
+	}
+	if err := spec.CheckPresetBase(); err != nil {
+		return nil, nil, err
+	}
+	if err := validateLoadedSpec(&spec); err != nil {
+		return nil, nil, err
+	}
+	return &spec, doc.warnings, nil
+}
+
+// LoadSpecFromYAML loads a spec from the contents of a config file and the preset files of its forks, e.g. phase0.yaml.
+// Unlike LoadConfigYAML it is strict: all config values must be present, and unknown keys are rejected,
+// except for the epochs and versions of unknown forks that are not scheduled.
+// The preset files must define all preset values together. Without preset files,
+// the preset is the known preset of the PRESET_BASE of the config.
+func LoadSpecFromYAML(configYAML []byte, presetYAML ...[]byte) (*common.Spec, error) {
+	doc, err := parseConfigYAML(bytes.NewReader(configYAML))
+	if err != nil {
+		return nil, err
+	}
+	var unknown, missing []string
+	for k := range doc.values {
+		if _, ok := specYAMLKeys[k]; ok || k == "CONFIG_NAME" || strings.HasSuffix(k, "_FORK_EPOCH") {
+			continue
+		}
+		if fork := strings.TrimSuffix(k, "_FORK_VERSION"); fork != k {
+			if _, ok := doc.values[fork+"_FORK_EPOCH"]; ok {
+				continue
+			}
+		}
+		unknown = append(unknown, k)
+	}
+	for k := range configYAMLKeys {
+		if _, ok := doc.values[k]; !ok {
+			missing = append(missing, k)
+		}
+	}
+	var spec common.Spec
+	if len(presetYAML) == 0 {
+		base, ok := PresetBases[doc.presetBase]
+		if !ok {
+			return nil, fmt.Errorf("unknown preset base %q", doc.presetBase)
+		}
+		spec.Preset = base.Preset
+	} else {
+		spec.PresetName = doc.presetBase
+		defined := make(map[string]struct{})
+		for i, data := range presetYAML {
+			var node yaml.Node
+			if err := yaml.Unmarshal(data, &node); err != nil {
+				return nil, fmt.Errorf("failed to parse preset %d: %v", i, err)
+			}
+			if node.Kind != yaml.DocumentNode || len(node.Content) != 1 || node.Content[0].Kind != yaml.MappingNode {
+				return nil, fmt.Errorf("preset %d must be a mapping of keys to values", i)
+			}
+			m := node.Content[0]
+			for j := 0; j < len(m.Content); j += 2 {
+				k := m.Content[j].Value
+				if _, ok := presetYAMLKeys[k]; !ok {
+					unknown = append(unknown, k)
+				}
+				defined[k] = struct{}{}
+			}
+			if err := m.Decode(&spec.Preset); err != nil {
+				return nil, fmt.Errorf("failed to decode preset %d: %v", i, err)
+			}
+		}
+		for k := range presetYAMLKeys {
+			if _, ok := defined[k]; !ok {
+				missing = append(missing, k)
+			}
+		}
+	}
+	if len(unknown) > 0 {
+		sort.Strings(unknown)
+		return nil, fmt.Errorf("unknown spec keys: %s", strings.Join(unknown, ", "))
+	}
+	if len(missing) > 0 {
+		sort.Strings(missing)
+		return nil, fmt.Errorf("missing spec keys: %s", strings.Join(missing, ", "))
+	}
+	if err := doc.apply(&spec); err != nil {
+		return nil, err
+	}
+	if err := spec.CheckPresetBase(); err != nil {
+		return nil, err
+	}
+	if err := validateLoadedSpec(&spec); err != nil {
+		return nil, err
+	}
+	return &spec, nil
+}
+
+// LoadPresetYAML decodes a preset file of a single fork, e.g. phase0.yaml, into the preset.
+// Keys of forks that are not supported are ignored.
+func LoadPresetYAML(preset *common.Preset, r io.Reader) error {
+	if err := yaml.NewDecoder(r).Decode(preset); err != nil {
+		return fmt.Errorf("failed to decode preset: %v", err)
+	}
+	return nil
+}
+
+// PresetForks are the names of the preset files of the supported forks, in order.
+var PresetForks = []string{"phase0", "altair", "bellatrix", "capella", "deneb"}
+
+// LoadPresetDir loads the preset files of all supported forks from the directory, e.g. presets/mainnet,
+// and names the preset.
+func LoadPresetDir(name string, dir string) (*common.Preset, error) {
+	preset := &common.Preset{PresetName: name}
+	for _, fork := range PresetForks {
+		if err := loadPresetFile(preset, filepath.Join(dir, fork+".yaml")); err != nil {
+			return nil, fmt.Errorf("failed to load %s preset: %v", fork, err)
+		}
+	}
+	return preset, nil
+}
+
+func loadPresetFile(preset *common.Preset, path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	return LoadPresetYAML(preset, f)
+}
+
+type configDoc struct {
+	m *yaml.Node
+	// the value of every key in the config
+	values map[string]*yaml.Node
+	// empty if the config does not specify the preset base
+	presetBase string
+	warnings   []string
+}
+
+func parseConfigYAML(r io.Reader) (*configDoc, error) {
+	var doc yaml.Node
+	if err := yaml.NewDecoder(r).Decode(&doc); err != nil {
+		if err == io.EOF {
+			return nil, errors.New("empty config")
+		}
+		return nil, fmt.Errorf("failed to parse config: %v", err)
+	}
+	if doc.Kind != yaml.DocumentNode || len(doc.Content) != 1 || doc.Content[0].Kind != yaml.MappingNode {
+		return nil, errors.New("config must be a mapping of keys to values")
+	}
+	m := doc.Content[0]
+	out := &configDoc{m: m, values: make(map[string]*yaml.Node, len(m.Content)/2)}
+	for i := 0; i+1 < len(m.Content); i += 2 {
+		k, v := m.Content[i], m.Content[i+1]
+		if _, ok := specYAMLKeys[k.Value]; !ok {
+			if renamed := strings.ReplaceAll(k.Value, "MERGE", "BELLATRIX"); renamed != k.Value {
+				if _, ok := specYAMLKeys[renamed]; ok {
+					k.Value = renamed
+				}
+			}
+		}
+		out.values[k.Value] = v
+		switch _, ok := specYAMLKeys[k.Value]; {
+		case k.Value == "PRESET_BASE":
+			out.presetBase = v.Value
+		case ok:
+		case k.Value == "CONFIG_NAME":
+		case strings.HasSuffix(k.Value, "_FORK_EPOCH"):
+			epoch, err := strconv.ParseUint(v.Value, 0, 64)
+			if err != nil {
+				return nil, fmt.Errorf("invalid fork epoch %s: %v", k.Value, err)
+			}
+			if common.Epoch(epoch) != common.FAR_FUTURE_EPOCH {
+				return nil, fmt.Errorf("unknown fork %s is scheduled at epoch %d", k.Value, epoch)
+			}
+			out.warnings = append(out.warnings, fmt.Sprintf("ignoring unknown fork epoch %s", k.Value))
+		default:
+			out.warnings = append(out.warnings, fmt.Sprintf("ignoring unknown config key %s", k.Value))
+		}
+	}
+	return out, nil
+}
+
+// apply resolves the references of the config against the given spec, and decodes the config into it.
+func (d *configDoc) apply(spec *common.Spec) error {
+	m := d.m
+	for i := 0; i+1 < len(m.Content); i += 2 {
+		k, v := m.Content[i], m.Content[i+1]
+		if _, ok := specYAMLKeys[k.Value]; !ok {
+			continue
+		}
+		resolved, err := resolveConfigValue(spec, specYAMLKeys, d.values, k.Value, v)
+		if err != nil {
+			return err
+		}
+		m.Content[i+1] = resolved
+	}
+	if err := m.Decode(spec); err != nil {
+		return fmt.Errorf("failed to decode config: %v", err)
+	}
+	return nil
+}
+
+// resolveConfigValue follows references to other keys, to the values in the config or the preset base.
+func resolveConfigValue(base *common.Spec, known map[string][]int, values map[string]*yaml.Node, key string, v *yaml.Node) (*yaml.Node, error) {
+	for depth := 0; v.Kind == yaml.ScalarNode && v.Style == 0; depth++ {
+		ref, ok := known[v.Value]
+		if !ok {
+			return v, nil
+		}
+		if depth >= 8 {
+			return nil, fmt.Errorf("config key %s: too many references", key)
+		}
+		if next, ok := values[v.Value]; ok {
+			v = next
+			continue
+		}
+		var out yaml.Node
+		if err := out.Encode(reflect.ValueOf(base).Elem().FieldByIndex(ref).Interface()); err != nil {
+			return nil, fmt.Errorf("config key %s: failed to resolve reference %s: %v", key, v.Value, err)
+		}
+		return &out, nil
+	}
+	return v, nil
+}
+
+// the YAML key of every config and preset value of the Spec, mapped to the field index
+var specYAMLKeys = func() map[string][]int {
+	out := make(map[string][]int)
+	collectYAMLKeys(reflect.TypeOf(common.Spec{}), nil, out)
+	return out
+}()
+
+// the YAML keys of the config and of the preset values of the Spec
+var configYAMLKeys, presetYAMLKeys = func() (map[string][]int, map[string][]int) {
+	config, preset := make(map[string][]int), make(map[string][]int)
+	collectYAMLKeys(reflect.TypeOf(common.Config{}), nil, config)
+	collectYAMLKeys(reflect.TypeOf(common.Preset{}), nil, preset)
+	return config, preset
+}()
+
+func collectYAMLKeys(typ reflect.Type, index []int, out map[string][]int) {
+	for i := 0; i < typ.NumField(); i++ {
+		f := typ.Field(i)
+		tag := f.Tag.Get("yaml")
+		name := strings.Split(tag, ",")[0]
+		fieldIndex := append(append(make([]int, 0, len(index)+1), index...), i)
+		if strings.Contains(tag, ",inline") && f.Type.Kind() == reflect.Struct {
+			collectYAMLKeys(f.Type, fieldIndex, out)
+		} else if name != "" && name != "-" {
+			out[name] = fieldIndex
+		}
+	}
+}
@@ -0,0 +1,252 @@
+package configs
+
+import (
+	"bytes"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"gopkg.in/yaml.v3"
+
+	"github.com/protolambda/zrnt/eth2/beacon/common"
+)
+
+func TestLoadConfigYAMLMainnet(t *testing.T) {
+	spec, warnings, err := LoadConfigYAMLWithWarnings(bytes.NewReader(mustLoad("configs", "mainnet")))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if spec.SLOTS_PER_EPOCH != 32 || spec.MAX_ATTESTATIONS != 128 || spec.SYNC_COMMITTEE_SIZE != 512 {
+		t.Fatal("expected mainnet preset")
+	}
+	if spec.SECONDS_PER_SLOT != 12 || spec.ALTAIR_FORK_EPOCH != 74240 || spec.CAPELLA_FORK_VERSION != (common.Version{3, 0, 0, 0}) {
+		t.Fatal("expected mainnet config")
+	}
+	if spec.Config != Mainnet.Config {
+		t.Fatal("expected loaded config to match the mainnet config")
+	}
+	// the EIP6110 fork is not known, but not scheduled either
+	if len(warnings) != 2 {
+		t.Fatalf("expected warnings for the unknown fork, got %v", warnings)
+	}
+	if epoch := spec.SlotToEpoch(64); epoch != 2 {
+		t.Fatal("expected slots per epoch of the preset to drive the epoch computation")
+	}
+}
+
+func TestLoadConfigYAMLMinimal(t *testing.T) {
+	spec, err := LoadConfigYAML(bytes.NewReader(mustLoad("configs", "minimal")))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if spec.SLOTS_PER_EPOCH != 8 || spec.SYNC_COMMITTEE_SIZE != 32 || spec.EPOCHS_PER_HISTORICAL_VECTOR != 64 {
+		t.Fatal("expected minimal preset")
+	}
+	if spec.SECONDS_PER_SLOT != 6 || spec.GENESIS_FORK_VERSION != (common.Version{0, 0, 0, 1}) || spec.CHURN_LIMIT_QUOTIENT != 32 {
+		t.Fatal("expected minimal config")
+	}
+}
+
+func TestLoadConfigYAMLDevnet(t *testing.T) {
+	spec, warnings, err := LoadConfigYAMLWithWarnings(strings.NewReader(`
+PRESET_BASE: 'minimal'
+CONFIG_NAME: 'devnet'
+GENESIS_FORK_VERSION: 0x10000038
+ALTAIR_FORK_EPOCH: 0
+MERGE_FORK_VERSION: 0x30000038
+MERGE_FORK_EPOCH: 2
+SECONDS_PER_SLOT: 3
+SHARD_COMMITTEE_PERIOD: MIN_VALIDATOR_WITHDRAWABILITY_DELAY
+MIN_VALIDATOR_WITHDRAWABILITY_DELAY: 10
+ETH1_FOLLOW_DISTANCE: SLOTS_PER_EPOCH
+SOME_CLIENT_FLAG: true
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if spec.GENESIS_FORK_VERSION != (common.Version{0x10, 0, 0, 0x38}) || spec.ALTAIR_FORK_EPOCH != 0 || spec.SECONDS_PER_SLOT != 3 {
+		t.Fatal("expected overridden config values")
+	}
+	if spec.BELLATRIX_FORK_VERSION != (common.Version{0x30, 0, 0, 0x38}) || spec.BELLATRIX_FORK_EPOCH != 2 {
+		t.Fatal("expected legacy merge keys to configure bellatrix")
+	}
+	if spec.SHARD_COMMITTEE_PERIOD != 10 || spec.ETH1_FOLLOW_DISTANCE != 8 {
+		t.Fatalf("expected references to be resolved, got %d and %d", spec.SHARD_COMMITTEE_PERIOD, spec.ETH1_FOLLOW_DISTANCE)
+	}
+	// defaults of the preset base for missing keys
+	if spec.CAPELLA_FORK_EPOCH != Minimal.CAPELLA_FORK_EPOCH || spec.DEPOSIT_CHAIN_ID != Minimal.DEPOSIT_CHAIN_ID {
+		t.Fatal("expected missing keys to default to the preset base")
+	}
+	if len(warnings) != 1 || !strings.Contains(warnings[0], "SOME_CLIENT_FLAG") {
+		t.Fatalf("expected warning for unknown key, got %v", warnings)
+	}
+	if Minimal.SECONDS_PER_SLOT != 6 {
+		t.Fatal("loading a config must not change the preset base")
+	}
+}
+
+func TestLoadConfigYAMLInvalid(t *testing.T) {
+	cases := map[string]string{
+		"scheduled unknown fork": "EIP6110_FORK_EPOCH: 10\n",
+		"unknown preset base":    "PRESET_BASE: 'other'\n",
+		"invalid value":          "SECONDS_PER_SLOT: twelve\n",
+		"not a mapping":          "- SECONDS_PER_SLOT\n",
+		"empty":                  "",
+	}
+	for name, input := range cases {
+		if _, err := LoadConfigYAML(strings.NewReader(input)); err == nil {
+			t.Errorf("%s: expected error", name)
+		}
+	}
+}
+
+func TestLoadPresetDir(t *testing.T) {
+	for name, expected := range PresetBases {
+		preset, err := LoadPresetDir(name, filepath.Join("yamls", "presets", name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(*preset, expected.Preset) {
+			t.Fatalf("loaded %s preset does not match", name)
+		}
+	}
+}
+
+func TestLoadConfigYAMLWithPreset(t *testing.T) {
+	mainnet, err := LoadPresetDir("mainnet", filepath.Join("yamls", "presets", "mainnet"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// a devnet config with the mainnet preset
+	spec, _, err := LoadConfigYAMLWithPreset(strings.NewReader(`
+PRESET_BASE: 'mainnet'
+CONFIG_NAME: 'devnet'
+GENESIS_FORK_VERSION: 0x10000038
+SECONDS_PER_SLOT: 4
+`), mainnet)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if spec.SLOTS_PER_EPOCH != 32 || spec.MAX_BLOBS_PER_BLOCK != Mainnet.MAX_BLOBS_PER_BLOCK {
+		t.Fatal("expected mainnet preset")
+	}
+	if spec.SECONDS_PER_SLOT != 4 || spec.GENESIS_FORK_VERSION != (common.Version{0x10, 0, 0, 0x38}) {
+		t.Fatal("expected devnet config")
+	}
+	if spec.ALTAIR_FORK_EPOCH != Mainnet.ALTAIR_FORK_EPOCH {
+		t.Fatal("expected missing keys to default to the mainnet config")
+	}
+
+	minimal, err := LoadPresetDir("minimal", filepath.Join("yamls", "presets", "minimal"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	spec, _, err = LoadConfigYAMLWithPreset(bytes.NewReader(mustLoad("configs", "minimal")), minimal)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(spec.Preset, Minimal.Preset) || spec.Config != Minimal.Config {
+		t.Fatal("expected minimal spec")
+	}
+
+	// the mainnet config is not meant for the minimal preset
+	if _, _, err := LoadConfigYAMLWithPreset(bytes.NewReader(mustLoad("configs", "mainnet")), minimal); err == nil {
+		t.Fatal("expected preset base mismatch to be rejected")
+	}
+	mismatch := *Minimal
+	mismatch.PRESET_BASE = "mainnet"
+	if err := mismatch.CheckPresetBase(); err == nil {
+		t.Fatal("expected preset base mismatch to be detected")
+	}
+}
+
+func TestLoadSpecFromYAML(t *testing.T) {
+	for name, expected := range PresetBases {
+		var presets [][]byte
+		for _, fork := range PresetForks {
+			presets = append(presets, mustLoad("presets", name, fork))
+		}
+		config := mustLoad("configs", name)
+		spec, err := LoadSpecFromYAML(config, presets...)
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		if spec.SLOTS_PER_EPOCH != expected.SLOTS_PER_EPOCH || spec.MAX_ATTESTATIONS != expected.MAX_ATTESTATIONS ||
+			spec.EPOCHS_PER_HISTORICAL_VECTOR != expected.EPOCHS_PER_HISTORICAL_VECTOR || spec.MAX_BLOBS_PER_BLOCK != expected.MAX_BLOBS_PER_BLOCK {
+			t.Fatalf("%s: unexpected preset values", name)
+		}
+		if spec.SECONDS_PER_SLOT != expected.SECONDS_PER_SLOT || spec.GENESIS_FORK_VERSION != expected.GENESIS_FORK_VERSION ||
+			spec.CAPELLA_FORK_EPOCH != expected.CAPELLA_FORK_EPOCH || spec.MIN_GENESIS_TIME != expected.MIN_GENESIS_TIME {
+			t.Fatalf("%s: unexpected config values", name)
+		}
+		if !reflect.DeepEqual(spec.Preset, expected.Preset) || spec.Config != expected.Config {
+			t.Fatalf("%s: loaded spec does not match", name)
+		}
+		// the preset of the preset base
+		if spec, err := LoadSpecFromYAML(config); err != nil || spec.Preset != expected.Preset {
+			t.Fatalf("%s: expected preset of the preset base: %v", name, err)
+		}
+
+		// missing preset files
+		if _, err := LoadSpecFromYAML(config, presets[:2]...); err == nil || !strings.Contains(err.Error(), "missing spec keys: ") ||
+			!strings.Contains(err.Error(), "MAX_BLOBS_PER_BLOCK") {
+			t.Fatalf("%s: expected missing preset keys, got %v", name, err)
+		}
+		// a missing config value
+		partial := bytes.Replace(config, []byte("\nSECONDS_PER_SLOT:"), []byte("\n# SECONDS_PER_SLOT:"), 1)
+		if _, err := LoadSpecFromYAML(partial, presets...); err == nil || err.Error() != "missing spec keys: SECONDS_PER_SLOT" {
+			t.Fatalf("%s: expected missing config key, got %v", name, err)
+		}
+		// an unknown config value
+		extra := append(append([]byte{}, config...), []byte("\nFOO_BAR: 3\n")...)
+		if _, err := LoadSpecFromYAML(extra, presets...); err == nil || err.Error() != "unknown spec keys: FOO_BAR" {
+			t.Fatalf("%s: expected unknown config key, got %v", name, err)
+		}
+	}
+}
+
+func TestSpecMarshalAPIYAML(t *testing.T) {
+	data, err := Mainnet.MarshalAPIYAML()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var values map[string]string
+	if err := yaml.Unmarshal(data, &values); err != nil {
+		t.Fatal(err)
+	}
+	if values["SECONDS_PER_SLOT"] != "12" || values["GENESIS_FORK_VERSION"] != "0x00000000" || values["DOMAIN_RANDAO"] != "0x02000000" {
+		t.Fatalf("unexpected values: %s", data)
+	}
+	spec, err := common.SpecFromAPI(values)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if spec.Preset != Mainnet.Preset || spec.Config != Mainnet.Config {
+		t.Fatal("expected the spec to round trip through the spec API")
+	}
+}
+
+// yaml.Marshal of the spec keeps encoding the fields of the spec, which decode into a spec again.
+func TestSpecMarshalYAML(t *testing.T) {
+	data, err := yaml.Marshal(Mainnet)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var spec common.Spec
+	if err := yaml.Unmarshal(data, &spec); err != nil {
+		t.Fatal(err)
+	}
+	// the preset name is not encoded
+	spec.PresetName = Mainnet.PresetName
+	if spec.Preset != Mainnet.Preset || spec.Config != Mainnet.Config {
+		t.Fatal("expected the spec to round trip through YAML")
+	}
+	var values map[string]interface{}
+	if err := yaml.Unmarshal(data, &values); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := values["DOMAIN_RANDAO"]; ok {
+		t.Fatal("expected no spec API constants")
+	}
+}
@@ -0,0 +1,92 @@
+// Package networks bundles the configs and genesis data of the public networks.
+package networks
+
+import (
+	"bytes"
+	"embed"
+	"fmt"
+
+	"github.com/protolambda/zrnt/eth2/beacon/common"
+	"github.com/protolambda/zrnt/eth2/configs"
+)
+
+// The canonical config files of the networks, as published by the client teams.
+//
+//go:embed configs/*.yaml
+var configFiles embed.FS
+
+type Network struct {
+	Name                  string
+	Spec                  *common.Spec
+	GenesisTime           common.Timestamp
+	GenesisValidatorsRoot common.Root
+	ForkSchedule          common.ForkSchedule
+}
+
+// ForkDigest returns the digest of the fork that is active at the epoch.
+func (n *Network) ForkDigest(epoch common.Epoch) common.ForkDigest {
+	f := n.ForkSchedule.ForkAtEpoch(epoch)
+	return f.Digest(n.GenesisValidatorsRoot)
+}
+
+// GenesisForkDigest returns the digest of the genesis fork.
+func (n *Network) GenesisForkDigest() common.ForkDigest {
+	return n.ForkSchedule[0].Digest(n.GenesisValidatorsRoot)
+}
+
+func mustRoot(s string) (out common.Root) {
+	if err := out.UnmarshalText([]byte(s)); err != nil {
+		panic(err)
+	}
+	return out
+}
+
+// load loads the embedded config of the network. The embedded configs are valid, a failure is a bug.
+func load(name string, genesisTime common.Timestamp, genesisValRoot common.Root) *Network {
+	data, err := configFiles.ReadFile("configs/" + name + ".yaml")
+	if err != nil {
+		panic(fmt.Errorf("missing %s config: %v", name, err))
+	}
+	spec, err := configs.LoadConfigYAML(bytes.NewReader(data))
+	if err != nil {
+		panic(fmt.Errorf("invalid %s config: %v", name, err))
+	}
+	return &Network{
+		Name:                  name,
+		Spec:                  spec,
+		GenesisTime:           genesisTime,
+		GenesisValidatorsRoot: genesisValRoot,
+		ForkSchedule:          spec.ForkSchedule(),
+	}
+}
+
+// Mainnet returns a new copy of the mainnet bundle.
+func Mainnet() *Network {
+	return load("mainnet", 1606824023, mustRoot("0x4b363db94e286120d76eb905340fdd4e54bfe9f06bf33ff6cf5ad27f511bfe95"))
+}
+
+// Prater returns a new copy of the bundle of the Prater testnet, the beacon chain of Goerli.
+func Prater() *Network {
+	return load("prater", 1616508000, mustRoot("0x043db0d9a83813551ee2f33450d23797757d430911a9320530ad8a0eabc43efb"))
+}
+
+// Sepolia returns a new copy of the bundle of the Sepolia testnet.
+func Sepolia() *Network {
+	return load("sepolia", 1655733600, mustRoot("0xd8ea171f3c94aea21ebc42a1ed61052acf3f9209c00e4efbaaddac09ed9b8078"))
+}
+
+var byName = map[string]func() *Network{
+	"mainnet": Mainnet,
+	"prater":  Prater,
+	"goerli":  Prater,
+	"sepolia": Sepolia,
+}
+
+// ByName returns a new copy of the bundle of the named network, if known.
+func ByName(name string) (*Network, bool) {
+	fn, ok := byName[name]
+	if !ok {
+		return nil, false
+	}
+	return fn(), true
+}
@@ -0,0 +1,43 @@
+package networks
+
+import (
+	"testing"
+
+	"github.com/protolambda/zrnt/eth2/beacon/common"
+	"github.com/protolambda/zrnt/eth2/configs"
+)
+
+func TestMainnet(t *testing.T) {
+	n := Mainnet()
+	// the fork digest of the genesis fork of mainnet, as used in the gossip topics of phase0
+	if d := n.GenesisForkDigest(); d != (common.ForkDigest{0xb5, 0x30, 0x3f, 0x2a}) {
+		t.Fatalf("unexpected mainnet genesis fork digest: %s", d)
+	}
+	if d := n.ForkDigest(74240); d != (common.ForkDigest{0xaf, 0xca, 0xab, 0xa0}) {
+		t.Fatalf("unexpected mainnet altair fork digest: %s", d)
+	}
+	if n.Spec.Config != configs.Mainnet.Config {
+		t.Fatal("expected the embedded mainnet config to match the mainnet config")
+	}
+	if n.Spec == Mainnet().Spec {
+		t.Fatal("expected a new spec for every bundle")
+	}
+}
+
+func TestByName(t *testing.T) {
+	for _, name := range []string{"mainnet", "prater", "goerli", "sepolia"} {
+		n, ok := ByName(name)
+		if !ok {
+			t.Fatalf("unknown network %s", name)
+		}
+		if n.GenesisTime < n.Spec.MIN_GENESIS_TIME {
+			t.Fatalf("%s: unexpected genesis time %d", name, n.GenesisTime)
+		}
+		if n.ForkSchedule.VersionAtEpoch(0) != n.Spec.GENESIS_FORK_VERSION {
+			t.Fatalf("%s: unexpected genesis fork version", name)
+		}
+	}
+	if _, ok := ByName("pyrmont"); ok {
+		t.Fatal("expected unknown network")
+	}
+}
@@ -0,0 +1,154 @@
+package configs
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/protolambda/zrnt/eth2/beacon/common"
+	"github.com/protolambda/zrnt/eth2/beacon/phase0"
+)
+
+func TestSpecValidate(t *testing.T) {
+	for name, spec := range PresetBases {
+		if err := spec.Validate(); err != nil {
+			t.Fatalf("%s spec: %v", name, err)
+		}
+	}
+	cases := []struct {
+		name   string
+		modify func(spec *common.Spec)
+		// part of the expected violation
+		expected string
+	}{
+		{"zero slots per epoch", func(s *common.Spec) { s.SLOTS_PER_EPOCH = 0 }, "SLOTS_PER_EPOCH must not be zero"},
+		{"historical roots not per epoch", func(s *common.Spec) { s.SLOTS_PER_HISTORICAL_ROOT = s.SLOTS_PER_EPOCH*4 + 1 }, "multiple of SLOTS_PER_EPOCH"},
+		{"historical roots too short", func(s *common.Spec) { s.SLOTS_PER_HISTORICAL_ROOT = s.SLOTS_PER_EPOCH }, "at least two epochs"},
+		{"zero sync committee period", func(s *common.Spec) { s.EPOCHS_PER_SYNC_COMMITTEE_PERIOD = 0 }, "EPOCHS_PER_SYNC_COMMITTEE_PERIOD"},
+		{"seed lookahead order", func(s *common.Spec) { s.MIN_SEED_LOOKAHEAD = s.MAX_SEED_LOOKAHEAD }, "less than MAX_SEED_LOOKAHEAD"},
+		{"zero min seed lookahead", func(s *common.Spec) { s.MIN_SEED_LOOKAHEAD = 0 }, "MIN_SEED_LOOKAHEAD must be at least 1"},
+		{"short randao history", func(s *common.Spec) { s.EPOCHS_PER_HISTORICAL_VECTOR = 2 }, "EPOCHS_PER_HISTORICAL_VECTOR"},
+		{"zero inclusion delay", func(s *common.Spec) { s.MIN_ATTESTATION_INCLUSION_DELAY = 0 }, "MIN_ATTESTATION_INCLUSION_DELAY must be at least 1"},
+		{"late inclusion delay", func(s *common.Spec) { s.MIN_ATTESTATION_INCLUSION_DELAY = s.SLOTS_PER_EPOCH + 1 }, "must not exceed SLOTS_PER_EPOCH"},
+		{"zero committees", func(s *common.Spec) { s.MAX_COMMITTEES_PER_SLOT = 0 }, "MAX_COMMITTEES_PER_SLOT"},
+		{"small committee limit", func(s *common.Spec) { s.MAX_VALIDATORS_PER_COMMITTEE = s.TARGET_COMMITTEE_SIZE - 1 }, "MAX_VALIDATORS_PER_COMMITTEE"},
+		{"zero hysteresis", func(s *common.Spec) { s.HYSTERESIS_QUOTIENT = 0 }, "HYSTERESIS_QUOTIENT"},
+		{"uneven max balance", func(s *common.Spec) { s.MAX_EFFECTIVE_BALANCE += 1 }, "multiple of EFFECTIVE_BALANCE_INCREMENT"},
+		{"high ejection balance", func(s *common.Spec) { s.EJECTION_BALANCE = s.MAX_EFFECTIVE_BALANCE }, "EJECTION_BALANCE"},
+		{"high min deposit", func(s *common.Spec) { s.MIN_DEPOSIT_AMOUNT = s.MAX_EFFECTIVE_BALANCE + 1 }, "MIN_DEPOSIT_AMOUNT"},
+		{"zero deposits", func(s *common.Spec) { s.MAX_DEPOSITS = 0 }, "MAX_DEPOSITS"},
+		{"uneven sync subnets", func(s *common.Spec) { s.SYNC_COMMITTEE_SIZE = 30 }, "subnet count"},
+		{"too many sync participants", func(s *common.Spec) { s.MIN_SYNC_COMMITTEE_PARTICIPANTS = s.SYNC_COMMITTEE_SIZE + 1 }, "MIN_SYNC_COMMITTEE_PARTICIPANTS"},
+		{"zero inactivity bias", func(s *common.Spec) { s.INACTIVITY_SCORE_BIAS = 0 }, "INACTIVITY_SCORE_BIAS"},
+		{"zero withdrawals", func(s *common.Spec) { s.MAX_WITHDRAWALS_PER_PAYLOAD = 0 }, "MAX_WITHDRAWALS_PER_PAYLOAD"},
+		{"blob size", func(s *common.Spec) { s.FIELD_ELEMENTS_PER_BLOB = 3000 }, "power of two"},
+		{"zero slot time", func(s *common.Spec) { s.SECONDS_PER_SLOT = 0 }, "SECONDS_PER_SLOT"},
+		{"zero churn quotient", func(s *common.Spec) { s.CHURN_LIMIT_QUOTIENT = 0 }, "CHURN_LIMIT_QUOTIENT"},
+		{"fork order", func(s *common.Spec) { s.ALTAIR_FORK_EPOCH = s.BELLATRIX_FORK_EPOCH + 1 }, "ALTAIR_FORK_EPOCH"},
+		{"fork version reuse", func(s *common.Spec) { s.CAPELLA_FORK_VERSION = s.BELLATRIX_FORK_VERSION }, "BELLATRIX_FORK_VERSION and CAPELLA_FORK_VERSION must differ"},
+		{"zero shuffle rounds", func(s *common.Spec) { s.SHUFFLE_ROUND_COUNT = 0 }, "SHUFFLE_ROUND_COUNT must not be zero"},
+		{"zero genesis validators", func(s *common.Spec) { s.MIN_GENESIS_ACTIVE_VALIDATOR_COUNT = 0 }, "MIN_GENESIS_ACTIVE_VALIDATOR_COUNT must not be zero"},
+		{"small registry", func(s *common.Spec) { s.VALIDATOR_REGISTRY_LIMIT = 1024 }, "VALIDATOR_REGISTRY_LIMIT (1024) must be at least MAX_VALIDATORS_PER_COMMITTEE (2048)"},
+		{"zero historical roots", func(s *common.Spec) { s.HISTORICAL_ROOTS_LIMIT = 0 }, "HISTORICAL_ROOTS_LIMIT must not be zero"},
+		{"randao history size", func(s *common.Spec) { s.EPOCHS_PER_HISTORICAL_VECTOR = 60000 }, "EPOCHS_PER_HISTORICAL_VECTOR (60000) must be a power of two"},
+		{"score boost", func(s *common.Spec) { s.PROPOSER_SCORE_BOOST = 101 }, "PROPOSER_SCORE_BOOST"},
+	}
+	for _, c := range cases {
+		spec := *Mainnet
+		c.modify(&spec)
+		err := spec.Validate()
+		if err == nil {
+			t.Errorf("%s: expected violation", c.name)
+			continue
+		}
+		if !strings.Contains(err.Error(), c.expected) {
+			t.Errorf("%s: expected violation %q, got: %v", c.name, c.expected, err)
+		}
+	}
+}
+
+func TestSpecValidateAllViolations(t *testing.T) {
+	spec := *Minimal
+	spec.EPOCHS_PER_SYNC_COMMITTEE_PERIOD = 0
+	spec.MIN_SEED_LOOKAHEAD = spec.MAX_SEED_LOOKAHEAD
+	spec.SECONDS_PER_SLOT = 0
+	errs, ok := spec.Validate().(common.SpecErrors)
+	if !ok || len(errs) != 3 {
+		t.Fatalf("expected all 3 violations, got %v", errs)
+	}
+}
+
+func TestLoadConfigYAMLValidation(t *testing.T) {
+	input := "PRESET_BASE: 'minimal'\nSECONDS_PER_SLOT: 0\n"
+	if _, err := LoadConfigYAML(strings.NewReader(input)); err == nil {
+		t.Fatal("expected invalid config to be rejected")
+	}
+	ValidateLoadedSpecs = false
+	defer func() { ValidateLoadedSpecs = true }()
+	spec, err := LoadConfigYAML(strings.NewReader(input))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if spec.SECONDS_PER_SLOT != 0 {
+		t.Fatal("expected invalid value to be loaded when validation is disabled")
+	}
+}
+
+func TestSpecBuilder(t *testing.T) {
+	spec, err := common.NewSpecBuilder(Minimal).SlotsPerEpoch(4).SecondsPerSlot(2).
+		AltairForkEpoch(2).BellatrixForkEpoch(3).Build()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if spec.SLOTS_PER_EPOCH != 4 || spec.SECONDS_PER_SLOT != 2 || spec.ALTAIR_FORK_EPOCH != 2 || spec.BELLATRIX_FORK_EPOCH != 3 {
+		t.Fatal("expected modified spec")
+	}
+	if Minimal.SLOTS_PER_EPOCH != 8 || Minimal.ALTAIR_FORK_EPOCH == 2 {
+		t.Fatal("expected base spec to be unchanged")
+	}
+	if f := spec.ForkSchedule().ForkAtEpoch(2); f.Name != common.Altair {
+		t.Fatalf("expected altair at epoch 2, got %s", f.Name)
+	}
+	// the preset sizes the SSZ types of the built spec
+	if n := phase0.RandaoMixesType(spec).Length(); n != uint64(Minimal.EPOCHS_PER_HISTORICAL_VECTOR) {
+		t.Fatalf("unexpected randao mixes length %d", n)
+	}
+	custom, err := common.NewSpecBuilder(Minimal).EpochsPerHistoricalVector(128).Build()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n := phase0.RandaoMixesType(custom).Length(); n != 128 {
+		t.Fatalf("expected randao mixes of the built preset, got length %d", n)
+	}
+
+	for _, c := range []struct {
+		name    string
+		builder *common.SpecBuilder
+		// all expected violations
+		expected []string
+	}{
+		{"history vector", common.NewSpecBuilder(Minimal).EpochsPerHistoricalVector(48),
+			[]string{"EPOCHS_PER_HISTORICAL_VECTOR (48) must be a power of two"}},
+		{"historical roots", common.NewSpecBuilder(Minimal).SlotsPerEpoch(6),
+			[]string{"SLOTS_PER_HISTORICAL_ROOT (64) must be a multiple of SLOTS_PER_EPOCH (6)"}},
+		{"churn", common.NewSpecBuilder(Minimal).ChurnLimitQuotient(0),
+			[]string{"CHURN_LIMIT_QUOTIENT must not be zero"}},
+		{"forks", common.NewSpecBuilder(Minimal).AltairForkEpoch(10).BellatrixForkEpoch(5).SecondsPerSlot(0),
+			[]string{"SECONDS_PER_SLOT must not be zero", "ALTAIR_FORK_EPOCH (10) must not be after BELLATRIX_FORK_EPOCH (5)"}},
+	} {
+		spec, err := c.builder.Build()
+		if spec != nil {
+			t.Errorf("%s: expected no spec", c.name)
+		}
+		var errs common.SpecErrors
+		if !errors.As(err, &errs) || len(errs) != len(c.expected) {
+			t.Errorf("%s: expected %d violations, got %v", c.name, len(c.expected), err)
+			continue
+		}
+		for i, expected := range c.expected {
+			if errs[i].Error() != expected {
+				t.Errorf("%s: expected violation %q, got %q", c.name, expected, errs[i])
+			}
+		}
+	}
+}
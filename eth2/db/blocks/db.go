@@ -0,0 +1,108 @@
+// Package blocks stores signed beacon blocks by block root.
+package blocks
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+
+	"github.com/protolambda/ztyp/codec"
+
+	"github.com/protolambda/zrnt/eth2/beacon"
+	"github.com/protolambda/zrnt/eth2/beacon/common"
+	"github.com/protolambda/zrnt/eth2/beacon/transition"
+)
+
+// DB stores signed beacon blocks of any fork, by block root. Implementations are safe for concurrent use.
+type DB interface {
+	// Store the block, by its block root. Storing a block again is a no-op.
+	Store(root common.Root, block *common.BeaconBlockEnvelope) error
+	// Get the block with the given block root.
+	Get(root common.Root) (block *common.BeaconBlockEnvelope, exists bool, err error)
+	// Remove the block with the given block root. Exists is true if the block was stored.
+	Remove(root common.Root) (exists bool, err error)
+	// Stream writes the SSZ encoding of the signed block, without decoding it. ErrUnknownBlock if it is not stored.
+	Stream(root common.Root, w io.Writer) error
+}
+
+var ErrUnknownBlock = errors.New("unknown block")
+
+// encodeBlock encodes the block as the signed block type of its fork.
+func encodeBlock(spec *common.Spec, block *common.BeaconBlockEnvelope) ([]byte, error) {
+	signed, err := beacon.EnvelopeToSignedBeaconBlock(block)
+	if err != nil {
+		return nil, err
+	}
+	var buf bytes.Buffer
+	if err := signed.Serialize(spec, codec.NewEncodingWriter(&buf)); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// MemDB keeps the encoded blocks in memory.
+type MemDB struct {
+	sync.RWMutex
+	spec           *common.Spec
+	genesisValRoot common.Root
+	blocks         map[common.Root][]byte
+}
+
+var _ DB = (*MemDB)(nil)
+
+// NewMemDB creates an empty blocks DB. The genesis validators root is needed to decode the blocks of any fork.
+func NewMemDB(spec *common.Spec, genesisValRoot common.Root) *MemDB {
+	return &MemDB{spec: spec, genesisValRoot: genesisValRoot, blocks: make(map[common.Root][]byte)}
+}
+
+func (db *MemDB) Store(root common.Root, block *common.BeaconBlockEnvelope) error {
+	db.RLock()
+	_, exists := db.blocks[root]
+	db.RUnlock()
+	if exists {
+		return nil
+	}
+	data, err := encodeBlock(db.spec, block)
+	if err != nil {
+		return fmt.Errorf("failed to encode block %s: %v", root, err)
+	}
+	db.Lock()
+	db.blocks[root] = data
+	db.Unlock()
+	return nil
+}
+
+func (db *MemDB) Get(root common.Root) (block *common.BeaconBlockEnvelope, exists bool, err error) {
+	db.RLock()
+	data, exists := db.blocks[root]
+	db.RUnlock()
+	if !exists {
+		return nil, false, nil
+	}
+	block, err = transition.DecodeBlock(db.spec, db.genesisValRoot, data)
+	if err != nil {
+		return nil, true, fmt.Errorf("failed to decode block %s: %v", root, err)
+	}
+	return block, true, nil
+}
+
+func (db *MemDB) Remove(root common.Root) (exists bool, err error) {
+	db.Lock()
+	defer db.Unlock()
+	_, exists = db.blocks[root]
+	delete(db.blocks, root)
+	return exists, nil
+}
+
+func (db *MemDB) Stream(root common.Root, w io.Writer) error {
+	db.RLock()
+	data, exists := db.blocks[root]
+	db.RUnlock()
+	if !exists {
+		return ErrUnknownBlock
+	}
+	_, err := w.Write(data)
+	return err
+}
@@ -0,0 +1,123 @@
+package blocks
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"testing"
+
+	"github.com/protolambda/ztyp/codec"
+	"github.com/protolambda/ztyp/tree"
+
+	"github.com/protolambda/zrnt/eth2/beacon/common"
+	"github.com/protolambda/zrnt/eth2/beacon/testutil"
+	"github.com/protolambda/zrnt/eth2/configs"
+)
+
+// testChain returns a chain with blocks of phase0, altair and bellatrix,
+// with the minimal preset: the list limits of the block bodies differ from mainnet.
+func testChain(t *testing.T) (*common.Spec, *testutil.TestChain) {
+	spec := *configs.Minimal
+	spec.ALTAIR_FORK_EPOCH = 1
+	spec.BELLATRIX_FORK_EPOCH = 2
+	chain, err := testutil.GenerateTestChain(&spec, 3, nil, testutil.ChainOptions{Participation: 100})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &spec, chain
+}
+
+func testDB(t *testing.T, spec *common.Spec, db DB, chain *testutil.TestChain) {
+	for _, b := range chain.Blocks {
+		if err := db.Store(b.Envelope.BlockRoot, b.Envelope); err != nil {
+			t.Fatal(err)
+		}
+		if err := db.Store(b.Envelope.BlockRoot, b.Envelope); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, b := range chain.Blocks {
+		root := b.Envelope.BlockRoot
+		got, exists, err := db.Get(root)
+		if err != nil || !exists {
+			t.Fatalf("failed to get block %s, exists: %v, err: %v", root, exists, err)
+		}
+		if got.BlockRoot != root || got.Signature != b.Envelope.Signature || got.ForkDigest != b.Envelope.ForkDigest {
+			t.Fatalf("got different block for %s", root)
+		}
+		if got.Body.HashTreeRoot(spec, tree.GetHashFn()) != b.Envelope.Body.HashTreeRoot(spec, tree.GetHashFn()) {
+			t.Fatalf("got different body for %s", root)
+		}
+		var expected, streamed bytes.Buffer
+		if err := b.Signed.Serialize(spec, codec.NewEncodingWriter(&expected)); err != nil {
+			t.Fatal(err)
+		}
+		if err := db.Stream(root, &streamed); err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(expected.Bytes(), streamed.Bytes()) {
+			t.Fatalf("streamed different encoding for %s", root)
+		}
+	}
+	root := chain.Blocks[0].Envelope.BlockRoot
+	if exists, err := db.Remove(root); err != nil || !exists {
+		t.Fatalf("failed to remove block, exists: %v, err: %v", exists, err)
+	}
+	if exists, err := db.Remove(root); err != nil || exists {
+		t.Fatalf("expected removed block to not exist, err: %v", err)
+	}
+	if _, exists, err := db.Get(root); err != nil || exists {
+		t.Fatalf("expected removed block to not exist, err: %v", err)
+	}
+	if err := db.Stream(root, new(bytes.Buffer)); err != ErrUnknownBlock {
+		t.Fatalf("expected unknown block, got %v", err)
+	}
+}
+
+func TestMemDB(t *testing.T) {
+	spec, chain := testChain(t)
+	gvr, err := chain.Genesis.GenesisValidatorsRoot()
+	if err != nil {
+		t.Fatal(err)
+	}
+	testDB(t, spec, NewMemDB(spec, gvr), chain)
+}
+
+func TestFileDB(t *testing.T) {
+	spec, chain := testChain(t)
+	gvr, err := chain.Genesis.GenesisValidatorsRoot()
+	if err != nil {
+		t.Fatal(err)
+	}
+	db, err := NewFileDB(spec, gvr, t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	testDB(t, spec, db, chain)
+
+	// the mainnet preset has other list limits and epoch lengths: the blocks do not decode with it
+	mainnetDB, err := NewFileDB(configs.Mainnet, gvr, db.dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	last := chain.Blocks[len(chain.Blocks)-1].Envelope
+	if _, exists, err := mainnetDB.Get(last.BlockRoot); !exists || err == nil {
+		t.Fatal("expected minimal preset block to not decode with the mainnet preset")
+	}
+
+	// truncate a file, like a write without sync before a crash
+	root := chain.Blocks[1].Envelope.BlockRoot
+	info, err := os.Stat(db.path(root))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Truncate(db.path(root), info.Size()-10); err != nil {
+		t.Fatal(err)
+	}
+	if _, exists, err := db.Get(root); !exists || !errors.Is(err, ErrPartialFile) {
+		t.Fatalf("expected partial file error, got %v", err)
+	}
+	if err := db.Stream(root, new(bytes.Buffer)); !errors.Is(err, ErrPartialFile) {
+		t.Fatalf("expected partial file error, got %v", err)
+	}
+}
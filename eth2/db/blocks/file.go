@@ -0,0 +1,142 @@
+package blocks
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/protolambda/zrnt/eth2/beacon/common"
+	"github.com/protolambda/zrnt/eth2/beacon/transition"
+)
+
+// FileDB stores every block as a file in a directory, named by the block root.
+// A file starts with the length of the encoded block, as 8 byte little-endian integer,
+// to reject partially written files, followed by the encoded signed block.
+//
+// Files are written to a temporary file first, then synced and renamed: a crash leaves either no file or the full file.
+type FileDB struct {
+	spec           *common.Spec
+	genesisValRoot common.Root
+	dir            string
+}
+
+var _ DB = (*FileDB)(nil)
+
+// NewFileDB opens the blocks directory, and creates it if it does not exist.
+// The genesis validators root is needed to decode the blocks of any fork.
+func NewFileDB(spec *common.Spec, genesisValRoot common.Root, dir string) (*FileDB, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, fmt.Errorf("failed to create blocks dir: %v", err)
+	}
+	return &FileDB{spec: spec, genesisValRoot: genesisValRoot, dir: dir}, nil
+}
+
+func (db *FileDB) path(root common.Root) string {
+	return filepath.Join(db.dir, hex.EncodeToString(root[:])+".ssz")
+}
+
+func (db *FileDB) Store(root common.Root, block *common.BeaconBlockEnvelope) error {
+	path := db.path(root)
+	if _, err := os.Stat(path); err == nil {
+		return nil
+	} else if !os.IsNotExist(err) {
+		return err
+	}
+	data, err := encodeBlock(db.spec, block)
+	if err != nil {
+		return fmt.Errorf("failed to encode block %s: %v", root, err)
+	}
+	tmp, err := ioutil.TempFile(db.dir, "tmp-block-")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	var header [8]byte
+	binary.LittleEndian.PutUint64(header[:], uint64(len(data)))
+	if _, err := tmp.Write(append(header[:], data...)); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to write block %s: %v", root, err)
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+var ErrPartialFile = errors.New("partially written block file")
+
+// open opens the file of the block, and checks its length. The returned reader reads the encoded block.
+func (db *FileDB) open(root common.Root) (f *os.File, size int64, err error) {
+	f, err = os.Open(db.path(root))
+	if os.IsNotExist(err) {
+		return nil, 0, ErrUnknownBlock
+	} else if err != nil {
+		return nil, 0, err
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return nil, 0, err
+	}
+	var header [8]byte
+	if _, err := io.ReadFull(f, header[:]); err != nil {
+		f.Close()
+		return nil, 0, ErrPartialFile
+	}
+	size = int64(binary.LittleEndian.Uint64(header[:]))
+	if info.Size()-int64(len(header)) != size {
+		f.Close()
+		return nil, 0, fmt.Errorf("%w: expected %d bytes, got %d", ErrPartialFile, size, info.Size()-int64(len(header)))
+	}
+	return f, size, nil
+}
+
+func (db *FileDB) Get(root common.Root) (block *common.BeaconBlockEnvelope, exists bool, err error) {
+	f, size, err := db.open(root)
+	if err == ErrUnknownBlock {
+		return nil, false, nil
+	} else if err != nil {
+		return nil, true, fmt.Errorf("failed to read block %s: %w", root, err)
+	}
+	defer f.Close()
+	var buf bytes.Buffer
+	if _, err := io.CopyN(&buf, f, size); err != nil {
+		return nil, true, fmt.Errorf("failed to read block %s: %v", root, err)
+	}
+	block, err = transition.DecodeBlock(db.spec, db.genesisValRoot, buf.Bytes())
+	if err != nil {
+		return nil, true, fmt.Errorf("failed to decode block %s: %v", root, err)
+	}
+	return block, true, nil
+}
+
+func (db *FileDB) Remove(root common.Root) (exists bool, err error) {
+	if err := os.Remove(db.path(root)); os.IsNotExist(err) {
+		return false, nil
+	} else if err != nil {
+		return true, err
+	}
+	return true, nil
+}
+
+func (db *FileDB) Stream(root common.Root, w io.Writer) error {
+	f, size, err := db.open(root)
+	if err == ErrUnknownBlock {
+		return err
+	} else if err != nil {
+		return fmt.Errorf("failed to read block %s: %w", root, err)
+	}
+	defer f.Close()
+	_, err = io.CopyN(w, f, size)
+	return err
+}
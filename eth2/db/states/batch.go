@@ -0,0 +1,278 @@
+package states
+
+import (
+	"context"
+	"encoding/hex"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/protolambda/ztyp/tree"
+
+	"github.com/protolambda/zrnt/eth2/beacon/common"
+)
+
+// Batch collects Store and Remove operations, to commit them at once. A batch is not safe for concurrent use.
+type Batch interface {
+	// Store the state when the batch is committed.
+	Store(ctx context.Context, state common.BeaconState) error
+	// Remove the state with the given state root when the batch is committed.
+	Remove(root common.Root) error
+	// Commit applies the operations in order. If it fails, the DB is left unchanged.
+	Commit() error
+	// Discard drops the operations. Discarding a committed batch is a no-op.
+	Discard()
+}
+
+type memOp struct {
+	root  common.Root
+	state *memState // nil for removals
+}
+
+type memBatch struct {
+	db  *MemDB
+	ops []memOp
+}
+
+func (db *MemDB) Batch() (Batch, error) {
+	return &memBatch{db: db}, nil
+}
+
+func (b *memBatch) Store(ctx context.Context, state common.BeaconState) error {
+	s, err := newMemState(state)
+	if err != nil {
+		return err
+	}
+	b.ops = append(b.ops, memOp{root: state.HashTreeRoot(tree.GetHashFn()), state: &s})
+	return nil
+}
+
+func (b *memBatch) Remove(root common.Root) error {
+	b.ops = append(b.ops, memOp{root: root})
+	return nil
+}
+
+func (b *memBatch) Commit() error {
+	b.db.Lock()
+	defer b.db.Unlock()
+	for _, op := range b.ops {
+		if op.state == nil {
+			delete(b.db.states, op.root)
+		} else {
+			b.db.states[op.root] = *op.state
+		}
+	}
+	b.ops = nil
+	return nil
+}
+
+func (b *memBatch) Discard() {
+	b.ops = nil
+}
+
+type diffOp struct {
+	root  common.Root
+	state common.BeaconState // nil for removals
+}
+
+type diffBatch struct {
+	db  *DiffDB
+	ops []diffOp
+}
+
+func (db *DiffDB) Batch() (Batch, error) {
+	return &diffBatch{db: db}, nil
+}
+
+// Store keeps a copy of the state view: the diff is encoded relative to the last stored state, when committing.
+func (b *diffBatch) Store(ctx context.Context, state common.BeaconState) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	state, err := state.CopyState()
+	if err != nil {
+		return err
+	}
+	b.ops = append(b.ops, diffOp{state: state})
+	return nil
+}
+
+func (b *diffBatch) Remove(root common.Root) error {
+	b.ops = append(b.ops, diffOp{root: root})
+	return nil
+}
+
+func (b *diffBatch) Commit() error {
+	db := b.db
+	db.Lock()
+	defer db.Unlock()
+	// removals replace the entries of the re-encoded states, the previous entries are unchanged.
+	prev := make(map[common.Root]*diffState, len(db.states))
+	for root, s := range db.states {
+		prev[root] = s
+	}
+	prevTipRoot, prevTipNode := db.tipRoot, db.tipNode
+	for _, op := range b.ops {
+		var err error
+		if op.state == nil {
+			_, err = db.remove(op.root)
+		} else {
+			_, err = db.store(context.Background(), op.state)
+		}
+		if err != nil {
+			db.states, db.tipRoot, db.tipNode = prev, prevTipRoot, prevTipNode
+			return fmt.Errorf("failed to commit batch: %v", err)
+		}
+	}
+	b.ops = nil
+	return nil
+}
+
+func (b *diffBatch) Discard() {
+	b.ops = nil
+}
+
+type fileOp struct {
+	root   common.Root
+	staged string // empty for removals
+	info   StateInfo
+}
+
+// fileBatch writes the states to a staging directory in the DB directory,
+// and moves them into place when committing, with a single sync of the DB directory.
+type fileBatch struct {
+	db      *FileDB
+	staging string
+	ops     []fileOp
+}
+
+func (db *FileDB) Batch() (Batch, error) {
+	staging, err := ioutil.TempDir(db.dir, "tmp-batch-")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create staging dir: %v", err)
+	}
+	return &fileBatch{db: db, staging: staging}, nil
+}
+
+func (b *fileBatch) Store(ctx context.Context, state common.BeaconState) error {
+	root := state.HashTreeRoot(tree.GetHashFn())
+	slot, err := state.Slot()
+	if err != nil {
+		return err
+	}
+	data, err := encodeState(state)
+	if err != nil {
+		return err
+	}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	staged := filepath.Join(b.staging, fmt.Sprintf("%d-%s", len(b.ops), hex.EncodeToString(root[:])))
+	f, err := os.Create(staged)
+	if err != nil {
+		return err
+	}
+	if err := writeStateFile(f, slot, data, b.db.codec); err != nil {
+		f.Close()
+		return fmt.Errorf("failed to write state %s: %v", root, err)
+	}
+	stat, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	fork, err := state.Fork()
+	if err != nil {
+		return err
+	}
+	info := StateInfo{Root: root, Slot: slot, ForkVersion: fork.CurrentVersion, Size: uint64(stat.Size())}
+	b.ops = append(b.ops, fileOp{root: root, staged: staged, info: info})
+	return nil
+}
+
+func (b *fileBatch) Remove(root common.Root) error {
+	b.ops = append(b.ops, fileOp{root: root})
+	return nil
+}
+
+func (b *fileBatch) Commit() error {
+	defer b.Discard()
+	for _, op := range b.ops {
+		if op.staged != "" {
+			if err := syncPath(op.staged); err != nil {
+				return fmt.Errorf("failed to sync staged state %s: %v", op.root, err)
+			}
+		}
+	}
+	// undo reverts the applied operations, in reverse order, if an operation fails.
+	var undo []func() error
+	var applied []fileOp
+	rollback := func(err error) error {
+		for i := len(undo) - 1; i >= 0; i-- {
+			if uerr := undo[i](); uerr != nil {
+				return fmt.Errorf("failed to commit batch: %v, and failed to roll back: %v", err, uerr)
+			}
+		}
+		return fmt.Errorf("failed to commit batch: %v", err)
+	}
+	for i, op := range b.ops {
+		path := b.db.path(op.root)
+		exists, err := b.db.exists(op.root)
+		if err != nil {
+			return rollback(err)
+		}
+		if op.staged != "" {
+			if exists {
+				continue
+			}
+			if err := os.Rename(op.staged, path); err != nil {
+				return rollback(err)
+			}
+			undo = append(undo, func() error { return os.Remove(path) })
+			applied = append(applied, op)
+		} else {
+			if !exists {
+				continue
+			}
+			// keep the removed file in the staging dir until the batch is done
+			backup := filepath.Join(b.staging, fmt.Sprintf("%d-removed", i))
+			if err := os.Rename(path, backup); err != nil {
+				return rollback(err)
+			}
+			undo = append(undo, func() error { return os.Rename(backup, path) })
+			applied = append(applied, op)
+		}
+	}
+	if err := syncPath(b.db.dir); err != nil {
+		return rollback(err)
+	}
+	b.db.Lock()
+	defer b.db.Unlock()
+	for _, op := range applied {
+		if op.staged != "" {
+			b.db.index[op.root] = op.info
+		} else {
+			delete(b.db.index, op.root)
+		}
+	}
+	// the states are committed: a failure to write the index is recovered from when the DB is opened again
+	return b.db.writeIndex()
+}
+
+func (b *fileBatch) Discard() {
+	b.ops = nil
+	os.RemoveAll(b.staging)
+}
+
+func syncPath(path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	return f.Sync()
+}
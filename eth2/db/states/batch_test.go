@@ -0,0 +1,130 @@
+package states
+
+import (
+	"context"
+	"os"
+	"testing"
+
+	"github.com/protolambda/ztyp/tree"
+
+	"github.com/protolambda/zrnt/eth2/beacon/common"
+	"github.com/protolambda/zrnt/eth2/beacon/testutil"
+	"github.com/protolambda/zrnt/eth2/configs"
+)
+
+func testBatch(t *testing.T, db DB, states []common.BeaconState) {
+	ctx := context.Background()
+	a, b := states[0], states[1]
+	rootA, rootB := a.HashTreeRoot(tree.GetHashFn()), b.HashTreeRoot(tree.GetHashFn())
+	if _, err := db.Store(ctx, a); err != nil {
+		t.Fatal(err)
+	}
+	// a discarded batch has no effect
+	batch, err := db.Batch()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := batch.Store(ctx, b); err != nil {
+		t.Fatal(err)
+	}
+	if err := batch.Remove(rootA); err != nil {
+		t.Fatal(err)
+	}
+	batch.Discard()
+	if list, err := db.List(); err != nil || len(list) != 1 || list[0].Root != rootA {
+		t.Fatalf("unexpected list after discard: %v, err: %v", list, err)
+	}
+
+	batch, err = db.Batch()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := batch.Store(ctx, b); err != nil {
+		t.Fatal(err)
+	}
+	if err := batch.Remove(rootA); err != nil {
+		t.Fatal(err)
+	}
+	if list, err := db.List(); err != nil || len(list) != 1 || list[0].Root != rootA {
+		t.Fatalf("expected no changes before commit, got list: %v, err: %v", list, err)
+	}
+	if err := batch.Commit(); err != nil {
+		t.Fatal(err)
+	}
+	if list, err := db.List(); err != nil || len(list) != 1 || list[0].Root != rootB {
+		t.Fatalf("unexpected list after commit: %v, err: %v", list, err)
+	}
+	if state, exists, err := db.Get(ctx, rootB); err != nil || !exists || state.HashTreeRoot(tree.GetHashFn()) != rootB {
+		t.Fatalf("failed to get committed state, exists: %v, err: %v", exists, err)
+	}
+}
+
+func TestBatch(t *testing.T) {
+	spec := configs.Minimal
+	states := testStates(t, spec)
+	testBatch(t, NewMemDB(spec), states)
+	testBatch(t, NewDiffDB(spec, DiffOptions{SnapshotEpochs: 2, MaxDepth: 4}), states)
+	db, err := NewFileDB(spec, t.TempDir(), CodecSnappy)
+	if err != nil {
+		t.Fatal(err)
+	}
+	testBatch(t, db, states)
+}
+
+func TestFileDBBatchFailure(t *testing.T) {
+	spec := configs.Minimal
+	ctx := context.Background()
+	states := testStates(t, spec)
+	rootA, rootB := states[0].HashTreeRoot(tree.GetHashFn()), states[1].HashTreeRoot(tree.GetHashFn())
+	removed, _, err := testutil.GenerateTestState(spec, 64, testutil.StateOptions{Slot: 17, Participation: 100})
+	if err != nil {
+		t.Fatal(err)
+	}
+	rootRemoved := removed.HashTreeRoot(tree.GetHashFn())
+	db, err := NewFileDB(spec, t.TempDir(), CodecNone)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.Store(ctx, removed); err != nil {
+		t.Fatal(err)
+	}
+	b, err := db.Batch()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := b.Store(ctx, states[0]); err != nil {
+		t.Fatal(err)
+	}
+	if err := b.Remove(rootRemoved); err != nil {
+		t.Fatal(err)
+	}
+	if err := b.Store(ctx, states[1]); err != nil {
+		t.Fatal(err)
+	}
+	// lose the last staged file, to fail the commit after the first two operations are applied
+	fb := b.(*fileBatch)
+	if err := os.Remove(fb.ops[2].staged); err != nil {
+		t.Fatal(err)
+	}
+	if err := b.Commit(); err == nil {
+		t.Fatal("expected commit to fail")
+	}
+	list, err := db.List()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(list) != 1 || list[0].Root != rootRemoved {
+		t.Fatalf("expected the DB to be unchanged, got %v", list)
+	}
+	for _, root := range []common.Root{rootA, rootB} {
+		if _, exists, err := db.Get(ctx, root); err != nil || exists {
+			t.Fatalf("expected state %s to not exist, err: %v", root, err)
+		}
+	}
+	if _, exists, err := db.Get(ctx, rootRemoved); err != nil || !exists {
+		t.Fatalf("expected the removed state to be restored, exists: %v, err: %v", exists, err)
+	}
+	if _, err := os.Stat(fb.staging); !os.IsNotExist(err) {
+		t.Fatalf("expected the staging dir to be removed, got %v", err)
+	}
+}
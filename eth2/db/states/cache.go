@@ -0,0 +1,208 @@
+package states
+
+import (
+	"container/list"
+	"context"
+	"sync"
+
+	"github.com/protolambda/ztyp/tree"
+
+	"github.com/protolambda/zrnt/eth2/beacon/common"
+)
+
+type cachedState struct {
+	root  common.Root
+	slot  common.Slot
+	state common.BeaconState
+}
+
+// CachedDB keeps the most recently used states of the inner DB in memory, as decoded state views.
+// The least recently used state is evicted when the cache is full.
+type CachedDB struct {
+	sync.Mutex
+	inner     DB
+	maxStates int
+	entries   map[common.Root]*list.Element
+	// least recently used at the back
+	lru *list.List
+	// removals counts the invalidations, to not cache a state that was removed while it was read from the inner DB.
+	removals uint64
+
+	hits   uint64
+	misses uint64
+}
+
+var _ DB = (*CachedDB)(nil)
+
+func NewCachedDB(inner DB, maxStates int) *CachedDB {
+	if maxStates < 1 {
+		maxStates = 1
+	}
+	return &CachedDB{
+		inner:     inner,
+		maxStates: maxStates,
+		entries:   make(map[common.Root]*list.Element, maxStates),
+		lru:       list.New(),
+	}
+}
+
+// add caches a copy of the state, evicting the least recently used state if the cache is full. The cache must be locked.
+func (db *CachedDB) add(root common.Root, state common.BeaconState) error {
+	if elem, ok := db.entries[root]; ok {
+		db.lru.MoveToFront(elem)
+		return nil
+	}
+	slot, err := state.Slot()
+	if err != nil {
+		return err
+	}
+	state, err = state.CopyState()
+	if err != nil {
+		return err
+	}
+	// the copies share the tree of the cached state: hash it once, so readers do not write the cached roots concurrently
+	state.HashTreeRoot(tree.GetHashFn())
+	if db.lru.Len() >= db.maxStates {
+		last := db.lru.Back()
+		db.lru.Remove(last)
+		delete(db.entries, last.Value.(*cachedState).root)
+	}
+	db.entries[root] = db.lru.PushFront(&cachedState{root: root, slot: slot, state: state})
+	return nil
+}
+
+// invalidate drops the cached state. The cache must be locked.
+func (db *CachedDB) invalidate(root common.Root) {
+	if elem, ok := db.entries[root]; ok {
+		db.lru.Remove(elem)
+		delete(db.entries, root)
+	}
+	db.removals++
+}
+
+// Store stores the state in the inner DB, and caches it.
+func (db *CachedDB) Store(ctx context.Context, state common.BeaconState) (exists bool, err error) {
+	db.Lock()
+	removals := db.removals
+	db.Unlock()
+	exists, err = db.inner.Store(ctx, state)
+	if err != nil {
+		return exists, err
+	}
+	db.Lock()
+	defer db.Unlock()
+	if db.removals != removals {
+		return exists, nil
+	}
+	return exists, db.add(state.HashTreeRoot(tree.GetHashFn()), state)
+}
+
+// Get returns a copy of the cached state, or reads it from the inner DB and caches it.
+func (db *CachedDB) Get(ctx context.Context, root common.Root) (state common.BeaconState, exists bool, err error) {
+	db.Lock()
+	if elem, ok := db.entries[root]; ok {
+		db.hits++
+		db.lru.MoveToFront(elem)
+		state := elem.Value.(*cachedState).state
+		db.Unlock()
+		state, err := state.CopyState()
+		return state, true, err
+	}
+	db.misses++
+	removals := db.removals
+	db.Unlock()
+
+	state, exists, err = db.inner.Get(ctx, root)
+	if err != nil || !exists {
+		return state, exists, err
+	}
+	db.Lock()
+	defer db.Unlock()
+	if db.removals == removals {
+		if err := db.add(root, state); err != nil {
+			return nil, true, err
+		}
+	}
+	return state, true, nil
+}
+
+// Remove removes the state from the inner DB, then from the cache:
+// a concurrent read of the inner DB that started before the removal does not cache the state again.
+func (db *CachedDB) Remove(root common.Root) (exists bool, err error) {
+	exists, err = db.inner.Remove(root)
+	db.Lock()
+	db.invalidate(root)
+	db.Unlock()
+	return exists, err
+}
+
+func (db *CachedDB) List() ([]StateInfo, error) {
+	return db.inner.List()
+}
+
+func (db *CachedDB) PruneBelow(slot common.Slot, keep KeepFn) (removed int, err error) {
+	removed, err = db.inner.PruneBelow(slot, keep)
+	db.Lock()
+	defer db.Unlock()
+	for root, elem := range db.entries {
+		if s := elem.Value.(*cachedState).slot; s < slot && (keep == nil || !keep(s)) {
+			db.invalidate(root)
+		}
+	}
+	// states of the inner DB that are not cached may be read concurrently
+	db.removals++
+	return removed, err
+}
+
+func (db *CachedDB) Batch() (Batch, error) {
+	b, err := db.inner.Batch()
+	if err != nil {
+		return nil, err
+	}
+	return &cachedBatch{Batch: b, db: db}, nil
+}
+
+// cachedBatch invalidates the cached states that the batch removes, after committing.
+type cachedBatch struct {
+	Batch
+	db      *CachedDB
+	removed []common.Root
+}
+
+func (b *cachedBatch) Remove(root common.Root) error {
+	if err := b.Batch.Remove(root); err != nil {
+		return err
+	}
+	b.removed = append(b.removed, root)
+	return nil
+}
+
+func (b *cachedBatch) Commit() error {
+	err := b.Batch.Commit()
+	b.db.Lock()
+	for _, root := range b.removed {
+		b.db.invalidate(root)
+	}
+	b.db.Unlock()
+	b.removed = nil
+	return err
+}
+
+func (b *cachedBatch) Discard() {
+	b.Batch.Discard()
+	b.removed = nil
+}
+
+// Len returns the number of cached states.
+func (db *CachedDB) Len() int {
+	db.Lock()
+	defer db.Unlock()
+	return db.lru.Len()
+}
+
+// Stats returns the number of cache hits and misses so far.
+func (db *CachedDB) Stats() (hits uint64, misses uint64) {
+	db.Lock()
+	defer db.Unlock()
+	return db.hits, db.misses
+}
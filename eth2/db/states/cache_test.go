@@ -0,0 +1,127 @@
+package states
+
+import (
+	"context"
+	"sync"
+	"testing"
+
+	"github.com/protolambda/ztyp/tree"
+
+	"github.com/protolambda/zrnt/eth2/beacon/common"
+	"github.com/protolambda/zrnt/eth2/beacon/testutil"
+	"github.com/protolambda/zrnt/eth2/configs"
+)
+
+func TestCachedDB(t *testing.T) {
+	spec := configs.Minimal
+	states := testStates(t, spec)
+	testDB(t, NewCachedDB(NewMemDB(spec), 1), states)
+	testPrune(t, NewCachedDB(NewMemDB(spec), 2), spec)
+	testBatch(t, NewCachedDB(NewMemDB(spec), 2), states)
+}
+
+func TestCachedDBEviction(t *testing.T) {
+	spec := configs.Minimal
+	ctx := context.Background()
+	inner := NewMemDB(spec)
+	var roots []common.Root
+	for _, slot := range []common.Slot{3, 9, 17} {
+		state, _, err := testutil.GenerateTestState(spec, 64, testutil.StateOptions{Slot: slot, Participation: 100})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := inner.Store(ctx, state); err != nil {
+			t.Fatal(err)
+		}
+		roots = append(roots, state.HashTreeRoot(tree.GetHashFn()))
+	}
+	a, b, c := roots[0], roots[1], roots[2]
+	db := NewCachedDB(inner, 2)
+	get := func(root common.Root) common.BeaconState {
+		state, exists, err := db.Get(ctx, root)
+		if err != nil || !exists {
+			t.Fatalf("failed to get state %s, exists: %v, err: %v", root, exists, err)
+		}
+		return state
+	}
+	expectStats := func(hits, misses uint64) {
+		if h, m := db.Stats(); h != hits || m != misses {
+			t.Fatalf("expected %d hits and %d misses, got %d and %d", hits, misses, h, m)
+		}
+	}
+	get(a)
+	get(b)
+	expectStats(0, 2)
+	// a becomes the most recently used, b is evicted for c
+	get(a)
+	get(c)
+	expectStats(1, 3)
+	get(a)
+	expectStats(2, 3)
+	get(b)
+	expectStats(2, 4)
+	if db.Len() != 2 {
+		t.Fatalf("expected 2 cached states, got %d", db.Len())
+	}
+
+	// changes to a returned state do not change the cached state
+	if err := get(b).SetSlot(100); err != nil {
+		t.Fatal(err)
+	}
+	if get(b).HashTreeRoot(tree.GetHashFn()) != b {
+		t.Fatal("cached state changed")
+	}
+
+	if exists, err := db.Remove(b); err != nil || !exists {
+		t.Fatalf("failed to remove state, exists: %v, err: %v", exists, err)
+	}
+	if _, exists, err := db.Get(ctx, b); err != nil || exists {
+		t.Fatalf("expected removed state to not exist, err: %v", err)
+	}
+}
+
+func TestCachedDBConcurrent(t *testing.T) {
+	spec := configs.Minimal
+	ctx := context.Background()
+	states := testStates(t, spec)
+	db := NewCachedDB(NewMemDB(spec), 1)
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			state := states[i%len(states)]
+			root := state.HashTreeRoot(tree.GetHashFn())
+			for j := 0; j < 20; j++ {
+				if _, err := db.Store(ctx, state); err != nil {
+					t.Error(err)
+					return
+				}
+				if got, exists, err := db.Get(ctx, root); err != nil {
+					t.Error(err)
+					return
+				} else if exists && got.HashTreeRoot(tree.GetHashFn()) != root {
+					t.Error("got different state")
+					return
+				}
+				if j%5 == 0 {
+					if _, err := db.Remove(root); err != nil {
+						t.Error(err)
+						return
+					}
+				}
+			}
+		}(i)
+	}
+	wg.Wait()
+	// a removed state is never served from the cache
+	for _, state := range states {
+		root := state.HashTreeRoot(tree.GetHashFn())
+		if _, err := db.Remove(root); err != nil {
+			t.Fatal(err)
+		}
+		if _, exists, err := db.Get(ctx, root); err != nil || exists {
+			t.Fatalf("expected removed state to not exist, err: %v", err)
+		}
+	}
+}
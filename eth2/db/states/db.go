@@ -0,0 +1,184 @@
+// Package states stores beacon states by state root.
+package states
+
+import (
+	"bytes"
+	"context"
+	"sort"
+	"sync"
+
+	"github.com/protolambda/ztyp/codec"
+	"github.com/protolambda/ztyp/tree"
+
+	"github.com/protolambda/zrnt/eth2/beacon/common"
+	"github.com/protolambda/zrnt/eth2/beacon/transition"
+)
+
+// DB stores beacon states of any fork, by state root. Implementations are safe for concurrent use.
+type DB interface {
+	// Store the state, by its state root. Exists is true if the state was already stored.
+	Store(ctx context.Context, state common.BeaconState) (exists bool, err error)
+	// Get the state with the given state root. Every call returns a new state view.
+	Get(ctx context.Context, root common.Root) (state common.BeaconState, exists bool, err error)
+	// Remove the state with the given state root. Exists is true if the state was stored.
+	Remove(root common.Root) (exists bool, err error)
+	// List the stored states, ordered by slot, then by root.
+	List() ([]StateInfo, error)
+	// PruneBelow removes the states before the slot, except those to keep, if keep is not nil.
+	PruneBelow(slot common.Slot, keep KeepFn) (removed int, err error)
+	// Batch starts a batch of operations, to commit at once.
+	Batch() (Batch, error)
+}
+
+// StateInfo describes a stored state.
+type StateInfo struct {
+	Root        common.Root
+	Slot        common.Slot
+	ForkVersion common.Version
+	// Size is the number of bytes used to store the state. Compressed states and diffs are smaller than the encoded state.
+	Size uint64
+}
+
+// Oldest returns the stored state with the lowest slot, if any.
+func Oldest(db DB) (info StateInfo, ok bool, err error) {
+	infos, err := db.List()
+	if err != nil || len(infos) == 0 {
+		return StateInfo{}, false, err
+	}
+	return infos[0], true, nil
+}
+
+// Newest returns the stored state with the highest slot, if any.
+func Newest(db DB) (info StateInfo, ok bool, err error) {
+	infos, err := db.List()
+	if err != nil || len(infos) == 0 {
+		return StateInfo{}, false, err
+	}
+	return infos[len(infos)-1], true, nil
+}
+
+func sortInfos(infos []StateInfo) {
+	sort.Slice(infos, func(i, j int) bool {
+		if infos[i].Slot != infos[j].Slot {
+			return infos[i].Slot < infos[j].Slot
+		}
+		return bytes.Compare(infos[i].Root[:], infos[j].Root[:]) < 0
+	})
+}
+
+// KeepFn decides to keep a state of the given slot when pruning.
+type KeepFn func(slot common.Slot) bool
+
+// ArchiveEvery keeps the states at the start of every n-th epoch, as archive points to regenerate other states from.
+func ArchiveEvery(spec *common.Spec, epochs common.Epoch) KeepFn {
+	return func(slot common.Slot) bool {
+		return slot%spec.SLOTS_PER_EPOCH == 0 && spec.SlotToEpoch(slot)%epochs == 0
+	}
+}
+
+func encodeState(state common.BeaconState) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := state.Serialize(codec.NewEncodingWriter(&buf)); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+type memState struct {
+	slot    common.Slot
+	version common.Version
+	data    []byte
+}
+
+// MemDB keeps the encoded states in memory.
+type MemDB struct {
+	sync.RWMutex
+	spec   *common.Spec
+	states map[common.Root]memState
+}
+
+var _ DB = (*MemDB)(nil)
+
+func NewMemDB(spec *common.Spec) *MemDB {
+	return &MemDB{spec: spec, states: make(map[common.Root]memState)}
+}
+
+func newMemState(state common.BeaconState) (memState, error) {
+	slot, err := state.Slot()
+	if err != nil {
+		return memState{}, err
+	}
+	fork, err := state.Fork()
+	if err != nil {
+		return memState{}, err
+	}
+	data, err := encodeState(state)
+	if err != nil {
+		return memState{}, err
+	}
+	return memState{slot: slot, version: fork.CurrentVersion, data: data}, nil
+}
+
+func (db *MemDB) Store(ctx context.Context, state common.BeaconState) (exists bool, err error) {
+	root := state.HashTreeRoot(tree.GetHashFn())
+	db.RLock()
+	_, exists = db.states[root]
+	db.RUnlock()
+	if exists {
+		return true, nil
+	}
+	s, err := newMemState(state)
+	if err != nil {
+		return false, err
+	}
+	db.Lock()
+	defer db.Unlock()
+	_, exists = db.states[root]
+	db.states[root] = s
+	return exists, nil
+}
+
+func (db *MemDB) Get(ctx context.Context, root common.Root) (state common.BeaconState, exists bool, err error) {
+	db.RLock()
+	s, exists := db.states[root]
+	db.RUnlock()
+	if !exists {
+		return nil, false, nil
+	}
+	state, _, err = transition.DecodeState(db.spec, s.data)
+	if err != nil {
+		return nil, true, err
+	}
+	return state, true, nil
+}
+
+func (db *MemDB) Remove(root common.Root) (exists bool, err error) {
+	db.Lock()
+	defer db.Unlock()
+	_, exists = db.states[root]
+	delete(db.states, root)
+	return exists, nil
+}
+
+func (db *MemDB) List() ([]StateInfo, error) {
+	db.RLock()
+	out := make([]StateInfo, 0, len(db.states))
+	for root, s := range db.states {
+		out = append(out, StateInfo{Root: root, Slot: s.slot, ForkVersion: s.version, Size: uint64(len(s.data))})
+	}
+	db.RUnlock()
+	sortInfos(out)
+	return out, nil
+}
+
+func (db *MemDB) PruneBelow(slot common.Slot, keep KeepFn) (removed int, err error) {
+	db.Lock()
+	defer db.Unlock()
+	for root, s := range db.states {
+		if s.slot < slot && (keep == nil || !keep(s.slot)) {
+			delete(db.states, root)
+			removed++
+		}
+	}
+	return removed, nil
+}
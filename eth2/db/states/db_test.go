@@ -0,0 +1,554 @@
+package states
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"runtime"
+	"strings"
+	"testing"
+
+	"github.com/protolambda/ztyp/tree"
+
+	"github.com/protolambda/zrnt/eth2/beacon/common"
+	"github.com/protolambda/zrnt/eth2/beacon/testutil"
+	"github.com/protolambda/zrnt/eth2/configs"
+)
+
+func testStates(t testing.TB, spec *common.Spec) []common.BeaconState {
+	var out []common.BeaconState
+	for _, slot := range []common.Slot{3, 9} {
+		state, _, err := testutil.GenerateTestState(spec, 64, testutil.StateOptions{Slot: slot, Participation: 100})
+		if err != nil {
+			t.Fatal(err)
+		}
+		out = append(out, state)
+	}
+	return out
+}
+
+func testDB(t *testing.T, db DB, states []common.BeaconState) {
+	ctx := context.Background()
+	var roots []common.Root
+	for _, state := range states {
+		if exists, err := db.Store(ctx, state); err != nil || exists {
+			t.Fatalf("failed to store state, exists: %v, err: %v", exists, err)
+		}
+		if exists, err := db.Store(ctx, state); err != nil || !exists {
+			t.Fatalf("expected state to exist, err: %v", err)
+		}
+		roots = append(roots, state.HashTreeRoot(tree.GetHashFn()))
+	}
+	for _, root := range roots {
+		state, exists, err := db.Get(ctx, root)
+		if err != nil || !exists {
+			t.Fatalf("failed to get state %s, exists: %v, err: %v", root, exists, err)
+		}
+		if state.HashTreeRoot(tree.GetHashFn()) != root {
+			t.Fatalf("got different state for %s", root)
+		}
+	}
+	list, err := db.List()
+	if err != nil {
+		t.Fatal(err)
+	}
+	// listed by slot
+	if len(list) != 2 || list[0].Root != roots[0] || list[1].Root != roots[1] {
+		t.Fatalf("unexpected list: %v", list)
+	}
+	for i, info := range list {
+		slot, err := states[i].Slot()
+		if err != nil {
+			t.Fatal(err)
+		}
+		fork, err := states[i].Fork()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if info.Slot != slot || info.ForkVersion != fork.CurrentVersion || info.Size == 0 {
+			t.Fatalf("unexpected info of state %d: %v", i, info)
+		}
+	}
+	if oldest, ok, err := Oldest(db); err != nil || !ok || oldest.Root != roots[0] {
+		t.Fatalf("unexpected oldest state %v, ok: %v, err: %v", oldest, ok, err)
+	}
+	if newest, ok, err := Newest(db); err != nil || !ok || newest.Root != roots[1] {
+		t.Fatalf("unexpected newest state %v, ok: %v, err: %v", newest, ok, err)
+	}
+	if exists, err := db.Remove(roots[0]); err != nil || !exists {
+		t.Fatalf("failed to remove state, exists: %v, err: %v", exists, err)
+	}
+	if exists, err := db.Remove(roots[0]); err != nil || exists {
+		t.Fatalf("expected removed state to not exist, err: %v", err)
+	}
+	if _, exists, err := db.Get(ctx, roots[0]); err != nil || exists {
+		t.Fatalf("expected removed state to not exist, err: %v", err)
+	}
+	if list, err := db.List(); err != nil || len(list) != 1 || list[0].Root != roots[1] {
+		t.Fatalf("unexpected list after removal: %v, err: %v", list, err)
+	}
+}
+
+func testPrune(t *testing.T, db DB, spec *common.Spec) {
+	ctx := context.Background()
+	roots := make(map[common.Slot]common.Root)
+	for _, slot := range []common.Slot{0, 8, 9, 16, 24} {
+		state, _, err := testutil.GenerateTestState(spec, 64, testutil.StateOptions{Slot: slot, Participation: 100})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := db.Store(ctx, state); err != nil {
+			t.Fatal(err)
+		}
+		roots[slot] = state.HashTreeRoot(tree.GetHashFn())
+	}
+	// minimal: 8 slots per epoch, the states of epoch 0 and 2 are archive points
+	if removed, err := db.PruneBelow(24, ArchiveEvery(spec, 2)); err != nil || removed != 2 {
+		t.Fatalf("unexpected prune result, removed: %d, err: %v", removed, err)
+	}
+	for slot, root := range roots {
+		_, exists, err := db.Get(ctx, root)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if expected := slot != 8 && slot != 9; exists != expected {
+			t.Fatalf("state of slot %d: expected exists %v", slot, expected)
+		}
+	}
+	if removed, err := db.PruneBelow(24, nil); err != nil || removed != 2 {
+		t.Fatalf("unexpected prune result, removed: %d, err: %v", removed, err)
+	}
+	if list, err := db.List(); err != nil || len(list) != 1 || list[0].Root != roots[24] {
+		t.Fatalf("unexpected list after pruning: %v, err: %v", list, err)
+	}
+}
+
+func TestMemDB(t *testing.T) {
+	spec := configs.Minimal
+	testDB(t, NewMemDB(spec), testStates(t, spec))
+	testPrune(t, NewMemDB(spec), spec)
+}
+
+func TestFileDB(t *testing.T) {
+	spec := configs.Minimal
+	states := testStates(t, spec)
+	for _, codec := range []Codec{CodecNone, CodecSnappy} {
+		db, err := NewFileDB(spec, t.TempDir(), codec)
+		if err != nil {
+			t.Fatal(err)
+		}
+		testDB(t, db, states)
+		db, err = NewFileDB(spec, t.TempDir(), codec)
+		if err != nil {
+			t.Fatal(err)
+		}
+		testPrune(t, db, spec)
+	}
+}
+
+func TestFileDBIndex(t *testing.T) {
+	spec := configs.Minimal
+	ctx := context.Background()
+	states := testStates(t, spec)
+	rootA, rootB := states[0].HashTreeRoot(tree.GetHashFn()), states[1].HashTreeRoot(tree.GetHashFn())
+	dir := t.TempDir()
+	db, err := NewFileDB(spec, dir, CodecSnappy)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.Store(ctx, states[0]); err != nil {
+		t.Fatal(err)
+	}
+	b, err := db.Batch()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := b.Store(ctx, states[1]); err != nil {
+		t.Fatal(err)
+	}
+	if err := b.Commit(); err != nil {
+		t.Fatal(err)
+	}
+	expected, err := db.List()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(expected) != 2 || expected[0].Root != rootA || expected[1].Root != rootB {
+		t.Fatalf("unexpected list: %v", expected)
+	}
+	expectList := func(name string, infos ...StateInfo) {
+		db, err := NewFileDB(spec, dir, CodecSnappy)
+		if err != nil {
+			t.Fatal(err)
+		}
+		list, err := db.List()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(list) != len(infos) {
+			t.Fatalf("%s: unexpected list %v", name, list)
+		}
+		for i := range infos {
+			if list[i] != infos[i] {
+				t.Fatalf("%s: expected %v, got %v", name, infos[i], list[i])
+			}
+		}
+	}
+	expectList("reopened", expected...)
+
+	// the index is recovered from the state files
+	indexPath := dir + "/" + indexFileName
+	if err := os.Remove(indexPath); err != nil {
+		t.Fatal(err)
+	}
+	expectList("missing index", expected...)
+	if err := os.WriteFile(indexPath, []byte{0xff}, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	expectList("invalid index", expected...)
+
+	// a stale index, e.g. after a crash between writing a state file and the index
+	stale, err := os.ReadFile(indexPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if exists, err := db.Remove(rootB); err != nil || !exists {
+		t.Fatalf("failed to remove state, exists: %v, err: %v", exists, err)
+	}
+	expectList("removed", expected[0])
+	if err := os.WriteFile(indexPath, stale, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	expectList("stale index with removed state", expected[0])
+	if err := os.WriteFile(indexPath, encodeIndex(nil), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	expectList("stale index with missing state", expected[0])
+}
+
+func TestFileDBPartialFile(t *testing.T) {
+	spec := configs.Minimal
+	state := testStates(t, spec)[1]
+	root := state.HashTreeRoot(tree.GetHashFn())
+	for _, codec := range []Codec{CodecNone, CodecSnappy} {
+		dir := t.TempDir()
+		db, err := NewFileDB(spec, dir, codec)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := db.Store(context.Background(), state); err != nil {
+			t.Fatal(err)
+		}
+		// a leftover temporary file of an interrupted write is not listed
+		if err := os.WriteFile(dir+"/tmp-state-123", []byte{1, 2, 3}, 0o644); err != nil {
+			t.Fatal(err)
+		}
+		if list, err := db.List(); err != nil || len(list) != 1 {
+			t.Fatalf("unexpected list: %v, err: %v", list, err)
+		}
+		// truncate the file, like a write without sync before a crash
+		path := db.path(root)
+		info, err := os.Stat(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := os.Truncate(path, info.Size()-100); err != nil {
+			t.Fatal(err)
+		}
+		if _, exists, err := db.Get(context.Background(), root); !exists || !errors.Is(err, ErrPartialFile) {
+			t.Fatalf("expected partial file error, got %v", err)
+		}
+	}
+}
+
+func TestFileDBMixedCodecs(t *testing.T) {
+	spec := configs.Minimal
+	ctx := context.Background()
+	states := testStates(t, spec)
+	dir := t.TempDir()
+	for i, codec := range []Codec{CodecNone, CodecSnappy} {
+		db, err := NewFileDB(spec, dir, codec)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := db.Store(ctx, states[i]); err != nil {
+			t.Fatal(err)
+		}
+	}
+	db, err := NewFileDB(spec, dir, CodecNone)
+	if err != nil {
+		t.Fatal(err)
+	}
+	raw, err := os.Stat(db.path(states[0].HashTreeRoot(tree.GetHashFn())))
+	if err != nil {
+		t.Fatal(err)
+	}
+	compressed, err := os.Stat(db.path(states[1].HashTreeRoot(tree.GetHashFn())))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if compressed.Size() >= raw.Size() {
+		t.Fatalf("expected the snappy file to be smaller: %d >= %d", compressed.Size(), raw.Size())
+	}
+	for _, state := range states {
+		root := state.HashTreeRoot(tree.GetHashFn())
+		got, exists, err := db.Get(ctx, root)
+		if err != nil || !exists || got.HashTreeRoot(tree.GetHashFn()) != root {
+			t.Fatalf("failed to get state %s, exists: %v, err: %v", root, exists, err)
+		}
+	}
+}
+
+func TestFileDBCorruptFile(t *testing.T) {
+	spec := configs.Minimal
+	ctx := context.Background()
+	state := testStates(t, spec)[1]
+	root := state.HashTreeRoot(tree.GetHashFn())
+	corrupt := func(name string, codec Codec, fn func(data []byte)) {
+		db, err := NewFileDB(spec, t.TempDir(), codec)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := db.Store(ctx, state); err != nil {
+			t.Fatal(err)
+		}
+		data, err := os.ReadFile(db.path(root))
+		if err != nil {
+			t.Fatal(err)
+		}
+		fn(data)
+		if err := os.WriteFile(db.path(root), data, 0o644); err != nil {
+			t.Fatal(err)
+		}
+		if _, exists, err := db.Get(ctx, root); !exists || !errors.Is(err, ErrCorruptFile) {
+			t.Fatalf("%s: expected corrupt file error, got %v", name, err)
+		}
+	}
+	corrupt("unknown version", CodecNone, func(data []byte) { data[0] = 2 })
+	corrupt("unknown codec", CodecNone, func(data []byte) { data[1] = 7 })
+	// the checksum of the snappy frame does not match
+	corrupt("frame data", CodecSnappy, func(data []byte) { data[len(data)/2] ^= 0xff })
+	// the chunk type of the first frame after the stream identifier is unknown
+	corrupt("frame header", CodecSnappy, func(data []byte) { data[stateFileHeaderSize+10] = 0x10 })
+	// a raw file marked as snappy-framed
+	corrupt("codec mismatch", CodecNone, func(data []byte) { data[1] = byte(CodecSnappy) })
+}
+
+func TestFileDBVerify(t *testing.T) {
+	spec := configs.Minimal
+	ctx := context.Background()
+	states := testStates(t, spec)
+	rootA, rootB := states[0].HashTreeRoot(tree.GetHashFn()), states[1].HashTreeRoot(tree.GetHashFn())
+	db, err := NewFileDB(spec, t.TempDir(), CodecSnappy)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, state := range states {
+		if _, err := db.Store(ctx, state); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if invalid, err := db.Verify(ctx); err != nil || len(invalid) != 0 {
+		t.Fatalf("unexpected invalid states: %v, err: %v", invalid, err)
+	}
+	// a valid file with the wrong state
+	data, err := os.ReadFile(db.path(rootB))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(db.path(rootA), data, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if invalid, err := db.Verify(ctx); err != nil || len(invalid) != 1 || invalid[0] != rootA {
+		t.Fatalf("expected state A to be invalid, got %v, err: %v", invalid, err)
+	}
+	if _, _, err := db.Get(ctx, rootA); err != nil {
+		t.Fatalf("expected no verification on read by default, got %v", err)
+	}
+	db.VerifyOnRead = true
+	if _, exists, err := db.Get(ctx, rootA); !exists || !errors.Is(err, ErrRootMismatch) {
+		t.Fatalf("expected root mismatch, got %v", err)
+	}
+	if _, _, err := db.Get(ctx, rootB); err != nil {
+		t.Fatal(err)
+	}
+	// an unreadable file is invalid too
+	if err := os.Truncate(db.path(rootB), 100); err != nil {
+		t.Fatal(err)
+	}
+	invalid, err := db.Verify(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// ordered by slot
+	if len(invalid) != 2 || invalid[0] != rootA || invalid[1] != rootB {
+		t.Fatalf("expected both states to be invalid, got %v", invalid)
+	}
+	cancelled, cancel := context.WithCancel(ctx)
+	cancel()
+	if _, err := db.Verify(cancelled); !errors.Is(err, context.Canceled) {
+		t.Fatalf("expected cancellation, got %v", err)
+	}
+}
+
+func TestFileDBMapFiles(t *testing.T) {
+	spec := configs.Minimal
+	ctx := context.Background()
+	states := testStates(t, spec)
+	for _, codec := range []Codec{CodecNone, CodecSnappy} {
+		db, err := NewFileDB(spec, t.TempDir(), codec)
+		if err != nil {
+			t.Fatal(err)
+		}
+		db.MapFiles = true
+		testDB(t, db, states)
+	}
+	db, err := NewFileDB(spec, t.TempDir(), CodecNone)
+	if err != nil {
+		t.Fatal(err)
+	}
+	db.MapFiles = true
+	for _, state := range states {
+		if _, err := db.Store(ctx, state); err != nil {
+			t.Fatal(err)
+		}
+	}
+	rootA, rootB := states[0].HashTreeRoot(tree.GetHashFn()), states[1].HashTreeRoot(tree.GetHashFn())
+	// the mapped bytes are verified like the bytes read into memory
+	data, err := os.ReadFile(db.path(rootB))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(db.path(rootA), data, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if invalid, err := db.Verify(ctx); err != nil || len(invalid) != 1 || invalid[0] != rootA {
+		t.Fatalf("expected state A to be invalid, got %v, err: %v", invalid, err)
+	}
+	db.VerifyOnRead = true
+	if _, exists, err := db.Get(ctx, rootA); !exists || !errors.Is(err, ErrRootMismatch) {
+		t.Fatalf("expected root mismatch, got %v", err)
+	}
+	// trailing data, a truncated file and a file shorter than the header are all partial
+	if err := os.WriteFile(db.path(rootA), append(data, 0), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if _, exists, err := db.Get(ctx, rootA); !exists || !errors.Is(err, ErrPartialFile) {
+		t.Fatalf("expected partial file error for trailing data, got %v", err)
+	}
+	for _, size := range []int64{int64(len(data)) - 100, stateFileHeaderSize - 1, 0} {
+		if err := os.Truncate(db.path(rootB), size); err != nil {
+			t.Fatal(err)
+		}
+		if _, exists, err := db.Get(ctx, rootB); !exists || !errors.Is(err, ErrPartialFile) {
+			t.Fatalf("expected partial file error for size %d, got %v", size, err)
+		}
+	}
+	data[0] = 2
+	if err := os.WriteFile(db.path(rootB), data, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if _, exists, err := db.Get(ctx, rootB); !exists || !errors.Is(err, ErrCorruptFile) {
+		t.Fatalf("expected corrupt file error, got %v", err)
+	}
+}
+
+func BenchmarkFileDB(b *testing.B) {
+	spec := configs.Mainnet
+	state, _, err := testutil.GenerateTestState(spec, 4096, testutil.StateOptions{})
+	if err != nil {
+		b.Fatal(err)
+	}
+	root := state.HashTreeRoot(tree.GetHashFn())
+	ctx := context.Background()
+	for _, codec := range []Codec{CodecNone, CodecSnappy} {
+		db, err := NewFileDB(spec, b.TempDir(), codec)
+		if err != nil {
+			b.Fatal(err)
+		}
+		b.Run(codec.String()+"/store", func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				if _, err := db.Remove(root); err != nil {
+					b.Fatal(err)
+				}
+				if _, err := db.Store(ctx, state); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+		b.Run(codec.String()+"/load", func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				if _, _, err := db.Get(ctx, root); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+// The load latency and memory use of decoding a state file from a memory mapping, versus reading it into memory first.
+// The allocated bytes of the read path include the encoded state. The growth of the peak RSS of the process
+// is reported where the platform exposes it, i.e. Linux.
+func BenchmarkFileDBMapFiles(b *testing.B) {
+	spec := configs.Mainnet
+	state, _, err := testutil.GenerateTestState(spec, 16384, testutil.StateOptions{})
+	if err != nil {
+		b.Fatal(err)
+	}
+	root := state.HashTreeRoot(tree.GetHashFn())
+	db, err := NewFileDB(spec, b.TempDir(), CodecNone)
+	if err != nil {
+		b.Fatal(err)
+	}
+	if _, err := db.Store(context.Background(), state); err != nil {
+		b.Fatal(err)
+	}
+	for _, mapped := range []bool{false, true} {
+		name := "read"
+		if mapped {
+			name = "mapped"
+		}
+		b.Run(name, func(b *testing.B) {
+			db.MapFiles = mapped
+			runtime.GC()
+			start, ok := resetPeakRSS()
+			b.ReportAllocs()
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				if _, _, err := db.Get(context.Background(), root); err != nil {
+					b.Fatal(err)
+				}
+			}
+			b.StopTimer()
+			if peak, ok2 := procStatusKiB("VmHWM:"); ok && ok2 {
+				b.ReportMetric(float64(peak-start)/1024, "peak-rss-growth-MiB")
+			}
+		})
+	}
+}
+
+// resetPeakRSS resets the peak RSS of the process to the current RSS, and returns the current RSS in KiB.
+func resetPeakRSS() (uint64, bool) {
+	if err := os.WriteFile("/proc/self/clear_refs", []byte("5"), 0); err != nil {
+		return 0, false
+	}
+	return procStatusKiB("VmRSS:")
+}
+
+func procStatusKiB(key string) (uint64, bool) {
+	data, err := os.ReadFile("/proc/self/status")
+	if err != nil {
+		return 0, false
+	}
+	for _, line := range strings.Split(string(data), "\n") {
+		if strings.HasPrefix(line, key) {
+			var v uint64
+			if _, err := fmt.Sscanf(strings.TrimSpace(line[len(key):]), "%d kB", &v); err != nil {
+				return 0, false
+			}
+			return v, true
+		}
+	}
+	return 0, false
+}
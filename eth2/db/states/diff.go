@@ -0,0 +1,384 @@
+package states
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"sync"
+
+	"github.com/protolambda/ztyp/tree"
+
+	"github.com/protolambda/zrnt/eth2/beacon/common"
+	"github.com/protolambda/zrnt/eth2/beacon/transition"
+)
+
+// DiffOptions configures the DiffDB. With zero options every state is stored as snapshot.
+type DiffOptions struct {
+	// SnapshotEpochs is the number of epochs between full snapshots. States in between are stored as diffs.
+	SnapshotEpochs common.Epoch
+	// MaxDepth is the maximum number of diffs to apply on a snapshot to reconstruct a state.
+	// A state that would exceed it is stored as snapshot.
+	MaxDepth int
+}
+
+type diffState struct {
+	slot    common.Slot
+	version common.Version
+	// base is the state the diff applies to, zero if the state is a snapshot.
+	base common.Root
+	// data is the encoded state if the state is a snapshot, the encoded diff otherwise.
+	data []byte
+}
+
+func (s *diffState) snapshot() bool {
+	return s.base == (common.Root{})
+}
+
+// DiffDB keeps states in memory, as full snapshots, and diffs of the backing tree in between.
+// A diff stores the subtrees of the state that changed relative to the previously stored state,
+// found by comparing node references and roots, not by hashing or encoding the full state.
+//
+// Removing a state that other states are based on re-encodes those states relative to the base of the removed state.
+type DiffDB struct {
+	sync.RWMutex
+	spec   *common.Spec
+	opts   DiffOptions
+	states map[common.Root]*diffState
+	// The last stored state, the base of the next diff, if any.
+	tipRoot common.Root
+	tipNode tree.Node
+}
+
+var _ DB = (*DiffDB)(nil)
+
+func NewDiffDB(spec *common.Spec, opts DiffOptions) *DiffDB {
+	return &DiffDB{spec: spec, opts: opts, states: make(map[common.Root]*diffState)}
+}
+
+// depth returns the number of diffs to apply to reconstruct the state. The DB must be locked.
+func (db *DiffDB) depth(root common.Root) (depth int, snapshot *diffState) {
+	s := db.states[root]
+	for !s.snapshot() {
+		depth++
+		s = db.states[s.base]
+	}
+	return depth, s
+}
+
+func (db *DiffDB) Store(ctx context.Context, state common.BeaconState) (exists bool, err error) {
+	db.Lock()
+	defer db.Unlock()
+	return db.store(ctx, state)
+}
+
+// store encodes the state as snapshot or as diff relative to the last stored state. The DB must be locked.
+func (db *DiffDB) store(ctx context.Context, state common.BeaconState) (exists bool, err error) {
+	root := state.HashTreeRoot(tree.GetHashFn())
+	slot, err := state.Slot()
+	if err != nil {
+		return false, err
+	}
+	fork, err := state.Fork()
+	if err != nil {
+		return false, err
+	}
+	node := state.Backing()
+	if _, exists := db.states[root]; exists {
+		return true, nil
+	}
+	s := &diffState{slot: slot, version: fork.CurrentVersion}
+	if tip, ok := db.states[db.tipRoot]; ok && db.tipNode != nil && tip.version == s.version {
+		depth, snap := db.depth(db.tipRoot)
+		snapEpoch, epoch := db.spec.SlotToEpoch(snap.slot), db.spec.SlotToEpoch(slot)
+		if depth+1 <= db.opts.MaxDepth && epoch >= snapEpoch && epoch-snapEpoch < db.opts.SnapshotEpochs {
+			s.base = db.tipRoot
+			if s.data, err = encodeDiff(db.tipNode, node); err != nil {
+				return false, err
+			}
+		}
+	}
+	if s.snapshot() {
+		if err := ctx.Err(); err != nil {
+			return false, err
+		}
+		if s.data, err = encodeState(state); err != nil {
+			return false, err
+		}
+	}
+	db.states[root] = s
+	db.tipRoot = root
+	db.tipNode = node
+	return false, nil
+}
+
+func (db *DiffDB) Get(ctx context.Context, root common.Root) (state common.BeaconState, exists bool, err error) {
+	db.RLock()
+	s, exists := db.states[root]
+	if !exists {
+		db.RUnlock()
+		return nil, false, nil
+	}
+	var diffs [][]byte
+	for !s.snapshot() {
+		diffs = append(diffs, s.data)
+		s = db.states[s.base]
+	}
+	db.RUnlock()
+	state, err = db.reconstruct(s.data, diffs)
+	if err != nil {
+		return nil, true, fmt.Errorf("failed to reconstruct state %s: %w", root, err)
+	}
+	return state, true, nil
+}
+
+// reconstruct decodes the snapshot, and applies the diffs, in reverse order.
+func (db *DiffDB) reconstruct(snapshot []byte, diffs [][]byte) (common.BeaconState, error) {
+	state, _, err := transition.DecodeState(db.spec, snapshot)
+	if err != nil {
+		return nil, err
+	}
+	node := state.Backing()
+	for i := len(diffs) - 1; i >= 0; i-- {
+		if node, err = applyDiff(node, diffs[i]); err != nil {
+			return nil, err
+		}
+	}
+	if err := state.SetBacking(node); err != nil {
+		return nil, err
+	}
+	return state, nil
+}
+
+func (db *DiffDB) Remove(root common.Root) (exists bool, err error) {
+	db.Lock()
+	defer db.Unlock()
+	return db.remove(root)
+}
+
+// remove re-encodes the states based on the removed state, then removes it. The DB must be locked.
+func (db *DiffDB) remove(root common.Root) (exists bool, err error) {
+	s, exists := db.states[root]
+	if !exists {
+		return false, nil
+	}
+	var children []common.Root
+	for r, c := range db.states {
+		if c.base == root {
+			children = append(children, r)
+		}
+	}
+	if len(children) > 0 {
+		// apply the diffs onto the shared base, to diff the children against it by node references
+		baseRoot := s.base
+		if s.snapshot() {
+			baseRoot = root
+		}
+		state, err := db.load(baseRoot)
+		if err != nil {
+			return true, err
+		}
+		baseNode := state.Backing()
+		removedNode := baseNode
+		if !s.snapshot() {
+			if removedNode, err = applyDiff(baseNode, s.data); err != nil {
+				return true, err
+			}
+		}
+		for _, r := range children {
+			c := db.states[r]
+			childNode, err := applyDiff(removedNode, c.data)
+			if err != nil {
+				return true, err
+			}
+			var data []byte
+			if s.snapshot() {
+				if err := state.SetBacking(childNode); err != nil {
+					return true, err
+				}
+				data, err = encodeState(state)
+			} else {
+				data, err = encodeDiff(baseNode, childNode)
+			}
+			if err != nil {
+				return true, fmt.Errorf("failed to re-encode state %s: %w", r, err)
+			}
+			db.states[r] = &diffState{slot: c.slot, version: c.version, base: s.base, data: data}
+		}
+	}
+	delete(db.states, root)
+	if root == db.tipRoot {
+		db.tipRoot = common.Root{}
+		db.tipNode = nil
+	}
+	return true, nil
+}
+
+// load reconstructs a stored state. The DB must be locked.
+func (db *DiffDB) load(root common.Root) (common.BeaconState, error) {
+	s := db.states[root]
+	var diffs [][]byte
+	for !s.snapshot() {
+		diffs = append(diffs, s.data)
+		s = db.states[s.base]
+	}
+	return db.reconstruct(s.data, diffs)
+}
+
+// List lists the stored states, the size of a state stored as diff is the size of the diff.
+func (db *DiffDB) List() ([]StateInfo, error) {
+	db.RLock()
+	out := make([]StateInfo, 0, len(db.states))
+	for root, s := range db.states {
+		out = append(out, StateInfo{Root: root, Slot: s.slot, ForkVersion: s.version, Size: uint64(len(s.data))})
+	}
+	db.RUnlock()
+	sortInfos(out)
+	return out, nil
+}
+
+func (db *DiffDB) PruneBelow(slot common.Slot, keep KeepFn) (removed int, err error) {
+	db.Lock()
+	defer db.Unlock()
+	var roots []common.Root
+	for root, s := range db.states {
+		if s.slot < slot && (keep == nil || !keep(s.slot)) {
+			roots = append(roots, root)
+		}
+	}
+	// remove the newest first: the states based on them are re-encoded against older states, not turned into snapshots.
+	sort.Slice(roots, func(i, j int) bool {
+		return db.states[roots[i]].slot > db.states[roots[j]].slot
+	})
+	for _, root := range roots {
+		if _, err := db.remove(root); err != nil {
+			return removed, err
+		}
+		removed++
+	}
+	return removed, nil
+}
+
+// Size returns the number of bytes of the stored snapshots and diffs.
+func (db *DiffDB) Size() (snapshots uint64, diffs uint64) {
+	db.RLock()
+	defer db.RUnlock()
+	for _, s := range db.states {
+		if s.snapshot() {
+			snapshots += uint64(len(s.data))
+		} else {
+			diffs += uint64(len(s.data))
+		}
+	}
+	return
+}
+
+const (
+	diffLeaf byte = 0
+	diffPair byte = 1
+)
+
+// encodeDiff encodes the subtrees of b that differ from a, as a list of generalized index and subtree.
+// Subtrees with equal references or equal roots are skipped. A leaf and a pair are always different,
+// even with the same root: ztyp summarizes zero subtrees into leaves, and expands them when set.
+func encodeDiff(a, b tree.Node) ([]byte, error) {
+	var w bytes.Buffer
+	hFn := tree.GetHashFn()
+	var walk func(a, b tree.Node, gindex uint64) error
+	walk = func(a, b tree.Node, gindex uint64) error {
+		if a == b {
+			return nil
+		}
+		if a.IsLeaf() == b.IsLeaf() && a.MerkleRoot(hFn) == b.MerkleRoot(hFn) {
+			return nil
+		}
+		if !a.IsLeaf() && !b.IsLeaf() {
+			if gindex >= 1<<63 {
+				return errors.New("tree too deep")
+			}
+			aL, _ := a.Left()
+			bL, _ := b.Left()
+			if err := walk(aL, bL, gindex*2); err != nil {
+				return err
+			}
+			aR, _ := a.Right()
+			bR, _ := b.Right()
+			return walk(aR, bR, gindex*2+1)
+		}
+		var tmp [binary.MaxVarintLen64]byte
+		w.Write(tmp[:binary.PutUvarint(tmp[:], gindex)])
+		encodeSubtree(&w, b)
+		return nil
+	}
+	if err := walk(a, b, 1); err != nil {
+		return nil, err
+	}
+	return w.Bytes(), nil
+}
+
+func encodeSubtree(w *bytes.Buffer, n tree.Node) {
+	if n.IsLeaf() {
+		w.WriteByte(diffLeaf)
+		root := n.MerkleRoot(nil)
+		w.Write(root[:])
+		return
+	}
+	w.WriteByte(diffPair)
+	left, _ := n.Left()
+	encodeSubtree(w, left)
+	right, _ := n.Right()
+	encodeSubtree(w, right)
+}
+
+func decodeSubtree(r *bytes.Reader) (tree.Node, error) {
+	tag, err := r.ReadByte()
+	if err != nil {
+		return nil, err
+	}
+	switch tag {
+	case diffLeaf:
+		var root tree.Root
+		if _, err := io.ReadFull(r, root[:]); err != nil {
+			return nil, err
+		}
+		return &root, nil
+	case diffPair:
+		left, err := decodeSubtree(r)
+		if err != nil {
+			return nil, err
+		}
+		right, err := decodeSubtree(r)
+		if err != nil {
+			return nil, err
+		}
+		return tree.NewPairNode(left, right), nil
+	default:
+		return nil, fmt.Errorf("unknown node tag %d", tag)
+	}
+}
+
+// applyDiff sets the subtrees of the diff in the tree, and returns the new root node.
+func applyDiff(node tree.Node, diff []byte) (tree.Node, error) {
+	r := bytes.NewReader(diff)
+	for r.Len() > 0 {
+		gindex, err := binary.ReadUvarint(r)
+		if err != nil {
+			return nil, err
+		}
+		sub, err := decodeSubtree(r)
+		if err != nil {
+			return nil, fmt.Errorf("invalid subtree at gindex %d: %v", gindex, err)
+		}
+		setter, err := node.Setter(tree.Gindex64(gindex), false)
+		if err != nil {
+			return nil, fmt.Errorf("invalid gindex %d: %v", gindex, err)
+		}
+		if node, err = setter(sub); err != nil {
+			return nil, err
+		}
+	}
+	return node, nil
+}
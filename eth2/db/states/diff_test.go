@@ -0,0 +1,76 @@
+package states
+
+import (
+	"context"
+	"testing"
+
+	"github.com/protolambda/ztyp/tree"
+
+	"github.com/protolambda/zrnt/eth2/beacon/common"
+	"github.com/protolambda/zrnt/eth2/beacon/testutil"
+	"github.com/protolambda/zrnt/eth2/configs"
+)
+
+func TestDiffDB(t *testing.T) {
+	spec := configs.Minimal
+	opts := DiffOptions{SnapshotEpochs: 2, MaxDepth: 4}
+	testDB(t, NewDiffDB(spec, opts), testStates(t, spec))
+	testPrune(t, NewDiffDB(spec, opts), spec)
+}
+
+func TestDiffDBReconstruct(t *testing.T) {
+	spec := configs.Minimal
+	chain, err := testutil.GenerateTestChain(spec, 4, nil, testutil.ChainOptions{Participation: 100})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+	db := NewDiffDB(spec, DiffOptions{SnapshotEpochs: 2, MaxDepth: 8})
+	var full uint64
+	roots := make(map[common.Slot]common.Root)
+	for _, b := range chain.Blocks {
+		if _, err := db.Store(ctx, b.PostState); err != nil {
+			t.Fatal(err)
+		}
+		size, err := b.PostState.ValueByteLength()
+		if err != nil {
+			t.Fatal(err)
+		}
+		full += size
+		roots[b.Envelope.Slot] = b.PostState.HashTreeRoot(tree.GetHashFn())
+	}
+	snapshots, diffs := db.Size()
+	t.Logf("%d states: %d bytes as full states, %d bytes as snapshots and %d bytes as diffs", len(roots), full, snapshots, diffs)
+	if snapshots+diffs >= full/4 {
+		t.Fatalf("expected diffs to be smaller than full states")
+	}
+	check := func() {
+		for slot, root := range roots {
+			state, exists, err := db.Get(ctx, root)
+			if err != nil || !exists {
+				t.Fatalf("failed to get state of slot %d, exists: %v, err: %v", slot, exists, err)
+			}
+			if state.HashTreeRoot(tree.GetHashFn()) != root {
+				t.Fatalf("reconstructed state of slot %d has a different root", slot)
+			}
+			if s, err := state.Slot(); err != nil || s != slot {
+				t.Fatalf("reconstructed state has slot %d, expected %d, err: %v", s, slot, err)
+			}
+		}
+	}
+	check()
+	// pruning re-encodes the remaining states based on the removed states
+	removed, err := db.PruneBelow(20, ArchiveEvery(spec, 2))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for slot := range roots {
+		if slot < 20 && slot != 16 {
+			delete(roots, slot)
+		}
+	}
+	if list, _ := db.List(); len(list) != len(roots) || removed+len(roots) != len(chain.Blocks) {
+		t.Fatalf("unexpected states after pruning: %d, removed %d", len(list), removed)
+	}
+	check()
+}
@@ -0,0 +1,386 @@
+package states
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/golang/snappy"
+	"github.com/protolambda/ztyp/tree"
+
+	"github.com/protolambda/zrnt/eth2/beacon/common"
+	"github.com/protolambda/zrnt/eth2/beacon/transition"
+)
+
+const stateFileExt = ".ssz"
+
+// Codec is the encoding of the state in a state file.
+type Codec uint8
+
+const (
+	// CodecNone stores the SSZ encoding of the state as-is.
+	CodecNone Codec = 0
+	// CodecSnappy stores the SSZ encoding of the state snappy-framed, like the req-resp protocol.
+	CodecSnappy Codec = 1
+)
+
+func (c Codec) String() string {
+	switch c {
+	case CodecNone:
+		return "none"
+	case CodecSnappy:
+		return "snappy"
+	default:
+		return fmt.Sprintf("unknown codec %d", uint8(c))
+	}
+}
+
+// FileDB stores every state as a file in a directory, named by the state root.
+// A file starts with a header: the format version and the codec, one byte each,
+// the length of the encoded state, to reject partially written files,
+// and the slot of the state, to prune without decoding states. Both are 8 byte little-endian integers.
+// The header is followed by the state, encoded with the codec.
+//
+// Files are written to a temporary file first, then synced and renamed: a crash leaves either the old or the new file.
+type FileDB struct {
+	sync.Mutex
+	// index of the stored states, kept in a sidecar file, to list the states without reading them.
+	index map[common.Root]StateInfo
+	spec  *common.Spec
+	dir   string
+	// Codec of new files. Files of any codec are read, a DB can contain a mix.
+	codec Codec
+	// VerifyOnRead makes Get check the root of every read state, for deployments that cannot trust the disk.
+	VerifyOnRead bool
+	// MapFiles makes Get and Verify decode uncompressed state files from a read-only memory mapping of the file,
+	// instead of reading the file into memory first. The mapping is released once the state is decoded.
+	// Snappy-framed files, and platforms without memory mapping, are read into memory as usual.
+	MapFiles bool
+}
+
+var _ DB = (*FileDB)(nil)
+
+// NewFileDB opens the states directory, and creates it if it does not exist.
+// The index of the stored states is loaded, and updated if it does not match the state files.
+func NewFileDB(spec *common.Spec, dir string, codec Codec) (*FileDB, error) {
+	if codec != CodecNone && codec != CodecSnappy {
+		return nil, fmt.Errorf("unsupported codec: %s", codec)
+	}
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, fmt.Errorf("failed to create states dir: %v", err)
+	}
+	db := &FileDB{spec: spec, dir: dir, codec: codec}
+	if err := db.loadIndex(); err != nil {
+		return nil, fmt.Errorf("failed to load states index: %v", err)
+	}
+	return db, nil
+}
+
+func (db *FileDB) path(root common.Root) string {
+	return filepath.Join(db.dir, hex.EncodeToString(root[:])+stateFileExt)
+}
+
+// exists checks if there is a file of the state.
+func (db *FileDB) exists(root common.Root) (bool, error) {
+	if _, err := os.Stat(db.path(root)); err == nil {
+		return true, nil
+	} else if os.IsNotExist(err) {
+		return false, nil
+	} else {
+		return false, err
+	}
+}
+
+func (db *FileDB) Store(ctx context.Context, state common.BeaconState) (exists bool, err error) {
+	root := state.HashTreeRoot(tree.GetHashFn())
+	if exists, err := db.exists(root); err != nil || exists {
+		return exists, err
+	}
+	slot, err := state.Slot()
+	if err != nil {
+		return false, err
+	}
+	data, err := encodeState(state)
+	if err != nil {
+		return false, err
+	}
+	if err := ctx.Err(); err != nil {
+		return false, err
+	}
+	tmp, err := ioutil.TempFile(db.dir, "tmp-state-")
+	if err != nil {
+		return false, err
+	}
+	defer os.Remove(tmp.Name())
+	if err := writeStateFile(tmp, slot, data, db.codec); err != nil {
+		tmp.Close()
+		return false, fmt.Errorf("failed to write state %s: %v", root, err)
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return false, err
+	}
+	info, err := tmp.Stat()
+	if err != nil {
+		tmp.Close()
+		return false, err
+	}
+	if err := tmp.Close(); err != nil {
+		return false, err
+	}
+	fork, err := state.Fork()
+	if err != nil {
+		return false, err
+	}
+	if err := os.Rename(tmp.Name(), db.path(root)); err != nil {
+		return false, err
+	}
+	db.Lock()
+	defer db.Unlock()
+	db.index[root] = StateInfo{Root: root, Slot: slot, ForkVersion: fork.CurrentVersion, Size: uint64(info.Size())}
+	return false, db.writeIndex()
+}
+
+const (
+	stateFileVersion    = 1
+	stateFileHeaderSize = 18
+)
+
+func writeStateFile(w io.Writer, slot common.Slot, data []byte, codec Codec) error {
+	var header [stateFileHeaderSize]byte
+	header[0] = stateFileVersion
+	header[1] = byte(codec)
+	binary.LittleEndian.PutUint64(header[2:10], uint64(len(data)))
+	binary.LittleEndian.PutUint64(header[10:18], uint64(slot))
+	if _, err := w.Write(header[:]); err != nil {
+		return err
+	}
+	switch codec {
+	case CodecNone:
+		_, err := w.Write(data)
+		return err
+	case CodecSnappy:
+		sw := snappy.NewBufferedWriter(w)
+		if _, err := sw.Write(data); err != nil {
+			return err
+		}
+		return sw.Close()
+	default:
+		return fmt.Errorf("unsupported codec: %s", codec)
+	}
+}
+
+var (
+	ErrPartialFile = errors.New("partially written state file")
+	ErrCorruptFile = errors.New("corrupt state file")
+)
+
+type stateFileHeader struct {
+	codec Codec
+	size  uint64
+	slot  common.Slot
+}
+
+func readStateFileHeader(r io.Reader) (h stateFileHeader, err error) {
+	var header [stateFileHeaderSize]byte
+	if _, err := io.ReadFull(r, header[:]); err != nil {
+		return h, ErrPartialFile
+	}
+	if header[0] != stateFileVersion {
+		return h, fmt.Errorf("%w: unknown format version %d", ErrCorruptFile, header[0])
+	}
+	h.codec = Codec(header[1])
+	if h.codec != CodecNone && h.codec != CodecSnappy {
+		return h, fmt.Errorf("%w: %s", ErrCorruptFile, h.codec)
+	}
+	h.size = binary.LittleEndian.Uint64(header[2:10])
+	h.slot = common.Slot(binary.LittleEndian.Uint64(header[10:18]))
+	return h, nil
+}
+
+func readStateFile(r io.Reader) ([]byte, error) {
+	h, err := readStateFileHeader(r)
+	if err != nil {
+		return nil, err
+	}
+	file := &eofReader{r: r}
+	r = file
+	if h.codec == CodecSnappy {
+		r = snappy.NewReader(r)
+	}
+	var buf bytes.Buffer
+	// read one byte more than expected, to detect trailing data
+	n, err := io.Copy(&buf, io.LimitReader(r, int64(h.size)+1))
+	// snappy reports a truncated frame as corrupt: the frame is partial if the file ended
+	if (err == snappy.ErrCorrupt && !file.eof) || err == snappy.ErrUnsupported {
+		return nil, fmt.Errorf("%w: %v", ErrCorruptFile, err)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrPartialFile, err)
+	}
+	if uint64(n) != h.size {
+		return nil, fmt.Errorf("%w: expected %d bytes, got %d", ErrPartialFile, h.size, n)
+	}
+	return buf.Bytes(), nil
+}
+
+// eofReader tracks if the reader ended.
+type eofReader struct {
+	r   io.Reader
+	eof bool
+}
+
+func (e *eofReader) Read(p []byte) (int, error) {
+	n, err := e.r.Read(p)
+	if err == io.EOF {
+		e.eof = true
+	}
+	return n, err
+}
+
+var ErrRootMismatch = errors.New("stored state does not match its root")
+
+func (db *FileDB) Get(ctx context.Context, root common.Root) (state common.BeaconState, exists bool, err error) {
+	state, exists, err = db.load(root)
+	if err != nil || !exists || !db.VerifyOnRead {
+		return state, exists, err
+	}
+	if actual := state.HashTreeRoot(tree.GetHashFn()); actual != root {
+		return nil, true, fmt.Errorf("%w: state %s has root %s", ErrRootMismatch, root, actual)
+	}
+	return state, true, nil
+}
+
+func (db *FileDB) load(root common.Root) (state common.BeaconState, exists bool, err error) {
+	f, err := os.Open(db.path(root))
+	if os.IsNotExist(err) {
+		return nil, false, nil
+	} else if err != nil {
+		return nil, true, err
+	}
+	defer f.Close()
+	if db.MapFiles {
+		if state, ok, err := db.loadMapped(root, f); ok {
+			return state, true, err
+		}
+	}
+	data, err := readStateFile(f)
+	if err != nil {
+		return nil, true, fmt.Errorf("failed to read state %s: %w", root, err)
+	}
+	state, _, err = transition.DecodeState(db.spec, data)
+	if err != nil {
+		return nil, true, fmt.Errorf("failed to decode state %s: %v", root, err)
+	}
+	return state, true, nil
+}
+
+// loadMapped decodes the state file from a memory mapping of the file. The size in the header is checked
+// against the mapped file, like readStateFile does. ok is false if the file cannot be mapped or is compressed,
+// to read it into memory instead.
+func (db *FileDB) loadMapped(root common.Root, f *os.File) (state common.BeaconState, ok bool, err error) {
+	info, err := f.Stat()
+	if err != nil {
+		return nil, true, err
+	}
+	if info.Size() < stateFileHeaderSize {
+		return nil, true, fmt.Errorf("failed to read state %s: %w", root, ErrPartialFile)
+	}
+	data, err := mapFile(f, info.Size())
+	if err != nil {
+		return nil, false, nil
+	}
+	// the tree of the decoded state does not reference the mapped bytes
+	defer unmapFile(data)
+	h, err := readStateFileHeader(bytes.NewReader(data))
+	if err != nil {
+		return nil, true, fmt.Errorf("failed to read state %s: %w", root, err)
+	}
+	if h.codec != CodecNone {
+		return nil, false, nil
+	}
+	if size := uint64(len(data) - stateFileHeaderSize); size != h.size {
+		return nil, true, fmt.Errorf("failed to read state %s: %w: expected %d bytes, got %d", root, ErrPartialFile, h.size, size)
+	}
+	state, _, err = transition.DecodeState(db.spec, data[stateFileHeaderSize:])
+	if err != nil {
+		return nil, true, fmt.Errorf("failed to decode state %s: %v", root, err)
+	}
+	return state, true, nil
+}
+
+// Verify reads every stored state, and returns the roots of the states that cannot be read,
+// or do not hash to their root. This reads and hashes every state: it can take minutes.
+func (db *FileDB) Verify(ctx context.Context) ([]common.Root, error) {
+	infos, err := db.List()
+	if err != nil {
+		return nil, err
+	}
+	var invalid []common.Root
+	for _, info := range infos {
+		root := info.Root
+		if err := ctx.Err(); err != nil {
+			return invalid, err
+		}
+		state, exists, err := db.load(root)
+		if !exists {
+			// removed while verifying
+			continue
+		}
+		if err != nil || state.HashTreeRoot(tree.GetHashFn()) != root {
+			invalid = append(invalid, root)
+		}
+	}
+	return invalid, nil
+}
+
+func (db *FileDB) Remove(root common.Root) (exists bool, err error) {
+	if err := os.Remove(db.path(root)); os.IsNotExist(err) {
+		return false, nil
+	} else if err != nil {
+		return true, err
+	}
+	db.Lock()
+	defer db.Unlock()
+	delete(db.index, root)
+	return true, db.writeIndex()
+}
+
+func (db *FileDB) List() ([]StateInfo, error) {
+	db.Lock()
+	out := make([]StateInfo, 0, len(db.index))
+	for _, info := range db.index {
+		out = append(out, info)
+	}
+	db.Unlock()
+	sortInfos(out)
+	return out, nil
+}
+
+func (db *FileDB) PruneBelow(slot common.Slot, keep KeepFn) (removed int, err error) {
+	db.Lock()
+	defer db.Unlock()
+	for root, info := range db.index {
+		if info.Slot >= slot || (keep != nil && keep(info.Slot)) {
+			continue
+		}
+		if rerr := os.Remove(db.path(root)); rerr != nil && !os.IsNotExist(rerr) {
+			err = rerr
+			break
+		}
+		delete(db.index, root)
+		removed++
+	}
+	if ierr := db.writeIndex(); err == nil {
+		err = ierr
+	}
+	return removed, err
+}
@@ -0,0 +1,182 @@
+package states
+
+import (
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/golang/snappy"
+
+	"github.com/protolambda/zrnt/eth2/beacon/common"
+)
+
+// The index file of a FileDB starts with a format version byte, followed by an entry per state:
+// the state root, the slot, the fork version and the file size. It is rewritten on every change.
+const (
+	indexFileName    = "index"
+	indexVersion     = 1
+	indexEntrySize   = 32 + 8 + 4 + 8
+	forkVersionStart = 8 + 32 + 8 + 4 // genesis time, genesis validators root, slot, previous fork version
+)
+
+func encodeIndex(index map[common.Root]StateInfo) []byte {
+	infos := make([]StateInfo, 0, len(index))
+	for _, info := range index {
+		infos = append(infos, info)
+	}
+	sortInfos(infos)
+	out := make([]byte, 1, 1+len(infos)*indexEntrySize)
+	out[0] = indexVersion
+	var entry [indexEntrySize]byte
+	for _, info := range infos {
+		copy(entry[0:32], info.Root[:])
+		binary.LittleEndian.PutUint64(entry[32:40], uint64(info.Slot))
+		copy(entry[40:44], info.ForkVersion[:])
+		binary.LittleEndian.PutUint64(entry[44:52], info.Size)
+		out = append(out, entry[:]...)
+	}
+	return out
+}
+
+func decodeIndex(data []byte) (map[common.Root]StateInfo, error) {
+	if len(data) < 1 || data[0] != indexVersion || (len(data)-1)%indexEntrySize != 0 {
+		return nil, errors.New("invalid index")
+	}
+	index := make(map[common.Root]StateInfo, (len(data)-1)/indexEntrySize)
+	for entry := data[1:]; len(entry) > 0; entry = entry[indexEntrySize:] {
+		var info StateInfo
+		copy(info.Root[:], entry[0:32])
+		info.Slot = common.Slot(binary.LittleEndian.Uint64(entry[32:40]))
+		copy(info.ForkVersion[:], entry[40:44])
+		info.Size = binary.LittleEndian.Uint64(entry[44:52])
+		index[info.Root] = info
+	}
+	return index, nil
+}
+
+// writeIndex replaces the index file with the index. The DB must be locked.
+func (db *FileDB) writeIndex() error {
+	tmp, err := ioutil.TempFile(db.dir, "tmp-index-")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(encodeIndex(db.index)); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to write states index: %v", err)
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), filepath.Join(db.dir, indexFileName))
+}
+
+// loadIndex reads the index file, and updates it to match the state files:
+// a crash between writing a state file and the index, or a missing or invalid index file, is recovered from.
+func (db *FileDB) loadIndex() error {
+	db.Lock()
+	defer db.Unlock()
+	data, err := ioutil.ReadFile(filepath.Join(db.dir, indexFileName))
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	changed := err != nil
+	index, err := decodeIndex(data)
+	if err != nil {
+		index = make(map[common.Root]StateInfo)
+		changed = true
+	}
+	roots, err := db.scanDir()
+	if err != nil {
+		return err
+	}
+	files := make(map[common.Root]struct{}, len(roots))
+	for _, root := range roots {
+		files[root] = struct{}{}
+		if _, ok := index[root]; ok {
+			continue
+		}
+		info, err := readFileInfo(db.path(root), root)
+		if os.IsNotExist(err) {
+			continue
+		} else if err != nil {
+			// keep unreadable files listed, for Verify to report them
+			info = StateInfo{Root: root}
+		}
+		index[root] = info
+		changed = true
+	}
+	for root := range index {
+		if _, ok := files[root]; !ok {
+			delete(index, root)
+			changed = true
+		}
+	}
+	db.index = index
+	if changed {
+		return db.writeIndex()
+	}
+	return nil
+}
+
+// scanDir returns the roots of the state files in the DB directory.
+func (db *FileDB) scanDir() ([]common.Root, error) {
+	entries, err := ioutil.ReadDir(db.dir)
+	if err != nil {
+		return nil, err
+	}
+	out := make([]common.Root, 0, len(entries))
+	for _, e := range entries {
+		name := e.Name()
+		if !strings.HasSuffix(name, stateFileExt) {
+			// e.g. temporary files and the index
+			continue
+		}
+		var root common.Root
+		if b, err := hex.DecodeString(strings.TrimSuffix(name, stateFileExt)); err != nil || len(b) != len(root) {
+			continue
+		} else {
+			copy(root[:], b)
+		}
+		out = append(out, root)
+	}
+	return out, nil
+}
+
+// readFileInfo reads the slot from the header of the state file, and the fork version from the start of the state.
+func readFileInfo(path string, root common.Root) (StateInfo, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return StateInfo{}, err
+	}
+	defer f.Close()
+	stat, err := f.Stat()
+	if err != nil {
+		return StateInfo{}, err
+	}
+	h, err := readStateFileHeader(f)
+	if err != nil {
+		return StateInfo{}, err
+	}
+	var r io.Reader = f
+	if h.codec == CodecSnappy {
+		r = snappy.NewReader(f)
+	}
+	var start [forkVersionStart + 4]byte
+	if _, err := io.ReadFull(r, start[:]); err != nil {
+		return StateInfo{}, fmt.Errorf("%w: %v", ErrPartialFile, err)
+	}
+	info := StateInfo{Root: root, Slot: h.slot, Size: uint64(stat.Size())}
+	copy(info.ForkVersion[:], start[forkVersionStart:])
+	return info, nil
+}
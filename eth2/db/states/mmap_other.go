@@ -0,0 +1,20 @@
+//go:build !(linux || darwin || freebsd || netbsd || openbsd || dragonfly)
+// +build !linux,!darwin,!freebsd,!netbsd,!openbsd,!dragonfly
+
+package states
+
+import (
+	"errors"
+	"os"
+)
+
+var errMapUnsupported = errors.New("memory mapped files are not supported on this platform")
+
+// mapFile is not supported on this platform, files are read into memory instead.
+func mapFile(f *os.File, size int64) ([]byte, error) {
+	return nil, errMapUnsupported
+}
+
+func unmapFile(data []byte) error {
+	return errMapUnsupported
+}
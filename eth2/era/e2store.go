@@ -0,0 +1,67 @@
+package era
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+)
+
+// EntryType is the type of an e2store entry.
+type EntryType [2]byte
+
+var (
+	TypeVersion                     = EntryType{0x65, 0x32}
+	TypeCompressedSignedBeaconBlock = EntryType{0x01, 0x00}
+	TypeCompressedBeaconState       = EntryType{0x02, 0x00}
+	TypeSlotIndex                   = EntryType{0x69, 0x32}
+)
+
+const entryHeaderSize = 8
+
+// Entry is a record of an e2store file: an 8 byte header with the type, the data length and reserved bytes, followed by the data.
+type Entry struct {
+	Type EntryType
+	Data []byte
+}
+
+// WriteEntry writes the header and the data of the entry, and returns the number of written bytes.
+func WriteEntry(w io.Writer, typ EntryType, data []byte) (int64, error) {
+	if uint64(len(data)) > math.MaxUint32 {
+		return 0, fmt.Errorf("entry data too large: %d bytes", len(data))
+	}
+	var header [entryHeaderSize]byte
+	copy(header[0:2], typ[:])
+	binary.LittleEndian.PutUint32(header[2:6], uint32(len(data)))
+	n, err := w.Write(header[:])
+	if err != nil {
+		return int64(n), err
+	}
+	m, err := w.Write(data)
+	return int64(n + m), err
+}
+
+// ReadEntry reads the next entry. It returns io.EOF if there are no more entries.
+func ReadEntry(r io.Reader) (*Entry, error) {
+	var header [entryHeaderSize]byte
+	if _, err := io.ReadFull(r, header[:]); err == io.EOF {
+		return nil, io.EOF
+	} else if err != nil {
+		return nil, fmt.Errorf("failed to read entry header: %v", err)
+	}
+	if header[6] != 0 || header[7] != 0 {
+		return nil, errors.New("reserved bytes of entry header are not zero")
+	}
+	var e Entry
+	copy(e.Type[:], header[0:2])
+	size := binary.LittleEndian.Uint32(header[2:6])
+	// grow the buffer as the data is read, a corrupt length must not allocate up front
+	var buf bytes.Buffer
+	if _, err := io.CopyN(&buf, r, int64(size)); err != nil {
+		return nil, fmt.Errorf("failed to read %d bytes of entry data: %v", size, err)
+	}
+	e.Data = buf.Bytes()
+	return &e, nil
+}
@@ -0,0 +1,311 @@
+// Package era writes and reads era files: the blocks of SLOTS_PER_HISTORICAL_ROOT slots,
+// and the state at the end of them, snappy-framed in e2store entries, with slot indices.
+package era
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+
+	"github.com/golang/snappy"
+	"github.com/protolambda/ztyp/codec"
+	"github.com/protolambda/ztyp/tree"
+
+	"github.com/protolambda/zrnt/eth2/beacon"
+	"github.com/protolambda/zrnt/eth2/beacon/common"
+	"github.com/protolambda/zrnt/eth2/beacon/transition"
+)
+
+// Era is the content of an era file.
+type Era struct {
+	Number uint64
+	// Blocks of the era, by increasing slot. Era 0 has no blocks.
+	Blocks []*common.BeaconBlockEnvelope
+	// State at the first slot after the blocks of the era: the era number times SLOTS_PER_HISTORICAL_ROOT.
+	State common.BeaconState
+}
+
+// Slots returns the range of the slots of the blocks of the era, the end is the slot of the state.
+func Slots(spec *common.Spec, number uint64) (start common.Slot, end common.Slot) {
+	end = common.Slot(number) * spec.SLOTS_PER_HISTORICAL_ROOT
+	if number == 0 {
+		return 0, 0
+	}
+	return end - spec.SLOTS_PER_HISTORICAL_ROOT, end
+}
+
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (c *countingWriter) write(typ EntryType, data []byte) (offset int64, err error) {
+	offset = c.n
+	n, err := WriteEntry(c.w, typ, data)
+	c.n += n
+	return offset, err
+}
+
+func compress(data []byte) ([]byte, error) {
+	var buf bytes.Buffer
+	w := snappy.NewBufferedWriter(&buf)
+	if _, err := w.Write(data); err != nil {
+		return nil, err
+	}
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// slotIndex encodes the start slot, the offsets of the entries relative to the index entry, and the count.
+// Slots without entry have offset 0.
+func slotIndex(start common.Slot, offsets []int64, indexOffset int64) []byte {
+	out := make([]byte, 8*(len(offsets)+2))
+	binary.LittleEndian.PutUint64(out[0:8], uint64(start))
+	for i, offset := range offsets {
+		if offset != 0 {
+			binary.LittleEndian.PutUint64(out[8+8*i:16+8*i], uint64(offset-indexOffset))
+		}
+	}
+	binary.LittleEndian.PutUint64(out[len(out)-8:], uint64(len(offsets)))
+	return out
+}
+
+// Write writes the era file of the era.
+func Write(w io.Writer, spec *common.Spec, e *Era) error {
+	start, end := Slots(spec, e.Number)
+	slot, err := e.State.Slot()
+	if err != nil {
+		return err
+	}
+	if slot != end {
+		return fmt.Errorf("era %d state must be at slot %d, got %d", e.Number, end, slot)
+	}
+	cw := &countingWriter{w: w}
+	if _, err := cw.write(TypeVersion, nil); err != nil {
+		return err
+	}
+	offsets := make([]int64, end-start)
+	for i, b := range e.Blocks {
+		if b.Slot < start || b.Slot >= end {
+			return fmt.Errorf("block %s at slot %d is not in era %d", b.BlockRoot, b.Slot, e.Number)
+		}
+		if i > 0 && b.Slot <= e.Blocks[i-1].Slot {
+			return fmt.Errorf("block %s at slot %d is not after the previous block", b.BlockRoot, b.Slot)
+		}
+		signed, err := beacon.EnvelopeToSignedBeaconBlock(b)
+		if err != nil {
+			return err
+		}
+		var buf bytes.Buffer
+		if err := signed.Serialize(spec, codec.NewEncodingWriter(&buf)); err != nil {
+			return fmt.Errorf("failed to encode block %s: %v", b.BlockRoot, err)
+		}
+		data, err := compress(buf.Bytes())
+		if err != nil {
+			return err
+		}
+		if offsets[b.Slot-start], err = cw.write(TypeCompressedSignedBeaconBlock, data); err != nil {
+			return err
+		}
+	}
+	var buf bytes.Buffer
+	if err := e.State.Serialize(codec.NewEncodingWriter(&buf)); err != nil {
+		return fmt.Errorf("failed to encode state: %v", err)
+	}
+	data, err := compress(buf.Bytes())
+	if err != nil {
+		return err
+	}
+	stateOffset, err := cw.write(TypeCompressedBeaconState, data)
+	if err != nil {
+		return err
+	}
+	if e.Number > 0 {
+		if _, err := cw.write(TypeSlotIndex, slotIndex(start, offsets, cw.n)); err != nil {
+			return err
+		}
+	}
+	_, err = cw.write(TypeSlotIndex, slotIndex(end, []int64{stateOffset}, cw.n))
+	return err
+}
+
+type ReadOptions struct {
+	// StateRoot is the trusted root of the era state, e.g. from the historical summaries of a later state.
+	// Optional: if nil, the blocks are only verified against the era state.
+	StateRoot *common.Root
+}
+
+type positioned struct {
+	offset int64
+	entry  *Entry
+}
+
+func decompress(data []byte) ([]byte, error) {
+	return ioutil.ReadAll(snappy.NewReader(bytes.NewReader(data)))
+}
+
+// Read reads and verifies an era file. The blocks must link to their parents, and match the block and state roots
+// of the era state, which makes the era state root the single root to trust.
+func Read(r io.Reader, spec *common.Spec, genesisValRoot common.Root, opts ReadOptions) (*Era, error) {
+	var entries []positioned
+	var offset int64
+	for {
+		e, err := ReadEntry(r)
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, err
+		}
+		entries = append(entries, positioned{offset: offset, entry: e})
+		offset += entryHeaderSize + int64(len(e.Data))
+	}
+	if len(entries) == 0 || entries[0].entry.Type != TypeVersion {
+		return nil, errors.New("era file does not start with a version entry")
+	}
+	var out Era
+	var stateOffset int64
+	var indices []positioned
+	blockOffsets := make(map[common.Slot]int64)
+	for _, p := range entries[1:] {
+		switch p.entry.Type {
+		case TypeCompressedSignedBeaconBlock:
+			data, err := decompress(p.entry.Data)
+			if err != nil {
+				return nil, fmt.Errorf("failed to decompress block at offset %d: %v", p.offset, err)
+			}
+			b, err := transition.DecodeBlock(spec, genesisValRoot, data)
+			if err != nil {
+				return nil, fmt.Errorf("failed to decode block at offset %d: %v", p.offset, err)
+			}
+			out.Blocks = append(out.Blocks, b)
+			blockOffsets[b.Slot] = p.offset
+		case TypeCompressedBeaconState:
+			if out.State != nil {
+				return nil, errors.New("era file has multiple states")
+			}
+			data, err := decompress(p.entry.Data)
+			if err != nil {
+				return nil, fmt.Errorf("failed to decompress state: %v", err)
+			}
+			if out.State, _, err = transition.DecodeState(spec, data); err != nil {
+				return nil, fmt.Errorf("failed to decode state: %v", err)
+			}
+			stateOffset = p.offset
+		case TypeSlotIndex:
+			indices = append(indices, p)
+		}
+		// other entry types are allowed, and ignored
+	}
+	if out.State == nil {
+		return nil, errors.New("era file has no state")
+	}
+	slot, err := out.State.Slot()
+	if err != nil {
+		return nil, err
+	}
+	if slot%spec.SLOTS_PER_HISTORICAL_ROOT != 0 {
+		return nil, fmt.Errorf("era state slot %d is not an era boundary", slot)
+	}
+	out.Number = uint64(slot / spec.SLOTS_PER_HISTORICAL_ROOT)
+	if opts.StateRoot != nil {
+		if root := out.State.HashTreeRoot(tree.GetHashFn()); root != *opts.StateRoot {
+			return nil, fmt.Errorf("era state root %s does not match trusted root %s", root, *opts.StateRoot)
+		}
+	}
+	start, end := Slots(spec, out.Number)
+
+	// the last index is the state index, the one before it the block index, if the era has blocks
+	expectedIndices := 1
+	if out.Number > 0 {
+		expectedIndices = 2
+	}
+	if len(indices) != expectedIndices {
+		return nil, fmt.Errorf("expected %d slot indices, got %d", expectedIndices, len(indices))
+	}
+	if err := checkIndex(indices[len(indices)-1], end, []int64{stateOffset}); err != nil {
+		return nil, fmt.Errorf("invalid state index: %v", err)
+	}
+	if out.Number > 0 {
+		offsets := make([]int64, end-start)
+		for s, o := range blockOffsets {
+			if s < start || s >= end {
+				return nil, fmt.Errorf("block at slot %d is not in era %d", s, out.Number)
+			}
+			offsets[s-start] = o
+		}
+		if err := checkIndex(indices[0], start, offsets); err != nil {
+			return nil, fmt.Errorf("invalid block index: %v", err)
+		}
+	} else if len(out.Blocks) > 0 {
+		return nil, errors.New("era 0 has no blocks")
+	}
+	if err := verifyBlocks(out.State, out.Blocks, start, end); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// checkIndex checks the slot index entry matches the offsets of the entries.
+func checkIndex(p positioned, start common.Slot, offsets []int64) error {
+	expected := slotIndex(start, offsets, p.offset)
+	if !bytes.Equal(p.entry.Data, expected) {
+		return errors.New("offsets do not match the entries")
+	}
+	return nil
+}
+
+// verifyBlocks checks the blocks link to their parents, and match the block roots and state roots of the era state.
+// Slots without block must repeat the block root of the slot before: no block can be missing.
+func verifyBlocks(state common.BeaconState, blocks []*common.BeaconBlockEnvelope, start, end common.Slot) error {
+	blockRoots, err := state.BlockRoots()
+	if err != nil {
+		return err
+	}
+	stateRoots, err := state.StateRoots()
+	if err != nil {
+		return err
+	}
+	i := 0
+	for slot := start; slot < end; slot++ {
+		expected, err := blockRoots.GetRoot(slot)
+		if err != nil {
+			return err
+		}
+		if i < len(blocks) && blocks[i].Slot == slot {
+			b := blocks[i]
+			if b.BlockRoot != expected {
+				return fmt.Errorf("block %s at slot %d does not match era state block root %s", b.BlockRoot, slot, expected)
+			}
+			stateRoot, err := stateRoots.GetRoot(slot)
+			if err != nil {
+				return err
+			}
+			if b.StateRoot != stateRoot {
+				return fmt.Errorf("block %s at slot %d has state root %s, era state has %s", b.BlockRoot, slot, b.StateRoot, stateRoot)
+			}
+			if i > 0 && b.ParentRoot != blocks[i-1].BlockRoot {
+				return fmt.Errorf("block %s at slot %d does not link to the previous block %s", b.BlockRoot, slot, blocks[i-1].BlockRoot)
+			}
+			i++
+			continue
+		}
+		if slot > start {
+			prev, err := blockRoots.GetRoot(slot - 1)
+			if err != nil {
+				return err
+			}
+			if expected != prev {
+				return fmt.Errorf("missing block %s at slot %d", expected, slot)
+			}
+		}
+	}
+	if i != len(blocks) {
+		return fmt.Errorf("blocks are not ordered by slot")
+	}
+	return nil
+}
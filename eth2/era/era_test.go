@@ -0,0 +1,128 @@
+package era
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/protolambda/ztyp/tree"
+
+	"github.com/protolambda/zrnt/eth2/beacon"
+	"github.com/protolambda/zrnt/eth2/beacon/common"
+	"github.com/protolambda/zrnt/eth2/beacon/testutil"
+	"github.com/protolambda/zrnt/eth2/configs"
+)
+
+// testEra returns era 1 of a chain with the minimal preset: the blocks of slots [0, 64), and the state at slot 64.
+func testEra(t *testing.T) (*common.Spec, common.Root, *Era, common.BeaconState) {
+	spec := configs.Minimal
+	chain, err := testutil.GenerateTestChain(spec, 8, nil, testutil.ChainOptions{Seed: 3, Participation: 100, SkipSlots: 20})
+	if err != nil {
+		t.Fatal(err)
+	}
+	e := &Era{Number: 1}
+	var last *testutil.TestBlock
+	for _, b := range chain.Blocks {
+		if b.Envelope.Slot < 64 {
+			e.Blocks = append(e.Blocks, b.Envelope)
+			last = b
+		}
+	}
+	if len(e.Blocks) == 63 {
+		t.Fatal("expected empty slots in the era")
+	}
+	state, err := last.PostState.CopyState()
+	if err != nil {
+		t.Fatal(err)
+	}
+	upgradeable := &beacon.StandardUpgradeableBeaconState{BeaconState: state}
+	epc, err := common.NewEpochsContext(spec, upgradeable)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := common.ProcessSlots(context.Background(), spec, epc, upgradeable, 64); err != nil {
+		t.Fatal(err)
+	}
+	e.State = upgradeable.BeaconState
+	gvr, err := chain.Genesis.GenesisValidatorsRoot()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return spec, gvr, e, chain.Genesis
+}
+
+func TestEraRoundTrip(t *testing.T) {
+	spec, gvr, e, genesis := testEra(t)
+	var buf bytes.Buffer
+	if err := Write(&buf, spec, e); err != nil {
+		t.Fatal(err)
+	}
+	stateRoot := e.State.HashTreeRoot(tree.GetHashFn())
+	got, err := Read(bytes.NewReader(buf.Bytes()), spec, gvr, ReadOptions{StateRoot: &stateRoot})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Number != 1 || len(got.Blocks) != len(e.Blocks) {
+		t.Fatalf("unexpected era %d with %d blocks", got.Number, len(got.Blocks))
+	}
+	for i, b := range got.Blocks {
+		if b.BlockRoot != e.Blocks[i].BlockRoot {
+			t.Fatalf("unexpected block %d: %s", i, b.BlockRoot)
+		}
+	}
+	if got.State.HashTreeRoot(tree.GetHashFn()) != stateRoot {
+		t.Fatal("unexpected state")
+	}
+
+	// era 0 is only the genesis state
+	buf.Reset()
+	if err := Write(&buf, spec, &Era{Number: 0, State: genesis}); err != nil {
+		t.Fatal(err)
+	}
+	got, err = Read(&buf, spec, gvr, ReadOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Number != 0 || len(got.Blocks) != 0 || got.State.HashTreeRoot(tree.GetHashFn()) != genesis.HashTreeRoot(tree.GetHashFn()) {
+		t.Fatal("unexpected era 0")
+	}
+}
+
+func TestEraVerify(t *testing.T) {
+	spec, gvr, e, _ := testEra(t)
+	expectErr := func(name string, e *Era, opts ReadOptions, modify func(data []byte) []byte, msg string) {
+		var buf bytes.Buffer
+		if err := Write(&buf, spec, e); err != nil {
+			t.Fatal(err)
+		}
+		data := buf.Bytes()
+		if modify != nil {
+			data = modify(data)
+		}
+		if _, err := Read(bytes.NewReader(data), spec, gvr, opts); err == nil || !strings.Contains(err.Error(), msg) {
+			t.Fatalf("%s: expected error %q, got %v", name, msg, err)
+		}
+	}
+	missing := *e
+	missing.Blocks = append(append([]*common.BeaconBlockEnvelope{}, e.Blocks[:5]...), e.Blocks[6:]...)
+	expectErr("missing block", &missing, ReadOptions{}, nil, "missing block")
+
+	other := common.Root{1}
+	expectErr("untrusted state", e, ReadOptions{StateRoot: &other}, nil, "does not match trusted root")
+
+	// move the offset of the first block in the block index: the entries do not match it anymore
+	expectErr("index", e, ReadOptions{}, func(data []byte) []byte {
+		blockIndex := len(data) - (entryHeaderSize + 3*8) - (entryHeaderSize + (64+2)*8)
+		offsets := data[blockIndex+entryHeaderSize+8 : blockIndex+entryHeaderSize+8+64*8]
+		for i := 0; i < len(offsets); i += 8 {
+			if offsets[i] != 0 {
+				offsets[i]++
+				break
+			}
+		}
+		return data
+	}, "invalid block index")
+
+	expectErr("truncated", e, ReadOptions{}, func(data []byte) []byte { return data[:len(data)-1] }, "failed to read")
+}
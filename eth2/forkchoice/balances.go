@@ -0,0 +1,66 @@
+package forkchoice
+
+import (
+	"sync"
+
+	"github.com/protolambda/zrnt/eth2/beacon/common"
+)
+
+// JustifiedBalances computes the vote weights of the validators, from the justified state:
+// the effective balance of the active validators that are not slashed, zero for other validators.
+func JustifiedBalances(spec *common.Spec, state common.BeaconState) ([]Gwei, error) {
+	vals, err := state.Validators()
+	if err != nil {
+		return nil, err
+	}
+	flats, err := common.FlattenValidators(vals)
+	if err != nil {
+		return nil, err
+	}
+	slot, err := state.Slot()
+	if err != nil {
+		return nil, err
+	}
+	epoch := spec.SlotToEpoch(slot)
+	out := make([]Gwei, len(flats))
+	for i := range flats {
+		if v := &flats[i]; v.IsActive(epoch) && !v.Slashed {
+			out[i] = v.EffectiveBalance
+		}
+	}
+	return out, nil
+}
+
+// BalancesCache keeps the justified balances of the latest justified checkpoint,
+// to only recompute them when the justified checkpoint changes.
+type BalancesCache struct {
+	mu         sync.Mutex
+	spec       *common.Spec
+	checkpoint Checkpoint
+	balances   []Gwei
+}
+
+func NewBalancesCache(spec *common.Spec) *BalancesCache {
+	return &BalancesCache{spec: spec}
+}
+
+// Get returns the justified balances of the checkpoint, computed from the state of the checkpoint if not cached.
+// The balances are shared between calls, and must not be modified.
+func (bc *BalancesCache) Get(justified Checkpoint, justifiedState func() (common.BeaconState, error)) ([]Gwei, error) {
+	bc.mu.Lock()
+	defer bc.mu.Unlock()
+	if bc.balances != nil && bc.checkpoint == justified {
+		return bc.balances, nil
+	}
+	state, err := justifiedState()
+	if err != nil {
+		return nil, err
+	}
+	balances, err := JustifiedBalances(bc.spec, state)
+	if err != nil {
+		return nil, err
+	}
+	bc.checkpoint = justified
+	bc.balances = balances
+	return balances, nil
+}
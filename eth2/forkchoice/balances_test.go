@@ -0,0 +1,89 @@
+package forkchoice
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/protolambda/zrnt/eth2/beacon/common"
+	"github.com/protolambda/zrnt/eth2/beacon/testutil"
+	"github.com/protolambda/zrnt/eth2/configs"
+)
+
+func TestJustifiedBalances(t *testing.T) {
+	spec := configs.Minimal
+	state, _, err := testutil.GenerateTestState(spec, 64, testutil.StateOptions{Seed: 3, Slot: 10, Slashed: 4})
+	if err != nil {
+		t.Fatal(err)
+	}
+	vals, err := state.Validators()
+	if err != nil {
+		t.Fatal(err)
+	}
+	// a validator that is not active yet
+	pending, err := vals.Validator(7)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := pending.SetActivationEpoch(5); err != nil {
+		t.Fatal(err)
+	}
+
+	balances, err := JustifiedBalances(spec, state)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(balances) != 64 {
+		t.Fatalf("expected a balance per validator, got %d", len(balances))
+	}
+	zeroed := 0
+	for i, b := range balances {
+		v, err := vals.Validator(common.ValidatorIndex(i))
+		if err != nil {
+			t.Fatal(err)
+		}
+		slashed, _ := v.Slashed()
+		activation, _ := v.ActivationEpoch()
+		expected, _ := v.EffectiveBalance()
+		if slashed || activation > 1 {
+			expected = 0
+			zeroed++
+		}
+		if b != expected {
+			t.Fatalf("validator %d: expected balance %d, got %d", i, expected, b)
+		}
+	}
+	if zeroed != 5 {
+		t.Fatalf("expected 4 slashed and 1 inactive validator, got %d zeroed balances", zeroed)
+	}
+
+	cache := NewBalancesCache(spec)
+	loads := 0
+	load := func() (common.BeaconState, error) {
+		loads++
+		return state, nil
+	}
+	cp := Checkpoint{Epoch: 1, Root: common.Root{1}}
+	a, err := cache.Get(cp, load)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := cache.Get(cp, load)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if loads != 1 || &a[0] != &b[0] {
+		t.Fatal("expected cached balances for the same checkpoint")
+	}
+	// a new checkpoint recomputes, and a failure keeps the previous balances
+	if _, err := cache.Get(Checkpoint{Epoch: 2}, func() (common.BeaconState, error) {
+		return nil, errors.New("state unavailable")
+	}); err == nil {
+		t.Fatal("expected error")
+	}
+	if _, err := cache.Get(cp, load); err != nil || loads != 1 {
+		t.Fatal("expected cached balances after failed update")
+	}
+	if _, err := cache.Get(Checkpoint{Epoch: 2}, load); err != nil || loads != 2 {
+		t.Fatal("expected recomputed balances for new checkpoint")
+	}
+}
@@ -28,6 +28,9 @@ type ProtoNode struct {
 	BestChild NodeIndex
 	// Relative to ForkchoiceParent relations
 	BestDescendant NodeIndex
+	// Skip list of the transition ancestors: ancestors[k] is the ancestor 2^k transitions back.
+	// Ends at the first ancestor that is unknown, or pruned at the time the node was added.
+	ancestors []NodeIndex
 }
 
 type NodeSinkFn func(ctx context.Context, ref NodeRef, canonical bool) error
@@ -375,6 +378,7 @@ func (pr *ProtoArray) ProcessSlot(parent Root, slot Slot, justifiedEpoch Epoch,
 				BestChild:        NONE,
 				BestDescendant:   NONE,
 			})
+			pr.linkAncestors(nodeIndex)
 			// remember the node as parent for the next
 			parentIndex = nodeIndex
 		}
@@ -393,6 +397,7 @@ func (pr *ProtoArray) ProcessSlot(parent Root, slot Slot, justifiedEpoch Epoch,
 		BestChild:        NONE,
 		BestDescendant:   NONE,
 	})
+	pr.linkAncestors(nodeIndex)
 	// Connections are out of sync, i.e. array needs work before next find-head can return the proper head.
 	pr.updatedConnections = false
 }
@@ -443,6 +448,7 @@ func (pr *ProtoArray) ProcessBlock(parent Root, blockRoot Root, blockSlot Slot,
 		BestChild:        NONE,
 		BestDescendant:   NONE,
 	})
+	pr.linkAncestors(nodeIndex)
 	// Connections are out of sync, i.e. array needs work before next find-head can return the proper head.
 	pr.updatedConnections = false
 	return true
@@ -546,20 +552,36 @@ func (pr *ProtoArray) inSubtree(anchorIndex NodeIndex, lookupIndex NodeIndex) (u
 		return false, false
 	}
 	// shortcut: if they have the same relative head, they are on the same chain.
-	if anchorNode.BestDescendant == lookupIndex || anchorNode.BestDescendant == lookupNode.BestDescendant {
+	// Leaf nodes have no best descendant, that is not a shared head.
+	if anchorNode.BestDescendant != NONE &&
+		(anchorNode.BestDescendant == lookupIndex || anchorNode.BestDescendant == lookupNode.BestDescendant) {
 		return false, true
 	}
 	// Root may still be on a different non-canonical branch out of the anchor.
-	for i := lookupNode.TransitionParent; i != NONE && i >= anchorIndex; {
-		tmp := &pr.nodes[i]
-		// early exit: as soon as we find a node that has the same relative head as the anchor,
-		// we know we are in-between the anchor and the head, thus in the subtree, thus an ancestor.
-		if tmp.BestDescendant == anchorNode.BestDescendant {
-			return false, true
+	// Ancestors are added before their descendants: find the earliest ancestor at or after the anchor,
+	// with the largest jumps first, it is the anchor only if the anchor is an ancestor.
+	i := lookupIndex
+	for k := len(lookupNode.ancestors) - 1; k >= 0; k-- {
+		ancestors := pr.nodes[i-pr.indexOffset].ancestors
+		if k < len(ancestors) && ancestors[k] >= anchorIndex {
+			i = ancestors[k]
 		}
-		i = tmp.TransitionParent
 	}
-	return false, false
+	return false, i == anchorIndex
+}
+
+// linkAncestors fills the skip list of the ancestors of a newly added node.
+func (pr *ProtoArray) linkAncestors(index NodeIndex) {
+	node := &pr.nodes[index-pr.indexOffset]
+	ancestor := node.TransitionParent
+	for k := 0; ancestor != NONE && ancestor >= pr.indexOffset; k++ {
+		node.ancestors = append(node.ancestors, ancestor)
+		next := pr.nodes[ancestor-pr.indexOffset].ancestors
+		if k >= len(next) {
+			break
+		}
+		ancestor = next[k]
+	}
 }
 
 var HeadUnknownErr = errors.New("array has invalid state, head has no index")
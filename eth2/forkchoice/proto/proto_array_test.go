@@ -0,0 +1,103 @@
+package proto
+
+import (
+	"math/rand"
+	"testing"
+
+	. "github.com/protolambda/zrnt/eth2/forkchoice"
+)
+
+func testRoot(i int) Root {
+	return Root{byte(i), byte(i >> 8), byte(i >> 16), 1}
+}
+
+// inSubtreeWalk is the reference ancestry check: a walk over all the transition parents.
+func (pr *ProtoArray) inSubtreeWalk(anchorIndex NodeIndex, lookupIndex NodeIndex) bool {
+	for i := lookupIndex; i != NONE && i >= anchorIndex; i = pr.nodes[i-pr.indexOffset].TransitionParent {
+		if i == anchorIndex {
+			return true
+		}
+	}
+	return false
+}
+
+func (pr *ProtoArray) blockIndex(t testing.TB, root Root) NodeIndex {
+	index, ok := pr.indices[NodeRef{Root: root, Slot: pr.blockSlots[root]}]
+	if !ok {
+		t.Fatalf("unknown block %s", root)
+	}
+	return index
+}
+
+func TestInSubtreeSkipList(t *testing.T) {
+	rng := rand.New(rand.NewSource(1234))
+	pr := NewProtoArray(Root{}, testRoot(0), 0, 0, 0, nil)
+	roots := []Root{testRoot(0)}
+	slots := []Slot{0}
+	for i := 1; i < 300; i++ {
+		// build on a random recent block, with gaps
+		p := len(roots) - 1 - rng.Intn(min(len(roots), 20))
+		slot := slots[p] + 1 + Slot(rng.Intn(3))
+		if !pr.ProcessBlock(roots[p], testRoot(i), slot, 0, 0) {
+			t.Fatalf("failed to add block %d", i)
+		}
+		roots = append(roots, testRoot(i))
+		slots = append(slots, slot)
+	}
+	for _, anchor := range roots {
+		for _, root := range roots {
+			expected := anchor == root || pr.inSubtreeWalk(pr.blockIndex(t, anchor), pr.blockIndex(t, root))
+			unknown, inSubtree := pr.InSubtree(anchor, root)
+			if unknown || inSubtree != expected {
+				t.Fatalf("anchor %s, root %s: expected in subtree %v, got %v (unknown %v)", anchor, root, expected, inSubtree, unknown)
+			}
+		}
+	}
+	if unknown, _ := pr.InSubtree(roots[0], testRoot(1000)); !unknown {
+		t.Fatal("expected unknown root")
+	}
+	if unknown, _ := pr.InSubtree(testRoot(1000), roots[0]); !unknown {
+		t.Fatal("expected unknown anchor")
+	}
+}
+
+func min(a, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
+
+// forkedArray builds two branches of blocks, of the given number of slots each, out of the first block.
+func forkedArray(slots int) (pr *ProtoArray, a Root, b Root, tip Root) {
+	pr = NewProtoArray(Root{}, testRoot(0), 0, 0, 0, nil)
+	parentA, parentB := testRoot(0), testRoot(0)
+	for i := 1; i <= slots; i++ {
+		rootA, rootB := testRoot(2*i), testRoot(2*i+1)
+		pr.ProcessBlock(parentA, rootA, Slot(i), 0, 0)
+		pr.ProcessBlock(parentB, rootB, Slot(i), 0, 0)
+		parentA, parentB = rootA, rootB
+	}
+	return pr, testRoot(2), testRoot(3), parentB
+}
+
+func BenchmarkInSubtree(b *testing.B) {
+	pr, anchorA, _, tip := forkedArray(2048)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, inSubtree := pr.InSubtree(anchorA, tip); inSubtree {
+			b.Fatal("tip of branch B is not in branch A")
+		}
+	}
+}
+
+func BenchmarkInSubtreeWalk(b *testing.B) {
+	pr, anchorA, _, tip := forkedArray(2048)
+	anchorIndex, tipIndex := pr.blockIndex(b, anchorA), pr.blockIndex(b, tip)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if pr.inSubtreeWalk(anchorIndex, tipIndex) {
+			b.Fatal("tip of branch B is not in branch A")
+		}
+	}
+}
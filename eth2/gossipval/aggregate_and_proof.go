@@ -152,11 +152,11 @@ func ValidateAggregateAndProof(ctx context.Context, signedAgg *phase0.SignedAggr
 	if err != nil {
 		return nil, GossipValidatorResult{IGNORE, err}
 	}
-	if indexedAtt, err := att.ConvertToIndexed(spec, committee); err != nil {
+	if indexedAtt, err := att.ConvertToIndexedWithCache(spec, epc, committee); err != nil {
 		// it should always convert.
 		// Something is very wrong if not, e.g. bad bitfield length.
 		return nil, GossipValidatorResult{REJECT, err}
-	} else if err := phase0.ValidateIndexedAttestation(spec, epc, state, indexedAtt); err != nil {
+	} else if err := phase0.ValidateIndexedAttestation(spec, epc, state, indexedAtt, true); err != nil {
 		return nil, GossipValidatorResult{REJECT, err}
 	}
 
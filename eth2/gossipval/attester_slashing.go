@@ -32,20 +32,15 @@ func ValidateAttesterSlashing(ctx context.Context, attSl *phase0.AttesterSlashin
 	if !phase0.IsSlashableAttestationData(&sa1.Data, &sa2.Data) {
 		return GossipValidatorResult{REJECT, errors.New("attester slashing has no valid reasoning")}
 	}
-	indices1, err := phase0.ValidateIndexedAttestationIndicesSet(spec, sa1)
-	if err != nil {
+	if _, err := phase0.ValidateIndexedAttestationIndicesSet(spec, sa1); err != nil {
 		return GossipValidatorResult{REJECT, errors.New("attestation 1 of attester slashing cannot be verified")}
 	}
-	indices2, err := phase0.ValidateIndexedAttestationIndicesSet(spec, sa2)
-	if err != nil {
+	if _, err := phase0.ValidateIndexedAttestationIndicesSet(spec, sa2); err != nil {
 		return GossipValidatorResult{REJECT, errors.New("attestation 2 of attester slashing cannot be verified")}
 	}
 
 	// [IGNORE] At least one index in the intersection of the attesting indices of each attestation has not yet been seen in any prior attester_slashing
-	slashable := make(common.ValidatorSet, 0, len(indices1))
-	indices1.ZigZagJoin(indices2, func(i common.ValidatorIndex) {
-		slashable = append(slashable, i)
-	}, nil)
+	slashable := phase0.SlashableIndices(sa1, sa2)
 
 	if attSlVal.AttesterSlashableAllSeen(slashable) {
 		return GossipValidatorResult{IGNORE, errors.New("no unseen slashable attester indices")}
@@ -78,10 +73,10 @@ func ValidateAttesterSlashing(ctx context.Context, attSl *phase0.AttesterSlashin
 
 	// [REJECT] All of the conditions within process_attester_slashing pass validation.
 	// Part 3: signature checks
-	if err := phase0.ValidateIndexedAttestation(spec, epc, state, sa1); err != nil {
+	if err := phase0.ValidateIndexedAttestation(spec, epc, state, sa1, true); err != nil {
 		return GossipValidatorResult{REJECT, fmt.Errorf("attester slashing att 1 signature is invalid: %v", err)}
 	}
-	if err := phase0.ValidateIndexedAttestation(spec, epc, state, sa2); err != nil {
+	if err := phase0.ValidateIndexedAttestation(spec, epc, state, sa2, true); err != nil {
 		return GossipValidatorResult{REJECT, fmt.Errorf("attester slashing att 2 signature is invalid: %v", err)}
 	}
 	attSlVal.MarkAttesterSlashings(slashable)
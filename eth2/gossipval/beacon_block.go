@@ -22,6 +22,36 @@ type BeaconBlockValBackend interface {
 	MarkBlock(slot common.Slot, proposer common.ValidatorIndex)
 }
 
+// BlockHeaderObserver can optionally be implemented by a BeaconBlockValBackend
+// to observe the signed headers of all blocks with a valid proposer signature, including duplicates that are ignored.
+// E.g. to detect proposer slashings.
+type BlockHeaderObserver interface {
+	ObserveBlockHeader(h *common.SignedBeaconBlockHeader)
+}
+
+// observeDuplicate verifies the signature of a duplicate block, and passes it to the header observer, if any.
+func observeDuplicate(ctx context.Context, block *common.BeaconBlockEnvelope, blockVal BeaconBlockValBackend) {
+	obs, ok := blockVal.(BlockHeaderObserver)
+	if !ok {
+		return
+	}
+	parentRef, ok := blockVal.Chain().ByBlock(block.ParentRoot)
+	if !ok {
+		return
+	}
+	parentEpc, err := parentRef.EpochsContext(ctx)
+	if err != nil {
+		return
+	}
+	pub, ok := parentEpc.ValidatorPubkeyCache.Pubkey(block.ProposerIndex)
+	if !ok {
+		return
+	}
+	if block.VerifySignature(blockVal.Spec(), blockVal.GenesisValidatorsRoot(), block.ProposerIndex, pub) {
+		obs.ObserveBlockHeader(block.SignedHeader())
+	}
+}
+
 func ValidateBeaconBlock(ctx context.Context, block *common.BeaconBlockEnvelope,
 	blockVal BeaconBlockValBackend) GossipValidatorResult {
 	spec := blockVal.Spec()
@@ -33,6 +63,7 @@ func ValidateBeaconBlock(ctx context.Context, block *common.BeaconBlockEnvelope,
 
 	// [IGNORE] The block is the first block with valid signature received for the proposer for the slot, signed_beacon_block.message.slot.
 	if blockVal.SeenBlock(block.Slot, block.ProposerIndex) {
+		observeDuplicate(ctx, block, blockVal)
 		return GossipValidatorResult{IGNORE, fmt.Errorf("already seen a block for slot %d proposer %d", block.Slot, block.ProposerIndex)}
 	}
 
@@ -80,6 +111,9 @@ func ValidateBeaconBlock(ctx context.Context, block *common.BeaconBlockEnvelope,
 	}
 
 	blockVal.MarkBlock(block.Slot, block.ProposerIndex)
+	if obs, ok := blockVal.(BlockHeaderObserver); ok {
+		obs.ObserveBlockHeader(block.SignedHeader())
+	}
 
 	// [REJECT] The block is proposed by the expected proposer_index for the block's slot in the context of
 	// the current shuffling (defined by parent_root/slot).
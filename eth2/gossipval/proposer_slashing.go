@@ -34,7 +34,7 @@ func ValidateProposerSlashing(ctx context.Context, propSl *phase0.ProposerSlashi
 	if err != nil {
 		return GossipValidatorResult{IGNORE, err}
 	}
-	if err := phase0.ValidateProposerSlashing(spec, epc, state, propSl); err != nil {
+	if err := phase0.ValidateProposerSlashing(spec, epc, nil, state, propSl); err != nil {
 		return GossipValidatorResult{REJECT, err}
 	}
 	propSlVal.MarkProposerSlashing(proposer)
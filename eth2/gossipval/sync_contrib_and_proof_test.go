@@ -0,0 +1,138 @@
+package gossipval
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	blsu "github.com/protolambda/bls12-381-util"
+	"github.com/protolambda/zrnt/eth2/beacon"
+	"github.com/protolambda/zrnt/eth2/beacon/altair"
+	"github.com/protolambda/zrnt/eth2/beacon/common"
+	"github.com/protolambda/zrnt/eth2/beacon/testutil"
+	"github.com/protolambda/zrnt/eth2/configs"
+	"github.com/protolambda/ztyp/view"
+)
+
+type testChainEntry struct {
+	beacon.ChainEntry
+	epc *common.EpochsContext
+}
+
+func (e *testChainEntry) EpochsContext(ctx context.Context) (*common.EpochsContext, error) {
+	return e.epc, nil
+}
+
+// testSyncChain only knows a single block
+type testSyncChain struct {
+	beacon.Chain
+	slot  common.Slot
+	root  common.Root
+	entry *testChainEntry
+}
+
+func (c *testSyncChain) ByBlockSlot(root common.Root, slot common.Slot) (beacon.ChainEntry, bool) {
+	if root != c.root || slot != c.slot {
+		return nil, false
+	}
+	return c.entry, true
+}
+
+type testSyncContribBackend struct {
+	spec  *common.Spec
+	slot  common.Slot
+	root  common.Root
+	entry *testChainEntry
+	state common.BeaconState
+	seen  map[common.ValidatorIndex]bool
+}
+
+func (b *testSyncContribBackend) Spec() *common.Spec {
+	return b.spec
+}
+
+func (b *testSyncContribBackend) Chain() beacon.Chain {
+	return &testSyncChain{slot: b.slot, root: b.root, entry: b.entry}
+}
+
+func (b *testSyncContribBackend) SlotAfter(delta time.Duration) common.Slot {
+	return b.slot
+}
+
+func (b *testSyncContribBackend) GetDomain(typ common.BLSDomainType, epoch common.Epoch) (common.BLSDomain, error) {
+	return common.GetDomain(b.state, typ, epoch)
+}
+
+func (b *testSyncContribBackend) SeenContribution(aggregator common.ValidatorIndex, slot common.Slot, subnet uint64) bool {
+	return b.seen[aggregator]
+}
+
+func (b *testSyncContribBackend) MarkContribution(aggregator common.ValidatorIndex, slot common.Slot, subnet uint64) {
+	b.seen[aggregator] = true
+}
+
+func TestBuildContributionAndProof(t *testing.T) {
+	spec := *configs.Minimal
+	spec.ALTAIR_FORK_EPOCH = 0
+	state, epc, err := testutil.GenerateTestState(&spec, 64, testutil.StateOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	backend := &testSyncContribBackend{
+		spec:  &spec,
+		slot:  3,
+		root:  common.Root{0x42},
+		entry: &testChainEntry{epc: epc},
+		state: state,
+		seen:  make(map[common.ValidatorIndex]bool),
+	}
+	subnet := uint64(1)
+	_, indices, err := epc.CurrentSyncCommittee.Subcommittee(&spec, subnet)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the local aggregate of the first 3 members of the subcommittee
+	msgDom, err := backend.GetDomain(common.DOMAIN_SYNC_COMMITTEE, spec.SlotToEpoch(backend.slot))
+	if err != nil {
+		t.Fatal(err)
+	}
+	bits := make(altair.SyncCommitteeSubnetBits, (len(indices)+7)/8)
+	for i := 0; i < 3; i++ {
+		bits[i/8] |= 1 << (i % 8)
+	}
+	contribution := &altair.SyncCommitteeContribution{
+		Slot:              backend.slot,
+		BeaconBlockRoot:   backend.root,
+		SubcommitteeIndex: view.Uint64View(subnet),
+		AggregationBits:   bits,
+		Signature:         testutil.Sign(backend.root, msgDom, indices[:3]...),
+	}
+
+	aggregator := indices[0]
+	aggSk := testutil.InteropKey(aggregator)
+	selectionRoot, err := altair.SyncAggregatorSelectionSigningRoot(&spec, backend.GetDomain, backend.slot, subnet)
+	if err != nil {
+		t.Fatal(err)
+	}
+	selectionProof := blsu.Sign(aggSk, selectionRoot[:]).Serialize()
+	if !altair.IsSyncCommitteeAggregator(&spec, selectionProof) {
+		t.Fatal("expected aggregator to be selected")
+	}
+
+	cnp := altair.BuildContributionAndProof(aggregator, contribution, selectionProof)
+	sigRoot, err := altair.ContributionAndProofSigningRoot(&spec, backend.GetDomain, cnp)
+	if err != nil {
+		t.Fatal(err)
+	}
+	signed := &altair.SignedContributionAndProof{
+		Message:   *cnp,
+		Signature: blsu.Sign(aggSk, sigRoot[:]).Serialize(),
+	}
+	if _, res := ValidateSyncContribAndProof(context.Background(), signed, backend); res.Result != ACCEPT {
+		t.Fatalf("expected produced contribution and proof to be accepted: %v", res)
+	}
+	if _, res := ValidateSyncContribAndProof(context.Background(), signed, backend); res.Result != IGNORE {
+		t.Fatalf("expected duplicate to be ignored: %v", res)
+	}
+}
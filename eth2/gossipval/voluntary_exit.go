@@ -29,7 +29,7 @@ func ValidateVoluntaryExit(ctx context.Context, volExit *phase0.SignedVoluntaryE
 	if err != nil {
 		return GossipValidatorResult{IGNORE, err}
 	}
-	if err := phase0.ValidateVoluntaryExit(exitVal.Spec(), epc, state, volExit); err != nil {
+	if err := phase0.ValidateVoluntaryExit(exitVal.Spec(), epc, nil, state, volExit); err != nil {
 		return GossipValidatorResult{REJECT, err}
 	}
 
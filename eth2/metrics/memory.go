@@ -0,0 +1,100 @@
+package metrics
+
+import (
+	"sort"
+	"strings"
+	"sync"
+)
+
+// MemorySink keeps the metrics in memory, to inspect them in tests and tools.
+type MemorySink struct {
+	mu         sync.Mutex
+	counters   map[string]float64
+	gauges     map[string]float64
+	histograms map[string][]float64
+}
+
+var _ Sink = (*MemorySink)(nil)
+
+func NewMemorySink() *MemorySink {
+	return &MemorySink{
+		counters:   make(map[string]float64),
+		gauges:     make(map[string]float64),
+		histograms: make(map[string][]float64),
+	}
+}
+
+// Key formats the name and labels of a series, like name{a="x",b="y"}, with the labels sorted by name.
+func Key(name string, labels ...Label) string {
+	if len(labels) == 0 {
+		return name
+	}
+	sorted := append([]Label(nil), labels...)
+	sort.Slice(sorted, func(i, j int) bool {
+		return sorted[i].Name < sorted[j].Name
+	})
+	var b strings.Builder
+	b.WriteString(name)
+	b.WriteByte('{')
+	for i, l := range sorted {
+		if i > 0 {
+			b.WriteByte(',')
+		}
+		b.WriteString(l.Name)
+		b.WriteString(`="`)
+		b.WriteString(l.Value)
+		b.WriteByte('"')
+	}
+	b.WriteByte('}')
+	return b.String()
+}
+
+func (m *MemorySink) Add(name string, delta float64, labels ...Label) {
+	key := Key(name, labels...)
+	m.mu.Lock()
+	m.counters[key] += delta
+	m.mu.Unlock()
+}
+
+func (m *MemorySink) Set(name string, value float64, labels ...Label) {
+	key := Key(name, labels...)
+	m.mu.Lock()
+	m.gauges[key] = value
+	m.mu.Unlock()
+}
+
+func (m *MemorySink) Observe(name string, value float64, labels ...Label) {
+	key := Key(name, labels...)
+	m.mu.Lock()
+	m.histograms[key] = append(m.histograms[key], value)
+	m.mu.Unlock()
+}
+
+// Snapshot is a copy of the metrics of a MemorySink, by series key (see Key).
+type Snapshot struct {
+	Counters map[string]float64
+	Gauges   map[string]float64
+	// All observed values of the histograms, in order of observation
+	Histograms map[string][]float64
+}
+
+// Snapshot copies the current metrics.
+func (m *MemorySink) Snapshot() Snapshot {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	out := Snapshot{
+		Counters:   make(map[string]float64, len(m.counters)),
+		Gauges:     make(map[string]float64, len(m.gauges)),
+		Histograms: make(map[string][]float64, len(m.histograms)),
+	}
+	for k, v := range m.counters {
+		out.Counters[k] = v
+	}
+	for k, v := range m.gauges {
+		out.Gauges[k] = v
+	}
+	for k, v := range m.histograms {
+		out.Histograms[k] = append([]float64(nil), v...)
+	}
+	return out
+}
@@ -0,0 +1,30 @@
+package metrics
+
+import "testing"
+
+func TestMemorySink(t *testing.T) {
+	m := NewMemorySink()
+	m.Add("ops", 1, Label{"kind", "deposit"})
+	m.Add("ops", 2, Label{"kind", "deposit"})
+	m.Add("ops", 1)
+	m.Set("size", 3, Label{"b", "2"}, Label{"a", "1"})
+	m.Set("size", 4, Label{"a", "1"}, Label{"b", "2"})
+	m.Observe("duration", 0.5)
+	m.Observe("duration", 0.25)
+
+	s := m.Snapshot()
+	if s.Counters[`ops{kind="deposit"}`] != 3 || s.Counters["ops"] != 1 {
+		t.Fatalf("unexpected counters: %v", s.Counters)
+	}
+	if len(s.Gauges) != 1 || s.Gauges[`size{a="1",b="2"}`] != 4 {
+		t.Fatalf("unexpected gauges: %v", s.Gauges)
+	}
+	if h := s.Histograms["duration"]; len(h) != 2 || h[0] != 0.5 || h[1] != 0.25 {
+		t.Fatalf("unexpected histogram: %v", h)
+	}
+	// the snapshot is a copy
+	m.Observe("duration", 1)
+	if len(s.Histograms["duration"]) != 2 {
+		t.Fatal("expected snapshot to be unaffected")
+	}
+}
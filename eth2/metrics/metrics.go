@@ -0,0 +1,47 @@
+// Package metrics defines the sink that the transition reports its metrics to,
+// to plug in the metrics system of the user, like Prometheus.
+package metrics
+
+// Label is a name and value pair, to distinguish the series of a metric.
+type Label struct {
+	Name  string
+	Value string
+}
+
+// Sink receives the metrics. A sink must be safe for concurrent use:
+// signatures, for example, are verified by multiple workers.
+//
+// Users of a sink keep it optional: a nil sink is checked before computing a metric,
+// so the default of no metrics costs nothing.
+type Sink interface {
+	// Add adds the delta to the counter.
+	Add(name string, delta float64, labels ...Label)
+	// Set sets the gauge to the value.
+	Set(name string, value float64, labels ...Label)
+	// Observe adds the value to the histogram.
+	Observe(name string, value float64, labels ...Label)
+}
+
+// The metrics of the transition.
+const (
+	// Histogram of the epoch transition duration, in seconds.
+	EpochTransitionSeconds = "epoch_transition_seconds"
+	// Histogram of the block processing duration, in seconds. Excludes the slot processing up to the block.
+	BlockTransitionSeconds = "block_transition_seconds"
+	// Histogram of the duration of the block stages, in seconds, labeled by stage.
+	BlockStageSeconds = "block_stage_seconds"
+	// Histogram of the duration of the epoch stages, in seconds, labeled by stage.
+	EpochStageSeconds = "epoch_stage_seconds"
+	// Counter of the verified signatures, labeled by kind.
+	SignatureVerifications = "signature_verifications_total"
+	// Gauges of the hits and misses of the caches of the epochs context, labeled by cache.
+	CacheHits   = "cache_hits"
+	CacheMisses = "cache_misses"
+)
+
+// The label names of the transition metrics.
+const (
+	LabelStage = "stage"
+	LabelKind  = "kind"
+	LabelCache = "cache"
+)
@@ -0,0 +1,449 @@
+package monitor
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	"github.com/protolambda/zrnt/eth2/beacon"
+	"github.com/protolambda/zrnt/eth2/beacon/common"
+)
+
+type dutyKey struct {
+	Epoch     common.Epoch
+	Shuffling common.ShufflingKey
+	Index     common.ValidatorIndex
+}
+
+// epochDuties are the attestation duties of an epoch, as assigned by one shuffling.
+// Forks with a different shuffling of the epoch have their own duties.
+type epochDuties struct {
+	// duties keyed by validator index
+	duties map[common.ValidatorIndex]*AttestationDuty
+	// blocks that used the shuffling, by root. Without blocks, the duties are dropped
+	// when there are duties of another shuffling of the epoch.
+	blocks map[common.Root]common.Slot
+}
+
+// latest returns the slot of the latest block that used the shuffling.
+func (ed *epochDuties) latest() (slot common.Slot) {
+	for _, s := range ed.blocks {
+		if s > slot {
+			slot = s
+		}
+	}
+	return
+}
+
+// blockRefs are the duties that a block included attestations for.
+type blockRefs struct {
+	Slot   common.Slot
+	Duties []dutyKey
+}
+
+// Inclusion describes a block that included an attestation with the bit of the validator set.
+type Inclusion struct {
+	// Root of the block that included the attestation
+	BlockRoot common.Root
+	// Slot of the block that included the attestation
+	Slot common.Slot
+	// If the target vote matched the chain of the including block
+	CorrectTarget bool
+	// If the head vote matched the chain of the including block
+	CorrectHead bool
+}
+
+type AttestationDuty struct {
+	Slot      common.Slot
+	Committee common.CommitteeIndex
+	// Every block that included the validator, possibly on different forks.
+	// Blocks that get reorged out should be removed with RemoveBlock.
+	Inclusions []Inclusion
+}
+
+// Best returns the earliest inclusion of the duty, if any.
+func (d *AttestationDuty) Best() (out Inclusion, ok bool) {
+	for _, incl := range d.Inclusions {
+		if !ok || incl.Slot < out.Slot {
+			out = incl
+			ok = true
+		}
+	}
+	return
+}
+
+type AttestationPerformance struct {
+	// Number of attestation duties within the requested range
+	Duties uint64
+	// Number of duties with an included attestation
+	Included uint64
+	// Number of duties without inclusion that can still be included
+	Pending uint64
+	// Number of included attestations with a correct target vote
+	CorrectTarget uint64
+	// Number of included attestations with a correct head vote
+	CorrectHead uint64
+	// Sum of the inclusion distances of the included attestations, see AvgInclusionDistance
+	InclusionDistanceSum uint64
+}
+
+// Missed is the number of duties that were not included and can not be included anymore.
+func (p *AttestationPerformance) Missed() uint64 {
+	return p.Duties - p.Included - p.Pending
+}
+
+func (p *AttestationPerformance) AvgInclusionDistance() float64 {
+	if p.Included == 0 {
+		return 0
+	}
+	return float64(p.InclusionDistanceSum) / float64(p.Included)
+}
+
+// AttestationTracker matches attestations of blocks back to the attestation duties of validators,
+// to track the attestation effectiveness of each validator over a rolling window of epochs.
+// Blocks are added with OnBlock, and removed with RemoveBlock when they get reorged out of the chain.
+//
+// The duties of an epoch are tracked per shuffling: a reorg can change the shuffling of an epoch,
+// and with it the duties. Duty and Performance use the shuffling of the latest block that is not removed.
+type AttestationTracker struct {
+	sync.RWMutex
+	spec *common.Spec
+	// Number of epochs to keep duties for
+	maxEpochs uint64
+	// duties per epoch, per shuffling
+	duties map[common.Epoch]map[common.ShufflingKey]*epochDuties
+	// shuffling ID -> key of the shuffling, to not digest the same shuffling for every block
+	keys map[uint64]common.ShufflingKey
+	// block root -> duties that the block included attestations for.
+	// Blocks without any tracked duties are not kept.
+	byBlock map[common.Root]*blockRefs
+	// the highest slot of any block seen so far
+	latestSlot common.Slot
+}
+
+func NewAttestationTracker(spec *common.Spec, maxEpochs uint64) *AttestationTracker {
+	return &AttestationTracker{
+		spec:      spec,
+		maxEpochs: maxEpochs,
+		duties:    make(map[common.Epoch]map[common.ShufflingKey]*epochDuties),
+		keys:      make(map[uint64]common.ShufflingKey),
+		byBlock:   make(map[common.Root]*blockRefs),
+	}
+}
+
+func (at *AttestationTracker) shufflingKey(state common.BeaconState, shuf *common.ShufflingEpoch) (common.ShufflingKey, error) {
+	if key, ok := at.keys[shuf.ID()]; ok {
+		return key, nil
+	}
+	mixes, err := state.RandaoMixes()
+	if err != nil {
+		return common.ShufflingKey{}, err
+	}
+	seed, err := common.GetSeed(at.spec, mixes, shuf.Epoch, common.DOMAIN_BEACON_ATTESTER)
+	if err != nil {
+		return common.ShufflingKey{}, err
+	}
+	key := common.NewShufflingKey(at.spec, shuf.Epoch, seed, shuf.ActiveIndices)
+	at.keys[shuf.ID()] = key
+	return key, nil
+}
+
+// registerDuties registers the duties of the shuffling if they were not already,
+// and the block as a user of the shuffling.
+func (at *AttestationTracker) registerDuties(key common.ShufflingKey, shuf *common.ShufflingEpoch, root common.Root, slot common.Slot) {
+	byShuffling, ok := at.duties[shuf.Epoch]
+	if !ok {
+		byShuffling = make(map[common.ShufflingKey]*epochDuties)
+		at.duties[shuf.Epoch] = byShuffling
+	}
+	ed, ok := byShuffling[key]
+	if !ok {
+		startSlot, _ := at.spec.EpochStartSlot(shuf.Epoch)
+		ed = &epochDuties{
+			duties: make(map[common.ValidatorIndex]*AttestationDuty, len(shuf.ActiveIndices)),
+			blocks: make(map[common.Root]common.Slot),
+		}
+		for i, slotComms := range shuf.Committees {
+			for j, comm := range slotComms {
+				for _, vi := range comm {
+					ed.duties[vi] = &AttestationDuty{
+						Slot:      startSlot + common.Slot(i),
+						Committee: common.CommitteeIndex(j),
+					}
+				}
+			}
+		}
+		byShuffling[key] = ed
+	}
+	ed.blocks[root] = slot
+	// all blocks of other shufflings were removed, e.g. by a reorg to this shuffling
+	for otherKey, other := range byShuffling {
+		if len(other.blocks) == 0 {
+			at.dropDuties(shuf.Epoch, otherKey, other)
+		}
+	}
+}
+
+// epochDuties returns the duties of the epoch, as assigned by the shuffling of the latest block.
+func (at *AttestationTracker) epochDuties(epoch common.Epoch) *epochDuties {
+	var out *epochDuties
+	var outSlot common.Slot
+	for _, ed := range at.duties[epoch] {
+		if slot := ed.latest(); out == nil || slot > outSlot {
+			out = ed
+			outSlot = slot
+		}
+	}
+	return out
+}
+
+// OnBlock registers the attestations included in the block.
+// The entry must be the chain entry of the block, its EpochsContext and post-state are used
+// to get the committees and to check the head and target votes.
+// The duties of the previous and current epoch of the block are registered if they were not already.
+func (at *AttestationTracker) OnBlock(ctx context.Context, entry beacon.ChainEntry, benv *common.BeaconBlockEnvelope) error {
+	atts, err := beacon.EnvelopeAttestations(benv)
+	if err != nil {
+		return err
+	}
+	epc, err := entry.EpochsContext(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to get epochs context of block %s: %v", benv.BlockRoot, err)
+	}
+	state, err := entry.State(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to get state of block %s: %v", benv.BlockRoot, err)
+	}
+
+	at.Lock()
+	defer at.Unlock()
+
+	if _, ok := at.byBlock[benv.BlockRoot]; ok {
+		// already processed this block.
+		// Blocks without tracked duties may be processed again, which does not change anything.
+		return nil
+	}
+
+	prevKey, err := at.shufflingKey(state, epc.PreviousEpoch)
+	if err != nil {
+		return fmt.Errorf("failed to identify previous shuffling of block %s: %v", benv.BlockRoot, err)
+	}
+	currKey, err := at.shufflingKey(state, epc.CurrentEpoch)
+	if err != nil {
+		return fmt.Errorf("failed to identify current shuffling of block %s: %v", benv.BlockRoot, err)
+	}
+	at.registerDuties(prevKey, epc.PreviousEpoch, benv.BlockRoot, benv.Slot)
+	at.registerDuties(currKey, epc.CurrentEpoch, benv.BlockRoot, benv.Slot)
+
+	var included []dutyKey
+	for i := range atts {
+		att := &atts[i]
+		comm, err := epc.GetBeaconCommittee(att.Data.Slot, att.Data.Index)
+		if err != nil {
+			return fmt.Errorf("failed to get committee of attestation %d: %v", i, err)
+		}
+		if bl := att.AggregationBits.BitLen(); bl != uint64(len(comm)) {
+			return fmt.Errorf("attestation %d has bitlength %d, but expected %d bits", i, bl, len(comm))
+		}
+		targetRoot, err := common.GetBlockRoot(at.spec, state, att.Data.Target.Epoch)
+		if err != nil {
+			return fmt.Errorf("failed to get target root of attestation %d: %v", i, err)
+		}
+		headRoot, err := common.GetBlockRootAtSlot(at.spec, state, att.Data.Slot)
+		if err != nil {
+			return fmt.Errorf("failed to get head root of attestation %d: %v", i, err)
+		}
+		incl := Inclusion{
+			BlockRoot:     benv.BlockRoot,
+			Slot:          benv.Slot,
+			CorrectTarget: targetRoot == att.Data.Target.Root,
+			CorrectHead:   headRoot == att.Data.BeaconBlockRoot,
+		}
+		var key common.ShufflingKey
+		switch att.Data.Target.Epoch {
+		case epc.PreviousEpoch.Epoch:
+			key = prevKey
+		case epc.CurrentEpoch.Epoch:
+			key = currKey
+		default:
+			continue
+		}
+		ed, ok := at.duties[att.Data.Target.Epoch][key]
+		if !ok {
+			continue
+		}
+		// filtering happens in-place, copy the committee to not modify the shuffling of the context.
+		participants := att.AggregationBits.FilterParticipants(append([]common.ValidatorIndex(nil), comm...))
+	participants:
+		for _, vi := range participants {
+			duty, ok := ed.duties[vi]
+			if !ok {
+				continue
+			}
+			// the same validator may be part of multiple aggregates in the same block
+			for _, existing := range duty.Inclusions {
+				if existing.BlockRoot == benv.BlockRoot {
+					continue participants
+				}
+			}
+			duty.Inclusions = append(duty.Inclusions, incl)
+			included = append(included, dutyKey{Epoch: att.Data.Target.Epoch, Shuffling: key, Index: vi})
+		}
+	}
+	if len(included) > 0 {
+		at.byBlock[benv.BlockRoot] = &blockRefs{Slot: benv.Slot, Duties: included}
+	}
+
+	if benv.Slot > at.latestSlot {
+		at.latestSlot = benv.Slot
+		at.prune()
+	}
+	return nil
+}
+
+// RemoveBlock un-includes all attestations of the given block, e.g. when the block is reorged out.
+// The duties of a shuffling are dropped when no remaining block uses the shuffling,
+// unless it is the only tracked shuffling of the epoch.
+func (at *AttestationTracker) RemoveBlock(root common.Root) {
+	at.Lock()
+	defer at.Unlock()
+	if refs, ok := at.byBlock[root]; ok {
+		for _, k := range refs.Duties {
+			ed, ok := at.duties[k.Epoch][k.Shuffling]
+			if !ok {
+				continue
+			}
+			duty, ok := ed.duties[k.Index]
+			if !ok {
+				continue
+			}
+			for i, incl := range duty.Inclusions {
+				if incl.BlockRoot == root {
+					duty.Inclusions = append(duty.Inclusions[:i], duty.Inclusions[i+1:]...)
+					break
+				}
+			}
+		}
+		delete(at.byBlock, root)
+	}
+	for epoch, byShuffling := range at.duties {
+		for key, ed := range byShuffling {
+			if _, ok := ed.blocks[root]; !ok {
+				continue
+			}
+			delete(ed.blocks, root)
+			if len(ed.blocks) == 0 && len(byShuffling) > 1 {
+				at.dropDuties(epoch, key, ed)
+			}
+		}
+	}
+}
+
+// dropDuties deletes the duties of the shuffling, and the references of blocks to them.
+func (at *AttestationTracker) dropDuties(epoch common.Epoch, key common.ShufflingKey, ed *epochDuties) {
+	delete(at.duties[epoch], key)
+	for vi, duty := range ed.duties {
+		k := dutyKey{Epoch: epoch, Shuffling: key, Index: vi}
+		for _, incl := range duty.Inclusions {
+			at.removeBlockRef(incl.BlockRoot, k)
+		}
+	}
+}
+
+func (at *AttestationTracker) prune() {
+	current := at.spec.SlotToEpoch(at.latestSlot)
+	if uint64(current) < at.maxEpochs {
+		return
+	}
+	min := current - common.Epoch(at.maxEpochs)
+	for epoch, byShuffling := range at.duties {
+		if epoch < min {
+			for key, ed := range byShuffling {
+				at.dropDuties(epoch, key, ed)
+			}
+			delete(at.duties, epoch)
+		}
+	}
+	for id, key := range at.keys {
+		if key.Epoch < min {
+			delete(at.keys, id)
+		}
+	}
+	// blocks before the window can only include duties of pruned epochs
+	minSlot, _ := at.spec.EpochStartSlot(min)
+	for root, refs := range at.byBlock {
+		if refs.Slot < minSlot {
+			delete(at.byBlock, root)
+		}
+	}
+}
+
+func (at *AttestationTracker) removeBlockRef(root common.Root, k dutyKey) {
+	refs, ok := at.byBlock[root]
+	if !ok {
+		return
+	}
+	for i, other := range refs.Duties {
+		if other == k {
+			refs.Duties = append(refs.Duties[:i], refs.Duties[i+1:]...)
+			break
+		}
+	}
+	if len(refs.Duties) == 0 {
+		delete(at.byBlock, root)
+	}
+}
+
+// Duty returns a copy of the attestation duty of the validator in the given epoch, if it is tracked.
+// The duty is assigned by the shuffling of the latest block.
+func (at *AttestationTracker) Duty(index common.ValidatorIndex, epoch common.Epoch) (out AttestationDuty, ok bool) {
+	at.RLock()
+	defer at.RUnlock()
+	ed := at.epochDuties(epoch)
+	if ed == nil {
+		return AttestationDuty{}, false
+	}
+	duty, ok := ed.duties[index]
+	if !ok {
+		return AttestationDuty{}, false
+	}
+	out = *duty
+	out.Inclusions = append([]Inclusion(nil), duty.Inclusions...)
+	return out, true
+}
+
+// Performance summarizes the attestation duties of the validator over the last N epochs,
+// up to and including the epoch of the latest block.
+func (at *AttestationTracker) Performance(index common.ValidatorIndex, lastNEpochs uint64) (out AttestationPerformance) {
+	at.RLock()
+	defer at.RUnlock()
+	current := at.spec.SlotToEpoch(at.latestSlot)
+	for i := uint64(0); i < lastNEpochs && i <= uint64(current); i++ {
+		ed := at.epochDuties(current - common.Epoch(i))
+		if ed == nil {
+			continue
+		}
+		duty, ok := ed.duties[index]
+		if !ok {
+			continue
+		}
+		if duty.Slot >= at.latestSlot {
+			// not a duty yet that could have been included
+			continue
+		}
+		out.Duties += 1
+		if incl, ok := duty.Best(); ok {
+			out.Included += 1
+			out.InclusionDistanceSum += uint64(incl.Slot - duty.Slot)
+			if incl.CorrectTarget {
+				out.CorrectTarget += 1
+			}
+			if incl.CorrectHead {
+				out.CorrectHead += 1
+			}
+		} else if duty.Slot+at.spec.SLOTS_PER_EPOCH >= at.latestSlot {
+			out.Pending += 1
+		}
+	}
+	return
+}
@@ -0,0 +1,247 @@
+package monitor
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	"github.com/protolambda/zrnt/eth2/beacon"
+	"github.com/protolambda/zrnt/eth2/beacon/common"
+)
+
+func TestAttestationTrackerLateInclusion(t *testing.T) {
+	entries := makeTestEntries(t, 12)
+	tracker := NewAttestationTracker(spec, 4)
+
+	// attestation for the last slot of epoch 0, included in epoch 1.
+	dutySlot := common.Slot(7)
+	inclEntry := entries[10]
+	att := makeTestAttestation(t, inclEntry, dutySlot, 0, 0)
+	comm, err := inclEntry.epc.GetBeaconCommittee(dutySlot, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	attester := comm[0]
+	block := makeTestBlock(inclEntry, common.Root{0xaa}, 0, att)
+	if err := tracker.OnBlock(context.Background(), inclEntry, block); err != nil {
+		t.Fatal(err)
+	}
+
+	duty, ok := tracker.Duty(attester, 0)
+	if !ok {
+		t.Fatal("expected duty in epoch 0 to be registered")
+	}
+	if duty.Slot != dutySlot {
+		t.Fatalf("expected duty at slot %d, got %d", dutySlot, duty.Slot)
+	}
+	// the epoch 1 duty only counts once its slot has passed
+	expectedDuties := uint64(1)
+	if next, ok := tracker.Duty(attester, 1); !ok {
+		t.Fatal("expected duty in epoch 1 to be registered")
+	} else if next.Slot < inclEntry.step.Slot() {
+		expectedDuties += 1
+	}
+	perf := tracker.Performance(attester, 2)
+	if perf.Duties != expectedDuties {
+		t.Fatalf("expected %d duties, got %d", expectedDuties, perf.Duties)
+	}
+	if perf.Included != 1 || perf.CorrectTarget != 1 || perf.CorrectHead != 1 {
+		t.Fatalf("unexpected performance: %+v", perf)
+	}
+	if d := perf.AvgInclusionDistance(); d != 3 {
+		t.Fatalf("expected inclusion distance 3, got %f", d)
+	}
+
+	// a validator of the same committee that did not attest
+	other := comm[1]
+	perf = tracker.Performance(other, 2)
+	if perf.Included != 0 || perf.Missed()+perf.Pending != perf.Duties {
+		t.Fatalf("unexpected performance of non-attester: %+v", perf)
+	}
+}
+
+func TestAttestationTrackerReorg(t *testing.T) {
+	entries := makeTestEntries(t, 8)
+	tracker := NewAttestationTracker(spec, 4)
+
+	dutySlot := common.Slot(3)
+	inclEntry := entries[4]
+	att := makeTestAttestation(t, inclEntry, dutySlot, 0, 0)
+	comm, err := inclEntry.epc.GetBeaconCommittee(dutySlot, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	attester := comm[0]
+
+	// included in a block that gets reorged out, and later on in the canonical chain again.
+	orphan := makeTestBlock(inclEntry, common.Root{0x01}, 0, att)
+	if err := tracker.OnBlock(context.Background(), inclEntry, orphan); err != nil {
+		t.Fatal(err)
+	}
+	canonEntry := entries[6]
+	canon := makeTestBlock(canonEntry, common.Root{0x02}, 0, att)
+	if err := tracker.OnBlock(context.Background(), canonEntry, canon); err != nil {
+		t.Fatal(err)
+	}
+	if perf := tracker.Performance(attester, 1); perf.Included != 1 || perf.InclusionDistanceSum != 1 {
+		t.Fatalf("expected earliest inclusion to count, got %+v", perf)
+	}
+
+	tracker.RemoveBlock(common.Root{0x01})
+	if perf := tracker.Performance(attester, 1); perf.Included != 1 || perf.InclusionDistanceSum != 3 {
+		t.Fatalf("expected remaining inclusion to count, got %+v", perf)
+	}
+
+	tracker.RemoveBlock(common.Root{0x02})
+	perf := tracker.Performance(attester, 1)
+	if perf.Included != 0 {
+		t.Fatalf("expected attestation to be un-included, got %+v", perf)
+	}
+	if perf.Pending != 1 {
+		t.Fatalf("expected duty to still be includable, got %+v", perf)
+	}
+}
+
+// makeTestForkEntry copies the entry into a fork with a different randao mix of the given epoch,
+// and with that a different shuffling of the epochs that are seeded by the mix.
+func makeTestForkEntry(t *testing.T, entry *testEntry, slot common.Slot, mixEpoch common.Epoch) *testEntry {
+	state, err := entry.state.CopyState()
+	if err != nil {
+		t.Fatal(err)
+	}
+	up := &beacon.StandardUpgradeableBeaconState{BeaconState: state}
+	if err := common.ProcessSlots(context.Background(), spec, entry.epc.Clone(), up, slot); err != nil {
+		t.Fatal(err)
+	}
+	mixes, err := up.BeaconState.RandaoMixes()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := mixes.SetRandomMix(mixEpoch, common.Root{0xff}); err != nil {
+		t.Fatal(err)
+	}
+	epc, err := common.NewEpochsContext(spec, up.BeaconState)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &testEntry{
+		step:      common.AsStep(slot, false),
+		blockRoot: common.Root{0xf0},
+		state:     up.BeaconState,
+		epc:       epc,
+	}
+}
+
+func TestAttestationTrackerReorgShuffling(t *testing.T) {
+	entries := makeTestEntries(t, 21)
+	tracker := NewAttestationTracker(spec, 4)
+
+	// the shuffling of epoch 2 is seeded by the randao mix of epoch 0
+	canonEntry := entries[20]
+	forkEntry := makeTestForkEntry(t, entries[20], 21, 0)
+	epoch := common.Epoch(2)
+	dutySlot := common.Slot(17)
+	att := makeTestAttestation(t, canonEntry, dutySlot, 0, 0)
+	comm, err := canonEntry.epc.GetBeaconCommittee(dutySlot, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	attester := comm[0]
+
+	// checkDuties checks that the duties of the epoch follow the shuffling of the given context
+	checkDuties := func(epc *common.EpochsContext) {
+		t.Helper()
+		startSlot, _ := spec.EpochStartSlot(epoch)
+		for i, slotComms := range epc.CurrentEpoch.Committees {
+			for j, comm := range slotComms {
+				for _, vi := range comm {
+					duty, ok := tracker.Duty(vi, epoch)
+					if !ok {
+						t.Fatalf("expected duty of validator %d", vi)
+					}
+					if duty.Slot != startSlot+common.Slot(i) || duty.Committee != common.CommitteeIndex(j) {
+						t.Fatalf("validator %d: expected duty at slot %d committee %d, got slot %d committee %d",
+							vi, startSlot+common.Slot(i), j, duty.Slot, duty.Committee)
+					}
+				}
+			}
+		}
+	}
+
+	if canonEntry.epc.CurrentEpoch.Epoch != epoch || forkEntry.epc.CurrentEpoch.Epoch != epoch {
+		t.Fatal("expected the entries to be in the same epoch")
+	}
+	if reflect.DeepEqual(canonEntry.epc.CurrentEpoch.Shuffling, forkEntry.epc.CurrentEpoch.Shuffling) {
+		t.Fatal("expected the fork to have a different shuffling")
+	}
+	if err := tracker.OnBlock(context.Background(), canonEntry, makeTestBlock(canonEntry, common.Root{0x01}, 0, att)); err != nil {
+		t.Fatal(err)
+	}
+	checkDuties(canonEntry.epc)
+	if perf := tracker.Performance(attester, 1); perf.Included != 1 {
+		t.Fatalf("expected inclusion, got %+v", perf)
+	}
+
+	// a later block of a fork with a different shuffling
+	if err := tracker.OnBlock(context.Background(), forkEntry, makeTestBlock(forkEntry, common.Root{0x02}, 0)); err != nil {
+		t.Fatal(err)
+	}
+	checkDuties(forkEntry.epc)
+
+	// the fork is removed, the duties of the canonical chain are used again
+	tracker.RemoveBlock(common.Root{0x02})
+	checkDuties(canonEntry.epc)
+	if n := len(tracker.duties[epoch]); n != 1 {
+		t.Fatalf("expected only the canonical shuffling to remain, got %d", n)
+	}
+	if perf := tracker.Performance(attester, 1); perf.Included != 1 {
+		t.Fatalf("expected inclusion, got %+v", perf)
+	}
+
+	// reorg to the fork: the canonical block is removed first, then the fork is added
+	tracker.RemoveBlock(common.Root{0x01})
+	if err := tracker.OnBlock(context.Background(), forkEntry, makeTestBlock(forkEntry, common.Root{0x02}, 0)); err != nil {
+		t.Fatal(err)
+	}
+	checkDuties(forkEntry.epc)
+	if n := len(tracker.duties[epoch]); n != 1 {
+		t.Fatalf("expected the stale shuffling to be dropped, got %d", n)
+	}
+	if n := len(tracker.byBlock); n != 0 {
+		t.Fatalf("expected no block entries, got %d", n)
+	}
+}
+
+func TestAttestationTrackerPruneBlocks(t *testing.T) {
+	entries := makeTestEntries(t, 26)
+	tracker := NewAttestationTracker(spec, 1)
+
+	// a block without attestations has nothing to remember
+	if err := tracker.OnBlock(context.Background(), entries[2], makeTestBlock(entries[2], common.Root{0x01}, 0)); err != nil {
+		t.Fatal(err)
+	}
+	if n := len(tracker.byBlock); n != 0 {
+		t.Fatalf("expected no block entries, got %d", n)
+	}
+
+	inclEntry := entries[4]
+	att := makeTestAttestation(t, inclEntry, 3, 0, 0)
+	if err := tracker.OnBlock(context.Background(), inclEntry, makeTestBlock(inclEntry, common.Root{0x02}, 0, att)); err != nil {
+		t.Fatal(err)
+	}
+	if n := len(tracker.byBlock); n != 1 {
+		t.Fatalf("expected 1 block entry, got %d", n)
+	}
+
+	// two epochs later, the duties of epoch 0, and the block that included them, are pruned
+	lastEntry := entries[25]
+	if err := tracker.OnBlock(context.Background(), lastEntry, makeTestBlock(lastEntry, common.Root{0x03}, 0)); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := tracker.Duty(0, 0); ok {
+		t.Fatal("expected duties of epoch 0 to be pruned")
+	}
+	if n := len(tracker.byBlock); n != 0 {
+		t.Fatalf("expected block entries to be pruned, got %d", n)
+	}
+}
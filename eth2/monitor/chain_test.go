@@ -0,0 +1,270 @@
+package monitor
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/protolambda/zrnt/eth2/beacon"
+	"github.com/protolambda/zrnt/eth2/beacon/common"
+	"github.com/protolambda/zrnt/eth2/beacon/phase0"
+	"github.com/protolambda/zrnt/eth2/beacon/testutil"
+	"github.com/protolambda/zrnt/eth2/configs"
+	"github.com/protolambda/ztyp/tree"
+)
+
+var spec = configs.Minimal
+
+const testValidatorCount = 64
+
+// testEntry is a chain entry backed by a state that was transitioned with empty slots only.
+type testEntry struct {
+	step      common.Step
+	blockRoot common.Root
+	state     common.BeaconState
+	epc       *common.EpochsContext
+}
+
+func (e *testEntry) Step() common.Step {
+	return e.step
+}
+
+func (e *testEntry) BlockRoot() (common.Root, error) {
+	return e.blockRoot, nil
+}
+
+func (e *testEntry) ParentRoot() (common.Root, error) {
+	return e.blockRoot, nil
+}
+
+func (e *testEntry) StateRoot() (common.Root, error) {
+	return e.state.HashTreeRoot(tree.GetHashFn()), nil
+}
+
+func (e *testEntry) EpochsContext(ctx context.Context) (*common.EpochsContext, error) {
+	return e.epc, nil
+}
+
+func (e *testEntry) State(ctx context.Context) (common.BeaconState, error) {
+	return e.state, nil
+}
+
+var _ beacon.ChainEntry = (*testEntry)(nil)
+
+// markTestBlock turns the entry into a block entry, proposed by the given proposer.
+func markTestBlock(t *testing.T, entry *testEntry, root common.Root, proposer common.ValidatorIndex) {
+	slot := entry.step.Slot()
+	if err := entry.state.SetLatestBlockHeader(&common.BeaconBlockHeader{
+		Slot:          slot,
+		ProposerIndex: proposer,
+	}); err != nil {
+		t.Fatal(err)
+	}
+	entry.step = common.AsStep(slot, true)
+	entry.blockRoot = root
+}
+
+// testChain is a canonical chain of test entries, one per slot, the last entry is the head.
+type testChain struct {
+	entries []*testEntry
+}
+
+func (c *testChain) entry(step common.Step) (*testEntry, bool) {
+	slot := step.Slot()
+	if uint64(slot) >= uint64(len(c.entries)) {
+		return nil, false
+	}
+	e := c.entries[slot]
+	if step.Block() && !e.step.Block() {
+		return nil, false
+	}
+	return e, true
+}
+
+func (c *testChain) ByStateRoot(root common.Root) (entry beacon.ChainEntry, ok bool) {
+	for _, e := range c.entries {
+		if r, _ := e.StateRoot(); r == root {
+			return e, true
+		}
+	}
+	return nil, false
+}
+
+func (c *testChain) ByBlock(root common.Root) (entry beacon.ChainEntry, ok bool) {
+	for _, e := range c.entries {
+		if e.step.Block() && e.blockRoot == root {
+			return e, true
+		}
+	}
+	return nil, false
+}
+
+func (c *testChain) ByBlockSlot(root common.Root, slot common.Slot) (entry beacon.ChainEntry, ok bool) {
+	e, ok := c.entry(common.AsStep(slot, false))
+	if !ok || e.blockRoot != root {
+		return nil, false
+	}
+	return e, true
+}
+
+func (c *testChain) Search(parentRoot *common.Root, slot *common.Slot) ([]beacon.SearchEntry, error) {
+	return nil, nil
+}
+
+func (c *testChain) Closest(fromBlockRoot common.Root, toSlot common.Slot) (entry beacon.ChainEntry, ok bool) {
+	return nil, false
+}
+
+func (c *testChain) InSubtree(anchor common.Root, root common.Root) (unknown bool, inSubtree bool) {
+	return true, false
+}
+
+func (c *testChain) ByCanonStep(step common.Step) (entry beacon.ChainEntry, ok bool) {
+	e, ok := c.entry(step)
+	if !ok {
+		return nil, false
+	}
+	return e, true
+}
+
+func (c *testChain) Iter() (beacon.ChainIter, error) {
+	return (*testChainIter)(c), nil
+}
+
+func (c *testChain) JustifiedCheckpoint() common.Checkpoint {
+	return common.Checkpoint{Root: c.entries[0].blockRoot}
+}
+
+func (c *testChain) FinalizedCheckpoint() common.Checkpoint {
+	return common.Checkpoint{Root: c.entries[0].blockRoot}
+}
+
+func (c *testChain) Justified() (beacon.ChainEntry, error) {
+	return c.entries[0], nil
+}
+
+func (c *testChain) Finalized() (beacon.ChainEntry, error) {
+	return c.entries[0], nil
+}
+
+func (c *testChain) Head() (beacon.ChainEntry, error) {
+	return c.entries[len(c.entries)-1], nil
+}
+
+func (c *testChain) Towards(ctx context.Context, fromBlockRoot common.Root, toSlot common.Slot) (beacon.ChainEntry, error) {
+	return nil, errors.New("not supported")
+}
+
+func (c *testChain) Genesis() beacon.GenesisInfo {
+	return beacon.GenesisInfo{}
+}
+
+var _ beacon.Chain = (*testChain)(nil)
+
+type testChainIter testChain
+
+func (it *testChainIter) Start() common.Step {
+	return common.AsStep(0, false)
+}
+
+func (it *testChainIter) End() common.Step {
+	return common.AsStep(common.Slot(len(it.entries)), false)
+}
+
+func (it *testChainIter) Entry(step common.Step) (beacon.ChainEntry, error) {
+	if step < it.Start() || step >= it.End() {
+		return nil, fmt.Errorf("step %s out of range", step)
+	}
+	e, ok := (*testChain)(it).entry(step)
+	if !ok {
+		return nil, nil
+	}
+	return e, nil
+}
+
+// makeTestEntries creates a genesis state, and then an entry for every slot up to (excl.) the given slot.
+func makeTestEntries(t *testing.T, slots common.Slot) []*testEntry {
+	genesis, epc, err := testutil.GenerateTestState(spec, testValidatorCount, testutil.StateOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	header, err := genesis.LatestBlockHeader()
+	if err != nil {
+		t.Fatal(err)
+	}
+	header.StateRoot = genesis.HashTreeRoot(tree.GetHashFn())
+	genesisRoot := header.HashTreeRoot(tree.GetHashFn())
+
+	entries := []*testEntry{{
+		step:      common.AsStep(0, true),
+		blockRoot: genesisRoot,
+		state:     genesis,
+		epc:       epc,
+	}}
+	ctx := context.Background()
+	for slot := common.Slot(1); slot < slots; slot++ {
+		prev := entries[len(entries)-1]
+		state, err := prev.state.CopyState()
+		if err != nil {
+			t.Fatal(err)
+		}
+		nextEpc := prev.epc.Clone()
+		up := &beacon.StandardUpgradeableBeaconState{BeaconState: state}
+		if err := common.ProcessSlots(ctx, spec, nextEpc, up, slot); err != nil {
+			t.Fatal(err)
+		}
+		entries = append(entries, &testEntry{
+			step:      common.AsStep(slot, false),
+			blockRoot: genesisRoot,
+			state:     up.BeaconState,
+			epc:       nextEpc,
+		})
+	}
+	return entries
+}
+
+// makeTestAttestation creates an attestation for the given committee of the slot,
+// with correct votes relative to the given entry, and the given participant positions set.
+func makeTestAttestation(t *testing.T, entry *testEntry, slot common.Slot, index common.CommitteeIndex, positions ...uint64) phase0.Attestation {
+	comm, err := entry.epc.GetBeaconCommittee(slot, index)
+	if err != nil {
+		t.Fatal(err)
+	}
+	bits := phase0.AttestationBits(make([]byte, len(comm)/8+1))
+	bits[len(comm)/8] |= 1 << (len(comm) % 8)
+	for _, p := range positions {
+		bits.SetBit(p, true)
+	}
+	epoch := spec.SlotToEpoch(slot)
+	headRoot, err := common.GetBlockRootAtSlot(spec, entry.state, slot)
+	if err != nil {
+		t.Fatal(err)
+	}
+	targetRoot, err := common.GetBlockRoot(spec, entry.state, epoch)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return phase0.Attestation{
+		AggregationBits: bits,
+		Data: phase0.AttestationData{
+			Slot:            slot,
+			Index:           index,
+			BeaconBlockRoot: headRoot,
+			Source:          common.Checkpoint{},
+			Target:          common.Checkpoint{Epoch: epoch, Root: targetRoot},
+		},
+	}
+}
+
+// makeTestBlock creates a block envelope for the slot of the entry, with the given attestations.
+func makeTestBlock(entry *testEntry, root common.Root, proposer common.ValidatorIndex, atts ...phase0.Attestation) *common.BeaconBlockEnvelope {
+	return &common.BeaconBlockEnvelope{
+		BeaconBlockHeader: common.BeaconBlockHeader{
+			Slot:          entry.step.Slot(),
+			ProposerIndex: proposer,
+		},
+		Body:      &phase0.BeaconBlockBody{Attestations: atts},
+		BlockRoot: root,
+	}
+}
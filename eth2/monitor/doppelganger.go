@@ -0,0 +1,224 @@
+package monitor
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/protolambda/zrnt/eth2/beacon"
+	"github.com/protolambda/zrnt/eth2/beacon/altair"
+	"github.com/protolambda/zrnt/eth2/beacon/common"
+	"github.com/protolambda/zrnt/eth2/beacon/phase0"
+)
+
+type DoppelgangerEvidence struct {
+	// Active is true if the validator was definitely active: an attestation was included or a block was proposed.
+	// If false, there is no evidence of the validator being active.
+	Active bool
+	// Slot of the latest evidence: the slot of the attestation duty, or the slot of the proposed block.
+	Slot common.Slot
+	// Proposal is true if the latest evidence is a block proposal.
+	Proposal bool
+}
+
+type doppelgangerSearch struct {
+	spec     *common.Spec
+	minEpoch common.Epoch
+	out      map[common.ValidatorIndex]DoppelgangerEvidence
+}
+
+func (ds *doppelgangerSearch) record(index common.ValidatorIndex, slot common.Slot, proposal bool) {
+	if ev, ok := ds.out[index]; ok && (!ev.Active || slot > ev.Slot) {
+		ds.out[index] = DoppelgangerEvidence{Active: true, Slot: slot, Proposal: proposal}
+	}
+}
+
+func (ds *doppelgangerSearch) pendingAttestations(ctx context.Context, epc *common.EpochsContext, atts *phase0.PendingAttestationsView) error {
+	attIter := atts.ReadonlyIter()
+	for {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		el, ok, err := attIter.Next()
+		if err != nil {
+			return err
+		}
+		if !ok {
+			return nil
+		}
+		attView, err := phase0.AsPendingAttestation(el, nil)
+		if err != nil {
+			return err
+		}
+		att, err := attView.Raw()
+		if err != nil {
+			return err
+		}
+		if att.Data.Target.Epoch < ds.minEpoch {
+			continue
+		}
+		committee, err := epc.GetBeaconCommittee(att.Data.Slot, att.Data.Index)
+		if err != nil {
+			return err
+		}
+		if att.AggregationBits.BitLen() != uint64(len(committee)) {
+			return fmt.Errorf("pending attestation bitlength %d does not match committee size %d",
+				att.AggregationBits.BitLen(), len(committee))
+		}
+		// filtering happens in-place, copy the committee to not modify the shuffling of the context.
+		participants := att.AggregationBits.FilterParticipants(append([]common.ValidatorIndex(nil), committee...))
+		for _, vi := range participants {
+			ds.record(vi, att.Data.Slot, false)
+		}
+	}
+}
+
+func (ds *doppelgangerSearch) participation(shuf *common.ShufflingEpoch, reg *altair.ParticipationRegistryView) error {
+	if shuf.Epoch < ds.minEpoch {
+		return nil
+	}
+	count, err := reg.Length()
+	if err != nil {
+		return err
+	}
+	for vi := range ds.out {
+		if uint64(vi) >= count {
+			continue
+		}
+		flags, err := reg.GetFlags(vi)
+		if err != nil {
+			return err
+		}
+		if flags == 0 {
+			continue
+		}
+		if slot, ok := dutySlot(ds.spec, shuf, vi); ok {
+			ds.record(vi, slot, false)
+		}
+	}
+	return nil
+}
+
+func (ds *doppelgangerSearch) attestations(ctx context.Context, epc *common.EpochsContext, state common.BeaconState) error {
+	switch s := state.(type) {
+	case phase0.Phase0PendingAttestationsBeaconState:
+		prevAtts, err := s.PreviousEpochAttestations()
+		if err != nil {
+			return err
+		}
+		if err := ds.pendingAttestations(ctx, epc, prevAtts); err != nil {
+			return err
+		}
+		currAtts, err := s.CurrentEpochAttestations()
+		if err != nil {
+			return err
+		}
+		return ds.pendingAttestations(ctx, epc, currAtts)
+	case altair.AltairLikeBeaconState:
+		prev, err := s.PreviousEpochParticipation()
+		if err != nil {
+			return err
+		}
+		if err := ds.participation(epc.PreviousEpoch, prev); err != nil {
+			return err
+		}
+		curr, err := s.CurrentEpochParticipation()
+		if err != nil {
+			return err
+		}
+		return ds.participation(epc.CurrentEpoch, curr)
+	default:
+		return fmt.Errorf("cannot read attestations from state of type %T", state)
+	}
+}
+
+// dutySlot finds the slot of the attestation duty of the validator in the given shuffling.
+func dutySlot(spec *common.Spec, shuf *common.ShufflingEpoch, index common.ValidatorIndex) (common.Slot, bool) {
+	startSlot, _ := spec.EpochStartSlot(shuf.Epoch)
+	for i, slotComms := range shuf.Committees {
+		for _, comm := range slotComms {
+			for _, vi := range comm {
+				if vi == index {
+					return startSlot + common.Slot(i), true
+				}
+			}
+		}
+	}
+	return 0, false
+}
+
+// DetectDoppelgangers scans the canonical chain of the last lookbackEpochs epochs (incl. the epoch of the head)
+// for signs of life of the given validators: included attestations and proposed blocks.
+// The result has an entry for every requested index. Indices without evidence have Active set to false.
+func DetectDoppelgangers(ctx context.Context, chain beacon.Chain, spec *common.Spec,
+	indices []common.ValidatorIndex, lookbackEpochs uint64) (map[common.ValidatorIndex]DoppelgangerEvidence, error) {
+
+	ds := &doppelgangerSearch{
+		spec: spec,
+		out:  make(map[common.ValidatorIndex]DoppelgangerEvidence, len(indices)),
+	}
+	for _, vi := range indices {
+		ds.out[vi] = DoppelgangerEvidence{}
+	}
+	if lookbackEpochs == 0 {
+		return ds.out, nil
+	}
+	head, err := chain.Head()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get head: %v", err)
+	}
+	headEpoch := spec.SlotToEpoch(head.Step().Slot())
+	if uint64(headEpoch)+1 > lookbackEpochs {
+		ds.minEpoch = headEpoch + 1 - common.Epoch(lookbackEpochs)
+	}
+	minSlot, err := spec.EpochStartSlot(ds.minEpoch)
+	if err != nil {
+		return nil, err
+	}
+
+	iter, err := chain.Iter()
+	if err != nil {
+		return nil, fmt.Errorf("failed to iterate chain: %v", err)
+	}
+	// The latest block of each epoch has the most complete participation data of the epoch,
+	// and the participation data of the previous epoch, to cover late inclusions.
+	checkedEpoch := headEpoch + 1
+	for step := iter.End(); step > iter.Start(); {
+		step--
+		if step.Slot() < minSlot {
+			break
+		}
+		if !step.Block() {
+			continue
+		}
+		entry, err := iter.Entry(step)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get chain entry at step %s: %v", step, err)
+		}
+		if entry == nil {
+			continue
+		}
+		state, err := entry.State(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get state at step %s: %v", step, err)
+		}
+		header, err := state.LatestBlockHeader()
+		if err != nil {
+			return nil, err
+		}
+		// the genesis block has no actual proposer
+		if header.Slot != common.GENESIS_SLOT {
+			ds.record(header.ProposerIndex, header.Slot, true)
+		}
+		if epoch := spec.SlotToEpoch(step.Slot()); epoch < checkedEpoch {
+			checkedEpoch = epoch
+			epc, err := entry.EpochsContext(ctx)
+			if err != nil {
+				return nil, fmt.Errorf("failed to get epochs context at step %s: %v", step, err)
+			}
+			if err := ds.attestations(ctx, epc, state); err != nil {
+				return nil, fmt.Errorf("failed to check attestations at step %s: %v", step, err)
+			}
+		}
+	}
+	return ds.out, nil
+}
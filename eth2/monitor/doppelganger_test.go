@@ -0,0 +1,67 @@
+package monitor
+
+import (
+	"context"
+	"testing"
+
+	"github.com/protolambda/zrnt/eth2/beacon/common"
+	"github.com/protolambda/zrnt/eth2/beacon/phase0"
+)
+
+func TestDetectDoppelgangers(t *testing.T) {
+	entries := makeTestEntries(t, 20)
+	ch := &testChain{entries: entries}
+
+	dutySlot := common.Slot(16)
+	blockEntry := entries[17]
+	comm, err := blockEntry.epc.GetBeaconCommittee(dutySlot, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	attester, silent, proposer := comm[0], comm[1], comm[2]
+	markTestBlock(t, blockEntry, common.Root{0x17}, proposer)
+
+	att := makeTestAttestation(t, blockEntry, dutySlot, 0, 0)
+	pending := phase0.PendingAttestation{
+		AggregationBits: att.AggregationBits,
+		Data:            att.Data,
+		InclusionDelay:  1,
+		ProposerIndex:   proposer,
+	}
+	currAtts, err := blockEntry.state.(*phase0.BeaconStateView).CurrentEpochAttestations()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := currAtts.Append(pending.View(spec)); err != nil {
+		t.Fatal(err)
+	}
+
+	// an old proposal by the otherwise silent validator, outside of the lookback window.
+	markTestBlock(t, entries[3], common.Root{0x03}, silent)
+
+	indices := []common.ValidatorIndex{attester, silent, proposer}
+	res, err := DetectDoppelgangers(context.Background(), ch, spec, indices, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(res) != len(indices) {
+		t.Fatalf("expected result for every index, got %d results", len(res))
+	}
+	if ev := res[attester]; !ev.Active || ev.Slot != dutySlot || ev.Proposal {
+		t.Fatalf("expected attestation evidence for attester, got %+v", ev)
+	}
+	if ev := res[proposer]; !ev.Active || ev.Slot != 17 || !ev.Proposal {
+		t.Fatalf("expected proposal evidence for proposer, got %+v", ev)
+	}
+	if ev := res[silent]; ev.Active {
+		t.Fatalf("expected no evidence for silent validator, got %+v", ev)
+	}
+
+	res, err = DetectDoppelgangers(context.Background(), ch, spec, indices, 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ev := res[silent]; !ev.Active || ev.Slot != 3 || !ev.Proposal {
+		t.Fatalf("expected old proposal evidence with larger lookback, got %+v", ev)
+	}
+}
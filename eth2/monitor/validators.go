@@ -0,0 +1,494 @@
+package monitor
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+
+	"github.com/protolambda/zrnt/eth2/beacon"
+	"github.com/protolambda/zrnt/eth2/beacon/altair"
+	"github.com/protolambda/zrnt/eth2/beacon/common"
+	"github.com/protolambda/zrnt/eth2/beacon/phase0"
+)
+
+// ValidatorSummary summarizes the activity of a single validator during an epoch.
+type ValidatorSummary struct {
+	// Balances at the end of the summarized data (the latest state of the next epoch)
+	Balance          common.Gwei
+	EffectiveBalance common.Gwei
+	Slashed          bool
+	// If the validator was not slashed yet in the summary of the previous epoch
+	NewlySlashed bool
+
+	// If the validator had an attestation duty in the epoch
+	AttestationDuty bool
+	// If an attestation of the validator was included
+	AttestationIncluded bool
+	// Inclusion distance of the earliest inclusion. Only known before Altair, 0 otherwise.
+	InclusionDistance common.Slot
+	CorrectSource     bool
+	CorrectTarget     bool
+	CorrectHead       bool
+
+	BlocksProposed uint64
+	BlocksMissed   uint64
+
+	// Number of blocks in the epoch where the validator was part of the sync committee, counted per committee position
+	SyncDuties uint64
+	// Number of sync committee duties that were included in the block
+	SyncParticipated uint64
+}
+
+type EpochSummaryCallback func(epoch common.Epoch, summary map[common.ValidatorIndex]ValidatorSummary)
+
+type syncCount struct {
+	duties       uint64
+	participated uint64
+}
+
+type blockSyncParticipation struct {
+	slot   common.Slot
+	counts map[common.ValidatorIndex]syncCount
+}
+
+type epochSummary struct {
+	// state root of the entry the summary was computed from
+	basis common.Root
+	// if the summary can not change anymore
+	final      bool
+	validators map[common.ValidatorIndex]ValidatorSummary
+}
+
+// ValidatorMonitor produces per-epoch summaries of a watchlist of validators.
+// Sync committee participation is registered per block with OnBlock,
+// and the summaries are updated with OnHead whenever the head of the chain changes.
+// The summary of an epoch is produced once the head is in the next epoch,
+// and recomputed on later head changes until it is finalized,
+// to account for late attestation inclusion and reorgs.
+type ValidatorMonitor struct {
+	sync.RWMutex
+	spec *common.Spec
+	// sorted watchlist
+	indices []common.ValidatorIndex
+	watched map[common.ValidatorIndex]struct{}
+	// Number of epochs to keep summaries for
+	maxEpochs uint64
+	summaries map[common.Epoch]*epochSummary
+	// block root -> sync committee participation of the watched validators
+	syncParticipation map[common.Root]*blockSyncParticipation
+	callback          EpochSummaryCallback
+}
+
+func NewValidatorMonitor(spec *common.Spec, indices []common.ValidatorIndex, maxEpochs uint64) *ValidatorMonitor {
+	if maxEpochs == 0 {
+		maxEpochs = 1
+	}
+	sorted := append([]common.ValidatorIndex(nil), indices...)
+	sort.Slice(sorted, func(i, j int) bool {
+		return sorted[i] < sorted[j]
+	})
+	watched := make(map[common.ValidatorIndex]struct{}, len(indices))
+	for _, vi := range sorted {
+		watched[vi] = struct{}{}
+	}
+	return &ValidatorMonitor{
+		spec:              spec,
+		indices:           sorted,
+		watched:           watched,
+		maxEpochs:         maxEpochs,
+		summaries:         make(map[common.Epoch]*epochSummary),
+		syncParticipation: make(map[common.Root]*blockSyncParticipation),
+	}
+}
+
+// SetCallback sets a function to call whenever the summary of an epoch is computed or recomputed.
+// The callback is called while holding the lock of the monitor, and must not call back into the monitor.
+func (vm *ValidatorMonitor) SetCallback(fn EpochSummaryCallback) {
+	vm.Lock()
+	defer vm.Unlock()
+	vm.callback = fn
+}
+
+// OnBlock registers the sync committee participation of the watched validators in the block.
+// The entry must be the chain entry of the block.
+func (vm *ValidatorMonitor) OnBlock(ctx context.Context, entry beacon.ChainEntry, benv *common.BeaconBlockEnvelope) error {
+	agg, err := beacon.EnvelopeSyncAggregate(benv)
+	if err != nil {
+		return err
+	}
+	if agg == nil {
+		return nil
+	}
+	epc, err := entry.EpochsContext(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to get epochs context of block %s: %v", benv.BlockRoot, err)
+	}
+	if epc.CurrentSyncCommittee == nil {
+		return fmt.Errorf("no sync committee available for block %s", benv.BlockRoot)
+	}
+	counts := make(map[common.ValidatorIndex]syncCount)
+	for i, vi := range epc.CurrentSyncCommittee.Indices {
+		if _, ok := vm.watched[vi]; !ok {
+			continue
+		}
+		c := counts[vi]
+		c.duties += 1
+		if agg.SyncCommitteeBits.GetBit(uint64(i)) {
+			c.participated += 1
+		}
+		counts[vi] = c
+	}
+	vm.Lock()
+	defer vm.Unlock()
+	vm.syncParticipation[benv.BlockRoot] = &blockSyncParticipation{slot: benv.Slot, counts: counts}
+	return nil
+}
+
+// entryAt returns the latest canonical entry at or before the given slot.
+func entryAt(iter beacon.ChainIter, slot common.Slot) (beacon.ChainEntry, error) {
+	start := iter.Start().Slot()
+	if end := iter.End(); end <= common.AsStep(slot, true) {
+		// the end is exclusive
+		if end == 0 {
+			return nil, fmt.Errorf("empty chain")
+		}
+		slot = (end - 1).Slot()
+	}
+	for s := slot; s >= start; s-- {
+		for _, block := range []bool{true, false} {
+			step := common.AsStep(s, block)
+			if step >= iter.End() || step < iter.Start() {
+				continue
+			}
+			entry, err := iter.Entry(step)
+			if err != nil {
+				return nil, fmt.Errorf("failed to get entry at step %s: %v", step, err)
+			}
+			if entry != nil {
+				return entry, nil
+			}
+		}
+		if s == 0 {
+			break
+		}
+	}
+	return nil, fmt.Errorf("no entry at or before slot %d", slot)
+}
+
+// OnHead updates the epoch summaries with the new canonical chain.
+func (vm *ValidatorMonitor) OnHead(ctx context.Context, chain beacon.Chain) error {
+	head, err := chain.Head()
+	if err != nil {
+		return fmt.Errorf("failed to get head: %v", err)
+	}
+	headSlot := head.Step().Slot()
+	headEpoch := vm.spec.SlotToEpoch(headSlot)
+	if headEpoch == 0 {
+		return nil
+	}
+	finalizedEpoch := chain.FinalizedCheckpoint().Epoch
+	iter, err := chain.Iter()
+	if err != nil {
+		return fmt.Errorf("failed to iterate chain: %v", err)
+	}
+
+	vm.Lock()
+	defer vm.Unlock()
+
+	var minEpoch common.Epoch
+	if uint64(headEpoch) > vm.maxEpochs {
+		minEpoch = headEpoch - common.Epoch(vm.maxEpochs)
+	}
+	for epoch := minEpoch; epoch < headEpoch; epoch++ {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		existing := vm.summaries[epoch]
+		if existing != nil && existing.final {
+			continue
+		}
+		endSlot, err := vm.spec.EpochStartSlot(epoch + 2)
+		if err != nil {
+			return err
+		}
+		endSlot -= 1
+		basisSlot := endSlot
+		if headSlot < basisSlot {
+			basisSlot = headSlot
+		}
+		basis, err := entryAt(iter, basisSlot)
+		if err != nil {
+			return fmt.Errorf("failed to get summary data for epoch %d: %v", epoch, err)
+		}
+		basisRoot, err := basis.StateRoot()
+		if err != nil {
+			return fmt.Errorf("failed to get state root for epoch %d summary: %v", epoch, err)
+		}
+		if existing != nil && existing.basis == basisRoot {
+			continue
+		}
+		validators, err := vm.summarize(ctx, iter, epoch, basis)
+		if err != nil {
+			return fmt.Errorf("failed to summarize epoch %d: %v", epoch, err)
+		}
+		vm.summaries[epoch] = &epochSummary{
+			basis:      basisRoot,
+			final:      basisSlot == endSlot && epoch+2 <= finalizedEpoch,
+			validators: validators,
+		}
+		if vm.callback != nil {
+			vm.callback(epoch, copySummary(validators))
+		}
+	}
+	for epoch := range vm.summaries {
+		if epoch < minEpoch {
+			delete(vm.summaries, epoch)
+		}
+	}
+	minSlot, _ := vm.spec.EpochStartSlot(minEpoch)
+	for root, p := range vm.syncParticipation {
+		if p.slot < minSlot {
+			delete(vm.syncParticipation, root)
+		}
+	}
+	return nil
+}
+
+func (vm *ValidatorMonitor) summarize(ctx context.Context, iter beacon.ChainIter, epoch common.Epoch,
+	basis beacon.ChainEntry) (map[common.ValidatorIndex]ValidatorSummary, error) {
+	out := make(map[common.ValidatorIndex]ValidatorSummary, len(vm.indices))
+
+	state, err := basis.State(ctx)
+	if err != nil {
+		return nil, err
+	}
+	epc, err := basis.EpochsContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if epc.PreviousEpoch.Epoch != epoch {
+		return nil, fmt.Errorf("expected data of epoch %d to be available in previous epoch, but got %d", epoch, epc.PreviousEpoch.Epoch)
+	}
+	validators, err := state.Validators()
+	if err != nil {
+		return nil, err
+	}
+	balances, err := state.Balances()
+	if err != nil {
+		return nil, err
+	}
+	count, err := validators.ValidatorCount()
+	if err != nil {
+		return nil, err
+	}
+	var prev *epochSummary
+	if epoch > 0 {
+		prev = vm.summaries[epoch-1]
+	}
+	for _, vi := range vm.indices {
+		if uint64(vi) >= count {
+			continue
+		}
+		var s ValidatorSummary
+		v, err := validators.Validator(vi)
+		if err != nil {
+			return nil, err
+		}
+		if s.EffectiveBalance, err = v.EffectiveBalance(); err != nil {
+			return nil, err
+		}
+		if s.Slashed, err = v.Slashed(); err != nil {
+			return nil, err
+		}
+		if s.Balance, err = balances.GetBalance(vi); err != nil {
+			return nil, err
+		}
+		if s.Slashed && prev != nil {
+			s.NewlySlashed = !prev.validators[vi].Slashed
+		}
+		_, s.AttestationDuty = dutySlot(vm.spec, epc.PreviousEpoch, vi)
+		out[vi] = s
+	}
+
+	if err := vm.summarizeAttestations(ctx, epoch, epc, state, out); err != nil {
+		return nil, err
+	}
+	if err := vm.summarizeBlocks(ctx, iter, epoch, out); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (vm *ValidatorMonitor) summarizeAttestations(ctx context.Context, epoch common.Epoch,
+	epc *common.EpochsContext, state common.BeaconState, out map[common.ValidatorIndex]ValidatorSummary) error {
+	switch st := state.(type) {
+	case phase0.Phase0PendingAttestationsBeaconState:
+		atts, err := st.PreviousEpochAttestations()
+		if err != nil {
+			return err
+		}
+		targetRoot, err := common.GetBlockRoot(vm.spec, state, epoch)
+		if err != nil {
+			return err
+		}
+		attIter := atts.ReadonlyIter()
+		for {
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+			el, ok, err := attIter.Next()
+			if err != nil {
+				return err
+			}
+			if !ok {
+				return nil
+			}
+			attView, err := phase0.AsPendingAttestation(el, nil)
+			if err != nil {
+				return err
+			}
+			att, err := attView.Raw()
+			if err != nil {
+				return err
+			}
+			comm, err := epc.GetBeaconCommittee(att.Data.Slot, att.Data.Index)
+			if err != nil {
+				return err
+			}
+			if bl := att.AggregationBits.BitLen(); bl != uint64(len(comm)) {
+				return fmt.Errorf("pending attestation has bitlength %d, but expected %d bits", bl, len(comm))
+			}
+			headRoot, err := common.GetBlockRootAtSlot(vm.spec, state, att.Data.Slot)
+			if err != nil {
+				return err
+			}
+			// filtering happens in-place, copy the committee to not modify the shuffling of the context.
+			participants := att.AggregationBits.FilterParticipants(append([]common.ValidatorIndex(nil), comm...))
+			for _, vi := range participants {
+				s, ok := out[vi]
+				if !ok {
+					continue
+				}
+				if !s.AttestationIncluded || att.InclusionDelay < s.InclusionDistance {
+					s.InclusionDistance = att.InclusionDelay
+				}
+				s.AttestationIncluded = true
+				// pending attestations always have a matching source
+				s.CorrectSource = true
+				s.CorrectTarget = s.CorrectTarget || att.Data.Target.Root == targetRoot
+				s.CorrectHead = s.CorrectHead || att.Data.BeaconBlockRoot == headRoot
+				out[vi] = s
+			}
+		}
+	case altair.AltairLikeBeaconState:
+		reg, err := st.PreviousEpochParticipation()
+		if err != nil {
+			return err
+		}
+		count, err := reg.Length()
+		if err != nil {
+			return err
+		}
+		for vi, s := range out {
+			if uint64(vi) >= count {
+				continue
+			}
+			flags, err := reg.GetFlags(vi)
+			if err != nil {
+				return err
+			}
+			s.AttestationIncluded = flags != 0
+			s.CorrectSource = flags&altair.TIMELY_SOURCE_FLAG != 0
+			s.CorrectTarget = flags&altair.TIMELY_TARGET_FLAG != 0
+			s.CorrectHead = flags&altair.TIMELY_HEAD_FLAG != 0
+			out[vi] = s
+		}
+		return nil
+	default:
+		return fmt.Errorf("cannot read attestations from state of type %T", state)
+	}
+}
+
+func (vm *ValidatorMonitor) summarizeBlocks(ctx context.Context, iter beacon.ChainIter, epoch common.Epoch,
+	out map[common.ValidatorIndex]ValidatorSummary) error {
+	startSlot, err := vm.spec.EpochStartSlot(epoch)
+	if err != nil {
+		return err
+	}
+	// the entry at the start of the epoch has the proposers of the epoch
+	start, err := entryAt(iter, startSlot)
+	if err != nil {
+		return err
+	}
+	epc, err := start.EpochsContext(ctx)
+	if err != nil {
+		return err
+	}
+	if epc.CurrentEpoch.Epoch != epoch {
+		return fmt.Errorf("expected proposers of epoch %d, but got %d", epoch, epc.CurrentEpoch.Epoch)
+	}
+	for i := common.Slot(0); i < vm.spec.SLOTS_PER_EPOCH; i++ {
+		slot := startSlot + i
+		var entry beacon.ChainEntry
+		if step := common.AsStep(slot, true); step < iter.End() {
+			entry, err = iter.Entry(step)
+			if err != nil {
+				return err
+			}
+		}
+		if entry != nil {
+			root, err := entry.BlockRoot()
+			if err != nil {
+				return err
+			}
+			if p, ok := vm.syncParticipation[root]; ok {
+				for vi, c := range p.counts {
+					if s, ok := out[vi]; ok {
+						s.SyncDuties += c.duties
+						s.SyncParticipated += c.participated
+						out[vi] = s
+					}
+				}
+			}
+		}
+		// the genesis block has no actual proposer
+		if slot == common.GENESIS_SLOT {
+			continue
+		}
+		proposer, err := epc.GetBeaconProposer(slot)
+		if err != nil {
+			return err
+		}
+		s, ok := out[proposer]
+		if !ok {
+			continue
+		}
+		if entry != nil {
+			s.BlocksProposed += 1
+		} else {
+			s.BlocksMissed += 1
+		}
+		out[proposer] = s
+	}
+	return nil
+}
+
+func copySummary(summary map[common.ValidatorIndex]ValidatorSummary) map[common.ValidatorIndex]ValidatorSummary {
+	out := make(map[common.ValidatorIndex]ValidatorSummary, len(summary))
+	for vi, s := range summary {
+		out[vi] = s
+	}
+	return out
+}
+
+// EpochSummary returns a copy of the summary of the watched validators in the given epoch, or nil if not available.
+func (vm *ValidatorMonitor) EpochSummary(epoch common.Epoch) map[common.ValidatorIndex]ValidatorSummary {
+	vm.RLock()
+	defer vm.RUnlock()
+	s, ok := vm.summaries[epoch]
+	if !ok {
+		return nil
+	}
+	return copySummary(s.validators)
+}
@@ -0,0 +1,136 @@
+package monitor
+
+import (
+	"context"
+	"testing"
+
+	"github.com/protolambda/zrnt/eth2/beacon/common"
+	"github.com/protolambda/zrnt/eth2/beacon/phase0"
+)
+
+// includeTestAttestation adds the attestation as pending attestation of the previous epoch to the state of the entry.
+func includeTestAttestation(t *testing.T, entry *testEntry, att phase0.Attestation) {
+	atts, err := entry.state.(*phase0.BeaconStateView).PreviousEpochAttestations()
+	if err != nil {
+		t.Fatal(err)
+	}
+	pending := phase0.PendingAttestation{
+		AggregationBits: att.AggregationBits,
+		Data:            att.Data,
+		InclusionDelay:  entry.step.Slot() - att.Data.Slot,
+	}
+	if err := atts.Append(pending.View(spec)); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestValidatorMonitor(t *testing.T) {
+	entries := makeTestEntries(t, 3*8)
+	ch := &testChain{entries: entries}
+
+	// two validators in the same committee in both epoch 0 and 1
+	comm0, err := entries[8].epc.GetBeaconCommittee(2, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	attester, lazy := comm0[0], comm0[1]
+	positions := func(epc *common.EpochsContext, epoch common.Epoch, vi common.ValidatorIndex) (common.Slot, common.CommitteeIndex, uint64) {
+		startSlot, _ := spec.EpochStartSlot(epoch)
+		for i := common.Slot(0); i < spec.SLOTS_PER_EPOCH; i++ {
+			comm, err := epc.GetBeaconCommittee(startSlot+i, 0)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for p, v := range comm {
+				if v == vi {
+					return startSlot + i, 0, uint64(p)
+				}
+			}
+		}
+		t.Fatalf("no duty for validator %d in epoch %d", vi, epoch)
+		return 0, 0, 0
+	}
+
+	// both attest in epoch 0, included in epoch 1
+	slot, index, pos := positions(entries[8].epc, 0, lazy)
+	includeTestAttestation(t, entries[15], makeTestAttestation(t, entries[15], slot, index, pos))
+	slot, index, pos = positions(entries[8].epc, 0, attester)
+	att := makeTestAttestation(t, entries[15], slot, index, pos)
+	includeTestAttestation(t, entries[15], att)
+	// only the attester attests in epoch 1, the other validator misses it
+	slot, index, pos = positions(entries[16].epc, 1, attester)
+	includeTestAttestation(t, entries[23], makeTestAttestation(t, entries[23], slot, index, pos))
+
+	// a proposed block and a missed block
+	proposer, err := entries[9].epc.GetBeaconProposer(9)
+	if err != nil {
+		t.Fatal(err)
+	}
+	markTestBlock(t, entries[9], common.Root{0x09}, proposer)
+	absent, err := entries[9].epc.GetBeaconProposer(10)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	vm := NewValidatorMonitor(spec, []common.ValidatorIndex{attester, lazy, proposer, absent}, 4)
+	var calls []common.Epoch
+	vm.SetCallback(func(epoch common.Epoch, summary map[common.ValidatorIndex]ValidatorSummary) {
+		calls = append(calls, epoch)
+	})
+	ctx := context.Background()
+	if err := vm.OnHead(ctx, ch); err != nil {
+		t.Fatal(err)
+	}
+	if len(calls) != 2 || calls[0] != 0 || calls[1] != 1 {
+		t.Fatalf("expected summaries of epoch 0 and 1, got %v", calls)
+	}
+	if vm.EpochSummary(2) != nil {
+		t.Fatal("epoch of the head should not be summarized yet")
+	}
+	sum0 := vm.EpochSummary(0)
+	if s := sum0[attester]; !s.AttestationDuty || !s.AttestationIncluded || !s.CorrectTarget || !s.CorrectHead ||
+		s.InclusionDistance != 15-att.Data.Slot {
+		t.Fatalf("unexpected epoch 0 summary of attester: %+v", s)
+	}
+	if s := sum0[lazy]; !s.AttestationIncluded {
+		t.Fatalf("expected epoch 0 attestation of lazy validator to be included: %+v", s)
+	}
+	sum1 := vm.EpochSummary(1)
+	if s := sum1[attester]; !s.AttestationIncluded || s.Balance == 0 || s.EffectiveBalance != spec.MAX_EFFECTIVE_BALANCE {
+		t.Fatalf("unexpected epoch 1 summary of attester: %+v", s)
+	}
+	if s := sum1[lazy]; !s.AttestationDuty || s.AttestationIncluded {
+		t.Fatalf("expected missed attestation in epoch 1: %+v", s)
+	}
+	if proposer != absent {
+		if s := sum1[proposer]; s.BlocksProposed != 1 {
+			t.Fatalf("expected a proposed block: %+v", s)
+		}
+	}
+	if s := sum1[absent]; s.BlocksMissed < 1 {
+		t.Fatalf("expected a missed block: %+v", s)
+	}
+
+	// same head, nothing to recompute
+	calls = nil
+	if err := vm.OnHead(ctx, ch); err != nil {
+		t.Fatal(err)
+	}
+	if len(calls) != 0 {
+		t.Fatalf("expected no recomputation, got %v", calls)
+	}
+
+	// a reorg replaces the last block, which does include the missed attestation
+	markTestBlock(t, entries[23], common.Root{0x23}, 0)
+	slot, index, pos = positions(entries[16].epc, 1, lazy)
+	includeTestAttestation(t, entries[23], makeTestAttestation(t, entries[23], slot, index, pos))
+	if err := vm.OnHead(ctx, ch); err != nil {
+		t.Fatal(err)
+	}
+	if len(calls) != 1 || calls[0] != 1 {
+		t.Fatalf("expected only epoch 1 to be recomputed, got %v", calls)
+	}
+	if s := vm.EpochSummary(1)[lazy]; !s.AttestationIncluded {
+		t.Fatalf("expected recomputed summary to include the attestation: %+v", s)
+	}
+}
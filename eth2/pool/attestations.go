@@ -1,12 +1,14 @@
 package pool
 
 import (
+	"bytes"
 	"context"
 	"errors"
 	"fmt"
 	"sync"
 	"time"
 
+	blsu "github.com/protolambda/bls12-381-util"
 	"github.com/protolambda/zrnt/eth2/beacon/common"
 	"github.com/protolambda/zrnt/eth2/beacon/phase0"
 	"github.com/protolambda/ztyp/tree"
@@ -32,12 +34,94 @@ type Aggregate struct {
 	Sig          common.BLSSignature
 }
 
+// MinAggregates keeps a small set of aggregates that maximizes the bit coverage for an attestation data root:
+// no aggregate in the set is covered by another, and the set is bounded in size.
 type MinAggregates struct {
 	Aggregates []Aggregate
 	// The OR of all bitfields contained in Aggregates list, to easily filter out subsets
 	Participants phase0.AttestationBits
-	// Things already covered by the sum of the above aggregates, but maybe useful later. Keep a limited number of these.
-	Extra []Aggregate
+}
+
+// Add applies the retention policy to a new aggregate:
+//   - if an existing aggregate covers the new aggregate, the new aggregate is ignored.
+//   - existing aggregates covered by the new aggregate are replaced by it.
+//   - partially overlapping aggregates are kept separately.
+//   - when exceeding max aggregates, disjoint aggregates are merged greedily (in order of addition),
+//     and if none are disjoint, the aggregate with the least participants is dropped.
+//
+// The change in the number of kept aggregates is returned.
+func (m *MinAggregates) Add(agg Aggregate, max uint64) (delta int, err error) {
+	before := len(m.Aggregates)
+	for _, existing := range m.Aggregates {
+		if covers, err := existing.Participants.Covers(agg.Participants); err != nil {
+			return 0, fmt.Errorf("could not compare aggregation bitfields: %v", err)
+		} else if covers {
+			return 0, nil
+		}
+	}
+	kept := m.Aggregates[:0]
+	for _, existing := range m.Aggregates {
+		// bitfield lengths were already checked above
+		if covers, _ := agg.Participants.Covers(existing.Participants); !covers {
+			kept = append(kept, existing)
+		}
+	}
+	m.Aggregates = append(kept, agg)
+	for uint64(len(m.Aggregates)) > max && len(m.Aggregates) > 0 {
+		if merged, err := m.mergeDisjoint(); err != nil {
+			return 0, err
+		} else if !merged {
+			m.dropSmallest()
+		}
+	}
+	m.Participants = agg.Participants.Copy()
+	for _, a := range m.Aggregates {
+		m.Participants.Or(a.Participants)
+	}
+	return len(m.Aggregates) - before, nil
+}
+
+// mergeDisjoint merges the first pair of aggregates that do not overlap, returns false if there is none.
+func (m *MinAggregates) mergeDisjoint() (bool, error) {
+	for i := 0; i < len(m.Aggregates); i++ {
+		for j := i + 1; j < len(m.Aggregates); j++ {
+			a, b := &m.Aggregates[i], &m.Aggregates[j]
+			if overlaps, err := a.Participants.Overlaps(b.Participants); err != nil {
+				return false, err
+			} else if overlaps {
+				continue
+			}
+			sigA, err := a.Sig.Signature()
+			if err != nil {
+				return false, fmt.Errorf("failed to deserialize aggregate signature: %v", err)
+			}
+			sigB, err := b.Sig.Signature()
+			if err != nil {
+				return false, fmt.Errorf("failed to deserialize aggregate signature: %v", err)
+			}
+			sig, err := blsu.Aggregate([]*blsu.Signature{sigA, sigB})
+			if err != nil {
+				return false, fmt.Errorf("failed to merge aggregate signatures: %v", err)
+			}
+			participants := a.Participants.Copy()
+			participants.Or(b.Participants)
+			m.Aggregates[i] = Aggregate{Participants: participants, Sig: sig.Serialize()}
+			m.Aggregates = append(m.Aggregates[:j], m.Aggregates[j+1:]...)
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// dropSmallest removes the aggregate with the least participants, the latest one if there is a tie.
+func (m *MinAggregates) dropSmallest() {
+	smallest := 0
+	for i := range m.Aggregates {
+		if m.Aggregates[i].Participants.OnesCount() <= m.Aggregates[smallest].Participants.OnesCount() {
+			smallest = i
+		}
+	}
+	m.Aggregates = append(m.Aggregates[:smallest], m.Aggregates[smallest+1:]...)
 }
 
 type AttestationPool struct {
@@ -54,17 +138,70 @@ type AttestationPool struct {
 	// This helps filter duplicate aggregate attestations:
 	// if all aggregate participants already voted, it can be ignored (and maybe slashed if bad double votes).
 	aggPerValidator map[Assignment]common.Root
-	// Keep some extra data around, which is already covered by larger aggregates, to try and pack better results.
-	maxExtraAggregates uint64
+	// Maximum number of aggregates to keep per attestation data root, see MinAggregates.
+	maxAggregates uint64
+	// Maximum number of attestations (individual and aggregates) to keep in total.
+	// When exceeded, the attestation data groups with the least participants get evicted first.
+	maxEntries uint64
+	// Number of attestations currently kept, compared against maxEntries
+	entries uint64
+
+	prunedExpired  uint64
+	prunedIncluded uint64
+	evicted        uint64
 }
 
 func NewAttestationPool(spec *common.Spec) *AttestationPool {
 	return &AttestationPool{
-		spec:               spec,
-		datas:              make(map[common.Root]*IndexedAttData),
-		individual:         make(map[Assignment]*AttRef),
-		aggregate:          make(map[common.Root]*MinAggregates),
-		maxExtraAggregates: 10, // TODO: worth tuning
+		spec:            spec,
+		datas:           make(map[common.Root]*IndexedAttData),
+		individual:      make(map[Assignment]*AttRef),
+		aggregate:       make(map[common.Root]*MinAggregates),
+		aggPerValidator: make(map[Assignment]common.Root),
+		maxAggregates:   4,      // TODO: worth tuning
+		maxEntries:      100000, // TODO: worth tuning
+	}
+}
+
+// SetMaxAggregates changes the maximum number of aggregates to keep per attestation data root.
+// The bound applies to aggregates added after the change.
+func (ap *AttestationPool) SetMaxAggregates(max uint64) {
+	ap.Lock()
+	defer ap.Unlock()
+	ap.maxAggregates = max
+}
+
+// SetMaxEntries changes the bound on the total number of attestations in the pool,
+// and evicts attestation data groups if the pool exceeds the new bound.
+func (ap *AttestationPool) SetMaxEntries(max uint64) {
+	ap.Lock()
+	defer ap.Unlock()
+	ap.maxEntries = max
+	ap.enforceBound()
+}
+
+type AttestationPoolStats struct {
+	// Number of distinct attestation data roots
+	Datas uint64
+	// Number of attestations kept in total (individual and aggregates)
+	Entries uint64
+	// Number of attestation data groups pruned because they could not be included anymore
+	PrunedExpired uint64
+	// Number of attestation data groups pruned because they were covered by on-chain attestations
+	PrunedIncluded uint64
+	// Number of attestation data groups evicted to stay within the entries bound
+	Evicted uint64
+}
+
+func (ap *AttestationPool) Stats() AttestationPoolStats {
+	ap.RLock()
+	defer ap.RUnlock()
+	return AttestationPoolStats{
+		Datas:          uint64(len(ap.datas)),
+		Entries:        ap.entries,
+		PrunedExpired:  ap.prunedExpired,
+		PrunedIncluded: ap.prunedIncluded,
+		Evicted:        ap.evicted,
 	}
 }
 
@@ -103,39 +240,31 @@ func (ap *AttestationPool) AddAttestation(ctx context.Context, att *phase0.Attes
 			}
 		}
 		ap.individual[key] = &AttRef{DataRoot: dataRoot, Sig: att.Signature}
+		ap.entries += 1
+		ap.enforceBound()
 		return nil
 	}
 
 	// aggregates: don't store more than we have to.
 	// Sometimes we find some different ones, keep those, every attester counts.
-	// No aggregation yet, we can put together the best version later.
+	// Only disjoint aggregates are merged ahead of time, we can put together the best version later.
 	if existing, ok := ap.aggregate[dataRoot]; ok {
-		if covers, err := existing.Participants.Covers(att.AggregationBits); err != nil {
-			return fmt.Errorf("could not compare aggregation bitfields: %v", err)
-		} else if covers {
-			// New attestation doesn't add any new info,
-			// but if it packs better than something we had before, we should keep it for better performance.
-			// To avoid spam / DoS, we only keep a limited number of these
-			if uint64(len(existing.Extra)) < ap.maxExtraAggregates {
-				existing.Extra = append(existing.Extra,
-					Aggregate{Participants: att.AggregationBits, Sig: att.Signature})
-			}
-			return nil
-		} else {
-			// this aggregate adds additional participants compared to the total we had before, keep it!
-			existing.Aggregates = append(existing.Aggregates,
-				Aggregate{Participants: att.AggregationBits, Sig: att.Signature})
-
-			// remember the participants attested this epoch
-			key := Assignment{Index: 0, Epoch: att.Data.Target.Epoch}
-			for i, vi := range committee {
-				if att.AggregationBits.GetBit(uint64(i)) {
-					key.Index = vi
-					ap.aggPerValidator[key] = dataRoot
-				}
+		delta, err := existing.Add(Aggregate{Participants: att.AggregationBits, Sig: att.Signature}, ap.maxAggregates)
+		if err != nil {
+			return err
+		}
+		ap.entries = uint64(int64(ap.entries) + int64(delta))
+
+		// remember the participants attested this epoch
+		key := Assignment{Index: 0, Epoch: att.Data.Target.Epoch}
+		for i, vi := range committee {
+			if att.AggregationBits.GetBit(uint64(i)) {
+				key.Index = vi
+				ap.aggPerValidator[key] = dataRoot
 			}
-			return nil
 		}
+		ap.enforceBound()
+		return nil
 	} else {
 		hasNewAttester := false
 		key := Assignment{Index: 0, Epoch: att.Data.Target.Epoch}
@@ -155,6 +284,8 @@ func (ap *AttestationPool) AddAttestation(ctx context.Context, att *phase0.Attes
 				// copy, we mutate this bitfield later, while still using the original (stored in above array)
 				Participants: att.AggregationBits.Copy(),
 			}
+			ap.entries += 1
+			ap.enforceBound()
 		} else {
 			return fmt.Errorf("ignoring new attestation for different data:" +
 				"all participants voted for other data this epoch already, whole attestation is likely slashable")
@@ -187,6 +318,8 @@ func (ap *AttestationPool) Search(opts ...AttSearchOption) (out []*phase0.Attest
 	for _, opt := range opts {
 		opt(&conf)
 	}
+	ap.RLock()
+	defer ap.RUnlock()
 	for k, d := range ap.datas {
 		if conf.slot != nil && d.Data.Slot != *conf.slot {
 			continue
@@ -194,7 +327,10 @@ func (ap *AttestationPool) Search(opts ...AttSearchOption) (out []*phase0.Attest
 		if conf.comm != nil && d.Data.Index != *conf.comm {
 			continue
 		}
-		agg := ap.aggregate[k]
+		agg, ok := ap.aggregate[k]
+		if !ok {
+			continue
+		}
 		for _, a := range agg.Aggregates {
 			out = append(out, &phase0.Attestation{AggregationBits: a.Participants, Data: d.Data, Signature: a.Sig})
 		}
@@ -203,27 +339,128 @@ func (ap *AttestationPool) Search(opts ...AttSearchOption) (out []*phase0.Attest
 	return out
 }
 
-// Prune pool based on current epoch, attestations which cannot be included anymore will get pruned.
-func (ap *AttestationPool) Prune(epoch common.Epoch) {
-	min := epoch.Previous()
-	for k, v := range ap.datas {
-		if v.Data.Target.Epoch < min {
-			delete(ap.datas, k)
-			delete(ap.aggregate, k)
-		}
+// dropGroup removes all attestations for the given attestation data root.
+func (ap *AttestationPool) dropGroup(dataRoot common.Root) {
+	if agg, ok := ap.aggregate[dataRoot]; ok {
+		ap.entries -= uint64(len(agg.Aggregates))
+		delete(ap.aggregate, dataRoot)
 	}
-	for k := range ap.individual {
-		if k.Epoch < min {
+	for k, ref := range ap.individual {
+		if ref.DataRoot == dataRoot {
+			ap.entries -= 1
 			delete(ap.individual, k)
 		}
 	}
+	delete(ap.datas, dataRoot)
+}
+
+// groupValue is the number of distinct participants covered by the attestations for the given data root.
+func (ap *AttestationPool) groupValue(dataRoot common.Root) uint64 {
+	d, ok := ap.datas[dataRoot]
+	if !ok {
+		return 0
+	}
+	var covered phase0.AttestationBits
+	if agg, ok := ap.aggregate[dataRoot]; ok {
+		covered = agg.Participants.Copy()
+	} else {
+		covered = phase0.NewAttestationBits(uint64(len(d.Committee)))
+	}
+	for k, ref := range ap.individual {
+		if ref.DataRoot != dataRoot {
+			continue
+		}
+		for i, vi := range d.Committee {
+			if vi == k.Index {
+				covered.SetBit(uint64(i), true)
+				break
+			}
+		}
+	}
+	return covered.OnesCount()
+}
+
+// enforceBound evicts the attestation data groups with the least participants until the pool is within bounds.
+func (ap *AttestationPool) enforceBound() {
+	for ap.entries > ap.maxEntries && len(ap.datas) > 0 {
+		var worst common.Root
+		worstValue := ^uint64(0)
+		for k := range ap.datas {
+			// tie-break on data root, to evict deterministically
+			if v := ap.groupValue(k); v < worstValue || (v == worstValue && bytes.Compare(k[:], worst[:]) < 0) {
+				worst = k
+				worstValue = v
+			}
+		}
+		ap.dropGroup(worst)
+		ap.evicted += 1
+	}
+}
+
+// Prune pool based on current slot, attestations which cannot be included anymore will get pruned.
+// An attestation can be included up to SLOTS_PER_EPOCH slots after its own slot.
+func (ap *AttestationPool) Prune(currentSlot common.Slot) {
+	ap.Lock()
+	defer ap.Unlock()
+	for k, v := range ap.datas {
+		if v.Data.Slot+ap.spec.SLOTS_PER_EPOCH < currentSlot {
+			ap.dropGroup(k)
+			ap.prunedExpired += 1
+		}
+	}
+	// Keep tracking the votes of the previous epoch, aggregates for it may still arrive.
+	minEpoch := ap.spec.SlotToEpoch(currentSlot).Previous()
 	for k := range ap.aggPerValidator {
-		if k.Epoch < min {
+		if k.Epoch < minEpoch {
 			delete(ap.aggPerValidator, k)
 		}
 	}
 }
 
+// OnIncludedAttestations takes the attestations that were included in a canonical block,
+// and drops every attestation data group that is fully covered by an included attestation.
+func (ap *AttestationPool) OnIncludedAttestations(atts []phase0.Attestation) {
+	ap.Lock()
+	defer ap.Unlock()
+	for i := range atts {
+		att := &atts[i]
+		dataRoot := att.Data.HashTreeRoot(tree.GetHashFn())
+		d, ok := ap.datas[dataRoot]
+		if !ok {
+			continue
+		}
+		if att.AggregationBits.BitLen() != uint64(len(d.Committee)) {
+			continue
+		}
+		covered := true
+		if agg, ok := ap.aggregate[dataRoot]; ok {
+			if c, err := att.AggregationBits.Covers(agg.Participants); err != nil || !c {
+				covered = false
+			}
+		}
+		if covered {
+			for k, ref := range ap.individual {
+				if ref.DataRoot != dataRoot {
+					continue
+				}
+				for j, vi := range d.Committee {
+					if vi == k.Index && !att.AggregationBits.GetBit(uint64(j)) {
+						covered = false
+						break
+					}
+				}
+				if !covered {
+					break
+				}
+			}
+		}
+		if covered {
+			ap.dropGroup(dataRoot)
+			ap.prunedIncluded += 1
+		}
+	}
+}
+
 // Approximation of the optimal attestation packing.
 // Attestations must match source, get prioritized if the target is correct, and more if the head is correct.
 // Attestations may not be included if they already are (checked via included func).
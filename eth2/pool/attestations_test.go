@@ -0,0 +1,222 @@
+package pool
+
+import (
+	"context"
+	"reflect"
+	"sort"
+	"testing"
+
+	blsu "github.com/protolambda/bls12-381-util"
+	"github.com/protolambda/zrnt/eth2/beacon/common"
+	"github.com/protolambda/zrnt/eth2/beacon/phase0"
+	"github.com/protolambda/zrnt/eth2/configs"
+)
+
+var spec = configs.Minimal
+
+func testCommittee(offset common.ValidatorIndex, size uint64) common.CommitteeIndices {
+	out := make(common.CommitteeIndices, size)
+	for i := range out {
+		out[i] = offset + common.ValidatorIndex(i)
+	}
+	return out
+}
+
+func testAttestation(slot common.Slot, index common.CommitteeIndex, size uint64, positions ...uint64) *phase0.Attestation {
+	bits := phase0.NewAttestationBits(size)
+	for _, p := range positions {
+		bits.SetBit(p, true)
+	}
+	return &phase0.Attestation{
+		AggregationBits: bits,
+		Data: phase0.AttestationData{
+			Slot:            slot,
+			Index:           index,
+			BeaconBlockRoot: common.Root{byte(slot)},
+			Target:          common.Checkpoint{Epoch: spec.SlotToEpoch(slot)},
+		},
+	}
+}
+
+func TestAttestationPoolPruneIncludability(t *testing.T) {
+	ap := NewAttestationPool(spec)
+	ctx := context.Background()
+	// last slot of epoch 0, and first slot of epoch 1
+	oldComm := testCommittee(0, 8)
+	if err := ap.AddAttestation(ctx, testAttestation(7, 0, 8, 1), oldComm); err != nil {
+		t.Fatal(err)
+	}
+	if err := ap.AddAttestation(ctx, testAttestation(7, 0, 8, 0, 2, 3), oldComm); err != nil {
+		t.Fatal(err)
+	}
+	newComm := testCommittee(100, 8)
+	if err := ap.AddAttestation(ctx, testAttestation(8, 0, 8, 0, 1), newComm); err != nil {
+		t.Fatal(err)
+	}
+	if stats := ap.Stats(); stats.Datas != 2 || stats.Entries != 3 {
+		t.Fatalf("unexpected stats after adding: %+v", stats)
+	}
+
+	// slot 7 attestations can still be included in slot 15
+	ap.Prune(15)
+	if stats := ap.Stats(); stats.Datas != 2 || stats.PrunedExpired != 0 {
+		t.Fatalf("pruned too early: %+v", stats)
+	}
+	ap.Prune(16)
+	stats := ap.Stats()
+	if stats.Datas != 1 || stats.Entries != 1 || stats.PrunedExpired != 1 {
+		t.Fatalf("expected slot 7 attestations to be pruned: %+v", stats)
+	}
+	if res := ap.Search(WithSlot(8)); len(res) != 1 {
+		t.Fatalf("expected slot 8 aggregate to remain, got %d results", len(res))
+	}
+}
+
+func TestAttestationPoolIncludedSuperset(t *testing.T) {
+	ap := NewAttestationPool(spec)
+	ctx := context.Background()
+	comm := testCommittee(0, 8)
+	if err := ap.AddAttestation(ctx, testAttestation(3, 0, 8, 0, 1), comm); err != nil {
+		t.Fatal(err)
+	}
+	if err := ap.AddAttestation(ctx, testAttestation(3, 0, 8, 2), comm); err != nil {
+		t.Fatal(err)
+	}
+
+	// does not cover the individual attestation
+	ap.OnIncludedAttestations([]phase0.Attestation{*testAttestation(3, 0, 8, 0, 1)})
+	if stats := ap.Stats(); stats.Datas != 1 || stats.PrunedIncluded != 0 {
+		t.Fatalf("expected partially included group to remain: %+v", stats)
+	}
+	// different data, same bits
+	ap.OnIncludedAttestations([]phase0.Attestation{*testAttestation(4, 0, 8, 0, 1, 2, 3)})
+	if stats := ap.Stats(); stats.Datas != 1 || stats.PrunedIncluded != 0 {
+		t.Fatalf("expected group with other data to remain: %+v", stats)
+	}
+	ap.OnIncludedAttestations([]phase0.Attestation{*testAttestation(3, 0, 8, 0, 1, 2, 3)})
+	if stats := ap.Stats(); stats.Datas != 0 || stats.Entries != 0 || stats.PrunedIncluded != 1 {
+		t.Fatalf("expected included superset to clean up the group: %+v", stats)
+	}
+}
+
+func TestAttestationPoolBound(t *testing.T) {
+	ap := NewAttestationPool(spec)
+	ctx := context.Background()
+	if err := ap.AddAttestation(ctx, testAttestation(3, 0, 8, 0, 1, 2), testCommittee(0, 8)); err != nil {
+		t.Fatal(err)
+	}
+	if err := ap.AddAttestation(ctx, testAttestation(3, 1, 8, 0, 1), testCommittee(100, 8)); err != nil {
+		t.Fatal(err)
+	}
+	if err := ap.AddAttestation(ctx, testAttestation(3, 2, 8, 0, 1, 2, 3), testCommittee(200, 8)); err != nil {
+		t.Fatal(err)
+	}
+	ap.SetMaxEntries(2)
+	if stats := ap.Stats(); stats.Entries != 2 || stats.Evicted != 1 {
+		t.Fatalf("expected a single eviction: %+v", stats)
+	}
+	if res := ap.Search(WithCommittee(1)); len(res) != 0 {
+		t.Fatal("expected the group with the least participants to be evicted")
+	}
+}
+
+func testSignature(t *testing.T, key byte, msg []byte) common.BLSSignature {
+	var sk blsu.SecretKey
+	if err := sk.Deserialize(&[32]byte{31: key}); err != nil {
+		t.Fatal(err)
+	}
+	return blsu.Sign(&sk, msg).Serialize()
+}
+
+func searchBits(ap *AttestationPool, slot common.Slot) (out []string) {
+	for _, att := range ap.Search(WithSlot(slot)) {
+		out = append(out, att.AggregationBits.String())
+	}
+	sort.Strings(out)
+	return out
+}
+
+func TestAttestationPoolSupersetReplaces(t *testing.T) {
+	ap := NewAttestationPool(spec)
+	ctx := context.Background()
+	comm := testCommittee(0, 8)
+	if err := ap.AddAttestation(ctx, testAttestation(3, 0, 8, 0, 1), comm); err != nil {
+		t.Fatal(err)
+	}
+	if err := ap.AddAttestation(ctx, testAttestation(3, 0, 8, 2, 3), comm); err != nil {
+		t.Fatal(err)
+	}
+	if res := searchBits(ap, 3); len(res) != 2 {
+		t.Fatalf("expected two partial aggregates, got %v", res)
+	}
+	superset := testAttestation(3, 0, 8, 0, 1, 2, 3)
+	if err := ap.AddAttestation(ctx, superset, comm); err != nil {
+		t.Fatal(err)
+	}
+	res := searchBits(ap, 3)
+	if len(res) != 1 || res[0] != superset.AggregationBits.String() {
+		t.Fatalf("expected superset to replace partial aggregates, got %v", res)
+	}
+	if stats := ap.Stats(); stats.Entries != 1 {
+		t.Fatalf("expected a single entry, got %+v", stats)
+	}
+	// covered by the superset, does not add anything
+	if err := ap.AddAttestation(ctx, testAttestation(3, 0, 8, 1, 2), comm); err != nil {
+		t.Fatal(err)
+	}
+	if res := searchBits(ap, 3); len(res) != 1 {
+		t.Fatalf("expected covered aggregate to be ignored, got %v", res)
+	}
+}
+
+func TestAttestationPoolDisjointRetained(t *testing.T) {
+	ap := NewAttestationPool(spec)
+	ctx := context.Background()
+	comm := testCommittee(0, 8)
+	a := testAttestation(3, 0, 8, 0, 1, 2, 3)
+	b := testAttestation(3, 0, 8, 4, 5, 6, 7)
+	c := testAttestation(3, 0, 8, 3, 4)
+	for _, att := range []*phase0.Attestation{a, b, c} {
+		if err := ap.AddAttestation(ctx, att, comm); err != nil {
+			t.Fatal(err)
+		}
+	}
+	expected := []string{a.AggregationBits.String(), b.AggregationBits.String(), c.AggregationBits.String()}
+	sort.Strings(expected)
+	if res := searchBits(ap, 3); !reflect.DeepEqual(res, expected) {
+		t.Fatalf("expected disjoint and overlapping aggregates to be retained, got %v", res)
+	}
+}
+
+func TestAttestationPoolMergeDisjoint(t *testing.T) {
+	ap := NewAttestationPool(spec)
+	ap.SetMaxAggregates(1)
+	ctx := context.Background()
+	comm := testCommittee(0, 8)
+	a := testAttestation(3, 0, 8, 0, 1)
+	a.Signature = testSignature(t, 1, []byte("a"))
+	b := testAttestation(3, 0, 8, 2, 3)
+	b.Signature = testSignature(t, 2, []byte("b"))
+	if err := ap.AddAttestation(ctx, a, comm); err != nil {
+		t.Fatal(err)
+	}
+	if err := ap.AddAttestation(ctx, b, comm); err != nil {
+		t.Fatal(err)
+	}
+	res := ap.Search(WithSlot(3))
+	if len(res) != 1 {
+		t.Fatalf("expected disjoint aggregates to be merged, got %d", len(res))
+	}
+	if expected := testAttestation(3, 0, 8, 0, 1, 2, 3).AggregationBits.String(); res[0].AggregationBits.String() != expected {
+		t.Fatalf("unexpected merged bits: %s", res[0].AggregationBits)
+	}
+	sigA, _ := a.Signature.Signature()
+	sigB, _ := b.Signature.Signature()
+	expectedSig, err := blsu.Aggregate([]*blsu.Signature{sigA, sigB})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res[0].Signature != common.BLSSignature(expectedSig.Serialize()) {
+		t.Fatal("unexpected merged signature")
+	}
+}
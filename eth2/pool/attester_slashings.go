@@ -1,8 +1,11 @@
 package pool
 
 import (
+	"bytes"
 	"context"
+	"errors"
 	"fmt"
+	"sort"
 	"sync"
 
 	"github.com/protolambda/zrnt/eth2/beacon/common"
@@ -10,29 +13,59 @@ import (
 	"github.com/protolambda/ztyp/tree"
 )
 
+type attesterSlashingEntry struct {
+	slashing *phase0.AttesterSlashing
+	// the validators that are not slashed yet, and would be slashed by the slashing. Sorted.
+	slashable common.ValidatorSet
+}
+
 type AttesterSlashingPool struct {
 	sync.RWMutex
 	spec      *common.Spec
-	slashings map[common.Root]*phase0.AttesterSlashing
+	slashings map[common.Root]*attesterSlashingEntry
 }
 
 func NewAttesterSlashingPool(spec *common.Spec) *AttesterSlashingPool {
 	return &AttesterSlashingPool{
 		spec:      spec,
-		slashings: make(map[common.Root]*phase0.AttesterSlashing),
+		slashings: make(map[common.Root]*attesterSlashingEntry),
 	}
 }
 
-// This does not filter slashings that are a subset of other slashings.
-// The pool merely collects them. Make sure to protect against spam elsewhere as a caller.
-func (asp *AttesterSlashingPool) AddAttesterSlashing(ctx context.Context, sl *phase0.AttesterSlashing) error {
+// isSubset checks if all indices of a are in b. Both sets must be sorted.
+func isSubset(a common.ValidatorSet, b common.ValidatorSet) bool {
+	out := true
+	a.ZigZagJoin(b, nil, func(i common.ValidatorIndex) {
+		out = false
+	})
+	return out
+}
+
+// AddAttesterSlashing validates the slashing against the given (head) state, and adds it to the pool.
+// Slashings that do not slash any validators that are not already covered by another slashing in the pool are rejected.
+// Slashings in the pool that only cover a subset of the validators of the new slashing are replaced.
+func (asp *AttesterSlashingPool) AddAttesterSlashing(ctx context.Context, epc *common.EpochsContext, state common.BeaconState, sl *phase0.AttesterSlashing) error {
+	slashable, err := phase0.ValidateAttesterSlashing(asp.spec, epc, nil, state, sl)
+	if err != nil {
+		return fmt.Errorf("invalid attester slashing: %v", err)
+	}
 	root := sl.HashTreeRoot(asp.spec, tree.GetHashFn())
 	asp.Lock()
 	defer asp.Unlock()
 	if _, ok := asp.slashings[root]; ok {
 		return fmt.Errorf("already have an attester slashing for message %s", root)
 	}
-	asp.slashings[root] = sl
+	for _, existing := range asp.slashings {
+		if isSubset(slashable, existing.slashable) {
+			return errors.New("attester slashing does not slash any validators that are not already covered")
+		}
+	}
+	for key, existing := range asp.slashings {
+		if isSubset(existing.slashable, slashable) {
+			delete(asp.slashings, key)
+		}
+	}
+	asp.slashings[root] = &attesterSlashingEntry{slashing: sl, slashable: slashable}
 	return nil
 }
 
@@ -41,11 +74,73 @@ func (asp *AttesterSlashingPool) All() []*phase0.AttesterSlashing {
 	defer asp.RUnlock()
 	out := make([]*phase0.AttesterSlashing, 0, len(asp.slashings))
 	for _, a := range asp.slashings {
-		out = append(out, a)
+		out = append(out, a.slashing)
+	}
+	return out
+}
+
+// Pending returns up to max slashings, ordered by the number of validators that would be newly slashed, most first.
+// The slashings are not removed from the pool.
+func (asp *AttesterSlashingPool) Pending(max uint) []*phase0.AttesterSlashing {
+	asp.RLock()
+	defer asp.RUnlock()
+	type keyedEntry struct {
+		root  common.Root
+		entry *attesterSlashingEntry
+	}
+	entries := make([]keyedEntry, 0, len(asp.slashings))
+	for root, e := range asp.slashings {
+		entries = append(entries, keyedEntry{root: root, entry: e})
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		a, b := len(entries[i].entry.slashable), len(entries[j].entry.slashable)
+		if a != b {
+			return a > b
+		}
+		return bytes.Compare(entries[i].root[:], entries[j].root[:]) < 0
+	})
+	if uint(len(entries)) > max {
+		entries = entries[:max]
+	}
+	out := make([]*phase0.AttesterSlashing, 0, len(entries))
+	for _, e := range entries {
+		out = append(out, e.entry.slashing)
 	}
 	return out
 }
 
+// OnFinalized updates the pool with the new finalized state:
+// validators that are slashed in the finalized state are not counted as slashable anymore,
+// and slashings are dropped once all of their offenders are slashed.
+func (asp *AttesterSlashingPool) OnFinalized(ctx context.Context, state common.BeaconState) error {
+	validators, err := state.Validators()
+	if err != nil {
+		return err
+	}
+	asp.Lock()
+	defer asp.Unlock()
+	for root, e := range asp.slashings {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		err := e.slashable.Filter(func(index common.ValidatorIndex) (bool, error) {
+			v, err := validators.Validator(index)
+			if err != nil {
+				return false, err
+			}
+			slashed, err := v.Slashed()
+			return !slashed, err
+		})
+		if err != nil {
+			return fmt.Errorf("failed to check slashed validators of attester slashing %s: %v", root, err)
+		}
+		if len(e.slashable) == 0 {
+			delete(asp.slashings, root)
+		}
+	}
+	return nil
+}
+
 // Pack n slashings, removes the slashings from the pool. A reward estimator is used to pick the best slashings.
 // Slashings with negative rewards will not be packed.
 func (asp *AttesterSlashingPool) Pack(estReward func(sl *phase0.AttesterSlashing) int, n uint) []*phase0.AttesterSlashing {
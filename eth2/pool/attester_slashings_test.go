@@ -0,0 +1,94 @@
+package pool
+
+import (
+	"context"
+	"testing"
+
+	"github.com/protolambda/zrnt/eth2/beacon/common"
+	"github.com/protolambda/zrnt/eth2/beacon/phase0"
+	"github.com/protolambda/zrnt/eth2/beacon/testutil"
+	"github.com/protolambda/ztyp/tree"
+)
+
+func testIndexedAttestation(t *testing.T, state common.BeaconState, data phase0.AttestationData, indices ...common.ValidatorIndex) phase0.IndexedAttestation {
+	domain, err := common.GetDomain(state, common.DOMAIN_BEACON_ATTESTER, data.Target.Epoch)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return phase0.IndexedAttestation{
+		AttestingIndices: indices,
+		Data:             data,
+		Signature:        testutil.Sign(data.HashTreeRoot(tree.GetHashFn()), domain, indices...),
+	}
+}
+
+// testDoubleVote creates a slashing for a double vote by the given validators
+func testDoubleVote(t *testing.T, state common.BeaconState, epoch common.Epoch, indices ...common.ValidatorIndex) *phase0.AttesterSlashing {
+	data := phase0.AttestationData{
+		BeaconBlockRoot: common.Root{1},
+		Target:          common.Checkpoint{Epoch: epoch},
+	}
+	data.Slot, _ = spec.EpochStartSlot(epoch)
+	other := data
+	other.BeaconBlockRoot = common.Root{2}
+	return &phase0.AttesterSlashing{
+		Attestation1: testIndexedAttestation(t, state, data, indices...),
+		Attestation2: testIndexedAttestation(t, state, other, indices...),
+	}
+}
+
+func TestAttesterSlashingPool(t *testing.T) {
+	state, epc := testExitState(t, 16)
+	epoch := epc.CurrentEpoch.Epoch
+	asp := NewAttesterSlashingPool(spec)
+	ctx := context.Background()
+
+	small := testDoubleVote(t, state, epoch, 1, 2)
+	large := testDoubleVote(t, state, epoch, 5, 6, 7)
+	other := testDoubleVote(t, state, epoch, 8, 9)
+	for _, sl := range []*phase0.AttesterSlashing{small, large, other} {
+		if err := asp.AddAttesterSlashing(ctx, epc, state, sl); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := asp.AddAttesterSlashing(ctx, epc, state, testDoubleVote(t, state, epoch, 6, 7)); err == nil {
+		t.Fatal("expected slashing without new slashable validators to be rejected")
+	}
+	// covers the small slashing, and more
+	superset := testDoubleVote(t, state, epoch, 1, 2, 3, 4)
+	if err := asp.AddAttesterSlashing(ctx, epc, state, superset); err != nil {
+		t.Fatal(err)
+	}
+	pending := asp.Pending(10)
+	if len(pending) != 3 || pending[0] != superset || pending[1] != large || pending[2] != other {
+		t.Fatal("expected slashings ordered by number of slashable validators, without the replaced subset")
+	}
+	if pending := asp.Pending(1); len(pending) != 1 || pending[0] != superset {
+		t.Fatal("expected only the best slashing")
+	}
+
+	// the large slashing gets included on chain, and finalized
+	if err := phase0.ProcessAttesterSlashing(spec, epc, nil, state, large); err != nil {
+		t.Fatal(err)
+	}
+	// a partially overlapping slashing is included as well
+	if err := phase0.ProcessAttesterSlashing(spec, epc, nil, state, testDoubleVote(t, state, epoch, 4)); err != nil {
+		t.Fatal(err)
+	}
+	if err := asp.OnFinalized(ctx, state); err != nil {
+		t.Fatal(err)
+	}
+	pending = asp.Pending(10)
+	if len(pending) != 2 || pending[0] != superset || pending[1] != other {
+		t.Fatal("expected fully slashed slashing to be expired")
+	}
+	if err := phase0.ProcessAttesterSlashing(spec, epc, nil, state, superset); err != nil {
+		t.Fatal(err)
+	}
+	if err := asp.OnFinalized(ctx, state); err != nil {
+		t.Fatal(err)
+	}
+	if pending := asp.Pending(10); len(pending) != 1 || pending[0] != other {
+		t.Fatal("expected only the slashing with unslashed offenders to remain")
+	}
+}
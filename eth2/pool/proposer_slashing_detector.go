@@ -0,0 +1,136 @@
+package pool
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+
+	"github.com/protolambda/zrnt/eth2/beacon/common"
+	"github.com/protolambda/zrnt/eth2/beacon/phase0"
+)
+
+type observedHeader struct {
+	header *common.SignedBeaconBlockHeader
+	// true if a slashing was already produced for this proposer and slot
+	reported bool
+	// the produced slashing, until it is cleared by finalization
+	slashing *phase0.ProposerSlashing
+}
+
+// ProposerSlashingDetector remembers the first signed header per proposer and slot,
+// to produce a proposer slashing when a conflicting header is observed.
+// Headers are expected to have a verified signature, e.g. blocks that passed gossip signature checks:
+// a gossip block validation backend can feed the detector by implementing gossipval.BlockHeaderObserver.
+type ProposerSlashingDetector struct {
+	sync.Mutex
+	spec *common.Spec
+	// Number of epochs to remember headers for.
+	// Validators are slashable until they are withdrawable, so equivocations older than that are not useful.
+	maxEpochs uint64
+	headers   map[common.Slot]map[common.ValidatorIndex]*observedHeader
+	// the highest slot of any observed header
+	latestSlot common.Slot
+}
+
+func NewProposerSlashingDetector(spec *common.Spec) *ProposerSlashingDetector {
+	return &ProposerSlashingDetector{
+		spec:      spec,
+		maxEpochs: uint64(spec.MIN_VALIDATOR_WITHDRAWABILITY_DELAY),
+		headers:   make(map[common.Slot]map[common.ValidatorIndex]*observedHeader),
+	}
+}
+
+func (psd *ProposerSlashingDetector) minSlot() common.Slot {
+	window := common.Slot(psd.maxEpochs) * psd.spec.SLOTS_PER_EPOCH
+	if psd.latestSlot < window {
+		return 0
+	}
+	return psd.latestSlot - window
+}
+
+// ObserveHeader checks the header for conflicts with previously observed headers.
+// A proposer slashing is returned when the header conflicts with the first observed header of the same proposer and slot.
+// Only one slashing is produced per proposer and slot. Headers older than the retention window are ignored.
+func (psd *ProposerSlashingDetector) ObserveHeader(h *common.SignedBeaconBlockHeader) (*phase0.ProposerSlashing, error) {
+	psd.Lock()
+	defer psd.Unlock()
+	slot := h.Message.Slot
+	if slot < psd.minSlot() {
+		return nil, nil
+	}
+	slotHeaders, ok := psd.headers[slot]
+	if !ok {
+		slotHeaders = make(map[common.ValidatorIndex]*observedHeader)
+		psd.headers[slot] = slotHeaders
+	}
+	existing, ok := slotHeaders[h.Message.ProposerIndex]
+	if !ok {
+		slotHeaders[h.Message.ProposerIndex] = &observedHeader{header: h}
+		if slot > psd.latestSlot {
+			psd.latestSlot = slot
+			psd.prune()
+		}
+		return nil, nil
+	}
+	if existing.reported || existing.header.Message == h.Message {
+		return nil, nil
+	}
+	sl := &phase0.ProposerSlashing{
+		SignedHeader1: *existing.header,
+		SignedHeader2: *h,
+	}
+	if err := phase0.ValidateProposerSlashingNoSignature(psd.spec, sl); err != nil {
+		return nil, fmt.Errorf("produced invalid proposer slashing: %v", err)
+	}
+	existing.reported = true
+	existing.slashing = sl
+	return sl, nil
+}
+
+// Equivocations returns the slashings of all conflicting headers that were observed,
+// and are not pruned or cleared yet, ordered by slot and proposer.
+func (psd *ProposerSlashingDetector) Equivocations() []*phase0.ProposerSlashing {
+	psd.Lock()
+	defer psd.Unlock()
+	var out []*phase0.ProposerSlashing
+	for _, slotHeaders := range psd.headers {
+		for _, h := range slotHeaders {
+			if h.slashing != nil {
+				out = append(out, h.slashing)
+			}
+		}
+	}
+	sort.Slice(out, func(i, j int) bool {
+		a, b := &out[i].SignedHeader1.Message, &out[j].SignedHeader1.Message
+		if a.Slot != b.Slot {
+			return a.Slot < b.Slot
+		}
+		return a.ProposerIndex < b.ProposerIndex
+	})
+	return out
+}
+
+// OnFinalized clears the equivocations of the slots up to and including the finalized slot.
+// The headers of these slots are kept until they leave the retention window,
+// so the proposers of the cleared equivocations are not reported again.
+func (psd *ProposerSlashingDetector) OnFinalized(slot common.Slot) {
+	psd.Lock()
+	defer psd.Unlock()
+	for s, slotHeaders := range psd.headers {
+		if s > slot {
+			continue
+		}
+		for _, h := range slotHeaders {
+			h.slashing = nil
+		}
+	}
+}
+
+func (psd *ProposerSlashingDetector) prune() {
+	min := psd.minSlot()
+	for slot := range psd.headers {
+		if slot < min {
+			delete(psd.headers, slot)
+		}
+	}
+}
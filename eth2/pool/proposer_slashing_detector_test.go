@@ -0,0 +1,87 @@
+package pool
+
+import (
+	"testing"
+
+	"github.com/protolambda/zrnt/eth2/beacon/common"
+	"github.com/protolambda/zrnt/eth2/beacon/phase0"
+	"github.com/protolambda/zrnt/eth2/beacon/testutil"
+	"github.com/protolambda/ztyp/tree"
+)
+
+func testHeader(t *testing.T, state common.BeaconState, h common.BeaconBlockHeader) *common.SignedBeaconBlockHeader {
+	domain, err := common.GetDomain(state, common.DOMAIN_BEACON_PROPOSER, spec.SlotToEpoch(h.Slot))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &common.SignedBeaconBlockHeader{
+		Message:   h,
+		Signature: testutil.Sign(h.HashTreeRoot(tree.GetHashFn()), domain, h.ProposerIndex),
+	}
+}
+
+func TestProposerSlashingDetector(t *testing.T) {
+	state, epc := testExitState(t, 16)
+	slot, _ := spec.EpochStartSlot(epc.CurrentEpoch.Epoch)
+	psd := NewProposerSlashingDetector(spec)
+
+	a := testHeader(t, state, common.BeaconBlockHeader{Slot: slot, ProposerIndex: 3, BodyRoot: common.Root{0xa}})
+	if sl, err := psd.ObserveHeader(a); err != nil {
+		t.Fatal(err)
+	} else if sl != nil {
+		t.Fatal("unexpected slashing for first header")
+	}
+	if sl, err := psd.ObserveHeader(a); err != nil {
+		t.Fatal(err)
+	} else if sl != nil {
+		t.Fatal("unexpected slashing for identical header")
+	}
+	// same body, other proposer
+	other := testHeader(t, state, common.BeaconBlockHeader{Slot: slot, ProposerIndex: 4, BodyRoot: common.Root{0xa}})
+	if sl, err := psd.ObserveHeader(other); err != nil {
+		t.Fatal(err)
+	} else if sl != nil {
+		t.Fatal("unexpected slashing for header of other proposer")
+	}
+
+	b := testHeader(t, state, common.BeaconBlockHeader{Slot: slot, ProposerIndex: 3, BodyRoot: common.Root{0xb}})
+	sl, err := psd.ObserveHeader(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sl == nil {
+		t.Fatal("expected slashing for conflicting header")
+	}
+	if err := phase0.ValidateProposerSlashing(spec, epc, nil, state, sl); err != nil {
+		t.Fatalf("produced invalid slashing: %v", err)
+	}
+	if sl, err := psd.ObserveHeader(b); err != nil {
+		t.Fatal(err)
+	} else if sl != nil {
+		t.Fatal("expected only a single slashing per proposer and slot")
+	}
+	if eqs := psd.Equivocations(); len(eqs) != 1 || eqs[0] != sl {
+		t.Fatalf("expected the slashing as equivocation, got %d", len(eqs))
+	}
+
+	// a later equivocation, by another proposer
+	c := testHeader(t, state, common.BeaconBlockHeader{Slot: slot + 1, ProposerIndex: 5, BodyRoot: common.Root{0xc}})
+	d := testHeader(t, state, common.BeaconBlockHeader{Slot: slot + 1, ProposerIndex: 5, BodyRoot: common.Root{0xd}})
+	for _, h := range []*common.SignedBeaconBlockHeader{d, c} {
+		if _, err := psd.ObserveHeader(h); err != nil {
+			t.Fatal(err)
+		}
+	}
+	eqs := psd.Equivocations()
+	if len(eqs) != 2 || eqs[0] != sl || eqs[1].SignedHeader1 != *d || eqs[1].SignedHeader2 != *c {
+		t.Fatal("expected equivocations ordered by slot")
+	}
+	// finalization of the first slot clears its equivocation, without reporting it again
+	psd.OnFinalized(slot)
+	if eqs := psd.Equivocations(); len(eqs) != 1 || eqs[0].SignedHeader1.Message.Slot != slot+1 {
+		t.Fatal("expected only the equivocation after the finalized slot")
+	}
+	if sl, err := psd.ObserveHeader(b); err != nil || sl != nil {
+		t.Fatal("expected no slashing for equivocation of finalized slot that was already reported")
+	}
+}
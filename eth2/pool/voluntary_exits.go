@@ -3,6 +3,7 @@ package pool
 import (
 	"context"
 	"fmt"
+	"sort"
 	"sync"
 
 	"github.com/protolambda/zrnt/eth2/beacon/common"
@@ -13,6 +14,9 @@ type VoluntaryExitPool struct {
 	sync.RWMutex
 	spec  *common.Spec
 	exits map[common.ValidatorIndex]*phase0.SignedVoluntaryExit
+	// epoch of the head the exits were last fully re-validated against
+	validatedEpoch common.Epoch
+	validated      bool
 }
 
 func NewVoluntaryExitPool(spec *common.Spec) *VoluntaryExitPool {
@@ -43,9 +47,109 @@ func (vep *VoluntaryExitPool) All() []*phase0.SignedVoluntaryExit {
 	return out
 }
 
+// exiting checks if the validator already has an exit epoch set in the state,
+// e.g. because an exit was included, or the validator got slashed.
+func exiting(state common.BeaconState, index common.ValidatorIndex) (bool, error) {
+	vals, err := state.Validators()
+	if err != nil {
+		return false, err
+	}
+	if valid, err := vals.IsValidIndex(index); err != nil {
+		return false, err
+	} else if !valid {
+		return false, nil
+	}
+	v, err := vals.Validator(index)
+	if err != nil {
+		return false, err
+	}
+	exitEpoch, err := v.ExitEpoch()
+	if err != nil {
+		return false, err
+	}
+	return exitEpoch != common.FAR_FUTURE_EPOCH, nil
+}
+
+// OnHead updates the pool for the new head: exits of validators that are already exiting in the head state are dropped.
+// On the first head of a new epoch all exits are fully re-validated against the head state, and invalid exits are dropped.
+// Returns the number of dropped exits.
+func (vep *VoluntaryExitPool) OnHead(ctx context.Context, epc *common.EpochsContext, state common.BeaconState) (dropped int, err error) {
+	vep.Lock()
+	defer vep.Unlock()
+	epoch := epc.CurrentEpoch.Epoch
+	full := !vep.validated || vep.validatedEpoch != epoch
+	for index, exit := range vep.exits {
+		if err := ctx.Err(); err != nil {
+			return dropped, err
+		}
+		if full {
+			if err := phase0.ValidateVoluntaryExit(vep.spec, epc, nil, state, exit); err != nil {
+				delete(vep.exits, index)
+				dropped++
+			}
+			continue
+		}
+		if ex, err := exiting(state, index); err != nil {
+			return dropped, fmt.Errorf("failed to check exit status of validator %d: %v", index, err)
+		} else if ex {
+			delete(vep.exits, index)
+			dropped++
+		}
+	}
+	if full {
+		vep.validatedEpoch = epoch
+		vep.validated = true
+	}
+	return dropped, nil
+}
+
 // Pack n exits, removes the exits from the pool. A ranking function is used to pick the best exits.
 // Exits with negative rank function outputs will not be packed.
 func (vep *VoluntaryExitPool) Pack(rank func(sl *phase0.SignedVoluntaryExit) int, n uint) []*phase0.SignedVoluntaryExit {
-	// TODO
-	return nil
+	vep.Lock()
+	defer vep.Unlock()
+	type ranked struct {
+		exit *phase0.SignedVoluntaryExit
+		rank int
+	}
+	candidates := make([]ranked, 0, len(vep.exits))
+	for _, exit := range vep.exits {
+		if r := rank(exit); r >= 0 {
+			candidates = append(candidates, ranked{exit: exit, rank: r})
+		}
+	}
+	sort.Slice(candidates, func(i, j int) bool {
+		if candidates[i].rank != candidates[j].rank {
+			return candidates[i].rank > candidates[j].rank
+		}
+		return candidates[i].exit.Message.ValidatorIndex < candidates[j].exit.Message.ValidatorIndex
+	})
+	if uint(len(candidates)) > n {
+		candidates = candidates[:n]
+	}
+	out := make([]*phase0.SignedVoluntaryExit, 0, len(candidates))
+	for _, c := range candidates {
+		out = append(out, c.exit)
+		delete(vep.exits, c.exit.Message.ValidatorIndex)
+	}
+	return out
+}
+
+// PackValid packs up to n exits that are valid for inclusion in a block on top of the given pre-state,
+// lowest validator index first. Exits that are no longer valid are dropped from the pool.
+func (vep *VoluntaryExitPool) PackValid(epc *common.EpochsContext, state common.BeaconState, n uint) []*phase0.SignedVoluntaryExit {
+	var invalid []common.ValidatorIndex
+	out := vep.Pack(func(exit *phase0.SignedVoluntaryExit) int {
+		if err := phase0.ValidateVoluntaryExit(vep.spec, epc, nil, state, exit); err != nil {
+			invalid = append(invalid, exit.Message.ValidatorIndex)
+			return -1
+		}
+		return 0
+	}, n)
+	vep.Lock()
+	defer vep.Unlock()
+	for _, index := range invalid {
+		delete(vep.exits, index)
+	}
+	return out
 }
@@ -0,0 +1,82 @@
+package pool
+
+import (
+	"context"
+	"testing"
+
+	"github.com/protolambda/zrnt/eth2/beacon/common"
+	"github.com/protolambda/zrnt/eth2/beacon/phase0"
+	"github.com/protolambda/zrnt/eth2/beacon/testutil"
+	"github.com/protolambda/ztyp/tree"
+)
+
+// testExitState creates a state with the given number of validators,
+// at the first epoch where the genesis validators are allowed to exit.
+func testExitState(t *testing.T, count uint64) (*phase0.BeaconStateView, *common.EpochsContext) {
+	slot, err := spec.EpochStartSlot(common.Epoch(spec.SHARD_COMMITTEE_PERIOD))
+	if err != nil {
+		t.Fatal(err)
+	}
+	state, epc, err := testutil.GenerateTestState(spec, count, testutil.StateOptions{Slot: slot})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return state.(*phase0.BeaconStateView), epc
+}
+
+func testExit(t *testing.T, state common.BeaconState, epoch common.Epoch, index common.ValidatorIndex) *phase0.SignedVoluntaryExit {
+	exit := phase0.VoluntaryExit{Epoch: epoch, ValidatorIndex: index}
+	domain, err := common.GetDomain(state, common.DOMAIN_VOLUNTARY_EXIT, epoch)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &phase0.SignedVoluntaryExit{
+		Message:   exit,
+		Signature: testutil.Sign(exit.HashTreeRoot(tree.GetHashFn()), domain, index),
+	}
+}
+
+func TestVoluntaryExitPoolOnHead(t *testing.T) {
+	state, epc := testExitState(t, 16)
+	epoch := epc.CurrentEpoch.Epoch
+	vep := NewVoluntaryExitPool(spec)
+	ctx := context.Background()
+	included, pending := testExit(t, state, epoch, 3), testExit(t, state, epoch, 5)
+	invalid := testExit(t, state, epoch, 7)
+	invalid.Message.Epoch += 1 // does not match the signature, and is not valid yet
+	for _, exit := range []*phase0.SignedVoluntaryExit{included, pending, invalid} {
+		if err := vep.AddVoluntaryExit(ctx, exit); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if dropped, err := vep.OnHead(ctx, epc, state); err != nil {
+		t.Fatal(err)
+	} else if dropped != 1 {
+		t.Fatalf("expected only the invalid exit to be dropped, dropped %d", dropped)
+	}
+
+	// a block on the new head includes the exit
+	if err := phase0.ProcessVoluntaryExit(spec, epc, nil, state, included); err != nil {
+		t.Fatal(err)
+	}
+	if dropped, err := vep.OnHead(ctx, epc, state); err != nil {
+		t.Fatal(err)
+	} else if dropped != 1 {
+		t.Fatalf("expected the included exit to be dropped, dropped %d", dropped)
+	}
+	all := vep.All()
+	if len(all) != 1 || all[0] != pending {
+		t.Fatalf("expected only the pending exit to remain, got %d exits", len(all))
+	}
+
+	// the pending exit is included too, without the pool seeing the head change
+	if err := phase0.ProcessVoluntaryExit(spec, epc, nil, state, pending); err != nil {
+		t.Fatal(err)
+	}
+	if packed := vep.PackValid(epc, state, 4); len(packed) != 0 {
+		t.Fatalf("expected redundant exit to not be packed, got %d exits", len(packed))
+	}
+	if all := vep.All(); len(all) != 0 {
+		t.Fatalf("expected redundant exit to be dropped when packing, got %d exits", len(all))
+	}
+}
@@ -0,0 +1,122 @@
+package bls
+
+import (
+	"crypto/rand"
+	"fmt"
+
+	kbls "github.com/kilic/bls12-381"
+)
+
+// BatchVerifier accumulates (pubkey, message, signature) triples, to verify them all at once in a single multi-pairing.
+// Every triple is multiplied with a random scalar, so invalid triples cannot cancel each other out.
+// A batch only tells if all triples are valid: see FirstInvalid to find an invalid one.
+//
+// The batch verification is implemented here instead of using the SignatureSetVerify of the backend:
+// the backend does not apply a random scalar to the second triple, which is thus not verified.
+type BatchVerifier struct {
+	pubkeys    []*Pubkey
+	messages   [][]byte
+	signatures []*Signature
+	// set when a triple is added that can never be valid
+	invalid bool
+}
+
+func NewBatchVerifier(capacity int) *BatchVerifier {
+	return &BatchVerifier{
+		pubkeys:    make([]*Pubkey, 0, capacity),
+		messages:   make([][]byte, 0, capacity),
+		signatures: make([]*Signature, 0, capacity),
+	}
+}
+
+// Add queues the triple for verification. The message must not be modified until the batch is verified.
+func (bv *BatchVerifier) Add(pub *Pubkey, message []byte, sig *Signature) {
+	if IsInfinityPubkey(pub) {
+		bv.invalid = true
+	}
+	bv.pubkeys = append(bv.pubkeys, pub)
+	bv.messages = append(bv.messages, message)
+	bv.signatures = append(bv.signatures, sig)
+}
+
+// Len returns the number of queued triples.
+func (bv *BatchVerifier) Len() int {
+	return len(bv.pubkeys)
+}
+
+// Verify checks all queued triples at once. An empty batch is valid.
+// An error is returned if the batch could not be verified, e.g. when no randomness is available.
+//
+// Every triple i gets a random 64-bit scalar r_i, and the batch is valid if
+// prod(e(r_i * pubkey_i, H(message_i))) == e(G1, sum(r_i * signature_i)).
+func (bv *BatchVerifier) Verify() (bool, error) {
+	if bv.invalid {
+		return false, nil
+	}
+	n := len(bv.pubkeys)
+	if n == 0 {
+		return true, nil
+	}
+	// Fetch all randomness at once. Note: the scalars of all triples must be random,
+	// a zero or known scalar would exclude a triple from the check.
+	rng := make([]byte, 8*n, 8*n)
+	if _, err := rand.Read(rng); err != nil {
+		return false, fmt.Errorf("failed to read batch randomness: %v", err)
+	}
+	g1 := kbls.NewG1()
+	g2 := kbls.NewG2()
+	eng := kbls.NewEngine()
+	aggSig := g2.Zero()
+	var scalar kbls.Fr
+	var sig kbls.PointG2
+	for i := 0; i < n; i++ {
+		r := rng[i*8 : (i+1)*8]
+		if isZero(r) {
+			r[7] = 1
+		}
+		scalar.FromBytes(r)
+		pub := g1.MulScalar(new(kbls.PointG1), (*kbls.PointG1)(bv.pubkeys[i]), &scalar)
+		msg, err := g2.HashToCurve(bv.messages[i], domain)
+		if err != nil {
+			return false, fmt.Errorf("failed to hash message %d to curve: %v", i, err)
+		}
+		eng.AddPair(pub, msg)
+		g2.MulScalar(&sig, (*kbls.PointG2)(bv.signatures[i]), &scalar)
+		g2.Add(aggSig, aggSig, &sig)
+	}
+	eng.AddPairInv(&kbls.G1One, aggSig)
+	return eng.Check(), nil
+}
+
+func isZero(b []byte) bool {
+	for _, v := range b {
+		if v != 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// FirstInvalid verifies the queued triples one by one, and returns the index of the first invalid triple,
+// e.g. to identify the invalid triple of a batch that failed to verify.
+func (bv *BatchVerifier) FirstInvalid() (index int, ok bool) {
+	for i := range bv.pubkeys {
+		if !Verify(bv.pubkeys[i], bv.messages[i], bv.signatures[i]) {
+			return i, true
+		}
+	}
+	return 0, false
+}
+
+// Reset drops the queued triples, to re-use the verifier for a new batch.
+func (bv *BatchVerifier) Reset() {
+	for i := range bv.pubkeys {
+		bv.pubkeys[i] = nil
+		bv.messages[i] = nil
+		bv.signatures[i] = nil
+	}
+	bv.pubkeys = bv.pubkeys[:0]
+	bv.messages = bv.messages[:0]
+	bv.signatures = bv.signatures[:0]
+	bv.invalid = false
+}
@@ -0,0 +1,93 @@
+// Package bls exposes the BLS signature primitives used by the beacon chain, independent of the backend.
+// The backend can be swapped here, without changing the users of this package.
+// The spec rules for identity pubkeys and empty inputs are enforced here, regardless of the backend.
+package bls
+
+import (
+	"errors"
+
+	kbls "github.com/kilic/bls12-381"
+	blsu "github.com/protolambda/bls12-381-util"
+)
+
+// domain separation tag of the proof-of-possession ciphersuite, as used by the backend
+var domain = []byte("BLS_SIG_BLS12381G2_XMD:SHA-256_SSWU_RO_POP_")
+
+type Pubkey = blsu.Pubkey
+
+type Signature = blsu.Signature
+
+// IsInfinityPubkey checks if the pubkey is the identity point, which fails the KeyValidate of the spec.
+// Deserialization of a pubkey does not reject the identity point.
+func IsInfinityPubkey(pub *Pubkey) bool {
+	return (*kbls.G1)(nil).IsZero((*kbls.PointG1)(pub))
+}
+
+// IsInfinitySignature checks if the signature is the G2 point at infinity.
+func IsInfinitySignature(sig *Signature) bool {
+	return (*kbls.G2)(nil).IsZero((*kbls.PointG2)(sig))
+}
+
+func anyInfinityPubkey(pubkeys []*Pubkey) bool {
+	for _, pub := range pubkeys {
+		if IsInfinityPubkey(pub) {
+			return true
+		}
+	}
+	return false
+}
+
+// Verify checks the signature of a single pubkey over the message.
+func Verify(pub *Pubkey, message []byte, sig *Signature) bool {
+	if IsInfinityPubkey(pub) {
+		return false
+	}
+	return blsu.Verify(pub, message, sig)
+}
+
+// AggregateVerify checks the aggregate signature over distinct messages, one per pubkey.
+// There must be at least one pubkey, and the number of pubkeys must match the number of messages.
+func AggregateVerify(pubkeys []*Pubkey, messages [][]byte, sig *Signature) bool {
+	if len(pubkeys) == 0 || len(pubkeys) != len(messages) || anyInfinityPubkey(pubkeys) {
+		return false
+	}
+	return blsu.AggregateVerify(pubkeys, messages, sig)
+}
+
+// FastAggregateVerify checks the aggregate signature of the pubkeys over the same message.
+// There must be at least one pubkey.
+func FastAggregateVerify(pubkeys []*Pubkey, message []byte, sig *Signature) bool {
+	if len(pubkeys) == 0 || anyInfinityPubkey(pubkeys) {
+		return false
+	}
+	return blsu.FastAggregateVerify(pubkeys, message, sig)
+}
+
+// Eth2FastAggregateVerify is FastAggregateVerify, but accepts the infinity signature for an empty set of pubkeys,
+// as specified by eth2_fast_aggregate_verify.
+func Eth2FastAggregateVerify(pubkeys []*Pubkey, message []byte, sig *Signature) bool {
+	if len(pubkeys) == 0 {
+		return IsInfinitySignature(sig)
+	}
+	return FastAggregateVerify(pubkeys, message, sig)
+}
+
+// AggregateSignatures aggregates one or more signatures into one.
+func AggregateSignatures(sigs []*Signature) (*Signature, error) {
+	if len(sigs) == 0 {
+		return nil, errors.New("need at least 1 signature to aggregate")
+	}
+	return blsu.Aggregate(sigs)
+}
+
+// AggregatePubkeys aggregates one or more pubkeys into one, as specified by eth2_aggregate_pubkeys.
+// Infinity pubkeys are rejected.
+func AggregatePubkeys(pubkeys []*Pubkey) (*Pubkey, error) {
+	if len(pubkeys) == 0 {
+		return nil, errors.New("need at least 1 pubkey to aggregate")
+	}
+	if anyInfinityPubkey(pubkeys) {
+		return nil, errors.New("cannot aggregate infinity pubkey")
+	}
+	return blsu.AggregatePubkeys(pubkeys)
+}
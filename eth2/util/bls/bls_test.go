@@ -0,0 +1,209 @@
+package bls
+
+import (
+	"encoding/binary"
+	"fmt"
+	"testing"
+
+	blsu "github.com/protolambda/bls12-381-util"
+)
+
+type testTriple struct {
+	pub *Pubkey
+	msg []byte
+	sig *Signature
+}
+
+func testKey(t *testing.T, i uint64) *blsu.SecretKey {
+	t.Helper()
+	var data [32]byte
+	binary.BigEndian.PutUint64(data[24:], i+1)
+	var sk blsu.SecretKey
+	if err := sk.Deserialize(&data); err != nil {
+		t.Fatal(err)
+	}
+	return &sk
+}
+
+func testTriples(t *testing.T, n uint64) []testTriple {
+	t.Helper()
+	out := make([]testTriple, n)
+	for i := range out {
+		sk := testKey(t, uint64(i))
+		pub, err := blsu.SkToPk(sk)
+		if err != nil {
+			t.Fatal(err)
+		}
+		msg := []byte(fmt.Sprintf("message %d", i))
+		out[i] = testTriple{pub: pub, msg: msg, sig: blsu.Sign(sk, msg)}
+	}
+	return out
+}
+
+func testInfinityPubkey(t *testing.T) *Pubkey {
+	t.Helper()
+	var data [48]byte
+	data[0] = 0xc0
+	var pub Pubkey
+	if err := pub.Deserialize(&data); err != nil {
+		t.Fatal(err)
+	}
+	return &pub
+}
+
+func testInfinitySignature(t *testing.T) *Signature {
+	t.Helper()
+	var data [96]byte
+	data[0] = 0xc0
+	var sig Signature
+	if err := sig.Deserialize(&data); err != nil {
+		t.Fatal(err)
+	}
+	return &sig
+}
+
+func TestBatchVerifier(t *testing.T) {
+	triples := testTriples(t, 10)
+	bv := NewBatchVerifier(len(triples))
+	for i, tr := range triples {
+		if !Verify(tr.pub, tr.msg, tr.sig) {
+			t.Fatalf("triple %d is not valid individually", i)
+		}
+		bv.Add(tr.pub, tr.msg, tr.sig)
+	}
+	if valid, err := bv.Verify(); err != nil {
+		t.Fatal(err)
+	} else if !valid {
+		t.Fatal("expected valid batch")
+	}
+
+	// corrupt a single item: a signature of another message
+	for corrupt := range triples {
+		bv.Reset()
+		for i, tr := range triples {
+			if i == corrupt {
+				bv.Add(tr.pub, tr.msg, triples[(i+1)%len(triples)].sig)
+			} else {
+				bv.Add(tr.pub, tr.msg, tr.sig)
+			}
+		}
+		if valid, err := bv.Verify(); err != nil {
+			t.Fatal(err)
+		} else if valid {
+			t.Fatalf("expected corrupted triple %d to be detected", corrupt)
+		}
+		if i, ok := bv.FirstInvalid(); !ok || i != corrupt {
+			t.Fatalf("expected triple %d to be found invalid, got %d, ok: %v", corrupt, i, ok)
+		}
+	}
+
+	// swapped signatures of two items are not valid either
+	bv.Reset()
+	for i, tr := range triples {
+		sig := tr.sig
+		if i < 2 {
+			sig = triples[1-i].sig
+		}
+		bv.Add(tr.pub, tr.msg, sig)
+	}
+	if valid, _ := bv.Verify(); valid {
+		t.Fatal("expected swapped signatures to be detected")
+	}
+
+	if i, ok := bv.FirstInvalid(); !ok || i != 0 {
+		t.Fatalf("expected the first swapped signature to be found invalid, got %d, ok: %v", i, ok)
+	}
+
+	bv.Reset()
+	if valid, err := bv.Verify(); err != nil || !valid {
+		t.Fatal("expected empty batch to be valid")
+	}
+	bv.Add(testInfinityPubkey(t), []byte("foo"), testInfinitySignature(t))
+	if valid, _ := bv.Verify(); valid {
+		t.Fatal("expected infinity pubkey to be rejected")
+	}
+}
+
+func TestAggregateVerify(t *testing.T) {
+	triples := testTriples(t, 5)
+	pubs := make([]*Pubkey, len(triples))
+	msgs := make([][]byte, len(triples))
+	sigs := make([]*Signature, len(triples))
+	for i, tr := range triples {
+		pubs[i], msgs[i], sigs[i] = tr.pub, tr.msg, tr.sig
+	}
+	agg, err := AggregateSignatures(sigs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !AggregateVerify(pubs, msgs, agg) {
+		t.Fatal("expected valid aggregate")
+	}
+	if AggregateVerify(pubs[1:], msgs[1:], agg) {
+		t.Fatal("expected aggregate with missing signer to be invalid")
+	}
+	if AggregateVerify(pubs, msgs[1:], agg) {
+		t.Fatal("expected mismatching inputs to be invalid")
+	}
+	if AggregateVerify(nil, nil, agg) {
+		t.Fatal("expected empty aggregate verification to be invalid")
+	}
+	if AggregateVerify(append([]*Pubkey{testInfinityPubkey(t)}, pubs...), append([][]byte{[]byte("foo")}, msgs...), agg) {
+		t.Fatal("expected infinity pubkey to be rejected")
+	}
+	if _, err := AggregateSignatures(nil); err == nil {
+		t.Fatal("expected error for empty signature aggregation")
+	}
+}
+
+func TestFastAggregateVerify(t *testing.T) {
+	msg := []byte("same message")
+	pubs := make([]*Pubkey, 4)
+	sigs := make([]*Signature, 4)
+	for i := range pubs {
+		sk := testKey(t, uint64(i))
+		var err error
+		pubs[i], err = blsu.SkToPk(sk)
+		if err != nil {
+			t.Fatal(err)
+		}
+		sigs[i] = blsu.Sign(sk, msg)
+	}
+	agg, err := AggregateSignatures(sigs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !FastAggregateVerify(pubs, msg, agg) {
+		t.Fatal("expected valid fast aggregate")
+	}
+	aggPub, err := AggregatePubkeys(pubs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !Verify(aggPub, msg, agg) {
+		t.Fatal("expected aggregate pubkey to verify the aggregate signature")
+	}
+	if FastAggregateVerify(pubs[:3], msg, agg) {
+		t.Fatal("expected fast aggregate with missing signer to be invalid")
+	}
+	// the identity point does not change the aggregate, but must still be rejected, also in first position
+	withInfinity := append([]*Pubkey{testInfinityPubkey(t)}, pubs...)
+	if FastAggregateVerify(withInfinity, msg, agg) {
+		t.Fatal("expected infinity pubkey to be rejected")
+	}
+	if _, err := AggregatePubkeys(withInfinity); err == nil {
+		t.Fatal("expected error for aggregating infinity pubkey")
+	}
+	if Verify(testInfinityPubkey(t), msg, testInfinitySignature(t)) {
+		t.Fatal("expected infinity pubkey to be rejected")
+	}
+	if FastAggregateVerify(nil, msg, testInfinitySignature(t)) {
+		t.Fatal("expected no keys to be rejected")
+	}
+	if !Eth2FastAggregateVerify(nil, msg, testInfinitySignature(t)) {
+		t.Fatal("expected no keys with infinity signature to be accepted")
+	}
+	if Eth2FastAggregateVerify(nil, msg, agg) {
+		t.Fatal("expected no keys with other signature to be rejected")
+	}
+}
@@ -0,0 +1,110 @@
+package benches
+
+import (
+	"context"
+	"encoding/binary"
+	"testing"
+
+	blsu "github.com/protolambda/bls12-381-util"
+	"github.com/protolambda/zrnt/eth2/beacon"
+	"github.com/protolambda/zrnt/eth2/beacon/common"
+	"github.com/protolambda/zrnt/eth2/beacon/phase0"
+	"github.com/protolambda/ztyp/tree"
+)
+
+// 4 committees per slot on mainnet, for a full block of 128 aggregates from the last 32 slots.
+const blockAttestationsValidatorFill = 16384
+
+// Creates a state and the attestations of a full block, with full participation.
+// Secret key of validator i is i+1, so the aggregate signature can be signed by the sum of the committee keys.
+func createFullBlockAttestations(b *testing.B) (*phase0.BeaconStateView, *common.EpochsContext, []phase0.Attestation) {
+	validators := CreateTestValidators(blockAttestationsValidatorFill+1, MAX_EFFECTIVE_BALANCE)[1:]
+	state, epc, err := phase0.KickStartState(spec, common.Root{123}, 1564000000, validators)
+	if err != nil {
+		b.Fatal(err)
+	}
+	ctx := context.Background()
+	currentSlot := spec.SLOTS_PER_EPOCH + 1
+	if err := common.ProcessSlots(ctx, spec, epc, &beacon.StandardUpgradeableBeaconState{BeaconState: state}, currentSlot); err != nil {
+		b.Fatal(err)
+	}
+	if err := common.WarmPubkeyCache(ctx, epc.ValidatorPubkeyCache, 0); err != nil {
+		b.Fatal(err)
+	}
+	var atts []phase0.Attestation
+	for slot := currentSlot - spec.SLOTS_PER_EPOCH; slot < currentSlot; slot++ {
+		target := spec.SlotToEpoch(slot)
+		var source common.Checkpoint
+		if target == spec.SlotToEpoch(currentSlot) {
+			source, err = state.CurrentJustifiedCheckpoint()
+		} else {
+			source, err = state.PreviousJustifiedCheckpoint()
+		}
+		if err != nil {
+			b.Fatal(err)
+		}
+		dom, err := common.GetDomain(state, common.DOMAIN_BEACON_ATTESTER, target)
+		if err != nil {
+			b.Fatal(err)
+		}
+		count, err := epc.GetCommitteeCountPerSlot(target)
+		if err != nil {
+			b.Fatal(err)
+		}
+		for index := common.CommitteeIndex(0); uint64(index) < count && len(atts) < int(spec.MAX_ATTESTATIONS); index++ {
+			committee, err := epc.GetBeaconCommittee(slot, index)
+			if err != nil {
+				b.Fatal(err)
+			}
+			att := phase0.Attestation{
+				AggregationBits: phase0.NewAttestationBits(uint64(len(committee))),
+				Data: phase0.AttestationData{
+					Slot:   slot,
+					Index:  index,
+					Source: source,
+					Target: common.Checkpoint{Epoch: target},
+				},
+			}
+			var skSum uint64
+			for i, vi := range committee {
+				att.AggregationBits.SetBit(uint64(i), true)
+				skSum += uint64(vi) + 1
+			}
+			var data [32]byte
+			binary.BigEndian.PutUint64(data[24:], skSum)
+			var sk blsu.SecretKey
+			if err := sk.Deserialize(&data); err != nil {
+				b.Fatal(err)
+			}
+			root := common.ComputeSigningRoot(att.Data.HashTreeRoot(tree.GetHashFn()), dom)
+			att.Signature = blsu.Sign(&sk, root[:]).Serialize()
+			atts = append(atts, att)
+		}
+	}
+	return state, epc, atts
+}
+
+func benchBlockAttestations(b *testing.B, parallelism int) {
+	state, epc, atts := createFullBlockAttestations(b)
+	ctx := context.Background()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		b.StopTimer()
+		pre, err := phase0.AsBeaconStateView(state.Copy())
+		if err != nil {
+			b.Fatal(err)
+		}
+		b.StartTimer()
+		if err := phase0.ProcessAttestationsParallel(ctx, spec, epc, nil, pre, atts, parallelism); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkBlockAttestationsSerial(b *testing.B) {
+	benchBlockAttestations(b, 1)
+}
+
+func BenchmarkBlockAttestationsParallel(b *testing.B) {
+	benchBlockAttestations(b, 0)
+}
@@ -0,0 +1,86 @@
+package benches
+
+import (
+	"testing"
+
+	"github.com/protolambda/zrnt/eth2/beacon/common"
+	"github.com/protolambda/zrnt/eth2/beacon/phase0"
+	"github.com/protolambda/ztyp/tree"
+)
+
+const balancesValidatorFill = 100000
+
+// Only the balances matter for the balance update phase of the epoch transition, the registry is left empty.
+func createBalancesState(b *testing.B) (*phase0.BeaconStateView, *common.Deltas) {
+	state := phase0.NewBeaconStateView(spec)
+	balances := make([]common.Gwei, balancesValidatorFill)
+	deltas := common.NewDeltas(balancesValidatorFill)
+	for i := range balances {
+		balances[i] = MAX_EFFECTIVE_BALANCE + common.Gwei(i)
+		// nearly every validator has a reward or penalty in a regular epoch
+		if i%8 == 0 {
+			deltas.Penalties[i] = 12000
+		} else {
+			deltas.Rewards[i] = 15000 + common.Gwei(i%100)
+		}
+	}
+	if err := state.SetBalances(balances); err != nil {
+		b.Fatal(err)
+	}
+	// hash once, like a state after a previous block
+	state.HashTreeRoot(tree.GetHashFn())
+	return state, deltas
+}
+
+func benchBalanceUpdate(b *testing.B, apply func(state *phase0.BeaconStateView, deltas *common.Deltas) error) {
+	state, deltas := createBalancesState(b)
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		b.StopTimer()
+		pre, err := phase0.AsBeaconStateView(state.Copy())
+		if err != nil {
+			b.Fatal(err)
+		}
+		b.StartTimer()
+		if err := apply(pre, deltas); err != nil {
+			b.Fatal(err)
+		}
+		pre.HashTreeRoot(tree.GetHashFn())
+	}
+}
+
+func BenchmarkBalanceUpdateBatched(b *testing.B) {
+	benchBalanceUpdate(b, func(state *phase0.BeaconStateView, deltas *common.Deltas) error {
+		return common.ApplyBalanceDeltas(spec, state, deltas.Rewards, deltas.Penalties)
+	})
+}
+
+// The previous approach: rebuild the full balances tree from a slice.
+func BenchmarkBalanceUpdateRebuild(b *testing.B) {
+	benchBalanceUpdate(b, func(state *phase0.BeaconStateView, deltas *common.Deltas) error {
+		balances, err := common.ApplyDeltas(state, deltas)
+		if err != nil {
+			return err
+		}
+		return state.SetBalances(balances)
+	})
+}
+
+func BenchmarkBalanceUpdatePerIndex(b *testing.B) {
+	benchBalanceUpdate(b, func(state *phase0.BeaconStateView, deltas *common.Deltas) error {
+		bals, err := state.Balances()
+		if err != nil {
+			return err
+		}
+		for i := range deltas.Rewards {
+			if err := common.IncreaseBalance(bals, common.ValidatorIndex(i), deltas.Rewards[i]); err != nil {
+				return err
+			}
+			if err := common.DecreaseBalance(bals, common.ValidatorIndex(i), deltas.Penalties[i]); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
@@ -0,0 +1,71 @@
+package benches
+
+import (
+	"testing"
+
+	"github.com/protolambda/zrnt/eth2/beacon/common"
+	"github.com/protolambda/zrnt/eth2/beacon/phase0"
+	"github.com/protolambda/ztyp/tree"
+)
+
+// Blocks with the max attestations, deposits and voluntary exits, for a by-range response of full blocks.
+func createFullBlocks(count int) []*phase0.SignedBeaconBlock {
+	blocks := make([]*phase0.SignedBeaconBlock, count)
+	for i := range blocks {
+		b := &phase0.SignedBeaconBlock{Message: phase0.BeaconBlock{
+			Slot:       common.Slot(i),
+			ParentRoot: common.Root{byte(i), byte(i >> 8)},
+		}}
+		body := &b.Message.Body
+		for j := uint64(0); j < uint64(spec.MAX_ATTESTATIONS); j++ {
+			bits := phase0.NewAttestationBits(128)
+			for k := uint64(0); k < 128; k += 2 {
+				bits.SetBit(k, true)
+			}
+			body.Attestations = append(body.Attestations, phase0.Attestation{
+				AggregationBits: bits,
+				Data: phase0.AttestationData{
+					Slot:            common.Slot(i),
+					Index:           common.CommitteeIndex(j),
+					BeaconBlockRoot: common.Root{byte(i), byte(j)},
+				},
+			})
+		}
+		for j := uint64(0); j < uint64(spec.MAX_DEPOSITS); j++ {
+			dep := common.Deposit{Data: common.DepositData{Amount: MAX_EFFECTIVE_BALANCE}}
+			dep.Data.Pubkey[0] = byte(j)
+			for k := range dep.Proof {
+				dep.Proof[k] = common.Root{byte(k), byte(j)}
+			}
+			body.Deposits = append(body.Deposits, dep)
+		}
+		for j := uint64(0); j < uint64(spec.MAX_VOLUNTARY_EXITS); j++ {
+			body.VoluntaryExits = append(body.VoluntaryExits, phase0.SignedVoluntaryExit{
+				Message: phase0.VoluntaryExit{ValidatorIndex: common.ValidatorIndex(j)},
+			})
+		}
+		blocks[i] = b
+	}
+	return blocks
+}
+
+func BenchmarkBlockRootsSerial(b *testing.B) {
+	blocks := createFullBlocks(64)
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		hFn := tree.GetHashFn()
+		for _, block := range blocks {
+			block.Message.HashTreeRoot(spec, hFn)
+		}
+	}
+}
+
+func BenchmarkBlockRootsParallel(b *testing.B) {
+	blocks := createFullBlocks(64)
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		phase0.HashTreeRoots(spec, blocks, 0)
+	}
+}
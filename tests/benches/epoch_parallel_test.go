@@ -0,0 +1,41 @@
+package benches
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/protolambda/zrnt/eth2/beacon"
+	"github.com/protolambda/zrnt/eth2/beacon/common"
+	"github.com/protolambda/zrnt/eth2/beacon/phase0"
+)
+
+const epochParallelValidatorFill = 200000
+
+// The epoch transition with the per-validator computations split over 1, 4 and 8 workers.
+func BenchmarkEpochTransitionParallelism(b *testing.B) {
+	state, epc := CreateTestState(epochParallelValidatorFill, MAX_EFFECTIVE_BALANCE)
+	ctx := context.Background()
+	slot, _ := spec.EpochStartSlot(3)
+	if err := common.ProcessSlots(ctx, spec, epc, &beacon.StandardUpgradeableBeaconState{BeaconState: state}, slot-1); err != nil {
+		b.Fatal(err)
+	}
+	for _, workers := range []int{1, 4, 8} {
+		b.Run(fmt.Sprintf("workers_%d", workers), func(b *testing.B) {
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				b.StopTimer()
+				pre, err := phase0.AsBeaconStateView(state.Copy())
+				if err != nil {
+					b.Fatal(err)
+				}
+				preEpc := epc.Clone()
+				preEpc.EpochProcessParallelism = workers
+				b.StartTimer()
+				if err := common.ProcessSlots(ctx, spec, preEpc, &beacon.StandardUpgradeableBeaconState{BeaconState: pre}, slot); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,46 @@
+package benches
+
+import (
+	"context"
+	"testing"
+
+	"github.com/protolambda/zrnt/eth2/beacon"
+	"github.com/protolambda/zrnt/eth2/beacon/common"
+	"github.com/protolambda/zrnt/eth2/beacon/phase0"
+)
+
+const epochValidatorFill = 30000
+
+// Allocations of a steady-state epoch transition: the transition from the last slot of an epoch to the next epoch.
+func BenchmarkEpochTransition(b *testing.B) {
+	state, epc := CreateTestState(epochValidatorFill, MAX_EFFECTIVE_BALANCE)
+	ctx := context.Background()
+	slot, _ := spec.EpochStartSlot(3)
+	if err := common.ProcessSlots(ctx, spec, epc, &beacon.StandardUpgradeableBeaconState{BeaconState: state}, slot-1); err != nil {
+		b.Fatal(err)
+	}
+	// warm up, any pooled buffers are allocated by the first transition
+	{
+		pre, err := phase0.AsBeaconStateView(state.Copy())
+		if err != nil {
+			b.Fatal(err)
+		}
+		if err := common.ProcessSlots(ctx, spec, epc.Clone(), &beacon.StandardUpgradeableBeaconState{BeaconState: pre}, slot); err != nil {
+			b.Fatal(err)
+		}
+	}
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		b.StopTimer()
+		pre, err := phase0.AsBeaconStateView(state.Copy())
+		if err != nil {
+			b.Fatal(err)
+		}
+		preEpc := epc.Clone()
+		b.StartTimer()
+		if err := common.ProcessSlots(ctx, spec, preEpc, &beacon.StandardUpgradeableBeaconState{BeaconState: pre}, slot); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
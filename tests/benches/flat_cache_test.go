@@ -0,0 +1,60 @@
+package benches
+
+import (
+	"testing"
+
+	"github.com/protolambda/zrnt/eth2/beacon/common"
+	"github.com/protolambda/zrnt/eth2/beacon/phase0"
+)
+
+const epochOperationsValidatorFill = 16384
+
+// noFlatsState hides the flat validator snapshot of the wrapped state, to read the state tree instead.
+type noFlatsState struct {
+	common.BeaconState
+}
+
+// The registry reads of the operations of a 32-block epoch, every block with a proposer slashing check
+// and the max voluntary exits. Without the flat validator snapshot, every exit iterates the registry tree for the exit queue.
+func benchEpochOperations(b *testing.B, flatCache bool) {
+	state, epc := CreateTestState(epochOperationsValidatorFill, MAX_EFFECTIVE_BALANCE)
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		b.StopTimer()
+		copied, err := state.CopyState()
+		if err != nil {
+			b.Fatal(err)
+		}
+		pre := copied
+		if !flatCache {
+			pre = noFlatsState{copied}
+		}
+		preEpc := epc.Clone()
+		b.StartTimer()
+		index := common.ValidatorIndex(0)
+		for block := 0; block < 32; block++ {
+			v, err := common.StateFlatValidators(pre).Validator(pre, common.ValidatorIndex(block))
+			if err != nil {
+				b.Fatal(err)
+			}
+			if !v.IsSlashable(preEpc.CurrentEpoch.Epoch) {
+				b.Fatal("expected slashable validator")
+			}
+			for j := uint64(0); j < uint64(spec.MAX_VOLUNTARY_EXITS); j++ {
+				if err := phase0.InitiateValidatorExit(spec, preEpc, pre, index); err != nil {
+					b.Fatal(err)
+				}
+				index++
+			}
+		}
+	}
+}
+
+func BenchmarkEpochOperationsFlatCache(b *testing.B) {
+	benchEpochOperations(b, true)
+}
+
+func BenchmarkEpochOperationsNoFlatCache(b *testing.B) {
+	benchEpochOperations(b, false)
+}
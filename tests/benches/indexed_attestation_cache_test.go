@@ -0,0 +1,60 @@
+package benches
+
+import (
+	"testing"
+
+	"github.com/protolambda/zrnt/eth2/beacon/common"
+	"github.com/protolambda/zrnt/eth2/beacon/phase0"
+)
+
+// The aggregates of a slot with committees of 128 validators, every aggregate converted six times:
+// when validated on gossip for four aggregators that published the same aggregate,
+// and when processed in a block on two sibling branches.
+func benchIndexedAttestations(b *testing.B, cached bool) {
+	state, epc := CreateTestState(16384, MAX_EFFECTIVE_BALANCE)
+	slot, err := state.Slot()
+	if err != nil {
+		b.Fatal(err)
+	}
+	count, err := epc.GetCommitteeCountPerSlot(epc.CurrentEpoch.Epoch)
+	if err != nil {
+		b.Fatal(err)
+	}
+	atts := make([]phase0.Attestation, count)
+	committees := make([][]common.ValidatorIndex, count)
+	for i := range atts {
+		committees[i], err = epc.GetBeaconCommittee(slot, common.CommitteeIndex(i))
+		if err != nil {
+			b.Fatal(err)
+		}
+		atts[i].Data = phase0.AttestationData{Slot: slot, Index: common.CommitteeIndex(i)}
+		atts[i].AggregationBits = phase0.NewAttestationBits(uint64(len(committees[i])))
+		for j := range committees[i] {
+			atts[i].AggregationBits.SetBit(uint64(j), j%7 != 0)
+		}
+	}
+	sibling := epc.Clone()
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if cached {
+			epc.IndexedAttestationCache = common.NewIndexedAttestationCache(64)
+			sibling.IndexedAttestationCache = epc.IndexedAttestationCache
+		}
+		for _, ctx := range []*common.EpochsContext{epc, epc, epc, epc, epc, sibling} {
+			for j := range atts {
+				if _, err := atts[j].ConvertToIndexedWithCache(spec, ctx, committees[j]); err != nil {
+					b.Fatal(err)
+				}
+			}
+		}
+	}
+}
+
+func BenchmarkIndexedAttestationsCached(b *testing.B) {
+	benchIndexedAttestations(b, true)
+}
+
+func BenchmarkIndexedAttestationsUncached(b *testing.B) {
+	benchIndexedAttestations(b, false)
+}
@@ -0,0 +1,89 @@
+package benches
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/protolambda/zrnt/eth2/beacon/bellatrix"
+	"github.com/protolambda/zrnt/eth2/beacon/common"
+	"github.com/protolambda/ztyp/codec"
+)
+
+const (
+	payloadDecodeTxCount = 1000
+	payloadDecodeTxSize  = 300
+)
+
+// copiedTransactions decodes like the transactions list before the shared buffer, as reference:
+// every transaction is read into its own allocation.
+type copiedTransactions []common.Transaction
+
+func (txs *copiedTransactions) Deserialize(spec *common.Spec, dr *codec.DecodingReader) error {
+	return dr.List(func() codec.Deserializable {
+		i := len(*txs)
+		*txs = append(*txs, common.Transaction{})
+		return spec.Wrap(&((*txs)[i]))
+	}, 0, uint64(spec.MAX_TRANSACTIONS_PER_PAYLOAD))
+}
+
+func largePayload(b *testing.B) []byte {
+	payload := &bellatrix.ExecutionPayload{Transactions: make(common.PayloadTransactions, payloadDecodeTxCount)}
+	for i := range payload.Transactions {
+		tx := make(common.Transaction, payloadDecodeTxSize)
+		for j := range tx {
+			tx[j] = byte(i * j)
+		}
+		payload.Transactions[i] = tx
+	}
+	var buf bytes.Buffer
+	if err := payload.Serialize(spec, codec.NewEncodingWriter(&buf)); err != nil {
+		b.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func BenchmarkPayloadDecode(b *testing.B) {
+	data := largePayload(b)
+	b.SetBytes(int64(len(data)))
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		var payload bellatrix.ExecutionPayload
+		if err := payload.Deserialize(spec, codec.NewDecodingReader(bytes.NewReader(data), uint64(len(data)))); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+// The transactions are the last field of the payload, and start at the first offset.
+func payloadTransactionsData(b *testing.B) []byte {
+	data := largePayload(b)
+	var payload bellatrix.ExecutionPayload
+	return data[payload.ByteLength(spec):]
+}
+
+func BenchmarkPayloadTransactionsDecodeShared(b *testing.B) {
+	data := payloadTransactionsData(b)
+	b.SetBytes(int64(len(data)))
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		var txs common.PayloadTransactions
+		if err := txs.Deserialize(spec, codec.NewDecodingReader(bytes.NewReader(data), uint64(len(data)))); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkPayloadTransactionsDecodeCopied(b *testing.B) {
+	data := payloadTransactionsData(b)
+	b.SetBytes(int64(len(data)))
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		var txs copiedTransactions
+		if err := txs.Deserialize(spec, codec.NewDecodingReader(bytes.NewReader(data), uint64(len(data)))); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
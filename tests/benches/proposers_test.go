@@ -0,0 +1,42 @@
+package benches
+
+import (
+	"testing"
+
+	"github.com/protolambda/zrnt/eth2/beacon/common"
+)
+
+const proposersValidatorFill = 16384
+
+func benchProposers(b *testing.B, all bool) {
+	state, epc := CreateTestState(proposersValidatorFill, MAX_EFFECTIVE_BALANCE)
+	slot, err := state.Slot()
+	if err != nil {
+		b.Fatal(err)
+	}
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		props, err := common.ComputeProposers(spec, state, epc.CurrentEpoch.Epoch, epc.CurrentEpoch.ActiveIndices)
+		if err != nil {
+			b.Fatal(err)
+		}
+		if all {
+			_, err = props.ComputeAllProposers()
+		} else {
+			_, err = props.GetBeaconProposer(slot)
+		}
+		if err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+// A validator client that only needs the proposer of a single slot.
+func BenchmarkProposersOneSlot(b *testing.B) {
+	benchProposers(b, false)
+}
+
+func BenchmarkProposersAllSlots(b *testing.B) {
+	benchProposers(b, true)
+}
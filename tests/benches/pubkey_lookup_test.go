@@ -0,0 +1,102 @@
+package benches
+
+import (
+	"encoding/binary"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"github.com/protolambda/zrnt/eth2/beacon/common"
+)
+
+const (
+	pubkeyLookupFill          = 100000
+	pubkeyLookupGoroutines    = 32
+	pubkeyLookupsPerCommittee = 128
+)
+
+// Lookups only, the pubkeys do not have to be valid.
+func fakePubkeys() []common.BLSPubkey {
+	pubs := make([]common.BLSPubkey, pubkeyLookupFill)
+	for i := range pubs {
+		binary.LittleEndian.PutUint64(pubs[i][0:8], uint64(i))
+		binary.LittleEndian.PutUint64(pubs[i][40:48], uint64(i)*0x9e3779b97f4a7c15)
+	}
+	return pubs
+}
+
+// singleLockPubkeyCache is the pubkey cache layout before sharding, as reference: a single lock for all lookups.
+type singleLockPubkeyCache struct {
+	rwLock  sync.RWMutex
+	pub2idx map[common.BLSPubkey]common.ValidatorIndex
+	idx2pub []common.CachedPubkey
+}
+
+func (pc *singleLockPubkeyCache) Pubkey(index common.ValidatorIndex) (*common.CachedPubkey, bool) {
+	pc.rwLock.RLock()
+	defer pc.rwLock.RUnlock()
+	if uint64(index) >= uint64(len(pc.idx2pub)) {
+		return nil, false
+	}
+	return &pc.idx2pub[index], true
+}
+
+func (pc *singleLockPubkeyCache) ValidatorIndex(pub common.BLSPubkey) (common.ValidatorIndex, bool) {
+	pc.rwLock.RLock()
+	defer pc.rwLock.RUnlock()
+	index, ok := pc.pub2idx[pub]
+	return index, ok
+}
+
+type pubkeyLookup interface {
+	Pubkey(index common.ValidatorIndex) (*common.CachedPubkey, bool)
+	ValidatorIndex(pub common.BLSPubkey) (common.ValidatorIndex, bool)
+}
+
+// Every goroutine resolves the pubkeys of a committee, like gossip attestation validation does.
+func benchPubkeyLookups(b *testing.B, pc pubkeyLookup, pubs []common.BLSPubkey) {
+	var worker uint64
+	b.SetParallelism(pubkeyLookupGoroutines)
+	b.ReportAllocs()
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		i := atomic.AddUint64(&worker, 1) * 7919
+		for pb.Next() {
+			for j := 0; j < pubkeyLookupsPerCommittee; j++ {
+				i = (i + 104729) % pubkeyLookupFill
+				if _, ok := pc.Pubkey(common.ValidatorIndex(i)); !ok {
+					b.Fatal("missing pubkey")
+				}
+			}
+			if _, ok := pc.ValidatorIndex(pubs[i]); !ok {
+				b.Fatal("missing index")
+			}
+		}
+	})
+}
+
+func BenchmarkPubkeyLookupsSharded(b *testing.B) {
+	pubs := fakePubkeys()
+	var pc pubkeyLookup
+	{
+		cache := common.EmptyPubkeyCache()
+		for i, pub := range pubs {
+			var err error
+			if cache, err = cache.AddValidator(common.ValidatorIndex(i), pub); err != nil {
+				b.Fatal(err)
+			}
+		}
+		pc = cache
+	}
+	benchPubkeyLookups(b, pc, pubs)
+}
+
+func BenchmarkPubkeyLookupsSingleLock(b *testing.B) {
+	pubs := fakePubkeys()
+	pc := &singleLockPubkeyCache{pub2idx: make(map[common.BLSPubkey]common.ValidatorIndex)}
+	for i, pub := range pubs {
+		pc.pub2idx[pub] = common.ValidatorIndex(i)
+		pc.idx2pub = append(pc.idx2pub, common.CachedPubkey{Compressed: pub})
+	}
+	benchPubkeyLookups(b, pc, pubs)
+}
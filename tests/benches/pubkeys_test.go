@@ -0,0 +1,106 @@
+package benches
+
+import (
+	"context"
+	"encoding/binary"
+	"sync"
+	"testing"
+
+	blsu "github.com/protolambda/bls12-381-util"
+	"github.com/protolambda/zrnt/eth2/beacon/common"
+	"github.com/protolambda/zrnt/eth2/beacon/phase0"
+	"github.com/protolambda/ztyp/tree"
+)
+
+const pubkeyCacheFill = 50000
+
+const pubkeyCommitteeSize = 128
+
+var (
+	benchPubkeysOnce sync.Once
+	benchPubkeys     []common.BLSPubkey
+	benchAtts        []*phase0.IndexedAttestation
+)
+
+// One aggregate attestation per committee, covering all validators, like a full epoch of attestations.
+// Secret key of validator i is i+1, so the aggregate signature can be signed by the sum of the committee keys.
+func loadBenchAttestations(b *testing.B) {
+	benchPubkeysOnce.Do(func() {
+		for _, v := range CreateTestValidators(pubkeyCacheFill+1, MAX_EFFECTIVE_BALANCE)[1:] {
+			benchPubkeys = append(benchPubkeys, v.Pubkey)
+		}
+		for start := uint64(0); start < pubkeyCacheFill; start += pubkeyCommitteeSize {
+			end := start + pubkeyCommitteeSize
+			if end > pubkeyCacheFill {
+				end = pubkeyCacheFill
+			}
+			att := &phase0.IndexedAttestation{Data: phase0.AttestationData{Slot: common.Slot(start)}}
+			var skSum uint64
+			for i := start; i < end; i++ {
+				att.AttestingIndices = append(att.AttestingIndices, common.ValidatorIndex(i))
+				skSum += i + 1
+			}
+			var data [32]byte
+			binary.BigEndian.PutUint64(data[24:], skSum)
+			var sk blsu.SecretKey
+			if err := sk.Deserialize(&data); err != nil {
+				panic(err)
+			}
+			root := common.ComputeSigningRoot(att.Data.HashTreeRoot(tree.GetHashFn()), common.BLSDomain{})
+			att.Signature = blsu.Sign(&sk, root[:]).Serialize()
+			benchAtts = append(benchAtts, att)
+		}
+	})
+}
+
+func newColdPubkeyCache(b *testing.B) *common.PubkeyCache {
+	pc := common.EmptyPubkeyCache()
+	for i, pub := range benchPubkeys {
+		var err error
+		if pc, err = pc.AddValidator(common.ValidatorIndex(i), pub); err != nil {
+			b.Fatal(err)
+		}
+	}
+	return pc
+}
+
+func benchColdStartVerify(b *testing.B, warm bool) {
+	loadBenchAttestations(b)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		b.StopTimer()
+		pc := newColdPubkeyCache(b)
+		if warm {
+			if err := common.WarmPubkeyCache(context.Background(), pc, 0); err != nil {
+				b.Fatal(err)
+			}
+		}
+		b.StartTimer()
+		for _, att := range benchAtts {
+			if err := phase0.ValidateIndexedAttestationSignature(spec, common.BLSDomain{}, pc, att); err != nil {
+				b.Fatal(err)
+			}
+		}
+	}
+}
+
+func BenchmarkColdStartVerifyNoWarming(b *testing.B) {
+	benchColdStartVerify(b, false)
+}
+
+func BenchmarkColdStartVerifyWarmed(b *testing.B) {
+	benchColdStartVerify(b, true)
+}
+
+func BenchmarkWarmPubkeyCache(b *testing.B) {
+	loadBenchAttestations(b)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		b.StopTimer()
+		pc := newColdPubkeyCache(b)
+		b.StartTimer()
+		if err := common.WarmPubkeyCache(context.Background(), pc, 0); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
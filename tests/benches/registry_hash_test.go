@@ -0,0 +1,68 @@
+package benches
+
+import (
+	"bytes"
+	"encoding/binary"
+	"testing"
+
+	"github.com/protolambda/zrnt/eth2/beacon/common"
+	"github.com/protolambda/zrnt/eth2/beacon/phase0"
+	"github.com/protolambda/ztyp/codec"
+	"github.com/protolambda/ztyp/tree"
+)
+
+const registryHashFill = 250000
+
+// registry with fake pubkeys, to avoid the pubkey computation of CreateTestValidators
+func createTestRegistrySSZ(b *testing.B, count uint64) []byte {
+	raw := make(phase0.ValidatorRegistry, 0, count)
+	for i := uint64(0); i < count; i++ {
+		v := &phase0.Validator{
+			EffectiveBalance:           MAX_EFFECTIVE_BALANCE,
+			ActivationEligibilityEpoch: common.GENESIS_EPOCH,
+			ActivationEpoch:            common.GENESIS_EPOCH,
+			ExitEpoch:                  common.FAR_FUTURE_EPOCH,
+			WithdrawableEpoch:          common.FAR_FUTURE_EPOCH,
+		}
+		binary.LittleEndian.PutUint64(v.Pubkey[:], i)
+		binary.LittleEndian.PutUint64(v.WithdrawalCredentials[1:], i)
+		raw = append(raw, v)
+	}
+	var buf bytes.Buffer
+	if err := raw.Serialize(spec, codec.NewEncodingWriter(&buf)); err != nil {
+		b.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func benchRegistryHash(b *testing.B, hash func(registry *phase0.ValidatorsRegistryView) common.Root) {
+	data := createTestRegistrySSZ(b, registryHashFill)
+	typ := phase0.ValidatorsRegistryType(spec)
+	b.ReportAllocs()
+	b.ResetTimer()
+	res := byte(0)
+	for i := 0; i < b.N; i++ {
+		// decode a fresh tree every time, to not re-use any cached roots
+		b.StopTimer()
+		registry, err := phase0.AsValidatorsRegistry(typ.Deserialize(
+			codec.NewDecodingReader(bytes.NewReader(data), uint64(len(data)))))
+		if err != nil {
+			b.Fatal(err)
+		}
+		b.StartTimer()
+		root := hash(registry)
+		res += root[0]
+	}
+}
+
+func BenchmarkRegistryHashSerial(b *testing.B) {
+	benchRegistryHash(b, func(registry *phase0.ValidatorsRegistryView) common.Root {
+		return registry.HashTreeRoot(tree.GetHashFn())
+	})
+}
+
+func BenchmarkRegistryHashParallel(b *testing.B) {
+	benchRegistryHash(b, func(registry *phase0.ValidatorsRegistryView) common.Root {
+		return registry.ParallelHashTreeRoot()
+	})
+}
@@ -0,0 +1,74 @@
+package benches
+
+import (
+	"bytes"
+	"context"
+	"testing"
+
+	"github.com/protolambda/zrnt/eth2/beacon"
+	"github.com/protolambda/zrnt/eth2/beacon/common"
+	"github.com/protolambda/zrnt/eth2/beacon/phase0"
+	"github.com/protolambda/ztyp/codec"
+	"github.com/protolambda/ztyp/tree"
+)
+
+const stateRootValidatorFill = 30000
+
+// ProcessSlots over an empty epoch: only the slot processing, no epoch transition.
+// The hashes of the state root queries after the slot processing are reported separately:
+// the first query re-hashes the path of the slot changed last, the repeated queries are served from the memoized root of the state view.
+func BenchmarkProcessSlotsEmptyEpoch(b *testing.B) {
+	state, epc := CreateTestState(stateRootValidatorFill, MAX_EFFECTIVE_BALANCE)
+	ctx := context.Background()
+	start, _ := spec.EpochStartSlot(1)
+	if err := common.ProcessSlots(ctx, spec, epc, &beacon.StandardUpgradeableBeaconState{BeaconState: state}, start); err != nil {
+		b.Fatal(err)
+	}
+	hashes := 0
+	baseHFn := tree.GetHashFn()
+	hFn := tree.HashFn(func(a tree.Root, b tree.Root) tree.Root {
+		hashes++
+		return baseHFn(a, b)
+	})
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		b.StopTimer()
+		pre, err := phase0.AsBeaconStateView(state.Copy())
+		if err != nil {
+			b.Fatal(err)
+		}
+		preEpc := epc.Clone()
+		b.StartTimer()
+		if err := common.ProcessSlots(ctx, spec, preEpc, &beacon.StandardUpgradeableBeaconState{BeaconState: pre}, start+spec.SLOTS_PER_EPOCH-1); err != nil {
+			b.Fatal(err)
+		}
+		// state root validation and chain bookkeeping query the root again
+		for j := 0; j < 3; j++ {
+			pre.HashTreeRoot(hFn)
+		}
+	}
+	b.ReportMetric(float64(hashes)/float64(b.N), "root-hashes/op")
+}
+
+// A state root query of a state without any cached roots, e.g. just decoded, as reference.
+func BenchmarkStateRootUncached(b *testing.B) {
+	state, _ := CreateTestState(stateRootValidatorFill, MAX_EFFECTIVE_BALANCE)
+	var buf bytes.Buffer
+	if err := state.Serialize(codec.NewEncodingWriter(&buf)); err != nil {
+		b.Fatal(err)
+	}
+	data := buf.Bytes()
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		b.StopTimer()
+		fresh, err := phase0.AsBeaconStateView(phase0.BeaconStateType(spec).Deserialize(
+			codec.NewDecodingReader(bytes.NewReader(data), uint64(len(data)))))
+		if err != nil {
+			b.Fatal(err)
+		}
+		b.StartTimer()
+		fresh.HashTreeRoot(tree.GetHashFn())
+	}
+}
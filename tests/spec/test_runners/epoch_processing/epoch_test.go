@@ -43,40 +43,40 @@ func NewEpochTest(fn stateFn) test_util.TransitionCaseMaker {
 	}
 }
 
-func TestEffectiveBalanceUpdates(t *testing.T) {
-	test_util.RunTransitionTest(t, test_util.AllForks, "epoch_processing", "effective_balance_updates",
+func init() {
+	test_util.RegisterTransition("epoch_processing", "effective_balance_updates", test_util.AllForks,
 		NewEpochTest(func(spec *common.Spec, state common.BeaconState, epc *common.EpochsContext, flats []common.FlatValidator) error {
 			return phase0.ProcessEffectiveBalanceUpdates(context.Background(), spec, epc, flats, state)
 		}))
 }
 
-func TestEth1DataReset(t *testing.T) {
-	test_util.RunTransitionTest(t, test_util.AllForks, "epoch_processing", "eth1_data_reset",
+func init() {
+	test_util.RegisterTransition("epoch_processing", "eth1_data_reset", test_util.AllForks,
 		NewEpochTest(func(spec *common.Spec, state common.BeaconState, epc *common.EpochsContext, flats []common.FlatValidator) error {
 			return phase0.ProcessEth1DataReset(context.Background(), spec, epc, state)
 		}))
 }
 
-func TestHistoricalRootsUpdate(t *testing.T) {
-	test_util.RunTransitionTest(t, []test_util.ForkName{"phase0", "altair", "bellatrix"}, "epoch_processing", "historical_roots_update",
+func init() {
+	test_util.RegisterTransition("epoch_processing", "historical_roots_update", []test_util.ForkName{"phase0", "altair", "bellatrix"},
 		NewEpochTest(func(spec *common.Spec, state common.BeaconState, epc *common.EpochsContext, flats []common.FlatValidator) error {
 			return phase0.ProcessHistoricalRootsUpdate(context.Background(), spec, epc, state)
 		}))
 }
 
-func TestHistoricalSummariesUpdate(t *testing.T) {
-	test_util.RunTransitionTest(t, []test_util.ForkName{"capella"}, "epoch_processing", "historical_summaries_update",
+func init() {
+	test_util.RegisterTransition("epoch_processing", "historical_summaries_update", []test_util.ForkName{"capella"},
 		NewEpochTest(func(spec *common.Spec, state common.BeaconState, epc *common.EpochsContext, flats []common.FlatValidator) error {
 			return capella.ProcessHistoricalSummariesUpdate(context.Background(), spec, epc, state.(capella.HistoricalSummariesBeaconState))
 		}))
 }
 
-func TestJustificationAndFinalization(t *testing.T) {
-	test_util.RunTransitionTest(t, test_util.AllForks, "epoch_processing", "justification_and_finalization",
+func init() {
+	test_util.RegisterTransition("epoch_processing", "justification_and_finalization", test_util.AllForks,
 		NewEpochTest(func(spec *common.Spec, state common.BeaconState, epc *common.EpochsContext, flats []common.FlatValidator) error {
 			var just *phase0.JustificationStakeData
 			if s, ok := state.(phase0.Phase0PendingAttestationsBeaconState); ok {
-				attesterData, err := phase0.ComputeEpochAttesterData(context.Background(), spec, epc, flats, s)
+				attesterData, err := phase0.ComputeEpochAttesterData(context.Background(), spec, epc, nil, flats, s)
 				if err != nil {
 					return err
 				}
@@ -87,7 +87,7 @@ func TestJustificationAndFinalization(t *testing.T) {
 					CurrEpochUnslashedTargetStake: attesterData.CurrEpochUnslashedTargetStake,
 				}
 			} else if s, ok := state.(altair.AltairLikeBeaconState); ok {
-				attesterData, err := altair.ComputeEpochAttesterData(context.Background(), spec, epc, flats, s)
+				attesterData, err := altair.ComputeEpochAttesterData(context.Background(), spec, epc, nil, flats, s)
 				if err != nil {
 					return err
 				}
@@ -104,8 +104,8 @@ func TestJustificationAndFinalization(t *testing.T) {
 		}))
 }
 
-func TestParticipationRecordUpdates(t *testing.T) {
-	test_util.RunTransitionTest(t, []test_util.ForkName{"phase0"}, "epoch_processing", "participation_record_updates",
+func init() {
+	test_util.RegisterTransition("epoch_processing", "participation_record_updates", []test_util.ForkName{"phase0"},
 		NewEpochTest(func(spec *common.Spec, state common.BeaconState, epc *common.EpochsContext, flats []common.FlatValidator) error {
 			if s, ok := state.(phase0.Phase0PendingAttestationsBeaconState); ok {
 				return phase0.ProcessParticipationRecordUpdates(context.Background(), spec, epc, s)
@@ -115,8 +115,8 @@ func TestParticipationRecordUpdates(t *testing.T) {
 		}))
 }
 
-func TestParticipationFlagUpdates(t *testing.T) {
-	test_util.RunTransitionTest(t, []test_util.ForkName{"altair", "bellatrix", "capella", "deneb"}, "epoch_processing", "participation_flag_updates",
+func init() {
+	test_util.RegisterTransition("epoch_processing", "participation_flag_updates", []test_util.ForkName{"altair", "bellatrix", "capella", "deneb"},
 		NewEpochTest(func(spec *common.Spec, state common.BeaconState, epc *common.EpochsContext, flats []common.FlatValidator) error {
 			if s, ok := state.(altair.AltairLikeBeaconState); ok {
 				return altair.ProcessParticipationFlagUpdates(context.Background(), spec, s)
@@ -126,57 +126,57 @@ func TestParticipationFlagUpdates(t *testing.T) {
 		}))
 }
 
-func TestRandaoMixesReset(t *testing.T) {
-	test_util.RunTransitionTest(t, test_util.AllForks, "epoch_processing", "randao_mixes_reset",
+func init() {
+	test_util.RegisterTransition("epoch_processing", "randao_mixes_reset", test_util.AllForks,
 		NewEpochTest(func(spec *common.Spec, state common.BeaconState, epc *common.EpochsContext, flats []common.FlatValidator) error {
 			return phase0.ProcessRandaoMixesReset(context.Background(), spec, epc, state)
 		}))
 }
 
-func TestRegistryUpdates(t *testing.T) {
-	test_util.RunTransitionTest(t, test_util.AllForks, "epoch_processing", "registry_updates",
+func init() {
+	test_util.RegisterTransition("epoch_processing", "registry_updates", test_util.AllForks,
 		NewEpochTest(func(spec *common.Spec, state common.BeaconState, epc *common.EpochsContext, flats []common.FlatValidator) error {
 			return phase0.ProcessEpochRegistryUpdates(context.Background(), spec, epc, flats, state)
 		}))
 }
 
-func TestRewardsPenalties(t *testing.T) {
-	test_util.RunTransitionTest(t, test_util.AllForks, "epoch_processing", "rewards_and_penalties",
+func init() {
+	test_util.RegisterTransition("epoch_processing", "rewards_and_penalties", test_util.AllForks,
 		NewEpochTest(func(spec *common.Spec, state common.BeaconState, epc *common.EpochsContext, flats []common.FlatValidator) error {
 			if s, ok := state.(phase0.Phase0PendingAttestationsBeaconState); ok {
-				attesterData, err := phase0.ComputeEpochAttesterData(context.Background(), spec, epc, flats, s)
+				attesterData, err := phase0.ComputeEpochAttesterData(context.Background(), spec, epc, nil, flats, s)
 				if err != nil {
 					return err
 				}
-				return phase0.ProcessEpochRewardsAndPenalties(context.Background(), spec, epc, attesterData, s)
+				return phase0.ProcessEpochRewardsAndPenalties(context.Background(), spec, epc, nil, attesterData, s)
 			} else if s, ok := state.(altair.AltairLikeBeaconState); ok {
-				attesterData, err := altair.ComputeEpochAttesterData(context.Background(), spec, epc, flats, s)
+				attesterData, err := altair.ComputeEpochAttesterData(context.Background(), spec, epc, nil, flats, s)
 				if err != nil {
 					return err
 				}
-				return altair.ProcessEpochRewardsAndPenalties(context.Background(), spec, epc, attesterData, s)
+				return altair.ProcessEpochRewardsAndPenalties(context.Background(), spec, epc, nil, attesterData, s)
 			} else {
 				return fmt.Errorf("unrecognized state type: %T", state)
 			}
 		}))
 }
 
-func TestSlashings(t *testing.T) {
-	test_util.RunTransitionTest(t, test_util.AllForks, "epoch_processing", "slashings",
+func init() {
+	test_util.RegisterTransition("epoch_processing", "slashings", test_util.AllForks,
 		NewEpochTest(func(spec *common.Spec, state common.BeaconState, epc *common.EpochsContext, flats []common.FlatValidator) error {
-			return phase0.ProcessEpochSlashings(context.Background(), spec, epc, flats, state)
+			return phase0.ProcessEpochSlashings(context.Background(), spec, epc, nil, flats, state)
 		}))
 }
 
-func TestSlashingsReset(t *testing.T) {
-	test_util.RunTransitionTest(t, test_util.AllForks, "epoch_processing", "slashings_reset",
+func init() {
+	test_util.RegisterTransition("epoch_processing", "slashings_reset", test_util.AllForks,
 		NewEpochTest(func(spec *common.Spec, state common.BeaconState, epc *common.EpochsContext, flats []common.FlatValidator) error {
 			return phase0.ProcessSlashingsReset(context.Background(), spec, epc, state)
 		}))
 }
 
-func TestSyncCommitteeUpdates(t *testing.T) {
-	test_util.RunTransitionTest(t, []test_util.ForkName{"altair", "bellatrix", "capella", "deneb"}, "epoch_processing", "sync_committee_updates",
+func init() {
+	test_util.RegisterTransition("epoch_processing", "sync_committee_updates", []test_util.ForkName{"altair", "bellatrix", "capella", "deneb"},
 		NewEpochTest(func(spec *common.Spec, state common.BeaconState, epc *common.EpochsContext, flats []common.FlatValidator) error {
 			if s, ok := state.(common.SyncCommitteeBeaconState); ok {
 				return altair.ProcessSyncCommitteeUpdates(context.Background(), spec, epc, s)
@@ -185,3 +185,7 @@ func TestSyncCommitteeUpdates(t *testing.T) {
 			}
 		}))
 }
+
+func TestEpochProcessing(t *testing.T) {
+	test_util.RunRegistered(t, "epoch_processing")
+}
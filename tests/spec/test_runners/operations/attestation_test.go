@@ -34,7 +34,7 @@ func (c *AttestationTestCase) Run() error {
 	}
 }
 
-func TestAttestation(t *testing.T) {
-	test_util.RunTransitionTest(t, test_util.AllForks, "operations", "attestation",
+func init() {
+	test_util.RegisterTransition("operations", "attestation", test_util.AllForks,
 		func() test_util.TransitionTest { return new(AttestationTestCase) })
 }
@@ -23,10 +23,10 @@ func (c *AttesterSlashingTestCase) Run() error {
 	if err != nil {
 		return err
 	}
-	return phase0.ProcessAttesterSlashing(c.Spec, epc, c.Pre, &c.AttesterSlashing)
+	return phase0.ProcessAttesterSlashing(c.Spec, epc, nil, c.Pre, &c.AttesterSlashing)
 }
 
-func TestAttesterSlashing(t *testing.T) {
-	test_util.RunTransitionTest(t, test_util.AllForks, "operations", "attester_slashing",
+func init() {
+	test_util.RegisterTransition("operations", "attester_slashing", test_util.AllForks,
 		func() test_util.TransitionTest { return new(AttesterSlashingTestCase) })
 }
@@ -59,7 +59,7 @@ func (c *BlockHeaderTestCase) Run() error {
 	return common.ProcessHeader(context.Background(), c.Spec, c.Pre, c.Header, proposer)
 }
 
-func TestBlockHeader(t *testing.T) {
-	test_util.RunTransitionTest(t, test_util.AllForks, "operations", "block_header",
+func init() {
+	test_util.RegisterTransition("operations", "block_header", test_util.AllForks,
 		func() test_util.TransitionTest { return new(BlockHeaderTestCase) })
 }
@@ -25,10 +25,10 @@ func (c *BlsToExecutionChangeTestCase) Run() error {
 	if err != nil {
 		return err
 	}
-	return capella.ProcessBLSToExecutionChange(context.Background(), c.Spec, epc, c.Pre, &c.BlsToExecutionChange)
+	return capella.ProcessBLSToExecutionChange(context.Background(), c.Spec, epc, nil, c.Pre, &c.BlsToExecutionChange)
 }
 
-func TestBlsToExecutionChange(t *testing.T) {
-	test_util.RunTransitionTest(t, []test_util.ForkName{"capella", "deneb"}, "operations", "bls_to_execution_change",
+func init() {
+	test_util.RegisterTransition("operations", "bls_to_execution_change", []test_util.ForkName{"capella", "deneb"},
 		func() test_util.TransitionTest { return new(BlsToExecutionChangeTestCase) })
 }
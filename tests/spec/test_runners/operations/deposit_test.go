@@ -23,10 +23,10 @@ func (c *DepositTestCase) Run() error {
 	if err != nil {
 		return err
 	}
-	return phase0.ProcessDeposit(c.Spec, epc, c.Pre, &c.Deposit, false)
+	return phase0.ProcessDeposit(c.Spec, epc, nil, c.Pre, &c.Deposit, false)
 }
 
-func TestDeposit(t *testing.T) {
-	test_util.RunTransitionTest(t, test_util.AllForks, "operations", "deposit",
+func init() {
+	test_util.RegisterTransition("operations", "deposit", test_util.AllForks,
 		func() test_util.TransitionTest { return new(DepositTestCase) })
 }
@@ -60,7 +60,7 @@ func (c *ExecutionPayloadTestCase) Run() error {
 	}
 }
 
-func TestExecutionPayload(t *testing.T) {
-	test_util.RunTransitionTest(t, []test_util.ForkName{"bellatrix", "capella", "deneb"}, "operations", "execution_payload",
+func init() {
+	test_util.RegisterTransition("operations", "execution_payload", []test_util.ForkName{"bellatrix", "capella", "deneb"},
 		func() test_util.TransitionTest { return new(ExecutionPayloadTestCase) })
 }
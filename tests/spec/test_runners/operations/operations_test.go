@@ -0,0 +1,11 @@
+package operations
+
+import (
+	"testing"
+
+	"github.com/protolambda/zrnt/tests/spec/test_util"
+)
+
+func TestOperations(t *testing.T) {
+	test_util.RunRegistered(t, "operations")
+}
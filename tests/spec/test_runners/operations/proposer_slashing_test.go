@@ -23,10 +23,10 @@ func (c *ProposerSlashingTestCase) Run() error {
 	if err != nil {
 		return err
 	}
-	return phase0.ProcessProposerSlashing(c.Spec, epc, c.Pre, &c.ProposerSlashing)
+	return phase0.ProcessProposerSlashing(c.Spec, epc, nil, c.Pre, &c.ProposerSlashing)
 }
 
-func TestProposerSlashing(t *testing.T) {
-	test_util.RunTransitionTest(t, test_util.AllForks, "operations", "proposer_slashing",
+func init() {
+	test_util.RegisterTransition("operations", "proposer_slashing", test_util.AllForks,
 		func() test_util.TransitionTest { return new(ProposerSlashingTestCase) })
 }
@@ -29,10 +29,10 @@ func (c *SyncAggregateTestCase) Run() error {
 	if !ok {
 		return fmt.Errorf("unrecognized state type: %T", c.Pre)
 	}
-	return altair.ProcessSyncAggregate(context.Background(), c.Spec, epc, s, &c.SyncAggregate)
+	return altair.ProcessSyncAggregate(context.Background(), c.Spec, epc, nil, s, &c.SyncAggregate)
 }
 
-func TestSyncAggregate(t *testing.T) {
-	test_util.RunTransitionTest(t, []test_util.ForkName{"altair", "bellatrix", "capella", "deneb"}, "operations", "sync_aggregate",
+func init() {
+	test_util.RegisterTransition("operations", "sync_aggregate", []test_util.ForkName{"altair", "bellatrix", "capella", "deneb"},
 		func() test_util.TransitionTest { return new(SyncAggregateTestCase) })
 }
@@ -23,10 +23,10 @@ func (c *VoluntaryExitTestCase) Run() error {
 	if err != nil {
 		return err
 	}
-	return phase0.ProcessVoluntaryExit(c.Spec, epc, c.Pre, &c.VoluntaryExit)
+	return phase0.ProcessVoluntaryExit(c.Spec, epc, nil, c.Pre, &c.VoluntaryExit)
 }
 
-func TestVoluntaryExit(t *testing.T) {
-	test_util.RunTransitionTest(t, test_util.AllForks, "operations", "voluntary_exit",
+func init() {
+	test_util.RegisterTransition("operations", "voluntary_exit", test_util.AllForks,
 		func() test_util.TransitionTest { return new(VoluntaryExitTestCase) })
 }
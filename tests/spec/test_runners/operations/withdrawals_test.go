@@ -40,7 +40,7 @@ func (c *WithdrawalsTestCase) Run() error {
 	return capella.ProcessWithdrawals(context.Background(), c.Spec, s, c.ExecutionPayload)
 }
 
-func TestWithdrawals(t *testing.T) {
-	test_util.RunTransitionTest(t, []test_util.ForkName{"capella", "deneb"}, "operations", "withdrawals",
+func init() {
+	test_util.RegisterTransition("operations", "withdrawals", []test_util.ForkName{"capella", "deneb"},
 		func() test_util.TransitionTest { return new(WithdrawalsTestCase) })
 }
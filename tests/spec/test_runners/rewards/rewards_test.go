@@ -124,11 +124,11 @@ func (c *RewardsTest) Run() error {
 	}
 
 	if s, ok := c.Pre.(phase0.Phase0PendingAttestationsBeaconState); ok {
-		attesterData, err := phase0.ComputeEpochAttesterData(context.Background(), c.Spec, epc, flats, s)
+		attesterData, err := phase0.ComputeEpochAttesterData(context.Background(), c.Spec, epc, nil, flats, s)
 		if err != nil {
 			return err
 		}
-		deltas, err := phase0.AttestationRewardsAndPenalties(context.Background(), c.Spec, epc, attesterData, s)
+		deltas, err := phase0.AttestationRewardsAndPenalties(context.Background(), c.Spec, epc, nil, attesterData, s)
 		if err != nil {
 			return err
 		}
@@ -138,11 +138,11 @@ func (c *RewardsTest) Run() error {
 		c.Output.InclusionDelay = deltas.InclusionDelay
 		c.Output.Inactivity = deltas.Inactivity
 	} else if s, ok := c.Pre.(altair.AltairLikeBeaconState); ok {
-		attesterData, err := altair.ComputeEpochAttesterData(context.Background(), c.Spec, epc, flats, s)
+		attesterData, err := altair.ComputeEpochAttesterData(context.Background(), c.Spec, epc, nil, flats, s)
 		if err != nil {
 			return err
 		}
-		deltas, err := altair.AttestationRewardsAndPenalties(context.Background(), c.Spec, epc, attesterData, s)
+		deltas, err := altair.AttestationRewardsAndPenalties(context.Background(), c.Spec, epc, nil, attesterData, s)
 		if err != nil {
 			return err
 		}
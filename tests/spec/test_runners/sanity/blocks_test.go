@@ -1,12 +1,10 @@
 package sanity
 
 import (
-	"testing"
-
 	"github.com/protolambda/zrnt/tests/spec/test_util"
 )
 
-func TestBlocks(t *testing.T) {
-	test_util.RunTransitionTest(t, test_util.AllForks, "sanity", "blocks",
+func init() {
+	test_util.RegisterTransition("sanity", "blocks", test_util.AllForks,
 		func() test_util.TransitionTest { return new(test_util.BlocksTestCase) })
 }
@@ -0,0 +1,11 @@
+package sanity
+
+import (
+	"testing"
+
+	"github.com/protolambda/zrnt/tests/spec/test_util"
+)
+
+func TestSanity(t *testing.T) {
+	test_util.RunRegistered(t, "sanity")
+}
@@ -42,7 +42,7 @@ func (c *SlotsTestCase) Run() error {
 	return common.ProcessSlots(context.Background(), c.Spec, epc, &nonUpgradeable{c.Pre}, slot+c.Slots)
 }
 
-func TestSlots(t *testing.T) {
-	test_util.RunTransitionTest(t, test_util.AllForks, "sanity", "slots",
+func init() {
+	test_util.RegisterTransition("sanity", "slots", test_util.AllForks,
 		func() test_util.TransitionTest { return new(SlotsTestCase) })
 }
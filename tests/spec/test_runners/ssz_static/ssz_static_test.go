@@ -11,13 +11,11 @@ import (
 	"github.com/golang/snappy"
 	"github.com/protolambda/ztyp/codec"
 	"github.com/protolambda/ztyp/tree"
-	"gopkg.in/yaml.v3"
 
 	"github.com/protolambda/zrnt/eth2/beacon/altair"
 	"github.com/protolambda/zrnt/eth2/beacon/bellatrix"
 	"github.com/protolambda/zrnt/eth2/beacon/common"
 	"github.com/protolambda/zrnt/eth2/beacon/phase0"
-	"github.com/protolambda/zrnt/eth2/configs"
 	"github.com/protolambda/zrnt/tests/spec/test_util"
 )
 
@@ -172,73 +170,57 @@ func init() {
 	objs["capella"]["Withdrawal"] = func() interface{} { return new(common.Withdrawal) }
 	objs["capella"]["BLSToExecutionChange"] = func() interface{} { return new(common.BLSToExecutionChange) }
 	objs["capella"]["SignedBLSToExecutionChange"] = func() interface{} { return new(common.SignedBLSToExecutionChange) }
+
+	for fork, objByName := range objs {
+		for k, v := range objByName {
+			test_util.Register("ssz_static", k, []test_util.ForkName{fork}, runSSZStaticTest(k, v))
+		}
+	}
 }
 
 type RootsYAML struct {
 	Root string `yaml:"root"`
 }
 
-func runSSZStaticTest(fork test_util.ForkName, name string, alloc ObjAllocator, spec *common.Spec) func(t *testing.T) {
-	return func(t *testing.T) {
-		test_util.RunHandler(t, "ssz_static/"+name, func(t *testing.T, forkName test_util.ForkName, readPart test_util.TestPartReader) {
-			c := &SSZStaticTestCase{
-				Spec:     readPart.Spec(),
-				TypeName: name,
-			}
+func runSSZStaticTest(name string, alloc ObjAllocator) test_util.CaseRunner {
+	return func(t *testing.T, forkName test_util.ForkName, readPart test_util.TestPartReader) {
+		c := &SSZStaticTestCase{
+			Spec:     readPart.Spec(),
+			TypeName: name,
+		}
 
-			// Allocate an empty value to decode into later for testing.
-			c.Value = alloc()
+		// Allocate an empty value to decode into later for testing.
+		c.Value = alloc()
 
-			// Load the SSZ encoded data as a bytes array. The test will serialize it both ways.
-			{
-				p := readPart.Part("serialized.ssz_snappy")
-				data, err := ioutil.ReadAll(p)
-				test_util.Check(t, err)
-				uncompressed, err := snappy.Decode(nil, data)
-				test_util.Check(t, err)
-				test_util.Check(t, p.Close())
-				test_util.Check(t, err)
-				c.Serialized = uncompressed
-			}
+		// Load the SSZ encoded data as a bytes array. The test will serialize it both ways.
+		{
+			p := readPart.Part("serialized.ssz_snappy")
+			data, err := ioutil.ReadAll(p)
+			test_util.Check(t, err)
+			uncompressed, err := snappy.Decode(nil, data)
+			test_util.Check(t, err)
+			test_util.Check(t, p.Close())
+			test_util.Check(t, err)
+			c.Serialized = uncompressed
+		}
 
+		{
+			roots := &RootsYAML{}
+			if !test_util.LoadYAML(t, "roots", roots, readPart) {
+				t.Fatal("missing roots")
+			}
 			{
-				p := readPart.Part("roots.yaml")
-				dec := yaml.NewDecoder(p)
-				roots := &RootsYAML{}
-				test_util.Check(t, dec.Decode(roots))
-				test_util.Check(t, p.Close())
-				{
-					root, err := hex.DecodeString(roots.Root[2:])
-					test_util.Check(t, err)
-					copy(c.Root[:], root)
-				}
+				root, err := hex.DecodeString(roots.Root[2:])
+				test_util.Check(t, err)
+				copy(c.Root[:], root)
 			}
+		}
 
-			// Run the test case
-			c.Run(t)
-
-		}, spec, fork)
+		// Run the test case
+		c.Run(t)
 	}
 }
 
 func TestSSZStatic(t *testing.T) {
-	t.Parallel()
-	t.Run("minimal", func(t *testing.T) {
-		for fork, objByName := range objs {
-			t.Run(string(fork), func(t *testing.T) {
-				for k, v := range objByName {
-					t.Run(k, runSSZStaticTest(fork, k, v, configs.Minimal))
-				}
-			})
-		}
-	})
-	t.Run("mainnet", func(t *testing.T) {
-		for fork, objByName := range objs {
-			t.Run(string(fork), func(t *testing.T) {
-				for k, v := range objByName {
-					t.Run(k, runSSZStaticTest(fork, k, v, configs.Mainnet))
-				}
-			})
-		}
-	})
+	test_util.RunRegistered(t, "ssz_static")
 }
@@ -0,0 +1,106 @@
+package test_util
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"testing"
+
+	"github.com/protolambda/zrnt/eth2/beacon/common"
+	"github.com/protolambda/zrnt/eth2/configs"
+)
+
+// TestVectorsEnv is the environment variable with the path to the consensus spec test vectors:
+// the directory with the "tests" directory in it. Defaults to tests/spec/eth2.0-spec-tests.
+const TestVectorsEnv = "ZRNT_SPEC_TESTS"
+
+func TestVectorsRoot() string {
+	if p := os.Getenv(TestVectorsEnv); p != "" {
+		return p
+	}
+	_, filename, _, _ := runtime.Caller(0)
+	return filepath.Join(filepath.Dir(filepath.Dir(filename)), "eth2.0-spec-tests")
+}
+
+// Presets are the presets to run the tests of, the test vectors are organized by preset name.
+var Presets = []*common.Spec{configs.Minimal, configs.Mainnet}
+
+// runner name -> handler name -> fork -> case runner
+var registry = make(map[string]map[string]map[ForkName]CaseRunner)
+
+// Register adds the handler of a test runner, to run the test cases of the given forks with.
+// Handlers are registered on init, and run with RunRegistered.
+func Register(runner string, handler string, forks []ForkName, caseRunner CaseRunner) {
+	handlers, ok := registry[runner]
+	if !ok {
+		handlers = make(map[string]map[ForkName]CaseRunner)
+		registry[runner] = handlers
+	}
+	byFork, ok := handlers[handler]
+	if !ok {
+		byFork = make(map[ForkName]CaseRunner)
+		handlers[handler] = byFork
+	}
+	for _, fork := range forks {
+		if _, ok := byFork[fork]; ok {
+			panic(fmt.Sprintf("handler %s/%s is already registered for fork %s", runner, handler, fork))
+		}
+		byFork[fork] = caseRunner
+	}
+}
+
+// RegisterTransition registers a handler of state transition tests.
+func RegisterTransition(runner string, handler string, forks []ForkName, mkr TransitionCaseMaker) {
+	Register(runner, handler, forks, transitionCaseRunner(runner, handler, mkr))
+}
+
+// RunRegistered runs the registered handlers of the runner, for every preset and fork.
+// Handlers that are in the test vectors, but not registered for the fork, are skipped.
+func RunRegistered(t *testing.T, runner string) {
+	handlers := registry[runner]
+	if len(handlers) == 0 {
+		t.Fatalf("no handlers registered for runner %s", runner)
+	}
+	for _, base := range Presets {
+		spec := *base
+		spec.ExecutionEngine = &NoOpExecutionEngine{}
+		t.Run(spec.PRESET_BASE, func(t *testing.T) {
+			for _, fork := range AllForks {
+				t.Run(string(fork), func(t *testing.T) {
+					runnerPath := filepath.Join(TestVectorsRoot(), "tests", spec.PRESET_BASE, string(fork), runner)
+					names := make(map[string]struct{})
+					for name, byFork := range handlers {
+						if _, ok := byFork[fork]; ok {
+							names[name] = struct{}{}
+						}
+					}
+					// discover the handlers of the test vectors
+					if items, err := ioutil.ReadDir(runnerPath); err == nil {
+						for _, item := range items {
+							if item.IsDir() {
+								names[item.Name()] = struct{}{}
+							}
+						}
+					}
+					sorted := make([]string, 0, len(names))
+					for name := range names {
+						sorted = append(sorted, name)
+					}
+					sort.Strings(sorted)
+					for _, name := range sorted {
+						t.Run(name, func(t *testing.T) {
+							caseRunner, ok := handlers[name][fork]
+							if !ok {
+								t.Skipf("no handler registered for %s/%s in fork %s", runner, name, fork)
+							}
+							runHandlerCases(t, filepath.Join(runnerPath, name), caseRunner, &spec, fork)
+						})
+					}
+				})
+			}
+		})
+	}
+}
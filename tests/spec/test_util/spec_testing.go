@@ -6,15 +6,21 @@ import (
 	"io/ioutil"
 	"os"
 	"path/filepath"
-	"runtime"
 	"testing"
 
 	"github.com/golang/snappy"
 	"github.com/protolambda/ztyp/codec"
+	"gopkg.in/yaml.v3"
 
 	"github.com/protolambda/zrnt/eth2/beacon/common"
+	"github.com/protolambda/zrnt/eth2/beacon/phase0"
 )
 
+func init() {
+	// the spec tests verify the participation tallies against the full recomputation
+	phase0.CheckParticipationTallies = true
+}
+
 type TestPart interface {
 	io.Reader
 	io.Closer
@@ -67,12 +73,15 @@ func (s *partAndSpec) Spec() *common.Spec {
 }
 
 func RunHandler(t *testing.T, handlerPath string, caseRunner CaseRunner, spec *common.Spec, fork ForkName) {
-	// get the current path, go to the root, and get the tests path
-	_, filename, _, _ := runtime.Caller(0)
-	basepath := filepath.Dir(filepath.Dir(filename))
-	handlerAbsPath := filepath.Join(basepath, "eth2.0-spec-tests", "tests",
+	handlerAbsPath := filepath.Join(TestVectorsRoot(), "tests",
 		spec.PRESET_BASE, string(fork), filepath.FromSlash(handlerPath))
+	t.Run(handlerPath, func(t *testing.T) {
+		runHandlerCases(t, handlerAbsPath, caseRunner, spec, fork)
+	})
+}
 
+// runHandlerCases runs every test case of every suite in the handler directory.
+func runHandlerCases(t *testing.T, handlerAbsPath string, caseRunner CaseRunner, spec *common.Spec, fork ForkName) {
 	forEachDir := func(t *testing.T, path string, callItem func(t *testing.T, path string)) {
 		if _, err := os.Stat(path); os.IsNotExist(err) {
 			t.Skipf("missing tests: %s", path)
@@ -105,14 +114,9 @@ func RunHandler(t *testing.T, handlerPath string, caseRunner CaseRunner, spec *c
 		caseRunner(t, fork, &partAndSpec{readPart: partReader, spec: spec})
 	}
 
-	runSuite := func(t *testing.T, path string) {
+	forEachDir(t, handlerAbsPath, func(t *testing.T, path string) {
 		//t.Parallel()
 		forEachDir(t, path, runTest)
-	}
-
-	t.Run(handlerPath, func(t *testing.T) {
-		//t.Parallel()
-		forEachDir(t, handlerAbsPath, runSuite)
 	})
 }
 
@@ -133,6 +137,19 @@ func LoadSpecObj(t *testing.T, name string, dst common.SpecObj, readPart TestPar
 	}
 }
 
+// LoadYAML decodes the YAML part into dst, and returns false if the part does not exist.
+func LoadYAML(t *testing.T, name string, dst interface{}, readPart TestPartReader) bool {
+	t.Helper()
+	p := readPart.Part(name + ".yaml")
+	if !p.Exists() {
+		return false
+	}
+	dec := yaml.NewDecoder(p)
+	Check(t, dec.Decode(dst))
+	Check(t, p.Close())
+	return true
+}
+
 func LoadSSZ(t *testing.T, name string, dst codec.Deserializable, readPart TestPartReader) bool {
 	t.Helper()
 	p := readPart.Part(name + ".ssz_snappy")
@@ -11,7 +11,6 @@ import (
 	"github.com/protolambda/messagediff"
 	"github.com/protolambda/ztyp/codec"
 	"github.com/protolambda/ztyp/tree"
-	"gopkg.in/yaml.v3"
 
 	"github.com/protolambda/zrnt/eth2/beacon"
 	"github.com/protolambda/zrnt/eth2/beacon/altair"
@@ -20,7 +19,6 @@ import (
 	"github.com/protolambda/zrnt/eth2/beacon/common"
 	"github.com/protolambda/zrnt/eth2/beacon/deneb"
 	"github.com/protolambda/zrnt/eth2/beacon/phase0"
-	"github.com/protolambda/zrnt/eth2/configs"
 )
 
 // Fork where the test is organized, and thus the state/block/etc. types default to.
@@ -111,52 +109,45 @@ type BlocksCountMeta struct {
 
 func (c *BlocksTestCase) Load(t *testing.T, forkName ForkName, readPart TestPartReader) {
 	c.BaseTransitionTest.Load(t, forkName, readPart)
-	p := readPart.Part("meta.yaml")
-	dec := yaml.NewDecoder(p)
 	m := &BlocksCountMeta{}
-	Check(t, dec.Decode(&m))
-	Check(t, p.Close())
+	if !LoadYAML(t, "meta", m, readPart) {
+		t.Fatal("missing meta")
+	}
 	valRoot, err := c.Pre.GenesisValidatorsRoot()
 	if err != nil {
 		t.Fatalf("failed to get pre-state genesis validators root: %v", err)
 	}
-	loadBlock := func(i uint64) *common.BeaconBlockEnvelope {
-		switch forkName {
-		case "phase0":
-			dst := new(phase0.SignedBeaconBlock)
-			LoadSpecObj(t, fmt.Sprintf("blocks_%d", i), dst, readPart)
-			digest := common.ComputeForkDigest(c.Spec.GENESIS_FORK_VERSION, valRoot)
-			return dst.Envelope(c.Spec, digest)
-		case "altair":
-			dst := new(altair.SignedBeaconBlock)
-			LoadSpecObj(t, fmt.Sprintf("blocks_%d", i), dst, readPart)
-			digest := common.ComputeForkDigest(c.Spec.ALTAIR_FORK_VERSION, valRoot)
-			return dst.Envelope(c.Spec, digest)
-		case "bellatrix":
-			dst := new(bellatrix.SignedBeaconBlock)
-			LoadSpecObj(t, fmt.Sprintf("blocks_%d", i), dst, readPart)
-			digest := common.ComputeForkDigest(c.Spec.BELLATRIX_FORK_VERSION, valRoot)
-			return dst.Envelope(c.Spec, digest)
-		case "capella":
-			dst := new(capella.SignedBeaconBlock)
-			LoadSpecObj(t, fmt.Sprintf("blocks_%d", i), dst, readPart)
-			digest := common.ComputeForkDigest(c.Spec.CAPELLA_FORK_VERSION, valRoot)
-			return dst.Envelope(c.Spec, digest)
-		case "deneb":
-			dst := new(deneb.SignedBeaconBlock)
-			LoadSpecObj(t, fmt.Sprintf("blocks_%d", i), dst, readPart)
-			digest := common.ComputeForkDigest(c.Spec.DENEB_FORK_VERSION, valRoot)
-			return dst.Envelope(c.Spec, digest)
-		default:
-			t.Fatalf("unrecognized fork name: %s", forkName)
-			return nil
-		}
-	}
 	for i := uint64(0); i < m.BlocksCount; i++ {
-		c.Blocks = append(c.Blocks, loadBlock(i))
+		c.Blocks = append(c.Blocks, LoadBlock(t, c.Spec, forkName, fmt.Sprintf("blocks_%d", i), valRoot, readPart))
 	}
 }
 
+// LoadBlock loads the signed block of the fork, and wraps it in an envelope with the fork digest.
+func LoadBlock(t *testing.T, spec *common.Spec, fork ForkName, name string, genesisValRoot common.Root, readPart TestPartReader) *common.BeaconBlockEnvelope {
+	t.Helper()
+	var block beacon.OpaqueBlock
+	var version common.Version
+	switch fork {
+	case "phase0":
+		block, version = new(phase0.SignedBeaconBlock), spec.GENESIS_FORK_VERSION
+	case "altair":
+		block, version = new(altair.SignedBeaconBlock), spec.ALTAIR_FORK_VERSION
+	case "bellatrix":
+		block, version = new(bellatrix.SignedBeaconBlock), spec.BELLATRIX_FORK_VERSION
+	case "capella":
+		block, version = new(capella.SignedBeaconBlock), spec.CAPELLA_FORK_VERSION
+	case "deneb":
+		block, version = new(deneb.SignedBeaconBlock), spec.DENEB_FORK_VERSION
+	default:
+		t.Fatalf("unrecognized fork name: %s", fork)
+		return nil
+	}
+	if !LoadSpecObj(t, name, block, readPart) {
+		t.Fatalf("missing block %s", name)
+	}
+	return block.Envelope(spec, common.ComputeForkDigest(version, genesisValRoot))
+}
+
 func (c *BlocksTestCase) Run() error {
 	epc, err := common.NewEpochsContext(c.Spec, c.Pre)
 	if err != nil {
@@ -221,8 +212,8 @@ type TransitionTest interface {
 
 type TransitionCaseMaker func() TransitionTest
 
-func RunTransitionTest(t *testing.T, forks []ForkName, runnerName string, handlerName string, mkr TransitionCaseMaker) {
-	caseRunner := HandleBLS(func(t *testing.T, forkName ForkName, readPart TestPartReader) {
+func transitionCaseRunner(runnerName string, handlerName string, mkr TransitionCaseMaker) CaseRunner {
+	return HandleBLS(func(t *testing.T, forkName ForkName, readPart TestPartReader) {
 		c := mkr()
 		c.Load(t, forkName, readPart)
 		if err := c.Run(); err != nil {
@@ -233,24 +224,21 @@ func RunTransitionTest(t *testing.T, forks []ForkName, runnerName string, handle
 		}
 		c.Check(t)
 	})
-	t.Run("minimal", func(t *testing.T) {
-		spec := *configs.Minimal
-		spec.ExecutionEngine = &NoOpExecutionEngine{}
-		for _, fork := range forks {
-			t.Run(string(fork), func(t *testing.T) {
-				RunHandler(t, runnerName+"/"+handlerName, caseRunner, &spec, fork)
-			})
-		}
-	})
-	t.Run("mainnet", func(t *testing.T) {
-		spec := *configs.Mainnet
+}
+
+func RunTransitionTest(t *testing.T, forks []ForkName, runnerName string, handlerName string, mkr TransitionCaseMaker) {
+	caseRunner := transitionCaseRunner(runnerName, handlerName, mkr)
+	for _, base := range Presets {
+		spec := *base
 		spec.ExecutionEngine = &NoOpExecutionEngine{}
-		for _, fork := range forks {
-			t.Run(string(fork), func(t *testing.T) {
-				RunHandler(t, runnerName+"/"+handlerName, caseRunner, &spec, fork)
-			})
-		}
-	})
+		t.Run(spec.PRESET_BASE, func(t *testing.T) {
+			for _, fork := range forks {
+				t.Run(string(fork), func(t *testing.T) {
+					RunHandler(t, runnerName+"/"+handlerName, caseRunner, &spec, fork)
+				})
+			}
+		})
+	}
 }
 
 type NoOpExecutionEngine struct{}